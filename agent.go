@@ -0,0 +1,95 @@
+package scout
+
+import (
+	"fmt"
+	"sort"
+)
+
+// remote reports whether the service is checked by remote agents instead of the scout
+func (s *Service) remote() bool {
+	return len(s.Agents) > 0
+}
+
+// assigned reports whether the agent checks the service
+func (s *Service) assigned(agent string) bool {
+	for _, a := range s.Agents {
+		if a == agent {
+			return true
+		}
+	}
+	return false
+}
+
+// Assigned returns the services the agent checks, sorted by ID
+func (s *Scout) Assigned(agent string) []*Service {
+	s.mux.RLock()
+	var servs []*Service
+	for _, serv := range s.Services {
+		if serv.assigned(agent) {
+			servs = append(servs, serv)
+		}
+	}
+	s.mux.RUnlock()
+	sort.Slice(servs, func(i, j int) bool { return servs[i].ID.String() < servs[j].ID.String() })
+	return servs
+}
+
+// Report records the ServiceSuccess or ServiceFailure of a check a remote agent ran of a service
+// assigned to it. The result is handled as if the scout had checked the service itself, it
+// updates the status, timeline and SLO of the service and is sent to the notifiers, with the
+// name of the agent in its details. A service with several agents is checked from every one of
+// them and its status decided by the quorum of their results, see Service.Quorum. The caller
+// authenticates the agent, the coordinator of grpcapi only reports for the agent of the principal
+func (s *Scout) Report(agent string, r Result) error {
+	serv := s.GetService(r.ServiceID())
+	if serv == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownService, r.ServiceID())
+	}
+	if !serv.assigned(agent) {
+		return fmt.Errorf("%w: %s %s", ErrNotAssigned, agent, serv.ID)
+	}
+	serv.checkMux.Lock()
+	defer serv.checkMux.Unlock()
+	if len(serv.Agents) > 1 {
+		loc := LocationResult{Agent: agent, CreatedAt: r.Time()}
+		switch r := r.(type) {
+		case ServiceSuccess:
+			loc.Online, loc.RequestLatency, loc.NetworkLatency = true, r.RequestLatency, r.NetworkLatency
+		case ServiceFailure:
+			loc.NetworkLatency, loc.Issue, loc.Class = r.NetworkLatency, r.Issue, r.Class
+		default:
+			return fmt.Errorf("scout: agent %s reported a %T, only checks are reported", agent, r)
+		}
+		serv.reportLocation(loc)
+		return nil
+	}
+	switch r := r.(type) {
+	case ServiceSuccess:
+		serv.Details = agentDetails(r.Details, agent)
+		serv.setRequestLatency(r.RequestLatency)
+		serv.setNetworkLatency(r.NetworkLatency)
+		serv.IPResults, serv.timings = r.IPResults, r.Timings
+		serv.TLSHandshake, serv.CertExpiry = r.TLSHandshake, r.CertExpiry
+		// the agent already held the latency against the thresholds of the service
+		serv.success(r.Degraded)
+	case ServiceFailure:
+		serv.Details = agentDetails(r.Details, agent)
+		serv.IPResults, serv.timings = r.IPResults, r.Timings
+		serv.setNetworkLatency(r.NetworkLatency)
+		serv.setStatusCode(r.ErrorCode)
+		serv.fail(r.Class, r.Err, r.Issue)
+	default:
+		return fmt.Errorf("scout: agent %s reported a %T, only checks are reported", agent, r)
+	}
+	return nil
+}
+
+// agentDetails returns a copy of the details of a result with the agent that checked the service
+func agentDetails(details map[string]string, agent string) map[string]string {
+	d := copyDetails(details)
+	if d == nil {
+		d = make(map[string]string, 1)
+	}
+	d["agent"] = agent
+	return d
+}
@@ -0,0 +1,568 @@
+package scout
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultAMQPPort  = 5672
+	defaultAMQPSPort = 5671
+
+	amqpFrameMethod    = 1
+	amqpFrameHeader    = 2
+	amqpFrameBody      = 3
+	amqpFrameHeartbeat = 8
+	amqpFrameEnd       = 0xCE
+
+	// amqpMaxCanaryGets bounds the messages fetched while looking for the canary
+	amqpMaxCanaryGets = 10
+)
+
+// amqp class and method ids of AMQP 0-9-1
+const (
+	amqpConnectionStart   = 10<<16 | 10
+	amqpConnectionStartOk = 10<<16 | 11
+	amqpConnectionTune    = 10<<16 | 30
+	amqpConnectionTuneOk  = 10<<16 | 31
+	amqpConnectionOpen    = 10<<16 | 40
+	amqpConnectionOpenOk  = 10<<16 | 41
+	amqpConnectionClose   = 10<<16 | 50
+	amqpConnectionCloseOk = 10<<16 | 51
+	amqpChannelOpen       = 20<<16 | 10
+	amqpChannelOpenOk     = 20<<16 | 11
+	amqpChannelClose      = 20<<16 | 40
+	amqpQueueDeclare      = 50<<16 | 10
+	amqpQueueDeclareOk    = 50<<16 | 11
+	amqpBasicPublish      = 60<<16 | 40
+	amqpBasicGet          = 60<<16 | 70
+	amqpBasicGetOk        = 60<<16 | 71
+	amqpBasicGetEmpty     = 60<<16 | 72
+	amqpBasicAck          = 60<<16 | 80
+	amqpBasicReject       = 60<<16 | 90
+	amqpConfirmSelect     = 85<<16 | 10
+	amqpConfirmSelectOk   = 85<<16 | 11
+)
+
+// AMQPConfig configures the AMQP check of a service
+type AMQPConfig struct {
+	// Queue is passively declared when it is set
+	Queue string `json:"queue"`
+	// Canary publishes a message to Queue and fetches it back
+	Canary bool `json:"canary"`
+}
+
+// CheckAMQP will open a AMQP 0-9-1 connection and channel to the broker of the URI (DSN or
+// Address, amqp:// or amqps://) and, when the Queue of the AMQP config is set, passively declare
+// the queue, failing
+// when it does not exist, with Canary a message is published to the queue with publisher confirms
+// and fetched back, the canary queue should not be shared with consumers, messages that are not
+// canaries are requeued and fail the check, the cluster name, product and version of the broker
+// are kept in Details, the publish round-trip is kept as the request latency when Canary is set
+func (s *Service) CheckAMQP() {
+	cfg := s.AMQP
+	if cfg == nil {
+		cfg = &AMQPConfig{}
+	}
+	uri := s.secret(s.DSN)
+	if uri == "" {
+		uri = s.Address
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		s.fail(FailureConfig, err, fmt.Sprintf("AMQP URI Error %v", err))
+		return
+	}
+	port := defaultAMQPPort
+	if u.Scheme == "amqps" {
+		port = defaultAMQPSPort
+	} else if u.Scheme != "amqp" {
+		s.fail(FailureConfig, nil, fmt.Sprintf("AMQP URI Error unsupported scheme %q", u.Scheme))
+		return
+	}
+	if p := u.Port(); p != "" {
+		port, _ = strconv.Atoi(p)
+	}
+	addr := net.JoinHostPort(u.Hostname(), strconv.Itoa(port))
+	user, pass := "guest", "guest"
+	if u.User != nil {
+		user = u.User.Username()
+		pass, _ = u.User.Password()
+	}
+	if s.Username != "" {
+		user, pass = s.secret(s.Username), s.secret(s.Password)
+	}
+	vhost := "/"
+	if len(u.Path) > 1 {
+		vhost, _ = url.PathUnescape(u.Path[1:])
+	}
+
+	t1 := time.Now()
+	conn, err := s.dial(s.network("tcp"), addr)
+	if err != nil {
+		s.fail(classifyError(err, false), err, fmt.Sprintf("Dial Error %v", err))
+		return
+	}
+	defer conn.Close()
+	if u.Scheme == "amqps" {
+		conn = tls.Client(conn, &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: !s.VerifySSL})
+	}
+	if err := conn.SetDeadline(s.deadline()); err != nil {
+		s.fail(FailureProtocol, err, fmt.Sprintf("AMQP Deadline Error %v", err))
+		return
+	}
+	s.setNetworkLatency(time.Since(t1).Milliseconds())
+
+	t2 := time.Now()
+	c := &amqpConn{w: conn, r: bufio.NewReader(conn)}
+	props, err := c.open(user, pass, vhost)
+	if err != nil {
+		s.fail(classifyError(err, true), err, fmt.Sprintf("AMQP Connection Error %v", err))
+		return
+	}
+	defer c.close()
+	s.setRequestLatency(time.Since(t2).Milliseconds())
+	s.Details = make(map[string]string)
+	for _, key := range []string{"cluster_name", "product", "version"} {
+		if v, ok := props[key].(string); ok {
+			s.Details[key] = v
+		}
+	}
+
+	if cfg.Queue == "" {
+		s.Success()
+		return
+	}
+	if err := c.call(1, amqpQueueDeclare, amqpQueueDeclareOk, func(w *amqpWriter) {
+		w.short(0)
+		w.shortstr(cfg.Queue)
+		w.octet(1) // passive
+		w.table()
+	}); err != nil {
+		s.fail(classifyError(err, true), err, fmt.Sprintf("AMQP Queue %v Error %v", cfg.Queue, err))
+		return
+	}
+	if !cfg.Canary {
+		s.Success()
+		return
+	}
+
+	canary := "scout canary " + uuid.New().String()
+	t3 := time.Now()
+	if err := c.publish(cfg.Queue, []byte(canary)); err != nil {
+		s.fail(classifyError(err, true), err, fmt.Sprintf("AMQP Publish Error %v", err))
+		return
+	}
+	s.setRequestLatency(time.Since(t3).Milliseconds())
+	s.Details["publishLatency"] = strconv.FormatInt(s.RequestLatency, 10)
+	if err := c.getCanary(cfg.Queue, canary); err != nil {
+		s.fail(classifyError(err, true), err, fmt.Sprintf("AMQP Get Error %v", err))
+		return
+	}
+	s.Success()
+}
+
+// amqpConn is a AMQP 0-9-1 connection, all methods after the handshake use channel 1
+type amqpConn struct {
+	w io.Writer
+	r *bufio.Reader
+}
+
+// amqpMethod is a method frame received from the broker
+type amqpMethod struct {
+	channel uint16
+	id      uint32
+	args    *amqpReader
+}
+
+// open runs the connection handshake with PLAIN authentication and opens channel 1, the
+// server properties of the broker are returned
+func (c *amqpConn) open(user, pass, vhost string) (map[string]interface{}, error) {
+	if _, err := io.WriteString(c.w, "AMQP\x00\x00\x09\x01"); err != nil {
+		return nil, err
+	}
+	start, err := c.expect(amqpConnectionStart)
+	if err != nil {
+		return nil, err
+	}
+	start.args.octet()
+	start.args.octet()
+	props := start.args.table()
+	if mechs := start.args.longstr(); !strings.Contains(mechs, "PLAIN") {
+		return nil, fmt.Errorf("broker does not support PLAIN authentication, only %v", mechs)
+	}
+	if err := c.send(0, amqpConnectionStartOk, func(w *amqpWriter) {
+		w.table("product", "phenixrizen-scout")
+		w.shortstr("PLAIN")
+		w.longstr("\x00" + user + "\x00" + pass)
+		w.shortstr("en_US")
+	}); err != nil {
+		return nil, err
+	}
+	tune, err := c.expect(amqpConnectionTune)
+	if err != nil {
+		return nil, err
+	}
+	channelMax, frameMax := tune.args.short(), tune.args.long()
+	if err := c.send(0, amqpConnectionTuneOk, func(w *amqpWriter) {
+		w.short(channelMax)
+		w.long(frameMax)
+		w.short(0) // no heartbeats
+	}); err != nil {
+		return nil, err
+	}
+	if err := c.call(0, amqpConnectionOpen, amqpConnectionOpenOk, func(w *amqpWriter) {
+		w.shortstr(vhost)
+		w.shortstr("")
+		w.octet(0)
+	}); err != nil {
+		return nil, err
+	}
+	if err := c.call(1, amqpChannelOpen, amqpChannelOpenOk, func(w *amqpWriter) {
+		w.shortstr("")
+	}); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+// publish sends body to queue through the default exchange and waits for the broker to confirm it
+func (c *amqpConn) publish(queue string, body []byte) error {
+	if err := c.call(1, amqpConfirmSelect, amqpConfirmSelectOk, func(w *amqpWriter) {
+		w.octet(0)
+	}); err != nil {
+		return err
+	}
+	if err := c.send(1, amqpBasicPublish, func(w *amqpWriter) {
+		w.short(0)
+		w.shortstr("")
+		w.shortstr(queue)
+		w.octet(1) // mandatory
+	}); err != nil {
+		return err
+	}
+	var header amqpWriter
+	header.short(60)
+	header.short(0)
+	header.longlong(uint64(len(body)))
+	header.short(0) // no properties
+	if err := c.frame(amqpFrameHeader, 1, header.b); err != nil {
+		return err
+	}
+	if err := c.frame(amqpFrameBody, 1, body); err != nil {
+		return err
+	}
+	_, err := c.expect(amqpBasicAck)
+	return err
+}
+
+// getCanary fetches messages from queue until it finds canary, other canaries are acknowledged
+// (dropped) and foreign messages are requeued
+func (c *amqpConn) getCanary(queue, canary string) error {
+	for i := 0; i < amqpMaxCanaryGets; i++ {
+		if err := c.send(1, amqpBasicGet, func(w *amqpWriter) {
+			w.short(0)
+			w.shortstr(queue)
+			w.octet(0)
+		}); err != nil {
+			return err
+		}
+		m, err := c.method()
+		if err != nil {
+			return err
+		}
+		switch m.id {
+		case amqpBasicGetEmpty:
+			return errors.New("canary message was not delivered")
+		case amqpBasicGetOk:
+		default:
+			return fmt.Errorf("unexpected method %v.%v", m.id>>16, m.id&0xffff)
+		}
+		tag := m.args.longlong()
+		body, err := c.content()
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(body, []byte("scout canary ")) {
+			c.send(1, amqpBasicReject, func(w *amqpWriter) {
+				w.longlong(tag)
+				w.octet(1) // requeue
+			})
+			return fmt.Errorf("queue %v holds messages that are not canaries", queue)
+		}
+		if err := c.send(1, amqpBasicAck, func(w *amqpWriter) {
+			w.longlong(tag)
+			w.octet(0)
+		}); err != nil {
+			return err
+		}
+		if string(body) == canary {
+			return nil
+		}
+	}
+	return fmt.Errorf("canary message not found within %v messages", amqpMaxCanaryGets)
+}
+
+// content reads the content header and body frames of a delivered message
+func (c *amqpConn) content() ([]byte, error) {
+	typ, _, payload, err := c.readFrame()
+	if err != nil {
+		return nil, err
+	}
+	if typ != amqpFrameHeader {
+		return nil, fmt.Errorf("expected content header, got frame type %v", typ)
+	}
+	h := &amqpReader{b: payload}
+	h.short()
+	h.short()
+	size := h.longlong()
+	if h.err != nil {
+		return nil, h.err
+	}
+	var body []byte
+	for uint64(len(body)) < size {
+		typ, _, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		if typ != amqpFrameBody {
+			return nil, fmt.Errorf("expected content body, got frame type %v", typ)
+		}
+		body = append(body, payload...)
+	}
+	return body, nil
+}
+
+// close closes the connection gracefully, errors are ignored as the check already completed
+func (c *amqpConn) close() {
+	c.call(0, amqpConnectionClose, amqpConnectionCloseOk, func(w *amqpWriter) {
+		w.short(200)
+		w.shortstr("scout check complete")
+		w.short(0)
+		w.short(0)
+	})
+}
+
+// call sends a method and waits for its reply
+func (c *amqpConn) call(channel uint16, id, reply uint32, args func(*amqpWriter)) error {
+	if err := c.send(channel, id, args); err != nil {
+		return err
+	}
+	_, err := c.expect(reply)
+	return err
+}
+
+func (c *amqpConn) send(channel uint16, id uint32, args func(*amqpWriter)) error {
+	var w amqpWriter
+	w.long(id)
+	args(&w)
+	return c.frame(amqpFrameMethod, channel, w.b)
+}
+
+func (c *amqpConn) frame(typ byte, channel uint16, payload []byte) error {
+	var w amqpWriter
+	w.octet(typ)
+	w.short(channel)
+	w.long(uint32(len(payload)))
+	w.b = append(w.b, payload...)
+	w.octet(amqpFrameEnd)
+	_, err := c.w.Write(w.b)
+	return err
+}
+
+// expect reads the next method, failing when it is not id, a close by the broker is returned
+// as a error with its reply code and text
+func (c *amqpConn) expect(id uint32) (*amqpMethod, error) {
+	m, err := c.method()
+	if err != nil {
+		return nil, err
+	}
+	if m.id != id {
+		return nil, fmt.Errorf("expected method %v.%v, got %v.%v", id>>16, id&0xffff, m.id>>16, m.id&0xffff)
+	}
+	return m, nil
+}
+
+// method reads the next method frame, skipping heartbeats
+func (c *amqpConn) method() (*amqpMethod, error) {
+	for {
+		typ, channel, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		if typ == amqpFrameHeartbeat {
+			continue
+		}
+		if typ != amqpFrameMethod {
+			return nil, fmt.Errorf("expected method frame, got frame type %v", typ)
+		}
+		r := &amqpReader{b: payload}
+		m := &amqpMethod{channel: channel, id: r.long(), args: r}
+		if r.err != nil {
+			return nil, r.err
+		}
+		if m.id == amqpConnectionClose || m.id == amqpChannelClose {
+			code, text := r.short(), r.shortstr()
+			return nil, fmt.Errorf("broker closed the %v: %v %v", map[uint32]string{amqpConnectionClose: "connection", amqpChannelClose: "channel"}[m.id], code, text)
+		}
+		return m, nil
+	}
+}
+
+func (c *amqpConn) readFrame() (byte, uint16, []byte, error) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(c.r, header); err != nil {
+		return 0, 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[3:])
+	if size > 1<<24 {
+		return 0, 0, nil, fmt.Errorf("amqp: frame of %v bytes is too large", size)
+	}
+	payload := make([]byte, size+1)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, 0, nil, err
+	}
+	if payload[size] != amqpFrameEnd {
+		return 0, 0, nil, errors.New("amqp: invalid frame end")
+	}
+	return header[0], binary.BigEndian.Uint16(header[1:]), payload[:size], nil
+}
+
+// amqpWriter encodes the AMQP 0-9-1 data types
+type amqpWriter struct {
+	b []byte
+}
+
+func (w *amqpWriter) octet(v byte)   { w.b = append(w.b, v) }
+func (w *amqpWriter) short(v uint16) { w.b = append(w.b, byte(v>>8), byte(v)) }
+func (w *amqpWriter) long(v uint32) {
+	w.b = append(w.b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+func (w *amqpWriter) longlong(v uint64) {
+	w.long(uint32(v >> 32))
+	w.long(uint32(v))
+}
+func (w *amqpWriter) shortstr(v string) {
+	w.octet(byte(len(v)))
+	w.b = append(w.b, v...)
+}
+func (w *amqpWriter) longstr(v string) {
+	w.long(uint32(len(v)))
+	w.b = append(w.b, v...)
+}
+
+// table encodes a field table of string values from key, value pairs
+func (w *amqpWriter) table(kv ...string) {
+	var t amqpWriter
+	for i := 0; i+1 < len(kv); i += 2 {
+		t.shortstr(kv[i])
+		t.octet('S')
+		t.longstr(kv[i+1])
+	}
+	w.long(uint32(len(t.b)))
+	w.b = append(w.b, t.b...)
+}
+
+// amqpReader decodes the AMQP 0-9-1 data types, the first error is kept and zero values are
+// returned after it
+type amqpReader struct {
+	b   []byte
+	err error
+}
+
+func (r *amqpReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.b) < n {
+		r.err = errors.New("amqp: truncated frame")
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *amqpReader) octet() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+func (r *amqpReader) short() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+func (r *amqpReader) long() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+func (r *amqpReader) longlong() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+func (r *amqpReader) shortstr() string { return string(r.next(int(r.octet()))) }
+func (r *amqpReader) longstr() string  { return string(r.next(int(r.long()))) }
+
+// table decodes a field table, long strings and nested tables are decoded, other values skipped
+func (r *amqpReader) table() map[string]interface{} {
+	t := &amqpReader{b: r.next(int(r.long()))}
+	fields := make(map[string]interface{})
+	for len(t.b) > 0 && t.err == nil {
+		key := t.shortstr()
+		if v := t.field(); v != nil {
+			fields[key] = v
+		}
+	}
+	if t.err != nil && r.err == nil {
+		r.err = t.err
+	}
+	return fields
+}
+
+func (r *amqpReader) field() interface{} {
+	switch typ := r.octet(); typ {
+	case 'S':
+		return r.longstr()
+	case 'F':
+		return r.table()
+	case 't':
+		return r.octet() != 0
+	case 'b', 'B':
+		r.next(1)
+	case 's', 'u':
+		r.next(2)
+	case 'I', 'i', 'f':
+		r.next(4)
+	case 'l', 'd', 'T':
+		r.next(8)
+	case 'D':
+		r.next(5)
+	case 'A', 'x':
+		r.next(int(r.long()))
+	case 'V':
+	default:
+		if r.err == nil {
+			r.err = fmt.Errorf("amqp: unknown field type %q", typ)
+		}
+	}
+	return nil
+}
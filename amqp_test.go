@@ -0,0 +1,148 @@
+package scout
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// amqpBroker is a broker with a single queue "canary" that stores the last message published
+func amqpBroker(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		c := &amqpConn{w: conn, r: bufio.NewReader(conn)}
+		io.ReadFull(c.r, make([]byte, 8))
+		c.send(0, amqpConnectionStart, func(w *amqpWriter) {
+			w.octet(0)
+			w.octet(9)
+			w.table("cluster_name", "rabbit@scout", "product", "RabbitMQ", "version", "3.13.0")
+			w.longstr("PLAIN AMQPLAIN")
+			w.longstr("en_US")
+		})
+		var message []byte
+		for {
+			m, err := c.method()
+			if err != nil {
+				return
+			}
+			reply := func(id uint32, args func(*amqpWriter)) { c.send(m.channel, id, args) }
+			none := func(*amqpWriter) {}
+			switch m.id {
+			case amqpConnectionStartOk:
+				m.args.table()
+				m.args.shortstr()
+				if m.args.longstr() != "\x00guest\x00guest" {
+					reply(amqpConnectionClose, func(w *amqpWriter) {
+						w.short(403)
+						w.shortstr("ACCESS_REFUSED")
+						w.short(0)
+						w.short(0)
+					})
+					return
+				}
+				reply(amqpConnectionTune, func(w *amqpWriter) {
+					w.short(2047)
+					w.long(131072)
+					w.short(60)
+				})
+			case amqpConnectionOpen:
+				reply(amqpConnectionOpenOk, func(w *amqpWriter) { w.shortstr("") })
+			case amqpChannelOpen:
+				reply(amqpChannelOpenOk, func(w *amqpWriter) { w.longstr("") })
+			case amqpQueueDeclare:
+				m.args.short()
+				if queue := m.args.shortstr(); queue != "canary" {
+					reply(amqpChannelClose, func(w *amqpWriter) {
+						w.short(404)
+						w.shortstr("NOT_FOUND - no queue '" + queue + "'")
+						w.short(50)
+						w.short(10)
+					})
+					continue
+				}
+				reply(amqpQueueDeclareOk, func(w *amqpWriter) {
+					w.shortstr("canary")
+					w.long(0)
+					w.long(0)
+				})
+			case amqpConfirmSelect:
+				reply(amqpConfirmSelectOk, none)
+			case amqpBasicPublish:
+				message, _ = c.content()
+				reply(amqpBasicAck, func(w *amqpWriter) {
+					w.longlong(1)
+					w.octet(0)
+				})
+			case amqpBasicGet:
+				if message == nil {
+					reply(amqpBasicGetEmpty, func(w *amqpWriter) { w.shortstr("") })
+					continue
+				}
+				reply(amqpBasicGetOk, func(w *amqpWriter) {
+					w.longlong(1)
+					w.octet(0)
+					w.shortstr("")
+					w.shortstr("canary")
+					w.long(0)
+				})
+				var header amqpWriter
+				header.short(60)
+				header.short(0)
+				header.longlong(uint64(len(message)))
+				header.short(0)
+				c.frame(amqpFrameHeader, 1, header.b)
+				c.frame(amqpFrameBody, 1, message)
+				message = nil
+			}
+		}
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestCheckAMQP(t *testing.T) {
+	assert := assert.New(t)
+
+	addr := amqpBroker(t)
+	serv := &Service{
+		ID:      uuid.New(),
+		Name:    "RabbitMQ",
+		Type:    "amqp",
+		Address: "amqp://" + addr + "/",
+		AMQP:    &AMQPConfig{Queue: "canary", Canary: true},
+		Timeout: Duration(2 * time.Second),
+		Logger:  NewSlogLogger(nil),
+	}
+	suc, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("rabbit@scout", suc.Details["cluster_name"])
+	assert.Contains(suc.Details, "publishLatency")
+
+	serv.AMQP.Queue = "missing"
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal("AMQP Queue missing Error broker closed the channel: 404 NOT_FOUND - no queue 'missing'", fail.Issue)
+
+	serv.Address = "amqp://scout:wrong@" + addr + "/"
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal("AMQP Connection Error broker closed the connection: 403 ACCESS_REFUSED", fail.Issue)
+}
@@ -0,0 +1,131 @@
+package scout
+
+import (
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// AnomalyLatency is the metric of anomalies in the request latency of successful checks
+	AnomalyLatency = "latency"
+	// AnomalyAvailability is the metric of anomalies in the recent success rate of the checks
+	AnomalyAvailability = "availability"
+
+	// anomalyAlpha weighs a new sample into the learned band of a metric
+	anomalyAlpha = 0.05
+	// availabilityAlpha weighs a check into the recent success rate
+	availabilityAlpha = 0.3
+	// anomalyWarmup is the number of samples learned before anomalies are detected
+	anomalyWarmup = 20
+)
+
+// ServiceAnomaly is sent on the Response Channel when a metric of a service with AnomalySigma
+// deviates more than AnomalySigma standard deviations from its learned band, it is sent once
+// until the metric is back within the band
+type ServiceAnomaly struct {
+	Service   uuid.UUID `json:"service"`
+	Metric    string    `json:"metric"`
+	Value     float64   `json:"value"`
+	Mean      float64   `json:"mean"`
+	StdDev    float64   `json:"stdDev"`
+	ZScore    float64   `json:"zScore"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ServiceID returns the ID of the service with the anomaly
+func (r ServiceAnomaly) ServiceID() uuid.UUID { return r.Service }
+
+// Time returns when the anomaly was detected
+func (r ServiceAnomaly) Time() time.Time { return r.CreatedAt }
+
+// ewma learns the exponentially weighted mean and variance of a metric
+type ewma struct {
+	mean      float64
+	variance  float64
+	samples   int
+	anomalous bool
+	// minStdDev keeps a metric that never varied from flagging every change
+	minStdDev float64
+}
+
+// add learns x and returns its z-score against the band before it was added, the score is 0
+// while the band is warming up
+func (e *ewma) add(x float64) float64 {
+	z := 0.0
+	if e.samples >= anomalyWarmup {
+		z = (x - e.mean) / e.stdDev()
+	}
+	if e.samples == 0 {
+		e.mean = x
+	} else {
+		diff := x - e.mean
+		incr := anomalyAlpha * diff
+		e.mean += incr
+		e.variance = (1 - anomalyAlpha) * (e.variance + diff*incr)
+	}
+	e.samples++
+	return z
+}
+
+func (e *ewma) stdDev() float64 {
+	return math.Max(math.Sqrt(e.variance), e.minStdDev)
+}
+
+// anomalyDetector learns the latency and availability bands of a service
+type anomalyDetector struct {
+	latency      ewma
+	availability ewma
+	recent       float64
+}
+
+// detectAnomalies learns the result of the last check and sends a ServiceAnomaly for the
+// metrics that left their band
+func (s *Service) detectAnomalies(ok bool) {
+	if s.AnomalySigma <= 0 {
+		return
+	}
+	if s.anomaly == nil {
+		s.anomaly = &anomalyDetector{
+			latency:      ewma{minStdDev: 1},
+			availability: ewma{minStdDev: 0.01},
+			recent:       1,
+		}
+	}
+	d := s.anomaly
+	x := 0.0
+	if ok {
+		x = 1
+	}
+	d.recent += availabilityAlpha * (x - d.recent)
+	// only a drop of the availability is a anomaly
+	s.checkAnomaly(&d.availability, AnomalyAvailability, d.recent, func(z float64) bool { return z < -s.AnomalySigma })
+	if ok {
+		s.checkAnomaly(&d.latency, AnomalyLatency, float64(s.RequestLatency), func(z float64) bool { return math.Abs(z) > s.AnomalySigma })
+	}
+}
+
+// checkAnomaly adds x to the band of the metric and sends a ServiceAnomaly when it becomes
+// anomalous
+func (s *Service) checkAnomaly(e *ewma, metric string, x float64, anomalous func(z float64) bool) {
+	mean, stdDev := e.mean, e.stdDev()
+	z := e.add(x)
+	if !anomalous(z) {
+		e.anomalous = false
+		return
+	}
+	if e.anomalous {
+		return
+	}
+	e.anomalous = true
+	s.emit(ServiceAnomaly{
+		Service:   s.ID,
+		Metric:    metric,
+		Value:     x,
+		Mean:      mean,
+		StdDev:    stdDev,
+		ZScore:    z,
+		CreatedAt: time.Now().UTC(),
+	})
+}
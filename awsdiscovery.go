@@ -0,0 +1,412 @@
+package scout
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// AWSInstances discovers the running EC2 instances matching the tag filters
+	AWSInstances = "ec2"
+	// AWSLoadBalancers discovers the active application and network load balancers matching the
+	// tag filters
+	AWSLoadBalancers = "elb"
+
+	ec2APIVersion = "2016-11-15"
+	elbAPIVersion = "2015-12-01"
+	// elbTagBatch is the most load balancers DescribeTags accepts at once
+	elbTagBatch = 20
+)
+
+// AWSDiscovery is a Discoverer with a service for every EC2 instance and load balancer of the
+// Regions matching the tag Filters, a filter with a empty value matches any value of the tag.
+// The services check the public address of a instance, or its private address when Private is
+// set, and the DNS name of a load balancer with a tcp check on Port (443 by default), a http
+// check of Scheme://address:Port/Path or a icmp check depending on Type. The credentials are
+// taken from $AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY and $AWS_SESSION_TOKEN unless set
+type AWSDiscovery struct {
+	Regions         []string          `json:"regions"`
+	Sources         []string          `json:"sources"`
+	Filters         map[string]string `json:"filters"`
+	Private         bool              `json:"private"`
+	Type            string            `json:"type"`
+	Port            int               `json:"port"`
+	Scheme          string            `json:"scheme"`
+	Path            string            `json:"path"`
+	Template        string            `json:"template"`
+	Interval        Duration          `json:"checkInterval"`
+	AccessKeyID     string            `json:"accessKeyId"`
+	SecretAccessKey string            `json:"secretAccessKey"`
+	SessionToken    string            `json:"sessionToken"`
+	// Endpoint replaces the AWS endpoints of every region, e.g. for a VPC endpoint or a test
+	Endpoint string       `json:"endpoint"`
+	Client   *http.Client `json:"-"`
+}
+
+// awsTarget is a discovered instance or load balancer
+type awsTarget struct {
+	id, name, host string
+	tags           map[string]string
+}
+
+// Discover lists the instances and load balancers of every region, it fails when one of the
+// regions can not be listed so its services are kept
+func (d *AWSDiscovery) Discover(ctx context.Context) ([]*Service, error) {
+	creds, err := d.credentials()
+	if err != nil {
+		return nil, err
+	}
+	sources := d.Sources
+	if len(sources) == 0 {
+		sources = []string{AWSInstances, AWSLoadBalancers}
+	}
+	var servs []*Service
+	for _, region := range d.Regions {
+		for _, source := range sources {
+			var targets []awsTarget
+			switch source {
+			case AWSInstances:
+				targets, err = d.instances(ctx, creds, region)
+			case AWSLoadBalancers:
+				targets, err = d.loadBalancers(ctx, creds, region)
+			default:
+				err = fmt.Errorf("unknown source %q", source)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("aws %s %s: %w", source, region, err)
+			}
+			for _, t := range targets {
+				servs = append(servs, d.service(source, region, t))
+			}
+		}
+	}
+	return servs, nil
+}
+
+// service returns the check of a discovered target
+func (d *AWSDiscovery) service(source, region string, t awsTarget) *Service {
+	port := d.Port
+	if port == 0 {
+		port = 443
+	}
+	serv := &Service{
+		ExternalID: "aws:" + source + ":" + region + ":" + t.id,
+		Name:       t.name,
+		Type:       "tcp",
+		Address:    t.host,
+		Port:       port,
+		Template:   d.Template,
+		Interval:   d.Interval,
+		Tags:       map[string]string{"aws-region": region, "aws-source": source},
+	}
+	for k, v := range t.tags {
+		serv.Tags[k] = v
+	}
+	switch d.Type {
+	case "http":
+		scheme := d.Scheme
+		if scheme == "" {
+			scheme = "https"
+		}
+		serv.Type, serv.Port = "http", 0
+		serv.Address = scheme + "://" + net.JoinHostPort(t.host, strconv.Itoa(port)) + "/" + strings.TrimPrefix(d.Path, "/")
+	case "icmp":
+		serv.Type, serv.Port = "icmp", 0
+	}
+	return serv
+}
+
+// instances lists the running instances of the region matching the filters
+func (d *AWSDiscovery) instances(ctx context.Context, creds awsCredentials, region string) ([]awsTarget, error) {
+	params := url.Values{"Action": {"DescribeInstances"}, "Version": {ec2APIVersion}}
+	params.Set("Filter.1.Name", "instance-state-name")
+	params.Set("Filter.1.Value.1", "running")
+	n := 2
+	for _, key := range sortedKeys(d.Filters) {
+		if v := d.Filters[key]; v != "" {
+			params.Set("Filter."+strconv.Itoa(n)+".Name", "tag:"+key)
+			params.Set("Filter."+strconv.Itoa(n)+".Value.1", v)
+		} else {
+			params.Set("Filter."+strconv.Itoa(n)+".Name", "tag-key")
+			params.Set("Filter."+strconv.Itoa(n)+".Value.1", key)
+		}
+		n++
+	}
+	var targets []awsTarget
+	for {
+		var resp struct {
+			Reservations []struct {
+				Instances []struct {
+					ID        string   `xml:"instanceId"`
+					PublicIP  string   `xml:"ipAddress"`
+					PrivateIP string   `xml:"privateIpAddress"`
+					Tags      []awsTag `xml:"tagSet>item"`
+				} `xml:"instancesSet>item"`
+			} `xml:"reservationSet>item"`
+			NextToken string `xml:"nextToken"`
+		}
+		if err := d.call(ctx, creds, "ec2", region, params, &resp); err != nil {
+			return nil, err
+		}
+		for _, r := range resp.Reservations {
+			for _, i := range r.Instances {
+				host := i.PublicIP
+				if d.Private {
+					host = i.PrivateIP
+				}
+				if host == "" {
+					continue
+				}
+				tags := awsTags(i.Tags)
+				name := tags["Name"]
+				if name == "" {
+					name = i.ID
+				}
+				targets = append(targets, awsTarget{id: i.ID, name: name, host: host, tags: tags})
+			}
+		}
+		if resp.NextToken == "" {
+			return targets, nil
+		}
+		params.Set("NextToken", resp.NextToken)
+	}
+}
+
+// loadBalancers lists the active load balancers of the region matching the filters
+func (d *AWSDiscovery) loadBalancers(ctx context.Context, creds awsCredentials, region string) ([]awsTarget, error) {
+	params := url.Values{"Action": {"DescribeLoadBalancers"}, "Version": {elbAPIVersion}}
+	var lbs []awsTarget
+	for {
+		var resp struct {
+			LoadBalancers []struct {
+				ARN   string `xml:"LoadBalancerArn"`
+				Name  string `xml:"LoadBalancerName"`
+				DNS   string `xml:"DNSName"`
+				State string `xml:"State>Code"`
+			} `xml:"DescribeLoadBalancersResult>LoadBalancers>member"`
+			NextMarker string `xml:"DescribeLoadBalancersResult>NextMarker"`
+		}
+		if err := d.call(ctx, creds, "elasticloadbalancing", region, params, &resp); err != nil {
+			return nil, err
+		}
+		for _, lb := range resp.LoadBalancers {
+			if lb.State == "active" {
+				lbs = append(lbs, awsTarget{id: lb.ARN, name: lb.Name, host: lb.DNS})
+			}
+		}
+		if resp.NextMarker == "" {
+			break
+		}
+		params.Set("Marker", resp.NextMarker)
+	}
+
+	// the tags of the load balancers are listed separately
+	for start := 0; start < len(lbs); start += elbTagBatch {
+		end := start + elbTagBatch
+		if end > len(lbs) {
+			end = len(lbs)
+		}
+		params := url.Values{"Action": {"DescribeTags"}, "Version": {elbAPIVersion}}
+		for i, lb := range lbs[start:end] {
+			params.Set("ResourceArns.member."+strconv.Itoa(i+1), lb.id)
+		}
+		var resp struct {
+			Descriptions []struct {
+				ARN  string   `xml:"ResourceArn"`
+				Tags []awsTag `xml:"Tags>member"`
+			} `xml:"DescribeTagsResult>TagDescriptions>member"`
+		}
+		if err := d.call(ctx, creds, "elasticloadbalancing", region, params, &resp); err != nil {
+			return nil, err
+		}
+		for _, desc := range resp.Descriptions {
+			for i := start; i < end; i++ {
+				if lbs[i].id == desc.ARN {
+					lbs[i].tags = awsTags(desc.Tags)
+				}
+			}
+		}
+	}
+	targets := lbs[:0]
+	for _, lb := range lbs {
+		if d.matches(lb.tags) {
+			targets = append(targets, lb)
+		}
+	}
+	return targets, nil
+}
+
+// matches reports whether tags has every tag filter
+func (d *AWSDiscovery) matches(tags map[string]string) bool {
+	for k, v := range d.Filters {
+		got, ok := tags[k]
+		if !ok || (v != "" && got != v) {
+			return false
+		}
+	}
+	return true
+}
+
+// call sends the signed query API request and decodes its XML response into v
+func (d *AWSDiscovery) call(ctx context.Context, creds awsCredentials, service, region string, params url.Values, v interface{}) error {
+	endpoint := d.Endpoint
+	if endpoint == "" {
+		endpoint = "https://" + service + "." + region + ".amazonaws.com"
+	}
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/") + "/")
+	if err != nil {
+		return err
+	}
+	u.RawQuery = awsQuery(params)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	creds.sign(req, service, region, time.Now().UTC())
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Code    string `xml:"Errors>Error>Code"`
+			Message string `xml:"Errors>Error>Message"`
+			// ELB nests its error differently from EC2
+			ELBCode    string `xml:"Error>Code"`
+			ELBMessage string `xml:"Error>Message"`
+		}
+		xml.Unmarshal(body, &apiErr)
+		if apiErr.Code == "" {
+			apiErr.Code, apiErr.Message = apiErr.ELBCode, apiErr.ELBMessage
+		}
+		return fmt.Errorf("%s %s: %s %s", params.Get("Action"), resp.Status, apiErr.Code, apiErr.Message)
+	}
+	return xml.Unmarshal(body, v)
+}
+
+// credentials returns the credentials of the discovery or of the environment
+func (d *AWSDiscovery) credentials() (awsCredentials, error) {
+	creds := awsCredentials{d.AccessKeyID, d.SecretAccessKey, d.SessionToken}
+	if creds.accessKeyID == "" {
+		creds = awsCredentials{os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")}
+	}
+	if creds.accessKeyID == "" || creds.secretAccessKey == "" {
+		return creds, errors.New("aws: no credentials")
+	}
+	return creds, nil
+}
+
+type awsTag struct {
+	Key   string `xml:"key"`
+	Value string `xml:"value"`
+	// ELB capitalizes the elements of its tags
+	ELBKey   string `xml:"Key"`
+	ELBValue string `xml:"Value"`
+}
+
+func awsTags(tags []awsTag) map[string]string {
+	m := make(map[string]string, len(tags))
+	for _, t := range tags {
+		if t.Key != "" {
+			m[t.Key] = t.Value
+		} else {
+			m[t.ELBKey] = t.ELBValue
+		}
+	}
+	return m
+}
+
+type awsCredentials struct {
+	accessKeyID, secretAccessKey, sessionToken string
+}
+
+// sign signs the request without a body with AWS Signature Version 4
+func (c awsCredentials) sign(req *http.Request, service, region string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	headers := "host:" + req.URL.Host + "\nx-amz-date:" + amzDate + "\n"
+	signed := "host;x-amz-date"
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+		headers += "x-amz-security-token:" + c.sessionToken + "\n"
+		signed += ";x-amz-security-token"
+	}
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	emptyHash := sha256.Sum256(nil)
+	canonical := strings.Join([]string{req.Method, path, req.URL.RawQuery, headers, signed, hex.EncodeToString(emptyHash[:])}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := []byte("AWS4" + c.secretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.accessKeyID+"/"+scope+", SignedHeaders="+signed+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsQuery encodes params sorted by key with the RFC 3986 escaping signatures expect
+func awsQuery(params url.Values) string {
+	parts := make([]string, 0, len(params))
+	for _, k := range sortedKeys(params) {
+		for _, v := range params[k] {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func awsEscape(s string) string {
+	return strings.NewReplacer("+", "%20", "%7E", "~").Replace(url.QueryEscape(s))
+}
+
+// sortedKeys returns the keys of a map of strings or url.Values in order
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]string:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case url.Values:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,118 @@
+package scout
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAWSSign(t *testing.T) {
+	// the get-vanilla case of the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	creds := awsCredentials{accessKeyID: "AKIDEXAMPLE", secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	creds.sign(req, "service", "us-east-1", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31", req.Header.Get("Authorization"))
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+}
+
+func TestAWSDiscovery(t *testing.T) {
+	assert := assert.New(t)
+
+	lbState := "active"
+	aws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`<Response><Errors><Error><Code>AuthFailure</Code><Message>bad signature</Message></Error></Errors></Response>`))
+			return
+		}
+		q := r.URL.Query()
+		switch q.Get("Action") {
+		case "DescribeInstances":
+			assert.Equal("instance-state-name", q.Get("Filter.1.Name"))
+			if q.Get("Filter.2.Name") != "" {
+				assert.Equal("tag:env", q.Get("Filter.2.Name"))
+				assert.Equal("prod", q.Get("Filter.2.Value.1"))
+			}
+			if q.Get("NextToken") == "" {
+				w.Write([]byte(`<DescribeInstancesResponse><reservationSet><item><instancesSet>
+<item><instanceId>i-1</instanceId><ipAddress>203.0.113.1</ipAddress><privateIpAddress>10.0.0.1</privateIpAddress>
+<tagSet><item><key>Name</key><value>web</value></item><item><key>env</key><value>prod</value></item></tagSet></item>
+<item><instanceId>i-2</instanceId><privateIpAddress>10.0.0.2</privateIpAddress></item>
+</instancesSet></item></reservationSet><nextToken>page2</nextToken></DescribeInstancesResponse>`))
+				return
+			}
+			w.Write([]byte(`<DescribeInstancesResponse><reservationSet><item><instancesSet>
+<item><instanceId>i-3</instanceId><ipAddress>203.0.113.3</ipAddress></item>
+</instancesSet></item></reservationSet></DescribeInstancesResponse>`))
+		case "DescribeLoadBalancers":
+			w.Write([]byte(`<DescribeLoadBalancersResponse><DescribeLoadBalancersResult><LoadBalancers>
+<member><LoadBalancerArn>arn:lb/api</LoadBalancerArn><LoadBalancerName>api</LoadBalancerName><DNSName>api.elb.example</DNSName><State><Code>` + lbState + `</Code></State></member>
+<member><LoadBalancerArn>arn:lb/dev</LoadBalancerArn><LoadBalancerName>dev</LoadBalancerName><DNSName>dev.elb.example</DNSName><State><Code>active</Code></State></member>
+</LoadBalancers></DescribeLoadBalancersResult></DescribeLoadBalancersResponse>`))
+		case "DescribeTags":
+			w.Write([]byte(`<DescribeTagsResponse><DescribeTagsResult><TagDescriptions>
+<member><ResourceArn>arn:lb/api</ResourceArn><Tags><member><Key>env</Key><Value>prod</Value></member></Tags></member>
+<member><ResourceArn>arn:lb/dev</ResourceArn><Tags><member><Key>env</Key><Value>dev</Value></member></Tags></member>
+</TagDescriptions></DescribeTagsResult></DescribeTagsResponse>`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer aws.Close()
+
+	d := &AWSDiscovery{
+		Regions:         []string{"eu-west-1"},
+		Filters:         map[string]string{"env": "prod"},
+		Port:            8443,
+		Interval:        Duration(time.Minute),
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		Endpoint:        aws.URL,
+	}
+	s, err := NewScout(nil, NewSlogLogger(nil), WithDiscovery("aws", d, time.Minute))
+	assert.Nil(err)
+	ctx := context.Background()
+
+	assert.Nil(s.Discover(ctx))
+	assert.Len(s.GetServices(), 3)
+	web := s.GetServiceByExternalID("aws:ec2:eu-west-1:i-1")
+	if assert.NotNil(web) {
+		assert.Equal("web", web.Name)
+		assert.Equal("tcp", web.Type)
+		assert.Equal("203.0.113.1", web.Address)
+		assert.Equal(8443, web.Port)
+		assert.Equal("prod", web.Tags["env"])
+		assert.Equal("eu-west-1", web.Tags["aws-region"])
+	}
+	assert.NotNil(s.GetServiceByExternalID("aws:ec2:eu-west-1:i-3"))
+	api := s.GetServiceByExternalID("aws:elb:eu-west-1:arn:lb/api")
+	if assert.NotNil(api) {
+		assert.Equal("api.elb.example", api.Address)
+	}
+
+	// a load balancer that is no longer active is removed
+	lbState = "provisioning"
+	assert.Nil(s.Discover(ctx))
+	assert.Len(s.GetServices(), 2)
+	assert.Nil(s.GetServiceByExternalID("aws:elb:eu-west-1:arn:lb/api"))
+
+	// private addresses, and failing calls keep the services
+	servs, err := (&AWSDiscovery{Regions: []string{"eu-west-1"}, Sources: []string{AWSInstances}, Private: true, Type: "http", Path: "/health",
+		AccessKeyID: "AKID", SecretAccessKey: "secret", Endpoint: aws.URL}).Discover(ctx)
+	assert.Nil(err)
+	if assert.Len(servs, 2) {
+		assert.Equal("https://10.0.0.1:443/health", servs[0].Address)
+		assert.Equal("i-2", servs[1].Name)
+	}
+	d.AccessKeyID = "wrong"
+	err = s.Discover(ctx)
+	if assert.NotNil(err) {
+		assert.Contains(err.Error(), "AuthFailure")
+	}
+	assert.Len(s.GetServices(), 2)
+}
@@ -0,0 +1,187 @@
+package scout
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ber.go holds the small subset of ASN.1 BER used by the LDAP and SNMP checks
+
+var errBERTruncated = errors.New("ber: truncated value")
+
+// berTLV encodes a tag-length-value with a definite length
+func berTLV(tag byte, value []byte) []byte {
+	b := append([]byte{tag}, berLength(len(value))...)
+	return append(b, value...)
+}
+
+// berLength encodes a definite length in short or long form
+func berLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var l []byte
+	for ; n > 0; n >>= 8 {
+		l = append([]byte{byte(n)}, l...)
+	}
+	return append([]byte{0x80 | byte(len(l))}, l...)
+}
+
+// berInt encodes a integer with tag in the minimum number of two's complement octets
+func berInt(tag byte, v int64) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(v)}, b...)
+		if (v >= -128 && v < 128) || len(b) == 8 {
+			break
+		}
+		v >>= 8
+	}
+	return berTLV(tag, b)
+}
+
+// berSeq encodes the concatenated values as a constructed tag
+func berSeq(tag byte, values ...[]byte) []byte {
+	var b []byte
+	for _, v := range values {
+		b = append(b, v...)
+	}
+	return berTLV(tag, b)
+}
+
+// berParse splits the first tag-length-value off b
+func berParse(b []byte) (tag byte, value, rest []byte, err error) {
+	if len(b) < 2 {
+		return 0, nil, nil, errBERTruncated
+	}
+	tag = b[0]
+	n := int(b[1])
+	b = b[2:]
+	if n&0x80 != 0 {
+		octets := n & 0x7f
+		if octets == 0 || octets > 4 || len(b) < octets {
+			return 0, nil, nil, errors.New("ber: unsupported length")
+		}
+		n = 0
+		for _, o := range b[:octets] {
+			n = n<<8 | int(o)
+		}
+		b = b[octets:]
+	}
+	if len(b) < n {
+		return 0, nil, nil, errBERTruncated
+	}
+	return tag, b[:n], b[n:], nil
+}
+
+// berParseInt decodes the value of a integer
+func berParseInt(value []byte) int64 {
+	var v int64
+	for i, o := range value {
+		if i == 0 && o&0x80 != 0 {
+			v = -1
+		}
+		v = v<<8 | int64(o)
+	}
+	return v
+}
+
+// berRead reads one complete tag-length-value from r and returns it undecoded
+func berRead(r io.Reader) ([]byte, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	n := int(head[1])
+	if n&0x80 != 0 {
+		octets := n & 0x7f
+		if octets == 0 || octets > 4 {
+			return nil, errors.New("ber: unsupported length")
+		}
+		l := make([]byte, octets)
+		if _, err := io.ReadFull(r, l); err != nil {
+			return nil, err
+		}
+		head = append(head, l...)
+		n = 0
+		for _, o := range l {
+			n = n<<8 | int(o)
+		}
+	}
+	value := make([]byte, n)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return nil, err
+	}
+	return append(head, value...), nil
+}
+
+// berOID encodes a dotted object identifier
+func berOID(oid string) ([]byte, error) {
+	arcs, err := parseOID(oid)
+	if err != nil {
+		return nil, err
+	}
+	b := []byte{byte(arcs[0]*40 + arcs[1])}
+	for _, arc := range arcs[2:] {
+		var enc []byte
+		enc = append(enc, byte(arc&0x7f))
+		for arc >>= 7; arc > 0; arc >>= 7 {
+			enc = append([]byte{byte(arc&0x7f) | 0x80}, enc...)
+		}
+		b = append(b, enc...)
+	}
+	return berTLV(0x06, b), nil
+}
+
+// parseOID splits a dotted object identifier into its arcs
+func parseOID(oid string) ([]uint64, error) {
+	parts := strings.Split(strings.TrimPrefix(oid, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("ber: invalid oid %q", oid)
+	}
+	arcs := make([]uint64, len(parts))
+	for i, p := range parts {
+		arc, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ber: invalid oid %q", oid)
+		}
+		arcs[i] = arc
+	}
+	if arcs[0] > 2 || (arcs[0] < 2 && arcs[1] > 39) {
+		return nil, fmt.Errorf("ber: invalid oid %q", oid)
+	}
+	return arcs, nil
+}
+
+// berParseOID decodes the value of a object identifier into its dotted form
+func berParseOID(value []byte) string {
+	if len(value) == 0 {
+		return ""
+	}
+	first := uint64(value[0])
+	arcs := []string{strconv.FormatUint(first/40, 10), strconv.FormatUint(first%40, 10)}
+	if first >= 80 {
+		arcs = []string{"2", strconv.FormatUint(first-80, 10)}
+	}
+	var arc uint64
+	for _, o := range value[1:] {
+		arc = arc<<7 | uint64(o&0x7f)
+		if o&0x80 == 0 {
+			arcs = append(arcs, strconv.FormatUint(arc, 10))
+			arc = 0
+		}
+	}
+	return strings.Join(arcs, ".")
+}
+
+// berParseUint decodes the value of a unsigned integer (Counter32, Gauge32, TimeTicks, Counter64)
+func berParseUint(value []byte) uint64 {
+	var v uint64
+	for _, o := range value {
+		v = v<<8 | uint64(o)
+	}
+	return v
+}
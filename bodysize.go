@@ -0,0 +1,45 @@
+package scout
+
+import "fmt"
+
+// readLimit returns the most of a response body the requests of the service read into memory,
+// its ReadLimit or DefaultReadLimit, raised to MinBodyBytes and MaxBodyBytes so a truncated body
+// is always above both
+func (s *Service) readLimit() int64 {
+	limit := s.ReadLimit
+	if limit <= 0 {
+		limit = DefaultReadLimit
+	}
+	if s.MinBodyBytes > limit {
+		limit = s.MinBodyBytes
+	}
+	if s.MaxBodyBytes > limit {
+		limit = s.MaxBodyBytes
+	}
+	return limit
+}
+
+// verifyBodySize matches the size of the body read by a request against the MinBodyBytes and
+// MaxBodyBytes of the service and returns the issue when it is out of bounds
+func (s *Service) verifyBodySize(m *HTTPRequestMetrics) string {
+	if s.MaxBodyBytes > 0 && (m.BodyBytes > s.MaxBodyBytes || m.Truncated) {
+		s.classify(FailureBodyMismatch, nil)
+		if m.Truncated {
+			return fmt.Sprintf("HTTP Response Body of more than %d bytes exceeds the maximum of %d", m.BodyBytes, s.MaxBodyBytes)
+		}
+		return fmt.Sprintf("HTTP Response Body of %d bytes exceeds the maximum of %d", m.BodyBytes, s.MaxBodyBytes)
+	}
+	if m.BodyBytes < s.MinBodyBytes {
+		s.classify(FailureBodyMismatch, nil)
+		return fmt.Sprintf("HTTP Response Body of %d bytes is below the minimum of %d", m.BodyBytes, s.MinBodyBytes)
+	}
+	return ""
+}
+
+// response returns the body read by the request for LastResponse, noting when it was truncated
+func (m *HTTPRequestMetrics) response(content []byte) string {
+	if m == nil || !m.Truncated {
+		return string(content)
+	}
+	return fmt.Sprintf("%s\n[truncated after %d bytes]", content, len(content))
+}
@@ -0,0 +1,151 @@
+package scout
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// bson.go holds the small subset of BSON used by the MongoDB check
+
+var errBSONTruncated = errors.New("bson: truncated document")
+
+// bsonElem is a key and a int32, float64, bool or string value of a BSON document
+type bsonElem struct {
+	key   string
+	value interface{}
+}
+
+// bsonDoc encodes the elements as a BSON document, keeping their order
+func bsonDoc(elems ...bsonElem) []byte {
+	b := make([]byte, 4)
+	for _, e := range elems {
+		switch v := e.value.(type) {
+		case int32:
+			b = append(b, 0x10)
+			b = append(append(b, e.key...), 0)
+			b = appendInt32(b, uint32(v))
+		case float64:
+			b = append(b, 0x01)
+			b = append(append(b, e.key...), 0)
+			bits := math.Float64bits(v)
+			b = appendInt32(appendInt32(b, uint32(bits)), uint32(bits>>32))
+		case bool:
+			b = append(b, 0x08)
+			b = append(append(b, e.key...), 0)
+			if v {
+				b = append(b, 1)
+			} else {
+				b = append(b, 0)
+			}
+		case string:
+			b = append(b, 0x02)
+			b = append(append(b, e.key...), 0)
+			b = appendInt32(b, uint32(len(v)+1))
+			b = append(append(b, v...), 0)
+		}
+	}
+	b = append(b, 0)
+	binary.LittleEndian.PutUint32(b, uint32(len(b)))
+	return b
+}
+
+// appendInt32 appends v in little endian byte order
+func appendInt32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+// bsonParse decodes a BSON document, doubles, strings, booleans, integers, documents and arrays
+// are decoded (arrays as documents keyed by index), other values are skipped
+func bsonParse(b []byte) (map[string]interface{}, error) {
+	if len(b) < 5 {
+		return nil, errBSONTruncated
+	}
+	n := int(binary.LittleEndian.Uint32(b))
+	if n < 5 || n > len(b) {
+		return nil, errBSONTruncated
+	}
+	b = b[4 : n-1]
+	doc := make(map[string]interface{})
+	for len(b) > 0 {
+		typ := b[0]
+		end := 1
+		for end < len(b) && b[end] != 0 {
+			end++
+		}
+		if end == len(b) {
+			return nil, errBSONTruncated
+		}
+		key := string(b[1:end])
+		b = b[end+1:]
+		size, err := bsonValueSize(typ, b)
+		if err != nil {
+			return nil, err
+		}
+		if size > len(b) {
+			return nil, errBSONTruncated
+		}
+		v := b[:size]
+		switch typ {
+		case 0x01:
+			doc[key] = math.Float64frombits(binary.LittleEndian.Uint64(v))
+		case 0x02:
+			doc[key] = string(v[4 : size-1])
+		case 0x03, 0x04:
+			sub, err := bsonParse(v)
+			if err != nil {
+				return nil, err
+			}
+			doc[key] = sub
+		case 0x08:
+			doc[key] = v[0] != 0
+		case 0x10:
+			doc[key] = int32(binary.LittleEndian.Uint32(v))
+		case 0x12:
+			doc[key] = int64(binary.LittleEndian.Uint64(v))
+		}
+		b = b[size:]
+	}
+	return doc, nil
+}
+
+// bsonValueSize returns the encoded size of the value of type typ at the start of b
+func bsonValueSize(typ byte, b []byte) (int, error) {
+	length := func(extra int) (int, error) {
+		if len(b) < 4 {
+			return 0, errBSONTruncated
+		}
+		return int(binary.LittleEndian.Uint32(b)) + extra, nil
+	}
+	switch typ {
+	case 0x01, 0x09, 0x11, 0x12:
+		return 8, nil
+	case 0x02, 0x0D, 0x0E:
+		return length(4)
+	case 0x03, 0x04, 0x0F:
+		return length(0)
+	case 0x05:
+		return length(5)
+	case 0x07:
+		return 12, nil
+	case 0x08:
+		return 1, nil
+	case 0x06, 0x0A, 0x7F, 0xFF:
+		return 0, nil
+	case 0x0B:
+		// regular expression, a pattern and options cstring
+		zeros, i := 0, 0
+		for ; i < len(b) && zeros < 2; i++ {
+			if b[i] == 0 {
+				zeros++
+			}
+		}
+		return i, nil
+	case 0x10:
+		return 4, nil
+	case 0x13:
+		return 16, nil
+	}
+	return 0, fmt.Errorf("bson: unknown type 0x%02x", typ)
+}
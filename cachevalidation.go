@@ -0,0 +1,47 @@
+package scout
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// validateCache sends the request of the service again with the ETag and Last-Modified
+// validators of its response, dialing resolveTo when it is set, and returns the issue when the
+// response has no validators or the conditional request is not answered with a 304
+func (s *Service) validateCache(res *http.Response, resolveTo string) string {
+	if !s.ValidateCache {
+		return ""
+	}
+	conditional := make(http.Header)
+	if etag := res.Header.Get("ETag"); etag != "" {
+		conditional.Set("If-None-Match", etag)
+	}
+	if modified := res.Header.Get("Last-Modified"); modified != "" {
+		conditional.Set("If-Modified-Since", modified)
+	}
+	if len(conditional) == 0 {
+		s.classify(FailureCacheValidation, nil)
+		return "HTTP Response has no ETag or Last-Modified to validate the cache with"
+	}
+	_, revalidated, _, err := s.requestWith(s.context(), resolveTo, conditional)
+	if err != nil {
+		s.classify(classifyError(err, false), err)
+		return fmt.Sprintf("Conditional HTTP Error %v", err)
+	}
+	if revalidated.StatusCode != http.StatusNotModified {
+		s.classify(FailureCacheValidation, nil)
+		return fmt.Sprintf("Conditional HTTP request with %s returned %v instead of 304", validators(conditional), revalidated.StatusCode)
+	}
+	return ""
+}
+
+// validators describes the validators of a conditional request
+func validators(h http.Header) string {
+	switch {
+	case h.Get("If-None-Match") != "" && h.Get("If-Modified-Since") != "":
+		return fmt.Sprintf("If-None-Match %s and If-Modified-Since %s", h.Get("If-None-Match"), h.Get("If-Modified-Since"))
+	case h.Get("If-None-Match") != "":
+		return "If-None-Match " + h.Get("If-None-Match")
+	}
+	return "If-Modified-Since " + h.Get("If-Modified-Since")
+}
@@ -0,0 +1,95 @@
+package scout
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// defaultCompareHeaders are the cache headers compared between the CDN edge and origin
+// when a service does not specify CompareHeaders
+var defaultCompareHeaders = []string{"ETag", "Last-Modified"}
+
+// CheckCDN will fetch the service address from the CDN edge (the normal resolution or ResolveTo)
+// and from the origin (Origin, ip:port) and fail when the contents or cache headers diverge, a
+// service with Edges or EdgeResolvers compares each of those edges instead
+func (s *Service) CheckCDN() {
+	if len(s.Edges) > 0 || len(s.EdgeResolvers) > 0 {
+		s.checkEdges()
+		return
+	}
+	if s.Origin == "" {
+		s.fail(FailureConfig, nil, "CDN service has no origin to compare against")
+		return
+	}
+	if !s.SkipDNSTiming {
+		dnsLookup, err := s.DNSCheck()
+		if err != nil {
+			s.fail(FailureDNS, err, fmt.Sprintf("Could not get IP address for domain %v, %v", s.Address, err))
+			return
+		}
+		s.DNSResolve = dnsLookup
+	}
+
+	if s.ResolveTo != "" {
+		s.checkResolveDrift()
+	}
+	edge, edgeRes, metrics, err := s.request(s.context(), s.ResolveTo)
+	defer metrics.release()
+	s.timings = metrics.Timings()
+	if err != nil {
+		s.fail(metrics.classifyError(err), err, fmt.Sprintf("CDN Edge HTTP Error %v", err))
+		return
+	}
+	s.setNetworkLatency(metrics.NetworkLatency())
+	s.setRequestLatency(metrics.RequestLatency())
+	s.setResponse(metrics.response(edge))
+	s.setStatusCode(edgeRes.StatusCode)
+
+	origin, originRes, originMetrics, err := s.request(s.context(), s.Origin)
+	defer originMetrics.release()
+	if err != nil {
+		s.fail(classifyError(err, false), err, fmt.Sprintf("CDN Origin HTTP Error %v", err))
+		return
+	}
+
+	if s.ExpectedStatus != 0 && s.ExpectedStatus != edgeRes.StatusCode {
+		s.fail(FailureStatusMismatch, nil, fmt.Sprintf("HTTP Status Code %v did not match %v", edgeRes.StatusCode, s.ExpectedStatus))
+		return
+	}
+	if edgeRes.StatusCode != originRes.StatusCode {
+		s.fail(FailureStatusMismatch, nil, fmt.Sprintf("CDN edge status code %v did not match origin status code %v", edgeRes.StatusCode, originRes.StatusCode))
+		return
+	}
+	if diff := diffHeaders(s.compareHeaders(), edgeRes.Header, originRes.Header); len(diff) > 0 {
+		s.fail(FailureBodyMismatch, nil, fmt.Sprintf("CDN edge headers diverge from origin: %s", strings.Join(diff, ", ")))
+		return
+	}
+	edgeSum, originSum := sha256.Sum256(edge), sha256.Sum256(origin)
+	if edgeSum != originSum {
+		s.fail(FailureBodyMismatch, nil, fmt.Sprintf("CDN edge content (sha256 %x) did not match origin content (sha256 %x)", edgeSum, originSum))
+		return
+	}
+
+	s.Success()
+}
+
+func (s *Service) compareHeaders() []string {
+	if len(s.CompareHeaders) > 0 {
+		return s.CompareHeaders
+	}
+	return defaultCompareHeaders
+}
+
+// diffHeaders returns a description of each named header whose value differs between a and b
+func diffHeaders(names []string, a, b http.Header) []string {
+	var diff []string
+	for _, name := range names {
+		av, bv := a.Get(name), b.Get(name)
+		if av != bv {
+			diff = append(diff, fmt.Sprintf("%s %q != %q", http.CanonicalHeaderKey(name), av, bv))
+		}
+	}
+	return diff
+}
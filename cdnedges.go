@@ -0,0 +1,207 @@
+package scout
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// edgeResponse is the response of a CDN edge, or the error fetching it
+type edgeResponse struct {
+	addr    string
+	status  int
+	header  http.Header
+	sum     [sha256.Size]byte
+	latency int64
+	err     error
+}
+
+// key identifies the responses that are consistent with each other
+func (r *edgeResponse) key(headers []string) string {
+	key := []string{fmt.Sprint(r.status), fmt.Sprintf("%x", r.sum)}
+	for _, name := range headers {
+		key = append(key, r.header.Get(name))
+	}
+	return strings.Join(key, "|")
+}
+
+// diff returns how the response differs from the reference
+func (r *edgeResponse) diff(ref *edgeResponse, headers []string) []string {
+	var diff []string
+	if r.status != ref.status {
+		diff = append(diff, fmt.Sprintf("status %d != %d", r.status, ref.status))
+	}
+	diff = append(diff, diffHeaders(headers, r.header, ref.header)...)
+	if r.sum != ref.sum {
+		diff = append(diff, fmt.Sprintf("content sha256 %x != %x", r.sum[:6], ref.sum[:6]))
+	}
+	return diff
+}
+
+// checkEdges fetches the service address from each of its Edges and the edges its
+// EdgeResolvers answer for its host, and fails when a edge can not be fetched or its status,
+// cache headers or content diverge from the Origin, or the majority of the edges without one
+func (s *Service) checkEdges() {
+	edges, err := s.edgeAddresses()
+	if err != nil {
+		s.fail(FailureDNS, err, fmt.Sprintf("Could not resolve the CDN edges of %v, %v", s.Address, err))
+		return
+	}
+	headers := s.compareHeaders()
+	responses := make([]*edgeResponse, len(edges))
+	var latency int64
+	fetched := 0
+	for i, edge := range edges {
+		responses[i] = s.fetchEdge(edge)
+		if responses[i].err == nil {
+			latency += responses[i].latency
+			fetched++
+		}
+		if s.timedOut() {
+			return
+		}
+	}
+	if fetched == 0 {
+		err := responses[0].err
+		s.fail(classifyError(err, false), err, fmt.Sprintf("CDN Edge HTTP Error %v", err))
+		return
+	}
+	s.setRequestLatency(latency / int64(fetched))
+
+	var ref *edgeResponse
+	if s.Origin != "" {
+		if ref = s.fetchEdge(s.Origin); ref.err != nil {
+			s.fail(classifyError(ref.err, false), ref.err, fmt.Sprintf("CDN Origin HTTP Error %v", ref.err))
+			return
+		}
+	} else {
+		ref = consensus(responses, headers)
+	}
+
+	results := make([]IPResult, len(responses))
+	s.Details = make(map[string]string, len(responses))
+	var issues []string
+	for i, r := range responses {
+		results[i] = IPResult{IP: r.addr, RequestLatency: r.latency, NetworkLatency: -1}
+		if r.err != nil {
+			results[i].Issue = fmt.Sprintf("HTTP Error %v", r.err)
+		} else {
+			s.Details[r.addr] = fmt.Sprintf("status %d, sha256 %x", r.status, r.sum[:6])
+			if diff := r.diff(ref, headers); len(diff) > 0 {
+				results[i].Issue = strings.Join(diff, ", ")
+			}
+		}
+		results[i].Online = results[i].Issue == ""
+		if !results[i].Online {
+			issues = append(issues, fmt.Sprintf("%s: %s", r.addr, results[i].Issue))
+		}
+	}
+	s.IPResults = results
+	if len(issues) > 0 {
+		against := "the majority"
+		if s.Origin != "" {
+			against = "origin"
+		}
+		s.fail(FailureBodyMismatch, nil, fmt.Sprintf("%d of %d CDN edges are inconsistent with %s: %s", len(issues), len(edges), against, strings.Join(issues, "; ")))
+		return
+	}
+	if s.ExpectedStatus != 0 && s.ExpectedStatus != ref.status {
+		s.fail(FailureStatusMismatch, nil, fmt.Sprintf("HTTP Status Code %v did not match %v", ref.status, s.ExpectedStatus))
+		return
+	}
+	s.Success()
+}
+
+// consensus returns the response most edges agree on, the first of them on a tie
+func consensus(responses []*edgeResponse, headers []string) *edgeResponse {
+	counts := make(map[string]int)
+	var best *edgeResponse
+	for _, r := range responses {
+		if r.err != nil {
+			continue
+		}
+		key := r.key(headers)
+		counts[key]++
+		if best == nil || counts[key] > counts[best.key(headers)] {
+			best = r
+		}
+	}
+	return best
+}
+
+// fetchEdge sends the service request to the edge
+func (s *Service) fetchEdge(edge string) *edgeResponse {
+	content, res, metrics, err := s.request(s.context(), edge)
+	defer metrics.release()
+	r := &edgeResponse{addr: edge, err: err}
+	if err != nil {
+		return r
+	}
+	r.status, r.header = res.StatusCode, res.Header
+	r.sum = sha256.Sum256(content)
+	r.latency = metrics.RequestLatency()
+	return r
+}
+
+// edgeAddresses returns the ip:port of the Edges of the service and of the addresses its host
+// resolves to on each of its EdgeResolvers, in order and without duplicates
+func (s *Service) edgeAddresses() ([]string, error) {
+	u, err := url.Parse(s.Address)
+	if err != nil {
+		return nil, err
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	var edges []string
+	seen := make(map[string]bool)
+	add := func(edge string) {
+		if _, _, err := net.SplitHostPort(edge); err != nil {
+			edge = net.JoinHostPort(edge, port)
+		}
+		if !seen[edge] {
+			seen[edge] = true
+			edges = append(edges, edge)
+		}
+	}
+	for _, edge := range s.Edges {
+		add(edge)
+	}
+	for _, server := range s.EdgeResolvers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		resolver := &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+		addrs, err := resolver.LookupIPAddr(s.context(), u.Hostname())
+		if err != nil {
+			return nil, fmt.Errorf("resolver %s: %w", server, err)
+		}
+		ips := make([]string, len(addrs))
+		for i, addr := range addrs {
+			ips[i] = addr.IP.String()
+		}
+		sort.Strings(ips)
+		for _, ip := range ips {
+			add(ip)
+		}
+	}
+	if len(edges) == 0 {
+		return nil, fmt.Errorf("no edges")
+	}
+	return edges, nil
+}
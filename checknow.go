@@ -0,0 +1,33 @@
+package scout
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// CheckNow runs a check of the service right away and returns its result, the schedule of the
+// service is left as is and the result is also sent on the Response Channel and to the
+// subscribers, a service sharing the checks of another one has that service checked
+func (s *Scout) CheckNow(id uuid.UUID) (CheckResult, error) {
+	s.mux.RLock()
+	serv, ok := s.Services[id]
+	target := serv
+	if ok && serv.primary != nil {
+		target = serv.primary
+	}
+	s.mux.RUnlock()
+	if !ok {
+		return CheckResult{}, fmt.Errorf("%w: %s", ErrUnknownService, id)
+	}
+
+	target.checkMux.Lock()
+	defer target.checkMux.Unlock()
+	serv.checkResult = nil
+	target.check()
+	if serv.checkResult == nil {
+		return CheckResult{}, fmt.Errorf("%w: %s", ErrNoCheckResult, id)
+	}
+	st := serv.Snapshot()
+	return CheckResult{Result: serv.checkResult, Status: &st}, nil
+}
@@ -0,0 +1,245 @@
+package scout
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ringReplicas is the number of points of a member on the hash ring, more points spread the
+// services more evenly
+const ringReplicas = 128
+
+// Membership is the store the members of a cluster of scouts register in, e.g. Consul. A member
+// is alive while it keeps joining within the ttl
+type Membership interface {
+	// Join registers the member or renews its registration for ttl
+	Join(ctx context.Context, member string, ttl time.Duration) error
+	// Members returns the members that are alive
+	Members(ctx context.Context) ([]string, error)
+	// Leave removes the registration of the member
+	Leave(ctx context.Context, member string) error
+}
+
+// ClusterStatus is the view of the cluster of a member
+type ClusterStatus struct {
+	Member  string    `json:"member"`
+	Leader  string    `json:"leader"`
+	Members []string  `json:"members"`
+	Owned   int       `json:"owned"`
+	Synced  time.Time `json:"synced"`
+}
+
+// cluster is the membership of the scout and its last view of the members
+type cluster struct {
+	member     string
+	membership Membership
+	interval   time.Duration
+	mux        sync.RWMutex
+	members    []string
+	ring       hashRing
+	synced     time.Time
+}
+
+// WithCluster makes the scout the member of a cluster of scouts sharing the same services, each
+// service is checked by a single member, chosen by consistent hashing of its ID over the live
+// members. The member joins the membership every interval and the services of members that
+// stopped joining, within three intervals, are taken over by the others. The first member by
+// name is the leader of the cluster
+func WithCluster(member string, m Membership, interval time.Duration) Option {
+	return func(s *Scout) error {
+		if member == "" || m == nil || interval <= 0 {
+			return fmt.Errorf("scout: cluster needs a member name, a membership and a positive interval")
+		}
+		s.cluster = &cluster{member: member, membership: m, interval: interval}
+		return nil
+	}
+}
+
+// ClusterStatus returns the view of the cluster of the scout, the zero status when the scout is
+// not a member of a cluster
+func (s *Scout) ClusterStatus() ClusterStatus {
+	c := s.cluster
+	if c == nil {
+		return ClusterStatus{}
+	}
+	c.mux.RLock()
+	st := ClusterStatus{Member: c.member, Members: append([]string(nil), c.members...), Synced: c.synced}
+	c.mux.RUnlock()
+	if len(st.Members) > 0 {
+		st.Leader = st.Members[0]
+	}
+	for _, serv := range s.GetServices() {
+		if s.owns(serv) {
+			st.Owned++
+		}
+	}
+	return st
+}
+
+// Leader reports whether the scout is the leader of its cluster, a scout without a cluster is
+// its own leader
+func (s *Scout) Leader() bool {
+	if s.cluster == nil {
+		return true
+	}
+	return s.ClusterStatus().Leader == s.cluster.member
+}
+
+// owns reports whether the service is checked by this member of the cluster, no service is until
+// the members are known
+func (s *Scout) owns(serv *Service) bool {
+	c := s.cluster
+	if c == nil {
+		return true
+	}
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.ring.owner(serv.ID.String()) == c.member
+}
+
+// runCluster syncs the membership right away and then every interval until stop is closed, the
+// member leaves the cluster before done is closed
+func (s *Scout) runCluster(stop, done chan struct{}) {
+	defer close(done)
+	c := s.cluster
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		if err := s.syncCluster(ctx); err != nil && ctx.Err() == nil {
+			s.Logger.Warnf("scout: cluster sync failed, keeping the services of %s: %v", c.member, err)
+		}
+		select {
+		case <-stop:
+			leave, cancel := context.WithTimeout(context.Background(), c.interval)
+			if err := c.membership.Leave(leave, c.member); err != nil {
+				s.Logger.Warnf("scout: %s could not leave the cluster: %v", c.member, err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncCluster renews the membership, rebuilds the ring from the live members and starts the
+// services this member took over and stops the ones it gave up
+func (s *Scout) syncCluster(ctx context.Context) error {
+	c := s.cluster
+	if err := c.membership.Join(ctx, c.member, 3*c.interval); err != nil {
+		return err
+	}
+	members, err := c.membership.Members(ctx)
+	if err != nil {
+		return err
+	}
+	members = append(members, c.member)
+	sort.Strings(members)
+	uniq := members[:0]
+	for i, m := range members {
+		if i == 0 || m != members[i-1] {
+			uniq = append(uniq, m)
+		}
+	}
+	ring := newHashRing(uniq)
+	c.mux.Lock()
+	changed := !equalStrings(c.members, uniq)
+	previous := c.ring
+	c.members = uniq
+	c.ring = ring
+	c.synced = time.Now().UTC()
+	c.mux.Unlock()
+	if changed {
+		s.Logger.Infof("Cluster members of %s: %v", c.member, uniq)
+	}
+
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	if !s.Running {
+		return nil
+	}
+	// the services started by the previous ring, or when added since, are running
+	for _, serv := range s.Services {
+		if serv.primary != nil || serv.remote() || serv.Snapshot().Paused {
+			continue
+		}
+		key := serv.ID.String()
+		owned, was := ring.owner(key) == c.member, previous.owner(key) == c.member
+		switch {
+		case owned && !was:
+			go serv.Scout()
+		case !owned && was:
+			serv.Stop()
+		}
+	}
+	return nil
+}
+
+// reset forgets the members so no service is owned until the cluster is synced again
+func (c *cluster) reset() {
+	c.mux.Lock()
+	c.members, c.ring = nil, hashRing{}
+	c.mux.Unlock()
+}
+
+// hashRing assigns keys to members by consistent hashing, so a member joining or leaving only
+// moves the keys of its neighbours
+type hashRing struct {
+	points  []uint64
+	members map[uint64]string
+}
+
+func newHashRing(members []string) hashRing {
+	r := hashRing{members: make(map[uint64]string, len(members)*ringReplicas)}
+	for _, m := range members {
+		for i := 0; i < ringReplicas; i++ {
+			p := hashKey(m + "#" + strconv.Itoa(i))
+			r.points = append(r.points, p)
+			r.members[p] = m
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+// owner returns the member of the first point of the ring after the key, empty without members
+func (r hashRing) owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := hashKey(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.members[r.points[i]]
+}
+
+// hashKey hashes the key with sha256, faster hashes spread the similar names of the points badly
+func hashKey(key string) uint64 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,192 @@
+package scout
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryMembership is a Membership shared by the scouts of a test
+type memoryMembership struct {
+	mux     sync.Mutex
+	members map[string]time.Time
+}
+
+func (m *memoryMembership) Join(ctx context.Context, member string, ttl time.Duration) error {
+	m.mux.Lock()
+	m.members[member] = time.Now().Add(ttl)
+	m.mux.Unlock()
+	return nil
+}
+
+func (m *memoryMembership) Members(ctx context.Context) ([]string, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	var members []string
+	for member, expiry := range m.members {
+		if time.Now().Before(expiry) {
+			members = append(members, member)
+		}
+	}
+	return members, nil
+}
+
+func (m *memoryMembership) Leave(ctx context.Context, member string) error {
+	m.mux.Lock()
+	delete(m.members, member)
+	m.mux.Unlock()
+	return nil
+}
+
+func TestHashRing(t *testing.T) {
+	assert := assert.New(t)
+
+	three := newHashRing([]string{"a", "b", "c"})
+	two := newHashRing([]string{"a", "b"})
+	counts := map[string]int{}
+	for i := 0; i < 3000; i++ {
+		key := uuid.New().String()
+		owner := three.owner(key)
+		counts[owner]++
+		// only the keys of the member that left move
+		if owner != "c" {
+			assert.Equal(owner, two.owner(key))
+		}
+	}
+	for _, m := range []string{"a", "b", "c"} {
+		assert.InDelta(1000, counts[m], 400, m)
+	}
+	assert.Equal("", newHashRing(nil).owner("key"))
+}
+
+func TestCluster(t *testing.T) {
+	assert := assert.New(t)
+
+	membership := &memoryMembership{members: map[string]time.Time{}}
+	var servs []*Service
+	for i := 0; i < 20; i++ {
+		servs = append(servs, &Service{ID: uuid.New(), Name: "Cron", Type: "heartbeat", Interval: Duration(time.Hour)})
+	}
+	scout := func(member string) *Scout {
+		var copies []*Service
+		for _, serv := range servs {
+			copies = append(copies, &Service{ID: serv.ID, Name: serv.Name, Type: serv.Type, Interval: serv.Interval})
+		}
+		s, err := NewScoutWithOptions(WithServices(copies...), WithCluster(member, membership, 10*time.Millisecond))
+		assert.Nil(err)
+		go func() {
+			for range s.Responses {
+			}
+		}()
+		return s
+	}
+	a, b := scout("a"), scout("b")
+	// both members are known from the first sync
+	assert.Nil(membership.Join(context.Background(), "b", time.Second))
+	a.StartScoutingServices()
+	defer a.StopScoutingServices()
+	b.StartScoutingServices()
+
+	// the services are sharded across the members
+	assert.Eventually(func() bool {
+		la, lb := a.Health().ServiceLoops, b.Health().ServiceLoops
+		return la > 0 && lb > 0 && la+lb == 20
+	}, 2*time.Second, 10*time.Millisecond)
+	st := a.ClusterStatus()
+	assert.Equal([]string{"a", "b"}, st.Members)
+	assert.Equal("a", st.Leader)
+	assert.True(a.Leader())
+	assert.False(b.Leader())
+	assert.Equal(int(a.Health().ServiceLoops), st.Owned)
+
+	// the services of a member that left are taken over
+	b.StopScoutingServices()
+	assert.Eventually(func() bool { return a.Health().ServiceLoops == 20 && b.Health().ServiceLoops == 0 }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal([]string{"a"}, a.ClusterStatus().Members)
+}
+
+func TestConsulMembership(t *testing.T) {
+	assert := assert.New(t)
+
+	var mux sync.Mutex
+	sessions := map[string]string{}
+	kv := map[string]string{}
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+		assert.Equal("secret", r.Header.Get("X-Consul-Token"))
+		switch {
+		case r.URL.Path == "/v1/session/create":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			assert.Equal("30s", body["TTL"])
+			id := uuid.New().String()
+			sessions[id] = body["Name"]
+			json.NewEncoder(w).Encode(map[string]string{"ID": id})
+		case strings.HasPrefix(r.URL.Path, "/v1/session/renew/"):
+			if _, ok := sessions[strings.TrimPrefix(r.URL.Path, "/v1/session/renew/")]; !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte("[]"))
+		case strings.HasPrefix(r.URL.Path, "/v1/session/destroy/"):
+			id := strings.TrimPrefix(r.URL.Path, "/v1/session/destroy/")
+			delete(sessions, id)
+			for k, holder := range kv {
+				if holder == id {
+					delete(kv, k)
+				}
+			}
+			w.Write([]byte("true"))
+		case strings.HasPrefix(r.URL.Path, "/v1/kv/") && r.Method == http.MethodPut:
+			kv[strings.TrimPrefix(r.URL.Path, "/v1/kv/")] = r.URL.Query().Get("acquire")
+			w.Write([]byte("true"))
+		case strings.HasPrefix(r.URL.Path, "/v1/kv/"):
+			prefix := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+			var keys []string
+			for k := range kv {
+				if strings.HasPrefix(k, prefix) {
+					keys = append(keys, k)
+				}
+			}
+			if len(keys) == 0 {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(keys)
+		}
+	}))
+	defer consul.Close()
+
+	c := &ConsulMembership{Address: consul.URL, Token: "secret"}
+	ctx := context.Background()
+	members, err := c.Members(ctx)
+	assert.Nil(err)
+	assert.Empty(members)
+	assert.Nil(c.Join(ctx, "a", 30*time.Second))
+	assert.Nil(c.Join(ctx, "a", 30*time.Second))
+	assert.Len(sessions, 1)
+	members, err = c.Members(ctx)
+	assert.Nil(err)
+	assert.Equal([]string{"a"}, members)
+
+	// a expired session joins again
+	mux.Lock()
+	sessions = map[string]string{}
+	mux.Unlock()
+	assert.Nil(c.Join(ctx, "a", 30*time.Second))
+	assert.Len(sessions, 1)
+
+	assert.Nil(c.Leave(ctx, "a"))
+	members, err = c.Members(ctx)
+	assert.Nil(err)
+	assert.Empty(members)
+}
@@ -1,37 +1,131 @@
 package main
 
 import (
-	"io/ioutil"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/ghodss/yaml"
-	"github.com/sirupsen/logrus"
-
 	"github.com/phenixrizen/scout"
+	"github.com/phenixrizen/scout/tui"
+)
+
+const (
+	// drainTimeout bounds how long a shutdown waits for the checks in flight and queued notifications
+	drainTimeout = 30 * time.Second
+	// targetsDir is watched for service files every targetsInterval
+	targetsDir      = "./targets.d"
+	targetsInterval = 10 * time.Second
+	// clusterInterval is how often a member of a cluster renews its membership in Consul
+	clusterInterval = 5 * time.Second
+	// probesAddr serves /healthz and /readyz unless SCOUT_HTTP_ADDR is set
+	probesAddr = ":8080"
 )
 
+// main scouts the services of services.yml, logging their responses, or drawing them as a live
+// dashboard when run as `scout tui`
 func main() {
-	log := logrus.New()
+	var out io.Writer = os.Stderr
+	dashboard := len(os.Args) > 1 && os.Args[1] == "tui"
+	if dashboard {
+		// log lines would scroll the dashboard away
+		out = io.Discard
+	}
+	log := scout.NewSlogLogger(slog.New(slog.NewTextHandler(out, nil)))
 
-	var servs []*scout.Service
-	yb, err := ioutil.ReadFile("./services.yml")
+	servs, err := scout.LoadConfig("./services.yml")
 	if err != nil {
-		logrus.Fatal(err)
+		log.Errorf("Could not load services, %v", err)
+		os.Exit(1)
+	}
+
+	opts := []scout.Option{scout.WithServices(servs...), scout.WithLogger(log)}
+	// services can also be dropped in and removed from targets.d as single files
+	if fi, err := os.Stat(targetsDir); err == nil && fi.IsDir() {
+		opts = append(opts, scout.WithDiscovery(targetsDir, &scout.DirectoryDiscovery{Dir: targetsDir}, targetsInterval))
+	}
+	// scouts started with SCOUT_CLUSTER set share the services through the Consul of
+	// CONSUL_HTTP_ADDR, each member named by its host name unless SCOUT_CLUSTER_MEMBER is set
+	if os.Getenv("SCOUT_CLUSTER") != "" {
+		member := os.Getenv("SCOUT_CLUSTER_MEMBER")
+		if member == "" {
+			member, _ = os.Hostname()
+		}
+		membership := &scout.ConsulMembership{Address: os.Getenv("CONSUL_HTTP_ADDR"), Prefix: os.Getenv("SCOUT_CLUSTER") + "/members", Token: os.Getenv("CONSUL_HTTP_TOKEN")}
+		opts = append(opts, scout.WithCluster(member, membership, clusterInterval))
+	}
+	// services can reference secrets of the Vault of VAULT_ADDR as ${vault:path#key}
+	if os.Getenv("VAULT_ADDR") != "" {
+		opts = append(opts, scout.WithSecrets("vault", &scout.VaultSecrets{Address: os.Getenv("VAULT_ADDR"), Token: os.Getenv("VAULT_TOKEN")}))
 	}
-	err = yaml.Unmarshal(yb, &servs)
+	if dashboard {
+		// the dashboard reads the results from its own subscription
+		opts = append(opts, scout.WithoutResponseChannel())
+	}
+	s, err := scout.NewScoutWithOptions(opts...)
 	if err != nil {
-		logrus.Fatal(err)
+		log.Errorf("Could not create scout, %v", err)
+		os.Exit(1)
 	}
 
-	s := scout.NewScout(servs, log)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
 
-	go s.StartScoutingServices()
-	go s.HandleResponses()
+	// the liveness and readiness probes of the orchestrator
+	addr := os.Getenv("SCOUT_HTTP_ADDR")
+	if addr == "" {
+		addr = probesAddr
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", s.HealthzHandler())
+	mux.Handle("/readyz", s.ReadyzHandler())
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("Could not serve the probes on %s, %v", addr, err)
+		}
+	}()
+
+	if dashboard {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go tui.New(s, os.Stdout).Run(ctx)
+	} else {
+		go s.HandleResponses()
+	}
+	s.StartScoutingServices()
 
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
 	for {
-		time.Sleep(30 * time.Second)
-		for _, serv := range s.Services {
-			log.Infof("Service: %s, Address: %s, Type: %s, Online: %t, Last Online: %s, Last Status Code: %d, Latency: %dms, Ping Time: %dms", serv.Name, serv.Address, serv.Type, serv.Online, serv.LastOnline, serv.LastStatusCode, serv.RequestLatency, serv.NetworkLatency)
+		select {
+		case sig := <-signals:
+			log.Infof("Received %s, draining checks and notifications", sig)
+			// a second signal exits right away
+			signal.Reset(syscall.SIGTERM, syscall.SIGINT)
+			ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+			err := s.Drain(ctx)
+			srv.Shutdown(ctx)
+			cancel()
+			if err != nil {
+				log.Errorf("Could not drain: %v", err)
+				os.Exit(1)
+			}
+			log.Infof("Drained, exiting")
+			return
+		case <-ticker.C:
+			if dashboard {
+				continue
+			}
+			for _, serv := range s.GetServices() {
+				st := serv.Snapshot()
+				log.Infof("Service: %s, Address: %s, Type: %s, Online: %t, Last Online: %s, Last Status Code: %d, Latency: %dms, Ping Time: %dms", st.Name, serv.Address, st.Type, st.Online, st.LastOnline, st.LastStatusCode, st.RequestLatency, st.NetworkLatency)
+			}
 		}
 	}
 }
@@ -0,0 +1,91 @@
+package scout
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// CompressionNone requires responses that are not compressed
+	CompressionNone = "none"
+	// CompressionAny requires responses compressed with any encoding
+	CompressionAny = "any"
+)
+
+// defaultAcceptEncoding is sent by services that expect a compression without AcceptEncoding
+const defaultAcceptEncoding = "gzip, deflate, br"
+
+// compressions are the values of ExpectCompression
+var compressions = map[string]bool{CompressionNone: true, CompressionAny: true, "gzip": true, "deflate": true, "br": true}
+
+// acceptEncoding returns the Accept-Encoding the requests of the service send, empty to leave the
+// compression to the HTTP transport which decompresses gzip transparently
+func (s *Service) acceptEncoding() string {
+	if s.AcceptEncoding == "" && s.ExpectCompression != "" {
+		return defaultAcceptEncoding
+	}
+	return s.AcceptEncoding
+}
+
+// decompress decodes a gzip or deflate body into a pooled buffer, reading at most limit bytes, the
+// bodies of other encodings, e.g. br, are returned as they are. A body cut off by the read limit is
+// decoded as far as it goes
+func decompress(encoding string, body *bytes.Buffer, cut bool, limit int64) (contents *bytes.Buffer, truncated bool, err error) {
+	var r io.Reader
+	switch strings.ToLower(encoding) {
+	case "gzip", "x-gzip":
+		if r, err = gzip.NewReader(bytes.NewReader(body.Bytes())); err != nil {
+			return body, cut, err
+		}
+	case "deflate":
+		// deflate is zlib wrapped, some servers send it raw
+		if r, err = zlib.NewReader(bytes.NewReader(body.Bytes())); err != nil {
+			r = flate.NewReader(bytes.NewReader(body.Bytes()))
+		}
+	default:
+		return body, cut, nil
+	}
+	contents, truncated, err = readLimit(r, limit)
+	if cut && errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+		truncated = true
+	}
+	return contents, truncated, err
+}
+
+// verifyCompression matches the encoding of a response against the ExpectCompression of the
+// service and returns the issue when it does not match, empty bodies are not checked
+func (s *Service) verifyCompression(m *HTTPRequestMetrics) string {
+	if s.ExpectCompression == "" || m.BodyBytes == 0 {
+		return ""
+	}
+	encoding := strings.ToLower(m.ContentEncoding)
+	if encoding == "identity" {
+		encoding = ""
+	}
+	var issue string
+	switch s.ExpectCompression {
+	case CompressionNone:
+		if encoding != "" {
+			issue = fmt.Sprintf("HTTP Response Body is compressed with %s", encoding)
+		}
+	case CompressionAny:
+		if encoding == "" {
+			issue = "HTTP Response Body is not compressed"
+		}
+	default:
+		if encoding != s.ExpectCompression {
+			issue = fmt.Sprintf("HTTP Response Body encoding %q did not match %s", encoding, s.ExpectCompression)
+		}
+	}
+	if issue != "" {
+		s.classify(FailureCompression, nil)
+	}
+	return issue
+}
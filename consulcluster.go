@@ -0,0 +1,157 @@
+package scout
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConsulMembership is a Membership kept in the KV store of Consul, every member holds a key under
+// Prefix locked by a session with the ttl of the member, Consul deletes the key of a member whose
+// session is not renewed in time
+type ConsulMembership struct {
+	// Address is the HTTP API of the Consul agent, http://127.0.0.1:8500 by default
+	Address string `json:"address"`
+	// Prefix is the KV prefix of the members, scout/members by default
+	Prefix string       `json:"prefix"`
+	Token  string       `json:"token"`
+	Client *http.Client `json:"-"`
+
+	mux      sync.Mutex
+	sessions map[string]string
+}
+
+// Join creates a session for the member and acquires its key, or renews the session
+func (c *ConsulMembership) Join(ctx context.Context, member string, ttl time.Duration) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.sessions == nil {
+		c.sessions = make(map[string]string)
+	}
+	if id := c.sessions[member]; id != "" {
+		status, err := c.do(ctx, http.MethodPut, "/v1/session/renew/"+id, nil, nil)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusNotFound {
+			return nil
+		}
+		// the session expired, e.g. after a long pause, the member joins again
+		delete(c.sessions, member)
+	}
+	var session struct{ ID string }
+	body := map[string]string{"Name": "scout-" + member, "TTL": ttl.String(), "Behavior": "delete", "LockDelay": "0s"}
+	if _, err := c.do(ctx, http.MethodPut, "/v1/session/create", body, &session); err != nil {
+		return err
+	}
+	var acquired bool
+	if _, err := c.do(ctx, http.MethodPut, "/v1/kv/"+c.key(member)+"?acquire="+session.ID, member, &acquired); err != nil {
+		return err
+	}
+	if !acquired {
+		c.do(ctx, http.MethodPut, "/v1/session/destroy/"+session.ID, nil, nil)
+		return fmt.Errorf("consul: member %s is held by another session", member)
+	}
+	c.sessions[member] = session.ID
+	return nil
+}
+
+// Members lists the keys of the members
+func (c *ConsulMembership) Members(ctx context.Context) ([]string, error) {
+	var keys []string
+	status, err := c.do(ctx, http.MethodGet, "/v1/kv/"+c.key("")+"?keys", nil, &keys)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	members := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if m := strings.TrimPrefix(k, c.key("")); m != "" {
+			members = append(members, m)
+		}
+	}
+	return members, nil
+}
+
+// Leave destroys the session of the member, which deletes its key
+func (c *ConsulMembership) Leave(ctx context.Context, member string) error {
+	c.mux.Lock()
+	id := c.sessions[member]
+	delete(c.sessions, member)
+	c.mux.Unlock()
+	if id == "" {
+		return nil
+	}
+	_, err := c.do(ctx, http.MethodPut, "/v1/session/destroy/"+id, nil, nil)
+	return err
+}
+
+func (c *ConsulMembership) key(member string) string {
+	prefix := strings.Trim(c.Prefix, "/")
+	if prefix == "" {
+		prefix = "scout/members"
+	}
+	return prefix + "/" + member
+}
+
+// do sends a request to the Consul API and decodes its JSON response into v, a not found response
+// is returned as its status without error
+func (c *ConsulMembership) do(ctx context.Context, method, path string, body, v interface{}) (int, error) {
+	address := c.Address
+	if address == "" {
+		address = "127.0.0.1:8500"
+	}
+	// CONSUL_HTTP_ADDR is usually set without a scheme
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		if s, ok := body.(string); ok {
+			b = []byte(s)
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(address, "/")+path, r)
+	if err != nil {
+		return 0, err
+	}
+	if c.Token != "" {
+		req.Header.Set("X-Consul-Token", c.Token)
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return resp.StatusCode, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("consul: %s %s: %s %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			return resp.StatusCode, err
+		}
+	}
+	return resp.StatusCode, nil
+}
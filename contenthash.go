@@ -0,0 +1,67 @@
+package scout
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// verifyContentHash matches the SHA-256 of the body of a response against the ExpectedSHA256 of
+// the service and, with ContentDrift, against the hash of the content it first saw, it returns
+// the issue when either does not match
+func (s *Service) verifyContentHash(content []byte) string {
+	if s.ExpectedSHA256 == "" && !s.ContentDrift {
+		return ""
+	}
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	if s.Details == nil {
+		s.Details = make(map[string]string)
+	}
+	s.Details["sha256"] = hash
+	if s.ExpectedSHA256 != "" && !strings.EqualFold(s.ExpectedSHA256, hash) {
+		s.classify(FailureBodyMismatch, nil)
+		return fmt.Sprintf("HTTP Response Body sha256 %s did not match %s", hash, strings.ToLower(s.ExpectedSHA256))
+	}
+	if !s.ContentDrift {
+		return ""
+	}
+	if s.ContentHash == "" {
+		s.ContentHash = hash
+		return ""
+	}
+	if s.ContentHash != hash {
+		s.Logger.Warnf("Service %v content changed from sha256 %v to %v", s.Name, s.ContentHash, hash)
+		s.classify(FailureContentDrift, nil)
+		return fmt.Sprintf("HTTP Response Body changed from sha256 %s to %s", s.ContentHash, hash)
+	}
+	return ""
+}
+
+// AcceptContent accepts a content change of the service with the ID that fails its ContentDrift
+// check, the content of its next check is the one it is compared against from then on
+func (s *Scout) AcceptContent(id uuid.UUID) error {
+	serv := s.GetService(id)
+	if serv == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownService, id)
+	}
+	serv.checkMux.Lock()
+	serv.ContentHash = ""
+	serv.checkMux.Unlock()
+	s.Logger.Infof("Service %s content accepted", serv.Name)
+	return nil
+}
+
+// validateContentHash checks that the ExpectedSHA256 of the service is a hex SHA-256 hash
+func (s *Service) validateContentHash() error {
+	if s.ExpectedSHA256 == "" {
+		return nil
+	}
+	if b, err := hex.DecodeString(s.ExpectedSHA256); err != nil || len(b) != sha256.Size {
+		return fmt.Errorf("%w: expected sha256 %q is not a hex SHA-256 hash", ErrInvalidExpected, s.ExpectedSHA256)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package scout
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+)
+
+// maxBannerBytes bounds how much of a TCP/UDP response is read while waiting for ExpectedBanner
+const maxBannerBytes = 64 * 1024
+
+// converse writes SendPayload to conn and reads until the response matches ExpectedBanner, the
+// response read is kept in LastResponse and a non empty issue is returned when it did not match
+func (s *Service) converse(conn net.Conn) string {
+	if s.SendPayload == "" && s.ExpectedBanner == "" {
+		return ""
+	}
+	if err := conn.SetDeadline(s.deadline()); err != nil {
+		s.classify(FailureProtocol, err)
+		return fmt.Sprintf("%v Deadline Error %v", s.Type, err)
+	}
+	if s.SendPayload != "" {
+		if _, err := conn.Write([]byte(s.SendPayload)); err != nil {
+			s.classify(classifyError(err, true), err)
+			return fmt.Sprintf("Send Error %v", err)
+		}
+	}
+	if s.ExpectedBanner == "" {
+		return ""
+	}
+	re, err := regexp.Compile(s.ExpectedBanner)
+	if err != nil {
+		s.classify(FailureConfig, err)
+		return fmt.Sprintf("Invalid expected banner '%v', %v", s.ExpectedBanner, err)
+	}
+	var banner []byte
+	buf := make([]byte, 512)
+	for len(banner) < maxBannerBytes {
+		n, err := conn.Read(buf)
+		banner = append(banner, buf[:n]...)
+		s.setResponse(string(banner))
+		if re.Match(banner) {
+			return ""
+		}
+		if err != nil {
+			class := FailureBodyMismatch
+			if classifyError(err, true) == FailureReadTimeout {
+				class = FailureReadTimeout
+			}
+			s.classify(class, err)
+			return fmt.Sprintf("Response '%v' did not match '%v', %v", string(banner), s.ExpectedBanner, err)
+		}
+	}
+	s.classify(FailureBodyMismatch, nil)
+	return fmt.Sprintf("Response did not match '%v' within %v bytes", s.ExpectedBanner, maxBannerBytes)
+}
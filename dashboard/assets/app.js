@@ -0,0 +1,103 @@
+"use strict";
+
+let selected = null;
+// the API token is given in the fragment of the page URL, e.g. /dashboard/#token=..., which is
+// never sent to the server, and kept for the session once it is removed from the address bar
+const token = (function () {
+  const given = new URLSearchParams(location.hash.slice(1)).get("token");
+  if (given) {
+    sessionStorage.setItem("scout-token", given);
+    history.replaceState(null, "", location.pathname + location.search);
+  }
+  return sessionStorage.getItem("scout-token");
+})();
+
+function api(path, method) {
+  const headers = token ? { Authorization: "Bearer " + token } : {};
+  return fetch("api/" + path, { method: method || "GET", headers }).then((res) => {
+    if (!res.ok) {
+      throw new Error(res.status + " " + res.statusText);
+    }
+    return res.status === 204 ? null : res.json();
+  });
+}
+
+function el(tag, cls, text) {
+  const e = document.createElement(tag);
+  if (cls) e.className = cls;
+  if (text !== undefined) e.textContent = text;
+  return e;
+}
+
+function renderTiles(services) {
+  const tiles = document.getElementById("tiles");
+  tiles.replaceChildren();
+  let up = 0;
+  for (const s of services) {
+    if (s.state === "up") up++;
+    const tile = el("div", "tile " + s.state + (s.paused ? " paused" : ""));
+    tile.append(el("div", "name", s.name));
+    tile.append(el("div", "meta", s.type + " · " + (s.paused ? "paused" : s.state) + " · " + s.requestLatency + "ms"));
+    if (s.downText) tile.append(el("div", "meta", s.downText));
+    tile.onclick = () => select(s);
+    tiles.append(tile);
+    if (selected && selected.id === s.id) selected = s;
+  }
+  document.getElementById("summary").textContent = up + " of " + services.length + " up";
+}
+
+function renderIncidents(incidents) {
+  const list = document.getElementById("incidents");
+  list.replaceChildren();
+  for (const inc of incidents.slice(0, 50)) {
+    const ongoing = new Date(inc.end).getFullYear() <= 1;
+    const li = el("li", ongoing ? "ongoing" : "");
+    li.textContent = inc.name + " down since " + new Date(inc.start).toLocaleString() +
+      (ongoing ? " (ongoing)" : " until " + new Date(inc.end).toLocaleString()) + ", " + inc.checks + " failed checks";
+    list.append(li);
+  }
+}
+
+function renderLatency(timeline) {
+  const svg = document.getElementById("latency");
+  svg.replaceChildren();
+  const points = timeline.points || [];
+  if (points.length < 2) return;
+  const max = Math.max(1, ...points.map((p) => p.latency));
+  const x = (i) => (i / (points.length - 1)) * 600;
+  const y = (l) => 115 - (l / max) * 110;
+  const line = document.createElementNS("http://www.w3.org/2000/svg", "polyline");
+  line.setAttribute("points", points.map((p, i) => x(i) + "," + y(p.latency)).join(" "));
+  svg.append(line);
+  points.forEach((p, i) => {
+    if (p.up) return;
+    const dot = document.createElementNS("http://www.w3.org/2000/svg", "circle");
+    dot.setAttribute("cx", x(i));
+    dot.setAttribute("cy", 115);
+    dot.setAttribute("r", 3);
+    svg.append(dot);
+  });
+}
+
+function select(s) {
+  selected = s;
+  document.getElementById("detail").hidden = false;
+  document.getElementById("detail-name").textContent = s.name;
+  api("services/" + s.id + "/timeline").then(renderLatency);
+}
+
+function refresh() {
+  api("services").then(renderTiles).catch(console.error);
+  api("incidents").then(renderIncidents).catch(console.error);
+  if (selected) api("services/" + selected.id + "/timeline").then(renderLatency).catch(console.error);
+}
+
+document.querySelectorAll(".actions button").forEach((b) => {
+  b.onclick = () => {
+    if (!selected) return;
+    api("services/" + selected.id + "/" + b.dataset.action, "POST").then(refresh).catch((err) => alert(err));
+  };
+});
+
+refresh();
+setInterval(refresh, 5000);
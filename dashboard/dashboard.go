@@ -0,0 +1,262 @@
+// Package dashboard serves a single page web dashboard of the services of a scout, with their
+// tiles, incidents and latency graphs, and buttons to check, pause and silence them
+package dashboard
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/phenixrizen/scout"
+)
+
+// defaultSilence is how long a service is silenced when the request does not say
+const defaultSilence = time.Hour
+
+//go:embed assets
+var assets embed.FS
+
+// Incident is a period the checks of a service failed, End is zero while it is ongoing
+type Incident struct {
+	Service uuid.UUID `json:"service"`
+	Name    string    `json:"name"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end,omitempty"`
+	Checks  int       `json:"checks"`
+}
+
+// Option configures the dashboard
+type Option func(*config)
+
+type config struct {
+	auth scout.Authenticator
+}
+
+// WithAuthenticator requires a bearer token in the Authorization header of the API calls of the
+// dashboard, the page sends the one given in the fragment of its URL, e.g. /dashboard/#token=...
+// Tokens in query parameters are not accepted as they end up in access logs and Referer headers.
+// A principal with a namespace only sees and acts on the services of its namespace, viewers only
+// read the dashboard and checking, pausing, resuming and silencing services needs a operator
+func WithAuthenticator(a scout.Authenticator) Option {
+	return func(c *config) {
+		c.auth = a
+	}
+}
+
+// Handler returns the dashboard of the scout, it is meant to be mounted under a prefix with
+// http.StripPrefix, e.g. at /dashboard/. The latency graphs and incidents are read from the
+// timeline of the scout, so they stay empty unless it was created WithTimeline. The stats cover
+// the last day unless the window is given.
+//
+//	GET  /                          the dashboard
+//	GET  /api/services              the status of every service
+//	GET  /api/services/{id}/timeline the check timeline of a service
+//	GET  /api/services/{id}/stats   the uptime, MTTR and MTBF of a service ?from=&to= (RFC 3339)
+//	GET  /api/incidents             the incidents of the timeline, most recent first
+//	POST /api/services/{id}/check   check the service now
+//	POST /api/services/{id}/pause   pause the service
+//	POST /api/services/{id}/resume  resume the service
+//	POST /api/services/{id}/silence silence the service ?for=1h
+func Handler(s *scout.Scout, opts ...Option) http.Handler {
+	c := &config{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	static, err := fs.Sub(assets, "assets")
+	if err != nil {
+		panic(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(static)))
+	mux.HandleFunc("/api/services", c.authenticated(func(w http.ResponseWriter, r *http.Request, p scout.Principal) {
+		if !allow(w, r, http.MethodGet) {
+			return
+		}
+		writeJSON(w, statuses(s, p))
+	}))
+	mux.HandleFunc("/api/incidents", c.authenticated(func(w http.ResponseWriter, r *http.Request, p scout.Principal) {
+		if !allow(w, r, http.MethodGet) {
+			return
+		}
+		writeJSON(w, incidents(s, p))
+	}))
+	mux.HandleFunc("/api/services/", c.authenticated(func(w http.ResponseWriter, r *http.Request, p scout.Principal) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/services/"), "/")
+		if len(parts) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		id, err := uuid.Parse(parts[0])
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if serv := s.GetService(id); serv == nil || !p.Allowed(serv) {
+			http.NotFound(w, r)
+			return
+		}
+		if parts[1] != "timeline" && parts[1] != "stats" && !p.Can(scout.RoleOperator) {
+			http.Error(w, p.Require(scout.RoleOperator).Error(), http.StatusForbidden)
+			return
+		}
+		serviceAction(s, id, parts[1], w, r)
+	}))
+	return mux
+}
+
+// authenticated calls h with the principal of the request, an admin without a authenticator, it
+// answers 401 when the dashboard has a authenticator and the request has no valid token
+func (c *config) authenticated(h func(http.ResponseWriter, *http.Request, scout.Principal)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c.auth == nil {
+			h(w, r, scout.Principal{Role: scout.RoleAdmin})
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		p, err := c.auth.Authenticate(r.Context(), token)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		h(w, r.WithContext(scout.WithPrincipal(r.Context(), p)), p)
+	}
+}
+
+// serviceAction serves the action on the service with the ID
+func serviceAction(s *scout.Scout, id uuid.UUID, action string, w http.ResponseWriter, r *http.Request) {
+	method := http.MethodPost
+	if action == "timeline" || action == "stats" {
+		method = http.MethodGet
+	}
+	if !allow(w, r, method) {
+		return
+	}
+	var v interface{}
+	var err error
+	switch action {
+	case "timeline":
+		var tl scout.Timeline
+		tl, err = s.Timeline(id)
+		if errors.Is(err, scout.ErrNoTimeline) {
+			tl, err = scout.Timeline{Service: id}, nil
+		}
+		v = tl
+	case "stats":
+		to, from := time.Now(), time.Time{}
+		for _, t := range []struct {
+			param string
+			dst   *time.Time
+		}{{"to", &to}, {"from", &from}} {
+			if q := r.URL.Query().Get(t.param); q != "" {
+				if *t.dst, err = time.Parse(time.RFC3339, q); err != nil {
+					http.Error(w, "invalid time "+q, http.StatusBadRequest)
+					return
+				}
+			}
+		}
+		if from.IsZero() {
+			from = to.Add(-24 * time.Hour)
+		}
+		v, err = s.Reliability(id, from, to)
+	case "check":
+		var res scout.CheckResult
+		res, err = s.CheckNow(id)
+		v = res.Status
+	case "pause":
+		err = s.Pause(id)
+	case "resume":
+		err = s.Resume(id)
+	case "silence":
+		d := defaultSilence
+		if q := r.URL.Query().Get("for"); q != "" {
+			if d, err = time.ParseDuration(q); err != nil || d <= 0 {
+				http.Error(w, "invalid silence duration "+q, http.StatusBadRequest)
+				return
+			}
+		}
+		err = s.Silence(id, d, "silenced from the dashboard")
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	case errors.Is(err, scout.ErrUnknownService):
+		http.NotFound(w, r)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case v == nil:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSON(w, v)
+	}
+}
+
+// statuses returns the status of every service of the scout the principal sees sorted by name
+func statuses(s *scout.Scout, p scout.Principal) []scout.ServiceStatus {
+	servs := s.GetServices()
+	sts := make([]scout.ServiceStatus, 0, len(servs))
+	for _, serv := range servs {
+		if !p.Allowed(serv) {
+			continue
+		}
+		sts = append(sts, serv.Snapshot())
+	}
+	sort.Slice(sts, func(i, j int) bool { return sts[i].Name < sts[j].Name })
+	return sts
+}
+
+// incidents returns the runs of failed checks in the timelines of the services the principal
+// sees, most recent first
+func incidents(s *scout.Scout, p scout.Principal) []Incident {
+	incs := []Incident{}
+	for _, serv := range s.GetServices() {
+		if !p.Allowed(serv) {
+			continue
+		}
+		tl, err := s.Timeline(serv.ID)
+		if err != nil {
+			continue
+		}
+		var inc *Incident
+		for _, p := range tl.Points {
+			if !p.Up {
+				if inc == nil {
+					inc = &Incident{Service: serv.ID, Name: serv.Name, Start: p.Time}
+				}
+				inc.Checks++
+			} else if inc != nil {
+				inc.End = p.Time
+				incs = append(incs, *inc)
+				inc = nil
+			}
+		}
+		if inc != nil {
+			incs = append(incs, *inc)
+		}
+	}
+	sort.Slice(incs, func(i, j int) bool { return incs[i].Start.After(incs[j].Start) })
+	return incs
+}
+
+// allow answers 405 and returns false unless the request has the method
+func allow(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,139 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/phenixrizen/scout"
+)
+
+func TestHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	serv := &scout.Service{ID: uuid.New(), Name: "Cron", Type: "heartbeat", Interval: scout.Duration(time.Hour), Timeout: scout.Duration(time.Hour)}
+	s, err := scout.NewScoutWithOptions(scout.WithServices(serv), scout.WithResultBuffer(8),
+		scout.WithTimeline(scout.Retention{Raw: scout.Duration(time.Hour), Rollup: scout.Duration(time.Minute), Rollups: scout.Duration(time.Hour)}))
+	assert.Nil(err)
+	srv := httptest.NewServer(http.StripPrefix("/dashboard", Handler(s)))
+	defer srv.Close()
+
+	do := func(method, path string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+"/dashboard"+path, nil)
+		res, err := http.DefaultClient.Do(req)
+		assert.Nil(err)
+		return res
+	}
+
+	res := do(http.MethodGet, "/")
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Contains(res.Header.Get("Content-Type"), "text/html")
+	res = do(http.MethodGet, "/app.js")
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	// a failure opens an incident, a successful check ends it
+	serv.Failure("no heartbeat")
+	assert.Nil(s.Beat(serv.ID))
+	res = do(http.MethodPost, "/api/services/"+serv.ID.String()+"/check")
+	assert.Equal(http.StatusOK, res.StatusCode)
+	serv.Failure("no heartbeat")
+
+	var incs []Incident
+	res = do(http.MethodGet, "/api/incidents")
+	assert.Nil(json.NewDecoder(res.Body).Decode(&incs))
+	assert.Len(incs, 2)
+	assert.Equal(1, incs[0].Checks)
+	assert.True(incs[0].End.IsZero())
+	assert.False(incs[1].End.IsZero())
+
+	var tl scout.Timeline
+	res = do(http.MethodGet, "/api/services/"+serv.ID.String()+"/timeline")
+	assert.Nil(json.NewDecoder(res.Body).Decode(&tl))
+	assert.Len(tl.Points, 3)
+
+	var st scout.AvailabilityStat
+	res = do(http.MethodGet, "/api/services/"+serv.ID.String()+"/stats?from="+time.Now().Add(-time.Minute).Format(time.RFC3339))
+	assert.Nil(json.NewDecoder(res.Body).Decode(&st))
+	assert.Equal(2, st.Incidents)
+	assert.Equal(uint64(3), st.Checks)
+	assert.True(st.MTTR > 0)
+	res = do(http.MethodGet, "/api/services/"+serv.ID.String()+"/stats?to=yesterday")
+	assert.Equal(http.StatusBadRequest, res.StatusCode)
+
+	res = do(http.MethodPost, "/api/services/"+serv.ID.String()+"/pause")
+	assert.Equal(http.StatusNoContent, res.StatusCode)
+	var sts []scout.ServiceStatus
+	res = do(http.MethodGet, "/api/services")
+	assert.Nil(json.NewDecoder(res.Body).Decode(&sts))
+	assert.Len(sts, 1)
+	assert.True(sts[0].Paused)
+
+	res = do(http.MethodPost, "/api/services/"+serv.ID.String()+"/silence?for=10m")
+	assert.Equal(http.StatusNoContent, res.StatusCode)
+	assert.True(serv.IsSilenced())
+	res = do(http.MethodPost, "/api/services/"+serv.ID.String()+"/silence?for=soon")
+	assert.Equal(http.StatusBadRequest, res.StatusCode)
+
+	res = do(http.MethodGet, "/api/services/"+serv.ID.String()+"/pause")
+	assert.Equal(http.StatusMethodNotAllowed, res.StatusCode)
+	res = do(http.MethodPost, "/api/services/"+uuid.New().String()+"/check")
+	assert.Equal(http.StatusNotFound, res.StatusCode)
+}
+
+func TestHandlerNamespaces(t *testing.T) {
+	assert := assert.New(t)
+
+	payments := &scout.Service{ID: uuid.New(), Name: "Payments", Type: "heartbeat", Interval: scout.Duration(time.Hour), Namespace: "payments"}
+	search := &scout.Service{ID: uuid.New(), Name: "Search", Type: "heartbeat", Interval: scout.Duration(time.Hour), Namespace: "search"}
+	s, err := scout.NewScoutWithOptions(scout.WithServices(payments, search), scout.WithResultBuffer(8))
+	assert.Nil(err)
+	tokens := scout.Tokens{
+		"pay-token":  {Name: "payments-oncall", Namespace: "payments", Role: scout.RoleOperator},
+		"view-token": {Name: "payments-dev", Namespace: "payments"},
+	}
+	srv := httptest.NewServer(Handler(s, WithAuthenticator(tokens)))
+	defer srv.Close()
+
+	do := func(method, path, token string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		assert.Nil(err)
+		return res
+	}
+
+	// the page loads without a token, the API needs one
+	assert.Equal(http.StatusOK, do(http.MethodGet, "/", "").StatusCode)
+	assert.Equal(http.StatusUnauthorized, do(http.MethodGet, "/api/services", "").StatusCode)
+	assert.Equal(http.StatusUnauthorized, do(http.MethodGet, "/api/services", "wrong").StatusCode)
+
+	var sts []scout.ServiceStatus
+	res := do(http.MethodGet, "/api/services", "pay-token")
+	assert.Nil(json.NewDecoder(res.Body).Decode(&sts))
+	if assert.Len(sts, 1) {
+		assert.Equal("Payments", sts[0].Name)
+	}
+	// tokens in the URL would leak through logs and Referer headers
+	res = do(http.MethodGet, "/api/services?token=pay-token", "")
+	assert.Equal(http.StatusUnauthorized, res.StatusCode)
+
+	// the services of other namespaces are not found
+	assert.Equal(http.StatusNoContent, do(http.MethodPost, "/api/services/"+payments.ID.String()+"/pause", "pay-token").StatusCode)
+	assert.Equal(http.StatusNotFound, do(http.MethodPost, "/api/services/"+search.ID.String()+"/pause", "pay-token").StatusCode)
+	assert.False(search.Snapshot().Paused)
+
+	// viewers read the timelines but do not act on the services
+	assert.Equal(http.StatusOK, do(http.MethodGet, "/api/services/"+payments.ID.String()+"/timeline", "view-token").StatusCode)
+	assert.Equal(http.StatusForbidden, do(http.MethodPost, "/api/services/"+payments.ID.String()+"/resume", "view-token").StatusCode)
+	assert.Equal(http.StatusForbidden, do(http.MethodPost, "/api/services/"+payments.ID.String()+"/silence", "view-token").StatusCode)
+	assert.False(payments.IsSilenced())
+	assert.Equal(http.StatusNoContent, do(http.MethodPost, "/api/services/"+payments.ID.String()+"/silence", "pay-token").StatusCode)
+	assert.True(payments.IsSilenced())
+}
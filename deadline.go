@@ -0,0 +1,82 @@
+package scout
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// withDeadline runs check with a context that is cancelled once the Timeout of the service
+// elapsed or the check is aborted, every phase of the check (lookups, dials, pings, reads and
+// matching) shares it
+func (s *Service) withDeadline(check func()) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if s.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), s.Timeout.Duration())
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	s.checkCtx = ctx
+	s.cancelMux.Lock()
+	s.checkCancel = cancel
+	s.cancelMux.Unlock()
+	defer func() {
+		s.cancelMux.Lock()
+		s.checkCancel = nil
+		s.cancelMux.Unlock()
+		s.checkCtx = nil
+		cancel()
+	}()
+	check()
+}
+
+// abort cancels the context of the running check, it returns false when no check is running
+func (s *Service) abort() bool {
+	s.cancelMux.Lock()
+	defer s.cancelMux.Unlock()
+	if s.checkCancel == nil {
+		return false
+	}
+	s.checkCancel()
+	return true
+}
+
+// context returns the context of the running check, checks run outside Check have no deadline
+func (s *Service) context() context.Context {
+	if s.checkCtx == nil {
+		return context.Background()
+	}
+	return s.checkCtx
+}
+
+// deadline returns when the running check times out, checks run outside Check time out after
+// the Timeout of the service
+func (s *Service) deadline() time.Time {
+	if deadline, ok := s.context().Deadline(); ok {
+		return deadline
+	}
+	return time.Now().Add(s.Timeout.Duration())
+}
+
+// remaining returns how long the running check has left before it times out
+func (s *Service) remaining() time.Duration {
+	return time.Until(s.deadline())
+}
+
+// dial connects to address within the deadline of the running check
+func (s *Service) dial(network, address string) (net.Conn, error) {
+	d := &net.Dialer{Timeout: s.remaining()}
+	return d.DialContext(s.context(), network, address)
+}
+
+// timedOut fails the check when its deadline passed and reports whether it did, it guards the
+// phases that cannot be interrupted like reading a body or matching Expected
+func (s *Service) timedOut() bool {
+	if err := s.context().Err(); err != nil {
+		s.fail(FailureReadTimeout, err, fmt.Sprintf("Check timed out after %v", s.Timeout.Duration()))
+		return true
+	}
+	return false
+}
@@ -0,0 +1,246 @@
+package scout
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// maxDebugBody bounds the response body kept in a debug capture
+	maxDebugBody = 4096
+	// maxDebugCaptures bounds the debug captures kept per service, older ones are dropped
+	maxDebugCaptures = 32
+)
+
+// DebugCapture is the full record of one check of a service captured with CaptureDebug
+type DebugCapture struct {
+	Service        uuid.UUID         `json:"service"`
+	Type           string            `json:"type"`
+	Address        string            `json:"address"`
+	StartedAt      time.Time         `json:"startedAt"`
+	Duration       Duration          `json:"duration"`
+	Online         bool              `json:"online"`
+	Issue          string            `json:"issue,omitempty"`
+	DNSResolve     int64             `json:"dnsResolve"`
+	RequestLatency int64             `json:"requestLatency"`
+	NetworkLatency int64             `json:"networkLatency"`
+	ResolvedIPs    []string          `json:"resolvedIPs,omitempty"`
+	Exchanges      []DebugExchange   `json:"exchanges,omitempty"`
+	LastResponse   string            `json:"lastResponse,omitempty"`
+	Details        map[string]string `json:"details,omitempty"`
+}
+
+// DebugExchange is a HTTP request and response made by a check
+type DebugExchange struct {
+	Method          string              `json:"method"`
+	URL             string              `json:"url"`
+	ResolveTo       string              `json:"resolveTo,omitempty"`
+	Host            string              `json:"host,omitempty"`
+	RequestHeaders  http.Header         `json:"requestHeaders,omitempty"`
+	RemoteAddr      string              `json:"remoteAddr,omitempty"`
+	Status          int                 `json:"status,omitempty"`
+	Proto           string              `json:"proto,omitempty"`
+	ResponseHeaders http.Header         `json:"responseHeaders,omitempty"`
+	Body            string              `json:"body,omitempty"`
+	BodyTruncated   bool                `json:"bodyTruncated,omitempty"`
+	Timings         *HTTPRequestMetrics `json:"timings,omitempty"`
+	TLS             *DebugTLS           `json:"tls,omitempty"`
+	Error           string              `json:"error,omitempty"`
+}
+
+// DebugTLS is the negotiated TLS connection of a HTTP exchange
+type DebugTLS struct {
+	Version     string    `json:"version"`
+	CipherSuite string    `json:"cipherSuite"`
+	ServerName  string    `json:"serverName"`
+	ALPN        string    `json:"alpn,omitempty"`
+	Subject     string    `json:"subject,omitempty"`
+	Issuer      string    `json:"issuer,omitempty"`
+	DNSNames    []string  `json:"dnsNames,omitempty"`
+	NotAfter    time.Time `json:"notAfter"`
+}
+
+// CaptureDebug captures the full record of the next checks of the service, they are kept until
+// read with DebugCaptures
+func (s *Service) CaptureDebug(checks int) {
+	s.debugMux.Lock()
+	s.DebugChecks = checks
+	s.debugMux.Unlock()
+}
+
+// DebugCaptures returns the captured checks of the service and clears them
+func (s *Service) DebugCaptures() []DebugCapture {
+	s.debugMux.Lock()
+	defer s.debugMux.Unlock()
+	captures := s.debugCaptures
+	s.debugCaptures = nil
+	return captures
+}
+
+// CaptureDebug captures the full record of the next checks of the service with the id
+func (s *Scout) CaptureDebug(id uuid.UUID, checks int) error {
+	serv := s.GetService(id)
+	if serv == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownService, id)
+	}
+	serv.CaptureDebug(checks)
+	return nil
+}
+
+// DebugCaptures returns and clears the captured checks of the service with the id
+func (s *Scout) DebugCaptures(id uuid.UUID) ([]DebugCapture, error) {
+	serv := s.GetService(id)
+	if serv == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownService, id)
+	}
+	return serv.DebugCaptures(), nil
+}
+
+// startDebug starts a capture for the check about to run when the service has checks left to capture
+func (s *Service) startDebug() {
+	s.debugMux.Lock()
+	defer s.debugMux.Unlock()
+	s.debug = nil
+	if s.DebugChecks <= 0 {
+		return
+	}
+	s.DebugChecks--
+	s.debug = &DebugCapture{
+		Service:   s.ID,
+		Type:      s.Type,
+		Address:   s.Address,
+		StartedAt: time.Now().UTC(),
+	}
+}
+
+// finishDebug completes the capture of the check that ran and keeps it
+func (s *Service) finishDebug() {
+	s.debugMux.Lock()
+	defer s.debugMux.Unlock()
+	d := s.debug
+	if d == nil {
+		return
+	}
+	s.debug = nil
+	d.Duration = Duration(time.Since(d.StartedAt))
+	d.Online = s.Online
+	if !s.Online {
+		d.Issue = s.DownText
+	}
+	d.DNSResolve = s.DNSResolve
+	d.RequestLatency = s.RequestLatency
+	d.NetworkLatency = s.NetworkLatency
+	d.LastResponse = s.LastResponse
+	d.Details = copyDetails(s.Details)
+	s.debugCaptures = append(s.debugCaptures, *d)
+	if len(s.debugCaptures) > maxDebugCaptures {
+		s.debugCaptures = s.debugCaptures[len(s.debugCaptures)-maxDebugCaptures:]
+	}
+}
+
+// debugLookup records the answers of a lookup made during a captured check
+func (s *Service) debugLookup(host string, ips []string) {
+	s.debugMux.Lock()
+	if s.debug != nil {
+		for _, ip := range ips {
+			s.debug.ResolvedIPs = append(s.debug.ResolvedIPs, host+"="+ip)
+		}
+	}
+	s.debugMux.Unlock()
+}
+
+// debugExchange records a HTTP exchange made during a captured check
+func (s *Service) debugExchange(cfg *requestConfig, content []byte, res *http.Response, metrics *HTTPRequestMetrics, err error) {
+	s.debugMux.Lock()
+	defer s.debugMux.Unlock()
+	if s.debug == nil {
+		return
+	}
+	method := cfg.method
+	if method == "" {
+		method = "GET"
+	}
+	ex := DebugExchange{
+		Method:         method,
+		URL:            s.redact(cfg.url),
+		ResolveTo:      cfg.resolveTo,
+		Host:           cfg.hostHeader,
+		RequestHeaders: redactHeaders(cfg.headers),
+		Timings:        metrics,
+	}
+	if metrics != nil {
+		ex.RemoteAddr = metrics.RemoteAddr
+	}
+	if err != nil {
+		ex.Error = s.redact(err.Error())
+	}
+	for name, values := range ex.RequestHeaders {
+		for i, v := range values {
+			values[i] = s.redact(v)
+		}
+		ex.RequestHeaders[name] = values
+	}
+	if res != nil {
+		ex.Status = res.StatusCode
+		ex.Proto = res.Proto
+		ex.ResponseHeaders = res.Header.Clone()
+		ex.TLS = debugTLS(res.TLS)
+	}
+	// the body is redacted before it is cut so a secret across the cut is not kept in part
+	ex.Body = s.redact(string(content))
+	if len(ex.Body) > maxDebugBody {
+		ex.Body = ex.Body[:maxDebugBody]
+		ex.BodyTruncated = true
+	}
+	s.debug.Exchanges = append(s.debug.Exchanges, ex)
+}
+
+// redactHeaders returns a copy of the headers with the credentials redacted
+func redactHeaders(h http.Header) http.Header {
+	c := h.Clone()
+	for _, name := range []string{"Authorization", "Proxy-Authorization", "Cookie"} {
+		if c.Get(name) != "" {
+			c.Set(name, "REDACTED")
+		}
+	}
+	return c
+}
+
+func debugTLS(state *tls.ConnectionState) *DebugTLS {
+	if state == nil {
+		return nil
+	}
+	d := &DebugTLS{
+		Version:     tlsVersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ServerName:  state.ServerName,
+		ALPN:        state.NegotiatedProtocol,
+	}
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		d.Subject = cert.Subject.String()
+		d.Issuer = cert.Issuer.String()
+		d.DNSNames = cert.DNSNames
+		d.NotAfter = cert.NotAfter
+	}
+	return d
+}
+
+// tlsVersionName returns the name of a TLS version
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	}
+	return fmt.Sprintf("0x%04x", version)
+}
@@ -0,0 +1,72 @@
+package scout
+
+import "github.com/google/uuid"
+
+// down reports whether the service failed its last check
+func (s *Service) down() bool {
+	return !s.Online && !s.lastFailure.IsZero()
+}
+
+// rootCause returns the ID of the furthest upstream service the service depends on that is
+// down, or uuid.Nil when all its dependencies are up
+func (s *Service) rootCause() uuid.UUID {
+	if s.scout == nil || len(s.DependsOn) == 0 {
+		return uuid.Nil
+	}
+	s.scout.mux.RLock()
+	defer s.scout.mux.RUnlock()
+	return s.scout.rootCause(s, map[uuid.UUID]bool{s.ID: true})
+}
+
+// rootCause walks the dependencies of serv, it must be called with the scout lock held
+func (s *Scout) rootCause(serv *Service, seen map[uuid.UUID]bool) uuid.UUID {
+	for _, id := range serv.DependsOn {
+		parent, ok := s.Services[id]
+		if !ok || seen[id] {
+			continue
+		}
+		seen[id] = true
+		if parent.Snapshot().State != StateDown {
+			continue
+		}
+		if root := s.rootCause(parent, seen); root != uuid.Nil {
+			return root
+		}
+		return id
+	}
+	return uuid.Nil
+}
+
+// dependsOn reports whether serv depends on the service with the ID, directly or through other
+// services, it must be called with the scout lock held
+func (s *Scout) dependsOn(serv *Service, id uuid.UUID, seen map[uuid.UUID]bool) bool {
+	for _, parent := range serv.DependsOn {
+		if parent == id {
+			return true
+		}
+		if seen[parent] {
+			continue
+		}
+		seen[parent] = true
+		if p, ok := s.Services[parent]; ok && s.dependsOn(p, id, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// Dependents returns the IDs of the services that directly depend on the service with the ID
+func (s *Scout) Dependents(id uuid.UUID) []uuid.UUID {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	var ids []uuid.UUID
+	for _, serv := range s.Services {
+		for _, parent := range serv.DependsOn {
+			if parent == id {
+				ids = append(ids, serv.ID)
+				break
+			}
+		}
+	}
+	return ids
+}
@@ -0,0 +1,92 @@
+package scout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// DirectoryDiscovery is a Discoverer with the services of the YAML and JSON files of a
+// directory, e.g. a targets.d directory config management tools drop and remove per service
+// files in. A file holds a single service, a list of services or a Config with its own
+// templates, a service without a ExternalID is known by its file and position in it. Used with
+// WithDiscovery the directory is watched by reading it every interval
+type DirectoryDiscovery struct {
+	Dir string `json:"dir"`
+}
+
+// Discover reads the services of every file of the directory, it fails when a file can not be
+// read or parsed so a file that is being written does not remove its services
+func (d *DirectoryDiscovery) Discover(ctx context.Context) ([]*Service, error) {
+	files, err := ioutil.ReadDir(d.Dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	var servs []*Service
+	for _, f := range files {
+		ext := strings.ToLower(filepath.Ext(f.Name()))
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") || (ext != ".yml" && ext != ".yaml" && ext != ".json") {
+			continue
+		}
+		fs, err := d.read(filepath.Join(d.Dir, f.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name(), err)
+		}
+		for i, serv := range fs {
+			if serv.ExternalID == "" {
+				serv.ExternalID = "file:" + f.Name()
+				if len(fs) > 1 {
+					serv.ExternalID += "#" + strconv.Itoa(i)
+				}
+			}
+			servs = append(servs, serv)
+		}
+	}
+	return servs, nil
+}
+
+// read returns the services of the file with the templates of the file applied
+func (d *DirectoryDiscovery) read(path string) ([]*Service, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	j, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	var keys map[string]json.RawMessage
+	if json.Unmarshal(j, &keys) == nil && keys["services"] == nil && keys["templates"] == nil && keys["defaults"] == nil {
+		serv := &Service{}
+		if err := json.Unmarshal(j, serv); err != nil {
+			return nil, err
+		}
+		return []*Service{serv}, nil
+	}
+	cfg, err := parseConfig(b)
+	if err != nil {
+		return nil, err
+	}
+	for _, serv := range cfg.Services {
+		// a template the file does not define is left for the templates of the scout
+		if _, ok := cfg.Templates.Templates[serv.Template]; serv.Template != "" && !ok {
+			if cfg.Defaults != nil {
+				inherit(serv, cfg.Defaults)
+			}
+			continue
+		}
+		if err := cfg.Apply(serv); err != nil {
+			return nil, err
+		}
+		serv.Template = ""
+	}
+	return cfg.Services, nil
+}
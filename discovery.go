@@ -0,0 +1,137 @@
+package scout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// discoveryNamespace derives the IDs of discovered services without one from their ExternalID
+var discoveryNamespace = uuid.MustParse("3c1b5f2e-8f4a-4c55-9d0e-6a7b2c9e1d40")
+
+// Discoverer lists the services of a dynamic source, e.g. DNS SRV records or a directory of
+// files. Every service needs a ExternalID unique across the sources of the scout, it is how a
+// service is recognized from one discovery to the next
+type Discoverer interface {
+	Discover(ctx context.Context) ([]*Service, error)
+}
+
+// DiscovererFunc is a function used as a Discoverer
+type DiscovererFunc func(ctx context.Context) ([]*Service, error)
+
+// Discover calls f(ctx)
+func (f DiscovererFunc) Discover(ctx context.Context) ([]*Service, error) { return f(ctx) }
+
+// WithDiscovery reconciles the services of the scout with the source every interval while the
+// services are scouted: discovered services are added, changed ones are replaced and the ones
+// that disappeared from the source are removed. A source that fails keeps its services
+func WithDiscovery(name string, d Discoverer, interval time.Duration) Option {
+	return func(s *Scout) error {
+		if d == nil || interval <= 0 {
+			return fmt.Errorf("scout: discovery %s needs a discoverer and a positive interval", name)
+		}
+		s.discoveries = append(s.discoveries, &discovery{name: name, source: d, interval: interval, known: make(map[string]string)})
+		return nil
+	}
+}
+
+// Discover reconciles the services of the scout with all of its discovery sources once
+func (s *Scout) Discover(ctx context.Context) error {
+	var first error
+	for _, d := range s.discoveries {
+		if err := s.reconcile(ctx, d); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// discovery is a source of services and the fingerprints of the services it added by ExternalID
+type discovery struct {
+	name     string
+	source   Discoverer
+	interval time.Duration
+	known    map[string]string
+	mux      sync.Mutex
+}
+
+// discover reconciles the source right away and then every interval until stop is closed
+func (s *Scout) discover(d *discovery, stop chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		if err := s.reconcile(ctx, d); err != nil && ctx.Err() == nil {
+			s.Logger.Warnf("%v", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcile adds, replaces and removes the services of the source
+func (s *Scout) reconcile(ctx context.Context, d *discovery) error {
+	servs, err := d.source.Discover(ctx)
+	if err != nil {
+		return fmt.Errorf("scout: discovery %s failed, keeping its services: %w", d.name, err)
+	}
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	seen := make(map[string]bool, len(servs))
+	var failed error
+	for _, serv := range servs {
+		if serv == nil || serv.ExternalID == "" {
+			s.Logger.Warnf("Discovery %s found a service without a external id, ignoring it", d.name)
+			continue
+		}
+		key := serv.ExternalID
+		seen[key] = true
+		b, err := json.Marshal(serv)
+		if err != nil {
+			return fmt.Errorf("scout: discovery %s: %w", d.name, err)
+		}
+		fp := string(b)
+		existing := s.GetServiceByExternalID(key)
+		if known, ok := d.known[key]; ok && known == fp && existing != nil {
+			continue
+		}
+		if serv.ID == uuid.Nil {
+			serv.ID = uuid.NewSHA1(discoveryNamespace, []byte(key))
+		}
+		if existing != nil {
+			err = s.UpdateServiceByExternalID(serv)
+		} else {
+			err = s.AddService(serv)
+		}
+		if err != nil {
+			if failed == nil {
+				failed = fmt.Errorf("scout: discovery %s could not add %s: %w", d.name, key, err)
+			}
+			continue
+		}
+		if existing == nil {
+			s.Logger.Infof("Discovery %s added service %s (%s)", d.name, serv.Name, key)
+		}
+		d.known[key] = fp
+	}
+	for key := range d.known {
+		if !seen[key] {
+			s.Logger.Infof("Discovery %s removed service %s", d.name, key)
+			s.DelServiceByExternalID(key)
+			delete(d.known, key)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,129 @@
+package scout
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+const (
+	// OverflowBlock waits for the consumer when the Response Channel is full, it is the default
+	// overflow policy and keeps every result at the cost of delaying the checks
+	OverflowBlock = "block"
+	// OverflowDropNewest drops the result being sent when the Response Channel is full
+	OverflowDropNewest = "drop-newest"
+	// OverflowDropOldest drops the oldest buffered result to make room for the one being sent,
+	// on a unbuffered Response Channel it drops the result being sent like OverflowDropNewest
+	OverflowDropOldest = "drop-oldest"
+)
+
+// WithOverflowPolicy sets what happens to results sent while the Response Channel is full:
+// OverflowBlock, OverflowDropNewest or OverflowDropOldest, combine it with WithResultBuffer so
+// bursts are buffered before results are dropped
+func WithOverflowPolicy(policy string) Option {
+	return func(s *Scout) error {
+		switch policy {
+		case OverflowBlock, OverflowDropNewest, OverflowDropOldest:
+			s.overflowPolicy = policy
+			return nil
+		}
+		return fmt.Errorf("scout: unknown overflow policy %q", policy)
+	}
+}
+
+// WithoutResponseChannel stops sending results on the Response Channel, for consumers reading
+// the results of the scout only through Subscribe, including the ones they miss before they
+// subscribed
+func WithoutResponseChannel() Option {
+	return func(s *Scout) error {
+		s.responses = responsesOff
+		return nil
+	}
+}
+
+// the states of the Response Channel of a scout
+const (
+	// responsesAuto sends results on the Response Channel while the scout has no subscribers
+	responsesAuto int32 = iota
+	// responsesRead sends every result, the channel was read through GetResponseChannel or
+	// HandleResponses
+	responsesRead
+	// responsesOff sends none
+	responsesOff
+)
+
+// feedResponses reports whether results are sent on the Response Channel, consumers reading
+// the results through Subscribe alone never wait for the channel nobody reads
+func (s *Scout) feedResponses(subscribed bool) bool {
+	switch atomic.LoadInt32(&s.responses) {
+	case responsesRead:
+		return true
+	case responsesOff:
+		return false
+	}
+	return !subscribed
+}
+
+// DroppedResults returns how many results the overflow policy dropped from the Response Channel
+// and the subscriber channels
+func (s *Scout) DroppedResults() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// dispatch sends r to the subscribers of the scout of the service and on its Response Channel
+// when the scout feeds it, following the overflow policy, services without a scout block
+func (s *Service) dispatch(r Result) {
+	if s.scout == nil {
+		s.Responses <- r
+		return
+	}
+	list := subscriptionsPool.Get().(*[]*subscription)
+	subs := s.scout.subscriptions((*list)[:0])
+	defer func() {
+		// the list does not keep the subscribers alive while it is pooled
+		clear(subs)
+		*list = subs[:0]
+		subscriptionsPool.Put(list)
+	}()
+	if s.scout.feedResponses(len(subs) > 0) {
+		s.scout.dispatch(s.Responses, r)
+	}
+	cr := CheckResult{Result: r}
+	if r.ServiceID() == s.ID {
+		st := s.Snapshot()
+		cr.Status = &st
+	}
+	for _, sub := range subs {
+		s.scout.send(sub, cr)
+	}
+}
+
+// dispatch sends r on ch following the overflow policy
+func (s *Scout) dispatch(ch chan interface{}, r Result) {
+	policy := s.overflowPolicy
+	if policy == OverflowDropOldest && cap(ch) == 0 {
+		policy = OverflowDropNewest
+	}
+	switch policy {
+	case OverflowDropNewest:
+		select {
+		case ch <- r:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case ch <- r:
+				return
+			default:
+			}
+			select {
+			case <-ch:
+				atomic.AddUint64(&s.dropped, 1)
+			default:
+			}
+		}
+	default:
+		ch <- r
+	}
+}
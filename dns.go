@@ -0,0 +1,159 @@
+package scout
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// resolver returns the resolver the service should use, DNS-over-HTTPS (DNSOverHTTPS) takes
+// precedence over DNS-over-TLS (DNSOverTLS) and the system resolver is used when neither is set
+func (s *Service) resolver() *net.Resolver {
+	dial := s.dnsDial()
+	if dial == nil {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{PreferGo: true, Dial: dial}
+}
+
+// dnsDial returns the dial function of the encrypted resolver configured for the service,
+// or nil when the system resolver should be used
+func (s *Service) dnsDial() func(ctx context.Context, network, address string) (net.Conn, error) {
+	switch {
+	case s.DNSOverHTTPS != "":
+		client := &http.Client{Timeout: s.Timeout.Duration()}
+		return func(ctx context.Context, network, address string) (net.Conn, error) {
+			return &dohConn{ctx: ctx, endpoint: s.DNSOverHTTPS, client: client}, nil
+		}
+	case s.DNSOverTLS != "":
+		server := s.DNSOverTLS
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "853")
+		}
+		host, _, _ := net.SplitHostPort(server)
+		dialer := &tls.Dialer{
+			NetDialer: &net.Dialer{Timeout: s.Timeout.Duration()},
+			Config:    &tls.Config{ServerName: host},
+		}
+		return func(ctx context.Context, network, address string) (net.Conn, error) {
+			// the go resolver uses TCP framing for any conn that is not a net.PacketConn
+			return dialer.DialContext(ctx, "tcp", server)
+		}
+	}
+	return nil
+}
+
+// CheckDNS will resolve the service address and optionally match the answers against Expected,
+// combined with DNSOverHTTPS or DNSOverTLS this monitors the encrypted resolver itself
+func (s *Service) CheckDNS() {
+	t1 := time.Now()
+	ips, err := s.lookup(s.context())
+	if err != nil {
+		s.fail(FailureDNS, err, fmt.Sprintf("Could not resolve %v, %v", s.Address, err))
+		return
+	}
+	s.DNSResolve = time.Since(t1).Milliseconds()
+	s.setRequestLatency(s.DNSResolve)
+	answers := make([]string, len(ips))
+	for i, ip := range ips {
+		answers[i] = ip.String()
+	}
+	s.setResponse(strings.Join(answers, ","))
+	if s.timedOut() {
+		return
+	}
+	if s.Expected != "" {
+		match, err := regexp.MatchString(s.Expected, s.LastResponse)
+		if err != nil {
+			s.Logger.Warnf("Service %v expected: %v to match %v", s.Name, s.LastResponse, s.Expected)
+		}
+		if !match {
+			s.fail(FailureBodyMismatch, nil, fmt.Sprintf("DNS answers '%v' did not match '%v'", s.LastResponse, s.Expected))
+			return
+		}
+	}
+	s.Success()
+}
+
+// dohConn is a net.Conn that carries the TCP framed messages of the go resolver over
+// DNS-over-HTTPS (RFC 8484), each query written is sent as a POST when the answer is read
+type dohConn struct {
+	ctx      context.Context
+	endpoint string
+	client   *http.Client
+	deadline time.Time
+	query    bytes.Buffer
+	answer   bytes.Buffer
+}
+
+func (c *dohConn) Write(b []byte) (int, error) {
+	return c.query.Write(b)
+}
+
+func (c *dohConn) Read(b []byte) (int, error) {
+	if c.answer.Len() == 0 {
+		if err := c.exchange(); err != nil {
+			return 0, err
+		}
+	}
+	return c.answer.Read(b)
+}
+
+func (c *dohConn) exchange() error {
+	q := c.query.Bytes()
+	if len(q) < 2 {
+		return errors.New("dns-over-https: no query to send")
+	}
+	// strip the two byte length prefix of the TCP framing
+	msg := q[2:]
+	c.query.Reset()
+
+	ctx := c.ctx
+	if !c.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewReader(msg))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	req.Header.Set("User-Agent", "phenixrizen-scout")
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("dns-over-https: unexpected status code %v", res.StatusCode)
+	}
+	body, err := readAll(res.Body)
+	defer putBuffer(body)
+	if err != nil {
+		return err
+	}
+	c.answer.Write([]byte{byte(body.Len() >> 8), byte(body.Len())})
+	c.answer.Write(body.Bytes())
+	return nil
+}
+
+func (c *dohConn) Close() error                       { return nil }
+func (c *dohConn) LocalAddr() net.Addr                { return dohAddr(c.endpoint) }
+func (c *dohConn) RemoteAddr() net.Addr               { return dohAddr(c.endpoint) }
+func (c *dohConn) SetDeadline(t time.Time) error      { c.deadline = t; return nil }
+func (c *dohConn) SetReadDeadline(t time.Time) error  { c.deadline = t; return nil }
+func (c *dohConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type dohAddr string
+
+func (a dohAddr) Network() string { return "https" }
+func (a dohAddr) String() string  { return string(a) }
@@ -0,0 +1,164 @@
+package scout
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dohHandler answers every A question with 192.0.2.1 and a ttl of 60 seconds
+func dohHandler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var q dnsmessage.Message
+		if err := q.Unpack(body); err != nil {
+			t.Error(err)
+			return
+		}
+		resp := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: q.ID, Response: true, RecursionAvailable: true},
+			Questions: q.Questions,
+		}
+		for _, qu := range q.Questions {
+			if qu.Type == dnsmessage.TypeA {
+				resp.Answers = append(resp.Answers, dnsmessage.Resource{
+					Header: dnsmessage.ResourceHeader{Name: qu.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+					Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+				})
+			}
+		}
+		b, _ := resp.Pack()
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(b)
+	}
+}
+
+func TestCheckDNSOverHTTPS(t *testing.T) {
+	assert := assert.New(t)
+
+	doh := httptest.NewServer(dohHandler(t))
+	defer doh.Close()
+
+	serv := &Service{
+		Name:         "DoH",
+		Address:      "scout.example",
+		Type:         "dns",
+		Expected:     `^192\.0\.2\.1$`,
+		DNSOverHTTPS: doh.URL,
+		Timeout:      Duration(5 * time.Second),
+		Logger:       NewSlogLogger(nil),
+	}
+	_, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("192.0.2.1", serv.LastResponse)
+}
+
+func TestDNSCache(t *testing.T) {
+	assert := assert.New(t)
+
+	doh := httptest.NewServer(dohHandler(t))
+	defer doh.Close()
+
+	cache := NewDNSCache()
+	serv := &Service{
+		Address:      "scout.example",
+		Type:         "dns",
+		DNSOverHTTPS: doh.URL,
+		DNSCache:     cache,
+		Timeout:      Duration(5 * time.Second),
+		Logger:       NewSlogLogger(nil),
+	}
+	for i := 0; i < 3; i++ {
+		_, ok := checkOnce(serv).(ServiceSuccess)
+		assert.True(ok)
+	}
+	stats := cache.Stats()
+	assert.Equal(uint64(2), stats.Hits)
+	assert.Equal(uint64(1), stats.Misses)
+	assert.Equal(1, stats.Entries)
+	for _, entry := range cache.entries {
+		// the record ttl of 60s is honored rather than the 1s MinTTL
+		assert.True(time.Until(entry.expires) > 30*time.Second)
+	}
+
+	serv.BypassDNSCache = true
+	checkOnce(serv)
+	assert.Equal(uint64(1), cache.Stats().Misses)
+}
+
+func TestSRVDiscovery(t *testing.T) {
+	assert := assert.New(t)
+
+	ports := []uint16{8080, 8081}
+	failing := false
+	doh := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var q dnsmessage.Message
+		if err := q.Unpack(body); err != nil {
+			t.Error(err)
+			return
+		}
+		resp := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: q.ID, Response: true, RecursionAvailable: true},
+			Questions: q.Questions,
+		}
+		for _, qu := range q.Questions {
+			if qu.Type != dnsmessage.TypeSRV {
+				continue
+			}
+			for _, port := range ports {
+				resp.Answers = append(resp.Answers, dnsmessage.Resource{
+					Header: dnsmessage.ResourceHeader{Name: qu.Name, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET, TTL: 60},
+					Body:   &dnsmessage.SRVResource{Target: dnsmessage.MustNewName("api.scout.example."), Port: port, Weight: 1},
+				})
+			}
+		}
+		b, _ := resp.Pack()
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(b)
+	}))
+	defer doh.Close()
+
+	srv := &SRVDiscovery{Records: []string{"_api._tcp.scout.example"}, Type: "http", Path: "/health", Interval: Duration(time.Minute), DNSOverHTTPS: doh.URL}
+	s, err := NewScout(nil, NewSlogLogger(nil), WithDiscovery("srv", srv, time.Minute))
+	assert.Nil(err)
+	ctx := context.Background()
+
+	assert.Nil(s.Discover(ctx))
+	assert.Len(s.GetServices(), 2)
+	assert.NotNil(s.GetServiceByExternalID("srv:_api._tcp.scout.example/api.scout.example:8081"))
+	serv := s.GetServiceByExternalID("srv:_api._tcp.scout.example/api.scout.example:8080")
+	if !assert.NotNil(serv) {
+		return
+	}
+	assert.Equal("http://api.scout.example:8080/health", serv.Address)
+	assert.Equal("_api._tcp.scout.example", serv.Tags["srv"])
+	id := serv.ID
+
+	// a failing lookup keeps the services, a target that is gone is removed
+	failing = true
+	assert.NotNil(s.Discover(ctx))
+	assert.Len(s.GetServices(), 2)
+	failing, ports = false, []uint16{8080}
+	assert.Nil(s.Discover(ctx))
+	if assert.Len(s.GetServices(), 1) {
+		assert.Equal(id, s.GetServices()[0].ID)
+	}
+
+	// a changed target is replaced under the same ID
+	srv.Path = "/ready"
+	assert.Nil(s.Discover(ctx))
+	if serv = s.GetService(id); assert.NotNil(serv) {
+		assert.Equal("http://api.scout.example:8080/ready", serv.Address)
+	}
+}
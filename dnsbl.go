@@ -0,0 +1,136 @@
+package scout
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultDNSBLs are the blacklists checked by dnsbl services without DNSBLs
+var defaultDNSBLs = []string{"zen.spamhaus.org", "bl.spamcop.net", "b.barracudacentral.org"}
+
+// dnsblListing is a address listed on a blacklist and the reason given in its TXT record
+type dnsblListing struct {
+	ip, zone, code, reason string
+}
+
+func (l dnsblListing) String() string {
+	s := fmt.Sprintf("%s on %s (%s", l.ip, l.zone, l.code)
+	if l.reason != "" {
+		s += ", " + l.reason
+	}
+	return s + ")"
+}
+
+// CheckDNSBL looks the address of the service, a ip or a host whose addresses are checked, up
+// on the DNS blacklists of DNSBLs and fails as FailureBlacklisted when it is listed on any with the
+// reason the blacklist gives. Blacklists that can not be queried are skipped unless none can be
+func (s *Service) CheckDNSBL() {
+	ips := []net.IP{net.ParseIP(s.Address)}
+	if ips[0] == nil {
+		var err error
+		if ips, err = s.lookup(s.context()); err != nil {
+			s.fail(FailureDNS, err, fmt.Sprintf("Could not resolve %v, %v", s.Address, err))
+			return
+		}
+	}
+	zones := s.DNSBLs
+	if len(zones) == 0 {
+		zones = defaultDNSBLs
+	}
+	var listings []dnsblListing
+	var lastErr error
+	queried := 0
+	for _, ip := range ips {
+		for _, zone := range zones {
+			listing, err := s.queryDNSBL(ip, zone)
+			if err != nil {
+				s.Logger.Warnf("Service %v could not query blacklist %v, %v", s.Name, zone, err)
+				lastErr = err
+				continue
+			}
+			queried++
+			if listing != nil {
+				listings = append(listings, *listing)
+			}
+		}
+		if s.timedOut() {
+			return
+		}
+	}
+	if queried == 0 {
+		s.fail(FailureDNS, lastErr, fmt.Sprintf("Could not query any blacklist, %v", lastErr))
+		return
+	}
+	s.Details = make(map[string]string, len(listings))
+	for _, l := range listings {
+		s.Details[l.zone+" "+l.ip] = l.reason
+	}
+	if len(listings) > 0 {
+		listed := make([]string, len(listings))
+		for i, l := range listings {
+			listed[i] = l.String()
+		}
+		sort.Strings(listed)
+		s.setResponse(strings.Join(listed, ", "))
+		s.fail(FailureBlacklisted, nil, fmt.Sprintf("Listed on %v of %v blacklists: %v", len(listings), queried, s.LastResponse))
+		return
+	}
+	s.setResponse("not listed on " + strconv.Itoa(queried) + " blacklists")
+	s.Success()
+}
+
+// queryDNSBL looks the ip up on the blacklist of the zone, it returns nil when the ip is not
+// listed and a error when the blacklist refuses the query, e.g. the 127.255.255.x answers
+// Spamhaus gives to public resolvers
+func (s *Service) queryDNSBL(ip net.IP, zone string) (*dnsblListing, error) {
+	name := dnsblName(ip, zone)
+	resolver := s.resolver()
+	addrs, err := resolver.LookupHost(s.context(), name)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	code := ""
+	for _, addr := range addrs {
+		a := net.ParseIP(addr).To4()
+		if a == nil || a[0] != 127 {
+			continue
+		}
+		if a[1] == 255 && a[2] == 255 {
+			return nil, fmt.Errorf("%v refused the query with %v", zone, addr)
+		}
+		code = addr
+	}
+	if code == "" {
+		return nil, fmt.Errorf("%v answered %v outside of 127.0.0.0/8", zone, strings.Join(addrs, ","))
+	}
+	listing := &dnsblListing{ip: ip.String(), zone: zone, code: code}
+	if txts, err := resolver.LookupTXT(s.context(), name); err == nil {
+		listing.reason = strings.Join(txts, " ")
+	}
+	return listing, nil
+}
+
+// dnsblName returns the name to look the ip up on a blacklist, the reversed octets of a IPv4 or
+// nibbles of a IPv6 address in the zone
+func dnsblName(ip net.IP, zone string) string {
+	var labels []string
+	if v4 := ip.To4(); v4 != nil {
+		for i := len(v4) - 1; i >= 0; i-- {
+			labels = append(labels, strconv.Itoa(int(v4[i])))
+		}
+	} else {
+		v6 := ip.To16()
+		for i := len(v6) - 1; i >= 0; i-- {
+			labels = append(labels, strconv.FormatUint(uint64(v6[i]&0x0f), 16), strconv.FormatUint(uint64(v6[i]>>4), 16))
+		}
+	}
+	return strings.Join(labels, ".") + "." + strings.TrimSuffix(zone, ".") + "."
+}
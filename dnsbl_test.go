@@ -0,0 +1,84 @@
+package scout
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsblHandler is a DNS-over-HTTPS blacklist that lists 192.0.2.1 on listed.test, refuses the
+// queries of refused.test and lists nothing else
+func dnsblHandler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var q dnsmessage.Message
+		if err := q.Unpack(body); err != nil {
+			t.Error(err)
+			return
+		}
+		resp := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: q.ID, Response: true, RecursionAvailable: true},
+			Questions: q.Questions,
+		}
+		for _, qu := range q.Questions {
+			hdr := dnsmessage.ResourceHeader{Name: qu.Name, Type: qu.Type, Class: dnsmessage.ClassINET, TTL: 60}
+			switch name := qu.Name.String(); {
+			case name == "1.2.0.192.listed.test." && qu.Type == dnsmessage.TypeA:
+				resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.AResource{A: [4]byte{127, 0, 0, 2}}})
+			case name == "1.2.0.192.listed.test." && qu.Type == dnsmessage.TypeTXT:
+				resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.TXTResource{TXT: []string{"listed for spam"}}})
+			case strings.HasSuffix(name, ".refused.test.") && qu.Type == dnsmessage.TypeA:
+				resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.AResource{A: [4]byte{127, 255, 255, 254}}})
+			case name == "1.2.0.192.listed.test." || strings.HasSuffix(name, ".refused.test."):
+			default:
+				resp.RCode = dnsmessage.RCodeNameError
+			}
+		}
+		b, _ := resp.Pack()
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(b)
+	}
+}
+
+func TestCheckDNSBL(t *testing.T) {
+	assert := assert.New(t)
+
+	doh := httptest.NewServer(dnsblHandler(t))
+	defer doh.Close()
+
+	serv := &Service{
+		Name:         "Mail",
+		Address:      "192.0.2.2",
+		Type:         "dnsbl",
+		DNSBLs:       []string{"listed.test", "clean.test", "refused.test"},
+		DNSOverHTTPS: doh.URL,
+		Timeout:      Duration(5 * time.Second),
+		Logger:       NewSlogLogger(nil),
+	}
+	_, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("not listed on 2 blacklists", serv.LastResponse)
+
+	serv.Address = "192.0.2.1"
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureBlacklisted, fail.Class)
+	assert.True(errors.Is(fail.Err, ErrBlacklisted))
+	assert.Equal("Listed on 1 of 2 blacklists: 192.0.2.1 on listed.test (127.0.0.2, listed for spam)", fail.Issue)
+
+	serv.DNSBLs = []string{"refused.test"}
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureDNS, fail.Class)
+	assert.Contains(fail.Issue, "refused.test refused the query with 127.255.255.254")
+
+	assert.Equal("b.a.9.8.7.6.5.0.4.0.0.0.3.0.0.0.2.0.0.0.1.0.0.0.0.0.0.0.1.2.3.4.zen.spamhaus.org.", dnsblName(net.ParseIP("4321:0:1:2:3:4:567:89ab"), "zen.spamhaus.org"))
+}
@@ -0,0 +1,204 @@
+package scout
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DNSCache is a DNS answer cache shared by the services of a scout, answers are kept for the
+// smallest TTL of the records that made them up
+type DNSCache struct {
+	// MinTTL is the lower bound of the time an answer is cached, it is also used for answers that
+	// carry no TTL (e.g. from the hosts file)
+	MinTTL time.Duration
+	// MaxTTL is the upper bound of the time an answer is cached, zero means no bound
+	MaxTTL  time.Duration
+	hits    uint64
+	misses  uint64
+	entries map[string]dnsCacheEntry
+	mux     sync.Mutex
+}
+
+type dnsCacheEntry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// DNSCacheStats are the hit and miss counters of a DNSCache
+type DNSCacheStats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+}
+
+// NewDNSCache returns a empty DNS cache
+func NewDNSCache() *DNSCache {
+	return &DNSCache{
+		MinTTL:  time.Second,
+		entries: make(map[string]dnsCacheEntry),
+	}
+}
+
+// Stats returns the hit and miss counters and the number of cached answers
+func (c *DNSCache) Stats() DNSCacheStats {
+	c.mux.Lock()
+	entries := len(c.entries)
+	c.mux.Unlock()
+	return DNSCacheStats{
+		Hits:    atomic.LoadUint64(&c.hits),
+		Misses:  atomic.LoadUint64(&c.misses),
+		Entries: entries,
+	}
+}
+
+// Flush removes all cached answers
+func (c *DNSCache) Flush() {
+	c.mux.Lock()
+	c.entries = make(map[string]dnsCacheEntry)
+	c.mux.Unlock()
+}
+
+// lookup returns the cached answer for host or resolves it with dial (nil for the system
+// dialer), the key separates answers of different resolvers
+func (c *DNSCache) lookup(ctx context.Context, key, host string, dial func(ctx context.Context, network, address string) (net.Conn, error)) ([]net.IP, error) {
+	now := time.Now()
+	c.mux.Lock()
+	entry, ok := c.entries[key]
+	c.mux.Unlock()
+	if ok && now.Before(entry.expires) {
+		atomic.AddUint64(&c.hits, 1)
+		return entry.ips, nil
+	}
+	atomic.AddUint64(&c.misses, 1)
+
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	rec := &ttlRecorder{}
+	r := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			conn, err := dial(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := conn.(net.PacketConn); ok {
+				return &ttlPacketConn{ttlConn{Conn: conn, rec: rec}}, nil
+			}
+			return &ttlConn{Conn: conn, rec: rec, stream: true}, nil
+		},
+	}
+	addrs, err := r.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+
+	ttl := rec.ttl()
+	if ttl < c.MinTTL {
+		ttl = c.MinTTL
+	}
+	if c.MaxTTL > 0 && ttl > c.MaxTTL {
+		ttl = c.MaxTTL
+	}
+	c.mux.Lock()
+	if c.entries == nil {
+		c.entries = make(map[string]dnsCacheEntry)
+	}
+	c.entries[key] = dnsCacheEntry{ips: ips, expires: now.Add(ttl)}
+	c.mux.Unlock()
+	return ips, nil
+}
+
+// ttlRecorder keeps the smallest answer TTL seen in the DNS responses of a lookup
+type ttlRecorder struct {
+	min  uint32
+	seen bool
+	mux  sync.Mutex
+}
+
+func (r *ttlRecorder) record(msg []byte) {
+	var p dnsmessage.Parser
+	if _, err := p.Start(msg); err != nil {
+		return
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return
+	}
+	for {
+		h, err := p.AnswerHeader()
+		if err != nil {
+			return
+		}
+		r.mux.Lock()
+		if !r.seen || h.TTL < r.min {
+			r.min = h.TTL
+			r.seen = true
+		}
+		r.mux.Unlock()
+		if err := p.SkipAnswer(); err != nil {
+			return
+		}
+	}
+}
+
+func (r *ttlRecorder) ttl() time.Duration {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return time.Duration(r.min) * time.Second
+}
+
+// ttlConn passes DNS responses read from the resolver conn to a ttlRecorder, stream conns
+// are TCP framed (two byte length prefix) so they are buffered until a message is complete
+type ttlConn struct {
+	net.Conn
+	rec    *ttlRecorder
+	stream bool
+	buf    []byte
+}
+
+func (c *ttlConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		if !c.stream {
+			c.rec.record(b[:n])
+			return n, err
+		}
+		c.buf = append(c.buf, b[:n]...)
+		for len(c.buf) >= 2 {
+			l := int(c.buf[0])<<8 | int(c.buf[1])
+			if len(c.buf) < 2+l {
+				break
+			}
+			c.rec.record(c.buf[2 : 2+l])
+			c.buf = c.buf[2+l:]
+		}
+	}
+	return n, err
+}
+
+// ttlPacketConn is a ttlConn for packet conns, the go resolver only uses packet framing
+// for conns that implement net.PacketConn
+type ttlPacketConn struct {
+	ttlConn
+}
+
+func (c *ttlPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := c.Conn.(net.PacketConn).ReadFrom(b)
+	if n > 0 {
+		c.rec.record(b[:n])
+	}
+	return n, addr, err
+}
+
+func (c *ttlPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return c.Conn.(net.PacketConn).WriteTo(b, addr)
+}
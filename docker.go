@@ -0,0 +1,127 @@
+package scout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultDockerHost = "unix:///var/run/docker.sock"
+
+// CheckDocker will inspect the container named by the Address of the service through the Docker
+// API and fail when it is not running or its HEALTHCHECK reports it unhealthy, the API is reached
+// at DockerHost, $DOCKER_HOST or the local socket
+func (s *Service) CheckDocker() {
+	if s.Address == "" {
+		s.fail(FailureConfig, nil, "Docker service has no container")
+		return
+	}
+	host := s.DockerHost
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = defaultDockerHost
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		s.fail(FailureConfig, err, fmt.Sprintf("Docker Host Error %v", err))
+		return
+	}
+	base := "http://docker"
+	dialer := &net.Dialer{Timeout: s.Timeout.Duration()}
+	transport := &http.Transport{}
+	switch u.Scheme {
+	case "unix":
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", u.Path)
+		}
+	case "tcp", "http":
+		base = "http://" + u.Host
+	default:
+		s.fail(FailureConfig, nil, fmt.Sprintf("Docker Host Error unsupported scheme %q", u.Scheme))
+		return
+	}
+	client := &http.Client{Timeout: s.Timeout.Duration(), Transport: transport}
+	defer transport.CloseIdleConnections()
+
+	t1 := time.Now()
+	req, err := http.NewRequest(http.MethodGet, base+"/containers/"+url.PathEscape(strings.TrimPrefix(s.Address, "/"))+"/json", nil)
+	if err != nil {
+		s.fail(FailureConfig, err, fmt.Sprintf("Docker Error %v", err))
+		return
+	}
+	res, err := client.Do(req.WithContext(s.context()))
+	if err != nil {
+		s.fail(classifyError(err, false), err, fmt.Sprintf("Docker Error %v", err))
+		return
+	}
+	defer res.Body.Close()
+	buf, err := readAll(res.Body)
+	defer putBuffer(buf)
+	if err != nil {
+		s.fail(classifyError(err, true), err, fmt.Sprintf("Docker Error %v", err))
+		return
+	}
+	body := buf.Bytes()
+	s.setRequestLatency(time.Since(t1).Milliseconds())
+	s.setStatusCode(res.StatusCode)
+	if res.StatusCode != http.StatusOK {
+		s.fail(FailureProtocol, nil, fmt.Sprintf("Docker Error %v", dockerError(res, body)))
+		return
+	}
+
+	var inspect struct {
+		State struct {
+			Status   string `json:"Status"`
+			Running  bool   `json:"Running"`
+			ExitCode int    `json:"ExitCode"`
+			Health   *struct {
+				Status string `json:"Status"`
+				Log    []struct {
+					ExitCode int    `json:"ExitCode"`
+					Output   string `json:"Output"`
+				} `json:"Log"`
+			} `json:"Health"`
+		} `json:"State"`
+	}
+	if err := json.Unmarshal(body, &inspect); err != nil {
+		s.fail(FailureProtocol, err, fmt.Sprintf("Docker Error %v", err))
+		return
+	}
+	state := inspect.State
+	s.Details = map[string]string{"status": state.Status}
+	if !state.Running {
+		s.fail(FailureUnhealthy, nil, fmt.Sprintf("Docker container %v is %v (exit code %d)", s.Address, state.Status, state.ExitCode))
+		return
+	}
+	if state.Health != nil {
+		s.Details["health"] = state.Health.Status
+		if state.Health.Status == "unhealthy" {
+			if n := len(state.Health.Log); n > 0 {
+				s.setResponse(strings.TrimSpace(state.Health.Log[n-1].Output))
+			}
+			s.fail(FailureUnhealthy, nil, fmt.Sprintf("Docker container %v is unhealthy", s.Address))
+			return
+		}
+	}
+	s.Success()
+}
+
+// dockerError returns the message of a Docker API error response
+func dockerError(res *http.Response, body []byte) error {
+	var msg struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &msg) == nil && msg.Message != "" {
+		return errors.New(msg.Message)
+	}
+	return errors.New(res.Status)
+}
@@ -0,0 +1,73 @@
+package scout
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDocker(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "docker.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/containers/web/json":
+			w.Write([]byte(`{"State":{"Status":"running","Running":true,"Health":{"Status":"healthy"}}}`))
+		case "/containers/worker/json":
+			w.Write([]byte(`{"State":{"Status":"running","Running":true,"Health":{"Status":"unhealthy","Log":[{"ExitCode":1,"Output":"queue unreachable\n"}]}}}`))
+		case "/containers/cron/json":
+			w.Write([]byte(`{"State":{"Status":"exited","Running":false,"ExitCode":137}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"No such container: db"}`))
+		}
+	}))
+
+	serv := &Service{
+		ID:         uuid.New(),
+		Name:       "Web",
+		Type:       "docker",
+		Address:    "web",
+		DockerHost: "unix://" + sock,
+		Timeout:    Duration(2 * time.Second),
+		Logger:     NewSlogLogger(nil),
+	}
+	suc, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("running", suc.Details["status"])
+	assert.Equal("healthy", suc.Details["health"])
+
+	serv.Address = "worker"
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Contains(fail.Issue, "is unhealthy")
+	assert.Equal("queue unreachable", serv.LastResponse)
+
+	serv.Address = "cron"
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Contains(fail.Issue, "is exited (exit code 137)")
+
+	serv.Address = "db"
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Contains(fail.Issue, "No such container")
+}
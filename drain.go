@@ -0,0 +1,32 @@
+package scout
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// drainPoll is how often Drain looks whether the checks and notifications are done
+const drainPoll = 10 * time.Millisecond
+
+// Drain stops scheduling checks, then waits for the checks in flight to finish and for the
+// notifiers to send their queued notifications, it gives up when ctx is done and returns what
+// was left, e.g. to shut down gracefully on SIGTERM
+func (s *Scout) Drain(ctx context.Context) error {
+	s.StopScoutingServices()
+	ticker := time.NewTicker(drainPoll)
+	defer ticker.Stop()
+	for {
+		checks := atomic.LoadInt64(&s.inflight)
+		notes := atomic.LoadInt64(&s.notifyPending)
+		if checks == 0 && notes == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("scout: drain left %d checks and %d notifications: %w", checks, notes, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
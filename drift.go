@@ -0,0 +1,76 @@
+package scout
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ServiceResolveDrift is sent on the Response Channel when the DNS answer for a service with
+// ResolveTo stops (Drifted) or starts again (!Drifted) to include the pinned address
+type ServiceResolveDrift struct {
+	Service   uuid.UUID `json:"service"`
+	ResolveTo string    `json:"resolveTo"`
+	Resolved  []string  `json:"resolved"`
+	Drifted   bool      `json:"drifted"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// checkResolveDrift resolves the real DNS of a service pinned with ResolveTo and emits a
+// ServiceResolveDrift when the answer stops or starts matching the pinned address, it runs in the
+// check within its deadline
+func (s *Service) checkResolveDrift() {
+	ctx := s.context()
+	ips, err := s.lookup(ctx)
+	if err != nil {
+		s.Logger.Debugf("Could not resolve %s for ResolveTo drift, %v", s.Name, err)
+		return
+	}
+	pinned, err := s.pinnedIPs(ctx)
+	if err != nil {
+		s.Logger.Debugf("Could not resolve ResolveTo %s of %s, %v", s.ResolveTo, s.Name, err)
+		return
+	}
+	resolved := make([]string, len(ips))
+	drifted := true
+	for i, ip := range ips {
+		resolved[i] = ip.String()
+		for _, p := range pinned {
+			if ip.Equal(p) {
+				drifted = false
+			}
+		}
+	}
+	changed := drifted != s.resolveDrift
+	s.update(func() {
+		s.ResolvedIPs = resolved
+		s.resolveDrift = drifted
+	})
+	if !changed {
+		return
+	}
+	if drifted {
+		s.Logger.Warnf("Service %s is pinned to %s but %s resolves to %v", s.Name, s.ResolveTo, s.parseHost(), resolved)
+	}
+	s.emit(ServiceResolveDrift{
+		Service:   s.ID,
+		ResolveTo: s.ResolveTo,
+		Resolved:  resolved,
+		Drifted:   drifted,
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+// pinnedIPs returns the addresses of the ResolveTo host, resolving it when it is a name
+func (s *Service) pinnedIPs(ctx context.Context) ([]net.IP, error) {
+	host := s.ResolveTo
+	if h, _, err := net.SplitHostPort(s.ResolveTo); err == nil {
+		host = h
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	return s.lookupHost(ctx, host)
+}
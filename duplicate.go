@@ -0,0 +1,186 @@
+package scout
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DuplicateWarn logs a warning for services checking the same target, it is the default policy
+	DuplicateWarn = "warn"
+	// DuplicateMerge only keeps the first service checking a target, later ones are not added
+	DuplicateMerge = "merge"
+	// DuplicateShare keeps all services checking a target but only the first one runs the checks,
+	// its results are fanned out to the others
+	DuplicateShare = "share"
+)
+
+// stateFields are the exported fields of a service that hold the state of its checks rather than
+// configure them
+var stateFields = map[string]bool{
+	"CreatedAt": true, "UpdatedAt": true, "Online": true, "DNSResolve": true, "RequestLatency": true,
+	"NetworkLatency": true, "TraceData": true, "TraceBaseline": true, "TraceBaselineAt": true,
+	"LastResponse": true, "DownText": true, "DegradedText": true, "LastStatusCode": true,
+	"LastOnline": true, "Paused": true, "MovedTo": true, "MovedService": true, "TLSHandshake": true,
+	"CertExpiry": true, "ResolvedIPs": true, "ContentHash": true,
+	"IPResults": true, "Details": true, "SilencedUntil": true, "SilenceReason": true,
+	"Acknowledged": true, "AckReason": true,
+}
+
+// unprobedFields are the exported config fields of a service that identify it, schedule or
+// report its checks, services that only differ in them check the same target
+var unprobedFields = map[string]bool{
+	"ID": true, "ExternalID": true, "Name": true, "Template": true, "Tags": true, "DependsOn": true,
+	"Interval": true, "Retry": true, "RetryMinInterval": true, "RetryMaxInterval": true,
+	"RetryMax": true, "RetryStrategy": true, "RetryCap": true, "RecoveryInterval": true,
+	"FailureTTL": true, "ExpiresAt": true, "ExpireAction": true, "SLO": true, "DebugChecks": true,
+	"TraceInterval": true,
+}
+
+// targetKey identifies the target a service checks for duplicate detection, the type, address
+// and port of the service followed by a hash of every other field that configures its checks.
+// Heartbeat services are passive and never duplicates
+func (s *Service) targetKey() string {
+	key := []string{s.Type, s.Address, fmt.Sprint(s.Port)}
+	if s.Type == "heartbeat" {
+		return strings.Join(append(key, s.ID.String()), "|")
+	}
+	probe := make(map[string]interface{})
+	v := reflect.ValueOf(s).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.PkgPath != "" || f.Tag.Get("json") == "-" || stateFields[f.Name] || unprobedFields[f.Name] {
+			continue
+		}
+		probe[f.Name] = v.Field(i).Interface()
+	}
+	b, _ := json.Marshal(probe)
+	sum := sha256.Sum256(b)
+	return strings.Join(append(key, hex.EncodeToString(sum[:8])), "|")
+}
+
+// addTarget applies the duplicate policy to serv, it must be called with the scout lock held
+// and returns the service serv is merged into when it should not be added
+func (s *Scout) addTarget(serv *Service) *Service {
+	if s.targets == nil {
+		s.targets = make(map[string]*Service)
+	}
+	key := serv.targetKey()
+	primary, ok := s.targets[key]
+	if !ok {
+		s.targets[key] = serv
+		serv.target = key
+		return nil
+	}
+	switch s.duplicatePolicy {
+	case DuplicateMerge:
+		s.Logger.Warnf("Service %s (%s) checks the same target as %s (%s), merging into %s", serv.Name, serv.ID, primary.Name, primary.ID, primary.ID)
+		return primary
+	case DuplicateShare:
+		s.Logger.Infof("Service %s (%s) shares the checks of %s (%s)", serv.Name, serv.ID, primary.Name, primary.ID)
+		serv.primary = primary
+		primary.followers = append(primary.followers, serv)
+	default:
+		s.Logger.Warnf("Service %s (%s) checks the same target as %s (%s)", serv.Name, serv.ID, primary.Name, primary.ID)
+	}
+	serv.target = key
+	return nil
+}
+
+// delTarget removes serv from the duplicate tracking, promoting the first follower of a shared
+// target to run the checks, it must be called with the scout lock held. The target is the one
+// serv was added with, its config may have changed since
+func (s *Scout) delTarget(serv *Service) {
+	if serv.primary != nil {
+		p := serv.primary
+		for i, f := range p.followers {
+			if f == serv {
+				p.followers = append(p.followers[:i], p.followers[i+1:]...)
+				break
+			}
+		}
+		serv.primary = nil
+		return
+	}
+	key := serv.target
+	if s.targets[key] != serv {
+		return
+	}
+	delete(s.targets, key)
+	if len(serv.followers) == 0 {
+		return
+	}
+	next := serv.followers[0]
+	next.primary = nil
+	next.followers = serv.followers[1:]
+	for _, f := range next.followers {
+		f.primary = next
+	}
+	serv.followers = nil
+	s.targets[key] = next
+	if s.Running {
+		go next.Scout()
+	}
+}
+
+// Duplicates returns the IDs of the services checking the same target, keyed by target
+func (s *Scout) Duplicates() map[string][]uuid.UUID {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	byTarget := make(map[string][]uuid.UUID)
+	for _, serv := range s.Services {
+		key := serv.targetKey()
+		byTarget[key] = append(byTarget[key], serv.ID)
+	}
+	for key, ids := range byTarget {
+		if len(ids) < 2 {
+			delete(byTarget, key)
+		}
+	}
+	return byTarget
+}
+
+// fanOut copies a success, failure or sample of a shared target to the services following it
+func (s *Service) fanOut(r Result) {
+	if s.scout == nil {
+		return
+	}
+	s.scout.mux.RLock()
+	followers := append([]*Service(nil), s.followers...)
+	s.scout.mux.RUnlock()
+	for _, f := range followers {
+		f.update(func() {
+			f.Online = s.Online
+			f.DNSResolve = s.DNSResolve
+			f.RequestLatency = s.RequestLatency
+			f.NetworkLatency = s.NetworkLatency
+			f.LastResponse = s.LastResponse
+			f.LastStatusCode = s.LastStatusCode
+			f.LastOnline = s.LastOnline
+			f.DownText = s.DownText
+			f.DegradedText = s.DegradedText
+			f.Details = s.Details
+			f.lastFailure = s.lastFailure
+			f.failures = s.failures
+		})
+		switch res := r.(type) {
+		case ServiceSuccess:
+			res.Service = f.ID
+			res.Labels = copyDetails(f.Tags)
+			f.emit(res)
+		case ServiceFailure:
+			res.Service = f.ID
+			res.Labels = copyDetails(f.Tags)
+			f.emit(res)
+		case ServiceSample:
+			res.Service = f.ID
+			f.emit(res)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package scout
+
+import "errors"
+
+var (
+	// ErrNilLogger is returned when a scout is created without a logger
+	ErrNilLogger = errors.New("scout: logger is nil")
+	// ErrNilService is returned when a nil service is added to a scout
+	ErrNilService = errors.New("scout: service is nil")
+	// ErrMissingServiceID is returned when a service without a ID is added to a scout that does
+	// not auto assign IDs
+	ErrMissingServiceID = errors.New("scout: service has no id")
+	// ErrDuplicateServiceID is returned when a service is added with the ID of a existing service
+	ErrDuplicateServiceID = errors.New("scout: duplicate service id")
+	// ErrDuplicateExternalID is returned when a service is added with the external ID of a
+	// existing service
+	ErrDuplicateExternalID = errors.New("scout: duplicate external id")
+	// ErrDuplicateTarget is returned when a service is added that checks the same target as a
+	// existing service of a scout WithDuplicatePolicy(DuplicateMerge)
+	ErrDuplicateTarget = errors.New("scout: duplicate target")
+	// ErrUnknownService is returned when no service of the scout has the ID
+	ErrUnknownService = errors.New("scout: unknown service")
+	// ErrUnknownExternalID is returned when no service of the scout has the external ID
+	ErrUnknownExternalID = errors.New("scout: unknown external id")
+	// ErrNoCheckResult is returned by CheckNow when the check of the service produced no success
+	// or failure
+	ErrNoCheckResult = errors.New("scout: check produced no result")
+	// ErrNoTimeline is returned when the timeline of a scout created without WithTimeline is read
+	ErrNoTimeline = errors.New("scout: timeline is not kept")
+	// ErrNotHeartbeat is returned when a heartbeat is recorded for a service that is not a
+	// heartbeat service
+	ErrNotHeartbeat = errors.New("scout: not a heartbeat service")
+	// ErrDependencyCycle is returned when a service is added that depends on itself, directly
+	// or through the services it depends on
+	ErrDependencyCycle = errors.New("scout: dependency cycle")
+	// ErrNilGroup is returned when a nil group is added to a scout
+	ErrNilGroup = errors.New("scout: group is nil")
+	// ErrDuplicateGroupID is returned when a group is added with the ID of a existing group
+	ErrDuplicateGroupID = errors.New("scout: duplicate group id")
+	// ErrInvalidGroupPolicy is returned when a group is added with a unknown policy or a
+	// percentage outside of (0, 100]
+	ErrInvalidGroupPolicy = errors.New("scout: invalid group policy")
+	// ErrUnknownGroup is returned when no group of the scout has the ID
+	ErrUnknownGroup = errors.New("scout: unknown group")
+	// ErrUnknownTemplate is returned when a service or template references a template the scout
+	// does not have
+	ErrUnknownTemplate = errors.New("scout: unknown template")
+	// ErrTemplateCycle is returned when a template extends itself, directly or through the
+	// templates it extends
+	ErrTemplateCycle = errors.New("scout: template cycle")
+	// ErrUnknownNotifier is returned when a route sends to a notifier the scout does not have
+	ErrUnknownNotifier = errors.New("scout: unknown notifier")
+	// ErrNoIncident is returned when a service that is not failing is acknowledged
+	ErrNoIncident = errors.New("scout: service has no ongoing failure")
+	// ErrNoSLO is returned when the error budget of a service or group without a SLO is read
+	ErrNoSLO = errors.New("scout: no slo")
+	// ErrCheckFailed is matched by the error of every failed check
+	ErrCheckFailed = errors.New("scout: check failed")
+	// ErrDNSResolution is matched by checks that could not resolve the address of the service
+	ErrDNSResolution = errors.New("scout: dns resolution failed")
+	// ErrTimeout is matched by checks that timed out connecting to or reading from the service
+	ErrTimeout = errors.New("scout: timeout")
+	// ErrConnectionRefused is matched by checks whose connection was refused
+	ErrConnectionRefused = errors.New("scout: connection refused")
+	// ErrConnection is matched by checks that could not connect for any other reason
+	ErrConnection = errors.New("scout: connection failed")
+	// ErrTLSVerification is matched by checks with a failed TLS handshake or certificate
+	// verification
+	ErrTLSVerification = errors.New("scout: tls verification failed")
+	// ErrProtocol is matched by checks whose service answered with a error or a invalid reply
+	ErrProtocol = errors.New("scout: protocol error")
+	// ErrUnexpectedStatus is matched by checks whose status code did not match the expected one
+	ErrUnexpectedStatus = errors.New("scout: unexpected status")
+	// ErrUnexpectedContent is matched by checks whose response did not match the expected one
+	ErrUnexpectedContent = errors.New("scout: unexpected content")
+	// ErrLatencyExceeded is matched by checks slower than the MaxLatency of the service
+	ErrLatencyExceeded = errors.New("scout: latency exceeded")
+	// ErrUnhealthy is matched by checks whose target reports itself unhealthy or is outside of
+	// the thresholds of the service
+	ErrUnhealthy = errors.New("scout: unhealthy")
+	// ErrBlacklisted is matched by dnsbl services whose address is listed on a blacklist
+	ErrBlacklisted = errors.New("scout: listed on a dns blacklist")
+	// ErrHeartbeatMissed is matched by heartbeat services that missed a heartbeat
+	ErrHeartbeatMissed = errors.New("scout: heartbeat missed")
+	// ErrInvalidCheck is matched by checks that can not run as the service is configured
+	ErrInvalidCheck = errors.New("scout: invalid check configuration")
+	// ErrRetriesExhausted is matched by the last failure of a service that stopped retrying
+	ErrRetriesExhausted = errors.New("scout: retries exhausted")
+	// ErrNotAssigned is returned when a agent reports a result of a service it does not check
+	ErrNotAssigned = errors.New("scout: service not assigned to agent")
+	// ErrInvalidQuorum is matched by services with a Quorum that is negative or above the number
+	// of their agents
+	ErrInvalidQuorum = errors.New("scout: invalid quorum")
+	// ErrInvalidSecurityHeaders is matched by services whose SecurityHeaders audit unknown headers
+	// or have invalid value patterns
+	ErrInvalidSecurityHeaders = errors.New("scout: invalid security headers policy")
+	// ErrSecret is returned when a secret reference of a service can not be resolved
+	ErrSecret = errors.New("scout: unresolved secret")
+	// ErrInvalidMessageTemplate is returned when a message template of the notifications does
+	// not parse
+	ErrInvalidMessageTemplate = errors.New("scout: invalid message template")
+	// ErrInvalidSchedule is returned when a notifier schedule has a unknown time zone or a
+	// invalid window
+	ErrInvalidSchedule = errors.New("scout: invalid notifier schedule")
+	// ErrInvalidReport is returned when a report schedule has a unknown period, format or time
+	// zone and when a report is rendered in a unknown format
+	ErrInvalidReport = errors.New("scout: invalid report")
+	// ErrUnauthenticated is returned when a API request has no valid credentials
+	ErrUnauthenticated = errors.New("scout: unauthenticated")
+	// ErrForbidden is returned when the principal of a API request may not do what it asks
+	ErrForbidden = errors.New("scout: forbidden")
+	// ErrInvalidService is matched by the ValidationError of a service that can not be checked
+	ErrInvalidService = errors.New("scout: invalid service")
+	// ErrUnsupportedType is matched by services with a type scout has no check for
+	ErrUnsupportedType = errors.New("scout: unsupported type")
+	// ErrInvalidInterval is matched by services with a interval that is not positive
+	ErrInvalidInterval = errors.New("scout: invalid interval")
+	// ErrInvalidTimeout is matched by services with a Timeout below minTimeout, most likely a
+	// number of seconds given as a Duration, which counts nanoseconds
+	ErrInvalidTimeout = errors.New("scout: invalid timeout")
+	// ErrInvalidAddress is matched by services without a address or with a address that does
+	// not fit their type
+	ErrInvalidAddress = errors.New("scout: invalid address")
+	// ErrInvalidExpected is matched by services whose Expected or ExpectedBanner does not compile
+	ErrInvalidExpected = errors.New("scout: invalid expected pattern")
+	// ErrInvalidTLSPolicy is matched by services with certificate pins that are not SHA-256
+	// hashes, a unknown MinTLSVersion or unknown CipherSuites
+	ErrInvalidTLSPolicy = errors.New("scout: invalid tls policy")
+	// ErrInvalidRetry is matched by services with Retry set without valid retry intervals and by
+	// services with a unknown RetryStrategy or a negative RetryCap
+	ErrInvalidRetry = errors.New("scout: invalid retry")
+)
@@ -0,0 +1,84 @@
+package scout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const maxExecOutput = 64 * 1024
+
+// limitedBuffer keeps the first max bytes written to it and discards the rest
+type limitedBuffer struct {
+	buf []byte
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - len(b.buf); room > 0 {
+		if len(p) > room {
+			b.buf = append(b.buf, p[:room]...)
+		} else {
+			b.buf = append(b.buf, p...)
+		}
+	}
+	return len(p), nil
+}
+
+// CheckExec will run the Command of the service and interpret its exit code like a monitoring
+// plugin, 0 is up, 1 is degraded and 2 or any other code is down, the stdout of the command is
+// kept as the last response and its first line used as the issue
+func (s *Service) CheckExec() {
+	if len(s.Command) == 0 {
+		s.fail(FailureConfig, nil, "Exec service has no command")
+		return
+	}
+	ctx, cancel := context.WithTimeout(s.context(), s.Timeout.Duration())
+	defer cancel()
+	cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+	stdout := &limitedBuffer{max: maxExecOutput}
+	stderr := &limitedBuffer{max: maxExecOutput}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+
+	t1 := time.Now()
+	err := cmd.Run()
+	s.setRequestLatency(time.Since(t1).Milliseconds())
+	s.setResponse(strings.TrimSpace(string(stdout.buf)))
+	if ctx.Err() == context.DeadlineExceeded {
+		s.fail(FailureReadTimeout, nil, fmt.Sprintf("Command timed out after %v", s.Timeout.Duration()))
+		return
+	}
+	code := 0
+	if err != nil {
+		var exit *exec.ExitError
+		if !errors.As(err, &exit) {
+			s.fail(FailureConfig, err, fmt.Sprintf("Command Error %v", err))
+			return
+		}
+		code = exit.ExitCode()
+	}
+	s.setStatusCode(code)
+
+	summary := s.LastResponse
+	if summary == "" {
+		summary = strings.TrimSpace(string(stderr.buf))
+	}
+	if i := strings.IndexByte(summary, '\n'); i >= 0 {
+		summary = summary[:i]
+	}
+	issue := fmt.Sprintf("Command exited with status %d", code)
+	if summary != "" {
+		issue += ": " + summary
+	}
+	switch code {
+	case 0:
+		s.Success()
+	case 1:
+		s.Degraded(issue)
+	default:
+		s.fail(FailureUnhealthy, nil, issue)
+	}
+}
@@ -0,0 +1,46 @@
+package scout
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckExec(t *testing.T) {
+	assert := assert.New(t)
+
+	serv := &Service{
+		ID:      uuid.New(),
+		Name:    "Backup",
+		Type:    "exec",
+		Command: []string{"sh", "-c", "echo 'OK - last backup 2h ago'"},
+		Timeout: Duration(2 * time.Second),
+		Logger:  NewSlogLogger(nil),
+	}
+	suc, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("", suc.Degraded)
+	assert.Equal("OK - last backup 2h ago", serv.LastResponse)
+
+	serv.Command = []string{"sh", "-c", "echo 'WARNING - last backup 26h ago'; echo details; exit 1"}
+	suc, ok = checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("Command exited with status 1: WARNING - last backup 26h ago", suc.Degraded)
+	assert.True(serv.Online)
+	assert.Equal(suc.Degraded, serv.DegradedText)
+
+	serv.Command = []string{"sh", "-c", "echo 'CRITICAL - no backup' >&2; exit 2"}
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal("Command exited with status 2: CRITICAL - no backup", fail.Issue)
+	assert.Equal(2, fail.ErrorCode)
+	assert.Equal("", serv.DegradedText)
+
+	serv.Command = []string{"sleep", "5"}
+	serv.Timeout = Duration(100 * time.Millisecond)
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Contains(fail.Issue, "timed out")
+}
@@ -0,0 +1,57 @@
+package scout
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// ExpireRemove removes a expired service from its scout, it is the default ExpireAction
+	ExpireRemove = "remove"
+	// ExpirePause stops checking a expired service but keeps it in its scout
+	ExpirePause = "pause"
+)
+
+// ServiceExpired is sent on the Response Channel when a service reaches its ExpiresAt
+type ServiceExpired struct {
+	Service   uuid.UUID `json:"service"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Action    string    `json:"action"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Expired returns true if the service has a ExpiresAt that has passed
+func (s *Service) Expired() bool {
+	return !s.ExpiresAt.IsZero() && !time.Now().Before(s.ExpiresAt)
+}
+
+// expire stops the service and removes it from its scout or pauses it depending on ExpireAction
+func (s *Service) expire() {
+	action := s.ExpireAction
+	if action != ExpirePause {
+		action = ExpireRemove
+	}
+	s.Logger.Infof("Service %s expired at %s, action: %s", s.Name, s.ExpiresAt, action)
+	s.Stop()
+	s.update(func() { s.Paused = true })
+	if action == ExpireRemove && s.scout != nil {
+		s.scout.removeExpired(s)
+	}
+	s.emit(ServiceExpired{
+		Service:   s.ID,
+		ExpiresAt: s.ExpiresAt,
+		Action:    action,
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+// removeExpired removes the expired service from the scout like DelService, unless it was
+// replaced since
+func (s *Scout) removeExpired(serv *Service) {
+	s.mux.Lock()
+	if s.Services[serv.ID] == serv {
+		s.delService(serv.ID)
+	}
+	s.mux.Unlock()
+}
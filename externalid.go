@@ -0,0 +1,104 @@
+package scout
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// IDStrategy returns the ID for a service added to a scout without one
+type IDStrategy func(*Service) uuid.UUID
+
+// RandomIDs assigns random (version 4) UUIDs, it is the strategy of WithAutoAssignIDs
+func RandomIDs(*Service) uuid.UUID {
+	return uuid.New()
+}
+
+// ExternalIDs derives the ID of a service from its ExternalID (a version 5 UUID in namespace),
+// so services from a source system keep the same ID across restarts, services without a
+// ExternalID get a random ID
+func ExternalIDs(namespace uuid.UUID) IDStrategy {
+	return func(serv *Service) uuid.UUID {
+		if serv.ExternalID == "" {
+			return uuid.New()
+		}
+		return uuid.NewSHA1(namespace, []byte(serv.ExternalID))
+	}
+}
+
+// WithIDStrategy assigns IDs with strategy to services added without a ID instead of rejecting them
+func WithIDStrategy(strategy IDStrategy) Option {
+	return func(s *Scout) error {
+		if strategy == nil {
+			return errors.New("scout: id strategy is nil")
+		}
+		s.autoAssignIDs = true
+		s.idStrategy = strategy
+		return nil
+	}
+}
+
+// newID returns a ID for serv with the scout ID strategy
+func (s *Scout) newID(serv *Service) uuid.UUID {
+	if s.idStrategy == nil {
+		return RandomIDs(serv)
+	}
+	return s.idStrategy(serv)
+}
+
+// indexExternalID makes serv available by its ExternalID, it must be called with the scout
+// lock held
+func (s *Scout) indexExternalID(serv *Service) {
+	if serv.ExternalID == "" {
+		return
+	}
+	if s.externalIDs == nil {
+		s.externalIDs = make(map[string]uuid.UUID)
+	}
+	s.externalIDs[serv.ExternalID] = serv.ID
+}
+
+// unindexExternalID removes the ExternalID of serv from the index, it must be called with the
+// scout lock held
+func (s *Scout) unindexExternalID(serv *Service) {
+	if id, ok := s.externalIDs[serv.ExternalID]; ok && id == serv.ID {
+		delete(s.externalIDs, serv.ExternalID)
+	}
+}
+
+// GetServiceByExternalID returns the service with the external ID or nil when there is none
+func (s *Scout) GetServiceByExternalID(externalID string) *Service {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	if id, ok := s.externalIDs[externalID]; ok {
+		return s.Services[id]
+	}
+	return nil
+}
+
+// UpdateServiceByExternalID replaces the service with the ExternalID of serv, serv takes over
+// the ID of the service it replaces and is started when the scout is running, the service is
+// kept when serv can not be added
+func (s *Scout) UpdateServiceByExternalID(serv *Service) error {
+	if serv == nil {
+		return ErrNilService
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	id, ok := s.externalIDs[serv.ExternalID]
+	if !ok || serv.ExternalID == "" {
+		return fmt.Errorf("%w: %s", ErrUnknownExternalID, serv.ExternalID)
+	}
+	serv.ID = id
+	return s.replaceService(s.Services[id], serv)
+}
+
+// DelServiceByExternalID removes the service with the external ID from monitoring
+func (s *Scout) DelServiceByExternalID(externalID string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if id, ok := s.externalIDs[externalID]; ok {
+		s.delService(id)
+	}
+}
@@ -0,0 +1,190 @@
+package scout
+
+import (
+	"crypto/x509"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// FailureClass is a stable machine readable code for the cause of a failure, the Issue of a
+// failure is meant for humans and changes with the error text
+type FailureClass string
+
+const (
+	// FailureDNS is a failure to resolve the address of the service
+	FailureDNS FailureClass = "dns_error"
+	// FailureConnectTimeout is a connection that was not established within the timeout
+	FailureConnectTimeout FailureClass = "connect_timeout"
+	// FailureConnectRefused is a connection refused by the target
+	FailureConnectRefused FailureClass = "connect_refused"
+	// FailureConnect is any other failure to connect, e.g. a unreachable network
+	FailureConnect FailureClass = "connect_error"
+	// FailureTLS is a failed TLS handshake or certificate verification
+	FailureTLS FailureClass = "tls_error"
+	// FailureCertMismatch is a certificate that does not match the pinned fingerprints or public
+	// keys of the service
+	FailureCertMismatch FailureClass = "cert_mismatch"
+	// FailureTLSPolicy is a TLS version or cipher suite below the TLS policy of the service, or
+	// a server that still accepts the versions below its MinTLSVersion
+	FailureTLSPolicy FailureClass = "tls_policy"
+	// FailureCertChain is a server that sends a incomplete or misordered certificate chain
+	FailureCertChain FailureClass = "cert_chain"
+	// FailureCertHostname is a certificate that does not cover the hostname of the check
+	FailureCertHostname FailureClass = "cert_hostname"
+	// FailureCertRevoked is a certificate revoked by its issuer, per OCSP or its CRL
+	FailureCertRevoked FailureClass = "cert_revoked"
+	// FailureRevocationUnknown is a certificate whose revocation status could not be read, e.g.
+	// with a unreachable OCSP responder and CRL
+	FailureRevocationUnknown FailureClass = "revocation_unknown"
+	// FailureReadTimeout is a target that accepted the connection but did not answer in time
+	FailureReadTimeout FailureClass = "read_timeout"
+	// FailureProtocol is a target that answered with a error or a reply that could not be
+	// understood
+	FailureProtocol FailureClass = "protocol_error"
+	// FailureStatusMismatch is a status code that did not match the expected one
+	FailureStatusMismatch FailureClass = "status_mismatch"
+	// FailureBodyMismatch is a response, banner or value that did not match the expected one
+	FailureBodyMismatch FailureClass = "body_mismatch"
+	// FailureLatency is a request latency above the MaxLatency of the service
+	FailureLatency FailureClass = "latency_exceeded"
+	// FailureUnhealthy is a target that answered but reports itself unhealthy or outside of the
+	// thresholds of the service, e.g. a stopped container or a clock offset
+	FailureUnhealthy FailureClass = "unhealthy"
+	// FailureCacheValidation is a response without validators or whose conditional request was
+	// not answered with a 304 Not Modified
+	FailureCacheValidation FailureClass = "cache_validation"
+	// FailureCompression is a response that is not compressed as the service expects
+	FailureCompression FailureClass = "compression_mismatch"
+	// FailureContentDrift is a response whose content changed from the one first seen by a service
+	// with ContentDrift
+	FailureContentDrift FailureClass = "content_drift"
+	// FailureSecurityHeaders is a response missing required security headers or with invalid ones
+	FailureSecurityHeaders FailureClass = "security_headers"
+	// FailureSchema is a response body that violates the JSON Schema of the service
+	FailureSchema FailureClass = "schema_violation"
+	// FailureBlacklisted is a address listed on a DNS blacklist
+	FailureBlacklisted FailureClass = "blacklisted"
+	// FailureHeartbeatMissed is a heartbeat that was not received in time
+	FailureHeartbeatMissed FailureClass = "heartbeat_missed"
+	// FailureConfig is a service that can not be checked as configured
+	FailureConfig FailureClass = "config_error"
+	// FailureRetriesExhausted is the last failure of a service that stopped after RetryMax retries
+	FailureRetriesExhausted FailureClass = "retries_exhausted"
+	// FailureUnknown is a failure that was not classified
+	FailureUnknown FailureClass = "unknown"
+)
+
+// CheckError is the error of a failed check carried in ServiceFailure, it matches the error of
+// its class (ErrTimeout, ErrUnexpectedStatus, ...) and ErrCheckFailed with errors.Is and unwraps
+// to the error that caused the failure, if any
+type CheckError struct {
+	Class FailureClass
+	Issue string
+	Err   error
+}
+
+// Error returns the issue of the failure
+func (e *CheckError) Error() string {
+	return e.Issue
+}
+
+// Unwrap returns the error that caused the failure
+func (e *CheckError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrCheckFailed or the error of the class of the failure
+func (e *CheckError) Is(target error) bool {
+	return target == ErrCheckFailed || target == classErrors[e.Class]
+}
+
+// classErrors are the errors matched by the check errors of each failure class
+var classErrors = map[FailureClass]error{
+	FailureDNS:               ErrDNSResolution,
+	FailureConnectTimeout:    ErrTimeout,
+	FailureConnectRefused:    ErrConnectionRefused,
+	FailureConnect:           ErrConnection,
+	FailureTLS:               ErrTLSVerification,
+	FailureCertMismatch:      ErrTLSVerification,
+	FailureTLSPolicy:         ErrTLSVerification,
+	FailureCertChain:         ErrTLSVerification,
+	FailureCertHostname:      ErrTLSVerification,
+	FailureCertRevoked:       ErrTLSVerification,
+	FailureRevocationUnknown: ErrTLSVerification,
+	FailureReadTimeout:       ErrTimeout,
+	FailureProtocol:          ErrProtocol,
+	FailureStatusMismatch:    ErrUnexpectedStatus,
+	FailureBodyMismatch:      ErrUnexpectedContent,
+	FailureLatency:           ErrLatencyExceeded,
+	FailureUnhealthy:         ErrUnhealthy,
+	FailureCacheValidation:   ErrUnexpectedStatus,
+	FailureCompression:       ErrUnexpectedContent,
+	FailureContentDrift:      ErrUnexpectedContent,
+	FailureSecurityHeaders:   ErrUnexpectedContent,
+	FailureSchema:            ErrUnexpectedContent,
+	FailureBlacklisted:       ErrBlacklisted,
+	FailureHeartbeatMissed:   ErrHeartbeatMissed,
+	FailureConfig:            ErrInvalidCheck,
+	FailureRetriesExhausted:  ErrRetriesExhausted,
+}
+
+// fail classifies the next failure of the service with the error causing it and reports it
+func (s *Service) fail(class FailureClass, err error, issue string) {
+	s.classify(class, err)
+	s.Failure(issue)
+}
+
+// classify sets the class and cause of the next failure, for checks that return the issue to
+// their caller
+func (s *Service) classify(class FailureClass, err error) {
+	s.failureClass = class
+	s.failureErr = err
+}
+
+// classifyError returns the class of a network error, connected tells whether the connection
+// to the target was established before err
+func classifyError(err error, connected bool) FailureClass {
+	if errors.Is(err, ErrInvalidCheck) {
+		return FailureConfig
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return FailureDNS
+	}
+	if isTLSError(err) {
+		return FailureTLS
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		if connected {
+			return FailureReadTimeout
+		}
+		return FailureConnectTimeout
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return FailureConnectRefused
+	}
+	if connected {
+		return FailureProtocol
+	}
+	return FailureConnect
+}
+
+// classifyError returns the class of the error of the HTTP request m was recorded for
+func (m *HTTPRequestMetrics) classifyError(err error) FailureClass {
+	return classifyError(err, m != nil && m.GotConn != 0)
+}
+
+// isTLSError reports whether err comes from a TLS handshake or the verification of a certificate
+func isTLSError(err error) bool {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "tls: ") || strings.Contains(msg, "x509: ")
+}
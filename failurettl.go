@@ -0,0 +1,19 @@
+package scout
+
+import "time"
+
+// ageFailureContext clears the TraceData and DownText of the last failure, and its LastResponse
+// when no check replaced it since, once the service has been healthy for FailureTTL, services
+// without a FailureTTL keep them until the next failure. It is called by success, which publishes
+// the state it changes
+func (s *Service) ageFailureContext(now time.Time) {
+	if s.FailureTTL <= 0 || s.healthySince.IsZero() || now.Sub(s.healthySince) < s.FailureTTL.Duration() {
+		return
+	}
+	s.TraceData = nil
+	s.DownText = ""
+	if s.failureResponse != "" && s.LastResponse == s.failureResponse {
+		s.LastResponse = ""
+	}
+	s.failureResponse = ""
+}
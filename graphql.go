@@ -0,0 +1,171 @@
+package scout
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// GraphQLConfig configures the GraphQL check of a service, the query is posted as JSON to the
+// address of the service
+type GraphQLConfig struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+	// Assertions are matched against the data of the response
+	Assertions []GraphQLAssertion `json:"assertions,omitempty"`
+}
+
+// GraphQLAssertion asserts on the values at the JSONPath Path of the data of a response, e.g.
+// $.user.status or $.items[*].state, each value has to match Expected and numeric values have to
+// lie within Min and Max when they are set. A path without values fails the assertion
+type GraphQLAssertion struct {
+	Path     string   `json:"path"`
+	Expected string   `json:"expected,omitempty"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+}
+
+// graphQLResponse is the body of a GraphQL response
+type graphQLResponse struct {
+	Data   interface{} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// graphQLContentTypes are the media types of GraphQL responses
+var graphQLContentTypes = map[string]bool{"application/json": true, "application/graphql-response+json": true}
+
+// CheckGraphQL will post the query of the GraphQL config of the service and fail when the
+// response matches none of the HTTP assertions of the service, is not JSON, has errors or its
+// data does not match the assertions of the config. The asserted values are kept in Details by
+// path
+func (s *Service) CheckGraphQL() {
+	if s.GraphQL == nil || strings.TrimSpace(s.GraphQL.Query) == "" {
+		s.fail(FailureConfig, nil, "GraphQL service has no query")
+		return
+	}
+	content, res, metrics, err := s.request(s.context(), s.ResolveTo)
+	defer metrics.release()
+	s.timings = metrics.Timings()
+	if err != nil {
+		s.fail(metrics.classifyError(err), err, fmt.Sprintf("GraphQL Error %v", err))
+		return
+	}
+	s.setNetworkLatency(metrics.NetworkLatency())
+	s.setRequestLatency(metrics.RequestLatency())
+	s.setResponse(metrics.response(content))
+	s.setStatusCode(res.StatusCode)
+	if s.timedOut() {
+		return
+	}
+	if issue := s.verifyHTTP(content, res, metrics); issue != "" {
+		s.Failure(issue)
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); !graphQLContentTypes[mediaType] {
+		s.fail(FailureProtocol, nil, fmt.Sprintf("GraphQL Response Content-Type %q is not JSON", res.Header.Get("Content-Type")))
+		return
+	}
+	var body graphQLResponse
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil {
+		s.fail(FailureProtocol, err, fmt.Sprintf("GraphQL Response Error %v", err))
+		return
+	}
+	if len(body.Errors) > 0 {
+		messages := make([]string, len(body.Errors))
+		for i, e := range body.Errors {
+			messages[i] = e.Message
+		}
+		s.fail(FailureUnhealthy, nil, fmt.Sprintf("GraphQL Response has %d errors: %s", len(body.Errors), strings.Join(messages, "; ")))
+		return
+	}
+	if body.Data == nil {
+		s.fail(FailureProtocol, nil, "GraphQL Response has no data")
+		return
+	}
+	s.Details = make(map[string]string, len(s.GraphQL.Assertions))
+	for _, a := range s.GraphQL.Assertions {
+		values, err := jsonPath(body.Data, a.Path)
+		if err != nil {
+			s.fail(FailureConfig, err, fmt.Sprintf("GraphQL path %v: %v", a.Path, err))
+			return
+		}
+		if len(values) == 0 {
+			s.fail(FailureBodyMismatch, nil, fmt.Sprintf("GraphQL data has nothing at %v", a.Path))
+			return
+		}
+		formatted := make([]string, len(values))
+		for i, v := range values {
+			formatted[i] = jsonString(v)
+		}
+		s.Details[a.Path] = strings.Join(formatted, ", ")
+		for i, v := range values {
+			if issue := a.assert(v, formatted[i]); issue != "" {
+				s.fail(FailureBodyMismatch, nil, fmt.Sprintf("GraphQL data at %v %v", a.Path, issue))
+				return
+			}
+		}
+	}
+	s.Success()
+}
+
+// assert returns a issue when the value does not match the assertion
+func (a GraphQLAssertion) assert(v interface{}, value string) string {
+	if a.Expected != "" {
+		if match, _ := regexp.MatchString(a.Expected, value); !match {
+			return fmt.Sprintf("value '%v' did not match '%v'", value, a.Expected)
+		}
+	}
+	if a.Min == nil && a.Max == nil {
+		return ""
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return fmt.Sprintf("value '%v' is not numeric", value)
+	}
+	number, err := strconv.ParseFloat(n.String(), 64)
+	if err != nil {
+		return fmt.Sprintf("value '%v' is not numeric", value)
+	}
+	if a.Min != nil && number < *a.Min {
+		return fmt.Sprintf("value %v is below %v", value, *a.Min)
+	}
+	if a.Max != nil && number > *a.Max {
+		return fmt.Sprintf("value %v is above %v", value, *a.Max)
+	}
+	return ""
+}
+
+// graphQLRequest returns the JSON body posting the query of the service
+func (s *Service) graphQLRequest() ([]byte, error) {
+	req := struct {
+		Query         string                 `json:"query"`
+		Variables     map[string]interface{} `json:"variables,omitempty"`
+		OperationName string                 `json:"operationName,omitempty"`
+	}{s.GraphQL.Query, s.GraphQL.Variables, s.GraphQL.OperationName}
+	return json.Marshal(req)
+}
+
+// validate checks that the config has a query and its assertions compile
+func (c *GraphQLConfig) validate() error {
+	if strings.TrimSpace(c.Query) == "" {
+		return fmt.Errorf("%w: graphql without a query", ErrInvalidCheck)
+	}
+	for _, a := range c.Assertions {
+		if _, err := parseJSONPath(a.Path); err != nil {
+			return fmt.Errorf("%w: graphql path %v", ErrInvalidExpected, err)
+		}
+		if _, err := regexp.Compile(a.Expected); err != nil {
+			return fmt.Errorf("%w: graphql expected %q, %v", ErrInvalidExpected, a.Expected, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package scout
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONPath(t *testing.T) {
+	assert := assert.New(t)
+
+	var doc interface{}
+	assert.Nil(json.Unmarshal([]byte(`{"user":{"name":"ada","tags":["a","b","c"]},"items":[{"id":1},{"id":2}],"odd key":true}`), &doc))
+	for path, expected := range map[string][]interface{}{
+		"$.user.name":     {"ada"},
+		"user.name":       {"ada"},
+		"$['user'].name":  {"ada"},
+		"$.user.tags[1]":  {"b"},
+		"$.user.tags[-1]": {"c"},
+		"$.items[*].id":   {float64(1), float64(2)},
+		"$['odd key']":    {true},
+		"$.user.missing":  nil,
+		"$.user.tags[9]":  nil,
+	} {
+		values, err := jsonPath(doc, path)
+		assert.Nil(err, path)
+		assert.Equal(expected, values, path)
+	}
+	for _, path := range []string{"$.", "$.user[", "$.user[x]"} {
+		_, err := jsonPath(doc, path)
+		assert.NotNil(err, path)
+	}
+}
+
+func TestCheckGraphQL(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch req.Variables["case"] {
+		case "errors":
+			w.Header().Set("Content-Type", "application/graphql-response+json")
+			w.Write([]byte(`{"data":null,"errors":[{"message":"database is down"}]}`))
+		case "html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html></html>`))
+		default:
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Write([]byte(`{"data":{"health":{"status":"ok","replicas":3,"nodes":[{"up":true},{"up":true}]}}}`))
+		}
+	}))
+	defer ts.Close()
+
+	min := 2.0
+	serv := &Service{
+		ID:             uuid.New(),
+		Name:           "GraphQL",
+		Address:        ts.URL,
+		Type:           "graphql",
+		ExpectedStatus: http.StatusOK,
+		SkipDNSTiming:  true,
+		Interval:       Duration(time.Minute),
+		Timeout:        Duration(5 * time.Second),
+		Logger:         NewSlogLogger(nil),
+		GraphQL: &GraphQLConfig{
+			Query:     `query($case: String) { health(case: $case) { status replicas nodes { up } } }`,
+			Variables: map[string]interface{}{"case": "ok"},
+			Assertions: []GraphQLAssertion{
+				{Path: "$.health.status", Expected: "^ok$"},
+				{Path: "$.health.replicas", Min: &min},
+				{Path: "$.health.nodes[*].up", Expected: "true"},
+			},
+		},
+	}
+	assert.Nil(serv.Validate())
+	suc, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("ok", suc.Details["$.health.status"])
+	assert.Equal("3", suc.Details["$.health.replicas"])
+	assert.Equal("true, true", suc.Details["$.health.nodes[*].up"])
+
+	min = 4
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureBodyMismatch, fail.Class)
+	assert.Equal("GraphQL data at $.health.replicas value 3 is below 4", fail.Issue)
+
+	serv.GraphQL.Variables["case"] = "errors"
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureUnhealthy, fail.Class)
+	assert.Equal("GraphQL Response has 1 errors: database is down", fail.Issue)
+
+	serv.GraphQL.Variables["case"] = "html"
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureProtocol, fail.Class)
+
+	serv.GraphQL.Assertions = []GraphQLAssertion{{Path: "$.health[x]"}}
+	assert.True(errors.Is(serv.Validate(), ErrInvalidExpected))
+	serv.GraphQL = nil
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureConfig, fail.Class)
+}
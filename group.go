@@ -0,0 +1,218 @@
+package scout
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// GroupAll is up when all members are up, it is the default policy
+	GroupAll = "all"
+	// GroupAny is up when all members are up, degraded while at least one of them is online and
+	// down when none is
+	GroupAny = "any"
+	// GroupPercentage is down when less than Percentage of the members are online
+	GroupPercentage = "percentage"
+
+	// GroupUp is the status of a group whose members are healthy
+	GroupUp = "up"
+	// GroupDegraded is the status of a group that is online with members down or degraded
+	GroupDegraded = "degraded"
+	// GroupDown is the status of a group that is down by its policy
+	GroupDown = "down"
+	// GroupPending is the status of a group whose members have not been checked yet
+	GroupPending = "pending"
+)
+
+// Group is a set of services whose aggregate status is computed by its policy, e.g. a checkout
+// group spanning the API, database and CDN services
+type Group struct {
+	ID         uuid.UUID   `json:"id"`
+	Name       string      `json:"name"`
+	Members    []uuid.UUID `json:"members"`
+	Policy     string      `json:"policy"`
+	Percentage float64     `json:"percentage"`
+	SLO        *SLO        `json:"slo,omitempty"`
+}
+
+// GroupStatus is sent on the Response Channel when the aggregate status of a group changes
+type GroupStatus struct {
+	Group     uuid.UUID `json:"group"`
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Online    int       `json:"online"`
+	Degraded  int       `json:"degraded"`
+	Offline   int       `json:"offline"`
+	Pending   int       `json:"pending"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ServiceID returns the ID of the group
+func (r GroupStatus) ServiceID() uuid.UUID { return r.Group }
+
+// Time returns when the status was computed
+func (r GroupStatus) Time() time.Time { return r.CreatedAt }
+
+// groupState is a group with its last computed status
+type groupState struct {
+	group  Group
+	status string
+	slo    *sloTracker
+}
+
+// AddGroup adds a group to the scout, a group without a ID is assigned a random one, members do
+// not have to be added to the scout before the group
+func (s *Scout) AddGroup(g *Group) error {
+	if g == nil {
+		return ErrNilGroup
+	}
+	switch g.Policy {
+	case "", GroupAll, GroupAny:
+	case GroupPercentage:
+		if g.Percentage <= 0 || g.Percentage > 100 {
+			return fmt.Errorf("%w: percentage %v of %s is not within (0, 100]", ErrInvalidGroupPolicy, g.Percentage, g.Name)
+		}
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidGroupPolicy, g.Policy)
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if g.ID == uuid.Nil {
+		g.ID = uuid.New()
+	}
+	if _, ok := s.groups[g.ID]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateGroupID, g.ID)
+	}
+	if s.groups == nil {
+		s.groups = make(map[uuid.UUID]*groupState)
+	}
+	state := &groupState{group: *g}
+	state.group.Members = append([]uuid.UUID(nil), g.Members...)
+	state.status = s.groupStatus(state.group).Status
+	if g.SLO.valid() {
+		state.slo = newSLOTracker(*g.SLO)
+	}
+	s.groups[g.ID] = state
+	return nil
+}
+
+// DelGroup removes a group from the scout, its members are not removed
+func (s *Scout) DelGroup(id uuid.UUID) {
+	s.mux.Lock()
+	delete(s.groups, id)
+	s.mux.Unlock()
+}
+
+// GetGroup returns a copy of the group with the ID or nil when the scout has no such group
+func (s *Scout) GetGroup(id uuid.UUID) *Group {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	state, ok := s.groups[id]
+	if !ok {
+		return nil
+	}
+	g := state.group
+	g.Members = append([]uuid.UUID(nil), g.Members...)
+	return &g
+}
+
+// GroupStatus returns the current aggregate status of the group with the ID
+func (s *Scout) GroupStatus(id uuid.UUID) (GroupStatus, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	state, ok := s.groups[id]
+	if !ok {
+		return GroupStatus{}, fmt.Errorf("%w: %s", ErrUnknownGroup, id)
+	}
+	return s.groupStatus(state.group), nil
+}
+
+// groupStatus computes the status of g from its members, it must be called with the scout lock
+// held, members that are not part of the scout are not counted
+func (s *Scout) groupStatus(g Group) GroupStatus {
+	st := GroupStatus{Group: g.ID, Name: g.Name, CreatedAt: time.Now().UTC()}
+	for _, id := range g.Members {
+		serv, ok := s.Services[id]
+		if !ok {
+			continue
+		}
+		switch serv.Snapshot().State {
+		case StateDown:
+			st.Offline++
+		case StatePending:
+			st.Pending++
+		case StateDegraded:
+			st.Degraded++
+		default:
+			st.Online++
+		}
+	}
+	online := st.Online + st.Degraded
+	checked := online + st.Offline
+	switch {
+	case checked == 0:
+		st.Status = GroupPending
+	case g.Policy == GroupAny && online == 0:
+		st.Status = GroupDown
+	case g.Policy == GroupPercentage && float64(online)*100 < g.Percentage*float64(checked):
+		st.Status = GroupDown
+	case (g.Policy == "" || g.Policy == GroupAll) && st.Offline > 0:
+		st.Status = GroupDown
+	case st.Offline > 0 || st.Degraded > 0:
+		st.Status = GroupDegraded
+	default:
+		st.Status = GroupUp
+	}
+	return st
+}
+
+// updateGroups recomputes the groups serv is a member of and returns the statuses that changed
+// and the burn alerts of the group SLOs
+func (s *Scout) updateGroups(serv *Service) []Result {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var changed []Result
+	for _, state := range s.groups {
+		member := false
+		for _, id := range state.group.Members {
+			if id == serv.ID {
+				member = true
+				break
+			}
+		}
+		if !member {
+			continue
+		}
+		st := s.groupStatus(state.group)
+		if st.Status != state.status {
+			state.status = st.Status
+			changed = append(changed, st)
+		}
+		if st.Status == GroupPending {
+			continue
+		}
+		if state.slo != nil {
+			changed = append(changed, state.slo.add(state.group.ID, st.CreatedAt, st.Status != GroupDown)...)
+		}
+		// the timeline of a group has a point for every result of its members, for its reports
+		if s.timeline != nil {
+			s.timeline.add(state.group.ID, TimelinePoint{Time: st.CreatedAt, Up: st.Status != GroupDown})
+		}
+	}
+	return changed
+}
+
+// emitGroups sends the status of the groups of the service that changed with its last result
+func (s *Service) emitGroups() {
+	if s.scout == nil {
+		return
+	}
+	for _, r := range s.scout.updateGroups(s) {
+		if r = s.scout.intercept(r); r != nil {
+			s.dispatch(r)
+			s.scout.notify(r)
+		}
+	}
+}
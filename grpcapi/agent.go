@@ -0,0 +1,129 @@
+package grpcapi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/phenixrizen/scout"
+)
+
+// Agent checks the services a coordinator assigns to it with its scout and reports their results
+// to the coordinator, e.g. from a network the coordinator can not reach. The scout is the agent's
+// own, every result of its services is reported, and it needs to be scouting its services for
+// them to be checked
+type Agent struct {
+	Name string
+	// Token is the bearer token the agent authenticates with, the coordinator only accepts the
+	// agent whose principal has its Name
+	Token  string
+	Scout  *scout.Scout
+	Client CoordinatorClient
+	// revisions are the revisions of the assigned services the scout has
+	revisions map[uuid.UUID]int64
+}
+
+// NewAgent returns a agent checking the services assigned to name with the scout
+func NewAgent(name string, s *scout.Scout, client CoordinatorClient) *Agent {
+	return &Agent{Name: name, Scout: s, Client: client, revisions: make(map[uuid.UUID]int64)}
+}
+
+// Run connects to the coordinator and checks the services it assigns until ctx is done or the
+// connection fails, the services stay with the scout when the connection fails so Run can be
+// called again to reconnect
+func (a *Agent) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if a.Token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+a.Token)
+	}
+	stream, err := a.Client.Connect(ctx)
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(&AgentMessage{Agent: a.Name}); err != nil {
+		return err
+	}
+
+	subscriber := "agent-" + a.Name
+	results := a.Scout.Subscribe(subscriber, defaultBuffer)
+	defer a.Scout.Unsubscribe(subscriber)
+	sendErr := make(chan error, 1)
+	go func() {
+		for r := range results {
+			switch r.Result.(type) {
+			case scout.ServiceSuccess, scout.ServiceFailure:
+			default:
+				continue
+			}
+			pb, err := fromResult(r)
+			if err == nil {
+				err = stream.Send(&AgentMessage{Result: pb})
+			}
+			if err != nil {
+				sendErr <- err
+				cancel()
+				return
+			}
+		}
+	}()
+
+	for {
+		assignment, err := stream.Recv()
+		if err != nil {
+			select {
+			case err := <-sendErr:
+				return err
+			default:
+			}
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err := a.assign(assignment); err != nil {
+			a.Scout.Logger.Warnf("Agent %s: %v", a.Name, err)
+		}
+	}
+}
+
+// assign makes the services of the scout the assigned ones, the services with a new revision are
+// replaced and the ones no longer assigned are removed
+func (a *Agent) assign(assignment *Assignment) error {
+	if a.revisions == nil {
+		a.revisions = make(map[uuid.UUID]int64)
+	}
+	assigned := make(map[uuid.UUID]bool, len(assignment.GetServices()))
+	var failed error
+	for _, pb := range assignment.GetServices() {
+		serv, err := toService(pb)
+		if err != nil {
+			return err
+		}
+		assigned[serv.ID] = true
+		if a.revisions[serv.ID] == pb.GetRevision() && a.Scout.GetService(serv.ID) != nil {
+			continue
+		}
+		if a.Scout.GetService(serv.ID) != nil {
+			err = a.Scout.UpdateService(serv)
+		} else {
+			err = a.Scout.AddService(serv)
+		}
+		if err != nil {
+			if failed == nil {
+				failed = fmt.Errorf("could not check service %s: %w", serv.Name, err)
+			}
+			continue
+		}
+		a.revisions[serv.ID] = pb.GetRevision()
+	}
+	for id := range a.revisions {
+		if !assigned[id] {
+			a.Scout.DelService(id)
+			delete(a.revisions, id)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,255 @@
+package grpcapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/phenixrizen/scout"
+)
+
+// defaultResync is how often the assignments of connected agents are checked for changes when
+// the coordinator does not set Resync
+const defaultResync = 10 * time.Second
+
+// Coordinator implements CoordinatorServer for a scout, the services of the scout with Agents are
+// checked by those agents and the results they report are recorded by the scout
+type Coordinator struct {
+	UnimplementedCoordinatorServer
+	// Resync is how often the services assigned to the connected agents are checked for changes
+	Resync time.Duration
+	// Authenticator authenticates the bearer token of the authorization metadata of a agent
+	// connecting, a agent is the operator principal with its name and only checks the services
+	// of the namespace of the principal. Agents are refused without it
+	Authenticator scout.Authenticator
+	scout         *scout.Scout
+	mux           sync.Mutex
+	agents        map[string]*agentConn
+	revisions     map[uuid.UUID]revision
+}
+
+// revision is the revision of the definition of a service, every change of a service replaces it
+// in the scout so a new revision starts whenever the service is a different one
+type revision struct {
+	serv *scout.Service
+	n    int64
+}
+
+// agentConn is a connected agent
+type agentConn struct {
+	since    time.Time
+	lastSeen time.Time
+	done     chan struct{}
+}
+
+// AgentStatus is a connected agent and when it last reported a result
+type AgentStatus struct {
+	Name      string    `json:"name"`
+	Connected time.Time `json:"connected"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// NewCoordinator returns a coordinator of the scout, register it with RegisterCoordinatorServer
+func NewCoordinator(s *scout.Scout) *Coordinator {
+	return &Coordinator{scout: s, agents: make(map[string]*agentConn), revisions: make(map[uuid.UUID]revision)}
+}
+
+// Agents returns the connected agents
+func (c *Coordinator) Agents() []AgentStatus {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	agents := make([]AgentStatus, 0, len(c.agents))
+	for name, conn := range c.agents {
+		agents = append(agents, AgentStatus{Name: name, Connected: conn.since, LastSeen: conn.lastSeen})
+	}
+	return agents
+}
+
+// Connect sends the services assigned to the agent and records the results it reports until the
+// stream ends, a agent connecting again replaces its previous stream. The agent is the principal
+// of the call, the name of its first message has to be the one of the principal
+func (c *Coordinator) Connect(stream Coordinator_ConnectServer) error {
+	if c.Authenticator == nil {
+		return status.Error(codes.Unauthenticated, "the coordinator has no authenticator for agents")
+	}
+	p, err := authenticate(stream.Context(), c.Authenticator)
+	if err != nil {
+		return err
+	}
+	if err := p.Require(scout.RoleOperator); err != nil {
+		return toStatus(err)
+	}
+	hello, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	name := hello.GetAgent()
+	if name == "" {
+		return status.Error(codes.InvalidArgument, "the first message of a agent needs its name")
+	}
+	if name != p.Name {
+		return status.Errorf(codes.PermissionDenied, "%s can not connect as agent %s", p.Name, name)
+	}
+	conn := c.register(name)
+	defer c.unregister(name, conn)
+	c.scout.Logger.Infof("Agent %s connected", name)
+
+	// the results are read while the assignments are sent
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			if msg.GetResult() == nil {
+				continue
+			}
+			c.seen(name, conn)
+			r, err := toResult(msg.GetResult())
+			if err == nil {
+				if serv := c.scout.GetService(r.ServiceID()); serv != nil && !p.Allowed(serv) {
+					err = fmt.Errorf("%w: %s %s", scout.ErrNotAssigned, name, serv.ID)
+				} else {
+					err = c.scout.Report(name, r)
+				}
+			}
+			if err != nil {
+				c.scout.Logger.Warnf("Agent %s: %v", name, err)
+			}
+		}
+	}()
+
+	resync := c.Resync
+	if resync <= 0 {
+		resync = defaultResync
+	}
+	ticker := time.NewTicker(resync)
+	defer ticker.Stop()
+	var sent []revision
+	for {
+		if assigned := c.assigned(p); sent == nil || !sameRevisions(assigned, sent) {
+			assignment, err := c.assignment(assigned)
+			if err != nil {
+				return err
+			}
+			if err := stream.Send(assignment); err != nil {
+				return err
+			}
+			sent = assigned
+		}
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-conn.done:
+			return status.Errorf(codes.Aborted, "agent %s connected again", name)
+		case err := <-recvErr:
+			c.scout.Logger.Infof("Agent %s disconnected: %v", name, err)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// assigned returns the revisions of the services the agent checks in its namespace
+func (c *Coordinator) assigned(agent scout.Principal) []revision {
+	servs := c.scout.Assigned(agent.Name)
+	assigned := make([]revision, 0, len(servs))
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for _, serv := range servs {
+		if !agent.Allowed(serv) {
+			continue
+		}
+		rev, ok := c.revisions[serv.ID]
+		if !ok || rev.serv != serv {
+			// a timestamp keeps revisions apart across restarts of the coordinator
+			rev = revision{serv: serv, n: time.Now().UnixNano()}
+			c.revisions[serv.ID] = rev
+		}
+		assigned = append(assigned, rev)
+	}
+	return assigned
+}
+
+// sameRevisions reports whether a and b are the same revisions of the same services
+func sameRevisions(a, b []revision) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// assignment returns the specs of the services of the revisions without their agents so the agent
+// checks them itself, their credentials reach the agent as secret references only
+func (c *Coordinator) assignment(assigned []revision) (*Assignment, error) {
+	assignment := &Assignment{Services: make([]*Service, 0, len(assigned))}
+	for _, rev := range assigned {
+		local := rev.serv.Spec()
+		local.Agents = nil
+		pb, err := fromService(local)
+		if err != nil {
+			return nil, err
+		}
+		pb.Revision = rev.n
+		assignment.Services = append(assignment.Services, pb)
+	}
+	return assignment, nil
+}
+
+func (c *Coordinator) register(name string) *agentConn {
+	now := time.Now().UTC()
+	conn := &agentConn{since: now, lastSeen: now, done: make(chan struct{})}
+	c.mux.Lock()
+	if old := c.agents[name]; old != nil {
+		close(old.done)
+	}
+	c.agents[name] = conn
+	c.mux.Unlock()
+	return conn
+}
+
+func (c *Coordinator) unregister(name string, conn *agentConn) {
+	c.mux.Lock()
+	if c.agents[name] == conn {
+		delete(c.agents, name)
+	}
+	c.mux.Unlock()
+}
+
+func (c *Coordinator) seen(name string, conn *agentConn) {
+	c.mux.Lock()
+	conn.lastSeen = time.Now().UTC()
+	c.mux.Unlock()
+}
+
+// toResult returns the success or failure of a result sent by a agent
+func toResult(pb *CheckResult) (scout.Result, error) {
+	switch pb.GetKind() {
+	case "ServiceSuccess":
+		var r scout.ServiceSuccess
+		if err := json.Unmarshal(pb.GetResult(), &r); err != nil {
+			return nil, err
+		}
+		return r, nil
+	case "ServiceFailure":
+		var r scout.ServiceFailure
+		if err := json.Unmarshal(pb.GetResult(), &r); err != nil {
+			return nil, err
+		}
+		return r, nil
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown result kind %q", pb.GetKind())
+	}
+}
@@ -0,0 +1,148 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/phenixrizen/scout"
+)
+
+func TestCoordinator(t *testing.T) {
+	assert := assert.New(t)
+
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	defer target.Close()
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	closed.Close()
+
+	id := uuid.New()
+	central, err := scout.NewScoutWithOptions(scout.WithServices(&scout.Service{
+		ID:       id,
+		Name:     "Remote",
+		Type:     "tcp",
+		Address:  "127.0.0.1",
+		Port:     target.Addr().(*net.TCPAddr).Port,
+		SkipPing: true,
+		Interval: scout.Duration(50 * time.Millisecond),
+		Agents:   []string{"dc-1"},
+		Password: "hunter2",
+	}))
+	assert.Nil(err)
+	results := central.Subscribe("test", 64)
+	go func() {
+		for range central.GetResponseChannel() {
+		}
+	}()
+	// the coordinator does not check the services of its agents itself
+	central.StartScoutingServices()
+	defer central.StopScoutingServices()
+	assert.Equal(int64(0), central.Health().ServiceLoops)
+
+	coordinator := NewCoordinator(central)
+	coordinator.Resync = 20 * time.Millisecond
+	coordinator.Authenticator = scout.Tokens{
+		"dc-1-token": {Name: "dc-1", Role: scout.RoleOperator},
+		"dc-2-token": {Name: "dc-2", Role: scout.RoleOperator},
+		"view-token": {Name: "dc-1"},
+	}
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	RegisterCoordinatorServer(gs, coordinator)
+	go gs.Serve(lis)
+	defer gs.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	assert.Nil(err)
+	defer conn.Close()
+
+	local, err := scout.NewScoutWithOptions()
+	assert.Nil(err)
+	go func() {
+		for range local.GetResponseChannel() {
+		}
+	}()
+	local.StartScoutingServices()
+	defer local.StopScoutingServices()
+	// agents are the principal of their token
+	for token, code := range map[string]codes.Code{"": codes.Unauthenticated, "dc-2-token": codes.PermissionDenied, "view-token": codes.PermissionDenied} {
+		agent := NewAgent("dc-1", local, NewCoordinatorClient(conn))
+		agent.Token = token
+		assert.Equal(code, status.Code(agent.Run(ctx)), token)
+	}
+	assert.Nil(local.GetService(id))
+
+	agentCtx, stopAgent := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	agent := NewAgent("dc-1", local, NewCoordinatorClient(conn))
+	agent.Token = "dc-1-token"
+	go func() { done <- agent.Run(agentCtx) }()
+
+	// the agent checks the service and the coordinator records its results
+	r := <-results
+	if assert.IsType(scout.ServiceSuccess{}, r.Result) {
+		assert.Equal(id, r.ServiceID())
+		assert.Equal("dc-1", r.Result.(scout.ServiceSuccess).Details["agent"])
+	}
+	assert.True(central.GetService(id).Snapshot().Online)
+	if serv := local.GetService(id); assert.NotNil(serv) {
+		// credentials that are no secret references stay with the coordinator
+		assert.NotEqual("hunter2", serv.Password)
+	}
+	if agents := coordinator.Agents(); assert.Len(agents, 1) {
+		assert.Equal("dc-1", agents[0].Name)
+	}
+
+	// a changed service is replaced on the agent
+	assert.Nil(central.UpdateService(&scout.Service{
+		ID:       id,
+		Name:     "Remote",
+		Type:     "tcp",
+		Address:  "127.0.0.1",
+		Port:     closed.Addr().(*net.TCPAddr).Port,
+		SkipPing: true,
+		Interval: scout.Duration(50 * time.Millisecond),
+		Agents:   []string{"dc-1"},
+	}))
+	assert.Eventually(func() bool {
+		r := <-results
+		_, ok := r.Result.(scout.ServiceFailure)
+		return ok
+	}, 2*time.Second, time.Millisecond)
+	assert.False(central.GetService(id).Snapshot().Online)
+
+	// a result of a service the agent does not check is refused
+	assert.True(errors.Is(central.Report("dc-2", scout.ServiceSuccess{Service: id}), scout.ErrNotAssigned))
+
+	// a removed service is removed from the agent
+	central.DelService(id)
+	assert.Eventually(func() bool { return local.GetService(id) == nil }, 2*time.Second, 10*time.Millisecond)
+
+	stopAgent()
+	assert.Nil(<-done)
+	assert.Eventually(func() bool { return len(coordinator.Agents()) == 0 }, time.Second, 10*time.Millisecond)
+}
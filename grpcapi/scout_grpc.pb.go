@@ -0,0 +1,548 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package grpcapi
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// ScoutClient is the client API for Scout service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ScoutClient interface {
+	ListServices(ctx context.Context, in *ListServicesRequest, opts ...grpc.CallOption) (*ListServicesResponse, error)
+	GetService(ctx context.Context, in *ServiceRequest, opts ...grpc.CallOption) (*Service, error)
+	CreateService(ctx context.Context, in *Service, opts ...grpc.CallOption) (*Service, error)
+	UpdateService(ctx context.Context, in *Service, opts ...grpc.CallOption) (*Service, error)
+	DeleteService(ctx context.Context, in *ServiceRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// CheckNow checks the service right away and returns the result.
+	CheckNow(ctx context.Context, in *ServiceRequest, opts ...grpc.CallOption) (*CheckResult, error)
+	// SilenceService stops the notifications of the service for the duration while it is checked.
+	SilenceService(ctx context.Context, in *SilenceRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// GetStats returns the uptime, incidents, MTTR and MTBF of a service or group over a window.
+	GetStats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*Stats, error)
+	// StreamResults streams the results of every check until the call is canceled.
+	StreamResults(ctx context.Context, in *StreamResultsRequest, opts ...grpc.CallOption) (Scout_StreamResultsClient, error)
+}
+
+type scoutClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewScoutClient(cc grpc.ClientConnInterface) ScoutClient {
+	return &scoutClient{cc}
+}
+
+func (c *scoutClient) ListServices(ctx context.Context, in *ListServicesRequest, opts ...grpc.CallOption) (*ListServicesResponse, error) {
+	out := new(ListServicesResponse)
+	err := c.cc.Invoke(ctx, "/scout.v1.Scout/ListServices", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scoutClient) GetService(ctx context.Context, in *ServiceRequest, opts ...grpc.CallOption) (*Service, error) {
+	out := new(Service)
+	err := c.cc.Invoke(ctx, "/scout.v1.Scout/GetService", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scoutClient) CreateService(ctx context.Context, in *Service, opts ...grpc.CallOption) (*Service, error) {
+	out := new(Service)
+	err := c.cc.Invoke(ctx, "/scout.v1.Scout/CreateService", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scoutClient) UpdateService(ctx context.Context, in *Service, opts ...grpc.CallOption) (*Service, error) {
+	out := new(Service)
+	err := c.cc.Invoke(ctx, "/scout.v1.Scout/UpdateService", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scoutClient) DeleteService(ctx context.Context, in *ServiceRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/scout.v1.Scout/DeleteService", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scoutClient) CheckNow(ctx context.Context, in *ServiceRequest, opts ...grpc.CallOption) (*CheckResult, error) {
+	out := new(CheckResult)
+	err := c.cc.Invoke(ctx, "/scout.v1.Scout/CheckNow", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scoutClient) SilenceService(ctx context.Context, in *SilenceRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/scout.v1.Scout/SilenceService", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scoutClient) GetStats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*Stats, error) {
+	out := new(Stats)
+	err := c.cc.Invoke(ctx, "/scout.v1.Scout/GetStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scoutClient) StreamResults(ctx context.Context, in *StreamResultsRequest, opts ...grpc.CallOption) (Scout_StreamResultsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Scout_ServiceDesc.Streams[0], "/scout.v1.Scout/StreamResults", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &scoutStreamResultsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Scout_StreamResultsClient interface {
+	Recv() (*CheckResult, error)
+	grpc.ClientStream
+}
+
+type scoutStreamResultsClient struct {
+	grpc.ClientStream
+}
+
+func (x *scoutStreamResultsClient) Recv() (*CheckResult, error) {
+	m := new(CheckResult)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ScoutServer is the server API for Scout service.
+// All implementations must embed UnimplementedScoutServer
+// for forward compatibility
+type ScoutServer interface {
+	ListServices(context.Context, *ListServicesRequest) (*ListServicesResponse, error)
+	GetService(context.Context, *ServiceRequest) (*Service, error)
+	CreateService(context.Context, *Service) (*Service, error)
+	UpdateService(context.Context, *Service) (*Service, error)
+	DeleteService(context.Context, *ServiceRequest) (*emptypb.Empty, error)
+	// CheckNow checks the service right away and returns the result.
+	CheckNow(context.Context, *ServiceRequest) (*CheckResult, error)
+	// SilenceService stops the notifications of the service for the duration while it is checked.
+	SilenceService(context.Context, *SilenceRequest) (*emptypb.Empty, error)
+	// GetStats returns the uptime, incidents, MTTR and MTBF of a service or group over a window.
+	GetStats(context.Context, *StatsRequest) (*Stats, error)
+	// StreamResults streams the results of every check until the call is canceled.
+	StreamResults(*StreamResultsRequest, Scout_StreamResultsServer) error
+	mustEmbedUnimplementedScoutServer()
+}
+
+// UnimplementedScoutServer must be embedded to have forward compatible implementations.
+type UnimplementedScoutServer struct {
+}
+
+func (UnimplementedScoutServer) ListServices(context.Context, *ListServicesRequest) (*ListServicesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListServices not implemented")
+}
+func (UnimplementedScoutServer) GetService(context.Context, *ServiceRequest) (*Service, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetService not implemented")
+}
+func (UnimplementedScoutServer) CreateService(context.Context, *Service) (*Service, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateService not implemented")
+}
+func (UnimplementedScoutServer) UpdateService(context.Context, *Service) (*Service, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateService not implemented")
+}
+func (UnimplementedScoutServer) DeleteService(context.Context, *ServiceRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteService not implemented")
+}
+func (UnimplementedScoutServer) CheckNow(context.Context, *ServiceRequest) (*CheckResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckNow not implemented")
+}
+func (UnimplementedScoutServer) SilenceService(context.Context, *SilenceRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SilenceService not implemented")
+}
+func (UnimplementedScoutServer) GetStats(context.Context, *StatsRequest) (*Stats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
+}
+func (UnimplementedScoutServer) StreamResults(*StreamResultsRequest, Scout_StreamResultsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamResults not implemented")
+}
+func (UnimplementedScoutServer) mustEmbedUnimplementedScoutServer() {}
+
+// UnsafeScoutServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ScoutServer will
+// result in compilation errors.
+type UnsafeScoutServer interface {
+	mustEmbedUnimplementedScoutServer()
+}
+
+func RegisterScoutServer(s grpc.ServiceRegistrar, srv ScoutServer) {
+	s.RegisterService(&Scout_ServiceDesc, srv)
+}
+
+func _Scout_ListServices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListServicesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScoutServer).ListServices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/scout.v1.Scout/ListServices",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScoutServer).ListServices(ctx, req.(*ListServicesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Scout_GetService_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ServiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScoutServer).GetService(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/scout.v1.Scout/GetService",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScoutServer).GetService(ctx, req.(*ServiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Scout_CreateService_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Service)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScoutServer).CreateService(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/scout.v1.Scout/CreateService",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScoutServer).CreateService(ctx, req.(*Service))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Scout_UpdateService_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Service)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScoutServer).UpdateService(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/scout.v1.Scout/UpdateService",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScoutServer).UpdateService(ctx, req.(*Service))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Scout_DeleteService_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ServiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScoutServer).DeleteService(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/scout.v1.Scout/DeleteService",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScoutServer).DeleteService(ctx, req.(*ServiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Scout_CheckNow_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ServiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScoutServer).CheckNow(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/scout.v1.Scout/CheckNow",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScoutServer).CheckNow(ctx, req.(*ServiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Scout_SilenceService_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SilenceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScoutServer).SilenceService(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/scout.v1.Scout/SilenceService",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScoutServer).SilenceService(ctx, req.(*SilenceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Scout_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScoutServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/scout.v1.Scout/GetStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScoutServer).GetStats(ctx, req.(*StatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Scout_StreamResults_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamResultsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ScoutServer).StreamResults(m, &scoutStreamResultsServer{stream})
+}
+
+type Scout_StreamResultsServer interface {
+	Send(*CheckResult) error
+	grpc.ServerStream
+}
+
+type scoutStreamResultsServer struct {
+	grpc.ServerStream
+}
+
+func (x *scoutStreamResultsServer) Send(m *CheckResult) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Scout_ServiceDesc is the grpc.ServiceDesc for Scout service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Scout_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "scout.v1.Scout",
+	HandlerType: (*ScoutServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListServices",
+			Handler:    _Scout_ListServices_Handler,
+		},
+		{
+			MethodName: "GetService",
+			Handler:    _Scout_GetService_Handler,
+		},
+		{
+			MethodName: "CreateService",
+			Handler:    _Scout_CreateService_Handler,
+		},
+		{
+			MethodName: "UpdateService",
+			Handler:    _Scout_UpdateService_Handler,
+		},
+		{
+			MethodName: "DeleteService",
+			Handler:    _Scout_DeleteService_Handler,
+		},
+		{
+			MethodName: "CheckNow",
+			Handler:    _Scout_CheckNow_Handler,
+		},
+		{
+			MethodName: "SilenceService",
+			Handler:    _Scout_SilenceService_Handler,
+		},
+		{
+			MethodName: "GetStats",
+			Handler:    _Scout_GetStats_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamResults",
+			Handler:       _Scout_StreamResults_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "scout.proto",
+}
+
+// CoordinatorClient is the client API for Coordinator service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CoordinatorClient interface {
+	// Connect registers the agent named by its first message. The coordinator sends the services
+	// assigned to the agent whenever they change and the agent sends the result of every check.
+	Connect(ctx context.Context, opts ...grpc.CallOption) (Coordinator_ConnectClient, error)
+}
+
+type coordinatorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCoordinatorClient(cc grpc.ClientConnInterface) CoordinatorClient {
+	return &coordinatorClient{cc}
+}
+
+func (c *coordinatorClient) Connect(ctx context.Context, opts ...grpc.CallOption) (Coordinator_ConnectClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Coordinator_ServiceDesc.Streams[0], "/scout.v1.Coordinator/Connect", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &coordinatorConnectClient{stream}
+	return x, nil
+}
+
+type Coordinator_ConnectClient interface {
+	Send(*AgentMessage) error
+	Recv() (*Assignment, error)
+	grpc.ClientStream
+}
+
+type coordinatorConnectClient struct {
+	grpc.ClientStream
+}
+
+func (x *coordinatorConnectClient) Send(m *AgentMessage) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *coordinatorConnectClient) Recv() (*Assignment, error) {
+	m := new(Assignment)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// CoordinatorServer is the server API for Coordinator service.
+// All implementations must embed UnimplementedCoordinatorServer
+// for forward compatibility
+type CoordinatorServer interface {
+	// Connect registers the agent named by its first message. The coordinator sends the services
+	// assigned to the agent whenever they change and the agent sends the result of every check.
+	Connect(Coordinator_ConnectServer) error
+	mustEmbedUnimplementedCoordinatorServer()
+}
+
+// UnimplementedCoordinatorServer must be embedded to have forward compatible implementations.
+type UnimplementedCoordinatorServer struct {
+}
+
+func (UnimplementedCoordinatorServer) Connect(Coordinator_ConnectServer) error {
+	return status.Errorf(codes.Unimplemented, "method Connect not implemented")
+}
+func (UnimplementedCoordinatorServer) mustEmbedUnimplementedCoordinatorServer() {}
+
+// UnsafeCoordinatorServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CoordinatorServer will
+// result in compilation errors.
+type UnsafeCoordinatorServer interface {
+	mustEmbedUnimplementedCoordinatorServer()
+}
+
+func RegisterCoordinatorServer(s grpc.ServiceRegistrar, srv CoordinatorServer) {
+	s.RegisterService(&Coordinator_ServiceDesc, srv)
+}
+
+func _Coordinator_Connect_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CoordinatorServer).Connect(&coordinatorConnectServer{stream})
+}
+
+type Coordinator_ConnectServer interface {
+	Send(*Assignment) error
+	Recv() (*AgentMessage, error)
+	grpc.ServerStream
+}
+
+type coordinatorConnectServer struct {
+	grpc.ServerStream
+}
+
+func (x *coordinatorConnectServer) Send(m *Assignment) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *coordinatorConnectServer) Recv() (*AgentMessage, error) {
+	m := new(AgentMessage)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Coordinator_ServiceDesc is the grpc.ServiceDesc for Coordinator service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Coordinator_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "scout.v1.Coordinator",
+	HandlerType: (*CoordinatorServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Connect",
+			Handler:       _Coordinator_Connect_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "scout.proto",
+}
@@ -0,0 +1,433 @@
+// Package grpcapi serves the management API of a scout over gRPC, the service is defined in
+// scout.proto, run go generate to regenerate the code after changing it
+package grpcapi
+
+//go:generate buf generate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/phenixrizen/scout"
+)
+
+const (
+	// defaultBuffer is the buffer of a result stream when the request does not set one
+	defaultBuffer = 64
+	// defaultSilence is how long a service is silenced when the request does not set it
+	defaultSilence = time.Hour
+)
+
+// Server implements ScoutServer for a scout
+type Server struct {
+	UnimplementedScoutServer
+	// Authenticator authenticates the bearer token of the authorization metadata of every call
+	// when set, a principal with a namespace only sees and manages the services of its namespace.
+	// Viewers list, get, stream and read the stats of services, operators also check now and
+	// silence and admins also create, update and delete them
+	Authenticator scout.Authenticator
+	scout         *scout.Scout
+}
+
+// NewServer returns a server managing the scout, register it with RegisterScoutServer
+func NewServer(s *scout.Scout) *Server {
+	return &Server{scout: s}
+}
+
+// ListServices returns the status of the services having the tags of the request, sorted by name
+func (srv *Server) ListServices(ctx context.Context, req *ListServicesRequest) (*ListServicesResponse, error) {
+	p, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+	servs := srv.scout.GetServicesByTags(req.GetTags())
+	res := &ListServicesResponse{Services: make([]*ServiceStatus, 0, len(servs))}
+	for _, serv := range servs {
+		if !p.Allowed(serv) {
+			continue
+		}
+		st := serv.Snapshot()
+		res.Services = append(res.Services, fromStatus(&st))
+	}
+	return res, nil
+}
+
+// GetService returns the definition of a service, its credentials are redacted unless they are
+// secret references
+func (srv *Server) GetService(ctx context.Context, req *ServiceRequest) (*Service, error) {
+	serv, err := srv.service(ctx, req.GetId(), scout.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	return fromService(serv)
+}
+
+// CreateService adds a service to the scout, it gets a new ID unless the request has one
+func (srv *Server) CreateService(ctx context.Context, req *Service) (*Service, error) {
+	p, err := srv.authorize(ctx, scout.RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	serv, err := toService(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Scope(serv); err != nil {
+		return nil, toStatus(err)
+	}
+	if serv.ID == uuid.Nil {
+		serv.ID = uuid.New()
+	}
+	if srv.scout.GetService(serv.ID) != nil {
+		return nil, status.Errorf(codes.AlreadyExists, "service %s already exists", serv.ID)
+	}
+	if err := srv.scout.AddService(serv); err != nil {
+		return nil, toStatus(err)
+	}
+	return fromService(serv)
+}
+
+// UpdateService replaces the service with the ID of the request, the credentials GetService
+// redacts have to be set again
+func (srv *Server) UpdateService(ctx context.Context, req *Service) (*Service, error) {
+	p, err := srv.authorize(ctx, scout.RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	serv, err := toService(req)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := srv.service(ctx, serv.ID.String(), scout.RoleAdmin); err != nil {
+		return nil, err
+	}
+	if err := p.Scope(serv); err != nil {
+		return nil, toStatus(err)
+	}
+	if err := srv.scout.UpdateService(serv); err != nil {
+		return nil, toStatus(err)
+	}
+	return fromService(serv)
+}
+
+// DeleteService removes a service from the scout
+func (srv *Server) DeleteService(ctx context.Context, req *ServiceRequest) (*emptypb.Empty, error) {
+	serv, err := srv.service(ctx, req.GetId(), scout.RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	srv.scout.DelService(serv.ID)
+	return &emptypb.Empty{}, nil
+}
+
+// CheckNow checks a service right away and returns its result
+func (srv *Server) CheckNow(ctx context.Context, req *ServiceRequest) (*CheckResult, error) {
+	serv, err := srv.service(ctx, req.GetId(), scout.RoleOperator)
+	if err != nil {
+		return nil, err
+	}
+	res, err := srv.scout.CheckNow(serv.ID)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return fromResult(res)
+}
+
+// SilenceService silences the notifications of a service for the duration of the request
+func (srv *Server) SilenceService(ctx context.Context, req *SilenceRequest) (*emptypb.Empty, error) {
+	serv, err := srv.service(ctx, req.GetId(), scout.RoleOperator)
+	if err != nil {
+		return nil, err
+	}
+	d := defaultSilence
+	if req.GetDuration() != nil {
+		if d = req.GetDuration().AsDuration(); d <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid silence duration %s", d)
+		}
+	}
+	reason := req.GetReason()
+	if reason == "" {
+		reason = "silenced over the API"
+	}
+	if err := srv.scout.Silence(serv.ID, d, reason); err != nil {
+		return nil, toStatus(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// GetStats returns the reliability stats of a service or group from the timeline of the scout,
+// groups have no namespace so a principal with a namespace only gets the stats of its services
+func (srv *Server) GetStats(ctx context.Context, req *StatsRequest) (*Stats, error) {
+	p, err := srv.authorize(ctx, scout.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	id, err := parseID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	if serv := srv.scout.GetService(id); (serv == nil && p.Namespace != "") || (serv != nil && !p.Allowed(serv)) {
+		return nil, toStatus(fmt.Errorf("%w: %s", scout.ErrUnknownService, id))
+	}
+	to := time.Now()
+	if req.GetTo() != nil {
+		to = req.GetTo().AsTime()
+	}
+	from := to.Add(-24 * time.Hour)
+	if req.GetFrom() != nil {
+		from = req.GetFrom().AsTime()
+	}
+	st, err := srv.scout.Reliability(id, from, to)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &Stats{
+		Id:            st.ID.String(),
+		Name:          st.Name,
+		From:          timestamppb.New(from),
+		To:            timestamppb.New(to),
+		Checks:        st.Checks,
+		Failures:      st.Failures,
+		Uptime:        st.Uptime,
+		Incidents:     int32(st.Incidents),
+		Downtime:      durationpb.New(st.Downtime.Duration()),
+		Mttr:          durationpb.New(st.MTTR.Duration()),
+		Mtbf:          durationpb.New(st.MTBF.Duration()),
+		LongestOutage: durationpb.New(st.LongestOutage.Duration()),
+	}, nil
+}
+
+// StreamResults sends the results of the scout to the stream until it is canceled
+func (srv *Server) StreamResults(req *StreamResultsRequest, stream Scout_StreamResultsServer) error {
+	p, err := srv.principal(stream.Context())
+	if err != nil {
+		return err
+	}
+	// the name is never the one of the request, a stream with the name of another would end it
+	name := "grpc-" + uuid.New().String()
+	buffer := int(req.GetBuffer())
+	if buffer <= 0 {
+		buffer = defaultBuffer
+	}
+	results := srv.scout.Subscribe(name, buffer)
+	defer srv.scout.Unsubscribe(name)
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case r, ok := <-results:
+			if !ok {
+				return nil
+			}
+			if p.Namespace != "" {
+				// groups and removed services have no namespace to check
+				if serv := srv.scout.GetService(r.ServiceID()); serv == nil || !p.Allowed(serv) {
+					continue
+				}
+			}
+			res, err := fromResult(r)
+			if err != nil {
+				return err
+			}
+			if err := stream.Send(res); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// principal returns the principal of the call, an admin of every namespace without a
+// authenticator
+func (srv *Server) principal(ctx context.Context) (scout.Principal, error) {
+	if srv.Authenticator == nil {
+		return scout.Principal{Role: scout.RoleAdmin}, nil
+	}
+	return authenticate(ctx, srv.Authenticator)
+}
+
+// authenticate returns the principal of the bearer token of the authorization metadata of the
+// call
+func authenticate(ctx context.Context, a scout.Authenticator) (scout.Principal, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	if auth := md.Get("authorization"); len(auth) > 0 {
+		token = strings.TrimPrefix(auth[0], "Bearer ")
+	}
+	p, err := a.Authenticate(ctx, token)
+	if err != nil {
+		return scout.Principal{}, toStatus(err)
+	}
+	return p, nil
+}
+
+// authorize returns the principal of the call when it has the role
+func (srv *Server) authorize(ctx context.Context, role scout.Role) (scout.Principal, error) {
+	p, err := srv.principal(ctx)
+	if err != nil {
+		return scout.Principal{}, err
+	}
+	if err := p.Require(role); err != nil {
+		return scout.Principal{}, toStatus(err)
+	}
+	return p, nil
+}
+
+// service returns the service with the ID when the principal has the role, a service of another
+// namespace than the one of the principal is not found
+func (srv *Server) service(ctx context.Context, id string, role scout.Role) (*scout.Service, error) {
+	p, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+	u, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	serv := srv.scout.GetService(u)
+	if serv == nil || !p.Allowed(serv) {
+		return nil, toStatus(fmt.Errorf("%w: %s", scout.ErrUnknownService, u))
+	}
+	if err := p.Require(role); err != nil {
+		return nil, toStatus(err)
+	}
+	return serv, nil
+}
+
+func parseID(id string) (uuid.UUID, error) {
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, status.Errorf(codes.InvalidArgument, "invalid service id %q", id)
+	}
+	return u, nil
+}
+
+// toStatus maps the errors of the scout to gRPC status codes
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, scout.ErrUnknownService):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, scout.ErrNoTimeline):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, scout.ErrNoCheckResult):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, scout.ErrUnauthenticated):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, scout.ErrForbidden):
+		return status.Error(codes.PermissionDenied, err.Error())
+	default:
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+}
+
+// toService returns the scout service of the definition, spec first and the set fields over it
+func toService(pb *Service) (*scout.Service, error) {
+	serv := &scout.Service{}
+	if len(pb.GetSpec()) > 0 {
+		if err := json.Unmarshal(pb.GetSpec(), serv); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid service spec: %v", err)
+		}
+	}
+	if pb.GetId() != "" {
+		id, err := parseID(pb.GetId())
+		if err != nil {
+			return nil, err
+		}
+		serv.ID = id
+	}
+	set := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	set(&serv.ExternalID, pb.GetExternalId())
+	set(&serv.Name, pb.GetName())
+	set(&serv.Type, pb.GetType())
+	set(&serv.Address, pb.GetAddress())
+	set(&serv.Expected, pb.GetExpected())
+	set(&serv.Method, pb.GetMethod())
+	if pb.Interval != nil {
+		serv.Interval = scout.Duration(pb.Interval.AsDuration())
+	}
+	if pb.Timeout != nil {
+		serv.Timeout = scout.Duration(pb.Timeout.AsDuration())
+	}
+	if pb.GetExpectedStatus() != 0 {
+		serv.ExpectedStatus = int(pb.GetExpectedStatus())
+	}
+	if len(pb.GetTags()) > 0 {
+		serv.Tags = pb.GetTags()
+	}
+	return serv, nil
+}
+
+// fromService returns the definition of the service, it is built from the spec of the service so
+// it does not race its checks and holds no credentials
+func fromService(live *scout.Service) (*Service, error) {
+	serv := live.Spec()
+	spec, err := json.Marshal(serv)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &Service{
+		Id:             serv.ID.String(),
+		ExternalId:     serv.ExternalID,
+		Name:           serv.Name,
+		Type:           serv.Type,
+		Address:        serv.Address,
+		Interval:       durationpb.New(serv.Interval.Duration()),
+		Timeout:        durationpb.New(serv.Timeout.Duration()),
+		ExpectedStatus: int32(serv.ExpectedStatus),
+		Expected:       serv.Expected,
+		Method:         serv.Method,
+		Tags:           serv.Tags,
+		Spec:           spec,
+	}, nil
+}
+
+func fromStatus(st *scout.ServiceStatus) *ServiceStatus {
+	if st == nil {
+		return nil
+	}
+	return &ServiceStatus{
+		Id:             st.ID.String(),
+		Name:           st.Name,
+		Type:           st.Type,
+		State:          st.State,
+		Online:         st.Online,
+		Paused:         st.Paused,
+		RequestLatency: st.RequestLatency,
+		NetworkLatency: st.NetworkLatency,
+		LastStatusCode: int32(st.LastStatusCode),
+		LastOnline:     timestamppb.New(st.LastOnline),
+		LastFailure:    timestamppb.New(st.LastFailure),
+		DownText:       st.DownText,
+		Consecutive:    int32(st.Consecutive),
+	}
+}
+
+func fromResult(r scout.CheckResult) (*CheckResult, error) {
+	data, err := json.Marshal(r.Result)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &CheckResult{
+		Service:   r.ServiceID().String(),
+		Kind:      reflect.TypeOf(r.Result).Name(),
+		CreatedAt: timestamppb.New(r.Time()),
+		Status:    fromStatus(r.Status),
+		Result:    data,
+	}, nil
+}
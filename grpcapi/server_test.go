@@ -0,0 +1,168 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/phenixrizen/scout"
+)
+
+func TestServer(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := scout.NewScoutWithOptions(scout.WithResultBuffer(8))
+	assert.Nil(err)
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	RegisterScoutServer(gs, NewServer(s))
+	go gs.Serve(lis)
+	defer gs.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	assert.Nil(err)
+	defer conn.Close()
+	client := NewScoutClient(conn)
+
+	created, err := client.CreateService(ctx, &Service{
+		Name:     "Cron",
+		Type:     "heartbeat",
+		Interval: durationpb.New(time.Hour),
+		Tags:     map[string]string{"team": "ops"},
+		Spec:     []byte(`{"externalId": "cron-1", "password": "hunter2"}`),
+	})
+	assert.Nil(err)
+	assert.Equal("cron-1", created.ExternalId)
+	id := created.Id
+	assert.NotNil(s.GetService(uuid.MustParse(id)))
+
+	list, err := client.ListServices(ctx, &ListServicesRequest{Tags: map[string]string{"team": "ops"}})
+	assert.Nil(err)
+	assert.Len(list.Services, 1)
+	assert.Equal(scout.StatePending, list.Services[0].State)
+
+	created.Name = "Nightly"
+	updated, err := client.UpdateService(ctx, created)
+	assert.Nil(err)
+	assert.Equal("Nightly", updated.Name)
+	got, err := client.GetService(ctx, &ServiceRequest{Id: id})
+	assert.Nil(err)
+	assert.Equal("Nightly", got.Name)
+	assert.Equal(time.Hour, got.Interval.AsDuration())
+	assert.NotContains(string(got.Spec), "hunter2")
+
+	// a stream receives the result of a check triggered over the API
+	stream, err := client.StreamResults(ctx, &StreamResultsRequest{Subscriber: "test"})
+	assert.Nil(err)
+	// the subscriber of the request does not end the stream of another
+	other, err := client.StreamResults(ctx, &StreamResultsRequest{Subscriber: "test"})
+	assert.Nil(err)
+	assert.Eventually(func() bool {
+		assert.Nil(s.Beat(uuid.MustParse(id)))
+		res, err := client.CheckNow(ctx, &ServiceRequest{Id: id})
+		return err == nil && res.Kind == "ServiceSuccess"
+	}, time.Second, 10*time.Millisecond)
+	res, err := stream.Recv()
+	assert.Nil(err)
+	assert.Equal(id, res.Service)
+	assert.Equal("ServiceSuccess", res.Kind)
+	assert.True(res.Status.Online)
+	res, err = other.Recv()
+	assert.Nil(err)
+	assert.Equal(id, res.Service)
+
+	// the stats are read from the timeline
+	_, err = client.GetStats(ctx, &StatsRequest{Id: id})
+	assert.Equal(codes.FailedPrecondition, status.Code(err))
+
+	_, err = client.DeleteService(ctx, &ServiceRequest{Id: id})
+	assert.Nil(err)
+	_, err = client.GetService(ctx, &ServiceRequest{Id: id})
+	assert.Equal(codes.NotFound, status.Code(err))
+	_, err = client.CheckNow(ctx, &ServiceRequest{Id: "nope"})
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestServerNamespaces(t *testing.T) {
+	assert := assert.New(t)
+
+	search := &scout.Service{ID: uuid.New(), Name: "Search", Type: "heartbeat", Interval: scout.Duration(time.Hour), Namespace: "search"}
+	s, err := scout.NewScoutWithOptions(scout.WithServices(search), scout.WithResultBuffer(8))
+	assert.Nil(err)
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	srv := NewServer(s)
+	srv.Authenticator = scout.Tokens{
+		"pay-token":    {Name: "payments-team", Namespace: "payments", Role: scout.RoleAdmin},
+		"oncall-token": {Name: "payments-oncall", Namespace: "payments", Role: scout.RoleOperator},
+		"view-token":   {Name: "payments-dev", Namespace: "payments"},
+	}
+	RegisterScoutServer(gs, srv)
+	go gs.Serve(lis)
+	defer gs.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	assert.Nil(err)
+	defer conn.Close()
+	client := NewScoutClient(conn)
+
+	_, err = client.ListServices(ctx, &ListServicesRequest{})
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+
+	// a token scoped to a namespace creates services in it and only sees those
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer pay-token")
+	created, err := client.CreateService(ctx, &Service{Name: "Ledger", Type: "heartbeat", Interval: durationpb.New(time.Hour)})
+	assert.Nil(err)
+	serv := s.GetService(uuid.MustParse(created.Id))
+	if assert.NotNil(serv) {
+		assert.Equal("payments", serv.Namespace)
+	}
+	list, err := client.ListServices(ctx, &ListServicesRequest{})
+	assert.Nil(err)
+	if assert.Len(list.Services, 1) {
+		assert.Equal("Ledger", list.Services[0].Name)
+	}
+	_, err = client.GetService(ctx, &ServiceRequest{Id: search.ID.String()})
+	assert.Equal(codes.NotFound, status.Code(err))
+	_, err = client.DeleteService(ctx, &ServiceRequest{Id: search.ID.String()})
+	assert.Equal(codes.NotFound, status.Code(err))
+	_, err = client.CreateService(ctx, &Service{Name: "Index", Type: "heartbeat", Interval: durationpb.New(time.Hour), Spec: []byte(`{"namespace": "search"}`)})
+	assert.Equal(codes.PermissionDenied, status.Code(err))
+
+	// operators check and silence services but only admins delete them
+	ledger := &ServiceRequest{Id: created.Id}
+	oncall := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer oncall-token")
+	_, err = client.SilenceService(oncall, &SilenceRequest{Id: created.Id, Duration: durationpb.New(time.Minute), Reason: "deploy"})
+	assert.Nil(err)
+	assert.True(serv.IsSilenced())
+	_, err = client.DeleteService(oncall, ledger)
+	assert.Equal(codes.PermissionDenied, status.Code(err))
+	view := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer view-token")
+	_, err = client.GetService(view, ledger)
+	assert.Nil(err)
+	_, err = client.CheckNow(view, ledger)
+	assert.Equal(codes.PermissionDenied, status.Code(err))
+	_, err = client.SilenceService(view, &SilenceRequest{Id: created.Id})
+	assert.Equal(codes.PermissionDenied, status.Code(err))
+	_, err = client.DeleteService(ctx, ledger)
+	assert.Nil(err)
+	assert.Nil(s.GetService(serv.ID))
+}
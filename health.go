@@ -0,0 +1,104 @@
+package scout
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// Health is the internal state of a scout, to monitor scout itself
+type Health struct {
+	ServiceLoops         int64     `json:"serviceLoops"`
+	MaxSchedulerLag      Duration  `json:"maxSchedulerLag"`
+	MeanSchedulerLag     Duration  `json:"meanSchedulerLag"`
+	Checks               uint64    `json:"checks"`
+	DroppedResults       uint64    `json:"droppedResults"`
+	NotifierFailures     uint64    `json:"notifierFailures"`
+	DroppedNotifications uint64    `json:"droppedNotifications"`
+	HistoryEntries       int       `json:"historyEntries"`
+	HistoryBytes         int64     `json:"historyBytes"`
+	CreatedAt            time.Time `json:"createdAt"`
+}
+
+// Health returns the number of running service loops, how late the loops woke up for their
+// last check, the results and notifications that were lost, and the entries and approximate
+// memory of the timelines and debug captures kept for the services
+func (s *Scout) Health() Health {
+	h := Health{
+		ServiceLoops:         atomic.LoadInt64(&s.loops),
+		Checks:               atomic.LoadUint64(&s.checks),
+		DroppedResults:       s.DroppedResults(),
+		NotifierFailures:     atomic.LoadUint64(&s.notifyFailures),
+		DroppedNotifications: atomic.LoadUint64(&s.notifyDropped),
+		CreatedAt:            time.Now().UTC(),
+	}
+	var lags, total time.Duration
+	for _, serv := range s.GetServices() {
+		if lag := time.Duration(atomic.LoadInt64(&serv.lag)); lag > 0 {
+			lags++
+			total += lag
+			if Duration(lag) > h.MaxSchedulerLag {
+				h.MaxSchedulerLag = Duration(lag)
+			}
+		}
+		entries, bytes := serv.history()
+		h.HistoryEntries += entries
+		h.HistoryBytes += bytes
+	}
+	if lags > 0 {
+		h.MeanSchedulerLag = Duration(total / lags)
+	}
+	if s.timeline != nil {
+		s.timeline.mux.Lock()
+		for _, st := range s.timeline.services {
+			h.HistoryEntries += len(st.points) + len(st.rollups)
+			h.HistoryBytes += int64(cap(st.points))*int64(unsafe.Sizeof(TimelinePoint{})) + int64(cap(st.rollups))*int64(unsafe.Sizeof(TimelineRollup{}))
+		}
+		s.timeline.mux.Unlock()
+	}
+	return h
+}
+
+// MetricsHandler returns a handler exporting the Health of the scout in the Prometheus text
+// format, e.g. mounted at /metrics
+func (s *Scout) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := s.Health()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		for _, m := range []struct {
+			name, kind, help string
+			value            interface{}
+		}{
+			{"scout_service_loops", "gauge", "Running service check loops.", h.ServiceLoops},
+			{"scout_scheduler_lag_max_seconds", "gauge", "Longest delay of a service loop waking up for its last check.", h.MaxSchedulerLag.Duration().Seconds()},
+			{"scout_scheduler_lag_mean_seconds", "gauge", "Mean delay of the service loops waking up for their last check.", h.MeanSchedulerLag.Duration().Seconds()},
+			{"scout_checks_total", "counter", "Checks completed.", h.Checks},
+			{"scout_dropped_results_total", "counter", "Results dropped by the overflow policy.", h.DroppedResults},
+			{"scout_notifier_failures_total", "counter", "Notifications a notifier failed to send.", h.NotifierFailures},
+			{"scout_dropped_notifications_total", "counter", "Notifications dropped because a notifier queue was full.", h.DroppedNotifications},
+			{"scout_history_entries", "gauge", "Entries kept in the service histories.", h.HistoryEntries},
+			{"scout_history_bytes", "gauge", "Approximate memory of the service histories.", h.HistoryBytes},
+		} {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", m.name, m.help, m.name, m.kind, m.name, m.value)
+		}
+	})
+}
+
+// recordLag records how late the service loop woke up for a check compared to when it was due
+func (s *Service) recordLag(now time.Time) {
+	due := atomic.LoadInt64(&s.heartbeat) + atomic.LoadInt64(&s.heartbeatWait)
+	lag := now.UnixNano() - due
+	if lag < 0 {
+		lag = 0
+	}
+	atomic.StoreInt64(&s.lag, lag)
+}
+
+// history returns the entries and approximate memory of the debug captures of the service
+func (s *Service) history() (int, int64) {
+	s.debugMux.Lock()
+	defer s.debugMux.Unlock()
+	return len(s.debugCaptures), int64(len(s.debugCaptures)) * int64(unsafe.Sizeof(DebugCapture{}))
+}
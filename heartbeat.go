@@ -0,0 +1,83 @@
+package scout
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Beat records a heartbeat of the heartbeat service with the ID, the service fails when no
+// heartbeat arrives within its interval
+func (s *Scout) Beat(id uuid.UUID) error {
+	serv := s.GetService(id)
+	if serv == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownService, id)
+	}
+	if serv.Type != "heartbeat" {
+		return fmt.Errorf("%w: %s is a %s service", ErrNotHeartbeat, id, serv.Type)
+	}
+	atomic.StoreInt64(&serv.pushed, time.Now().UnixNano())
+	return nil
+}
+
+// HeartbeatHandler returns a handler that records a heartbeat for every POST to a path ending
+// in the ID or external ID of a heartbeat service, e.g. mounted at /heartbeat/ a cron job can
+// POST to /heartbeat/<id> when it completes
+func (s *Scout) HeartbeatHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		key := path.Base(r.URL.Path)
+		id, err := uuid.Parse(key)
+		if err != nil {
+			serv := s.GetServiceByExternalID(key)
+			if serv == nil {
+				http.NotFound(w, r)
+				return
+			}
+			id = serv.ID
+		}
+		switch err := s.Beat(id); {
+		case err == nil:
+			w.WriteHeader(http.StatusNoContent)
+		case errors.Is(err, ErrUnknownService):
+			http.NotFound(w, r)
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	})
+}
+
+// CheckHeartbeat will fail when the last heartbeat of the service is older than its interval,
+// the Timeout of the service is the grace period a heartbeat may be late, until the first
+// heartbeat or interval has passed no result is sent
+func (s *Service) CheckHeartbeat() {
+	now := time.Now()
+	if s.pushWait.IsZero() {
+		s.pushWait = now
+	}
+	late := s.Interval.Duration() + s.Timeout.Duration()
+	last := atomic.LoadInt64(&s.pushed)
+	if last == 0 {
+		if now.Sub(s.pushWait) < late {
+			return
+		}
+		s.fail(FailureHeartbeatMissed, nil, fmt.Sprintf("No heartbeat received in %v", now.Sub(s.pushWait).Round(time.Second)))
+		return
+	}
+	beat := time.Unix(0, last)
+	s.Details = map[string]string{"lastBeat": beat.UTC().Format(time.RFC3339)}
+	if age := now.Sub(beat); age > late {
+		s.fail(FailureHeartbeatMissed, nil, fmt.Sprintf("Last heartbeat received %v ago", age.Round(time.Second)))
+		return
+	}
+	s.Success()
+}
@@ -0,0 +1,56 @@
+package scout
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeartbeat(t *testing.T) {
+	assert := assert.New(t)
+
+	beat := &Service{ID: uuid.New(), ExternalID: "nightly-backup", Name: "Backup", Type: "heartbeat", Interval: Duration(50 * time.Millisecond), Timeout: Duration(10 * time.Millisecond)}
+	ping := &Service{ID: uuid.New(), Name: "Ping", Address: "example.com", Type: "icmp"}
+	s, err := NewScout([]*Service{beat, ping}, NewSlogLogger(nil))
+	assert.Nil(err)
+	beat.Responses = make(chan interface{}, 1)
+
+	// nothing is sent until the first interval passed without a heartbeat
+	beat.Check()
+	assert.Len(beat.Responses, 0)
+	time.Sleep(70 * time.Millisecond)
+	fail, ok := checkOnce(beat).(ServiceFailure)
+	assert.True(ok)
+	assert.Contains(fail.Issue, "No heartbeat received")
+
+	ts := httptest.NewServer(s.HeartbeatHandler())
+	defer ts.Close()
+	res, err := http.Post(ts.URL+"/heartbeat/nightly-backup", "text/plain", nil)
+	assert.Nil(err)
+	assert.Equal(http.StatusNoContent, res.StatusCode)
+	_, ok = checkOnce(beat).(ServiceSuccess)
+	assert.True(ok)
+
+	time.Sleep(70 * time.Millisecond)
+	fail, ok = checkOnce(beat).(ServiceFailure)
+	assert.True(ok)
+	assert.Contains(fail.Issue, "Last heartbeat received")
+
+	assert.Nil(s.Beat(beat.ID))
+	_, ok = checkOnce(beat).(ServiceSuccess)
+	assert.True(ok)
+
+	assert.True(errors.Is(s.Beat(ping.ID), ErrNotHeartbeat))
+	assert.True(errors.Is(s.Beat(uuid.New()), ErrUnknownService))
+	res, err = http.Post(ts.URL+"/heartbeat/"+uuid.New().String(), "text/plain", nil)
+	assert.Nil(err)
+	assert.Equal(http.StatusNotFound, res.StatusCode)
+	res, err = http.Get(ts.URL + "/heartbeat/nightly-backup")
+	assert.Nil(err)
+	assert.Equal(http.StatusMethodNotAllowed, res.StatusCode)
+}
@@ -0,0 +1,124 @@
+package scout
+
+import "time"
+
+const (
+	// StateUp is the state of a service whose last check succeeded
+	StateUp = "up"
+	// StateDegraded is the state of a service whose last check succeeded degraded
+	StateDegraded = "degraded"
+	// StateDown is the state of a service whose last check failed
+	StateDown = "down"
+	// StatePending is the state of a service that has not been checked yet
+	StatePending = "pending"
+)
+
+// Hooks are called around the checks of a service, the hooks of the scout are called before
+// the hooks of the service and nil hooks are skipped
+type Hooks struct {
+	// OnCheckStart is called before the check runs, it may change the service for the check,
+	// e.g. to set dynamic headers
+	OnCheckStart func(s *Service)
+	// OnCheckComplete is called after the check with its success or failure and how long the
+	// check took, r is nil when the check reported neither
+	OnCheckComplete func(s *Service, r Result, d time.Duration)
+	// OnStateChange is called after a check that changed the state of the service, StateUp,
+	// StateDegraded, StateDown or StatePending
+	OnStateChange func(s *Service, from, to string)
+}
+
+// CheckFunc runs the check of a service
+type CheckFunc func(s *Service)
+
+// Middleware wraps the check of a service, it can run code around next or replace it
+type Middleware func(next CheckFunc) CheckFunc
+
+// WithHooks adds hooks called around the checks of every service of the scout
+func WithHooks(h Hooks) Option {
+	return func(s *Scout) error {
+		s.AddHooks(h)
+		return nil
+	}
+}
+
+// WithMiddleware adds middleware wrapping the checks of every service of the scout
+func WithMiddleware(mw ...Middleware) Option {
+	return func(s *Scout) error {
+		s.AddMiddleware(mw...)
+		return nil
+	}
+}
+
+// AddHooks adds hooks called, in the order they were added, around the checks of every service
+// of the scout
+func (s *Scout) AddHooks(h Hooks) {
+	s.mux.Lock()
+	s.hooks = append(s.hooks, h)
+	s.mux.Unlock()
+}
+
+// AddMiddleware adds middleware wrapping the checks of every service of the scout, the first
+// middleware added is the outermost and the middleware of the scout wraps the service's own
+func (s *Scout) AddMiddleware(mw ...Middleware) {
+	s.mux.Lock()
+	s.middleware = append(s.middleware, mw...)
+	s.mux.Unlock()
+}
+
+// State returns the state of the service by its last check
+func (s *Service) State() string {
+	switch {
+	case s.down():
+		return StateDown
+	case !s.Online:
+		return StatePending
+	case s.DegradedText != "":
+		return StateDegraded
+	}
+	return StateUp
+}
+
+// checkHooks returns the hooks and middleware of the scout followed by the service's own
+func (s *Service) checkHooks() ([]Hooks, []Middleware) {
+	var hooks []Hooks
+	var mw []Middleware
+	if s.scout != nil {
+		s.scout.mux.RLock()
+		hooks = append(hooks, s.scout.hooks...)
+		mw = append(mw, s.scout.middleware...)
+		s.scout.mux.RUnlock()
+	}
+	return append(hooks, s.Hooks), append(mw, s.Middleware...)
+}
+
+// hookedCheck runs the check of the service wrapped in its middleware and calls its hooks
+func (s *Service) hookedCheck() {
+	hooks, mw := s.checkHooks()
+	check := CheckFunc((*Service).runCheck)
+	for i := len(mw) - 1; i >= 0; i-- {
+		check = mw[i](check)
+	}
+
+	from := s.State()
+	s.checkResult = nil
+	start := time.Now()
+	for _, h := range hooks {
+		if h.OnCheckStart != nil {
+			h.OnCheckStart(s)
+		}
+	}
+	check(s)
+	took := time.Since(start)
+	for _, h := range hooks {
+		if h.OnCheckComplete != nil {
+			h.OnCheckComplete(s, s.checkResult, took)
+		}
+	}
+	if to := s.State(); to != from {
+		for _, h := range hooks {
+			if h.OnStateChange != nil {
+				h.OnStateChange(s, from, to)
+			}
+		}
+	}
+}
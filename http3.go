@@ -0,0 +1,94 @@
+package scout
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// HTTP3Transport returns the round tripper a HTTP/3 request to addr, the ip:port or host:port the
+// request is sent to, is made with, e.g. the quic-go round trippers of the quictransport module. The
+// QUIC connection has to be made with tlsConf, which records the handshake in the metrics of the
+// request, and the round tripper is closed with the body of the response when it is a io.Closer
+type HTTP3Transport func(addr string, tlsConf *tls.Config) http.RoundTripper
+
+// WithHTTP3 makes the HTTP checks of services with HTTP3 over QUIC with the round trippers of the
+// transport, scout does not speak QUIC itself so that only the users of HTTP/3 depend on quic-go
+// through the quictransport module
+func WithHTTP3(t HTTP3Transport) Option {
+	return func(s *Scout) error {
+		if t == nil {
+			return fmt.Errorf("scout: http3 transport is nil")
+		}
+		s.http3 = t
+		return nil
+	}
+}
+
+// http3 returns the HTTP/3 transport of the scout of the service, nil without one
+func (s *Service) http3() HTTP3Transport {
+	if s.scout == nil {
+		return nil
+	}
+	return s.scout.http3
+}
+
+// roundTripHTTP3 sends the request over HTTP/3. QUIC connects and handshakes in one, so the
+// connect and TLS handshake of the metrics both run from the start of the request to the end of
+// the handshake and the request is written when the handshake is done
+func roundTripHTTP3(req *http.Request, cfg *requestConfig, tlsConf *tls.Config, metrics *HTTPRequestMetrics) (*http.Response, error) {
+	addr := cfg.resolveTo
+	if addr == "" {
+		port := req.URL.Port()
+		if port == "" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(req.URL.Hostname(), port)
+	}
+	tlsConf = tlsConf.Clone()
+	// the handshake is timed on top of the verification the config already does
+	verify := tlsConf.VerifyConnection
+	tlsConf.VerifyConnection = func(state tls.ConnectionState) error {
+		now := time.Now().UnixNano()
+		metrics.ConnectDone, metrics.TLSHandshakeDone, metrics.GotConn, metrics.WroteRequest = now, now, now, now
+		metrics.TLSVersion = tlsVersionName(state.Version)
+		metrics.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+		if verify != nil {
+			return verify(state)
+		}
+		return nil
+	}
+	rt := cfg.http3(addr, tlsConf)
+	start := time.Now().UnixNano()
+	metrics.GetConn, metrics.ConnectStart, metrics.TLSHandshakeStart = start, start, start
+	metrics.RemoteAddr = addr
+	client := &http.Client{Transport: rt, Timeout: cfg.timeout}
+	resp, err := client.Do(req)
+	if err == nil {
+		metrics.GotFirstResponseByte = time.Now().UnixNano()
+	}
+	if c, ok := rt.(io.Closer); ok {
+		if err != nil {
+			c.Close()
+		} else {
+			resp.Body = &http3Body{resp.Body, c}
+		}
+	}
+	return resp, err
+}
+
+// http3Body closes the round tripper of a HTTP/3 response with its body, the body is read over
+// the QUIC connection of the round tripper
+type http3Body struct {
+	io.ReadCloser
+	rt io.Closer
+}
+
+func (b *http3Body) Close() error {
+	err := b.ReadCloser.Close()
+	b.rt.Close()
+	return err
+}
@@ -0,0 +1,50 @@
+package scout
+
+import (
+	"fmt"
+	"net"
+)
+
+const (
+	// IPVersionAuto uses whichever address family the name resolves to, it is the default IPVersion
+	IPVersionAuto = "auto"
+	// IPVersion4 only checks IPv4 addresses
+	IPVersion4 = "ipv4"
+	// IPVersion6 only checks IPv6 addresses
+	IPVersion6 = "ipv6"
+)
+
+// network returns base ("tcp", "udp") restricted to the address family of IPVersion, an
+// empty base defaults to "tcp" and stays empty when no family is forced
+func (s *Service) network(base string) string {
+	suffix := ""
+	switch s.IPVersion {
+	case IPVersion4:
+		suffix = "4"
+	case IPVersion6:
+		suffix = "6"
+	default:
+		return base
+	}
+	if base == "" {
+		base = "tcp"
+	}
+	return base + suffix
+}
+
+// filterIPs drops the addresses host resolved to that are not of the IPVersion family
+func (s *Service) filterIPs(host string, ips []net.IP) ([]net.IP, error) {
+	if s.IPVersion != IPVersion4 && s.IPVersion != IPVersion6 {
+		return ips, nil
+	}
+	var filtered []net.IP
+	for _, ip := range ips {
+		if (ip.To4() != nil) == (s.IPVersion == IPVersion4) {
+			filtered = append(filtered, ip)
+		}
+	}
+	if len(filtered) == 0 {
+		return nil, fmt.Errorf("no %s address for %s", s.IPVersion, host)
+	}
+	return filtered, nil
+}
@@ -0,0 +1,433 @@
+package scout
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSchemaViolations is the most violations of a response listed in the issue of its check
+const maxSchemaViolations = 5
+
+// maxSchemaDepth bounds the nesting of $refs, e.g. of a schema that references itself
+const maxSchemaDepth = 64
+
+// jsonSchema validates JSON documents against a JSON Schema. The type, enum, const, object,
+// array, string, number and combining keywords of draft 7 and 2020-12 are supported and $ref
+// resolves pointers into the schema, e.g. #/definitions/user, other keywords are ignored
+type jsonSchema struct {
+	root interface{}
+}
+
+// parseJSONSchema parses a JSON Schema, a object or a boolean
+func parseJSONSchema(raw []byte) (*jsonSchema, error) {
+	root, err := decodeJSON(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch root.(type) {
+	case map[string]interface{}, bool:
+	default:
+		return nil, fmt.Errorf("schema is not a object or boolean")
+	}
+	return &jsonSchema{root: root}, nil
+}
+
+// decodeJSON decodes a JSON document keeping its numbers as json.Number
+func decodeJSON(raw []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// validate returns the violations of the document, each prefixed with the JSONPath of the
+// offending value
+func (s *jsonSchema) validate(doc interface{}) []string {
+	var violations []string
+	s.check(s.root, doc, "$", 0, &violations)
+	return violations
+}
+
+func (s *jsonSchema) check(schema, v interface{}, path string, depth int, violations *[]string) {
+	violate := func(format string, args ...interface{}) {
+		*violations = append(*violations, path+": "+fmt.Sprintf(format, args...))
+	}
+	switch schema := schema.(type) {
+	case bool:
+		if !schema {
+			violate("is not allowed")
+		}
+		return
+	case map[string]interface{}:
+		if ref, ok := schema["$ref"].(string); ok {
+			if depth >= maxSchemaDepth {
+				violate("$ref %s nests too deep", ref)
+				return
+			}
+			target, err := s.resolve(ref)
+			if err != nil {
+				violate("%v", err)
+				return
+			}
+			s.check(target, v, path, depth+1, violations)
+		}
+		s.checkKeywords(schema, v, path, depth, violations, violate)
+	}
+}
+
+func (s *jsonSchema) checkKeywords(schema map[string]interface{}, v interface{}, path string, depth int, violations *[]string, violate func(string, ...interface{})) {
+	if t, ok := schema["type"]; ok && !hasSchemaType(t, v) {
+		violate("got %s, want %s", schemaType(v), jsonString(t))
+		return
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			violate("%s is not one of %s", jsonLiteral(v), jsonLiteral(enum))
+		}
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(c, v) {
+		violate("%s is not %s", jsonLiteral(v), jsonLiteral(c))
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		s.checkObject(schema, v, path, depth, violations, violate)
+	case []interface{}:
+		s.checkArray(schema, v, path, depth, violations, violate)
+	case string:
+		n := utf8.RuneCountInString(v)
+		if min, ok := schemaNumber(schema["minLength"]); ok && float64(n) < min {
+			violate("length %d is below %v", n, min)
+		}
+		if max, ok := schemaNumber(schema["maxLength"]); ok && float64(n) > max {
+			violate("length %d is above %v", n, max)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if match, err := regexp.MatchString(pattern, v); err == nil && !match {
+				violate("%q does not match %q", v, pattern)
+			}
+		}
+	case json.Number:
+		n, _ := v.Float64()
+		if min, ok := schemaNumber(schema["minimum"]); ok && n < min {
+			violate("%v is below %v", v, min)
+		}
+		if max, ok := schemaNumber(schema["maximum"]); ok && n > max {
+			violate("%v is above %v", v, max)
+		}
+		if min, ok := schemaNumber(schema["exclusiveMinimum"]); ok && n <= min {
+			violate("%v is not above %v", v, min)
+		}
+		if max, ok := schemaNumber(schema["exclusiveMaximum"]); ok && n >= max {
+			violate("%v is not below %v", v, max)
+		}
+		if m, ok := schemaNumber(schema["multipleOf"]); ok && m > 0 {
+			if q := n / m; math.Abs(q-math.Round(q)) > 1e-9 {
+				violate("%v is not a multiple of %v", v, m)
+			}
+		}
+	}
+
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			s.check(sub, v, path, depth+1, violations)
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok && s.matching(anyOf, v, depth) == 0 {
+		violate("matches none of anyOf")
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		if n := s.matching(oneOf, v, depth); n != 1 {
+			violate("matches %d of oneOf, want 1", n)
+		}
+	}
+	if not, ok := schema["not"]; ok {
+		if len(s.violations(not, v, depth)) == 0 {
+			violate("matches not")
+		}
+	}
+}
+
+func (s *jsonSchema) checkObject(schema, v map[string]interface{}, path string, depth int, violations *[]string, violate func(string, ...interface{})) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				if _, ok := v[name]; !ok {
+					violate("missing required %s", name)
+				}
+			}
+		}
+	}
+	if min, ok := schemaNumber(schema["minProperties"]); ok && float64(len(v)) < min {
+		violate("%d properties are below %v", len(v), min)
+	}
+	if max, ok := schemaNumber(schema["maxProperties"]); ok && float64(len(v)) > max {
+		violate("%d properties are above %v", len(v), max)
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+	patterns, _ := schema["patternProperties"].(map[string]interface{})
+	additional, hasAdditional := schema["additionalProperties"]
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		child := jsonPathChild(path, name)
+		matched := false
+		if sub, ok := properties[name]; ok {
+			matched = true
+			s.check(sub, v[name], child, depth+1, violations)
+		}
+		for pattern, sub := range patterns {
+			if match, err := regexp.MatchString(pattern, name); err == nil && match {
+				matched = true
+				s.check(sub, v[name], child, depth+1, violations)
+			}
+		}
+		if !matched && hasAdditional {
+			if allowed, ok := additional.(bool); ok && !allowed {
+				violate("unexpected property %s", name)
+			} else {
+				s.check(additional, v[name], child, depth+1, violations)
+			}
+		}
+	}
+}
+
+func (s *jsonSchema) checkArray(schema map[string]interface{}, v []interface{}, path string, depth int, violations *[]string, violate func(string, ...interface{})) {
+	if min, ok := schemaNumber(schema["minItems"]); ok && float64(len(v)) < min {
+		violate("%d items are below %v", len(v), min)
+	}
+	if max, ok := schemaNumber(schema["maxItems"]); ok && float64(len(v)) > max {
+		violate("%d items are above %v", len(v), max)
+	}
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+		for i := range v {
+			for j := i + 1; j < len(v); j++ {
+				if jsonEqual(v[i], v[j]) {
+					violate("items %d and %d are equal", i, j)
+				}
+			}
+		}
+	}
+	// prefixItems of 2020-12 and the array form of items of draft 7 validate items by position,
+	// the remaining items are validated with items or additionalItems
+	prefix, ok := schema["prefixItems"].([]interface{})
+	rest, hasRest := schema["items"]
+	if !ok {
+		if tuple, isTuple := rest.([]interface{}); isTuple {
+			prefix = tuple
+			rest, hasRest = schema["additionalItems"]
+		}
+	}
+	for i, item := range v {
+		child := path + "[" + strconv.Itoa(i) + "]"
+		switch {
+		case i < len(prefix):
+			s.check(prefix[i], item, child, depth+1, violations)
+		case hasRest:
+			s.check(rest, item, child, depth+1, violations)
+		}
+	}
+}
+
+// matching returns how many of the schemas the value matches
+func (s *jsonSchema) matching(schemas []interface{}, v interface{}, depth int) int {
+	n := 0
+	for _, sub := range schemas {
+		if len(s.violations(sub, v, depth)) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *jsonSchema) violations(schema, v interface{}, depth int) []string {
+	var violations []string
+	s.check(schema, v, "$", depth+1, &violations)
+	return violations
+}
+
+// resolve returns the part of the schema a local $ref points to
+func (s *jsonSchema) resolve(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("$ref %s is not local", ref)
+	}
+	target := s.root
+	pointer := strings.TrimPrefix(ref, "#")
+	if pointer == "" {
+		return target, nil
+	}
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch t := target.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if target, ok = t[token]; !ok {
+				return nil, fmt.Errorf("$ref %s does not exist", ref)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil, fmt.Errorf("$ref %s does not exist", ref)
+			}
+			target = t[i]
+		default:
+			return nil, fmt.Errorf("$ref %s does not exist", ref)
+		}
+	}
+	return target, nil
+}
+
+// hasSchemaType reports whether the value has the type, or one of the types, of a type keyword
+func hasSchemaType(t, v interface{}) bool {
+	types, ok := t.([]interface{})
+	if !ok {
+		types = []interface{}{t}
+	}
+	actual := schemaType(v)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaType returns the JSON Schema type of a decoded value
+func schemaType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	}
+	return "unknown"
+}
+
+// schemaNumber returns the value of a numeric keyword
+func schemaNumber(v interface{}) (float64, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := n.Float64()
+	return f, err == nil
+}
+
+// jsonEqual reports whether two decoded values are equal, numbers by value
+func jsonEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, errA := a.Float64()
+		y, errB := b.Float64()
+		return errA == nil && errB == nil && x == y
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			if w, ok := b[k]; !ok || !jsonEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// jsonLiteral formats a decoded value as JSON
+func jsonLiteral(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// jsonPathChild returns the JSONPath of the property of the value at path
+func jsonPathChild(path, name string) string {
+	for _, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return path + "['" + name + "']"
+		}
+	}
+	if name == "" {
+		return path + "['']"
+	}
+	return path + "." + name
+}
+
+// verifyJSONSchema validates the body of a response against the JSONSchema of the service and
+// returns the issue listing the paths that violate it
+func (s *Service) verifyJSONSchema(content []byte) string {
+	if len(s.JSONSchema) == 0 {
+		return ""
+	}
+	schema, err := parseJSONSchema(s.JSONSchema)
+	if err != nil {
+		s.classify(FailureConfig, err)
+		return fmt.Sprintf("JSON Schema Error %v", err)
+	}
+	doc, err := decodeJSON(content)
+	if err != nil {
+		s.classify(FailureSchema, err)
+		return fmt.Sprintf("HTTP Response Body is not JSON, %v", err)
+	}
+	violations := schema.validate(doc)
+	if len(violations) == 0 {
+		return ""
+	}
+	s.classify(FailureSchema, nil)
+	listed := violations
+	if len(listed) > maxSchemaViolations {
+		listed = listed[:maxSchemaViolations]
+	}
+	issue := fmt.Sprintf("HTTP Response Body has %d JSON Schema violations: %s", len(violations), strings.Join(listed, "; "))
+	if len(violations) > len(listed) {
+		issue += fmt.Sprintf("; and %d more", len(violations)-len(listed))
+	}
+	return issue
+}
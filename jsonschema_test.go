@@ -0,0 +1,114 @@
+package scout
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+const userSchema = `{
+	"type": "object",
+	"required": ["id", "name", "roles"],
+	"properties": {
+		"id": {"type": "integer", "minimum": 1},
+		"name": {"type": "string", "minLength": 1},
+		"email": {"type": ["string", "null"], "pattern": "@"},
+		"roles": {"type": "array", "items": {"$ref": "#/definitions/role"}, "uniqueItems": true},
+		"manager": {"$ref": "#"}
+	},
+	"additionalProperties": false,
+	"definitions": {
+		"role": {"enum": ["admin", "user"]}
+	}
+}`
+
+func TestJSONSchemaValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	schema, err := parseJSONSchema([]byte(userSchema))
+	assert.Nil(err)
+	for doc, violations := range map[string][]string{
+		`{"id": 1, "name": "ada", "roles": ["admin"], "email": null}`:                                    nil,
+		`{"id": 2, "name": "bob", "roles": [], "manager": {"id": 1, "name": "ada", "roles": ["admin"]}}`: nil,
+		`{"id": "1", "name": "ada", "roles": ["admin"]}`:                                                 {"$.id: got string, want integer"},
+		`{"id": 0, "name": "", "roles": ["root", "user", "user"]}`: {
+			"$.id: 0 is below 1",
+			"$.name: length 0 is below 1",
+			"$.roles: items 1 and 2 are equal",
+			`$.roles[0]: "root" is not one of ["admin","user"]`,
+		},
+		`{"id": 1.5, "name": "ada", "roles": [], "extra key": 1}`: {
+			"$: unexpected property extra key",
+			`$.id: got number, want integer`,
+		},
+		`{"id": 2, "name": "bob", "roles": [], "manager": {"id": 1, "roles": []}}`: {"$.manager: missing required name"},
+		`[]`: {`$: got array, want object`},
+	} {
+		v, err := decodeJSON([]byte(doc))
+		assert.Nil(err)
+		assert.Equal(violations, schema.validate(v), doc)
+	}
+
+	schema, err = parseJSONSchema([]byte(`{"oneOf": [{"type": "integer"}, {"minimum": 2}], "not": {"const": 7}}`))
+	assert.Nil(err)
+	for doc, violations := range map[string][]string{
+		`1`:   nil,
+		`2.5`: nil,
+		`3`:   {"$: matches 2 of oneOf, want 1"},
+		`7`:   {"$: matches 2 of oneOf, want 1", "$: matches not"},
+	} {
+		v, _ := decodeJSON([]byte(doc))
+		assert.Equal(violations, schema.validate(v), doc)
+	}
+
+	_, err = parseJSONSchema([]byte(`"object"`))
+	assert.NotNil(err)
+}
+
+func TestJSONSchemaCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	users := map[string]interface{}{"id": 1, "name": "ada", "roles": []string{"admin"}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(users)
+	}))
+	defer ts.Close()
+
+	serv := &Service{
+		ID:             uuid.New(),
+		Name:           "Users API",
+		Address:        ts.URL,
+		Type:           "http",
+		ExpectedStatus: http.StatusOK,
+		SkipDNSTiming:  true,
+		Interval:       Duration(time.Minute),
+		Timeout:        Duration(5 * time.Second),
+		Logger:         NewSlogLogger(nil),
+		JSONSchema:     json.RawMessage(userSchema),
+	}
+	assert.Nil(serv.Validate())
+	_, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+
+	// the contract drifts, the id becomes a string and the roles are renamed
+	users["id"], users["roles"] = "1", nil
+	users["groups"] = []string{"admin"}
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureSchema, fail.Class)
+	assert.Equal(`HTTP Response Body has 3 JSON Schema violations: $: unexpected property groups; $.id: got string, want integer; $.roles: got null, want array`, fail.Issue)
+	assert.True(errors.Is(fail.Err, ErrUnexpectedContent))
+
+	serv.JSONSchema = json.RawMessage(`{"type": `)
+	err := serv.Validate()
+	assert.True(errors.Is(err, ErrInvalidExpected))
+	assert.True(strings.Contains(err.Error(), "json schema"))
+}
@@ -0,0 +1,542 @@
+package scout
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultKafkaPort = 9092
+
+	kafkaProduceKey  = 0
+	kafkaFetchKey    = 1
+	kafkaMetadataKey = 3
+
+	// the oldest versions still supported by current brokers, none of them use the flexible
+	// (tagged field) encoding
+	kafkaProduceVersion  = 3
+	kafkaFetchVersion    = 4
+	kafkaMetadataVersion = 4
+
+	kafkaClientID = "phenixrizen-scout"
+)
+
+// kafkaErrors names the error codes a broker commonly returns to the Kafka check
+var kafkaErrors = map[int16]string{
+	2:  "CORRUPT_MESSAGE",
+	3:  "UNKNOWN_TOPIC_OR_PARTITION",
+	5:  "LEADER_NOT_AVAILABLE",
+	6:  "NOT_LEADER_OR_FOLLOWER",
+	7:  "REQUEST_TIMED_OUT",
+	10: "MESSAGE_TOO_LARGE",
+	19: "NOT_ENOUGH_REPLICAS",
+	20: "NOT_ENOUGH_REPLICAS_AFTER_APPEND",
+	29: "TOPIC_AUTHORIZATION_FAILED",
+	35: "UNSUPPORTED_VERSION",
+}
+
+// kafkaError is a error code returned by a broker
+type kafkaError int16
+
+func (e kafkaError) Error() string {
+	if name, ok := kafkaErrors[int16(e)]; ok {
+		return fmt.Sprintf("kafka: %s (%d)", name, int16(e))
+	}
+	return fmt.Sprintf("kafka: error code %d", int16(e))
+}
+
+// KafkaConfig configures the Kafka check of a service
+type KafkaConfig struct {
+	// Topic is checked for a leader of its first partition when it is set
+	Topic string `json:"topic"`
+	// Canary produces a message to Topic and fetches it back
+	Canary bool `json:"canary"`
+}
+
+// CheckKafka will connect to a broker and fetch the metadata of the Topic of the Kafka config,
+// failing when the topic does not exist or its first partition has no leader, with Canary a
+// message is produced to
+// the leader of the first partition and fetched back, the produce round-trip is then kept as
+// the request latency instead of the metadata round-trip
+func (s *Service) CheckKafka() {
+	cfg := s.Kafka
+	if cfg == nil {
+		cfg = &KafkaConfig{}
+	}
+	if !s.SkipDNSTiming {
+		dnsLookup, err := s.DNSCheck()
+		if err != nil {
+			s.fail(FailureDNS, err, fmt.Sprintf("Could not get IP address for %v, %v", s.Address, err))
+			return
+		}
+		s.DNSResolve = dnsLookup
+	}
+	t1 := time.Now()
+	broker, err := s.dialKafka(s.netAddress(defaultKafkaPort))
+	if err != nil {
+		s.fail(classifyError(err, false), err, fmt.Sprintf("Dial Error %v", err))
+		return
+	}
+	defer broker.Close()
+	s.setNetworkLatency(time.Since(t1).Milliseconds())
+
+	t2 := time.Now()
+	meta, err := broker.metadata(cfg.Topic)
+	if err != nil {
+		s.fail(classifyError(err, true), err, fmt.Sprintf("Kafka Metadata Error %v", err))
+		return
+	}
+	s.setRequestLatency(time.Since(t2).Milliseconds())
+	s.Details = map[string]string{"brokers": strconv.Itoa(len(meta.brokers))}
+	if cfg.Topic == "" {
+		s.Success()
+		return
+	}
+	if meta.topicError != 0 {
+		s.fail(FailureProtocol, nil, fmt.Sprintf("Kafka topic %v: %v", cfg.Topic, kafkaError(meta.topicError)))
+		return
+	}
+	leader, ok := meta.brokers[meta.leader]
+	if !ok {
+		s.fail(FailureUnhealthy, nil, fmt.Sprintf("Kafka topic %v partition 0 has no leader", cfg.Topic))
+		return
+	}
+	s.Details["partitions"] = strconv.Itoa(meta.partitions)
+	s.Details["leader"] = leader
+	if !cfg.Canary {
+		s.Success()
+		return
+	}
+
+	if leader != broker.addr {
+		conn, err := s.dialKafka(leader)
+		if err != nil {
+			s.fail(classifyError(err, false), err, fmt.Sprintf("Kafka leader %v Dial Error %v", leader, err))
+			return
+		}
+		defer conn.Close()
+		broker = conn
+	}
+	canary := "scout canary " + uuid.New().String()
+	t3 := time.Now()
+	offset, err := broker.produce(cfg.Topic, []byte(canary))
+	if err != nil {
+		s.fail(classifyError(err, true), err, fmt.Sprintf("Kafka Produce Error %v", err))
+		return
+	}
+	s.setRequestLatency(time.Since(t3).Milliseconds())
+	s.Details["produceLatency"] = strconv.FormatInt(s.RequestLatency, 10)
+
+	value, err := broker.fetch(cfg.Topic, offset)
+	if err != nil {
+		s.fail(classifyError(err, true), err, fmt.Sprintf("Kafka Fetch Error %v", err))
+		return
+	}
+	if value != nil && string(value) != canary {
+		s.fail(FailureBodyMismatch, nil, fmt.Sprintf("Kafka canary at offset %v was '%v', expected '%v'", offset, string(value), canary))
+		return
+	}
+	s.Success()
+}
+
+// kafkaConn is a connection to a broker
+type kafkaConn struct {
+	net.Conn
+	addr        string
+	r           *bufio.Reader
+	correlation int32
+	timeout     time.Duration
+	deadline    time.Time
+}
+
+func (s *Service) dialKafka(addr string) (*kafkaConn, error) {
+	conn, err := s.dial(s.network("tcp"), addr)
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaConn{Conn: conn, addr: addr, r: bufio.NewReader(conn), timeout: s.Timeout.Duration(), deadline: s.deadline()}, nil
+}
+
+// roundTrip sends a request with a v1 request header and returns the response body, the
+// response has to arrive before the deadline of the check
+func (c *kafkaConn) roundTrip(key, version int16, body []byte) (*kafkaReader, error) {
+	if err := c.SetDeadline(c.deadline); err != nil {
+		return nil, err
+	}
+	c.correlation++
+	var w kafkaWriter
+	w.int32(0)
+	w.int16(key)
+	w.int16(version)
+	w.int32(c.correlation)
+	w.string(kafkaClientID)
+	w.b = append(w.b, body...)
+	binary.BigEndian.PutUint32(w.b, uint32(len(w.b)-4))
+	if _, err := c.Write(w.b); err != nil {
+		return nil, err
+	}
+
+	var size int32
+	if err := binary.Read(c.r, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	if size < 4 || size > 64*1024*1024 {
+		return nil, fmt.Errorf("kafka: invalid response size %v", size)
+	}
+	res := make([]byte, size)
+	if _, err := io.ReadFull(c.r, res); err != nil {
+		return nil, err
+	}
+	r := &kafkaReader{b: res}
+	if id := r.int32(); id != c.correlation {
+		return nil, fmt.Errorf("kafka: response for request %v, expected %v", id, c.correlation)
+	}
+	return r, nil
+}
+
+// kafkaMetadata is the part of a metadata response used by the check, brokers maps node IDs
+// to their host:port and leader is the node leading the first partition of the topic
+type kafkaMetadata struct {
+	brokers    map[int32]string
+	topicError int16
+	partitions int
+	leader     int32
+}
+
+func (c *kafkaConn) metadata(topic string) (*kafkaMetadata, error) {
+	var w kafkaWriter
+	if topic == "" {
+		w.int32(0)
+	} else {
+		w.int32(1)
+		w.string(topic)
+	}
+	// allow_auto_topic_creation
+	w.int8(0)
+	r, err := c.roundTrip(kafkaMetadataKey, kafkaMetadataVersion, w.b)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &kafkaMetadata{brokers: make(map[int32]string), leader: -1}
+	r.int32() // throttle_time_ms
+	for n := r.int32(); n > 0 && r.err == nil; n-- {
+		id := r.int32()
+		host := r.string()
+		port := r.int32()
+		r.string() // rack
+		meta.brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	r.string() // cluster_id
+	r.int32()  // controller_id
+	for n := r.int32(); n > 0 && r.err == nil; n-- {
+		meta.topicError = r.int16()
+		r.string() // name
+		r.int8()   // is_internal
+		for p := r.int32(); p > 0 && r.err == nil; p-- {
+			r.int16() // error_code
+			index := r.int32()
+			leader := r.int32()
+			r.skipInt32s() // replica_nodes
+			r.skipInt32s() // isr_nodes
+			if index == 0 {
+				meta.leader = leader
+			}
+			meta.partitions++
+		}
+	}
+	if topic != "" && meta.partitions == 0 && meta.topicError == 0 && r.err == nil {
+		meta.topicError = 3
+	}
+	return meta, r.err
+}
+
+// produce appends value to the first partition of topic and returns its offset
+func (c *kafkaConn) produce(topic string, value []byte) (int64, error) {
+	batch := kafkaRecordBatch(value, time.Now())
+	var w kafkaWriter
+	w.int16(-1) // transactional_id
+	w.int16(-1) // acks, all in sync replicas
+	w.int32(int32(c.timeout.Milliseconds()))
+	w.int32(1)
+	w.string(topic)
+	w.int32(1)
+	w.int32(0)
+	w.bytes(batch)
+	r, err := c.roundTrip(kafkaProduceKey, kafkaProduceVersion, w.b)
+	if err != nil {
+		return 0, err
+	}
+	if r.int32() != 1 {
+		return 0, errors.New("kafka: produce response has no topic")
+	}
+	r.string()
+	if r.int32() != 1 {
+		return 0, errors.New("kafka: produce response has no partition")
+	}
+	r.int32()
+	code := r.int16()
+	offset := r.int64()
+	if r.err != nil {
+		return 0, r.err
+	}
+	if code != 0 {
+		return 0, kafkaError(code)
+	}
+	return offset, nil
+}
+
+// fetch returns the value of the record at offset of the first partition of topic, or nil when
+// the broker returned it compressed
+func (c *kafkaConn) fetch(topic string, offset int64) ([]byte, error) {
+	var w kafkaWriter
+	w.int32(-1) // replica_id
+	w.int32(int32(c.timeout.Milliseconds() / 2))
+	w.int32(1)       // min_bytes
+	w.int32(1 << 20) // max_bytes
+	w.int8(0)        // isolation_level, read uncommitted
+	w.int32(1)
+	w.string(topic)
+	w.int32(1)
+	w.int32(0)
+	w.int64(offset)
+	w.int32(1 << 20)
+	r, err := c.roundTrip(kafkaFetchKey, kafkaFetchVersion, w.b)
+	if err != nil {
+		return nil, err
+	}
+	r.int32() // throttle_time_ms
+	if r.int32() != 1 {
+		return nil, errors.New("kafka: fetch response has no topic")
+	}
+	r.string()
+	if r.int32() != 1 {
+		return nil, errors.New("kafka: fetch response has no partition")
+	}
+	r.int32()
+	code := r.int16()
+	r.int64() // high_watermark
+	r.int64() // last_stable_offset
+	for n := r.int32(); n > 0 && r.err == nil; n-- {
+		r.int64() // producer_id
+		r.int64() // first_offset
+	}
+	records := r.bytes()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if code != 0 {
+		return nil, kafkaError(code)
+	}
+	return kafkaRecordValue(records, offset)
+}
+
+// kafkaRecordBatch encodes value as the only record of a uncompressed v2 record batch
+func kafkaRecordBatch(value []byte, now time.Time) []byte {
+	var rec kafkaWriter
+	rec.int8(0)    // attributes
+	rec.varint(0)  // timestamp_delta
+	rec.varint(0)  // offset_delta
+	rec.varint(-1) // key
+	rec.varint(int64(len(value)))
+	rec.b = append(rec.b, value...)
+	rec.varint(0) // headers
+
+	var body kafkaWriter
+	body.int16(0) // attributes
+	body.int32(0) // last_offset_delta
+	ts := now.UnixNano() / int64(time.Millisecond)
+	body.int64(ts)
+	body.int64(ts)
+	body.int64(-1) // producer_id
+	body.int16(-1) // producer_epoch
+	body.int32(-1) // base_sequence
+	body.int32(1)
+	body.varint(int64(len(rec.b)))
+	body.b = append(body.b, rec.b...)
+
+	var w kafkaWriter
+	w.int64(0) // base_offset
+	w.int32(int32(4 + 1 + 4 + len(body.b)))
+	w.int32(-1) // partition_leader_epoch
+	w.int8(2)   // magic
+	w.int32(int32(crc32.Checksum(body.b, crc32.MakeTable(crc32.Castagnoli))))
+	w.b = append(w.b, body.b...)
+	return w.b
+}
+
+// kafkaRecordValue returns the value of the record at offset in the v2 record batches, nil
+// when its batch is compressed
+func kafkaRecordValue(records []byte, offset int64) ([]byte, error) {
+	for len(records) >= 61 {
+		r := &kafkaReader{b: records}
+		base := r.int64()
+		length := int(r.int32())
+		if length < 49 || 12+length > len(records) {
+			break
+		}
+		batch := &kafkaReader{b: records[12 : 12+length]}
+		records = records[12+length:]
+		batch.int32() // partition_leader_epoch
+		if magic := batch.int8(); magic != 2 {
+			return nil, fmt.Errorf("kafka: unsupported record batch magic %v", magic)
+		}
+		batch.int32() // crc
+		attributes := batch.int16()
+		last := batch.int32()
+		if offset < base || offset > base+int64(last) {
+			continue
+		}
+		if attributes&0x07 != 0 {
+			return nil, nil
+		}
+		batch.b = batch.b[8+8+8+2+4:] // timestamps, producer, base_sequence
+		for n := batch.int32(); n > 0 && batch.err == nil; n-- {
+			batch.varint() // length
+			batch.int8()   // attributes
+			batch.varint() // timestamp_delta
+			delta := batch.varint()
+			batch.varintBytes() // key
+			value := batch.varintBytes()
+			for h := batch.varint(); h > 0 && batch.err == nil; h-- {
+				batch.varintBytes()
+				batch.varintBytes()
+			}
+			if base+delta == offset {
+				return value, batch.err
+			}
+		}
+		if batch.err != nil {
+			return nil, batch.err
+		}
+	}
+	return nil, fmt.Errorf("kafka: offset %v not found in fetch response", offset)
+}
+
+// kafkaWriter encodes the big endian primitives of the Kafka protocol
+type kafkaWriter struct {
+	b []byte
+}
+
+func (w *kafkaWriter) int8(v int8) { w.b = append(w.b, byte(v)) }
+func (w *kafkaWriter) int16(v int16) {
+	w.b = append(w.b, byte(v>>8), byte(v))
+}
+func (w *kafkaWriter) int32(v int32) {
+	w.b = append(w.b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+func (w *kafkaWriter) int64(v int64) {
+	w.int32(int32(v >> 32))
+	w.int32(int32(v))
+}
+func (w *kafkaWriter) string(v string) {
+	w.int16(int16(len(v)))
+	w.b = append(w.b, v...)
+}
+func (w *kafkaWriter) bytes(v []byte) {
+	w.int32(int32(len(v)))
+	w.b = append(w.b, v...)
+}
+func (w *kafkaWriter) varint(v int64) {
+	var buf [binary.MaxVarintLen64]byte
+	w.b = append(w.b, buf[:binary.PutVarint(buf[:], v)]...)
+}
+
+// kafkaReader decodes the big endian primitives of the Kafka protocol, the first error is kept
+// and zero values are returned after it
+type kafkaReader struct {
+	b   []byte
+	err error
+}
+
+func (r *kafkaReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.b) < n {
+		r.err = errors.New("kafka: truncated response")
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *kafkaReader) int8() int8 {
+	if b := r.next(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+func (r *kafkaReader) int16() int16 {
+	if b := r.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+func (r *kafkaReader) int32() int32 {
+	if b := r.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+func (r *kafkaReader) int64() int64 {
+	if b := r.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// string reads a (nullable) string, null is returned as ""
+func (r *kafkaReader) string() string {
+	n := r.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(r.next(int(n)))
+}
+
+// bytes reads (nullable) bytes, null is returned as nil
+func (r *kafkaReader) bytes() []byte {
+	n := r.int32()
+	if n < 0 {
+		return nil
+	}
+	return r.next(int(n))
+}
+
+func (r *kafkaReader) skipInt32s() {
+	n := r.int32()
+	r.next(int(n) * 4)
+}
+
+func (r *kafkaReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.b)
+	if n <= 0 {
+		r.err = errors.New("kafka: invalid varint")
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+// varintBytes reads varint length prefixed bytes, a negative length is returned as nil
+func (r *kafkaReader) varintBytes() []byte {
+	n := r.varint()
+	if n < 0 {
+		return nil
+	}
+	return r.next(int(n))
+}
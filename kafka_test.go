@@ -0,0 +1,156 @@
+package scout
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// kafkaBroker is a single broker cluster holding the topic "health" with one partition
+func kafkaBroker(t *testing.T) (string, int) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	addr := l.Addr().(*net.TCPAddr)
+	var batch []byte
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		for {
+			size := make([]byte, 4)
+			if _, err := io.ReadFull(conn, size); err != nil {
+				return
+			}
+			req := make([]byte, binary.BigEndian.Uint32(size))
+			io.ReadFull(conn, req)
+			r := &kafkaReader{b: req}
+			key, _, correlation := r.int16(), r.int16(), r.int32()
+			r.string()
+
+			var w kafkaWriter
+			w.int32(0)
+			w.int32(correlation)
+			switch key {
+			case kafkaMetadataKey:
+				topics := r.int32()
+				topic := r.string()
+				w.int32(0)
+				w.int32(1)
+				w.int32(1)
+				w.string(addr.IP.String())
+				w.int32(int32(addr.Port))
+				w.int16(-1)
+				w.int16(-1)
+				w.int32(1)
+				w.int32(topics)
+				if topics == 1 {
+					if topic == "health" {
+						w.int16(0)
+					} else {
+						w.int16(3)
+					}
+					w.string(topic)
+					w.int8(0)
+					if topic == "health" {
+						w.int32(1)
+						w.int16(0)
+						w.int32(0)
+						w.int32(1)
+						w.int32(1)
+						w.int32(1)
+						w.int32(1)
+						w.int32(1)
+					} else {
+						w.int32(0)
+					}
+				}
+			case kafkaProduceKey:
+				r.int16()
+				r.int16()
+				r.int32()
+				r.int32()
+				topic := r.string()
+				r.int32()
+				r.int32()
+				batch = append([]byte(nil), r.bytes()...)
+				w.int32(1)
+				w.string(topic)
+				w.int32(1)
+				w.int32(0)
+				w.int16(0)
+				w.int64(42)
+				w.int64(-1)
+				w.int32(0)
+			case kafkaFetchKey:
+				binary.BigEndian.PutUint64(batch, 42)
+				w.int32(0)
+				w.int32(1)
+				w.string("health")
+				w.int32(1)
+				w.int32(0)
+				w.int16(0)
+				w.int64(43)
+				w.int64(43)
+				w.int32(0)
+				w.bytes(batch)
+			}
+			binary.BigEndian.PutUint32(w.b, uint32(len(w.b)-4))
+			conn.Write(w.b)
+		}
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			serve(conn)
+		}
+	}()
+	return addr.IP.String(), addr.Port
+}
+
+func TestCheckKafka(t *testing.T) {
+	assert := assert.New(t)
+
+	host, port := kafkaBroker(t)
+	serv := &Service{
+		ID:      uuid.New(),
+		Name:    "Kafka",
+		Type:    "kafka",
+		Address: host,
+		Port:    port,
+		Kafka:   &KafkaConfig{Topic: "health", Canary: true},
+		Timeout: Duration(2 * time.Second),
+		Logger:  NewSlogLogger(nil),
+	}
+	suc, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal(net.JoinHostPort(host, strconv.Itoa(port)), suc.Details["leader"])
+	assert.Contains(suc.Details, "produceLatency")
+
+	serv.Kafka.Topic = "missing"
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal("Kafka topic missing: kafka: UNKNOWN_TOPIC_OR_PARTITION (3)", fail.Issue)
+}
+
+func TestKafkaRecordBatch(t *testing.T) {
+	assert := assert.New(t)
+
+	batch := kafkaRecordBatch([]byte("canary"), time.Now())
+	binary.BigEndian.PutUint64(batch, 7)
+	value, err := kafkaRecordValue(batch, 7)
+	assert.Nil(err)
+	assert.Equal("canary", string(value))
+
+	_, err = kafkaRecordValue(batch, 8)
+	assert.NotNil(err)
+}
@@ -0,0 +1,396 @@
+package scout
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// KubernetesDeployment checks the ready replicas of a deployment, it is the default kind
+	KubernetesDeployment = "deployment"
+	// KubernetesPods checks the number of ready pods matching a label selector
+	KubernetesPods = "pods"
+
+	inClusterTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	inClusterCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	inClusterNSFile    = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// KubernetesConfig configures the Kubernetes check of a service, the API server is taken from
+// Kubeconfig, $KUBECONFIG or ~/.kube/config or the in-cluster service account when scout runs
+// in a pod, the Address of the service overrides the server of the kubeconfig
+type KubernetesConfig struct {
+	Kubeconfig string `json:"kubeconfig"`
+	Context    string `json:"context"`
+	Namespace  string `json:"namespace"`
+	// Kind is KubernetesDeployment (default) with the Name of the deployment or KubernetesPods
+	// with a label Selector
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Selector string `json:"selector"`
+	// MinReady defaults to the desired replicas of a deployment and to 1 for pods
+	MinReady int `json:"minReady"`
+}
+
+// kubeconfig is the subset of a kubeconfig file scout needs to reach the API server
+type kubeconfig struct {
+	CurrentContext string `json:"current-context"`
+	Clusters       []struct {
+		Name    string `json:"name"`
+		Cluster struct {
+			Server                   string `json:"server"`
+			CertificateAuthority     string `json:"certificate-authority"`
+			CertificateAuthorityData []byte `json:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `json:"insecure-skip-tls-verify"`
+		} `json:"cluster"`
+	} `json:"clusters"`
+	Contexts []struct {
+		Name    string `json:"name"`
+		Context struct {
+			Cluster   string `json:"cluster"`
+			User      string `json:"user"`
+			Namespace string `json:"namespace"`
+		} `json:"context"`
+	} `json:"contexts"`
+	Users []struct {
+		Name string `json:"name"`
+		User struct {
+			Token                 string `json:"token"`
+			TokenFile             string `json:"tokenFile"`
+			ClientCertificate     string `json:"client-certificate"`
+			ClientCertificateData []byte `json:"client-certificate-data"`
+			ClientKey             string `json:"client-key"`
+			ClientKeyData         []byte `json:"client-key-data"`
+			Username              string `json:"username"`
+			Password              string `json:"password"`
+		} `json:"user"`
+	} `json:"users"`
+}
+
+// kubeClient is a connection to a Kubernetes API server
+type kubeClient struct {
+	server    string
+	namespace string
+	token     string
+	username  string
+	password  string
+	client    *http.Client
+}
+
+// CheckKubernetes will query the Kubernetes API for the deployment or pods of the Kubernetes
+// config and fail when less than MinReady of them are ready, the ready and desired counts are
+// kept in Details
+func (s *Service) CheckKubernetes() {
+	cfg := s.Kubernetes
+	if cfg == nil {
+		s.fail(FailureConfig, nil, "Kubernetes service has no kubernetes config")
+		return
+	}
+	kc, err := s.kubeClient()
+	if err != nil {
+		s.fail(FailureConfig, err, fmt.Sprintf("Kubernetes Config Error %v", err))
+		return
+	}
+	ns := cfg.Namespace
+	if ns == "" {
+		ns = kc.namespace
+	}
+	if ns == "" {
+		ns = "default"
+	}
+
+	ctx, cancel := context.WithTimeout(s.context(), s.Timeout.Duration())
+	defer cancel()
+	t1 := time.Now()
+	var ready, desired int
+	var what string
+	switch cfg.Kind {
+	case "", KubernetesDeployment:
+		what = fmt.Sprintf("deployment %v/%v", ns, cfg.Name)
+		ready, desired, err = kc.deployment(ctx, ns, cfg.Name)
+	case KubernetesPods:
+		what = fmt.Sprintf("pods %v in %v", cfg.Selector, ns)
+		ready, desired, err = kc.pods(ctx, ns, cfg.Selector)
+	default:
+		err = fmt.Errorf("unsupported kind %q", cfg.Kind)
+	}
+	if err != nil {
+		s.fail(classifyError(err, false), err, fmt.Sprintf("Kubernetes Error %v", err))
+		return
+	}
+	s.setRequestLatency(time.Since(t1).Milliseconds())
+	s.Details = map[string]string{
+		"ready":   fmt.Sprint(ready),
+		"desired": fmt.Sprint(desired),
+	}
+
+	min := cfg.MinReady
+	if min == 0 {
+		min = desired
+		if cfg.Kind == KubernetesPods || min == 0 {
+			min = 1
+		}
+	}
+	if ready < min {
+		s.fail(FailureUnhealthy, nil, fmt.Sprintf("Kubernetes %v has %d of %d ready, expected at least %d", what, ready, desired, min))
+		return
+	}
+	s.Success()
+}
+
+// deployment returns the ready and desired replicas of a deployment
+func (k *kubeClient) deployment(ctx context.Context, ns, name string) (int, int, error) {
+	if name == "" {
+		return 0, 0, errors.New("deployment has no name")
+	}
+	var deploy struct {
+		Spec struct {
+			Replicas *int `json:"replicas"`
+		} `json:"spec"`
+		Status struct {
+			ReadyReplicas int `json:"readyReplicas"`
+		} `json:"status"`
+	}
+	path := fmt.Sprintf("/apis/apps/v1/namespaces/%v/deployments/%v", url.PathEscape(ns), url.PathEscape(name))
+	if err := k.get(ctx, path, &deploy); err != nil {
+		return 0, 0, err
+	}
+	desired := 1
+	if deploy.Spec.Replicas != nil {
+		desired = *deploy.Spec.Replicas
+	}
+	return deploy.Status.ReadyReplicas, desired, nil
+}
+
+// pods returns the ready and total number of pods matching the label selector
+func (k *kubeClient) pods(ctx context.Context, ns, selector string) (int, int, error) {
+	var list struct {
+		Items []struct {
+			Status struct {
+				Phase      string `json:"phase"`
+				Conditions []struct {
+					Type   string `json:"type"`
+					Status string `json:"status"`
+				} `json:"conditions"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	path := fmt.Sprintf("/api/v1/namespaces/%v/pods?labelSelector=%v", url.PathEscape(ns), url.QueryEscape(selector))
+	if err := k.get(ctx, path, &list); err != nil {
+		return 0, 0, err
+	}
+	ready := 0
+	for _, pod := range list.Items {
+		for _, c := range pod.Status.Conditions {
+			if c.Type == "Ready" && c.Status == "True" && pod.Status.Phase == "Running" {
+				ready++
+			}
+		}
+	}
+	return ready, len(list.Items), nil
+}
+
+// get decodes the JSON response of the API server for path into v
+func (k *kubeClient) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, k.server+path, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if k.token != "" {
+		req.Header.Set("Authorization", "Bearer "+k.token)
+	} else if k.username != "" {
+		req.SetBasicAuth(k.username, k.password)
+	}
+	res, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	buf, err := readAll(res.Body)
+	defer putBuffer(buf)
+	if err != nil {
+		return err
+	}
+	body := buf.Bytes()
+	if res.StatusCode != http.StatusOK {
+		var status struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &status) == nil && status.Message != "" {
+			return fmt.Errorf("%v: %v", res.Status, status.Message)
+		}
+		return errors.New(res.Status)
+	}
+	return json.Unmarshal(body, v)
+}
+
+// kubeClient returns a client for the API server of the Kubernetes config of the service
+func (s *Service) kubeClient() (*kubeClient, error) {
+	cfg := s.Kubernetes
+	path := cfg.Kubeconfig
+	if path == "" {
+		path = os.Getenv("KUBECONFIG")
+	}
+	if path == "" && os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return s.inClusterClient()
+	}
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, ".kube", "config")
+	}
+	// $KUBECONFIG may be a list of files, the first one is used
+	path = filepath.SplitList(path)[0]
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var conf kubeconfig
+	if err := yaml.Unmarshal(b, &conf); err != nil {
+		return nil, err
+	}
+	name := cfg.Context
+	if name == "" {
+		name = conf.CurrentContext
+	}
+	kc := &kubeClient{}
+	tlsConfig := &tls.Config{}
+	var clusterName, userName string
+	found := false
+	for _, c := range conf.Contexts {
+		if c.Name == name {
+			clusterName, userName, kc.namespace = c.Context.Cluster, c.Context.User, c.Context.Namespace
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("kubeconfig has no context %q", name)
+	}
+	base := filepath.Dir(path)
+	found = false
+	for _, c := range conf.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		found = true
+		kc.server = c.Cluster.Server
+		tlsConfig.InsecureSkipVerify = c.Cluster.InsecureSkipTLSVerify
+		ca := c.Cluster.CertificateAuthorityData
+		if len(ca) == 0 && c.Cluster.CertificateAuthority != "" {
+			if ca, err = ioutil.ReadFile(kubePath(base, c.Cluster.CertificateAuthority)); err != nil {
+				return nil, err
+			}
+		}
+		if len(ca) > 0 {
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+				return nil, errors.New("kubeconfig has a invalid certificate authority")
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("kubeconfig has no cluster %q", clusterName)
+	}
+	for _, u := range conf.Users {
+		if u.Name != userName {
+			continue
+		}
+		user := u.User
+		kc.token, kc.username, kc.password = user.Token, user.Username, user.Password
+		if kc.token == "" && user.TokenFile != "" {
+			token, err := ioutil.ReadFile(kubePath(base, user.TokenFile))
+			if err != nil {
+				return nil, err
+			}
+			kc.token = strings.TrimSpace(string(token))
+		}
+		certPEM, keyPEM := user.ClientCertificateData, user.ClientKeyData
+		if len(certPEM) == 0 && user.ClientCertificate != "" {
+			if certPEM, err = ioutil.ReadFile(kubePath(base, user.ClientCertificate)); err != nil {
+				return nil, err
+			}
+		}
+		if len(keyPEM) == 0 && user.ClientKey != "" {
+			if keyPEM, err = ioutil.ReadFile(kubePath(base, user.ClientKey)); err != nil {
+				return nil, err
+			}
+		}
+		if len(certPEM) > 0 {
+			cert, err := tls.X509KeyPair(certPEM, keyPEM)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+	}
+	if s.Address != "" {
+		kc.server = s.Address
+	}
+	kc.server = strings.TrimSuffix(kc.server, "/")
+	kc.client = s.kubeHTTPClient(tlsConfig)
+	return kc, nil
+}
+
+// inClusterClient returns a client for the API server of the cluster scout runs in
+func (s *Service) inClusterClient() (*kubeClient, error) {
+	token, err := ioutil.ReadFile(inClusterTokenFile)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(inClusterCAFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{RootCAs: x509.NewCertPool()}
+	if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+		return nil, errors.New("service account has a invalid certificate authority")
+	}
+	kc := &kubeClient{
+		server: "https://" + net.JoinHostPort(os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")),
+		token:  strings.TrimSpace(string(token)),
+	}
+	if ns, err := ioutil.ReadFile(inClusterNSFile); err == nil {
+		kc.namespace = strings.TrimSpace(string(ns))
+	}
+	if s.Address != "" {
+		kc.server = strings.TrimSuffix(s.Address, "/")
+	}
+	kc.client = s.kubeHTTPClient(tlsConfig)
+	return kc, nil
+}
+
+func (s *Service) kubeHTTPClient(tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Timeout: s.Timeout.Duration(),
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+}
+
+// kubePath resolves a path of a kubeconfig relative to the directory of the kubeconfig
+func kubePath(base, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(base, path)
+}
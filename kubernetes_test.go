@@ -0,0 +1,105 @@
+package scout
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckKubernetes(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"kind":"Status","message":"Unauthorized"}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/apis/apps/v1/namespaces/web/deployments/frontend":
+			w.Write([]byte(`{"spec":{"replicas":3},"status":{"readyReplicas":2}}`))
+		case "/api/v1/namespaces/web/pods":
+			assert.Equal("app=frontend", r.URL.Query().Get("labelSelector"))
+			w.Write([]byte(`{"items":[
+				{"status":{"phase":"Running","conditions":[{"type":"Ready","status":"True"}]}},
+				{"status":{"phase":"Running","conditions":[{"type":"Ready","status":"False"}]}}
+			]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"kind":"Status","message":"not found"}`))
+		}
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "kube")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	kubeconfig := filepath.Join(dir, "config")
+	conf := `
+apiVersion: v1
+kind: Config
+current-context: test
+clusters:
+- name: test
+  cluster:
+    server: ` + ts.URL + `
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: scout
+    namespace: web
+users:
+- name: scout
+  user:
+    token: s3cret
+`
+	if err := ioutil.WriteFile(kubeconfig, []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	serv := &Service{
+		ID:   uuid.New(),
+		Name: "Frontend",
+		Type: "kubernetes",
+		Kubernetes: &KubernetesConfig{
+			Kubeconfig: kubeconfig,
+			Name:       "frontend",
+			MinReady:   2,
+		},
+		Timeout: Duration(2 * time.Second),
+		Logger:  NewSlogLogger(nil),
+	}
+	suc, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("2", suc.Details["ready"])
+	assert.Equal("3", suc.Details["desired"])
+
+	// without MinReady all desired replicas have to be ready
+	serv.Kubernetes.MinReady = 0
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Contains(fail.Issue, "has 2 of 3 ready, expected at least 3")
+
+	serv.Kubernetes.Kind = KubernetesPods
+	serv.Kubernetes.Selector = "app=frontend"
+	suc, ok = checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("1", suc.Details["ready"])
+	assert.Equal("2", suc.Details["desired"])
+
+	serv.Kubernetes.Kind = KubernetesDeployment
+	serv.Kubernetes.Name = "backend"
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Contains(fail.Issue, "not found")
+}
@@ -0,0 +1,164 @@
+package scout
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultLDAPPort = 389
+
+	ldapBindRequest     = 0x60
+	ldapBindResponse    = 0x61
+	ldapUnbindRequest   = 0x42
+	ldapSearchRequest   = 0x63
+	ldapSearchEntry     = 0x64
+	ldapSearchDone      = 0x65
+	ldapSearchReference = 0x73
+
+	// ldapMaxSearchMessages bounds the messages read for the base search
+	ldapMaxSearchMessages = 16
+)
+
+// LDAPConfig configures the LDAP check of a service
+type LDAPConfig struct {
+	// BaseDN is searched for after the bind when it is set
+	BaseDN string `json:"baseDN"`
+}
+
+// CheckLDAP will bind to the LDAP server of the service, anonymously or with the Username (the
+// bind DN) and Password, after upgrading the connection when StartTLS is StartTLSLDAP, and
+// search the BaseDN of the LDAP config when it is set, failing when the bind or search do not succeed, the bind
+// round-trip is kept as the request latency
+func (s *Service) CheckLDAP() {
+	if !s.SkipDNSTiming {
+		dnsLookup, err := s.DNSCheck()
+		if err != nil {
+			s.fail(FailureDNS, err, fmt.Sprintf("Could not get IP address for %v, %v", s.Address, err))
+			return
+		}
+		s.DNSResolve = dnsLookup
+	}
+	t1 := time.Now()
+	conn, err := s.dial(s.network("tcp"), s.netAddress(defaultLDAPPort))
+	if err != nil {
+		s.fail(classifyError(err, false), err, fmt.Sprintf("Dial Error %v", err))
+		return
+	}
+	defer conn.Close()
+	s.setNetworkLatency(time.Since(t1).Milliseconds())
+	if conn, err = s.startTLS(conn); err != nil {
+		s.fail(tlsClass(err), err, fmt.Sprintf("StartTLS Error %v", err))
+		return
+	}
+	if err := conn.SetDeadline(s.deadline()); err != nil {
+		s.fail(FailureProtocol, err, fmt.Sprintf("LDAP Deadline Error %v", err))
+		return
+	}
+
+	t2 := time.Now()
+	bind := berSeq(0x30,
+		berInt(0x02, 2),
+		berSeq(ldapBindRequest,
+			berInt(0x02, 3),
+			berTLV(0x04, []byte(s.secret(s.Username))),
+			berTLV(0x80, []byte(s.secret(s.Password))),
+		),
+	)
+	if _, err := conn.Write(bind); err != nil {
+		s.fail(classifyError(err, true), err, fmt.Sprintf("LDAP Bind Error %v", err))
+		return
+	}
+	resp, err := berRead(conn)
+	if err != nil {
+		s.fail(classifyError(err, true), err, fmt.Sprintf("LDAP Bind Error %v", err))
+		return
+	}
+	code, diag, err := ldapResult(resp, ldapBindResponse)
+	if err != nil {
+		s.fail(classifyError(err, true), err, fmt.Sprintf("LDAP Bind Error %v", err))
+		return
+	}
+	if code != 0 {
+		s.fail(FailureProtocol, nil, fmt.Sprintf("LDAP bind result code %d %s", code, diag))
+		return
+	}
+	s.setRequestLatency(time.Since(t2).Milliseconds())
+
+	if s.LDAP != nil && s.LDAP.BaseDN != "" {
+		entries, err := s.ldapBaseSearch(conn, s.LDAP.BaseDN)
+		if err != nil {
+			s.fail(classifyError(err, true), err, fmt.Sprintf("LDAP Search Error %v", err))
+			return
+		}
+		s.Details = map[string]string{"entries": strconv.Itoa(entries)}
+	}
+	conn.Write(berSeq(0x30, berInt(0x02, 4), berTLV(ldapUnbindRequest, nil)))
+	s.Success()
+}
+
+// ldapBaseSearch searches the baseDN object for any objectClass and returns the number of
+// entries returned
+func (s *Service) ldapBaseSearch(conn net.Conn, baseDN string) (int, error) {
+	search := berSeq(0x30,
+		berInt(0x02, 3),
+		berSeq(ldapSearchRequest,
+			berTLV(0x04, []byte(baseDN)),
+			berInt(0x0A, 0), // scope baseObject
+			berInt(0x0A, 0), // neverDerefAliases
+			berInt(0x02, 1), // sizeLimit
+			berInt(0x02, int64(s.Timeout.Duration().Seconds())),
+			berTLV(0x01, []byte{0}),             // typesOnly
+			berTLV(0x87, []byte("objectClass")), // present filter
+			berSeq(0x30, berTLV(0x04, []byte("1.1"))),
+		),
+	)
+	if _, err := conn.Write(search); err != nil {
+		return 0, err
+	}
+	entries := 0
+	for i := 0; i < ldapMaxSearchMessages; i++ {
+		msg, err := berRead(conn)
+		if err != nil {
+			return entries, err
+		}
+		op, err := ldapOp(msg)
+		if err != nil {
+			return entries, err
+		}
+		switch op {
+		case ldapSearchEntry:
+			entries++
+		case ldapSearchReference:
+		case ldapSearchDone:
+			code, diag, err := ldapResult(msg, ldapSearchDone)
+			if err != nil {
+				return entries, err
+			}
+			if code != 0 {
+				return entries, fmt.Errorf("result code %d %s", code, diag)
+			}
+			return entries, nil
+		default:
+			return entries, fmt.Errorf("unexpected response tag 0x%x", op)
+		}
+	}
+	return entries, fmt.Errorf("no search result within %v messages", ldapMaxSearchMessages)
+}
+
+// ldapOp returns the protocol op tag of a LDAPMessage
+func ldapOp(msg []byte) (byte, error) {
+	_, body, _, err := berParse(msg)
+	if err != nil {
+		return 0, err
+	}
+	if _, _, body, err = berParse(body); err != nil {
+		return 0, err
+	}
+	if len(body) == 0 {
+		return 0, errBERTruncated
+	}
+	return body[0], nil
+}
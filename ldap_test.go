@@ -0,0 +1,91 @@
+package scout
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// ldapResponse encodes a LDAPMessage with a LDAPResult protocol op
+func ldapResponse(id int64, op byte, code int64) []byte {
+	return berSeq(0x30, berInt(0x02, id), berSeq(op, berInt(0x0A, code), berTLV(0x04, nil), berTLV(0x04, nil)))
+}
+
+func TestCheckLDAP(t *testing.T) {
+	assert := assert.New(t)
+
+	// the directory accepts the bind of cn=scout and holds dc=example
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					msg, err := berRead(conn)
+					if err != nil {
+						return
+					}
+					_, body, _, _ := berParse(msg)
+					_, id, body, _ := berParse(body)
+					op, req, _, _ := berParse(body)
+					switch op {
+					case ldapBindRequest:
+						_, _, req, _ = berParse(req)
+						_, name, _, _ := berParse(req)
+						code := int64(49)
+						if string(name) == "cn=scout" {
+							code = 0
+						}
+						conn.Write(ldapResponse(berParseInt(id), ldapBindResponse, code))
+					case ldapSearchRequest:
+						_, base, _, _ := berParse(req)
+						if string(base) != "dc=example" {
+							conn.Write(ldapResponse(berParseInt(id), ldapSearchDone, 32))
+							continue
+						}
+						conn.Write(berSeq(0x30, berInt(0x02, berParseInt(id)), berSeq(ldapSearchEntry, berTLV(0x04, base), berSeq(0x30))))
+						conn.Write(ldapResponse(berParseInt(id), ldapSearchDone, 0))
+					}
+				}
+			}()
+		}
+	}()
+
+	addr := l.Addr().(*net.TCPAddr)
+	serv := &Service{
+		ID:       uuid.New(),
+		Name:     "LDAP",
+		Type:     "ldap",
+		Address:  addr.IP.String(),
+		Port:     addr.Port,
+		Username: "cn=scout",
+		Password: "secret",
+		LDAP:     &LDAPConfig{BaseDN: "dc=example"},
+		Timeout:  Duration(2 * time.Second),
+		Logger:   NewSlogLogger(nil),
+	}
+	suc, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("1", suc.Details["entries"])
+
+	serv.LDAP.BaseDN = "dc=missing"
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Contains(fail.Issue, "LDAP Search Error result code 32")
+
+	serv.Username = "cn=intruder"
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Contains(fail.Issue, "LDAP bind result code 49")
+}
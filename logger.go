@@ -0,0 +1,45 @@
+package scout
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Logger is the logger of scouts and services, logrus.FieldLogger and zap's SugaredLogger
+// implement it as is and the logrusadapter and zapadapter modules adapt their loggers without
+// scout depending on either
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// slogLogger adapts a slog logger to Logger
+type slogLogger struct {
+	log *slog.Logger
+}
+
+// NewSlogLogger returns a Logger writing to the slog logger, nil logs to slog.Default
+func NewSlogLogger(log *slog.Logger) Logger {
+	if log == nil {
+		log = slog.Default()
+	}
+	return slogLogger{log: log}
+}
+
+func (l slogLogger) Debugf(format string, args ...interface{}) {
+	l.log.Debug(fmt.Sprintf(format, args...))
+}
+
+func (l slogLogger) Infof(format string, args ...interface{}) {
+	l.log.Info(fmt.Sprintf(format, args...))
+}
+
+func (l slogLogger) Warnf(format string, args ...interface{}) {
+	l.log.Warn(fmt.Sprintf(format, args...))
+}
+
+func (l slogLogger) Errorf(format string, args ...interface{}) {
+	l.log.Error(fmt.Sprintf(format, args...))
+}
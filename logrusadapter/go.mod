@@ -0,0 +1,22 @@
+module github.com/phenixrizen/scout/logrusadapter
+
+go 1.21
+
+require (
+	github.com/phenixrizen/scout v0.0.0-20261015040649-3763ffa74cdc
+	github.com/sirupsen/logrus v1.4.2
+)
+
+require (
+	github.com/ghodss/yaml v1.0.0 // indirect
+	github.com/google/uuid v1.1.2 // indirect
+	github.com/konsorten/go-windows-terminal-sequences v1.0.1 // indirect
+	github.com/kr/text v0.2.0 // indirect
+	github.com/phenixrizen/go-traceroute v0.0.0-20200128013249-14f74dc421b9 // indirect
+	github.com/tatsushid/go-fastping v0.0.0-20160109021039-d7bb493dee3e // indirect
+	golang.org/x/net v0.0.0-20200822124328-c89045814202 // indirect
+	golang.org/x/sys v0.0.0-20200323222414-85ca7c5b95cd // indirect
+	gopkg.in/yaml.v2 v2.2.8 // indirect
+)
+
+replace github.com/phenixrizen/scout => ../
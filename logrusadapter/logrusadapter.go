@@ -0,0 +1,13 @@
+// Package logrusadapter adapts logrus loggers to scout.Logger
+package logrusadapter
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"github.com/phenixrizen/scout"
+)
+
+// New returns a scout.Logger writing to the logrus logger or entry
+func New(log logrus.FieldLogger) scout.Logger {
+	return log
+}
@@ -0,0 +1,188 @@
+package scout
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// MessageTemplates are the text/template templates of the messages of notifications by
+// severity, the template of the empty severity is used for the severities without one
+type MessageTemplates map[string]string
+
+// defaultMessages are the messages of the severities without a template
+var defaultMessages = mustParseMessages(MessageTemplates{
+	SeverityFailure:  `{{.Name}} is {{if .Reminder}}still {{end}}down: {{.Issue}}`,
+	SeverityDegraded: `{{.Name}} is {{if .Reminder}}still {{end}}degraded: {{.Issue}}`,
+	SeverityRecovery: `{{.Name}} recovered{{if .Duration}} after {{duration .Duration}}{{end}}`,
+	SeverityDigest:   `{{.Name}} while quiet{{range .Digest}}, {{.Severity}} {{.Name}}{{with .Issue}}: {{.}}{{end}}{{end}}`,
+	SeverityReport:   `{{.Name}} from {{.Report.From.Format "2006-01-02 15:04"}} to {{.Report.To.Format "2006-01-02 15:04"}}, uptime {{percent .Report.Uptime}}`,
+	"":               `{{.Name}}{{with .Issue}}: {{.}}{{end}}`,
+})
+
+// messageFuncs are the functions of the message templates
+var messageFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	// duration formats a duration rounded to the second
+	"duration": func(d time.Duration) string { return d.Round(time.Second).String() },
+	// percent formats a percentage with two decimals
+	"percent": func(f float64) string { return fmt.Sprintf("%.2f%%", f) },
+}
+
+// MessageData is what the message templates are executed with, the fields of the notification,
+// e.g. {{.Name}}, {{.Issue}} or {{.Since}}, and of its result, e.g. {{.Result.Consecutive}} of a
+// failure, with the state and stats of the service
+type MessageData struct {
+	Notification
+	// Status is the state of the service when the notification is delivered, nil for groups
+	Status *ServiceStatus
+	Tags   map[string]string
+	// Uptime is the percentage of successful checks in the timeline of the service, -1 when the
+	// scout keeps no timeline
+	Uptime float64
+	// SLO is the error budget of the service, nil when it has no SLO
+	SLO *SLOStatus
+	// Duration is how long the incident has been going on, or went on for a recovery
+	Duration time.Duration
+}
+
+// WithMessageTemplates sets the templates of the messages of the notifications, e.g.
+// {SeverityFailure: "{{.Name}} is down for {{duration .Duration}}: {{.Issue}}"}, the built in
+// messages are used for the severities without a template
+func WithMessageTemplates(t MessageTemplates) Option {
+	return func(s *Scout) error {
+		return s.SetMessageTemplates("", t)
+	}
+}
+
+// WithNotifierTemplates overrides the message templates for the notifier with the name, it has to
+// be added first
+func WithNotifierTemplates(notifier string, t MessageTemplates) Option {
+	return func(s *Scout) error {
+		return s.SetMessageTemplates(notifier, t)
+	}
+}
+
+// SetMessageTemplates replaces the message templates of the notifier with the name, or of every
+// notifier without templates of its own when the name is empty. The templates are parsed first,
+// one that does not parse fails with ErrInvalidMessageTemplate, and nil templates remove them
+func (s *Scout) SetMessageTemplates(notifier string, t MessageTemplates) error {
+	parsed, err := parseMessages(t)
+	if err != nil {
+		return err
+	}
+	s.router.mux.Lock()
+	defer s.router.mux.Unlock()
+	if notifier == "" {
+		s.router.messages = parsed
+		return nil
+	}
+	if _, ok := s.router.notifiers[notifier]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownNotifier, notifier)
+	}
+	if s.router.notifierMessages == nil {
+		s.router.notifierMessages = make(map[string]map[string]*template.Template)
+	}
+	s.router.notifierMessages[notifier] = parsed
+	return nil
+}
+
+func parseMessages(t MessageTemplates) (map[string]*template.Template, error) {
+	if len(t) == 0 {
+		return nil, nil
+	}
+	parsed := make(map[string]*template.Template, len(t))
+	for severity, text := range t {
+		tmpl, err := template.New(severity).Funcs(messageFuncs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidMessageTemplate, severity, err)
+		}
+		parsed[severity] = tmpl
+	}
+	return parsed, nil
+}
+
+func mustParseMessages(t MessageTemplates) map[string]*template.Template {
+	parsed, err := parseMessages(t)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// message returns the message of the notification for the notifier, a template that fails is
+// logged and the built in message is used instead
+func (s *Scout) message(notifier string, n Notification) string {
+	s.router.mux.Lock()
+	tmpl := messageTemplate(s.router.notifierMessages[notifier], n.Severity)
+	if tmpl == nil {
+		tmpl = messageTemplate(s.router.messages, n.Severity)
+	}
+	s.router.mux.Unlock()
+
+	data := s.messageData(n)
+	var b bytes.Buffer
+	if tmpl != nil {
+		err := tmpl.Execute(&b, data)
+		if err == nil {
+			return b.String()
+		}
+		s.Logger.Warnf("Message template of notifier %s failed for %s, %v", notifier, n.Name, err)
+		b.Reset()
+	}
+	if err := messageTemplate(defaultMessages, n.Severity).Execute(&b, data); err != nil {
+		return n.Name
+	}
+	return b.String()
+}
+
+// messageTemplate returns the template of the severity, or of the empty severity
+func messageTemplate(templates map[string]*template.Template, severity string) *template.Template {
+	if tmpl, ok := templates[severity]; ok {
+		return tmpl
+	}
+	return templates[""]
+}
+
+// messageData returns the data of the message of the notification
+func (s *Scout) messageData(n Notification) MessageData {
+	d := MessageData{Notification: n, Uptime: -1}
+	if !n.Since.IsZero() {
+		d.Duration = n.CreatedAt.Sub(n.Since)
+	}
+	serv := s.GetService(n.Service)
+	if serv == nil {
+		return d
+	}
+	st := serv.Snapshot()
+	d.Status, d.Tags = &st, serv.Tags
+	if s.timeline != nil {
+		d.Uptime = uptime(s.timeline.get(serv.ID))
+	}
+	if slo, err := s.SLOStatus(serv.ID); err == nil {
+		d.SLO = &slo
+	}
+	return d
+}
+
+// uptime returns the percentage of successful checks of the timeline, 100 without checks
+func uptime(tl Timeline) float64 {
+	var checks, failures uint64
+	for _, r := range tl.Rollups {
+		checks += r.Checks
+		failures += r.Failures
+	}
+	for _, p := range tl.Points {
+		checks++
+		if !p.Up {
+			failures++
+		}
+	}
+	if checks == 0 {
+		return 100
+	}
+	return float64(checks-failures) / float64(checks) * 100
+}
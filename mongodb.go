@@ -0,0 +1,221 @@
+package scout
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultMongoDBPort = 27017
+	// opMsg is the wire protocol opcode of OP_MSG, supported since MongoDB 3.6
+	opMsg = 2013
+)
+
+const (
+	// MongoDBPrimary is the role of the primary of a replica set
+	MongoDBPrimary = "primary"
+	// MongoDBSecondary is the role of a secondary of a replica set
+	MongoDBSecondary = "secondary"
+	// MongoDBArbiter is the role of a arbiter of a replica set
+	MongoDBArbiter = "arbiter"
+	// MongoDBStandalone is the role of a node that is not part of a replica set
+	MongoDBStandalone = "standalone"
+	// MongoDBRouter is the role of a mongos of a sharded cluster
+	MongoDBRouter = "mongos"
+	// MongoDBOther is the role of a replica set member that is neither primary, secondary nor arbiter
+	MongoDBOther = "other"
+)
+
+// mongoRequestID numbers the wire protocol messages sent by the MongoDB checks
+var mongoRequestID int32
+
+// MongoDBConfig configures the MongoDB check of a service
+type MongoDBConfig struct {
+	// ExpectedRole is the role the node has to have, one of the MongoDB roles, any role passes
+	// when it is empty
+	ExpectedRole string `json:"expectedRole"`
+}
+
+// CheckMongoDB will connect to the first host of the MongoDB URI (DSN or Address, mongodb:// or
+// mongodb+srv://), run ping and isMaster and fail when the role of the node (primary, secondary,
+// arbiter, standalone or mongos, kept in Details) is not the ExpectedRole of the MongoDB config,
+// the ping round-trip is kept as the request latency
+func (s *Service) CheckMongoDB() {
+	uri := s.secret(s.DSN)
+	if uri == "" {
+		uri = s.Address
+	}
+	ctx, cancel := context.WithTimeout(s.context(), s.Timeout.Duration())
+	defer cancel()
+	addr, tlsConfig, err := s.mongoAddress(ctx, uri)
+	if err != nil {
+		s.fail(FailureConfig, err, fmt.Sprintf("MongoDB URI Error %v", err))
+		return
+	}
+
+	t1 := time.Now()
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, s.network("tcp"), addr)
+	if err != nil {
+		s.fail(classifyError(err, false), err, fmt.Sprintf("Dial Error %v", err))
+		return
+	}
+	defer conn.Close()
+	if tlsConfig != nil {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	s.setNetworkLatency(time.Since(t1).Milliseconds())
+
+	t2 := time.Now()
+	if _, err := mongoCommand(conn, "ping"); err != nil {
+		s.fail(classifyError(err, true), err, fmt.Sprintf("MongoDB ping Error %v", err))
+		return
+	}
+	s.setRequestLatency(time.Since(t2).Milliseconds())
+
+	reply, err := mongoCommand(conn, "isMaster")
+	if err != nil {
+		s.fail(classifyError(err, true), err, fmt.Sprintf("MongoDB isMaster Error %v", err))
+		return
+	}
+	role := mongoRole(reply)
+	s.Details = map[string]string{"role": role}
+	if setName, ok := reply["setName"].(string); ok {
+		s.Details["setName"] = setName
+	}
+	if primary, ok := reply["primary"].(string); ok {
+		s.Details["primary"] = primary
+	}
+	s.setResponse(role)
+	if s.MongoDB != nil && s.MongoDB.ExpectedRole != "" && s.MongoDB.ExpectedRole != role {
+		s.fail(FailureUnhealthy, nil, fmt.Sprintf("MongoDB node is %v, expected %v", role, s.MongoDB.ExpectedRole))
+		return
+	}
+	s.Success()
+}
+
+// mongoAddress returns the host:port to dial for the URI and the TLS config when the URI
+// enables TLS, mongodb+srv URIs are resolved with the service resolver and use TLS by default
+func (s *Service) mongoAddress(ctx context.Context, uri string) (string, *tls.Config, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", nil, err
+	}
+	useTLS := false
+	var addr string
+	switch u.Scheme {
+	case "mongodb":
+		host := strings.Split(u.Host, ",")[0]
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), strconv.Itoa(defaultMongoDBPort))
+		}
+		addr = host
+	case "mongodb+srv":
+		_, srvs, err := s.resolver().LookupSRV(ctx, "mongodb", "tcp", u.Hostname())
+		if err != nil {
+			return "", nil, err
+		}
+		if len(srvs) == 0 {
+			return "", nil, fmt.Errorf("no SRV records for %v", u.Hostname())
+		}
+		addr = net.JoinHostPort(strings.TrimSuffix(srvs[0].Target, "."), strconv.Itoa(int(srvs[0].Port)))
+		useTLS = true
+	default:
+		return "", nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	q := u.Query()
+	for _, opt := range []string{"tls", "ssl"} {
+		if v := q.Get(opt); v != "" {
+			useTLS = v == "true"
+		}
+	}
+	if !useTLS {
+		return addr, nil, nil
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	return addr, &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: q.Get("tlsInsecure") == "true" || q.Get("tlsAllowInvalidCertificates") == "true",
+	}, nil
+}
+
+// mongoRole returns the role of a node from its isMaster reply
+func mongoRole(reply map[string]interface{}) string {
+	isTrue := func(key string) bool {
+		v, _ := reply[key].(bool)
+		return v
+	}
+	if msg, _ := reply["msg"].(string); msg == "isdbgrid" {
+		return MongoDBRouter
+	}
+	if _, ok := reply["setName"]; !ok {
+		return MongoDBStandalone
+	}
+	switch {
+	case isTrue("ismaster"):
+		return MongoDBPrimary
+	case isTrue("secondary"):
+		return MongoDBSecondary
+	case isTrue("arbiterOnly"):
+		return MongoDBArbiter
+	}
+	return MongoDBOther
+}
+
+// mongoCommand runs a admin command with OP_MSG and returns the reply document, replies that
+// are not ok are returned as errors
+func mongoCommand(rw io.ReadWriter, name string) (map[string]interface{}, error) {
+	doc := bsonDoc(bsonElem{name, int32(1)}, bsonElem{"$db", "admin"})
+	id := atomic.AddInt32(&mongoRequestID, 1)
+	msg := make([]byte, 16, 21+len(doc))
+	binary.LittleEndian.PutUint32(msg[4:], uint32(id))
+	binary.LittleEndian.PutUint32(msg[12:], opMsg)
+	// no flag bits, followed by a single body section (kind 0)
+	msg = append(msg, 0, 0, 0, 0, 0)
+	msg = append(msg, doc...)
+	binary.LittleEndian.PutUint32(msg, uint32(len(msg)))
+	if _, err := rw.Write(msg); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(rw, header); err != nil {
+		return nil, err
+	}
+	length := int(binary.LittleEndian.Uint32(header))
+	if length < 21 || length > 48*1024*1024 {
+		return nil, fmt.Errorf("mongodb: invalid message length %v", length)
+	}
+	body := make([]byte, length-16)
+	if _, err := io.ReadFull(rw, body); err != nil {
+		return nil, err
+	}
+	if op := binary.LittleEndian.Uint32(header[12:]); op != opMsg {
+		return nil, fmt.Errorf("mongodb: unexpected opcode %v", op)
+	}
+	if body[4] != 0 {
+		return nil, errors.New("mongodb: reply has no body section")
+	}
+	reply, err := bsonParse(body[5:])
+	if err != nil {
+		return nil, err
+	}
+	if ok, _ := reply["ok"].(float64); ok != 1 {
+		errmsg, _ := reply["errmsg"].(string)
+		return nil, fmt.Errorf("mongodb: %v failed: %v", name, errmsg)
+	}
+	return reply, nil
+}
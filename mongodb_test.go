@@ -0,0 +1,77 @@
+package scout
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBSON(t *testing.T) {
+	assert := assert.New(t)
+
+	doc, err := bsonParse(bsonDoc(bsonElem{"ok", 1.0}, bsonElem{"setName", "rs0"}, bsonElem{"ismaster", true}, bsonElem{"n", int32(3)}))
+	assert.Nil(err)
+	assert.Equal(map[string]interface{}{"ok": 1.0, "setName": "rs0", "ismaster": true, "n": int32(3)}, doc)
+
+	_, err = bsonParse([]byte{0xff, 0, 0, 0, 0})
+	assert.NotNil(err)
+}
+
+func TestCheckMongoDB(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					header := make([]byte, 16)
+					if _, err := io.ReadFull(conn, header); err != nil {
+						return
+					}
+					body := make([]byte, binary.LittleEndian.Uint32(header)-16)
+					io.ReadFull(conn, body)
+					reply := bsonDoc(bsonElem{"ok", 1.0}, bsonElem{"ismaster", false}, bsonElem{"secondary", true}, bsonElem{"setName", "rs0"})
+					msg := make([]byte, 16, 21+len(reply))
+					binary.LittleEndian.PutUint32(msg[8:], binary.LittleEndian.Uint32(header[4:]))
+					binary.LittleEndian.PutUint32(msg[12:], opMsg)
+					msg = append(append(msg, 0, 0, 0, 0, 0), reply...)
+					binary.LittleEndian.PutUint32(msg, uint32(len(msg)))
+					conn.Write(msg)
+				}
+			}()
+		}
+	}()
+
+	serv := &Service{
+		ID:      uuid.New(),
+		Name:    "MongoDB",
+		Type:    "mongodb",
+		DSN:     "mongodb://" + l.Addr().String() + "/?replicaSet=rs0",
+		MongoDB: &MongoDBConfig{ExpectedRole: MongoDBSecondary},
+		Timeout: Duration(2 * time.Second),
+		Logger:  NewSlogLogger(nil),
+	}
+	suc, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal(map[string]string{"role": MongoDBSecondary, "setName": "rs0"}, suc.Details)
+
+	serv.MongoDB.ExpectedRole = MongoDBPrimary
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal("MongoDB node is secondary, expected primary", fail.Issue)
+}
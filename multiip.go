@@ -0,0 +1,168 @@
+package scout
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// IPPolicyAll requires every resolved address to pass, it is the default IPPolicy
+	IPPolicyAll = "all"
+	// IPPolicyAny requires one resolved address to pass
+	IPPolicyAny = "any"
+	// IPPolicyQuorum requires IPQuorum resolved addresses to pass, a majority when IPQuorum is zero
+	IPPolicyQuorum = "quorum"
+)
+
+// IPResult is the outcome of checking one of the addresses a service name resolves to
+type IPResult struct {
+	IP             string `json:"ip"`
+	Online         bool   `json:"online"`
+	RequestLatency int64  `json:"requestLatency"`
+	NetworkLatency int64  `json:"networkLatency"`
+	Issue          string `json:"issue,omitempty"`
+}
+
+// checkAllIPs runs probe against every address the service resolves to and reports success
+// or failure according to IPPolicy
+func (s *Service) checkAllIPs(probe func(ip net.IP) (int64, string)) {
+	ips := s.ips()
+	if len(ips) == 0 {
+		s.IPResults = nil
+		s.fail(FailureDNS, nil, fmt.Sprintf("Could not get IP addresses for service %v", s.Address))
+		return
+	}
+	results := make([]IPResult, len(ips))
+	passed, pinged := 0, 0
+	var requestLatency, networkLatency int64
+	var issues []string
+	for i, ip := range ips {
+		res := IPResult{IP: ip.String(), NetworkLatency: -1}
+		if !s.SkipPing {
+			if pingTime, err := s.pingIP(ip); err == nil {
+				res.NetworkLatency = pingTime
+			}
+		}
+		res.RequestLatency, res.Issue = probe(ip)
+		if res.Issue == "" {
+			res.Online = true
+			passed++
+			requestLatency += res.RequestLatency
+			if res.NetworkLatency >= 0 {
+				networkLatency += res.NetworkLatency
+				pinged++
+			}
+		} else {
+			issues = append(issues, fmt.Sprintf("%s: %s", res.IP, res.Issue))
+		}
+		results[i] = res
+	}
+	s.IPResults = results
+	s.setNetworkLatency(-1)
+	if passed > 0 {
+		s.setRequestLatency(requestLatency / int64(passed))
+	}
+	if pinged > 0 {
+		s.setNetworkLatency(networkLatency / int64(pinged))
+	}
+
+	required := s.requiredIPs(len(ips))
+	if passed < required {
+		s.Failure(fmt.Sprintf("%d of %d addresses passed, policy %s requires %d: %s", passed, len(ips), s.ipPolicy(), required, strings.Join(issues, "; ")))
+		return
+	}
+	s.Success()
+}
+
+func (s *Service) ipPolicy() string {
+	switch s.IPPolicy {
+	case IPPolicyAny, IPPolicyQuorum:
+		return s.IPPolicy
+	}
+	return IPPolicyAll
+}
+
+// requiredIPs returns how many of total addresses have to pass under the service IPPolicy
+func (s *Service) requiredIPs(total int) int {
+	switch s.ipPolicy() {
+	case IPPolicyAny:
+		return 1
+	case IPPolicyQuorum:
+		if s.IPQuorum > 0 && s.IPQuorum <= total {
+			return s.IPQuorum
+		}
+		return total/2 + 1
+	}
+	return total
+}
+
+// probeNet dials the service port on ip and returns the dial latency or the issue
+func (s *Service) probeNet(ip net.IP) (int64, string) {
+	port := strconv.Itoa(s.Port)
+	if s.Port == 0 {
+		_, p, err := net.SplitHostPort(s.Address)
+		if err != nil {
+			s.classify(FailureConfig, err)
+			return 0, "no port to dial"
+		}
+		port = p
+	}
+	t1 := time.Now()
+	conn, err := s.dial(s.network(s.Type), net.JoinHostPort(ip.String(), port))
+	if err != nil {
+		s.classify(classifyError(err, false), err)
+		return 0, fmt.Sprintf("Dial Error %v", err)
+	}
+	tlsConn, err := s.startTLS(conn)
+	if err != nil {
+		conn.Close()
+		s.classify(tlsClass(err), err)
+		return 0, fmt.Sprintf("StartTLS Error %v", err)
+	}
+	conn = tlsConn
+	if issue := s.converse(conn); issue != "" {
+		conn.Close()
+		return 0, issue
+	}
+	if err := conn.Close(); err != nil {
+		s.classify(FailureProtocol, err)
+		return 0, fmt.Sprintf("%v Socket Close Error %v", strings.ToUpper(s.Type), err)
+	}
+	return time.Since(t1).Milliseconds(), ""
+}
+
+// probeHTTP sends the service request to ip and returns the request latency or the issue
+func (s *Service) probeHTTP(ip net.IP) (int64, string) {
+	u, err := url.Parse(s.Address)
+	if err != nil {
+		s.classify(FailureConfig, err)
+		return 0, fmt.Sprintf("HTTP Error %v", err)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	resolveTo := net.JoinHostPort(ip.String(), port)
+	content, res, metrics, err := s.request(s.context(), resolveTo)
+	defer metrics.release()
+	if err != nil {
+		s.classify(metrics.classifyError(err), err)
+		return 0, fmt.Sprintf("HTTP Error %v", err)
+	}
+	s.setResponse(metrics.response(content))
+	s.setStatusCode(res.StatusCode)
+	if issue := s.verifyHTTP(content, res, metrics); issue != "" {
+		return metrics.RequestLatency(), issue
+	}
+	if issue := s.validateCache(res, resolveTo); issue != "" {
+		return metrics.RequestLatency(), issue
+	}
+	return metrics.RequestLatency(), ""
+}
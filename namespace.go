@@ -0,0 +1,126 @@
+package scout
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"sort"
+)
+
+// Role is what a principal may do with the services it sees, every role may do what the roles
+// below it may
+type Role string
+
+const (
+	// RoleViewer reads the services, their results and timelines
+	RoleViewer Role = "viewer"
+	// RoleOperator also checks services now, pauses, resumes and silences them, e.g. on-call
+	// engineers
+	RoleOperator Role = "operator"
+	// RoleAdmin also creates, updates and deletes services
+	RoleAdmin Role = "admin"
+)
+
+// rank orders the roles, a unknown role is a viewer
+func (r Role) rank() int {
+	switch r {
+	case RoleAdmin:
+		return 2
+	case RoleOperator:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Principal is who a request to a API of the scout is made by, a principal with a Namespace only
+// sees and manages the services of that namespace and a principal without a Role is a viewer
+type Principal struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Role      Role   `json:"role,omitempty"`
+}
+
+// Can reports whether the principal has the role or a higher one
+func (p Principal) Can(r Role) bool {
+	return p.Role.rank() >= r.rank()
+}
+
+// Require returns ErrForbidden unless the principal has the role or a higher one
+func (p Principal) Require(r Role) error {
+	if !p.Can(r) {
+		return fmt.Errorf("%w: %s is not a %s", ErrForbidden, p.Name, r)
+	}
+	return nil
+}
+
+// Allowed reports whether the principal can see and manage the service
+func (p Principal) Allowed(serv *Service) bool {
+	return p.Namespace == "" || serv.Namespace == p.Namespace
+}
+
+// Scope sets the namespace of a service created or updated by the principal, it fails when a
+// principal with a namespace puts the service in another one
+func (p Principal) Scope(serv *Service) error {
+	if p.Namespace == "" {
+		return nil
+	}
+	if serv.Namespace != "" && serv.Namespace != p.Namespace {
+		return fmt.Errorf("%w: %s can not manage services of namespace %s", ErrForbidden, p.Name, serv.Namespace)
+	}
+	serv.Namespace = p.Namespace
+	return nil
+}
+
+// Authenticator returns the principal of the bearer token of a API request, it fails with
+// ErrUnauthenticated when the token is not valid
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (Principal, error)
+}
+
+// Tokens authenticates static bearer tokens, each token is the principal it maps to, e.g. a token
+// per team scoped to the namespace of the team with the role of the team
+type Tokens map[string]Principal
+
+// Authenticate returns the principal of the token, comparing the tokens in constant time
+func (t Tokens) Authenticate(ctx context.Context, token string) (Principal, error) {
+	var p Principal
+	found := 0
+	for tok, principal := range t {
+		if subtle.ConstantTimeCompare([]byte(tok), []byte(token)) == 1 {
+			p, found = principal, 1
+		}
+	}
+	if found == 0 || token == "" {
+		return Principal{}, ErrUnauthenticated
+	}
+	return p, nil
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the principal of a request
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the principal of a request, the zero principal, a viewer of every
+// namespace, when ctx carries none
+func PrincipalFrom(ctx context.Context) Principal {
+	p, _ := ctx.Value(principalKey{}).(Principal)
+	return p
+}
+
+// GetServicesByNamespace returns the services of the namespace sorted by name
+func (s *Scout) GetServicesByNamespace(namespace string) []*Service {
+	s.mux.RLock()
+	var servs []*Service
+	for _, serv := range s.Services {
+		if serv.Namespace == namespace {
+			servs = append(servs, serv)
+		}
+	}
+	s.mux.RUnlock()
+	sort.Slice(servs, func(i, j int) bool { return servs[i].Name < servs[j].Name })
+	return servs
+}
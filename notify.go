@@ -0,0 +1,440 @@
+package scout
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// SeverityFailure is the severity of failed services and groups that are down
+	SeverityFailure = "failure"
+	// SeverityDegraded is the severity of degraded services and groups
+	SeverityDegraded = "degraded"
+	// SeverityRecovery is the severity of services and groups that are up again after a failure
+	// or being degraded
+	SeverityRecovery = "recovery"
+	// SeverityInfo is the severity of the other results, e.g. expired or moved services
+	SeverityInfo = "info"
+	// SeverityDigest is the severity of the digest of the notifications held while a notifier
+	// was quiet, see NotifierSchedule
+	SeverityDigest = "digest"
+	// SeverityReport is the severity of the availability reports, see ReportSchedule
+	SeverityReport = "report"
+
+	notifierQueueSize = 64
+)
+
+// Notification is sent to the notifiers of the routes matching a result
+type Notification struct {
+	Route     string    `json:"route"`
+	Severity  string    `json:"severity"`
+	Service   uuid.UUID `json:"service"`
+	Namespace string    `json:"namespace,omitempty"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Issue     string    `json:"issue,omitempty"`
+	// Message is the message of the notification rendered by the message templates of its
+	// notifier, see WithMessageTemplates
+	Message string `json:"message,omitempty"`
+	Result  Result `json:"result"`
+	// Reminder is set on repeated notifications of a ongoing failure
+	Reminder bool `json:"reminder,omitempty"`
+	// Since is when the route first notified the ongoing failure
+	Since time.Time `json:"since,omitempty"`
+	// Digest are the notifications held while the notifier was quiet, for SeverityDigest
+	Digest []Notification `json:"digest,omitempty"`
+	// Report is the availability report of SeverityReport, rendered in the Attachment
+	Report     *AvailabilityReport `json:"report,omitempty"`
+	Attachment *Attachment         `json:"attachment,omitempty"`
+	CreatedAt  time.Time           `json:"createdAt"`
+}
+
+// Notifier delivers notifications, e.g. to a pager or chat
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// NotifierFunc is a function used as a Notifier
+type NotifierFunc func(n Notification) error
+
+// Notify calls f(n)
+func (f NotifierFunc) Notify(n Notification) error { return f(n) }
+
+// WebhookNotifier posts notifications as JSON to a URL
+type WebhookNotifier struct {
+	URL     string
+	Headers http.Header
+	Client  *http.Client
+}
+
+// Notify posts n to the URL of the webhook and fails on a non 2xx response
+func (w *WebhookNotifier) Notify(n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range w.Headers {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %v", res.Status)
+	}
+	return nil
+}
+
+// Route sends the notifications of the results matching all its conditions to its notifiers,
+// a empty condition matches every result, routes are matched in order and the first matching
+// route wins unless it has Continue set. A route notifies a ongoing failure once, repeating it
+// every Reminder when set, and always sends the recovery of a failure it notified
+type Route struct {
+	Name string `json:"name"`
+	// Namespaces are the namespaces of the services to match, so each team gets the
+	// notifications of its own services
+	Namespaces []string `json:"namespaces"`
+	// Tags have to be set on the service, a empty value matches any value of the tag
+	Tags map[string]string `json:"tags"`
+	// Types are the check types to match, "group" matches group statuses
+	Types      []string `json:"types"`
+	Severities []string `json:"severities"`
+	// MinConsecutive is the number of consecutive failures before a failure is routed
+	MinConsecutive int `json:"minConsecutive"`
+	// FailureClasses are the classes of the failures to route, other results are not filtered
+	FailureClasses []FailureClass `json:"failureClasses"`
+	// IncludeSuppressed routes failures of services whose dependencies are down
+	IncludeSuppressed bool     `json:"includeSuppressed"`
+	Notifiers         []string `json:"notifiers"`
+	Continue          bool     `json:"continue"`
+	Reminder          Duration `json:"reminder"`
+}
+
+// matches reports whether the notification n of r matches the route
+func (rt Route) matches(n Notification, r Result, tags map[string]string) bool {
+	if !containsString(rt.Types, n.Type) || !containsString(rt.Severities, n.Severity) || !containsString(rt.Namespaces, n.Namespace) {
+		return false
+	}
+	for k, v := range rt.Tags {
+		tag, ok := tags[k]
+		if !ok || (v != "" && tag != v) {
+			return false
+		}
+	}
+	if fail, ok := r.(ServiceFailure); ok {
+		if fail.Suppressed && !rt.IncludeSuppressed {
+			return false
+		}
+		if fail.Consecutive < rt.MinConsecutive {
+			return false
+		}
+		if !containsClass(rt.FailureClasses, fail.Class) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsString reports whether list is empty or contains v
+func containsString(list []string, v string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, l := range list {
+		if l == v {
+			return true
+		}
+	}
+	return false
+}
+
+// containsClass reports whether list is empty or contains class
+func containsClass(list []FailureClass, class FailureClass) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, l := range list {
+		if l == class {
+			return true
+		}
+	}
+	return false
+}
+
+// router is the routing state of a scout
+type router struct {
+	mux       sync.Mutex
+	routes    []Route
+	notifiers map[string]chan Notification
+	failing   map[string]error
+	pingers   map[string]NotifierPinger
+	last      map[uuid.UUID]string
+	incidents map[incidentKey]*incident
+	// messages are the message templates of the notifiers by severity and notifierMessages
+	// their overrides by notifier
+	messages         map[string]*template.Template
+	notifierMessages map[string]map[string]*template.Template
+	schedules        map[string]*schedule
+	digests          map[string][]Notification
+}
+
+// incidentKey identifies the ongoing failure of a service or group notified by a route
+type incidentKey struct {
+	route   int
+	service uuid.UUID
+}
+
+// incident is a ongoing failure notified by a route
+type incident struct {
+	severity string
+	since    time.Time
+	notified time.Time
+}
+
+// WithNotifier adds the notifier under the name to the scout
+func WithNotifier(name string, n Notifier) Option {
+	return func(s *Scout) error {
+		s.AddNotifier(name, n)
+		return nil
+	}
+}
+
+// WithRoutes sets the notification routes of the scout
+func WithRoutes(routes ...Route) Option {
+	return func(s *Scout) error {
+		return s.SetRoutes(routes...)
+	}
+}
+
+// AddNotifier adds the notifier under the name, replacing the notifier with that name, its
+// notifications are delivered in order by a go routine of its own
+func (s *Scout) AddNotifier(name string, n Notifier) {
+	queue := make(chan Notification, notifierQueueSize)
+	go func() {
+		for note := range queue {
+			note.Message = s.message(name, note)
+			err := n.Notify(note)
+			if err != nil {
+				atomic.AddUint64(&s.notifyFailures, 1)
+				s.Logger.Warnf("Notifier %s could not send %s notification for %s, %v", name, note.Severity, note.Name, err)
+			}
+			s.router.delivered(name, queue, err)
+			atomic.AddInt64(&s.notifyPending, -1)
+		}
+	}()
+	s.router.mux.Lock()
+	if s.router.notifiers == nil {
+		s.router.notifiers = make(map[string]chan Notification)
+	}
+	if old, ok := s.router.notifiers[name]; ok {
+		close(old)
+	}
+	s.router.notifiers[name] = queue
+	delete(s.router.failing, name)
+	s.router.pingers = setPinger(s.router.pingers, name, n)
+	s.router.mux.Unlock()
+}
+
+// RemoveNotifier removes the notifier with the name after it delivered its queued notifications
+func (s *Scout) RemoveNotifier(name string) {
+	s.router.mux.Lock()
+	if queue, ok := s.router.notifiers[name]; ok {
+		close(queue)
+		delete(s.router.notifiers, name)
+		delete(s.router.failing, name)
+		delete(s.router.pingers, name)
+		delete(s.router.notifierMessages, name)
+		delete(s.router.schedules, name)
+		delete(s.router.digests, name)
+	}
+	s.router.mux.Unlock()
+}
+
+// SetRoutes replaces the notification routes of the scout, the notifiers of the routes have to
+// be added first
+func (s *Scout) SetRoutes(routes ...Route) error {
+	s.router.mux.Lock()
+	defer s.router.mux.Unlock()
+	for _, rt := range routes {
+		for _, name := range rt.Notifiers {
+			if _, ok := s.router.notifiers[name]; !ok {
+				return fmt.Errorf("%w: %s in route %s", ErrUnknownNotifier, name, rt.Name)
+			}
+		}
+	}
+	s.router.routes = append([]Route(nil), routes...)
+	s.router.incidents = nil
+	return nil
+}
+
+// notify routes r to the notifiers of the matching routes, silenced and acknowledged services
+// only notify recoveries
+func (s *Scout) notify(r Result) {
+	n := Notification{Service: r.ServiceID(), Result: r, CreatedAt: time.Now().UTC()}
+	var tags map[string]string
+	muted := false
+	switch res := r.(type) {
+	case ServiceSuccess:
+		tags, n.Issue = res.Labels, res.Degraded
+	case ServiceFailure:
+		tags, n.Issue = res.Labels, res.Issue
+	case ServiceSample:
+		if !res.Online {
+			n.Issue = res.LastIssue
+		}
+	case GroupStatus:
+		n.Name, n.Type = res.Name, "group"
+	}
+	if n.Type == "" {
+		if serv := s.GetService(n.Service); serv != nil {
+			n.Name, n.Type, n.Namespace = serv.Name, serv.Type, serv.Namespace
+			if tags == nil {
+				tags = serv.Tags
+			}
+			muted = serv.IsSilenced()
+		}
+	}
+
+	s.router.mux.Lock()
+	defer s.router.mux.Unlock()
+	s.flushDigests(n.CreatedAt)
+	if n.Severity = s.router.severity(r); n.Severity == "" {
+		return
+	}
+	for i, rt := range s.router.routes {
+		if !rt.matches(n, r, tags) {
+			continue
+		}
+		note := n
+		note.Route = rt.Name
+		if (muted && note.Severity != SeverityRecovery) || !s.router.throttle(i, rt, &note) {
+			if !rt.Continue {
+				return
+			}
+			continue
+		}
+		for _, name := range rt.Notifiers {
+			queue, ok := s.router.notifiers[name]
+			if !ok || s.held(name, note, tags) {
+				continue
+			}
+			s.enqueue(name, queue, note)
+		}
+		if !rt.Continue {
+			return
+		}
+	}
+}
+
+// enqueue queues the notification for the notifier, it is dropped when the queue is full
+func (s *Scout) enqueue(name string, queue chan Notification, note Notification) {
+	atomic.AddInt64(&s.notifyPending, 1)
+	select {
+	case queue <- note:
+	default:
+		atomic.AddInt64(&s.notifyPending, -1)
+		atomic.AddUint64(&s.notifyDropped, 1)
+		s.Logger.Warnf("Notifier %s is full, dropping %s notification for %s", name, note.Severity, note.Name)
+	}
+}
+
+// severity returns the severity of r and keeps the state of its service or group, successes
+// that are not a recovery have no severity and are not routed, it must be called with the
+// router lock held
+func (rt *router) severity(r Result) string {
+	if rt.last == nil {
+		rt.last = make(map[uuid.UUID]string)
+	}
+	id := r.ServiceID()
+	last := rt.last[id]
+	var severity, state string
+	switch res := r.(type) {
+	case ServiceFailure:
+		severity, state = SeverityFailure, SeverityFailure
+	case ServiceSuccess:
+		severity, state = "", "up"
+		if res.Degraded != "" {
+			severity, state = SeverityDegraded, SeverityDegraded
+		}
+	case ServiceSample:
+		severity, state = "", "up"
+		if !res.Online {
+			severity, state = SeverityFailure, SeverityFailure
+		}
+	case GroupStatus:
+		switch res.Status {
+		case GroupDown:
+			severity, state = SeverityFailure, SeverityFailure
+		case GroupDegraded:
+			severity, state = SeverityDegraded, SeverityDegraded
+		case GroupUp:
+			severity, state = "", "up"
+		default:
+			return ""
+		}
+	default:
+		return SeverityInfo
+	}
+	rt.last[id] = state
+	if state == "up" && (last == SeverityFailure || last == SeverityDegraded) {
+		return SeverityRecovery
+	}
+	return severity
+}
+
+// throttle reports whether the route i sends n, deduplicating repeated notifications of a
+// ongoing failure until its reminder is due and only sending recoveries of notified failures,
+// it must be called with the router lock held
+func (rt *router) throttle(i int, route Route, n *Notification) bool {
+	if n.Severity == SeverityInfo {
+		return true
+	}
+	if rt.incidents == nil {
+		rt.incidents = make(map[incidentKey]*incident)
+	}
+	key := incidentKey{route: i, service: n.Service}
+	inc, ok := rt.incidents[key]
+	if n.Severity == SeverityRecovery {
+		if !ok {
+			return false
+		}
+		delete(rt.incidents, key)
+		n.Since = inc.since
+		return true
+	}
+	if !ok {
+		rt.incidents[key] = &incident{severity: n.Severity, since: n.CreatedAt, notified: n.CreatedAt}
+		n.Since = n.CreatedAt
+		return true
+	}
+	n.Since = inc.since
+	switch {
+	case inc.severity != n.Severity:
+		inc.severity = n.Severity
+	case route.Reminder > 0 && n.CreatedAt.Sub(inc.notified) >= route.Reminder.Duration():
+		n.Reminder = true
+	default:
+		return false
+	}
+	inc.notified = n.CreatedAt
+	return true
+}
@@ -0,0 +1,375 @@
+package scout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder is a notifier keeping its notifications
+type recorder chan Notification
+
+func (r recorder) Notify(n Notification) error {
+	r <- n
+	return nil
+}
+
+// next returns the next notification or fails after a second
+func (r recorder) next(t *testing.T) Notification {
+	select {
+	case n := <-r:
+		return n
+	case <-time.After(time.Second):
+		t.Fatal("no notification")
+	}
+	return Notification{}
+}
+
+func TestRoutes(t *testing.T) {
+	assert := assert.New(t)
+
+	prod := &Service{ID: uuid.New(), Name: "Prod", Address: "prod.example", Type: "tcp", Tags: map[string]string{"env": "prod"}}
+	staging := &Service{ID: uuid.New(), Name: "Staging", Address: "staging.example", Type: "tcp", Tags: map[string]string{"env": "staging"}}
+	pager, chat := make(recorder, 10), make(recorder, 10)
+	s, err := NewScout([]*Service{prod, staging}, NewSlogLogger(nil),
+		WithNotifier("pagerduty", pager),
+		WithNotifier("slack", chat),
+		WithRoutes(
+			Route{Name: "page", Tags: map[string]string{"env": "prod"}, MinConsecutive: 2, Notifiers: []string{"pagerduty"}, Continue: true},
+			Route{Name: "chat", Notifiers: []string{"slack"}},
+		),
+	)
+	assert.Nil(err)
+	for _, serv := range s.Services {
+		serv.Responses = make(chan interface{}, 10)
+	}
+
+	staging.Failure("connection refused")
+	n := chat.next(t)
+	assert.Equal("chat", n.Route)
+	assert.Equal(SeverityFailure, n.Severity)
+	assert.Equal("Staging", n.Name)
+	assert.Equal("connection refused", n.Issue)
+
+	// the first failure of prod does not page yet but continues to chat
+	prod.Failure("connection refused")
+	assert.Equal("Prod", chat.next(t).Name)
+	prod.Failure("connection refused")
+	n = pager.next(t)
+	assert.Equal("page", n.Route)
+	assert.Equal(2, n.Result.(ServiceFailure).Consecutive)
+	// chat already notified the ongoing failure
+	time.Sleep(10 * time.Millisecond)
+	assert.Len(chat, 0)
+
+	// successes are only routed as a recovery
+	prod.Success()
+	assert.Equal(SeverityRecovery, pager.next(t).Severity)
+	assert.Equal(SeverityRecovery, chat.next(t).Severity)
+	prod.Success()
+	time.Sleep(10 * time.Millisecond)
+	assert.Len(pager, 0)
+	assert.Len(chat, 0)
+
+	// only refused connections of staging are routed to the pager
+	assert.Nil(s.SetRoutes(Route{Name: "refused", FailureClasses: []FailureClass{FailureConnectRefused}, Notifiers: []string{"pagerduty"}}))
+	staging.fail(FailureTLS, nil, "tls: handshake failure")
+	time.Sleep(10 * time.Millisecond)
+	assert.Len(pager, 0)
+	staging.fail(FailureConnectRefused, nil, "connection refused")
+	n = pager.next(t)
+	assert.Equal("refused", n.Route)
+	assert.Equal(FailureConnectRefused, n.Result.(ServiceFailure).Class)
+
+	assert.True(errors.Is(s.SetRoutes(Route{Notifiers: []string{"email"}}), ErrUnknownNotifier))
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	assert := assert.New(t)
+
+	notes := make(chan Notification, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n struct {
+			Severity string `json:"severity"`
+			Name     string `json:"name"`
+		}
+		assert.Nil(json.NewDecoder(r.Body).Decode(&n))
+		assert.Equal("s3cret", r.Header.Get("X-Token"))
+		notes <- Notification{Severity: n.Severity, Name: n.Name}
+	}))
+	defer ts.Close()
+
+	w := &WebhookNotifier{URL: ts.URL, Headers: http.Header{"X-Token": []string{"s3cret"}}}
+	assert.Nil(w.Notify(Notification{Severity: SeverityFailure, Name: "Prod", Result: ServiceFailure{Issue: "down"}}))
+	n := <-notes
+	assert.Equal(SeverityFailure, n.Severity)
+	assert.Equal("Prod", n.Name)
+}
+
+func TestThrottle(t *testing.T) {
+	assert := assert.New(t)
+
+	web := &Service{ID: uuid.New(), Name: "Web", Address: "web.example", Type: "tcp"}
+	pager := make(recorder, 10)
+	_, err := NewScout([]*Service{web}, NewSlogLogger(nil),
+		WithNotifier("pagerduty", pager),
+		WithRoutes(Route{Name: "page", Notifiers: []string{"pagerduty"}, Reminder: Duration(50 * time.Millisecond)}),
+	)
+	assert.Nil(err)
+	web.Responses = make(chan interface{}, 10)
+
+	web.Failure("connection refused")
+	first := pager.next(t)
+	assert.False(first.Reminder)
+	web.Failure("connection refused")
+	time.Sleep(10 * time.Millisecond)
+	assert.Len(pager, 0)
+
+	time.Sleep(50 * time.Millisecond)
+	web.Failure("connection refused")
+	n := pager.next(t)
+	assert.True(n.Reminder)
+	assert.Equal(first.Since, n.Since)
+
+	// a change of severity is sent right away
+	web.Degraded("slow")
+	assert.Equal(SeverityDegraded, pager.next(t).Severity)
+
+	web.Success()
+	n = pager.next(t)
+	assert.Equal(SeverityRecovery, n.Severity)
+	assert.Equal(first.Since, n.Since)
+	web.Success()
+	time.Sleep(10 * time.Millisecond)
+	assert.Len(pager, 0)
+}
+
+func TestSilence(t *testing.T) {
+	assert := assert.New(t)
+
+	web := &Service{ID: uuid.New(), Name: "Web", Address: "web.example", Type: "tcp"}
+	pager := make(recorder, 10)
+	s, err := NewScout([]*Service{web}, NewSlogLogger(nil),
+		WithNotifier("pagerduty", pager),
+		WithRoutes(Route{Name: "page", Notifiers: []string{"pagerduty"}, Reminder: Duration(time.Nanosecond)}),
+	)
+	assert.Nil(err)
+	web.Responses = make(chan interface{}, 10)
+
+	assert.True(errors.Is(s.Acknowledge(web.ID, "known"), ErrNoIncident))
+	assert.True(errors.Is(s.Silence(uuid.New(), time.Hour, "maintenance"), ErrUnknownService))
+
+	// a silenced service keeps being checked but does not notify
+	assert.Nil(s.Silence(web.ID, time.Hour, "maintenance"))
+	assert.True(web.IsSilenced())
+	web.Failure("connection refused")
+	fail := (<-web.Responses).(ServiceFailure)
+	assert.True(fail.Silenced)
+	time.Sleep(10 * time.Millisecond)
+	assert.Len(pager, 0)
+	assert.Nil(s.Unsilence(web.ID))
+
+	web.Failure("connection refused")
+	<-web.Responses
+	assert.False(pager.next(t).Reminder)
+
+	// a acknowledged failure stops its reminders until it recovers
+	assert.Nil(s.Acknowledge(web.ID, "looking into it"))
+	web.Failure("connection refused")
+	fail = (<-web.Responses).(ServiceFailure)
+	assert.True(fail.Acknowledged)
+	time.Sleep(10 * time.Millisecond)
+	assert.Len(pager, 0)
+
+	web.Success()
+	suc := (<-web.Responses).(ServiceSuccess)
+	assert.False(suc.Acknowledged)
+	assert.Equal(SeverityRecovery, pager.next(t).Severity)
+	assert.False(web.Acknowledged)
+}
+
+func TestNamespaces(t *testing.T) {
+	assert := assert.New(t)
+
+	payments := &Service{ID: uuid.New(), Name: "Payments", Address: "payments.example", Type: "tcp", Namespace: "payments"}
+	search := &Service{ID: uuid.New(), Name: "Search", Address: "search.example", Type: "tcp", Namespace: "search"}
+	pager, chat := make(recorder, 10), make(recorder, 10)
+	s, err := NewScout([]*Service{payments, search}, NewSlogLogger(nil),
+		WithNotifier("payments-pager", pager),
+		WithNotifier("search-chat", chat),
+		WithRoutes(
+			Route{Name: "payments", Namespaces: []string{"payments"}, Notifiers: []string{"payments-pager"}},
+			Route{Name: "search", Namespaces: []string{"search"}, Notifiers: []string{"search-chat"}},
+		),
+	)
+	assert.Nil(err)
+	for _, serv := range s.Services {
+		serv.Responses = make(chan interface{}, 10)
+	}
+
+	// each team is notified of its own services
+	search.Failure("connection refused")
+	n := chat.next(t)
+	assert.Equal("Search", n.Name)
+	assert.Equal("search", n.Namespace)
+	payments.Failure("connection refused")
+	assert.Equal("Payments", pager.next(t).Name)
+	time.Sleep(10 * time.Millisecond)
+	assert.Len(pager, 0)
+	assert.Len(chat, 0)
+	assert.Equal([]*Service{payments}, s.GetServicesByNamespace("payments"))
+
+	// a token scoped to a namespace only sees and manages its services
+	tokens := Tokens{"pay-token": {Name: "payments-team", Namespace: "payments"}, "admin-token": {Name: "admin", Role: RoleAdmin}}
+	p, err := tokens.Authenticate(context.Background(), "pay-token")
+	assert.Nil(err)
+	assert.True(p.Allowed(payments))
+	assert.False(p.Allowed(search))
+	serv := &Service{Name: "Ledger"}
+	assert.Nil(p.Scope(serv))
+	assert.Equal("payments", serv.Namespace)
+	assert.True(errors.Is(p.Scope(&Service{Name: "Index", Namespace: "search"}), ErrForbidden))
+	admin, err := tokens.Authenticate(context.Background(), "admin-token")
+	assert.Nil(err)
+	assert.True(admin.Allowed(search))
+	// a principal without a role only views the services
+	assert.True(p.Can(RoleViewer))
+	assert.False(p.Can(RoleOperator))
+	assert.True(errors.Is(p.Require(RoleAdmin), ErrForbidden))
+	assert.True(admin.Can(RoleOperator))
+	assert.Nil(admin.Require(RoleAdmin))
+	assert.True(Principal{Role: RoleOperator}.Can(RoleOperator))
+	assert.False(Principal{Role: RoleOperator}.Can(RoleAdmin))
+	_, err = tokens.Authenticate(context.Background(), "wrong")
+	assert.True(errors.Is(err, ErrUnauthenticated))
+	_, err = tokens.Authenticate(context.Background(), "")
+	assert.True(errors.Is(err, ErrUnauthenticated))
+	assert.Equal(p, PrincipalFrom(WithPrincipal(context.Background(), p)))
+}
+
+func TestMessageTemplates(t *testing.T) {
+	assert := assert.New(t)
+
+	serv := &Service{ID: uuid.New(), Name: "Payments", Address: "payments.example", Type: "tcp", Tags: map[string]string{"team": "billing"}}
+	pager, chat, mail := make(recorder, 10), make(recorder, 10), make(recorder, 10)
+	s, err := NewScout([]*Service{serv}, NewSlogLogger(nil),
+		WithTimeline(Retention{Raw: Duration(time.Hour), Rollup: Duration(time.Minute), Rollups: Duration(time.Hour)}),
+		WithNotifier("pagerduty", pager),
+		WithNotifier("slack", chat),
+		WithNotifier("email", mail),
+		WithRoutes(Route{Name: "all", Notifiers: []string{"pagerduty", "slack", "email"}}),
+		WithMessageTemplates(MessageTemplates{
+			SeverityFailure: `{{upper .Severity}} {{.Name}} ({{.Tags.team}}): {{.Issue}}, {{.Result.Consecutive}} in a row, uptime {{percent .Uptime}}`,
+		}),
+		WithNotifierTemplates("slack", MessageTemplates{"": `:fire: {{.Name}} {{.Severity}}{{with .Status}} {{.State}}{{end}}`}),
+	)
+	assert.Nil(err)
+	serv.Responses = make(chan interface{}, 10)
+
+	serv.Success()
+	serv.Failure("connection refused")
+	assert.Equal("FAILURE Payments (billing): connection refused, 1 in a row, uptime 50.00%", pager.next(t).Message)
+	assert.Equal(":fire: Payments failure down", chat.next(t).Message)
+	assert.Equal("FAILURE Payments (billing): connection refused, 1 in a row, uptime 50.00%", mail.next(t).Message)
+	// severities without a template get the built in message
+	serv.Success()
+	assert.Equal("Payments recovered after 0s", pager.next(t).Message)
+	assert.Equal(":fire: Payments recovery up", chat.next(t).Message)
+	mail.next(t)
+
+	assert.Nil(s.SetMessageTemplates("email", MessageTemplates{"": `{{.Result.Consecutive}}`}))
+	serv.Success()
+	serv.Failure("timeout")
+	assert.Equal("FAILURE Payments (billing): timeout, 1 in a row, uptime 60.00%", pager.next(t).Message)
+	chat.next(t)
+	assert.Equal("1", mail.next(t).Message)
+	// a template failing on the result falls back to the built in message
+	serv.Success()
+	pager.next(t)
+	chat.next(t)
+	assert.Equal("Payments recovered after 0s", mail.next(t).Message)
+
+	assert.True(errors.Is(s.SetMessageTemplates("", MessageTemplates{"": "{{.Name"}), ErrInvalidMessageTemplate))
+	assert.True(errors.Is(s.SetMessageTemplates("pager", MessageTemplates{"": "{{.Name}}"}), ErrUnknownNotifier))
+}
+
+func TestNotifierSchedule(t *testing.T) {
+	assert := assert.New(t)
+
+	// a night window of friday in Berlin
+	sched, err := parseSchedule(NotifierSchedule{Timezone: "Europe/Berlin", Quiet: []Window{{Start: "22:00", End: "07:00", Days: []string{"fri"}}}})
+	assert.Nil(err)
+	berlin := sched.loc
+	assert.True(sched.quiet(time.Date(2026, 10, 16, 23, 0, 0, 0, berlin)))
+	assert.True(sched.quiet(time.Date(2026, 10, 17, 6, 59, 0, 0, berlin)))
+	assert.True(sched.quiet(time.Date(2026, 10, 16, 21, 30, 0, 0, time.UTC)))
+	assert.False(sched.quiet(time.Date(2026, 10, 17, 7, 0, 0, 0, berlin)))
+	assert.False(sched.quiet(time.Date(2026, 10, 17, 23, 0, 0, 0, berlin)))
+	assert.False(sched.quiet(time.Date(2026, 10, 15, 23, 0, 0, 0, berlin)))
+	// office hours only
+	sched, err = parseSchedule(NotifierSchedule{Active: []Window{{Start: "09:00", End: "17:00", Days: []string{"Monday", "tue", "wed", "thu", "fri"}}}})
+	assert.Nil(err)
+	assert.False(sched.quiet(time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)))
+	assert.True(sched.quiet(time.Date(2026, 10, 15, 17, 0, 0, 0, time.UTC)))
+	assert.True(sched.quiet(time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)))
+	for _, invalid := range []NotifierSchedule{
+		{Timezone: "Mars/Olympus"},
+		{Quiet: []Window{{Start: "25:00", End: "07:00"}}},
+		{Quiet: []Window{{Start: "22:00", End: "07:00", Days: []string{"someday"}}}},
+	} {
+		_, err = parseSchedule(invalid)
+		assert.True(errors.Is(err, ErrInvalidSchedule))
+	}
+
+	// slack is quiet but for critical services and email sends a digest of the quiet time
+	now := time.Now().UTC()
+	quiet := []Window{{Start: now.Add(-time.Hour).Format("15:04"), End: now.Add(time.Hour).Format("15:04")}}
+	web := &Service{ID: uuid.New(), Name: "Web", Address: "web.example", Type: "tcp"}
+	db := &Service{ID: uuid.New(), Name: "DB", Address: "db.example", Type: "tcp", Tags: map[string]string{"critical": "true"}}
+	pager, chat, mail := make(recorder, 10), make(recorder, 10), make(recorder, 10)
+	s, err := NewScout([]*Service{web, db}, NewSlogLogger(nil),
+		WithNotifier("pagerduty", pager),
+		WithNotifier("slack", chat),
+		WithNotifier("email", mail),
+		WithRoutes(Route{Name: "all", Notifiers: []string{"pagerduty", "slack", "email"}}),
+		WithNotifierSchedule("slack", NotifierSchedule{Quiet: quiet, Except: map[string]string{"critical": ""}}),
+		WithNotifierSchedule("email", NotifierSchedule{Quiet: quiet, Digest: true}),
+	)
+	assert.Nil(err)
+	for _, serv := range s.Services {
+		serv.Responses = make(chan interface{}, 10)
+	}
+
+	web.Failure("connection refused")
+	assert.Equal("Web", pager.next(t).Name)
+	db.Failure("connection refused")
+	assert.Equal("DB", pager.next(t).Name)
+	assert.Equal("DB", chat.next(t).Name)
+	time.Sleep(10 * time.Millisecond)
+	assert.Len(chat, 0)
+	assert.Len(mail, 0)
+
+	s.FlushDigests(now)
+	time.Sleep(10 * time.Millisecond)
+	assert.Len(mail, 0)
+	s.FlushDigests(now.Add(2 * time.Hour))
+	n := mail.next(t)
+	assert.Equal(SeverityDigest, n.Severity)
+	if assert.Len(n.Digest, 2) {
+		assert.Equal("Web", n.Digest[0].Name)
+		assert.Equal("DB", n.Digest[1].Name)
+	}
+	assert.Equal("2 notifications while quiet, failure Web: connection refused, failure DB: connection refused", n.Message)
+	s.FlushDigests(now.Add(2 * time.Hour))
+	time.Sleep(10 * time.Millisecond)
+	assert.Len(mail, 0)
+
+	assert.True(errors.Is(s.SetNotifierSchedule("pager", NotifierSchedule{}), ErrUnknownNotifier))
+}
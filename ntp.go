@@ -0,0 +1,106 @@
+package scout
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultNTPPort = 123
+	// ntpEpochOffset is the number of seconds between the NTP (1900) and unix (1970) epochs
+	ntpEpochOffset = 2208988800
+)
+
+// NTPConfig configures the NTP check of a service
+type NTPConfig struct {
+	// MaxOffset is the largest offset of the local clock to the server that passes, any offset
+	// passes when it is zero
+	MaxOffset Duration `json:"maxOffset"`
+}
+
+// CheckNTP will query the NTP server of the service (SNTP, RFC 4330) and fail when the offset
+// of the local clock to the server exceeds the MaxOffset of the NTP config or the server is unsynchronized, the
+// offset, stratum and round-trip delay are kept in Details and the delay as the request latency
+func (s *Service) CheckNTP() {
+	conn, err := s.dial(s.network("udp"), s.netAddress(defaultNTPPort))
+	if err != nil {
+		s.fail(classifyError(err, false), err, fmt.Sprintf("Dial Error %v", err))
+		return
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(s.deadline()); err != nil {
+		s.fail(FailureProtocol, err, fmt.Sprintf("NTP Deadline Error %v", err))
+		return
+	}
+
+	req := make([]byte, 48)
+	// leap indicator 0, version 4, mode 3 (client)
+	req[0] = 0<<6 | 4<<3 | 3
+	t1 := time.Now()
+	binary.BigEndian.PutUint64(req[40:], ntpTime(t1))
+	if _, err := conn.Write(req); err != nil {
+		s.fail(classifyError(err, true), err, fmt.Sprintf("NTP Send Error %v", err))
+		return
+	}
+	res := make([]byte, 48)
+	n, err := conn.Read(res)
+	t4 := time.Now()
+	if err != nil {
+		s.fail(classifyError(err, true), err, fmt.Sprintf("NTP Read Error %v", err))
+		return
+	}
+	if n < 48 {
+		s.fail(FailureProtocol, nil, fmt.Sprintf("NTP response of %v bytes is too short", n))
+		return
+	}
+	if mode := res[0] & 0x07; mode != 4 {
+		s.fail(FailureProtocol, nil, fmt.Sprintf("NTP response has mode %v, expected 4 (server)", mode))
+		return
+	}
+	if binary.BigEndian.Uint64(res[24:]) != binary.BigEndian.Uint64(req[40:]) {
+		s.fail(FailureProtocol, nil, "NTP response does not answer the request sent")
+		return
+	}
+	stratum := res[1]
+	if stratum == 0 {
+		s.fail(FailureUnhealthy, nil, fmt.Sprintf("NTP server sent kiss-o'-death %q", string(res[12:16])))
+		return
+	}
+	if leap := res[0] >> 6; leap == 3 {
+		s.fail(FailureUnhealthy, nil, "NTP server clock is unsynchronized")
+		return
+	}
+
+	t2 := ntpToTime(binary.BigEndian.Uint64(res[32:]))
+	t3 := ntpToTime(binary.BigEndian.Uint64(res[40:]))
+	offset := (t2.Sub(t1) + t3.Sub(t4)) / 2
+	delay := t4.Sub(t1) - t3.Sub(t2)
+	s.setRequestLatency(delay.Milliseconds())
+	s.Details = map[string]string{
+		"offset":  offset.String(),
+		"stratum": strconv.Itoa(int(stratum)),
+		"delay":   delay.String(),
+	}
+	s.setResponse(offset.String())
+	if cfg := s.NTP; cfg != nil && cfg.MaxOffset > 0 && (offset > cfg.MaxOffset.Duration() || offset < -cfg.MaxOffset.Duration()) {
+		s.fail(FailureUnhealthy, nil, fmt.Sprintf("NTP offset %v exceeds %v", offset, cfg.MaxOffset.Duration()))
+		return
+	}
+	s.Success()
+}
+
+// ntpTime returns t as a 64 bit NTP timestamp
+func ntpTime(t time.Time) uint64 {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / 1e9
+	return secs<<32 | frac
+}
+
+// ntpToTime returns the time of a 64 bit NTP timestamp
+func ntpToTime(ts uint64) time.Time {
+	secs := int64(ts>>32) - ntpEpochOffset
+	nanos := int64((ts & 0xffffffff) * 1e9 >> 32)
+	return time.Unix(secs, nanos)
+}
@@ -0,0 +1,67 @@
+package scout
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckNTP(t *testing.T) {
+	assert := assert.New(t)
+
+	// the server clock is two seconds ahead
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go func() {
+		buf := make([]byte, 48)
+		for {
+			_, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			res := make([]byte, 48)
+			res[0] = 4<<3 | 4
+			res[1] = 2
+			copy(res[24:32], buf[40:48])
+			now := ntpTime(time.Now().Add(2 * time.Second))
+			binary.BigEndian.PutUint64(res[32:], now)
+			binary.BigEndian.PutUint64(res[40:], now)
+			pc.WriteTo(res, addr)
+		}
+	}()
+
+	addr := pc.LocalAddr().(*net.UDPAddr)
+	serv := &Service{
+		ID:      uuid.New(),
+		Name:    "NTP",
+		Type:    "ntp",
+		Address: addr.IP.String(),
+		Port:    addr.Port,
+		NTP:     &NTPConfig{MaxOffset: Duration(5 * time.Second)},
+		Timeout: Duration(2 * time.Second),
+		Logger:  NewSlogLogger(nil),
+	}
+	suc, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("2", suc.Details["stratum"])
+	offset, err := time.ParseDuration(suc.Details["offset"])
+	assert.Nil(err)
+	assert.InDelta(2*time.Second, offset, float64(100*time.Millisecond))
+
+	serv.NTP.MaxOffset = Duration(time.Second)
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Contains(fail.Issue, "exceeds 1s")
+}
+
+func TestNTPTime(t *testing.T) {
+	now := time.Unix(1700000000, 123456789)
+	assert.WithinDuration(t, now, ntpToTime(ntpTime(now)), time.Microsecond)
+}
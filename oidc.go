@@ -0,0 +1,333 @@
+package scout
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// oidcLeeway is the clock skew allowed between the provider and the scout
+	oidcLeeway = time.Minute
+	// oidcRefresh is how often at most the keys are fetched again for a unknown key ID
+	oidcRefresh = time.Minute
+)
+
+// OIDC authenticates the ID tokens of a OpenID Connect provider, e.g. the one the engineers sign
+// in to the dashboard with. The signature of a token is verified with the keys the provider
+// publishes, RS256 to RS512 and ES256 to ES512, and it must be issued by Issuer for Audience and
+// not be expired. The principal is named after the email of the user, or its subject, and gets
+// the highest role the values of its RolesClaim map to, users without one are viewers
+type OIDC struct {
+	// Issuer is the URL of the provider, its keys are discovered from
+	// Issuer/.well-known/openid-configuration
+	Issuer string `json:"issuer"`
+	// Audience is the client ID the tokens are issued for
+	Audience string `json:"audience"`
+	// RolesClaim is the claim with the groups or roles of the user, groups by default
+	RolesClaim string `json:"rolesClaim"`
+	// Roles maps the values of RolesClaim to roles, e.g. {"sre": "admin", "oncall": "operator"}
+	Roles map[string]Role `json:"roles"`
+	// NamespaceClaim is the claim with the namespace of the user, tokens without it are rejected,
+	// users see every namespace when it is not set
+	NamespaceClaim string       `json:"namespaceClaim"`
+	Client         *http.Client `json:"-"`
+
+	mux     sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+	// fetching is closed once the keys being fetched are in keys
+	fetching chan struct{}
+}
+
+// esCurves are the curves of the ES algorithms, a key on another curve does not verify them
+var esCurves = map[string]elliptic.Curve{
+	"ES256": elliptic.P256(),
+	"ES384": elliptic.P384(),
+	"ES512": elliptic.P521(),
+}
+
+// Authenticate verifies the ID token and returns the principal of its user
+func (o *OIDC) Authenticate(ctx context.Context, token string) (Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Principal{}, fmt.Errorf("%w: malformed token", ErrUnauthenticated)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Principal{}, fmt.Errorf("%w: token header: %v", ErrUnauthenticated, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: token signature: %v", ErrUnauthenticated, err)
+	}
+	key, err := o.key(ctx, header.Kid)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+	if err := verifyJWT(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Principal{}, fmt.Errorf("%w: token claims: %v", ErrUnauthenticated, err)
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != strings.TrimSuffix(o.Issuer, "/") {
+		return Principal{}, fmt.Errorf("%w: token issued by %q", ErrUnauthenticated, iss)
+	}
+	if !containsString(claimStrings(claims["aud"]), o.Audience) {
+		return Principal{}, fmt.Errorf("%w: token not issued for %s", ErrUnauthenticated, o.Audience)
+	}
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(oidcLeeway)) {
+		return Principal{}, fmt.Errorf("%w: token expired", ErrUnauthenticated)
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(oidcLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return Principal{}, fmt.Errorf("%w: token not valid yet", ErrUnauthenticated)
+	}
+
+	p := Principal{Role: RoleViewer}
+	p.Name, _ = claims["email"].(string)
+	if p.Name == "" {
+		p.Name, _ = claims["sub"].(string)
+	}
+	rolesClaim := o.RolesClaim
+	if rolesClaim == "" {
+		rolesClaim = "groups"
+	}
+	for _, v := range claimStrings(claims[rolesClaim]) {
+		if r, ok := o.Roles[v]; ok && r.rank() > p.Role.rank() {
+			p.Role = r
+		}
+	}
+	if o.NamespaceClaim != "" {
+		// a empty namespace sees every namespace, so a token without the claim is not trusted
+		if p.Namespace, _ = claims[o.NamespaceClaim].(string); p.Namespace == "" {
+			return Principal{}, fmt.Errorf("%w: token has no %s claim", ErrUnauthenticated, o.NamespaceClaim)
+		}
+	}
+	return p, nil
+}
+
+// key returns the public key with the ID, the keys are fetched again when the provider rotated
+// them, but not more than once every oidcRefresh. The keys are fetched without holding the lock,
+// lookups of unknown keys meanwhile wait for the fetch
+func (o *OIDC) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	o.mux.Lock()
+	if key, ok := o.keys[kid]; ok {
+		o.mux.Unlock()
+		return key, nil
+	}
+	fetching := o.fetching
+	if fetching == nil && time.Since(o.fetched) < oidcRefresh {
+		o.mux.Unlock()
+		return nil, fmt.Errorf("oidc: unknown key %q", kid)
+	}
+	if fetching == nil {
+		fetching = make(chan struct{})
+		o.fetching = fetching
+		o.mux.Unlock()
+		keys, err := o.fetchKeys(ctx)
+		o.mux.Lock()
+		if err == nil {
+			o.keys, o.fetched = keys, time.Now()
+		}
+		o.fetching = nil
+		close(fetching)
+		o.mux.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		o.mux.Unlock()
+		select {
+		case <-fetching:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	if key, ok := o.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("oidc: unknown key %q", kid)
+}
+
+// fetchKeys discovers the JWKS of the provider and returns its signing keys by ID
+func (o *OIDC) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	var discovery struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := o.get(ctx, strings.TrimSuffix(o.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	if discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc: %s has no jwks_uri", o.Issuer)
+	}
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := o.get(ctx, discovery.JWKSURI, &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+			e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, err1 := base64.RawURLEncoding.DecodeString(k.X)
+			y, err2 := base64.RawURLEncoding.DecodeString(k.Y)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	return keys, nil
+}
+
+func (o *OIDC) get(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// verifyJWT verifies the signature of the signed part of a token with the key
+func verifyJWT(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("oidc: unsupported algorithm %q", alg)
+	}
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	}
+	var digest []byte
+	switch hash {
+	case crypto.SHA256:
+		sum := sha256.Sum256([]byte(signed))
+		digest = sum[:]
+	case crypto.SHA384:
+		sum := sha512.Sum384([]byte(signed))
+		digest = sum[:]
+	case crypto.SHA512:
+		sum := sha512.Sum512([]byte(signed))
+		digest = sum[:]
+	}
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if digest != nil && strings.HasPrefix(alg, "RS") {
+			if err := rsa.VerifyPKCS1v15(key, hash, digest, sig); err != nil {
+				return fmt.Errorf("oidc: invalid signature")
+			}
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if curve, ok := esCurves[alg]; ok {
+			if key.Curve != curve {
+				return fmt.Errorf("oidc: %s key is not on the %s curve", alg, curve.Params().Name)
+			}
+			// the signature is r and s, each padded to the byte size of the curve
+			size := (curve.Params().BitSize + 7) / 8
+			if len(sig) != 2*size {
+				return fmt.Errorf("oidc: invalid signature")
+			}
+			r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+			if !ecdsa.Verify(key, digest, r, s) {
+				return fmt.Errorf("oidc: invalid signature")
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("oidc: unsupported algorithm %q", alg)
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// claimStrings returns the values of a claim that is a string or a list of strings
+func claimStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		strs := make([]string, 0, len(v))
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				strs = append(strs, s)
+			}
+		}
+		return strs
+	}
+	return nil
+}
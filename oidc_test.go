@@ -0,0 +1,152 @@
+package scout
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOIDC(t *testing.T) {
+	assert := assert.New(t)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(err)
+	ec384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.Nil(err)
+	b64 := base64.RawURLEncoding.EncodeToString
+	var provider *httptest.Server
+	var stall chan struct{}
+	provider = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"issuer": provider.URL, "jwks_uri": provider.URL + "/keys"})
+		case "/keys":
+			if stall != nil {
+				<-stall
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+				{"kid": "rsa", "kty": "RSA", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+				{"kid": "ec", "kty": "EC", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+				{"kid": "ec384", "kty": "EC", "crv": "P-384", "x": b64(ec384Key.X.Bytes()), "y": b64(ec384Key.Y.Bytes())},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer provider.Close()
+
+	sign := func(kid string, claims map[string]interface{}) string {
+		alg := "RS256"
+		if kid == "ec" {
+			alg = "ES256"
+		}
+		header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+		payload, _ := json.Marshal(claims)
+		signed := b64(header) + "." + b64(payload)
+		digest := sha256.Sum256([]byte(signed))
+		var sig []byte
+		if kid == "ec" {
+			r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+			assert.Nil(err)
+			sig = make([]byte, 64)
+			r.FillBytes(sig[:32])
+			s.FillBytes(sig[32:])
+		} else {
+			sig, err = rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+			assert.Nil(err)
+		}
+		return signed + "." + b64(sig)
+	}
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{"iss": provider.URL, "aud": "scout", "sub": "u1", "team": "sre", "exp": time.Now().Add(time.Hour).Unix()}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	o := &OIDC{
+		Issuer:         provider.URL,
+		Audience:       "scout",
+		Roles:          map[string]Role{"sre": RoleAdmin, "oncall": RoleOperator},
+		NamespaceClaim: "team",
+	}
+	ctx := context.Background()
+	p, err := o.Authenticate(ctx, sign("rsa", claims(map[string]interface{}{"email": "ana@example.com", "groups": []string{"dev", "oncall"}, "team": "payments"})))
+	assert.Nil(err)
+	assert.Equal(Principal{Name: "ana@example.com", Namespace: "payments", Role: RoleOperator}, p)
+	p, err = o.Authenticate(ctx, sign("ec", claims(map[string]interface{}{"aud": []string{"other", "scout"}, "groups": "sre"})))
+	assert.Nil(err)
+	assert.Equal(Principal{Name: "u1", Namespace: "sre", Role: RoleAdmin}, p)
+	p, err = o.Authenticate(ctx, sign("rsa", claims(nil)))
+	assert.Nil(err)
+	assert.Equal(RoleViewer, p.Role)
+
+	// tokens that are expired, for another client, from another issuer or tampered with fail
+	for _, token := range []string{
+		sign("rsa", claims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})),
+		sign("rsa", claims(map[string]interface{}{"aud": "other"})),
+		sign("rsa", claims(map[string]interface{}{"iss": "https://evil.example.com"})),
+		// without its namespace a user would see every namespace
+		sign("rsa", claims(map[string]interface{}{"team": nil})),
+		sign("rsa", claims(map[string]interface{}{"team": ""})),
+		sign("rsa", claims(map[string]interface{}{"team": 42})),
+		sign("unknown", claims(nil)),
+		sign("rsa", claims(nil))[:40] + "x" + sign("rsa", claims(nil))[41:],
+		"not-a-token",
+	} {
+		_, err = o.Authenticate(ctx, token)
+		assert.True(errors.Is(err, ErrUnauthenticated), token)
+	}
+
+	// ES signatures are verified with a key on the curve of the algorithm only, and must be r and
+	// s padded to the size of the curve
+	signEC := func(kid string, key *ecdsa.PrivateKey, size int) string {
+		header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": kid, "typ": "JWT"})
+		payload, _ := json.Marshal(claims(nil))
+		signed := b64(header) + "." + b64(payload)
+		digest := sha256.Sum256([]byte(signed))
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		assert.Nil(err)
+		sig := make([]byte, 2*size)
+		r.FillBytes(sig[:size])
+		s.FillBytes(sig[size:])
+		return signed + "." + b64(sig)
+	}
+	_, err = o.Authenticate(ctx, signEC("ec", ecKey, 32))
+	assert.Nil(err)
+	for _, token := range []string{signEC("ec384", ec384Key, 48), signEC("ec", ecKey, 33)} {
+		_, err = o.Authenticate(ctx, token)
+		assert.True(errors.Is(err, ErrUnauthenticated), token)
+	}
+
+	// known keys are looked up while the keys are fetched again
+	stall = make(chan struct{})
+	o.fetched = time.Time{}
+	fetched := make(chan error)
+	go func() {
+		_, err := o.Authenticate(ctx, sign("rotated", claims(nil)))
+		fetched <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	_, err = o.Authenticate(ctx, sign("rsa", claims(nil)))
+	assert.Nil(err)
+	close(stall)
+	assert.True(errors.Is(<-fetched, ErrUnauthenticated))
+}
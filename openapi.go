@@ -0,0 +1,403 @@
+package scout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// healthPath matches the paths of health endpoints, they are checked whatever the Operations
+var healthPath = regexp.MustCompile(`(?i)/(health|healthz|healthcheck|ready|readyz|readiness|live|livez|liveness|ping|status)/?$`)
+
+// OpenAPIDiscovery is a Discoverer with a http service for the safe operations of a OpenAPI 3 or
+// Swagger 2 spec, so a large API is covered without writing its checks by hand. The GET
+// operations whose required parameters have a example or default are checked, only the
+// Operations selected by operationId, tag or "GET /path" when they are set, and health endpoints
+// like /healthz always. A service expects the first 2xx status of its operation and validates
+// JSON bodies against the response schema, the other fields come from the Template and the
+// defaults of the scout, e.g. the headers that authenticate the requests
+type OpenAPIDiscovery struct {
+	// Spec is the path or http(s) url of the spec, in YAML or JSON
+	Spec string `json:"spec"`
+	// BaseURL replaces the servers of the spec, e.g. to check a staging deployment
+	BaseURL    string            `json:"baseURL"`
+	Operations []string          `json:"operations"`
+	Template   string            `json:"template"`
+	Interval   Duration          `json:"checkInterval"`
+	Tags       map[string]string `json:"tags"`
+}
+
+// Discover reads the spec and returns the services of its operations, it fails when the spec
+// can not be read so a unavailable spec does not remove the services
+func (d *OpenAPIDiscovery) Discover(ctx context.Context) ([]*Service, error) {
+	spec, err := d.read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("openapi %s: %w", d.Spec, err)
+	}
+	return d.Services(spec)
+}
+
+// read returns the spec from its file or url
+func (d *OpenAPIDiscovery) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(d.Spec, "http://") && !strings.HasPrefix(d.Spec, "https://") {
+		return ioutil.ReadFile(d.Spec)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", d.Spec, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %s", res.Status)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// Services returns the services checking the operations of the spec, a YAML or JSON OpenAPI 3
+// or Swagger 2 document
+func (d *OpenAPIDiscovery) Services(spec []byte) ([]*Service, error) {
+	j, err := yaml.YAMLToJSON(spec)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := decodeJSON(j)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("spec is not a object")
+	}
+	base, err := d.baseURL(root)
+	if err != nil {
+		return nil, err
+	}
+	selected := make(map[string]bool, len(d.Operations))
+	for _, op := range d.Operations {
+		selected[op] = true
+	}
+	info, _ := root["info"].(map[string]interface{})
+	title, _ := info["title"].(string)
+	paths, _ := root["paths"].(map[string]interface{})
+	names := make([]string, 0, len(paths))
+	for path := range paths {
+		names = append(names, path)
+	}
+	sort.Strings(names)
+
+	var servs []*Service
+	for _, path := range names {
+		item, _ := paths[path].(map[string]interface{})
+		op, ok := item["get"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		key := "GET " + path
+		id, _ := op["operationId"].(string)
+		if id == "" {
+			id = key
+		}
+		chosen := selected[id] || selected[key]
+		if tags, ok := op["tags"].([]interface{}); ok {
+			for _, tag := range tags {
+				if tag, ok := tag.(string); ok && selected[tag] {
+					chosen = true
+				}
+			}
+		}
+		health := healthPath.MatchString(path)
+		switch {
+		case len(selected) > 0 && !chosen && !health:
+			continue
+		case len(selected) == 0 && op["deprecated"] == true:
+			continue
+		}
+		address, headers, missing := openAPIRequest(root, base, path, item, op)
+		if missing != "" {
+			if chosen {
+				return nil, fmt.Errorf("operation %s: required parameter %s has no example or default", id, missing)
+			}
+			continue
+		}
+		status, schema, err := openAPIResponse(root, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %s: %w", id, err)
+		}
+		serv := &Service{
+			ExternalID:     "openapi:" + id,
+			Name:           strings.TrimSpace(title + " " + id),
+			Type:           "http",
+			Method:         "GET",
+			Address:        address,
+			Headers:        headers,
+			ExpectedStatus: status,
+			JSONSchema:     schema,
+			Template:       d.Template,
+			Interval:       d.Interval,
+			Tags:           map[string]string{"openapi": id},
+		}
+		for k, v := range d.Tags {
+			serv.Tags[k] = v
+		}
+		servs = append(servs, serv)
+	}
+	return servs, nil
+}
+
+// baseURL returns the BaseURL, the first server of a OpenAPI 3 spec with the defaults of its
+// variables or the scheme, host and basePath of a Swagger 2 spec
+func (d *OpenAPIDiscovery) baseURL(root map[string]interface{}) (string, error) {
+	base := d.BaseURL
+	if base == "" {
+		if servers, ok := root["servers"].([]interface{}); ok && len(servers) > 0 {
+			server, _ := servers[0].(map[string]interface{})
+			base, _ = server["url"].(string)
+			variables, _ := server["variables"].(map[string]interface{})
+			for name, v := range variables {
+				variable, _ := v.(map[string]interface{})
+				def, _ := variable["default"].(string)
+				base = strings.Replace(base, "{"+name+"}", def, -1)
+			}
+		} else if host, ok := root["host"].(string); ok {
+			scheme := "https"
+			if schemes, ok := root["schemes"].([]interface{}); ok && len(schemes) > 0 {
+				scheme, _ = schemes[0].(string)
+				for _, s := range schemes {
+					if s == "https" {
+						scheme = "https"
+					}
+				}
+			}
+			basePath, _ := root["basePath"].(string)
+			base = scheme + "://" + host + basePath
+		}
+	}
+	u, err := url.Parse(base)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("spec has no absolute server url %q, set a BaseURL", base)
+	}
+	return strings.TrimSuffix(base, "/"), nil
+}
+
+// openAPIRequest returns the url and headers of a request to the operation with the examples or
+// defaults of its required parameters, or the name of a required parameter without either
+func openAPIRequest(root map[string]interface{}, base, path string, item, op map[string]interface{}) (string, http.Header, string) {
+	spec := &jsonSchema{root: root}
+	params := make(map[string]map[string]interface{})
+	var order []string
+	for _, list := range []interface{}{item["parameters"], op["parameters"]} {
+		list, _ := list.([]interface{})
+		for _, p := range list {
+			param, _ := p.(map[string]interface{})
+			if ref, ok := param["$ref"].(string); ok {
+				target, _ := spec.resolve(ref)
+				param, _ = target.(map[string]interface{})
+			}
+			if param == nil {
+				continue
+			}
+			key := fmt.Sprint(param["in"], " ", param["name"])
+			if params[key] == nil {
+				order = append(order, key)
+			}
+			params[key] = param
+		}
+	}
+	query := url.Values{}
+	var headers http.Header
+	for _, key := range order {
+		param := params[key]
+		name, _ := param["name"].(string)
+		in, _ := param["in"].(string)
+		if required, _ := param["required"].(bool); !required && in != "path" {
+			continue
+		}
+		value, ok := openAPIExample(param)
+		if !ok || in == "cookie" || in == "body" || in == "formData" {
+			return "", nil, name
+		}
+		switch in {
+		case "path":
+			path = strings.Replace(path, "{"+name+"}", url.PathEscape(jsonString(value)), -1)
+		case "query":
+			query.Set(name, jsonString(value))
+		case "header":
+			if headers == nil {
+				headers = make(http.Header)
+			}
+			headers.Set(name, jsonString(value))
+		}
+	}
+	address := base + path
+	if len(query) > 0 {
+		address += "?" + query.Encode()
+	}
+	return address, headers, ""
+}
+
+// openAPIExample returns the example, default or first enum value of a parameter
+func openAPIExample(param map[string]interface{}) (interface{}, bool) {
+	schema, _ := param["schema"].(map[string]interface{})
+	for _, m := range []map[string]interface{}{param, schema} {
+		for _, key := range []string{"example", "x-example", "default"} {
+			if v, ok := m[key]; ok {
+				return v, true
+			}
+		}
+		if enum, ok := m["enum"].([]interface{}); ok && len(enum) > 0 {
+			return enum[0], true
+		}
+	}
+	if examples, ok := param["examples"].(map[string]interface{}); ok {
+		names := make([]string, 0, len(examples))
+		for name := range examples {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			example, _ := examples[name].(map[string]interface{})
+			if v, ok := example["value"]; ok {
+				return v, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// openAPIResponse returns the first 2xx status of the operation, 200 without one, and the JSON
+// Schema of its JSON body with the parts of the spec it references
+func openAPIResponse(root map[string]interface{}, op map[string]interface{}) (int, json.RawMessage, error) {
+	spec := &jsonSchema{root: root}
+	responses, _ := op["responses"].(map[string]interface{})
+	codes := make([]string, 0, len(responses))
+	for code := range responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	status := http.StatusOK
+	var res map[string]interface{}
+	for _, code := range codes {
+		if n, err := strconv.Atoi(code); err == nil && n >= 200 && n < 300 {
+			status = n
+			res, _ = responses[code].(map[string]interface{})
+			break
+		}
+		if strings.EqualFold(code, "2XX") {
+			res, _ = responses[code].(map[string]interface{})
+		}
+	}
+	if ref, ok := res["$ref"].(string); ok {
+		target, err := spec.resolve(ref)
+		if err != nil {
+			return 0, nil, err
+		}
+		res, _ = target.(map[string]interface{})
+	}
+	schema, ok := res["schema"]
+	if content, isOpenAPI3 := res["content"].(map[string]interface{}); isOpenAPI3 {
+		ok = false
+		for mediaType, c := range content {
+			if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+				media, _ := c.(map[string]interface{})
+				schema, ok = media["schema"]
+				break
+			}
+		}
+	}
+	if !ok {
+		return status, nil, nil
+	}
+
+	// the references of the schema are kept at their pointers in the spec, with the ones they
+	// make, so the schema resolves them on its own
+	doc := map[string]interface{}{"allOf": []interface{}{openAPISchema(schema)}}
+	seen := make(map[string]bool)
+	pending := schemaRefs(schema, nil)
+	for len(pending) > 0 {
+		ref := pending[0]
+		pending = pending[1:]
+		if seen[ref] || ref == "#" {
+			continue
+		}
+		seen[ref] = true
+		target, err := spec.resolve(ref)
+		if err != nil {
+			return 0, nil, err
+		}
+		setPointer(doc, strings.TrimPrefix(ref, "#/"), openAPISchema(target))
+		pending = schemaRefs(target, pending)
+	}
+	b, err := json.Marshal(doc)
+	return status, b, err
+}
+
+// schemaRefs appends the local $refs in the schema to refs
+func schemaRefs(schema interface{}, refs []string) []string {
+	switch v := schema.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["$ref"].(string); ok && strings.HasPrefix(ref, "#") {
+			refs = append(refs, ref)
+		}
+		for _, child := range v {
+			refs = schemaRefs(child, refs)
+		}
+	case []interface{}:
+		for _, child := range v {
+			refs = schemaRefs(child, refs)
+		}
+	}
+	return refs
+}
+
+// openAPISchema returns a copy of a OpenAPI schema as JSON Schema, nullable types of OpenAPI 3.0
+// and Swagger 2 extensions also allow null
+func openAPISchema(schema interface{}) interface{} {
+	switch v := schema.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			out[k] = openAPISchema(child)
+		}
+		if t, ok := v["type"].(string); ok && (v["nullable"] == true || v["x-nullable"] == true) {
+			out["type"] = []interface{}{t, "null"}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, child := range v {
+			out[i] = openAPISchema(child)
+		}
+		return out
+	}
+	return schema
+}
+
+// setPointer sets the value at the JSON pointer, without its leading #/, in doc
+func setPointer(doc map[string]interface{}, pointer string, value interface{}) {
+	tokens := strings.Split(pointer, "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	for _, token := range tokens[:len(tokens)-1] {
+		next, ok := doc[token].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			doc[token] = next
+		}
+		doc = next
+	}
+	doc[tokens[len(tokens)-1]] = value
+}
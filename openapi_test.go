@@ -0,0 +1,223 @@
+package scout
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const petstore = `
+openapi: 3.0.3
+info:
+  title: Petstore
+servers:
+  - url: https://{env}.petstore.example/v1
+    variables:
+      env:
+        default: api
+paths:
+  /healthz:
+    get:
+      responses:
+        "200":
+          description: healthy
+  /pets:
+    get:
+      operationId: listPets
+      tags: [pets]
+      parameters:
+        - name: limit
+          in: query
+          schema: {type: integer}
+        - $ref: "#/components/parameters/Version"
+      responses:
+        "200":
+          description: the pets
+          content:
+            application/json:
+              schema:
+                type: array
+                items: {$ref: "#/components/schemas/Pet"}
+    post:
+      operationId: createPet
+      responses:
+        "201":
+          description: created
+  /pets/{petId}:
+    get:
+      operationId: showPet
+      tags: [pets]
+      parameters:
+        - name: petId
+          in: path
+          required: true
+          schema: {type: integer, example: 1}
+      responses:
+        "404":
+          description: not found
+        "200":
+          $ref: "#/components/responses/Pet"
+  /owners/{ownerId}:
+    get:
+      operationId: showOwner
+      parameters:
+        - name: ownerId
+          in: path
+          required: true
+          schema: {type: string}
+      responses:
+        "200":
+          description: the owner
+  /legacy:
+    get:
+      operationId: legacy
+      deprecated: true
+      responses:
+        "204":
+          description: gone
+components:
+  parameters:
+    Version:
+      name: X-Version
+      in: header
+      required: true
+      example: "2"
+  responses:
+    Pet:
+      description: a pet
+      content:
+        application/json:
+          schema: {$ref: "#/components/schemas/Pet"}
+  schemas:
+    Pet:
+      type: object
+      required: [id, name]
+      properties:
+        id: {type: integer}
+        name: {type: string}
+        tag: {type: string, nullable: true}
+        owner: {$ref: "#/components/schemas/Owner"}
+    Owner:
+      type: object
+      properties:
+        name: {type: string}
+    Unused:
+      type: string
+`
+
+func TestOpenAPIDiscovery(t *testing.T) {
+	assert := assert.New(t)
+
+	d := &OpenAPIDiscovery{Interval: Duration(time.Minute), Tags: map[string]string{"team": "pets"}}
+	servs, err := d.Services([]byte(petstore))
+	assert.Nil(err)
+	assert.Equal(3, len(servs))
+	byID := make(map[string]*Service)
+	for _, serv := range servs {
+		byID[serv.ExternalID] = serv
+		assert.Equal("http", serv.Type)
+		assert.Equal("GET", serv.Method)
+		assert.Equal("pets", serv.Tags["team"])
+	}
+	health := byID["openapi:GET /healthz"]
+	assert.Equal("https://api.petstore.example/v1/healthz", health.Address)
+	assert.Equal("Petstore GET /healthz", health.Name)
+	assert.Equal(http.StatusOK, health.ExpectedStatus)
+	assert.Empty(health.JSONSchema)
+	list := byID["openapi:listPets"]
+	assert.Equal("https://api.petstore.example/v1/pets", list.Address)
+	assert.Equal("2", list.Headers.Get("X-Version"))
+	// the schema carries the schemas it references, but not the others
+	var schema map[string]interface{}
+	assert.Nil(json.Unmarshal(list.JSONSchema, &schema))
+	schemas := schema["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	assert.Contains(schemas, "Pet")
+	assert.Contains(schemas, "Owner")
+	assert.NotContains(schemas, "Unused")
+	show := byID["openapi:showPet"]
+	assert.Equal("https://api.petstore.example/v1/pets/1", show.Address)
+	assert.Equal(http.StatusOK, show.ExpectedStatus)
+	assert.Nil(show.Validate())
+
+	// selected operations have to be checkable, health endpoints are always checked
+	d.Operations = []string{"pets"}
+	servs, err = d.Services([]byte(petstore))
+	assert.Nil(err)
+	assert.Equal(3, len(servs))
+	d.Operations = []string{"GET /owners/{ownerId}"}
+	_, err = d.Services([]byte(petstore))
+	assert.NotNil(err)
+	assert.True(strings.Contains(err.Error(), "ownerId"))
+
+	// the generated services check the api against its contract
+	pet := `{"id": 1, "name": "rex", "tag": null, "owner": {"name": "ada"}}`
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/openapi.yaml":
+			w.Write([]byte(petstore))
+		case "/v1/pets/1":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(pet))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer api.Close()
+	d = &OpenAPIDiscovery{Spec: api.URL + "/v1/openapi.yaml", BaseURL: api.URL + "/v1/", Operations: []string{"showPet"}, Interval: Duration(time.Minute)}
+	servs, err = d.Discover(context.Background())
+	assert.Nil(err)
+	assert.Equal(2, len(servs))
+	show = servs[1]
+	assert.Equal(api.URL+"/v1/pets/1", show.Address)
+	show.SkipDNSTiming, show.Timeout, show.Logger = true, Duration(5*time.Second), NewSlogLogger(nil)
+	_, ok := checkOnce(show).(ServiceSuccess)
+	assert.True(ok)
+	pet = `{"id": 1, "name": 7, "owner": {"name": null}}`
+	fail, ok := checkOnce(show).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureSchema, fail.Class)
+	assert.Equal("HTTP Response Body has 2 JSON Schema violations: $.name: got integer, want string; $.owner.name: got null, want string", fail.Issue)
+
+	d.Spec = api.URL + "/missing.yaml"
+	_, err = d.Discover(context.Background())
+	assert.NotNil(err)
+}
+
+func TestOpenAPIDiscoverySwagger(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := `{
+		"swagger": "2.0",
+		"info": {"title": "Legacy"},
+		"host": "legacy.example",
+		"basePath": "/api",
+		"schemes": ["http", "https"],
+		"paths": {
+			"/items": {
+				"get": {
+					"operationId": "listItems",
+					"parameters": [{"name": "page", "in": "query", "required": true, "type": "integer", "default": 1}],
+					"responses": {"200": {"schema": {"type": "array", "items": {"$ref": "#/definitions/Item"}}}}
+				}
+			}
+		},
+		"definitions": {"Item": {"type": "object", "properties": {"id": {"type": "string", "x-nullable": true}}}}
+	}`
+	servs, err := (&OpenAPIDiscovery{}).Services([]byte(spec))
+	assert.Nil(err)
+	assert.Equal(1, len(servs))
+	assert.Equal("https://legacy.example/api/items?page=1", servs[0].Address)
+	schema, err := parseJSONSchema(servs[0].JSONSchema)
+	assert.Nil(err)
+	doc, _ := decodeJSON([]byte(`[{"id": null}, {"id": 2}]`))
+	assert.Equal([]string{"$[1].id: got integer, want [\"string\",\"null\"]"}, schema.validate(doc))
+
+	_, err = (&OpenAPIDiscovery{}).Services([]byte(`{"openapi": "3.0.0", "servers": [{"url": "/v1"}], "paths": {}}`))
+	assert.NotNil(err)
+}
@@ -0,0 +1,85 @@
+package scout
+
+import (
+	"fmt"
+	"time"
+)
+
+// Option configures a scout when it is created
+type Option func(*Scout) error
+
+// WithAutoAssignIDs assigns a new random UUID to services added without a ID instead of rejecting them
+func WithAutoAssignIDs() Option {
+	return func(s *Scout) error {
+		s.autoAssignIDs = true
+		return nil
+	}
+}
+
+// WithDuplicatePolicy sets what the scout does with services that check the same target, services
+// whose config only differs in their identity, schedule and reporting: DuplicateWarn, DuplicateMerge
+// or DuplicateShare. Adding a duplicate to a scout that merges fails with ErrDuplicateTarget
+func WithDuplicatePolicy(policy string) Option {
+	return func(s *Scout) error {
+		switch policy {
+		case DuplicateWarn, DuplicateMerge, DuplicateShare:
+			s.duplicatePolicy = policy
+			return nil
+		}
+		return fmt.Errorf("scout: unknown duplicate policy %q", policy)
+	}
+}
+
+// WithServices adds the services to the scout once all options are applied
+func WithServices(servs ...*Service) Option {
+	return func(s *Scout) error {
+		s.pending = append(s.pending, servs...)
+		return nil
+	}
+}
+
+// WithLogger sets the logger of the scout and of its services without a logger of their own
+func WithLogger(log Logger) Option {
+	return func(s *Scout) error {
+		if log == nil {
+			return ErrNilLogger
+		}
+		s.Logger = log
+		return nil
+	}
+}
+
+// WithResultBuffer buffers up to size results on the Response Channel so slow consumers do not
+// block the checks, the channel is unbuffered by default
+func WithResultBuffer(size int) Option {
+	return func(s *Scout) error {
+		if size < 0 {
+			return fmt.Errorf("scout: result buffer must not be negative, got %d", size)
+		}
+		s.resultBuffer = size
+		return nil
+	}
+}
+
+// WithDefaultTimeout sets the timeout of services added without one
+func WithDefaultTimeout(timeout time.Duration) Option {
+	return func(s *Scout) error {
+		if timeout <= 0 {
+			return fmt.Errorf("scout: default timeout must be positive, got %v", timeout)
+		}
+		s.defaultTimeout = Duration(timeout)
+		return nil
+	}
+}
+
+// WithConcurrencyLimit limits how many checks of the scout services run at the same time, checks
+// over the limit wait for a running check to complete
+func WithConcurrencyLimit(limit int) Option {
+	return func(s *Scout) error {
+		if limit < 1 {
+			return fmt.Errorf("scout: concurrency limit must be at least 1, got %d", limit)
+		}
+		s.checkSlots = make(chan struct{}, limit)
+		return nil
+	}
+}
@@ -0,0 +1,42 @@
+package scout
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Pause stops checking the service with the ID but keeps it in the scout, a paused service is
+// checked again after Resume
+func (s *Scout) Pause(id uuid.UUID) error {
+	serv := s.GetService(id)
+	if serv == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownService, id)
+	}
+	serv.Stop()
+	serv.checkMux.Lock()
+	serv.update(func() { serv.Paused = true })
+	serv.checkMux.Unlock()
+	s.Logger.Infof("Service %s paused", serv.Name)
+	return nil
+}
+
+// Resume checks the paused service with the ID again, its checks start right away when the scout
+// is scouting its services and with the other services otherwise
+func (s *Scout) Resume(id uuid.UUID) error {
+	serv := s.GetService(id)
+	if serv == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownService, id)
+	}
+	if serv.IsRunning() {
+		return nil
+	}
+	serv.checkMux.Lock()
+	serv.update(func() { serv.Paused = false })
+	serv.checkMux.Unlock()
+	if s.Running && serv.primary == nil && !serv.remote() && s.owns(serv) {
+		go serv.Scout()
+	}
+	s.Logger.Infof("Service %s resumed", serv.Name)
+	return nil
+}
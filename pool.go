@@ -0,0 +1,84 @@
+package scout
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+)
+
+// maxPooledBuffer bounds the capacity of the buffers kept in bufferPool, so a single large
+// response does not stay pinned in memory
+const maxPooledBuffer = 1 << 20
+
+// bufferPool holds the buffers responses are read into by the checks
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// subscriptionsPool holds the lists of subscribers a result is sent to, one is taken for every
+// result and given back once it is sent. The results themselves are not pooled as the same value
+// goes to the Response Channel, the subscribers, the notifiers and CheckNow
+var subscriptionsPool = sync.Pool{
+	New: func() interface{} { return new([]*subscription) },
+}
+
+// getBuffer takes a empty buffer from bufferPool
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer gives buf back to bufferPool, its bytes must not be used after
+func putBuffer(buf *bytes.Buffer) {
+	if buf != nil && buf.Cap() <= maxPooledBuffer {
+		bufferPool.Put(buf)
+	}
+}
+
+// readAll reads r to EOF into a pooled buffer, the caller gives it back with putBuffer once it
+// is done with its bytes
+func readAll(r io.Reader) (*bytes.Buffer, error) {
+	buf := getBuffer()
+	_, err := buf.ReadFrom(r)
+	return buf, err
+}
+
+// readLimit reads at most limit bytes of r into a pooled buffer the caller gives back with
+// putBuffer, truncated tells whether r had more. A negative limit reads all of r
+func readLimit(r io.Reader, limit int64) (buf *bytes.Buffer, truncated bool, err error) {
+	if limit < 0 {
+		buf, err = readAll(r)
+		return buf, false, err
+	}
+	buf = getBuffer()
+	// one more byte than the limit tells whether the body goes on
+	_, err = buf.ReadFrom(io.LimitReader(r, limit+1))
+	if int64(buf.Len()) > limit {
+		buf.Truncate(int(limit))
+		truncated = true
+	}
+	return buf, truncated, err
+}
+
+// errReleased is the error reading the body of a response whose contents were released
+var errReleased = errors.New("scout: response body released")
+
+// pooledBody is the body of a response read into a pooled buffer, it reads the contents until
+// the metrics of the request release the buffer
+type pooledBody struct {
+	contents *bytes.Reader
+	metrics  *HTTPRequestMetrics
+}
+
+func (b *pooledBody) Read(p []byte) (int, error) {
+	if b.metrics.body == nil {
+		return 0, errReleased
+	}
+	return b.contents.Read(p)
+}
+
+func (b *pooledBody) Close() error {
+	return nil
+}
@@ -0,0 +1,139 @@
+package scout
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// NotifierPinger is a Notifier that can report whether its destination is reachable without
+// sending a notification, it is asked by the readiness probe
+type NotifierPinger interface {
+	Ping() error
+}
+
+// probe is a named check of a health probe, err is nil when it passes
+type probe struct {
+	name string
+	err  error
+}
+
+// HealthzHandler returns a liveness probe handler, e.g. mounted at /healthz, it answers 200
+// while the scheduler is running and none of the service loops stalled, 503 otherwise
+func (s *Scout) HealthzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeProbes(w, r, s.liveness())
+	})
+}
+
+// ReadyzHandler returns a readiness probe handler, e.g. mounted at /readyz, it answers 200
+// when the scout is live and every notifier is reachable, a notifier is unreachable while its
+// last notification failed or when its Ping fails, 503 otherwise
+func (s *Scout) ReadyzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeProbes(w, r, append(s.liveness(), s.notifierProbes()...))
+	})
+}
+
+// liveness returns the probes of the scheduler
+func (s *Scout) liveness() []probe {
+	scheduler := probe{name: "scheduler"}
+	if !s.Running {
+		scheduler.err = fmt.Errorf("not running")
+	}
+	var stalled []string
+	for _, serv := range s.GetServices() {
+		if atomic.LoadInt32(&serv.stalled) == 1 {
+			stalled = append(stalled, serv.Name)
+		}
+	}
+	loops := probe{name: "loops"}
+	if len(stalled) > 0 {
+		sort.Strings(stalled)
+		loops.err = fmt.Errorf("stalled %s", strings.Join(stalled, ", "))
+	}
+	return []probe{scheduler, loops}
+}
+
+// notifierProbes returns a probe for every notifier, pinging the ones that can be pinged
+func (s *Scout) notifierProbes() []probe {
+	s.router.mux.Lock()
+	probes := make([]probe, 0, len(s.router.notifiers))
+	pingers := make(map[string]NotifierPinger, len(s.router.pingers))
+	for name := range s.router.notifiers {
+		probes = append(probes, probe{name: "notifier " + name, err: s.router.failing[name]})
+		if p, ok := s.router.pingers[name]; ok {
+			pingers[name] = p
+		}
+	}
+	s.router.mux.Unlock()
+
+	// pinging may take a while, so it is done without holding the router lock
+	for i := range probes {
+		name := strings.TrimPrefix(probes[i].name, "notifier ")
+		if p, ok := pingers[name]; ok && probes[i].err == nil {
+			probes[i].err = p.Ping()
+		}
+	}
+	sort.Slice(probes, func(i, j int) bool { return probes[i].name < probes[j].name })
+	return probes
+}
+
+// writeProbes writes one line per probe in the style of the Kubernetes probes, with a 503 status
+// when any of them failed
+func writeProbes(w http.ResponseWriter, r *http.Request, probes []probe) {
+	var b strings.Builder
+	status := http.StatusOK
+	for _, p := range probes {
+		if p.err != nil {
+			status = http.StatusServiceUnavailable
+			fmt.Fprintf(&b, "[-]%s failed: %v\n", p.name, p.err)
+			continue
+		}
+		fmt.Fprintf(&b, "[+]%s ok\n", p.name)
+	}
+	if status == http.StatusOK {
+		b.WriteString("ok\n")
+	} else {
+		b.WriteString("failed\n")
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		fmt.Fprint(w, b.String())
+	}
+}
+
+// delivered records whether the last notification of the notifier queue failed, a queue of a
+// notifier that was replaced or removed is ignored
+func (rt *router) delivered(name string, queue chan Notification, err error) {
+	rt.mux.Lock()
+	defer rt.mux.Unlock()
+	if rt.notifiers[name] != queue {
+		return
+	}
+	if err == nil {
+		delete(rt.failing, name)
+		return
+	}
+	if rt.failing == nil {
+		rt.failing = make(map[string]error)
+	}
+	rt.failing[name] = err
+}
+
+// setPinger keeps n under the name when it can be pinged, it must be called with the router
+// lock held
+func setPinger(pingers map[string]NotifierPinger, name string, n Notifier) map[string]NotifierPinger {
+	delete(pingers, name)
+	if p, ok := n.(NotifierPinger); ok {
+		if pingers == nil {
+			pingers = make(map[string]NotifierPinger)
+		}
+		pingers[name] = p
+	}
+	return pingers
+}
@@ -0,0 +1,31 @@
+module github.com/phenixrizen/scout/quictransport
+
+go 1.21
+
+require (
+	github.com/phenixrizen/scout v0.0.0-20261015041124-bbdfa5df1e19
+	github.com/quic-go/quic-go v0.42.0
+)
+
+require (
+	github.com/ghodss/yaml v1.0.0 // indirect
+	github.com/go-task/slim-sprig v0.0.0-20230315185526-52ccab3ef572 // indirect
+	github.com/google/pprof v0.0.0-20210407192527-94a9f03dee38 // indirect
+	github.com/google/uuid v1.1.2 // indirect
+	github.com/kr/text v0.2.0 // indirect
+	github.com/onsi/ginkgo/v2 v2.9.5 // indirect
+	github.com/phenixrizen/go-traceroute v0.0.0-20200128013249-14f74dc421b9 // indirect
+	github.com/quic-go/qpack v0.4.0 // indirect
+	github.com/tatsushid/go-fastping v0.0.0-20160109021039-d7bb493dee3e // indirect
+	go.uber.org/mock v0.4.0 // indirect
+	golang.org/x/crypto v0.4.0 // indirect
+	golang.org/x/exp v0.0.0-20221205204356-47842c84f3db // indirect
+	golang.org/x/mod v0.11.0 // indirect
+	golang.org/x/net v0.10.0 // indirect
+	golang.org/x/sys v0.8.0 // indirect
+	golang.org/x/text v0.9.0 // indirect
+	golang.org/x/tools v0.9.1 // indirect
+	gopkg.in/yaml.v2 v2.2.8 // indirect
+)
+
+replace github.com/phenixrizen/scout => ../
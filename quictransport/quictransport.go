@@ -0,0 +1,27 @@
+// Package quictransport speaks HTTP/3 for scout with quic-go
+package quictransport
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+
+	"github.com/phenixrizen/scout"
+)
+
+// New returns a scout.HTTP3Transport whose round trippers dial the QUIC connection to the address
+// scout sends the request to, with the TLS config of the check so the handshake is timed
+func New(conf *quic.Config) scout.HTTP3Transport {
+	return func(addr string, tlsConf *tls.Config) http.RoundTripper {
+		return &http3.RoundTripper{
+			TLSClientConfig: tlsConf,
+			QuicConfig:      conf,
+			Dial: func(ctx context.Context, _ string, tlsConf *tls.Config, conf *quic.Config) (quic.EarlyConnection, error) {
+				return quic.DialAddrEarly(ctx, addr, tlsConf, conf)
+			},
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package scout
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LocationResult is the result of the check of a service from one of its agents
+type LocationResult struct {
+	Agent          string       `json:"agent"`
+	Online         bool         `json:"online"`
+	RequestLatency int64        `json:"requestLatency"`
+	NetworkLatency int64        `json:"networkLatency"`
+	Issue          string       `json:"issue,omitempty"`
+	Class          FailureClass `json:"class,omitempty"`
+	CreatedAt      time.Time    `json:"createdAt"`
+}
+
+// quorum returns how many locations have to fail for the service to be down, a majority of its
+// agents unless Quorum is set
+func (s *Service) quorum() int {
+	if s.Quorum > 0 {
+		return s.Quorum
+	}
+	return len(s.Agents)/2 + 1
+}
+
+// reportLocation records the result of a agent of a service checked from several locations, it
+// must be called with the check lock held. The service gets a single result a round, once every
+// agent reported or a agent reports again before the others, and is down when at least quorum
+// of the locations of the round failed
+func (s *Service) reportLocation(loc LocationResult) {
+	if s.round == nil {
+		s.round = make(map[string]LocationResult, len(s.Agents))
+	}
+	if _, again := s.round[loc.Agent]; again {
+		s.evaluateRound()
+	}
+	s.round[loc.Agent] = loc
+	if len(s.round) == len(s.Agents) {
+		s.evaluateRound()
+	}
+}
+
+// evaluateRound sends the result of the locations of the round and starts a new round
+func (s *Service) evaluateRound() {
+	locs := make([]LocationResult, 0, len(s.round))
+	for _, loc := range s.round {
+		locs = append(locs, loc)
+	}
+	s.round = make(map[string]LocationResult, len(s.Agents))
+	sort.Slice(locs, func(i, j int) bool { return locs[i].Agent < locs[j].Agent })
+
+	var failing []string
+	var class FailureClass
+	var latency, network int64
+	online := 0
+	for _, loc := range locs {
+		if !loc.Online {
+			if class == "" {
+				class = loc.Class
+			}
+			failing = append(failing, loc.Agent+": "+loc.Issue)
+			continue
+		}
+		latency += loc.RequestLatency
+		network += loc.NetworkLatency
+		online++
+	}
+	s.Details = map[string]string{"locations": fmt.Sprintf("%d/%d", online, len(locs))}
+	s.locations = locs
+	if len(failing) >= s.quorum() {
+		s.setNetworkLatency(-1)
+		s.fail(class, nil, fmt.Sprintf("Down from %d of %d locations: %s", len(failing), len(locs), strings.Join(failing, "; ")))
+		return
+	}
+	// the latency of the service is the mean of the locations it is up from
+	if online > 0 {
+		s.setRequestLatency(latency / int64(online))
+		s.setNetworkLatency(network / int64(online))
+	}
+	if len(failing) > 0 {
+		s.success(fmt.Sprintf("Down from %d of %d locations: %s", len(failing), len(locs), strings.Join(failing, "; ")))
+		return
+	}
+	s.success("")
+}
@@ -0,0 +1,191 @@
+package scout
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithRateLimit caps the checks of all scout services at perSecond, allowing bursts of up to
+// burst checks, checks over the limit wait for their turn before they start
+func WithRateLimit(perSecond float64, burst int) Option {
+	return func(s *Scout) error {
+		if err := validRate(perSecond, burst); err != nil {
+			return err
+		}
+		s.limits().global = newRateLimiter(perSecond, burst)
+		return nil
+	}
+}
+
+// WithHostRateLimit caps the checks against each destination host at perSecond, allowing bursts
+// of up to burst checks, so services sharing a origin or checking aggressively can not flood it
+func WithHostRateLimit(perSecond float64, burst int) Option {
+	return func(s *Scout) error {
+		if err := validRate(perSecond, burst); err != nil {
+			return err
+		}
+		l := s.limits()
+		l.hostRate, l.hostBurst = perSecond, burst
+		return nil
+	}
+}
+
+func validRate(perSecond float64, burst int) error {
+	if perSecond <= 0 || burst < 1 {
+		return fmt.Errorf("scout: rate limit must be positive with a burst of at least 1, got %v/s burst %d", perSecond, burst)
+	}
+	return nil
+}
+
+// rateLimits holds the global limiter and the limiters of the destination hosts of a scout
+type rateLimits struct {
+	global    *rateLimiter
+	hostRate  float64
+	hostBurst int
+	hosts     map[string]*rateLimiter
+	mux       sync.Mutex
+}
+
+func (s *Scout) limits() *rateLimits {
+	if s.rateLimits == nil {
+		s.rateLimits = &rateLimits{hosts: make(map[string]*rateLimiter)}
+	}
+	return s.rateLimits
+}
+
+// reserve takes a token for a check against host and returns how long the check has to wait
+// for it, the longest wait of the global and the host limiter
+func (l *rateLimits) reserve(host string, now time.Time) time.Duration {
+	var wait time.Duration
+	if l.global != nil {
+		wait = l.global.reserve(now)
+	}
+	if l.hostRate == 0 || host == "" {
+		return wait
+	}
+	host = strings.ToLower(host)
+	l.mux.Lock()
+	hl, ok := l.hosts[host]
+	if !ok {
+		hl = newRateLimiter(l.hostRate, l.hostBurst)
+		l.hosts[host] = hl
+	}
+	l.mux.Unlock()
+	if w := hl.reserve(now); w > wait {
+		wait = w
+	}
+	return wait
+}
+
+// cancel gives back the tokens reserved for a check against host that did not run
+func (l *rateLimits) cancel(host string) {
+	if l.global != nil {
+		l.global.cancel()
+	}
+	if l.hostRate == 0 || host == "" {
+		return
+	}
+	l.mux.Lock()
+	hl := l.hosts[strings.ToLower(host)]
+	l.mux.Unlock()
+	if hl != nil {
+		hl.cancel()
+	}
+}
+
+// evictHost drops the limiter of host unless one of the services still checks it, it must be
+// called with the scout lock held
+func (s *Scout) evictHost(host string) {
+	l := s.rateLimits
+	if l == nil || host == "" {
+		return
+	}
+	host = strings.ToLower(host)
+	for _, serv := range s.Services {
+		if strings.ToLower(serv.parseHost()) == host {
+			return
+		}
+	}
+	l.mux.Lock()
+	delete(l.hosts, host)
+	l.mux.Unlock()
+}
+
+// throttle waits until the rate limits of the scout allow the service to check, it returns
+// false when the service was stopped or the check aborted while it waited, the reservation is
+// then given back
+func (s *Service) throttle() bool {
+	if s.scout == nil || s.scout.rateLimits == nil || s.Type == "heartbeat" {
+		return true
+	}
+	host := s.parseHost()
+	wait := s.scout.rateLimits.reserve(host, time.Now())
+	if wait <= 0 {
+		return true
+	}
+	s.Logger.Debugf("Rate limited %s for %v", s.Name, wait)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancelMux.Lock()
+	s.checkCancel = cancel
+	s.cancelMux.Unlock()
+	defer func() {
+		s.cancelMux.Lock()
+		s.checkCancel = nil
+		s.cancelMux.Unlock()
+		cancel()
+	}()
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+	case <-s.Running:
+	}
+	s.scout.rateLimits.cancel(host)
+	return false
+}
+
+// rateLimiter is a token bucket refilling rate tokens per second up to burst, tokens are
+// reserved ahead so concurrent callers queue up instead of polling
+type rateLimiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	mux    sync.Mutex
+}
+
+func newRateLimiter(perSecond float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: perSecond, burst: float64(burst), tokens: float64(burst)}
+}
+
+// reserve takes a token and returns how long to wait until it is available
+func (l *rateLimiter) reserve(now time.Time) time.Duration {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// cancel gives back a token taken by reserve
+func (l *rateLimiter) cancel() {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.tokens++; l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
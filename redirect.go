@@ -0,0 +1,104 @@
+package scout
+
+import (
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ServiceMoved is sent on the Response Channel when a service with TrackRedirects is
+// permanently redirected to a new location, NewService is the follow-up service checking it
+type ServiceMoved struct {
+	Service    uuid.UUID `json:"service"`
+	From       string    `json:"from"`
+	To         string    `json:"to"`
+	NewService uuid.UUID `json:"newService,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// permanentRedirect returns the location the original request of res was permanently
+// (301/308) redirected to, following the chain of redirect responses back to the first one
+func permanentRedirect(res *http.Response) string {
+	req := res.Request
+	for req != nil && req.Response != nil {
+		prev := req.Response
+		if prev.Request == nil || prev.Request.Response == nil {
+			if prev.StatusCode == http.StatusMovedPermanently || prev.StatusCode == http.StatusPermanentRedirect {
+				return req.URL.String()
+			}
+			return ""
+		}
+		req = prev.Request
+	}
+	return ""
+}
+
+// moved flags the service as moved to location and creates or updates its follow-up service
+func (s *Service) moved(location string) {
+	if s.MovedTo == location {
+		return
+	}
+	s.Logger.Warnf("Service %s moved permanently from %s to %s", s.Name, s.Address, location)
+	s.MovedTo = location
+	if s.scout != nil {
+		s.MovedService = s.scout.followMove(s, location)
+	}
+	s.emit(ServiceMoved{
+		Service:    s.ID,
+		From:       s.Address,
+		To:         location,
+		NewService: s.MovedService,
+		CreatedAt:  time.Now().UTC(),
+	})
+}
+
+// followMove points the follow-up service of serv at location, creating it when serv has none.
+// A existing follow-up service is replaced by a copy at location rather than changed while its
+// check may be running
+func (s *Scout) followMove(serv *Service, location string) uuid.UUID {
+	if follow := s.GetService(serv.MovedService); follow != nil {
+		moved := follow.clone()
+		moved.ID = follow.ID
+		moved.Address = location
+		moved.CreatedAt = follow.CreatedAt
+		if err := s.UpdateService(moved); err != nil {
+			s.Logger.Warnf("Could not move follow-up service for %s, %v", serv.Name, err)
+		}
+		return follow.ID
+	}
+	follow := serv.clone()
+	follow.ID = uuid.New()
+	follow.Name = serv.Name + " (moved)"
+	follow.Address = location
+	if err := s.AddService(follow); err != nil {
+		s.Logger.Warnf("Could not add follow-up service for %s, %v", serv.Name, err)
+		return uuid.Nil
+	}
+	return follow.ID
+}
+
+// cloneExempt are the fields identifying a service, a clone gets its own
+var cloneExempt = map[string]bool{"ID": true, "ExternalID": true}
+
+// clone returns a copy of the service configuration without its identity and check state, every
+// exported field but the ones holding state is copied along with the hooks and middleware
+func (s *Service) clone() *Service {
+	c := &Service{
+		Hooks:      s.Hooks,
+		Middleware: append([]Middleware(nil), s.Middleware...),
+	}
+	src, dst := reflect.ValueOf(s).Elem(), reflect.ValueOf(c).Elem()
+	for i := 0; i < dst.NumField(); i++ {
+		f := dst.Type().Field(i)
+		if f.PkgPath != "" || f.Tag.Get("json") == "-" || stateFields[f.Name] || cloneExempt[f.Name] {
+			continue
+		}
+		if sf := src.Field(i); !sf.IsZero() {
+			dst.Field(i).Set(clone(sf))
+		}
+	}
+	c.Initialize()
+	return c
+}
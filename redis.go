@@ -0,0 +1,291 @@
+package scout
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRedisPort     = 6379
+	defaultMemcachedPort = 11211
+)
+
+// errRedisNil is returned for a nil bulk string reply, e.g. a GET of a missing key
+var errRedisNil = errors.New("redis: nil reply")
+
+// netAddress returns the host:port to dial for the service, defaultPort is used when the
+// service has no Port
+func (s *Service) netAddress(defaultPort int) string {
+	port := s.Port
+	if port == 0 {
+		port = defaultPort
+	}
+	return net.JoinHostPort(s.Address, strconv.Itoa(port))
+}
+
+// dialCache runs the DNS timing check and connects to a cache server, the connect time is
+// kept as the network latency
+func (s *Service) dialCache(defaultPort int) (net.Conn, error) {
+	if !s.SkipDNSTiming {
+		dnsLookup, err := s.DNSCheck()
+		if err != nil {
+			s.classify(FailureDNS, err)
+			return nil, fmt.Errorf("could not get IP address for %v, %v", s.Address, err)
+		}
+		s.DNSResolve = dnsLookup
+	}
+	t1 := time.Now()
+	conn, err := s.dial(s.network("tcp"), s.netAddress(defaultPort))
+	if err != nil {
+		s.classify(classifyError(err, false), err)
+		return nil, fmt.Errorf("Dial Error %v", err)
+	}
+	s.setNetworkLatency(time.Since(t1).Milliseconds())
+	if err := conn.SetDeadline(s.deadline()); err != nil {
+		conn.Close()
+		s.classify(FailureProtocol, err)
+		return nil, fmt.Errorf("Deadline Error %v", err)
+	}
+	return conn, nil
+}
+
+// RedisConfig configures the redis check of a service
+type RedisConfig struct {
+	// Key is fetched and its value matched against the Expected of the service when it is set
+	Key string `json:"key"`
+}
+
+// MemcachedConfig configures the memcached check of a service
+type MemcachedConfig struct {
+	// Key is fetched and its value matched against the Expected of the service when it is set
+	Key string `json:"key"`
+}
+
+// CheckRedis will connect to a redis server, authenticate with Password (and Username for
+// ACLs) and send a PING, when the Key of the redis config is set the key is fetched with GET and its value matched
+// against Expected, the command round-trip is kept as the request latency
+func (s *Service) CheckRedis() {
+	cfg := s.Redis
+	if cfg == nil {
+		cfg = &RedisConfig{}
+	}
+	conn, err := s.dialCache(defaultRedisPort)
+	if err != nil {
+		s.Failure(err.Error())
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	if s.Password != "" {
+		args := []string{"AUTH", s.secret(s.Password)}
+		if s.Username != "" {
+			args = []string{"AUTH", s.secret(s.Username), s.secret(s.Password)}
+		}
+		if _, err := redisCommand(conn, r, args...); err != nil {
+			s.fail(classifyError(err, true), err, fmt.Sprintf("Redis AUTH Error %v", err))
+			return
+		}
+	}
+
+	t1 := time.Now()
+	reply, err := redisCommand(conn, r, "PING")
+	if err != nil {
+		s.fail(classifyError(err, true), err, fmt.Sprintf("Redis PING Error %v", err))
+		return
+	}
+	s.setRequestLatency(time.Since(t1).Milliseconds())
+	s.setResponse(reply)
+	if reply != "PONG" {
+		s.fail(FailureProtocol, nil, fmt.Sprintf("Redis PING reply '%v' was not PONG", reply))
+		return
+	}
+
+	if cfg.Key != "" {
+		t1 = time.Now()
+		value, err := redisCommand(conn, r, "GET", cfg.Key)
+		if err == errRedisNil {
+			s.fail(FailureBodyMismatch, nil, fmt.Sprintf("Redis key '%v' does not exist", cfg.Key))
+			return
+		}
+		if err != nil {
+			s.fail(classifyError(err, true), err, fmt.Sprintf("Redis GET Error %v", err))
+			return
+		}
+		s.setRequestLatency(time.Since(t1).Milliseconds())
+		s.setResponse(value)
+		if issue := s.matchExpected("Redis key '"+cfg.Key+"'", value); issue != "" {
+			s.Failure(issue)
+			return
+		}
+	}
+	s.Success()
+}
+
+// CheckMemcached will connect to a memcached server and send a version command, when the Key of
+// the memcached config is set the key is fetched with get and its value matched against Expected, otherwise Expected is
+// matched against the stats output, the command round-trip is kept as the request latency
+func (s *Service) CheckMemcached() {
+	cfg := s.Memcached
+	if cfg == nil {
+		cfg = &MemcachedConfig{}
+	}
+	conn, err := s.dialCache(defaultMemcachedPort)
+	if err != nil {
+		s.Failure(err.Error())
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	t1 := time.Now()
+	lines, err := memcachedCommand(conn, r, "version")
+	if err != nil {
+		s.fail(classifyError(err, true), err, fmt.Sprintf("Memcached version Error %v", err))
+		return
+	}
+	s.setRequestLatency(time.Since(t1).Milliseconds())
+	s.setResponse(lines[0])
+
+	switch {
+	case cfg.Key != "":
+		t1 = time.Now()
+		lines, err := memcachedCommand(conn, r, "get "+cfg.Key)
+		if err != nil {
+			s.fail(classifyError(err, true), err, fmt.Sprintf("Memcached get Error %v", err))
+			return
+		}
+		s.setRequestLatency(time.Since(t1).Milliseconds())
+		// a hit is a VALUE line followed by the data block, a miss only the END line
+		if len(lines) < 2 {
+			s.fail(FailureBodyMismatch, nil, fmt.Sprintf("Memcached key '%v' does not exist", cfg.Key))
+			return
+		}
+		s.setResponse(lines[1])
+		if issue := s.matchExpected("Memcached key '"+cfg.Key+"'", lines[1]); issue != "" {
+			s.Failure(issue)
+			return
+		}
+	case s.Expected != "":
+		lines, err := memcachedCommand(conn, r, "stats")
+		if err != nil {
+			s.fail(classifyError(err, true), err, fmt.Sprintf("Memcached stats Error %v", err))
+			return
+		}
+		s.setResponse(strings.Join(lines, "\n"))
+		if issue := s.matchExpected("Memcached stats", s.LastResponse); issue != "" {
+			s.Failure(issue)
+			return
+		}
+	}
+	s.Success()
+}
+
+// matchExpected matches value against Expected and returns a issue when it does not match
+func (s *Service) matchExpected(what, value string) string {
+	if s.Expected == "" {
+		return ""
+	}
+	match, err := regexp.MatchString(s.Expected, value)
+	if err != nil {
+		s.Logger.Warnf("Service %v expected: %v to match %v", s.Name, value, s.Expected)
+	}
+	if !match {
+		s.classify(FailureBodyMismatch, nil)
+		return fmt.Sprintf("%v value '%v' did not match '%v'", what, value, s.Expected)
+	}
+	return ""
+}
+
+// redisCommand sends a RESP command and returns its reply, error replies are returned as errors
+func redisCommand(w io.Writer, r *bufio.Reader, args ...string) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return "", err
+	}
+	return redisReply(r)
+}
+
+// redisReply reads a RESP reply, array replies are returned with their elements joined by a
+// newline
+func redisReply(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		return "", errors.New(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", fmt.Errorf("redis: invalid bulk length %q", line[1:])
+		}
+		if n < 0 {
+			return "", errRedisNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", fmt.Errorf("redis: invalid array length %q", line[1:])
+		}
+		elems := make([]string, 0, n)
+		for i := 0; i < n; i++ {
+			elem, err := redisReply(r)
+			if err != nil && err != errRedisNil {
+				return "", err
+			}
+			elems = append(elems, elem)
+		}
+		return strings.Join(elems, "\n"), nil
+	}
+	return "", fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+// memcachedCommand sends a memcached text protocol command and returns the lines of its reply,
+// multi line replies (get, stats) are read up to their END line which is not returned
+func memcachedCommand(w io.Writer, r *bufio.Reader, cmd string) ([]string, error) {
+	if _, err := io.WriteString(w, cmd+"\r\n"); err != nil {
+		return nil, err
+	}
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "ERROR", strings.HasPrefix(line, "CLIENT_ERROR"), strings.HasPrefix(line, "SERVER_ERROR"):
+			return nil, errors.New(line)
+		case line == "END":
+			return lines, nil
+		}
+		lines = append(lines, line)
+		if strings.HasPrefix(line, "VERSION ") {
+			return lines, nil
+		}
+	}
+}
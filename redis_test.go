@@ -0,0 +1,136 @@
+package scout
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// serveLines answers each line (or RESP command) received with the reply returned by handle
+func serveLines(t *testing.T, handle func(cmd string) string) (string, int) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					line = strings.TrimRight(line, "\r\n")
+					if strings.HasPrefix(line, "*") {
+						// RESP array of bulk strings, join the arguments with spaces
+						var args []string
+						n := int(line[1] - '0')
+						for i := 0; i < n; i++ {
+							r.ReadString('\n')
+							arg, _ := r.ReadString('\n')
+							args = append(args, strings.TrimRight(arg, "\r\n"))
+						}
+						line = strings.Join(args, " ")
+					}
+					io.WriteString(conn, handle(line))
+				}
+			}()
+		}
+	}()
+	addr := l.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func TestCheckRedis(t *testing.T) {
+	assert := assert.New(t)
+
+	host, port := serveLines(t, func(cmd string) string {
+		switch cmd {
+		case "AUTH secret":
+			return "+OK\r\n"
+		case "PING":
+			return "+PONG\r\n"
+		case "GET health":
+			return "$2\r\nok\r\n"
+		case "GET missing":
+			return "$-1\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+	serv := &Service{
+		ID:       uuid.New(),
+		Name:     "Redis",
+		Type:     "redis",
+		Address:  host,
+		Port:     port,
+		Password: "secret",
+		Redis:    &RedisConfig{Key: "health"},
+		Expected: "^ok$",
+		Timeout:  Duration(2 * time.Second),
+		Logger:   NewSlogLogger(nil),
+	}
+	_, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("ok", serv.LastResponse)
+
+	serv.Redis.Key = "missing"
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Contains(fail.Issue, "does not exist")
+
+	serv.Password = "wrong"
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Contains(fail.Issue, "Redis AUTH Error ERR unknown command")
+}
+
+func TestCheckMemcached(t *testing.T) {
+	assert := assert.New(t)
+
+	host, port := serveLines(t, func(cmd string) string {
+		switch cmd {
+		case "version":
+			return "VERSION 1.6.9\r\n"
+		case "stats":
+			return "STAT pid 1\r\nSTAT curr_connections 2\r\nEND\r\n"
+		case "get health":
+			return "VALUE health 0 2\r\nok\r\nEND\r\n"
+		}
+		return "END\r\n"
+	})
+	serv := &Service{
+		ID:       uuid.New(),
+		Name:     "Memcached",
+		Type:     "memcached",
+		Address:  host,
+		Port:     port,
+		Expected: `curr_connections \d+`,
+		Timeout:  Duration(2 * time.Second),
+		Logger:   NewSlogLogger(nil),
+	}
+	_, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+
+	serv.Memcached, serv.Expected = &MemcachedConfig{Key: "health"}, "^ok$"
+	_, ok = checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("ok", serv.LastResponse)
+
+	serv.Memcached.Key = "missing"
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Contains(fail.Issue, "does not exist")
+}
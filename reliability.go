@@ -0,0 +1,136 @@
+package scout
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReliabilityStats are the incidents of a service or group over a window, derived from the
+// outages in its timeline
+type ReliabilityStats struct {
+	Incidents int `json:"incidents"`
+	// Downtime is how long the incidents lasted in the window, a ongoing incident lasts until
+	// its end
+	Downtime Duration `json:"downtime"`
+	// MTTR is the mean time to recover of the incidents that ended in the window
+	MTTR Duration `json:"mttr"`
+	// MTBF is the mean time between failures, the time up in the window by incident, zero
+	// without incidents
+	MTBF          Duration `json:"mtbf"`
+	LongestOutage Duration `json:"longestOutage"`
+}
+
+// outage is a incident of a timeline, open while it is ongoing at the end of the window
+type outage struct {
+	start, end time.Time
+	downtime   time.Duration
+	open       bool
+}
+
+// Reliability returns the availability and reliability stats of the service or group with the ID
+// from the time until the other, it fails with ErrNoTimeline unless the scout was created
+// WithTimeline
+func (s *Scout) Reliability(id uuid.UUID, from, to time.Time) (AvailabilityStat, error) {
+	if s.timeline == nil {
+		return AvailabilityStat{}, ErrNoTimeline
+	}
+	if !to.After(from) {
+		return AvailabilityStat{}, fmt.Errorf("scout: window from %s to %s is empty", from, to)
+	}
+	var name string
+	group := false
+	s.mux.RLock()
+	if serv, ok := s.Services[id]; ok {
+		name = serv.Name
+	} else if g, ok := s.groups[id]; ok {
+		name, group = g.group.Name, true
+	} else {
+		s.mux.RUnlock()
+		return AvailabilityStat{}, fmt.Errorf("%w: %s", ErrUnknownService, id)
+	}
+	s.mux.RUnlock()
+	st := availability(s.timeline.get(id), from, to)
+	st.ID, st.Name = id, name
+	if group {
+		st.Latency, st.Trend = 0, nil
+	}
+	return st, nil
+}
+
+// outages returns the incidents of the timeline from the time until the other, the runs of
+// failed checks which end with the next success. The older checks that are only kept as rollups
+// fail in runs of rollups with failures whose downtime is the share of failed checks of the
+// rollups
+func outages(tl Timeline, from, to time.Time) []outage {
+	var outs []outage
+	var cur *outage
+	// downFor is the downtime of the rollups of the current outage and down when they ended
+	var downFor time.Duration
+	var down time.Time
+	end := func(at time.Time) {
+		if cur == nil {
+			return
+		}
+		cur.end = at
+		cur.downtime = downFor + at.Sub(down)
+		outs = append(outs, *cur)
+		cur, downFor = nil, 0
+	}
+	for _, r := range tl.Rollups {
+		if r.Start.Before(from) || !r.Start.Before(to) {
+			continue
+		}
+		if r.Failures == 0 {
+			end(down)
+			continue
+		}
+		if cur == nil {
+			cur = &outage{start: r.Start}
+		}
+		downFor += time.Duration(float64(r.Width.Duration()) * float64(r.Failures) / float64(r.Checks))
+		down = r.Start.Add(r.Width.Duration())
+	}
+	for _, p := range tl.Points {
+		if p.Time.Before(from) || !p.Time.Before(to) {
+			continue
+		}
+		if p.Up {
+			end(p.Time)
+			continue
+		}
+		if cur == nil {
+			cur, down = &outage{start: p.Time}, p.Time
+		}
+	}
+	if cur != nil {
+		end(to)
+		outs[len(outs)-1].open = true
+	}
+	return outs
+}
+
+// reliability returns the stats of the outages of a window from the time until the other
+func reliability(outs []outage, from, to time.Time) ReliabilityStats {
+	st := ReliabilityStats{Incidents: len(outs)}
+	var recovered int
+	var repair time.Duration
+	for _, o := range outs {
+		st.Downtime += Duration(o.downtime)
+		if Duration(o.downtime) > st.LongestOutage {
+			st.LongestOutage = Duration(o.downtime)
+		}
+		if !o.open {
+			recovered++
+			repair += o.downtime
+		}
+	}
+	if recovered > 0 {
+		st.MTTR = Duration(repair / time.Duration(recovered))
+	}
+	if len(outs) > 0 {
+		st.MTBF = Duration((to.Sub(from) - st.Downtime.Duration()) / time.Duration(len(outs)))
+	}
+	return st
+}
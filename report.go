@@ -0,0 +1,271 @@
+package scout
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// ReportDaily reports cover the previous day from midnight
+	ReportDaily = "daily"
+	// ReportWeekly reports cover the previous week from monday
+	ReportWeekly = "weekly"
+
+	// ReportHTML, ReportMarkdown and ReportPDF are the formats reports are rendered in
+	ReportHTML     = "html"
+	ReportMarkdown = "markdown"
+	ReportPDF      = "pdf"
+)
+
+// AvailabilityReport is the availability of the services and groups of a scout over a period,
+// computed from its timeline
+type AvailabilityReport struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Uptime is the percentage of successful checks of all the services
+	Uptime   float64            `json:"uptime"`
+	Services []AvailabilityStat `json:"services"`
+	Groups   []AvailabilityStat `json:"groups,omitempty"`
+}
+
+// AvailabilityStat is the availability of a service or group over the period of a report
+type AvailabilityStat struct {
+	ID       uuid.UUID `json:"id"`
+	Name     string    `json:"name"`
+	Checks   uint64    `json:"checks"`
+	Failures uint64    `json:"failures"`
+	Uptime   float64   `json:"uptime"`
+	ReliabilityStats
+	// Latency is the mean latency of the successful checks, in milliseconds
+	Latency int64 `json:"latency"`
+	// Trend is the mean latency of the successful checks of every hour of a report over a day,
+	// or every day of a longer report
+	Trend []LatencyBucket `json:"trend,omitempty"`
+}
+
+// LatencyBucket is the mean latency of the successful checks from Start
+type LatencyBucket struct {
+	Start   time.Time `json:"start"`
+	Latency int64     `json:"latency"`
+}
+
+// Attachment is a file sent with a notification, e.g. the rendering of a report
+type Attachment struct {
+	Name        string `json:"name"`
+	ContentType string `json:"contentType"`
+	Data        []byte `json:"data"`
+}
+
+// AvailabilityReport returns the availability of the services and groups from the time until the
+// other, sorted by name, it fails with ErrNoTimeline unless the scout was created WithTimeline. A
+// member of a cluster only reports the services it checks
+func (s *Scout) AvailabilityReport(from, to time.Time) (AvailabilityReport, error) {
+	if s.timeline == nil {
+		return AvailabilityReport{}, ErrNoTimeline
+	}
+	rep := AvailabilityReport{From: from.UTC(), To: to.UTC(), Uptime: 100}
+	var checks, failures uint64
+	for _, serv := range s.GetServices() {
+		if !s.owns(serv) {
+			continue
+		}
+		st := availability(s.timeline.get(serv.ID), from, to)
+		st.ID, st.Name = serv.ID, serv.Name
+		checks += st.Checks
+		failures += st.Failures
+		rep.Services = append(rep.Services, st)
+	}
+	s.mux.RLock()
+	for id, g := range s.groups {
+		st := availability(s.timeline.get(id), from, to)
+		st.ID, st.Name, st.Latency, st.Trend = id, g.group.Name, 0, nil
+		rep.Groups = append(rep.Groups, st)
+	}
+	s.mux.RUnlock()
+	sort.Slice(rep.Services, func(i, j int) bool { return rep.Services[i].Name < rep.Services[j].Name })
+	sort.Slice(rep.Groups, func(i, j int) bool { return rep.Groups[i].Name < rep.Groups[j].Name })
+	if checks > 0 {
+		rep.Uptime = float64(checks-failures) / float64(checks) * 100
+	}
+	return rep, nil
+}
+
+// availability returns the availability of a timeline from the time until the other
+func availability(tl Timeline, from, to time.Time) AvailabilityStat {
+	st := AvailabilityStat{Uptime: 100, ReliabilityStats: reliability(outages(tl, from, to), from, to)}
+	bucket := time.Hour
+	if to.Sub(from) > 24*time.Hour {
+		bucket = 24 * time.Hour
+	}
+	trend := make(map[time.Time]*[2]int64)
+	var latency, up int64
+	add := func(at time.Time, checks, failures uint64, mean int64) {
+		st.Checks += checks
+		st.Failures += failures
+		if ok := int64(checks - failures); ok > 0 {
+			latency += mean * ok
+			up += ok
+			start := from.Add(at.Sub(from).Truncate(bucket))
+			if trend[start] == nil {
+				trend[start] = &[2]int64{}
+			}
+			trend[start][0] += mean * ok
+			trend[start][1] += ok
+		}
+	}
+	for _, r := range tl.Rollups {
+		if !r.Start.Before(from) && r.Start.Before(to) {
+			add(r.Start, r.Checks, r.Failures, r.Latency)
+		}
+	}
+	for _, p := range tl.Points {
+		if p.Time.Before(from) || !p.Time.Before(to) {
+			continue
+		}
+		if p.Up {
+			add(p.Time, 1, 0, p.Latency)
+		} else {
+			add(p.Time, 1, 1, 0)
+		}
+	}
+
+	if st.Checks > 0 {
+		st.Uptime = float64(st.Checks-st.Failures) / float64(st.Checks) * 100
+	}
+	if up > 0 {
+		st.Latency = latency / up
+	}
+	for start, b := range trend {
+		st.Trend = append(st.Trend, LatencyBucket{Start: start.UTC(), Latency: b[0] / b[1]})
+	}
+	sort.Slice(st.Trend, func(i, j int) bool { return st.Trend[i].Start.Before(st.Trend[j].Start) })
+	return st
+}
+
+// ReportSchedule sends a availability report of the services and groups to notifiers every day
+// or week, as a notification of SeverityReport with the report rendered in Format attached. The
+// reports are sent to the notifiers directly, regardless of the routes and quiet hours
+type ReportSchedule struct {
+	// Name is the name of the notifications, Availability report by default
+	Name string `json:"name"`
+	// Period is ReportDaily or ReportWeekly
+	Period string `json:"period"`
+	// Timezone is the IANA name of the time zone the days start in, UTC by default
+	Timezone string `json:"timezone"`
+	// Format is ReportHTML, ReportMarkdown or ReportPDF
+	Format    string   `json:"format"`
+	Notifiers []string `json:"notifiers"`
+}
+
+// reportJob is a ReportSchedule with its time zone
+type reportJob struct {
+	ReportSchedule
+	loc *time.Location
+}
+
+// WithReport sends the reports of the schedule while the services are scouted, the scout needs a
+// timeline and the notifiers have to be added first
+func WithReport(rs ReportSchedule) Option {
+	return func(s *Scout) error {
+		if s.timeline == nil {
+			return fmt.Errorf("%w: reports need WithTimeline", ErrInvalidReport)
+		}
+		job := &reportJob{ReportSchedule: rs, loc: time.UTC}
+		if rs.Period != ReportDaily && rs.Period != ReportWeekly {
+			return fmt.Errorf("%w: unknown period %q", ErrInvalidReport, rs.Period)
+		}
+		if !validFormat(rs.Format) {
+			return fmt.Errorf("%w: unknown format %q", ErrInvalidReport, rs.Format)
+		}
+		if rs.Timezone != "" {
+			loc, err := time.LoadLocation(rs.Timezone)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidReport, err)
+			}
+			job.loc = loc
+		}
+		s.router.mux.Lock()
+		defer s.router.mux.Unlock()
+		for _, name := range rs.Notifiers {
+			if _, ok := s.router.notifiers[name]; !ok {
+				return fmt.Errorf("%w: %s in report %s", ErrUnknownNotifier, name, rs.Name)
+			}
+		}
+		s.reports = append(s.reports, job)
+		return nil
+	}
+}
+
+// next returns the end of the report period after the time, the next midnight or monday
+func (job *reportJob) next(now time.Time) time.Time {
+	now = now.In(job.loc)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, job.loc)
+	if job.Period == ReportWeekly {
+		day = day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		return day.AddDate(0, 0, 7)
+	}
+	return day.AddDate(0, 0, 1)
+}
+
+// start returns the start of the report period ending at the time
+func (job *reportJob) start(end time.Time) time.Time {
+	if job.Period == ReportWeekly {
+		return end.AddDate(0, 0, -7)
+	}
+	return end.AddDate(0, 0, -1)
+}
+
+// SendReport sends the report of the schedule from the time until the other to its notifiers
+func (s *Scout) SendReport(rs ReportSchedule, from, to time.Time) error {
+	rep, err := s.AvailabilityReport(from, to)
+	if err != nil {
+		return err
+	}
+	data, err := rep.Render(rs.Format)
+	if err != nil {
+		return err
+	}
+	name := rs.Name
+	if name == "" {
+		name = "Availability report"
+	}
+	n := Notification{
+		Severity: SeverityReport,
+		Name:     name,
+		Report:   &rep,
+		Attachment: &Attachment{
+			Name:        fmt.Sprintf("availability-%s.%s", from.In(to.Location()).Format("2006-01-02"), formatExtensions[rs.Format]),
+			ContentType: formatTypes[rs.Format],
+			Data:        data,
+		},
+		CreatedAt: time.Now().UTC(),
+	}
+	s.router.mux.Lock()
+	defer s.router.mux.Unlock()
+	for _, notifier := range rs.Notifiers {
+		if queue, ok := s.router.notifiers[notifier]; ok {
+			s.enqueue(notifier, queue, n)
+		}
+	}
+	return nil
+}
+
+// runReport sends the reports of the job at the end of every period until stop is closed
+func (s *Scout) runReport(job *reportJob, stop chan struct{}) {
+	for {
+		end := job.next(time.Now())
+		timer := time.NewTimer(time.Until(end))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err := s.SendReport(job.ReportSchedule, job.start(end), end); err != nil {
+			s.Logger.Warnf("Could not send report %s, %v", job.Name, err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package scout
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAvailabilityReport(t *testing.T) {
+	assert := assert.New(t)
+
+	web := &Service{ID: uuid.New(), Name: "Web", Address: "web.example", Type: "tcp"}
+	db := &Service{ID: uuid.New(), Name: "DB", Address: "db.example", Type: "tcp"}
+	mail := make(recorder, 10)
+	s, err := NewScout([]*Service{web, db}, NewSlogLogger(nil),
+		WithTimeline(Retention{Raw: Duration(24 * time.Hour), Rollup: Duration(time.Hour), Rollups: Duration(30 * 24 * time.Hour)}),
+		WithNotifier("email", mail),
+	)
+	assert.Nil(err)
+	assert.Nil(s.AddGroup(&Group{ID: uuid.New(), Name: "Shop", Members: []uuid.UUID{web.ID, db.ID}}))
+
+	// web has a incident that recovered after 20 minutes and one that is still going on
+	from := time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	for _, p := range []TimelinePoint{
+		{Time: from.Add(-time.Minute)},
+		{Time: from, Up: true, Latency: 100},
+		{Time: from.Add(10 * time.Minute)},
+		{Time: from.Add(20 * time.Minute)},
+		{Time: from.Add(30 * time.Minute), Up: true, Latency: 200},
+		{Time: from.Add(time.Hour), Up: true, Latency: 300},
+		{Time: to.Add(-10 * time.Minute)},
+	} {
+		s.timeline.add(web.ID, p)
+	}
+	// the checks of db are only kept as rollups, it failed half of an hour and a whole hour
+	s.timeline.services[db.ID] = &serviceTimeline{rollups: []TimelineRollup{
+		{Start: from, Width: Duration(time.Hour), Checks: 60, Latency: 50},
+		{Start: from.Add(time.Hour), Width: Duration(time.Hour), Checks: 60, Failures: 30, Latency: 70},
+		{Start: from.Add(2 * time.Hour), Width: Duration(time.Hour), Checks: 60, Failures: 60},
+		{Start: from.Add(3 * time.Hour), Width: Duration(time.Hour), Checks: 60, Latency: 50},
+	}}
+
+	rep, err := s.AvailabilityReport(from, to)
+	assert.Nil(err)
+	assert.Len(rep.Services, 2)
+	d, w := rep.Services[0], rep.Services[1]
+	assert.Equal("Web", w.Name)
+	assert.Equal(uint64(6), w.Checks)
+	assert.Equal(50.0, w.Uptime)
+	assert.Equal(2, w.Incidents)
+	assert.Equal(Duration(30*time.Minute), w.Downtime)
+	assert.Equal(Duration(20*time.Minute), w.MTTR)
+	assert.Equal(Duration(20*time.Minute), w.LongestOutage)
+	assert.Equal(Duration(11*time.Hour+45*time.Minute), w.MTBF)
+	assert.Equal(int64(200), w.Latency)
+	assert.Equal([]LatencyBucket{{Start: from, Latency: 150}, {Start: from.Add(time.Hour), Latency: 300}}, w.Trend)
+	assert.Equal("DB", d.Name)
+	assert.Equal(62.5, d.Uptime)
+	assert.Equal(1, d.Incidents)
+	assert.Equal(Duration(90*time.Minute), d.Downtime)
+	assert.Equal(Duration(90*time.Minute), d.MTTR)
+	assert.Equal(int64(54), d.Latency)
+	assert.InDelta(62.2, rep.Uptime, 0.01)
+	assert.Len(rep.Groups, 1)
+	st, err := s.Reliability(db.ID, from, to)
+	assert.Nil(err)
+	assert.Equal(d, st)
+	_, err = s.Reliability(uuid.New(), from, to)
+	assert.True(errors.Is(err, ErrUnknownService))
+
+	// the groups are recorded with the results of their members
+	db.Responses = make(chan interface{}, 10)
+	db.Failure("connection refused")
+	rep, err = s.AvailabilityReport(time.Now().Add(-time.Minute), time.Now().Add(time.Minute))
+	assert.Nil(err)
+	assert.Equal("Shop", rep.Groups[0].Name)
+	assert.Equal(1, rep.Groups[0].Incidents)
+
+	// rendering
+	rep, _ = s.AvailabilityReport(from, to)
+	md, err := rep.Render(ReportMarkdown)
+	assert.Nil(err)
+	assert.Contains(string(md), "| Web | 50.00% | 6 | 2 | 30m0s | 20m0s | 200ms | ▁█ |")
+	html, err := rep.Render(ReportHTML)
+	assert.Nil(err)
+	assert.Contains(string(html), "<td>Web</td><td>50.00%</td>")
+	doc, err := rep.Render(ReportPDF)
+	assert.Nil(err)
+	assert.True(bytes.HasPrefix(doc, []byte("%PDF-1.4\n")))
+	assert.True(bytes.HasSuffix(doc, []byte("%%EOF\n")))
+	assert.Contains(string(doc), "150ms -> 300ms")
+	_, err = rep.Render("docx")
+	assert.True(errors.Is(err, ErrInvalidReport))
+
+	// schedules
+	for _, invalid := range []ReportSchedule{
+		{Period: "monthly", Format: ReportPDF},
+		{Period: ReportDaily, Format: "docx"},
+		{Period: ReportDaily, Format: ReportPDF, Timezone: "Mars/Olympus"},
+	} {
+		assert.True(errors.Is(WithReport(invalid)(s), ErrInvalidReport))
+	}
+	assert.True(errors.Is(WithReport(ReportSchedule{Period: ReportDaily, Format: ReportPDF, Notifiers: []string{"fax"}})(s), ErrUnknownNotifier))
+	weekly := &reportJob{ReportSchedule: ReportSchedule{Period: ReportWeekly}, loc: time.UTC}
+	end := weekly.next(time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC))
+	assert.Equal(time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), end)
+	assert.Equal(time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC), weekly.start(end))
+
+	assert.Nil(s.SendReport(ReportSchedule{Name: "Daily availability", Period: ReportDaily, Format: ReportMarkdown, Notifiers: []string{"email"}}, from, to))
+	n := mail.next(t)
+	assert.Equal(SeverityReport, n.Severity)
+	assert.Equal("availability-2026-10-14.md", n.Attachment.Name)
+	assert.Equal(md, n.Attachment.Data)
+	assert.Equal("Daily availability from 2026-10-14 00:00 to 2026-10-15 00:00, uptime 62.20%", n.Message)
+}
+
+func TestPDFPages(t *testing.T) {
+	assert := assert.New(t)
+
+	var lines []string
+	for i := 0; i < 130; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	doc := string(pdf(lines))
+	streams := regexp.MustCompile(`(?s)stream\n(.*?)\nendstream`).FindAllStringSubmatch(doc, -1)
+	assert.Len(streams, 3)
+	drawn := 0
+	for _, stream := range streams {
+		var leading, x, top int
+		_, err := fmt.Sscanf(stream[1], "BT /F1 8 Tf %d TL %d %d Td", &leading, &x, &top)
+		assert.Nil(err)
+		n := strings.Count(stream[1], ") '\n")
+		// ' moves down before it draws, the last line of a full page stays above the bottom margin
+		assert.True(top-leading*n >= 36, "the last of %d lines is drawn at y=%d", n, top-leading*n)
+		assert.Contains(stream[1], fmt.Sprintf("(line %d) '", drawn))
+		drawn += n
+	}
+	assert.Equal(len(lines), drawn)
+}
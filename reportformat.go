@@ -0,0 +1,244 @@
+package scout
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+)
+
+// formatTypes and formatExtensions are the content types and file extensions of the report formats
+var (
+	formatTypes = map[string]string{
+		ReportHTML:     "text/html; charset=utf-8",
+		ReportMarkdown: "text/markdown; charset=utf-8",
+		ReportPDF:      "application/pdf",
+	}
+	formatExtensions = map[string]string{
+		ReportHTML:     "html",
+		ReportMarkdown: "md",
+		ReportPDF:      "pdf",
+	}
+)
+
+// sparks are the bars of the latency trends, from the lowest to the highest latency
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+func validFormat(format string) bool {
+	_, ok := formatTypes[format]
+	return ok
+}
+
+// Render renders the report as ReportHTML, ReportMarkdown or ReportPDF, a unknown format fails
+// with ErrInvalidReport
+func (r AvailabilityReport) Render(format string) ([]byte, error) {
+	switch format {
+	case ReportHTML:
+		var b bytes.Buffer
+		if err := reportHTML.Execute(&b, struct {
+			AvailabilityReport
+			Period string
+		}{r, r.period()}); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	case ReportMarkdown:
+		return []byte(r.markdown()), nil
+	case ReportPDF:
+		return pdf(r.text()), nil
+	}
+	return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidReport, format)
+}
+
+// period returns the period of the report for its title
+func (r AvailabilityReport) period() string {
+	return fmt.Sprintf("%s to %s", r.From.Format("2006-01-02 15:04 MST"), r.To.Format("2006-01-02 15:04 MST"))
+}
+
+func (r AvailabilityReport) markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Availability report\n\n%s, overall uptime %.2f%%\n", r.period(), r.Uptime)
+	if len(r.Services) > 0 {
+		b.WriteString("\n## Services\n\n| Service | Uptime | Checks | Incidents | Downtime | MTTR | Latency | Trend |\n|---|---:|---:|---:|---:|---:|---:|---|\n")
+		for _, st := range r.Services {
+			fmt.Fprintf(&b, "| %s | %.2f%% | %d | %d | %s | %s | %dms | %s |\n", markdownEscape(st.Name), st.Uptime, st.Checks, st.Incidents,
+				reportDuration(st.Downtime), reportDuration(st.MTTR), st.Latency, sparkline(st.Trend))
+		}
+	}
+	if len(r.Groups) > 0 {
+		b.WriteString("\n## Groups\n\n| Group | Uptime | Incidents | Downtime | MTTR |\n|---|---:|---:|---:|---:|\n")
+		for _, st := range r.Groups {
+			fmt.Fprintf(&b, "| %s | %.2f%% | %d | %s | %s |\n", markdownEscape(st.Name), st.Uptime, st.Incidents,
+				reportDuration(st.Downtime), reportDuration(st.MTTR))
+		}
+	}
+	return b.String()
+}
+
+// text returns the report as plain text lines for the PDF, its fonts have no sparklines so the
+// trend is the latency of the first and last bucket
+func (r AvailabilityReport) text() []string {
+	lines := []string{"Availability report", r.period(), fmt.Sprintf("Overall uptime %.2f%%", r.Uptime), ""}
+	if len(r.Services) > 0 {
+		lines = append(lines, fmt.Sprintf("%-24s %8s %7s %9s %10s %10s %8s  %s", "Service", "Uptime", "Checks", "Incidents", "Downtime", "MTTR", "Latency", "Trend"))
+		for _, st := range r.Services {
+			trend := "-"
+			if n := len(st.Trend); n > 0 {
+				trend = fmt.Sprintf("%dms -> %dms", st.Trend[0].Latency, st.Trend[n-1].Latency)
+			}
+			lines = append(lines, fmt.Sprintf("%-24s %7.2f%% %7d %9d %10s %10s %6dms  %s", truncate(st.Name, 24), st.Uptime, st.Checks, st.Incidents,
+				reportDuration(st.Downtime), reportDuration(st.MTTR), st.Latency, trend))
+		}
+		lines = append(lines, "")
+	}
+	if len(r.Groups) > 0 {
+		lines = append(lines, fmt.Sprintf("%-24s %8s %9s %10s %10s", "Group", "Uptime", "Incidents", "Downtime", "MTTR"))
+		for _, st := range r.Groups {
+			lines = append(lines, fmt.Sprintf("%-24s %7.2f%% %9d %10s %10s", truncate(st.Name, 24), st.Uptime, st.Incidents,
+				reportDuration(st.Downtime), reportDuration(st.MTTR)))
+		}
+	}
+	return lines
+}
+
+var reportHTML = template.Must(template.New("report").Funcs(template.FuncMap{
+	"duration":  reportDuration,
+	"sparkline": sparkline,
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Availability report</title>
+<style>body{font-family:sans-serif}table{border-collapse:collapse}th,td{border:1px solid #ccc;padding:4px 8px;text-align:right}th:first-child,td:first-child{text-align:left}</style>
+</head><body>
+<h1>Availability report</h1>
+<p>{{.Period}}, overall uptime {{printf "%.2f" .Uptime}}%</p>
+{{with .Services}}<h2>Services</h2>
+<table><tr><th>Service</th><th>Uptime</th><th>Checks</th><th>Incidents</th><th>Downtime</th><th>MTTR</th><th>Latency</th><th>Trend</th></tr>
+{{range .}}<tr><td>{{.Name}}</td><td>{{printf "%.2f" .Uptime}}%</td><td>{{.Checks}}</td><td>{{.Incidents}}</td><td>{{duration .Downtime}}</td><td>{{duration .MTTR}}</td><td>{{.Latency}}ms</td><td>{{sparkline .Trend}}</td></tr>
+{{end}}</table>
+{{end}}{{with .Groups}}<h2>Groups</h2>
+<table><tr><th>Group</th><th>Uptime</th><th>Incidents</th><th>Downtime</th><th>MTTR</th></tr>
+{{range .}}<tr><td>{{.Name}}</td><td>{{printf "%.2f" .Uptime}}%</td><td>{{.Incidents}}</td><td>{{duration .Downtime}}</td><td>{{duration .MTTR}}</td></tr>
+{{end}}</table>
+{{end}}</body></html>
+`))
+
+// reportDuration formats a duration of a report rounded to the second
+func reportDuration(d Duration) string {
+	return d.Duration().Round(time.Second).String()
+}
+
+// sparkline returns the latency trend as bars scaled from the lowest to the highest latency
+func sparkline(trend []LatencyBucket) string {
+	if len(trend) == 0 {
+		return ""
+	}
+	min, max := trend[0].Latency, trend[0].Latency
+	for _, b := range trend {
+		if b.Latency < min {
+			min = b.Latency
+		}
+		if b.Latency > max {
+			max = b.Latency
+		}
+	}
+	var s strings.Builder
+	for _, b := range trend {
+		i := 0
+		if max > min {
+			i = int((b.Latency - min) * int64(len(sparks)-1) / (max - min))
+		}
+		s.WriteRune(sparks[i])
+	}
+	return s.String()
+}
+
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "~"
+	}
+	return s
+}
+
+// the PDF of a report is set on landscape A4 pages with a margin around the text, the ' operator
+// moves down by the leading before it draws a line
+const (
+	pdfPageWidth  = 842
+	pdfPageHeight = 595
+	pdfMargin     = 36
+	pdfLeading    = 10
+	// pdfLinesPerPage is how many lines of text fit between the top and bottom margin
+	pdfLinesPerPage = (pdfPageHeight - 2*pdfMargin) / pdfLeading
+)
+
+// pdf returns a minimal PDF of the lines in landscape A4 pages set in Courier, the characters
+// outside of Latin-1 are replaced
+func pdf(lines []string) []byte {
+	var pages [][]string
+	for len(lines) > pdfLinesPerPage {
+		pages = append(pages, lines[:pdfLinesPerPage])
+		lines = lines[pdfLinesPerPage:]
+	}
+	pages = append(pages, lines)
+
+	// objects 1 and 2 are the catalog and pages, 3 the font, then a page and its content per page
+	var objects []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+	)
+	for i, page := range pages {
+		var content strings.Builder
+		fmt.Fprintf(&content, "BT /F1 8 Tf %d TL %d %d Td\n", pdfLeading, pdfMargin, pdfPageHeight-pdfMargin)
+		for _, line := range page {
+			fmt.Fprintf(&content, "(%s) '\n", pdfString(line))
+		}
+		content.WriteString("ET")
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, 5+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()),
+		)
+	}
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return b.Bytes()
+}
+
+// pdfString escapes the text for a PDF string in the Latin-1 range of WinAnsiEncoding
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 255 || (r >= 127 && r < 160):
+			b.WriteByte('?')
+		case r > 127:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,98 @@
+package scout
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Result is implemented by every event sent on the Response Channel
+type Result interface {
+	// ServiceID returns the ID of the service the result is about
+	ServiceID() uuid.UUID
+	// Time returns when the result was created
+	Time() time.Time
+}
+
+// Interceptor is run on every result before it is sent on the Response Channel, it returns
+// the (possibly modified) result to send or nil to drop it
+type Interceptor func(Result) Result
+
+// ServiceID returns the ID of the service that succeeded
+func (r ServiceSuccess) ServiceID() uuid.UUID { return r.Service }
+
+// Time returns when the success was recorded
+func (r ServiceSuccess) Time() time.Time { return r.CreatedAt }
+
+// ServiceID returns the ID of the service that failed
+func (r ServiceFailure) ServiceID() uuid.UUID { return r.Service }
+
+// Time returns when the failure was recorded
+func (r ServiceFailure) Time() time.Time { return r.CreatedAt }
+
+// ServiceID returns the ID of the service that expired
+func (r ServiceExpired) ServiceID() uuid.UUID { return r.Service }
+
+// Time returns when the service expired
+func (r ServiceExpired) Time() time.Time { return r.CreatedAt }
+
+// ServiceID returns the ID of the service that moved
+func (r ServiceMoved) ServiceID() uuid.UUID { return r.Service }
+
+// Time returns when the move was detected
+func (r ServiceMoved) Time() time.Time { return r.CreatedAt }
+
+// ServiceID returns the ID of the service whose ResolveTo drifted
+func (r ServiceResolveDrift) ServiceID() uuid.UUID { return r.Service }
+
+// Time returns when the drift was detected
+func (r ServiceResolveDrift) Time() time.Time { return r.CreatedAt }
+
+// Use adds interceptors that are run, in the order they were added, on every result of the
+// scout services before it is sent on the Response Channel
+func (s *Scout) Use(interceptors ...Interceptor) {
+	s.mux.Lock()
+	s.interceptors = append(s.interceptors, interceptors...)
+	s.mux.Unlock()
+}
+
+// intercept runs the interceptors on r, it returns nil when a interceptor dropped the result
+func (s *Scout) intercept(r Result) Result {
+	s.mux.RLock()
+	interceptors := s.interceptors
+	s.mux.RUnlock()
+	for _, i := range interceptors {
+		if r = i(r); r == nil {
+			return nil
+		}
+	}
+	return r
+}
+
+// emit sends r on the Response Channel after sampling and running the scout interceptors, a full
+// channel is handled by the overflow policy of the scout
+func (s *Service) emit(r Result) {
+	switch r.(type) {
+	case ServiceSuccess, ServiceFailure:
+		s.checkResult = r
+	}
+	if s.SampleSize > 1 {
+		if r = s.sampleResult(r); r == nil {
+			return
+		}
+	}
+	if s.scout != nil {
+		if r = s.scout.intercept(r); r == nil {
+			return
+		}
+	}
+	s.dispatch(r)
+	if s.scout != nil {
+		s.scout.notify(r)
+	}
+	switch r.(type) {
+	case ServiceSuccess, ServiceFailure:
+		s.emitGroups()
+	}
+	s.fanOut(r)
+}
@@ -0,0 +1,122 @@
+package scout
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	// RetryLinearJitter waits a random interval between RetryMinInterval and RetryMaxInterval
+	// times the attempt number, it is the default RetryStrategy
+	RetryLinearJitter = "linear-jitter"
+	// RetryExponentialJitter waits a random interval between RetryMinInterval and
+	// RetryMaxInterval doubled with every attempt
+	RetryExponentialJitter = "exponential-jitter"
+	// RetryFixed waits RetryMinInterval between every attempt
+	RetryFixed = "fixed"
+	// RetryFibonacci waits RetryMinInterval times the fibonacci number of the attempt
+	RetryFibonacci = "fibonacci"
+)
+
+// RetryInfo is where a failing service is in its retry backoff
+type RetryInfo struct {
+	Strategy string   `json:"strategy"`
+	Attempt  int      `json:"attempt"`
+	Max      int      `json:"max,omitempty"`
+	Backoff  Duration `json:"backoff,omitempty"`
+}
+
+// retryStrategy returns the RetryStrategy of the service, defaulting to RetryLinearJitter
+func (s *Service) retryStrategy() string {
+	if s.RetryStrategy == "" {
+		return RetryLinearJitter
+	}
+	return s.RetryStrategy
+}
+
+// validRetryStrategy reports whether strategy is a known RetryStrategy
+func validRetryStrategy(strategy string) bool {
+	switch strategy {
+	case "", RetryLinearJitter, RetryExponentialJitter, RetryFixed, RetryFibonacci:
+		return true
+	}
+	return false
+}
+
+// Backoff sets SleepDuration to the wait before the next retry following the RetryStrategy of
+// the service, bounded by RetryCap when it is set
+func (s *Service) Backoff() {
+	switch s.retryStrategy() {
+	case RetryExponentialJitter:
+		s.RetryAttempts++
+		s.SleepDuration = scaleDuration(s.retryJitter(), math.Pow(2, float64(s.RetryAttempts-1)))
+	case RetryFixed:
+		s.RetryAttempts++
+		s.SleepDuration = s.RetryMinInterval
+	case RetryFibonacci:
+		s.RetryAttempts++
+		s.SleepDuration = scaleDuration(s.RetryMinInterval.Duration(), fibonacci(s.RetryAttempts))
+	default:
+		s.LinearJitterBackoff()
+	}
+	if s.RetryCap > 0 && s.SleepDuration > s.RetryCap {
+		s.SleepDuration = s.RetryCap
+	}
+}
+
+// recoveryInterval returns the wait before the next check of a down service, the Interval is
+// halved with every consecutive failure down to the RecoveryInterval floor so a recovery is
+// noticed quickly, once the service is up it checks at its Interval again
+func (s *Service) recoveryInterval() Duration {
+	sleep := s.Interval
+	if s.RecoveryInterval >= sleep {
+		return sleep
+	}
+	for i := 0; i < s.failures && sleep > s.RecoveryInterval; i++ {
+		sleep /= 2
+	}
+	if sleep < s.RecoveryInterval {
+		sleep = s.RecoveryInterval
+	}
+	return sleep
+}
+
+// retryJitter returns a random interval between RetryMinInterval and RetryMaxInterval
+func (s *Service) retryJitter() time.Duration {
+	if s.RetryMaxInterval <= s.RetryMinInterval {
+		return s.RetryMinInterval.Duration()
+	}
+	jitter := rand.Int63n(int64(s.RetryMaxInterval - s.RetryMinInterval))
+	return s.RetryMinInterval.Duration() + time.Duration(jitter)
+}
+
+// retryInfo returns the retry metadata of a failure, nil when the service does not retry
+func (s *Service) retryInfo() *RetryInfo {
+	if !s.Retry {
+		return nil
+	}
+	info := &RetryInfo{Strategy: s.retryStrategy(), Attempt: s.RetryAttempts, Max: s.RetryMax}
+	if s.RetryAttempts > 0 {
+		info.Backoff = s.SleepDuration
+	}
+	return info
+}
+
+// scaleDuration multiplies d by factor, saturating instead of overflowing
+func scaleDuration(d time.Duration, factor float64) Duration {
+	scaled := float64(d) * factor
+	if scaled >= math.MaxInt64 {
+		return Duration(math.MaxInt64)
+	}
+	return Duration(scaled)
+}
+
+// fibonacci returns the nth fibonacci number, starting 1, 1, 2, 3, 5
+func fibonacci(n int) float64 {
+	a, b := 0.0, 1.0
+	for i := 0; i < n; i++ {
+		a, b = b, a+b
+	}
+	return a
+}
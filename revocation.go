@@ -0,0 +1,385 @@
+package scout
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// revocationLeeway is the clock skew allowed for the update times of OCSP responses and CRLs
+	revocationLeeway = 5 * time.Minute
+	// revocationTTL is how long a status without a next update is cached
+	revocationTTL = time.Hour
+	// maxCRLSize bounds the CRLs downloaded for revocation checks
+	maxCRLSize = 32 << 20
+)
+
+var (
+	oidSHA1              = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidOCSPBasicResponse = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+
+	// signatureAlgorithms are the algorithms of the OCSP response signatures that are checked
+	signatureAlgorithms = map[string]x509.SignatureAlgorithm{
+		"1.2.840.113549.1.1.5":  x509.SHA1WithRSA,
+		"1.2.840.113549.1.1.11": x509.SHA256WithRSA,
+		"1.2.840.113549.1.1.12": x509.SHA384WithRSA,
+		"1.2.840.113549.1.1.13": x509.SHA512WithRSA,
+		"1.2.840.10045.4.3.2":   x509.ECDSAWithSHA256,
+		"1.2.840.10045.4.3.3":   x509.ECDSAWithSHA384,
+		"1.2.840.10045.4.3.4":   x509.ECDSAWithSHA512,
+		"1.3.101.112":           x509.PureEd25519,
+	}
+)
+
+// errRevocationUnknown is the error of a revocation status that could not be determined
+var errRevocationUnknown = errors.New("revocation status unknown")
+
+// the OCSP messages of RFC 6960
+type ocspCertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+type ocspRequest struct {
+	TBSRequest struct {
+		RequestList []struct {
+			Cert ocspCertID
+		}
+	}
+}
+
+type ocspResponse struct {
+	Status   asn1.Enumerated
+	Response struct {
+		ResponseType asn1.ObjectIdentifier
+		Response     []byte
+	} `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    ocspResponseData
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	Raw         asn1.RawContent
+	Version     int `asn1:"optional,default:0,explicit,tag:0"`
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time `asn1:"generalized"`
+	Responses   []ocspSingleResponse
+}
+
+type ocspSingleResponse struct {
+	CertID     ocspCertID
+	Good       asn1.Flag        `asn1:"tag:0,optional"`
+	Revoked    ocspRevokedInfo  `asn1:"tag:1,optional"`
+	Unknown    asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate time.Time        `asn1:"generalized"`
+	NextUpdate time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	Extensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+// revocationStatus is the cached revocation status of a certificate
+type revocationStatus struct {
+	revoked time.Time
+	until   time.Time
+}
+
+// revocationCache caches the revocation status of the certificates of a service by fingerprint
+// until the next update of the OCSP response or CRL it was read from
+type revocationCache struct {
+	mux      sync.Mutex
+	statuses map[string]revocationStatus
+}
+
+func (c *revocationCache) get(key string, now time.Time) (revocationStatus, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	st, ok := c.statuses[key]
+	if !ok || now.After(st.until) {
+		return revocationStatus{}, false
+	}
+	return st, true
+}
+
+func (c *revocationCache) put(key string, st revocationStatus) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.statuses == nil {
+		c.statuses = make(map[string]revocationStatus)
+	}
+	c.statuses[key] = st
+}
+
+// verifyRevocation checks that the leaf certificate of the connection is not revoked, with the
+// OCSP response stapled by the server, its OCSP responder or else its CRL. A revoked certificate
+// fails as FailureCertRevoked and a status that could not be determined as
+// FailureRevocationUnknown, a certificate without OCSP responder or CRL is not checked
+func (s *Service) verifyRevocation(state *tls.ConnectionState) error {
+	leaf := state.PeerCertificates[0]
+	if len(state.OCSPResponse) == 0 && len(leaf.OCSPServer) == 0 && len(leaf.CRLDistributionPoints) == 0 {
+		return nil
+	}
+	issuer := certIssuer(state)
+	if issuer == nil {
+		return &tlsPolicyError{class: FailureRevocationUnknown, msg: fmt.Sprintf("%v: the server did not send the issuer of %q", errRevocationUnknown, leaf.Subject.CommonName)}
+	}
+	now := time.Now()
+	sum := sha256.Sum256(leaf.Raw)
+	key := hex.EncodeToString(sum[:])
+	st, ok := s.revocations.get(key, now)
+	if !ok {
+		var err error
+		if st, err = s.revocationStatus(leaf, issuer, state.OCSPResponse, now); err != nil {
+			return &tlsPolicyError{class: FailureRevocationUnknown, msg: fmt.Sprintf("%v: %v", errRevocationUnknown, err)}
+		}
+		s.revocations.put(key, st)
+	}
+	if !st.revoked.IsZero() {
+		return &tlsPolicyError{class: FailureCertRevoked, msg: fmt.Sprintf("certificate %q was revoked at %s", leaf.Subject.CommonName, st.revoked.UTC().Format(time.RFC3339))}
+	}
+	return nil
+}
+
+// certIssuer returns the issuer of the leaf certificate, from the verified chain or else the
+// chain sent by the server
+func certIssuer(state *tls.ConnectionState) *x509.Certificate {
+	for _, chain := range state.VerifiedChains {
+		if len(chain) > 1 {
+			return chain[1]
+		}
+	}
+	leaf := state.PeerCertificates[0]
+	for _, cert := range state.PeerCertificates[1:] {
+		if leaf.CheckSignatureFrom(cert) == nil {
+			return cert
+		}
+	}
+	return nil
+}
+
+// revocationStatus reads the status of the certificate from the stapled OCSP response, its OCSP
+// responders and its CRLs in that order, it fails when none of them answers
+func (s *Service) revocationStatus(leaf, issuer *x509.Certificate, stapled []byte, now time.Time) (revocationStatus, error) {
+	var errs []error
+	if len(stapled) > 0 {
+		st, err := parseOCSP(stapled, leaf, issuer, now)
+		if err == nil {
+			return st, nil
+		}
+		errs = append(errs, fmt.Errorf("stapled OCSP response: %v", err))
+	}
+	for _, server := range leaf.OCSPServer {
+		st, err := s.queryOCSP(server, leaf, issuer, now)
+		if err == nil {
+			return st, nil
+		}
+		errs = append(errs, fmt.Errorf("OCSP %s: %v", server, err))
+	}
+	for _, dp := range leaf.CRLDistributionPoints {
+		st, err := s.fetchCRL(dp, leaf, issuer, now)
+		if err == nil {
+			return st, nil
+		}
+		errs = append(errs, fmt.Errorf("CRL %s: %v", dp, err))
+	}
+	msg := ""
+	for i, err := range errs {
+		if i > 0 {
+			msg += ", "
+		}
+		msg += err.Error()
+	}
+	return revocationStatus{}, errors.New(msg)
+}
+
+// queryOCSP posts a OCSP request for the certificate to the responder
+func (s *Service) queryOCSP(server string, leaf, issuer *x509.Certificate, now time.Time) (revocationStatus, error) {
+	id, err := ocspID(leaf, issuer)
+	if err != nil {
+		return revocationStatus{}, err
+	}
+	var req ocspRequest
+	req.TBSRequest.RequestList = append(req.TBSRequest.RequestList, struct{ Cert ocspCertID }{id})
+	body, err := asn1.Marshal(req)
+	if err != nil {
+		return revocationStatus{}, err
+	}
+	resp, err := s.fetch(server, "application/ocsp-request", body, 64<<10)
+	if err != nil {
+		return revocationStatus{}, err
+	}
+	return parseOCSP(resp, leaf, issuer, now)
+}
+
+// ocspID returns the OCSP id of the certificate, SHA-1 hashes of the name and key of its issuer
+func ocspID(leaf, issuer *x509.Certificate) (ocspCertID, error) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return ocspCertID{}, err
+	}
+	name := sha1.Sum(issuer.RawSubject)
+	key := sha1.Sum(spki.PublicKey.RightAlign())
+	return ocspCertID{
+		HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+		NameHash:      name[:],
+		IssuerKeyHash: key[:],
+		SerialNumber:  leaf.SerialNumber,
+	}, nil
+}
+
+// parseOCSP returns the status of the certificate in a OCSP response signed by its issuer or a
+// responder the issuer delegated to
+func parseOCSP(der []byte, leaf, issuer *x509.Certificate, now time.Time) (revocationStatus, error) {
+	var resp ocspResponse
+	if _, err := asn1.Unmarshal(der, &resp); err != nil {
+		return revocationStatus{}, fmt.Errorf("invalid response: %v", err)
+	}
+	if resp.Status != 0 {
+		return revocationStatus{}, fmt.Errorf("response status %d", resp.Status)
+	}
+	if !resp.Response.ResponseType.Equal(oidOCSPBasicResponse) {
+		return revocationStatus{}, fmt.Errorf("unsupported response type %v", resp.Response.ResponseType)
+	}
+	var basic ocspBasicResponse
+	if _, err := asn1.Unmarshal(resp.Response.Response, &basic); err != nil {
+		return revocationStatus{}, fmt.Errorf("invalid basic response: %v", err)
+	}
+	signer := issuer
+	if len(basic.Certificates) > 0 {
+		responder, err := x509.ParseCertificate(basic.Certificates[0].FullBytes)
+		if err != nil {
+			return revocationStatus{}, fmt.Errorf("invalid responder certificate: %v", err)
+		}
+		if !bytes.Equal(responder.Raw, issuer.Raw) {
+			if err := responder.CheckSignatureFrom(issuer); err != nil {
+				return revocationStatus{}, fmt.Errorf("responder not delegated by the issuer: %v", err)
+			}
+			if !hasExtKeyUsage(responder, x509.ExtKeyUsageOCSPSigning) {
+				return revocationStatus{}, errors.New("responder certificate is not for OCSP signing")
+			}
+			signer = responder
+		}
+	}
+	alg, ok := signatureAlgorithms[basic.SignatureAlgorithm.Algorithm.String()]
+	if !ok {
+		return revocationStatus{}, fmt.Errorf("unsupported signature algorithm %v", basic.SignatureAlgorithm.Algorithm)
+	}
+	if err := signer.CheckSignature(alg, basic.TBSResponseData.Raw, basic.Signature.RightAlign()); err != nil {
+		return revocationStatus{}, fmt.Errorf("invalid signature: %v", err)
+	}
+	for _, single := range basic.TBSResponseData.Responses {
+		if single.CertID.SerialNumber == nil || single.CertID.SerialNumber.Cmp(leaf.SerialNumber) != 0 {
+			continue
+		}
+		if single.ThisUpdate.After(now.Add(revocationLeeway)) {
+			return revocationStatus{}, fmt.Errorf("response from the future, %s", single.ThisUpdate)
+		}
+		if !single.NextUpdate.IsZero() && single.NextUpdate.Before(now.Add(-revocationLeeway)) {
+			return revocationStatus{}, fmt.Errorf("stale response, next update was %s", single.NextUpdate)
+		}
+		st := revocationStatus{until: single.NextUpdate}
+		if st.until.IsZero() {
+			st.until = now.Add(revocationTTL)
+		}
+		switch {
+		case !single.Revoked.RevocationTime.IsZero():
+			st.revoked = single.Revoked.RevocationTime
+		case bool(single.Unknown):
+			return revocationStatus{}, errors.New("responder does not know the certificate")
+		}
+		return st, nil
+	}
+	return revocationStatus{}, errors.New("no status for the certificate")
+}
+
+// fetchCRL downloads the CRL and looks up the certificate
+func (s *Service) fetchCRL(url string, leaf, issuer *x509.Certificate, now time.Time) (revocationStatus, error) {
+	der, err := s.fetch(url, "", nil, maxCRLSize)
+	if err != nil {
+		return revocationStatus{}, err
+	}
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return revocationStatus{}, fmt.Errorf("invalid CRL: %v", err)
+	}
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		return revocationStatus{}, fmt.Errorf("invalid CRL signature: %v", err)
+	}
+	if !crl.NextUpdate.IsZero() && crl.NextUpdate.Before(now.Add(-revocationLeeway)) {
+		return revocationStatus{}, fmt.Errorf("stale CRL, next update was %s", crl.NextUpdate)
+	}
+	st := revocationStatus{until: crl.NextUpdate}
+	if st.until.IsZero() {
+		st.until = now.Add(revocationTTL)
+	}
+	for _, entry := range crl.RevokedCertificateEntries {
+		if entry.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+			st.revoked = entry.RevocationTime
+			break
+		}
+	}
+	return st, nil
+}
+
+// fetch gets the URL, or posts the body when it has one, within the deadline of the check and
+// returns at most max bytes of the response
+func (s *Service) fetch(url, contentType string, body []byte, max int64) ([]byte, error) {
+	ctx, cancel := context.WithDeadline(s.context(), s.deadline())
+	defer cancel()
+	method := http.MethodGet
+	if body != nil {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s: %s", method, url, resp.Status)
+	}
+	return ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, max))
+}
+
+func hasExtKeyUsage(cert *x509.Certificate, usage x509.ExtKeyUsage) bool {
+	for _, u := range cert.ExtKeyUsage {
+		if u == usage {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package scout
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ServiceSample is sent on the Response Channel instead of every success and failure of a
+// service with a SampleSize, it aggregates SampleSize checks
+type ServiceSample struct {
+	Service        uuid.UUID `json:"service"`
+	Checks         int       `json:"checks"`
+	Successes      int       `json:"successes"`
+	Failures       int       `json:"failures"`
+	SuccessRate    float64   `json:"successRate"`
+	MinLatency     int64     `json:"minLatency"`
+	MaxLatency     int64     `json:"maxLatency"`
+	AvgLatency     int64     `json:"avgLatency"`
+	NetworkLatency int64     `json:"networkLatency"`
+	LastIssue      string    `json:"lastIssue,omitempty"`
+	Online         bool      `json:"online"`
+	StartedAt      time.Time `json:"startedAt"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// ServiceID returns the ID of the sampled service
+func (r ServiceSample) ServiceID() uuid.UUID { return r.Service }
+
+// Time returns when the sample was completed
+func (r ServiceSample) Time() time.Time { return r.CreatedAt }
+
+// sampler accumulates the successes and failures of a sample
+type sampler struct {
+	sample         ServiceSample
+	latencyTotal   int64
+	networkTotal   int64
+	networkSamples int64
+}
+
+// sampleResult adds a success or failure to the current sample and returns the sample once it
+// holds SampleSize checks, or nil while it is still being filled, other results pass through
+func (s *Service) sampleResult(r Result) Result {
+	if s.sampler == nil {
+		s.sampler = &sampler{}
+	}
+	sm := s.sampler
+	if sm.sample.Checks == 0 {
+		sm.sample = ServiceSample{Service: s.ID, StartedAt: r.Time()}
+	}
+	switch res := r.(type) {
+	case ServiceSuccess:
+		sm.sample.Successes++
+		sm.addLatency(res.RequestLatency, res.NetworkLatency)
+	case ServiceFailure:
+		sm.sample.Failures++
+		sm.sample.LastIssue = res.Issue
+		if res.NetworkLatency >= 0 {
+			sm.networkTotal += res.NetworkLatency
+			sm.networkSamples++
+		}
+	default:
+		return r
+	}
+	sm.sample.Checks++
+	if sm.sample.Checks < s.SampleSize {
+		return nil
+	}
+
+	sample := sm.sample
+	sample.SuccessRate = float64(sample.Successes) / float64(sample.Checks)
+	if sample.Successes > 0 {
+		sample.AvgLatency = sm.latencyTotal / int64(sample.Successes)
+	}
+	sample.NetworkLatency = -1
+	if sm.networkSamples > 0 {
+		sample.NetworkLatency = sm.networkTotal / sm.networkSamples
+	}
+	sample.Online = s.Online
+	sample.CreatedAt = time.Now().UTC()
+	s.sampler = &sampler{}
+	return sample
+}
+
+func (sm *sampler) addLatency(request, network int64) {
+	if sm.sample.Successes == 1 || request < sm.sample.MinLatency {
+		sm.sample.MinLatency = request
+	}
+	if request > sm.sample.MaxLatency {
+		sm.sample.MaxLatency = request
+	}
+	sm.latencyTotal += request
+	if network >= 0 {
+		sm.networkTotal += network
+		sm.networkSamples++
+	}
+}
@@ -0,0 +1,259 @@
+package scout
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxDigest bounds the notifications held for the digest of a notifier, later ones are dropped
+	maxDigest = 1000
+	// digestInterval is how often the digests of the notifiers whose quiet window ended are sent
+	digestInterval = time.Minute
+)
+
+// Window is a daily window of time from Start to End, times of the day like 22:00, on Days,
+// every day when empty. A window ending before it starts ends the next day, e.g. 22:00 to 07:00,
+// and a window ending when it starts lasts the whole day
+type Window struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Days are the weekdays the window starts on, e.g. ["sat", "sun"]
+	Days []string `json:"days"`
+}
+
+// NotifierSchedule is when a notifier is notified, outside its Active windows, when it has any,
+// and inside its Quiet windows it is quiet and the notifications of the services that do not
+// have the Except tags are held for a Digest or dropped
+type NotifierSchedule struct {
+	// Timezone is the IANA name of the time zone of the windows, e.g. Europe/Berlin, UTC by
+	// default
+	Timezone string   `json:"timezone"`
+	Active   []Window `json:"active"`
+	Quiet    []Window `json:"quiet"`
+	// Except are the tags of the services notified while the notifier is quiet, e.g.
+	// {"critical": ""}, a empty value matches any value of the tag
+	Except map[string]string `json:"except"`
+	// Digest holds the notifications of the quiet time and sends them as a single notification
+	// of SeverityDigest when it ends
+	Digest bool `json:"digest"`
+}
+
+// schedule is a parsed NotifierSchedule
+type schedule struct {
+	NotifierSchedule
+	loc           *time.Location
+	activeWindows []window
+	quietWindows  []window
+}
+
+// window is a parsed Window, start and end are minutes of the day
+type window struct {
+	start, end int
+	days       [7]bool
+}
+
+// WithNotifierSchedule sets the schedule of the notifier with the name, it has to be added first
+func WithNotifierSchedule(notifier string, sched NotifierSchedule) Option {
+	return func(s *Scout) error {
+		return s.SetNotifierSchedule(notifier, sched)
+	}
+}
+
+// SetNotifierSchedule replaces the schedule of the notifier with the name, the notifications held
+// for its digest are kept. A schedule with a unknown time zone or a invalid window fails with
+// ErrInvalidSchedule
+func (s *Scout) SetNotifierSchedule(notifier string, sched NotifierSchedule) error {
+	parsed, err := parseSchedule(sched)
+	if err != nil {
+		return err
+	}
+	s.router.mux.Lock()
+	defer s.router.mux.Unlock()
+	if _, ok := s.router.notifiers[notifier]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownNotifier, notifier)
+	}
+	if s.router.schedules == nil {
+		s.router.schedules = make(map[string]*schedule)
+	}
+	s.router.schedules[notifier] = parsed
+	return nil
+}
+
+func parseSchedule(sched NotifierSchedule) (*schedule, error) {
+	parsed := &schedule{NotifierSchedule: sched, loc: time.UTC}
+	if sched.Timezone != "" {
+		loc, err := time.LoadLocation(sched.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+		}
+		parsed.loc = loc
+	}
+	for _, ws := range []struct {
+		windows []Window
+		parsed  *[]window
+	}{{sched.Active, &parsed.activeWindows}, {sched.Quiet, &parsed.quietWindows}} {
+		for _, w := range ws.windows {
+			pw, err := parseWindow(w)
+			if err != nil {
+				return nil, err
+			}
+			*ws.parsed = append(*ws.parsed, pw)
+		}
+	}
+	return parsed, nil
+}
+
+func parseWindow(w Window) (window, error) {
+	var pw window
+	for _, t := range []struct {
+		value string
+		min   *int
+	}{{w.Start, &pw.start}, {w.End, &pw.end}} {
+		at, err := time.Parse("15:04", t.value)
+		if err != nil {
+			return window{}, fmt.Errorf("%w: time of day %q", ErrInvalidSchedule, t.value)
+		}
+		*t.min = at.Hour()*60 + at.Minute()
+	}
+	if len(w.Days) == 0 {
+		pw.days = [7]bool{true, true, true, true, true, true, true}
+	}
+	for _, day := range w.Days {
+		found := false
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if name := strings.ToLower(d.String()); strings.EqualFold(day, name) || strings.EqualFold(day, name[:3]) {
+				pw.days[d], found = true, true
+			}
+		}
+		if !found {
+			return window{}, fmt.Errorf("%w: day %q", ErrInvalidSchedule, day)
+		}
+	}
+	return pw, nil
+}
+
+// contains reports whether the window contains the time in its time zone
+func (w window) contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	today, yesterday := t.Weekday(), (t.Weekday()+6)%7
+	switch {
+	case w.start < w.end:
+		return w.days[today] && m >= w.start && m < w.end
+	case w.start > w.end:
+		return (w.days[today] && m >= w.start) || (w.days[yesterday] && m < w.end)
+	default:
+		return w.days[today]
+	}
+}
+
+// quiet reports whether the notifier of the schedule is quiet at the time
+func (sched *schedule) quiet(at time.Time) bool {
+	at = at.In(sched.loc)
+	if len(sched.activeWindows) > 0 && !inWindows(sched.activeWindows, at) {
+		return true
+	}
+	return inWindows(sched.quietWindows, at)
+}
+
+// excepts reports whether the services with the tags are notified while the notifier is quiet
+func (sched *schedule) excepts(tags map[string]string) bool {
+	if len(sched.Except) == 0 {
+		return false
+	}
+	for k, v := range sched.Except {
+		tag, ok := tags[k]
+		if !ok || (v != "" && tag != v) {
+			return false
+		}
+	}
+	return true
+}
+
+func inWindows(windows []window, at time.Time) bool {
+	for _, w := range windows {
+		if w.contains(at) {
+			return true
+		}
+	}
+	return false
+}
+
+// held reports whether the notification for the notifier is held back by its schedule, it is
+// added to the digest of the notifier when it has one, it must be called with the router lock
+// held
+func (s *Scout) held(notifier string, n Notification, tags map[string]string) bool {
+	sched := s.router.schedules[notifier]
+	if sched == nil || !sched.quiet(n.CreatedAt) || sched.excepts(tags) {
+		return false
+	}
+	if !sched.Digest {
+		return true
+	}
+	if len(s.router.digests[notifier]) >= maxDigest {
+		atomic.AddUint64(&s.notifyDropped, 1)
+		return true
+	}
+	if s.router.digests == nil {
+		s.router.digests = make(map[string][]Notification)
+	}
+	s.router.digests[notifier] = append(s.router.digests[notifier], n)
+	return true
+}
+
+// FlushDigests sends the digests of the notifiers that are no longer quiet at the time, it runs
+// every minute on its own while the services are scouted and whenever a result is routed
+func (s *Scout) FlushDigests(now time.Time) {
+	s.router.mux.Lock()
+	defer s.router.mux.Unlock()
+	s.flushDigests(now)
+}
+
+// flushDigests sends the digests that are due, it must be called with the router lock held
+func (s *Scout) flushDigests(now time.Time) {
+	for name, held := range s.router.digests {
+		if sched := s.router.schedules[name]; sched != nil && sched.quiet(now) {
+			continue
+		}
+		delete(s.router.digests, name)
+		queue, ok := s.router.notifiers[name]
+		if !ok || len(held) == 0 {
+			continue
+		}
+		s.enqueue(name, queue, Notification{
+			Severity:  SeverityDigest,
+			Name:      fmt.Sprintf("%d notifications", len(held)),
+			Digest:    held,
+			Since:     held[0].CreatedAt,
+			CreatedAt: now.UTC(),
+		})
+	}
+}
+
+// scheduled reports whether a notifier has a schedule with a digest
+func (s *Scout) scheduled() bool {
+	s.router.mux.Lock()
+	defer s.router.mux.Unlock()
+	for _, sched := range s.router.schedules {
+		if sched.Digest {
+			return true
+		}
+	}
+	return false
+}
+
+// sendDigests flushes the digests every digestInterval until stop is closed
+func (s *Scout) sendDigests(stop chan struct{}) {
+	ticker := time.NewTicker(digestInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			s.FlushDigests(now)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package scout
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSchedulerTick is the resolution of the timing wheel of WithSchedulerTick(0)
+	DefaultSchedulerTick = 100 * time.Millisecond
+	// wheelSlots is the number of ticks of one revolution of the timing wheel
+	wheelSlots = 512
+)
+
+// WithSchedulerTick schedules the checks of the scout services on a shared timing wheel with
+// the tick as resolution instead of a timer per service and check, checks that are due
+// within the same tick run together, zero uses DefaultSchedulerTick
+func WithSchedulerTick(tick time.Duration) Option {
+	return func(s *Scout) error {
+		if tick <= 0 {
+			tick = DefaultSchedulerTick
+		}
+		s.wheel = newTimingWheel(tick)
+		return nil
+	}
+}
+
+// WithStartJitter delays the first check of every service by a random part of up to fraction of
+// its interval, so services started together with the same interval do not check in bursts,
+// fraction ranges from 0 (check right away) to 1 (spread over the whole interval)
+func WithStartJitter(fraction float64) Option {
+	return func(s *Scout) error {
+		if fraction < 0 || fraction > 1 {
+			return fmt.Errorf("scout: start jitter %v is not between 0 and 1", fraction)
+		}
+		s.startJitter = fraction
+		return nil
+	}
+}
+
+// startDelay returns how long the service waits before its first check
+func (s *Service) startDelay() time.Duration {
+	if s.scout == nil || s.scout.startJitter == 0 || s.Interval <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Float64() * s.scout.startJitter * float64(s.Interval))
+}
+
+// timingWheel wakes up service loops, a wake up due in n ticks is kept in the slot n ticks
+// ahead together with the number of revolutions to wait, the wheel only runs while it holds
+// wake ups
+type timingWheel struct {
+	tick    time.Duration
+	slots   [wheelSlots][]wheelEntry
+	pos     int
+	pending int
+	running bool
+	// next is when the wheel ticks next, the ticker never ticks before it
+	next time.Time
+	mux  sync.Mutex
+}
+
+type wheelEntry struct {
+	wake   chan time.Time
+	rounds int
+}
+
+func newTimingWheel(tick time.Duration) *timingWheel {
+	return &timingWheel{tick: tick}
+}
+
+// schedule sends the time on wake at the first tick after d has passed, wake must be buffered
+func (w *timingWheel) schedule(wake chan time.Time, d time.Duration) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	now := time.Now()
+	var ticker *time.Ticker
+	if !w.running {
+		w.running = true
+		w.next = now.Add(w.tick)
+		ticker = time.NewTicker(w.tick)
+	}
+	// the slot n ticks ahead is woken n-1 ticks after the next tick, which can be any time
+	// within a tick from now
+	ticks := 1
+	if rest := d - w.next.Sub(now); rest > 0 {
+		ticks += int((rest + w.tick - 1) / w.tick)
+	}
+	slot := (w.pos + ticks) % wheelSlots
+	w.slots[slot] = append(w.slots[slot], wheelEntry{wake: wake, rounds: (ticks - 1) / wheelSlots})
+	w.pending++
+	if ticker != nil {
+		go w.run(ticker)
+	}
+}
+
+// run advances the wheel every tick of the ticker until it holds no more wake ups
+func (w *timingWheel) run(ticker *time.Ticker) {
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if !w.advance(now) {
+			return
+		}
+	}
+}
+
+// advance moves the wheel one tick and sends now to the wake ups that became due, it returns
+// false and stops the wheel when there are none left
+func (w *timingWheel) advance(now time.Time) bool {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.pos = (w.pos + 1) % wheelSlots
+	w.next = w.next.Add(w.tick)
+	entries := w.slots[w.pos]
+	keep := entries[:0]
+	for _, e := range entries {
+		if e.rounds > 0 {
+			e.rounds--
+			keep = append(keep, e)
+			continue
+		}
+		w.pending--
+		select {
+		case e.wake <- now:
+		default:
+		}
+	}
+	w.slots[w.pos] = keep
+	if w.pending == 0 {
+		w.running = false
+		return false
+	}
+	return true
+}
+
+// after returns a channel that receives the time once d has passed, on the timing wheel of
+// the scout when it has one, wake is reused by the service loop for every wait
+func (s *Service) after(wake chan time.Time, d time.Duration) <-chan time.Time {
+	if s.scout == nil || s.scout.wheel == nil {
+		return time.After(d)
+	}
+	s.scout.wheel.schedule(wake, d)
+	return wake
+}
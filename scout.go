@@ -2,11 +2,12 @@ package scout
 
 import (
 	"fmt"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/sirupsen/logrus"
 
 	traceroute "github.com/phenixrizen/go-traceroute"
 )
@@ -15,84 +16,333 @@ type Scout struct {
 	Services  map[uuid.UUID]*Service
 	Responses chan interface{}
 	Running   bool
-	Logger    logrus.FieldLogger
+	Logger    Logger
+	DNSCache  *DNSCache
 	mux       sync.RWMutex
+
+	interceptors    []Interceptor
+	autoAssignIDs   bool
+	duplicatePolicy string
+	targets         map[string]*Service
+	stallFactor     int
+	stallRestart    bool
+	watchdog        chan struct{}
+	idStrategy      IDStrategy
+	externalIDs     map[string]uuid.UUID
+	checks          uint64
+	started         time.Time
+	wheel           *timingWheel
+	groups          map[uuid.UUID]*groupState
+	router          router
+	hooks           []Hooks
+	middleware      []Middleware
+	pending         []*Service
+	resultBuffer    int
+	responses       int32
+	defaultTimeout  Duration
+	checkSlots      chan struct{}
+	overflowPolicy  string
+	dropped         uint64
+	subscribers     map[string]*subscription
+	startJitter     float64
+	rateLimits      *rateLimits
+	timeline        *timeline
+	timelineStop    chan struct{}
+	templates       *Templates
+	discoveries     []*discovery
+	discoveryStop   chan struct{}
+	cluster         *cluster
+	clusterStop     chan struct{}
+	clusterDone     chan struct{}
+	secrets         map[string]SecretProvider
+	http3           HTTP3Transport
+	digestStop      chan struct{}
+	reports         []*reportJob
+	reportStop      chan struct{}
+	loops           int64
+	notifyFailures  uint64
+	notifyDropped   uint64
+	notifyPending   int64
+	inflight        int64
 }
 
 type ServiceSuccess struct {
-	Service        uuid.UUID `json:"service"`
-	RequestLatency int64     `json:"requestLatency"`
-	NetworkLatency int64     `json:"networkLatency"`
-	CreatedAt      time.Time `json:"createdAt"`
+	Service        uuid.UUID         `json:"service"`
+	RequestLatency int64             `json:"requestLatency"`
+	NetworkLatency int64             `json:"networkLatency"`
+	IPResults      []IPResult        `json:"ipResults,omitempty"`
+	TLSHandshake   int64             `json:"tlsHandshake,omitempty"`
+	CertExpiry     time.Time         `json:"certExpiry"`
+	Details        map[string]string `json:"details,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Timings        *Timings          `json:"timings,omitempty"`
+	Degraded       string            `json:"degraded,omitempty"`
+	Locations      []LocationResult  `json:"locations,omitempty"`
+	Silenced       bool              `json:"silenced,omitempty"`
+	Acknowledged   bool              `json:"acknowledged,omitempty"`
+	CreatedAt      time.Time         `json:"createdAt"`
 }
 
 type ServiceFailure struct {
 	Service          uuid.UUID              `json:"service"`
 	Issue            string                 `json:"issue"`
+	Class            FailureClass           `json:"class"`
+	Err              error                  `json:"-"`
 	NetworkLatency   int64                  `json:"networkLatency"`
 	TraceData        []traceroute.TraceData `json:"traceData,omitempty"`
+	TraceBaseline    []traceroute.TraceData `json:"traceBaseline,omitempty"`
 	RetriesExhausted bool                   `json:"retiresExhausted,omitempty"`
+	IPResults        []IPResult             `json:"ipResults,omitempty"`
+	Details          map[string]string      `json:"details,omitempty"`
+	Labels           map[string]string      `json:"labels,omitempty"`
 	CreatedAt        time.Time              `json:"createdAt"`
 	ErrorCode        int                    `json:"errorCode,omitempty"`
+	Timings          *Timings               `json:"timings,omitempty"`
+	Consecutive      int                    `json:"consecutive"`
+	Suppressed       bool                   `json:"suppressed,omitempty"`
+	RootCause        uuid.UUID              `json:"rootCause,omitempty"`
+	Silenced         bool                   `json:"silenced,omitempty"`
+	Acknowledged     bool                   `json:"acknowledged,omitempty"`
+	Retry            *RetryInfo             `json:"retry,omitempty"`
+	Locations        []LocationResult       `json:"locations,omitempty"`
 }
 
-// NewScout returns a scout
-func NewScout(servs []*Service, log logrus.FieldLogger) *Scout {
+// NewScout returns a scout for the services, options are applied before the services are added,
+// it is a wrapper of NewScoutWithOptions kept for existing callers
+func NewScout(servs []*Service, log Logger, opts ...Option) (*Scout, error) {
 	if log == nil {
-		return nil
+		return nil, ErrNilLogger
+	}
+	opts = append([]Option{WithLogger(log)}, opts...)
+	return NewScoutWithOptions(append(opts, WithServices(servs...))...)
+}
+
+// NewScoutWithOptions returns a scout configured by the options, it logs to slog.Default
+// unless WithLogger is given and the services of WithServices are added after all
+// options are applied
+func NewScoutWithOptions(opts ...Option) (*Scout, error) {
+	s := &Scout{
+		Services: make(map[uuid.UUID]*Service),
+		Logger:   NewSlogLogger(slog.Default().With("component", "scout")),
 	}
-	log = log.WithField("component", "scout")
-	servMap := make(map[uuid.UUID]*Service)
-	resp := make(chan interface{})
-	for i, serv := range servs {
-		serv.Responses = resp
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	s.Responses = make(chan interface{}, s.resultBuffer)
+	servs := s.pending
+	s.pending = nil
+	for _, serv := range servs {
+		if err := s.validateService(serv, nil); err != nil {
+			return nil, err
+		}
+		serv.Responses = s.Responses
+		serv.scout = s
 		if serv.Logger == nil {
-			serv.Logger = log
+			serv.Logger = s.Logger
+		}
+		if serv.Timeout == 0 {
+			serv.Timeout = s.defaultTimeout
+		}
+		if err := s.resolveSecrets(serv); err != nil {
+			return nil, err
 		}
 		serv.Initialize()
-		servMap[serv.ID] = servs[i]
-	}
-	s := &Scout{
-		Services:  servMap,
-		Responses: resp,
-		Logger:    log,
+		if s.addTarget(serv) == nil {
+			s.Services[serv.ID] = serv
+			s.indexExternalID(serv)
+		}
 	}
 
-	return s
+	return s, nil
+}
+
+// validateService checks that serv can be added to the scout after applying the templates of the
+// scout, assigning it a ID when it has none and the scout was created WithAutoAssignIDs or
+// WithIDStrategy. The service serv replaces, if any, does not count as a duplicate
+func (s *Scout) validateService(serv, replaces *Service) error {
+	if serv == nil {
+		return ErrNilService
+	}
+	if err := s.templates.Apply(serv); err != nil {
+		return err
+	}
+	if serv.ID == uuid.Nil {
+		if !s.autoAssignIDs {
+			return fmt.Errorf("%w: %s", ErrMissingServiceID, serv.Name)
+		}
+		serv.ID = s.newID(serv)
+	}
+	if other, ok := s.Services[serv.ID]; ok && other != replaces {
+		return fmt.Errorf("%w: %s", ErrDuplicateServiceID, serv.ID)
+	}
+	if id, ok := s.externalIDs[serv.ExternalID]; ok && serv.ExternalID != "" && (replaces == nil || id != replaces.ID) {
+		return fmt.Errorf("%w: %s", ErrDuplicateExternalID, serv.ExternalID)
+	}
+	if s.dependsOn(serv, serv.ID, map[uuid.UUID]bool{}) {
+		return fmt.Errorf("%w: %s", ErrDependencyCycle, serv.ID)
+	}
+	return nil
 }
 
 // AddService adds a service to monitor
-func (s *Scout) AddService(serv *Service) {
-	if serv != nil && serv.ID != uuid.Nil {
-		serv.Responses = s.Responses
-		serv.Logger = s.Logger
-		s.mux.Lock()
-		s.Services[serv.ID] = serv
-		if s.Running {
-			go serv.Scout()
+func (s *Scout) AddService(serv *Service) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.addService(serv)
+}
+
+// addService validates and adds a service to monitor, it must be called with the scout lock held
+func (s *Scout) addService(serv *Service) error {
+	if err := s.prepareService(serv, nil); err != nil {
+		return err
+	}
+	s.insertService(serv)
+	return nil
+}
+
+// replaceService replaces old with serv, serv is validated and its secrets resolved before old is
+// removed so old keeps running when serv can not be added. It must be called with the scout lock
+// held
+func (s *Scout) replaceService(old, serv *Service) error {
+	if err := s.prepareService(serv, old); err != nil {
+		return err
+	}
+	s.delService(old.ID)
+	s.insertService(serv)
+	return nil
+}
+
+// prepareService validates serv and resolves its secrets, everything that can fail adding it, the
+// service it replaces, if any, is not a duplicate of it
+func (s *Scout) prepareService(serv, replaces *Service) error {
+	if err := s.validateService(serv, replaces); err != nil {
+		return err
+	}
+	if err := serv.Validate(); err != nil {
+		return err
+	}
+	serv.Responses = s.Responses
+	serv.Logger = s.Logger
+	serv.DNSCache = s.DNSCache
+	serv.scout = s
+	if serv.Timeout == 0 {
+		serv.Timeout = s.defaultTimeout
+	}
+	if err := s.resolveSecrets(serv); err != nil {
+		return err
+	}
+	if s.duplicatePolicy == DuplicateMerge {
+		if primary := s.targets[serv.targetKey()]; primary != nil && primary != replaces {
+			return fmt.Errorf("%w: %s checks the same target as %s", ErrDuplicateTarget, serv.ID, primary.ID)
 		}
-		s.mux.Unlock()
+	}
+	return nil
+}
+
+// insertService adds the prepared serv and starts it when the scout is running
+func (s *Scout) insertService(serv *Service) {
+	serv.Initialize()
+	// a target merged into another was refused by prepareService
+	s.addTarget(serv)
+	s.Services[serv.ID] = serv
+	s.indexExternalID(serv)
+	if s.Running && serv.primary == nil && !serv.remote() && s.owns(serv) {
+		go serv.Scout()
 	}
 }
 
-// DelService adds a service to monitor
+// SetDNSCache shares a DNS cache between all services of the scout, nil disables caching
+func (s *Scout) SetDNSCache(c *DNSCache) {
+	s.mux.Lock()
+	s.DNSCache = c
+	for _, serv := range s.Services {
+		serv.DNSCache = c
+	}
+	s.mux.Unlock()
+}
+
+// UpdateService replaces the service with the ID of serv, it fails with ErrUnknownService when
+// the scout has no service with that ID and keeps the service when serv can not be added
+func (s *Scout) UpdateService(serv *Service) error {
+	if serv == nil {
+		return ErrNilService
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	old, ok := s.Services[serv.ID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownService, serv.ID)
+	}
+	return s.replaceService(old, serv)
+}
+
+// DelService removes a service from monitoring
 func (s *Scout) DelService(id uuid.UUID) {
-	if id != uuid.Nil {
-		s.Services[id].Stop()
-		s.mux.Lock()
-		delete(s.Services, id)
-		s.mux.Unlock()
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.delService(id)
+}
+
+// delService removes a service from monitoring, it must be called with the scout lock held
+func (s *Scout) delService(id uuid.UUID) {
+	serv, ok := s.Services[id]
+	if !ok {
+		return
 	}
+	serv.Stop()
+	delete(s.Services, id)
+	s.delTarget(serv)
+	s.unindexExternalID(serv)
+	s.evictHost(serv.parseHost())
 }
 
-// StartScoutingServices will start the checking go routine for each service
+// StartScoutingServices will start the checking go routine for each service that is not paused,
+// checked by remote agents or by another member of the cluster
 func (s *Scout) StartScoutingServices() {
 	s.Logger.Infof(fmt.Sprintf("Starting scouting routines for %v Services", len(s.Services)))
 	if !s.Running {
+		if s.cluster != nil {
+			s.cluster.reset()
+		}
 		for _, ser := range s.Services {
-			go ser.Scout()
+			if ser.primary == nil && !ser.Paused && !ser.remote() && s.owns(ser) {
+				go ser.Scout()
+			}
+		}
+		if s.stallFactor > 0 {
+			s.watchdog = make(chan struct{})
+			go s.watch(s.watchdog)
+		}
+		if s.timeline != nil {
+			s.timelineStop = make(chan struct{})
+			go s.pruneTimeline(s.timelineStop)
+		}
+		if s.scheduled() {
+			s.digestStop = make(chan struct{})
+			go s.sendDigests(s.digestStop)
 		}
+		if len(s.reports) > 0 {
+			s.reportStop = make(chan struct{})
+			for _, job := range s.reports {
+				go s.runReport(job, s.reportStop)
+			}
+		}
+		s.started = time.Now().UTC()
 		s.Running = true
+		// the services of the member are started once the cluster is synced
+		if s.cluster != nil {
+			s.clusterStop, s.clusterDone = make(chan struct{}), make(chan struct{})
+			go s.runCluster(s.clusterStop, s.clusterDone)
+		}
+		// discovered services are started as they are added once the scout is running
+		if len(s.discoveries) > 0 {
+			s.discoveryStop = make(chan struct{})
+			for _, d := range s.discoveries {
+				go s.discover(d, s.discoveryStop)
+			}
+		}
 	}
 }
 
@@ -100,42 +350,84 @@ func (s *Scout) StartScoutingServices() {
 func (s *Scout) StopScoutingServices() {
 	s.Logger.Infof(fmt.Sprintf("Stopping scouting routines for %v Services", len(s.Services)))
 	if s.Running {
+		if s.discoveryStop != nil {
+			close(s.discoveryStop)
+			s.discoveryStop = nil
+		}
+		if s.clusterStop != nil {
+			// no service is started by the cluster once it is done
+			close(s.clusterStop)
+			<-s.clusterDone
+			s.clusterStop, s.clusterDone = nil, nil
+		}
 		for _, ser := range s.Services {
 			ser.Stop()
 		}
+		if s.watchdog != nil {
+			close(s.watchdog)
+			s.watchdog = nil
+		}
+		if s.timelineStop != nil {
+			close(s.timelineStop)
+			s.timelineStop = nil
+		}
+		if s.digestStop != nil {
+			close(s.digestStop)
+			s.digestStop = nil
+		}
+		if s.reportStop != nil {
+			close(s.reportStop)
+			s.reportStop = nil
+		}
 		s.Running = false
 	}
 }
 
-// GetResponseChannel returns a interface channel that has either ServiceSuccess or ServiceFailure responses
+// GetResponseChannel returns a interface channel that has either ServiceSuccess or ServiceFailure
+// responses, from then on it receives every result even while the scout has subscribers
 func (s *Scout) GetResponseChannel() chan interface{} {
+	atomic.CompareAndSwapInt32(&s.responses, responsesAuto, responsesRead)
 	return s.Responses
 }
 
 // HandleResponses simply logs current responses, this is not intended to be used, but demonatrates scouts usage
 func (s *Scout) HandleResponses() {
-	s.Logger.Info("Listening for Responses...")
-	for resp := range s.Responses {
+	s.Logger.Infof("Listening for Responses...")
+	for resp := range s.GetResponseChannel() {
 		success, ok := resp.(ServiceSuccess)
 		if ok {
 			s.Logger.Infof("Response: SUCCESS %s -> %s %+v", s.Services[success.Service].Name, s.Services[success.Service].Type, resp)
 			continue
 		}
 		fail, ok := resp.(ServiceFailure)
+		if ok && fail.Suppressed {
+			s.Logger.Infof("Response: SUPPRESSED %s -> %s caused by %s %+v", s.Services[fail.Service].Name, s.Services[fail.Service].Type, fail.RootCause, resp)
+			continue
+		}
 		if ok {
 			s.Logger.Infof("Response: FAILURE %s -> %s %+v", s.Services[fail.Service].Name, s.Services[fail.Service].Type, resp)
 			continue
 		}
+		expired, ok := resp.(ServiceExpired)
+		if ok {
+			s.Logger.Infof("Response: EXPIRED %s -> %s %+v", expired.Service, expired.Action, resp)
+			continue
+		}
+		group, ok := resp.(GroupStatus)
+		if ok {
+			s.Logger.Infof("Response: GROUP %s -> %s %+v", group.Name, group.Status, resp)
+			continue
+		}
 	}
 }
 
 // GetService returns a service
 func (s *Scout) GetService(id uuid.UUID) *Service {
 	s.mux.RLock()
-	if s, ok := s.Services[id]; ok {
-		return s
+	defer s.mux.RUnlock()
+	if serv, ok := s.Services[id]; ok {
+		return serv
 	}
-	s.mux.RUnlock()
 	return nil
 }
 
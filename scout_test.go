@@ -1,17 +1,28 @@
 package scout
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestScout(t *testing.T) {
 	assert := assert.New(t)
 
-	log := logrus.New()
+	log := NewSlogLogger(nil)
 
 	google := &Service{
 		ID:             uuid.New(),
@@ -47,10 +58,1317 @@ func TestScout(t *testing.T) {
 
 	servs := []*Service{google, netlify, netlifyPing}
 
-	s := NewScout(servs, log)
+	s, err := NewScout(servs, log)
+	assert.Nil(err)
 	assert.NotNil(s)
 
 	// go s.CheckServices()
 	//# s.HandleResponses()
 
 }
+
+func TestScoutUse(t *testing.T) {
+	assert := assert.New(t)
+
+	serv := &Service{
+		ID:   uuid.New(),
+		Name: "Intercepted",
+		Type: "http",
+	}
+	s, err := NewScout([]*Service{serv}, NewSlogLogger(nil))
+	assert.Nil(err)
+	s.Use(func(r Result) Result {
+		if suc, ok := r.(ServiceSuccess); ok {
+			suc.Labels = map[string]string{"env": "test"}
+			return suc
+		}
+		return r
+	}, func(r Result) Result {
+		if _, ok := r.(ServiceFailure); ok {
+			return nil
+		}
+		return r
+	})
+
+	go func() {
+		serv.Failure("dropped")
+		serv.Success()
+	}()
+	suc, ok := (<-s.Responses).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("test", suc.Labels["env"])
+}
+
+func TestHooks(t *testing.T) {
+	assert := assert.New(t)
+
+	var calls []string
+	var changes []string
+	serv := &Service{
+		ID:      uuid.New(),
+		Name:    "Hooked",
+		Type:    "heartbeat",
+		Address: "placeholder",
+		Hooks: Hooks{
+			OnCheckStart: func(s *Service) { calls = append(calls, "service start") },
+		},
+		Middleware: []Middleware{func(next CheckFunc) CheckFunc {
+			return func(s *Service) {
+				calls = append(calls, "service middleware")
+				if s.Address == "up" {
+					s.Success()
+					return
+				}
+				s.Failure("down")
+			}
+		}},
+	}
+	s, err := NewScout([]*Service{serv}, NewSlogLogger(nil),
+		WithHooks(Hooks{
+			OnCheckStart: func(s *Service) {
+				calls = append(calls, "scout start")
+				s.Address = "up"
+			},
+			OnCheckComplete: func(s *Service, r Result, d time.Duration) {
+				_, ok := r.(ServiceSuccess)
+				calls = append(calls, fmt.Sprintf("complete %v", ok))
+			},
+			OnStateChange: func(s *Service, from, to string) {
+				changes = append(changes, from+" -> "+to)
+			},
+		}),
+		WithMiddleware(func(next CheckFunc) CheckFunc {
+			return func(s *Service) {
+				calls = append(calls, "scout middleware")
+				next(s)
+			}
+		}),
+	)
+	assert.Nil(err)
+	serv.Responses = make(chan interface{}, 4)
+
+	serv.Check()
+	assert.Equal([]string{"scout start", "service start", "scout middleware", "service middleware", "complete true"}, calls)
+	assert.Equal([]string{StatePending + " -> " + StateUp}, changes)
+
+	// a check keeping the state does not call OnStateChange
+	serv.Check()
+	assert.Len(changes, 1)
+
+	s.AddHooks(Hooks{OnCheckStart: func(s *Service) { s.Address = "down" }})
+	serv.Check()
+	assert.Equal([]string{StatePending + " -> " + StateUp, StateUp + " -> " + StateDown}, changes)
+	assert.Equal(StateDown, serv.State())
+}
+
+func TestNewScoutErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewScout(nil, nil)
+	assert.True(errors.Is(err, ErrNilLogger))
+
+	id := uuid.New()
+	_, err = NewScout([]*Service{{ID: id}, {ID: id}}, NewSlogLogger(nil))
+	assert.True(errors.Is(err, ErrDuplicateServiceID))
+
+	_, err = NewScout([]*Service{{Name: "No ID"}}, NewSlogLogger(nil))
+	assert.True(errors.Is(err, ErrMissingServiceID))
+
+	serv := &Service{Name: "No ID"}
+	s, err := NewScout([]*Service{serv}, NewSlogLogger(nil), WithAutoAssignIDs())
+	assert.Nil(err)
+	assert.NotEqual(uuid.Nil, serv.ID)
+	assert.Equal(serv, s.GetService(serv.ID))
+	assert.True(errors.Is(s.AddService(&Service{ID: serv.ID}), ErrDuplicateServiceID))
+}
+
+func TestNewScoutWithOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewScoutWithOptions()
+	assert.Nil(err)
+	assert.NotNil(s.Logger)
+	assert.Equal(0, cap(s.Responses))
+
+	_, err = NewScoutWithOptions(WithLogger(nil))
+	assert.True(errors.Is(err, ErrNilLogger))
+	_, err = NewScoutWithOptions(WithResultBuffer(-1))
+	assert.NotNil(err)
+	_, err = NewScoutWithOptions(WithConcurrencyLimit(0))
+	assert.NotNil(err)
+
+	serv := &Service{ID: uuid.New(), Name: "Optioned", Type: "heartbeat"}
+	timed := &Service{ID: uuid.New(), Name: "Timed", Type: "heartbeat", Timeout: Duration(time.Second)}
+	s, err = NewScoutWithOptions(
+		WithServices(serv, timed),
+		WithLogger(NewSlogLogger(nil)),
+		WithResultBuffer(8),
+		WithDefaultTimeout(3*time.Second),
+		WithConcurrencyLimit(1),
+	)
+	assert.Nil(err)
+	assert.Len(s.Services, 2)
+	assert.Equal(8, cap(s.Responses))
+	assert.Equal(Duration(3*time.Second), serv.Timeout)
+	assert.Equal(Duration(time.Second), timed.Timeout)
+	late := &Service{ID: uuid.New(), Name: "Late", Type: "heartbeat", Interval: Duration(time.Minute)}
+	assert.Nil(s.AddService(late))
+	assert.Equal(Duration(3*time.Second), late.Timeout)
+
+	// a second check waits for the slot of the running one
+	running := make(chan struct{})
+	release := make(chan struct{})
+	serv.Middleware = []Middleware{func(next CheckFunc) CheckFunc {
+		return func(s *Service) {
+			close(running)
+			<-release
+		}
+	}}
+	go serv.Check()
+	<-running
+	done := make(chan struct{})
+	go func() {
+		timed.Check()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("check ran over the concurrency limit")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-done
+}
+
+func TestSlogLogger(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	log := NewSlogLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn})))
+	serv := &Service{ID: uuid.New(), Name: "Logged", Type: "heartbeat"}
+	s, err := NewScoutWithOptions(WithServices(serv), WithLogger(log))
+	assert.Nil(err)
+	assert.Equal(log, serv.Logger)
+
+	s.Logger.Infof("hidden %d", 1)
+	s.Logger.Warnf("shown %d", 2)
+	assert.NotContains(buf.String(), "hidden")
+	assert.Contains(buf.String(), "level=WARN msg=\"shown 2\"")
+
+	// services without a scout log to slog.Default
+	lone := &Service{ID: uuid.New(), Name: "Lone"}
+	lone.Initialize()
+	assert.NotNil(lone.Logger)
+}
+
+func TestSubscribe(t *testing.T) {
+	assert := assert.New(t)
+
+	// a consumer that only subscribes keeps receiving results without anyone reading the
+	// unbuffered Response Channel
+	serv := &Service{ID: uuid.New(), Name: "Subscribed", Type: "heartbeat"}
+	s, err := NewScoutWithOptions(WithServices(serv), WithLogger(NewSlogLogger(nil)))
+	assert.Nil(err)
+	only := s.Subscribe("only", 0)
+	go func() {
+		for i := 0; i < 5; i++ {
+			serv.Success()
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		select {
+		case r := <-only:
+			assert.IsType(ServiceSuccess{}, r.Result)
+		case <-time.After(time.Second):
+			t.Fatalf("subscriber stalled after %d results", i)
+		}
+	}
+	s.Unsubscribe("only")
+
+	serv = &Service{ID: uuid.New(), Name: "Subscribed", Type: "heartbeat"}
+	s, err = NewScoutWithOptions(WithServices(serv), WithLogger(NewSlogLogger(nil)), WithResultBuffer(3))
+	assert.Nil(err)
+	metrics := s.Subscribe("metrics", 3)
+	persister := s.Subscribe("persister", 3)
+	// the Response Channel receives every result once it is read
+	responses := s.GetResponseChannel()
+
+	serv.Success()
+	serv.Failure("down")
+	assert.Len(responses, 2)
+	<-responses
+	<-responses
+	for _, ch := range []<-chan CheckResult{metrics, persister} {
+		if assert.Len(ch, 2) {
+			r := <-ch
+			assert.IsType(ServiceSuccess{}, r.Result)
+			assert.Equal(serv.ID, r.ServiceID())
+			r = <-ch
+			assert.IsType(ServiceFailure{}, r.Result)
+			if assert.NotNil(r.Status) {
+				assert.Equal(StateDown, r.Status.State)
+			}
+		}
+	}
+
+	// subscribing again replaces the subscriber and closes its previous channel
+	again := s.Subscribe("metrics", 1)
+	_, open := <-metrics
+	assert.False(open)
+
+	s.Unsubscribe("persister")
+	_, open = <-persister
+	assert.False(open)
+	serv.Success()
+	assert.Len(again, 1)
+	<-again
+	<-responses
+
+	// a unsubscribed blocked subscriber does not stall the check
+	blocked := s.Subscribe("blocked", 0)
+	done := make(chan struct{})
+	go func() {
+		serv.Success()
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	s.Unsubscribe("blocked")
+	<-done
+	_, open = <-blocked
+	assert.False(open)
+}
+
+// BenchmarkDispatch reports the allocations of sending a result to the subscribers, run with
+// -benchmem
+func BenchmarkDispatch(b *testing.B) {
+	serv := &Service{ID: uuid.New(), Name: "Bench", Type: "heartbeat", Interval: Duration(time.Hour)}
+	s, err := NewScout([]*Service{serv}, NewSlogLogger(nil), WithoutResponseChannel())
+	if err != nil {
+		b.Fatal(err)
+	}
+	subs := []<-chan CheckResult{s.Subscribe("one", 1), s.Subscribe("two", 1)}
+	r := ServiceSuccess{Service: serv.ID}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		serv.dispatch(r)
+		for _, sub := range subs {
+			<-sub
+		}
+	}
+}
+
+func TestCheckNow(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+	serv := &Service{ID: uuid.New(), Name: "Web", Address: ts.URL, Type: "http", ExpectedStatus: 200, SkipDNSTiming: true, Interval: Duration(time.Hour)}
+	follower := &Service{ID: uuid.New(), Name: "Web Copy", Address: ts.URL, Type: "http", ExpectedStatus: 200, SkipDNSTiming: true, Interval: Duration(time.Hour)}
+	s, err := NewScout([]*Service{serv, follower}, NewSlogLogger(nil), WithResultBuffer(8), WithDuplicatePolicy(DuplicateShare))
+	assert.Nil(err)
+
+	r, err := s.CheckNow(serv.ID)
+	assert.Nil(err)
+	assert.IsType(ServiceSuccess{}, r.Result)
+	if assert.NotNil(r.Status) {
+		assert.Equal(StateUp, r.Status.State)
+	}
+	// the result is also sent for the follower sharing the check
+	assert.Len(s.Responses, 2)
+
+	// a follower has its primary checked and gets its own copy of the result
+	r, err = s.CheckNow(follower.ID)
+	assert.Nil(err)
+	assert.Equal(follower.ID, r.ServiceID())
+
+	serv.ExpectedStatus = 201
+	r, err = s.CheckNow(serv.ID)
+	assert.Nil(err)
+	assert.IsType(ServiceFailure{}, r.Result)
+
+	_, err = s.CheckNow(uuid.New())
+	assert.True(errors.Is(err, ErrUnknownService))
+}
+
+func TestOverflowPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewScoutWithOptions(WithOverflowPolicy("spill"))
+	assert.NotNil(err)
+
+	for policy, kept := range map[string]int64{OverflowDropNewest: 1, OverflowDropOldest: 3} {
+		serv := &Service{ID: uuid.New(), Name: policy, Type: "heartbeat"}
+		s, err := NewScoutWithOptions(WithServices(serv), WithLogger(NewSlogLogger(nil)), WithResultBuffer(1), WithOverflowPolicy(policy))
+		assert.Nil(err)
+		for i := int64(1); i <= 3; i++ {
+			serv.RequestLatency = i
+			serv.Success()
+		}
+		assert.Equal(uint64(2), s.DroppedResults())
+		if assert.Len(s.Responses, 1) {
+			assert.Equal(kept, (<-s.Responses).(ServiceSuccess).RequestLatency, policy)
+		}
+	}
+
+	// a unbuffered channel without a consumer does not stall the check
+	serv := &Service{ID: uuid.New(), Name: "Unbuffered", Type: "heartbeat"}
+	s, err := NewScoutWithOptions(WithServices(serv), WithLogger(NewSlogLogger(nil)), WithOverflowPolicy(OverflowDropOldest))
+	assert.Nil(err)
+	serv.Success()
+	assert.Equal(uint64(1), s.DroppedResults())
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	valid := &Service{ID: uuid.New(), Name: "API", Type: "http", Address: "https://api.example", Interval: Duration(time.Minute)}
+	assert.Nil(valid.Validate())
+
+	serv := &Service{
+		ID:               uuid.New(),
+		Name:             "Broken",
+		Type:             "tcp",
+		Address:          "db.example",
+		Expected:         "(",
+		Retry:            true,
+		RetryMaxInterval: Duration(time.Second),
+	}
+	err := serv.Validate()
+	var verr *ValidationError
+	if assert.True(errors.As(err, &verr)) {
+		assert.Equal("Broken", verr.Service)
+		assert.Len(verr.Problems, 4)
+	}
+	assert.True(errors.Is(err, ErrInvalidService))
+	assert.True(errors.Is(err, ErrInvalidInterval))
+	assert.True(errors.Is(err, ErrInvalidAddress))
+	assert.True(errors.Is(err, ErrInvalidExpected))
+	assert.True(errors.Is(err, ErrInvalidRetry))
+	assert.False(errors.Is(err, ErrUnsupportedType))
+
+	assert.True(errors.Is((&Service{Type: "gopher", Interval: 1, Address: "x"}).Validate(), ErrUnsupportedType))
+	assert.True(errors.Is((&Service{Type: "http", Interval: 1, Address: "api.example"}).Validate(), ErrInvalidAddress))
+	assert.Nil((&Service{Type: "heartbeat", Interval: 1}).Validate())
+	assert.True(errors.Is((&Service{Type: "heartbeat", Interval: 1, RetryStrategy: "quadratic"}).Validate(), ErrInvalidRetry))
+	// a timeout meant as seconds is nanoseconds
+	valid.Timeout = 10
+	assert.True(errors.Is(valid.Validate(), ErrInvalidTimeout))
+	valid.Timeout = Duration(10 * time.Second)
+	assert.Nil(valid.Validate())
+
+	s, err := NewScout(nil, NewSlogLogger(nil))
+	assert.Nil(err)
+	assert.True(errors.Is(s.AddService(serv), ErrInvalidService))
+	assert.Nil(serv.scout)
+	assert.Nil(s.AddService(valid))
+
+	f, err := ioutil.TempFile("", "scout-*.yml")
+	assert.Nil(err)
+	defer os.Remove(f.Name())
+	f.WriteString("- id: 7d444840-9dc0-11d1-b245-5ffdce74fad2\n  name: API\n  type: http\n  address: https://api.example\n  checkInterval: 30s\n- name: Cache\n  type: redis\n  checkInterval: 30s\n")
+	f.Close()
+	_, err = LoadConfig(f.Name())
+	assert.True(errors.Is(err, ErrInvalidAddress))
+	assert.Contains(err.Error(), "Cache")
+
+	assert.Nil(ioutil.WriteFile(f.Name(), []byte("- name: API\n  type: http\n  address: https://api.example\n  checkInterval: 30s\n"), 0600))
+	servs, err := LoadConfig(f.Name())
+	assert.Nil(err)
+	if assert.Len(servs, 1) {
+		assert.Equal(Duration(30*time.Second), servs[0].Interval)
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpls := Templates{
+		Defaults: &Service{Interval: Duration(time.Minute), Tags: map[string]string{"env": "prod", "team": "ops"}},
+		Templates: map[string]*Service{
+			"https": {Type: "http", Method: "GET", Timeout: Duration(5 * time.Second)},
+			"https-prod": {
+				Template:       "https",
+				ExpectedStatus: 200,
+				Retry:          true,
+				RetryStrategy:  RetryFixed,
+				Headers:        http.Header{"Accept": {"application/json"}},
+				Tags:           map[string]string{"team": "web"},
+			},
+		},
+	}
+	api := &Service{ID: uuid.New(), Name: "API", Address: "https://api.example", Template: "https-prod", Timeout: Duration(time.Second), Tags: map[string]string{"tier": "1"}}
+	s, err := NewScout([]*Service{api}, NewSlogLogger(nil), WithTemplates(tmpls))
+	assert.Nil(err)
+	assert.Equal("http", api.Type)
+	assert.Equal("GET", api.Method)
+	assert.Equal(200, api.ExpectedStatus)
+	assert.Equal(Duration(time.Second), api.Timeout)
+	assert.Equal(Duration(time.Minute), api.Interval)
+	assert.True(api.Retry)
+	assert.Equal(map[string]string{"env": "prod", "team": "web", "tier": "1"}, api.Tags)
+	// the service does not share the maps of its templates
+	api.Headers.Set("Accept", "text/plain")
+	assert.Equal("application/json", tmpls.Templates["https-prod"].Headers.Get("Accept"))
+
+	err = s.AddService(&Service{ID: uuid.New(), Name: "Web", Address: "https://web.example", Template: "http-staging"})
+	assert.True(errors.Is(err, ErrUnknownTemplate))
+	_, err = NewScout(nil, NewSlogLogger(nil), WithTemplates(Templates{Templates: map[string]*Service{"a": {Template: "b"}, "b": {Template: "a"}}}))
+	assert.True(errors.Is(err, ErrTemplateCycle))
+
+	f, err := ioutil.TempFile("", "scout-*.yml")
+	assert.Nil(err)
+	defer os.Remove(f.Name())
+	f.WriteString("defaults:\n  checkInterval: 30s\ntemplates:\n  https-prod:\n    type: http\n    expectedStatus: 200\nservices:\n- name: API\n  template: https-prod\n  address: https://api.example\n- name: Cache\n  type: redis\n  address: cache:6379\n")
+	f.Close()
+	servs, err := LoadConfig(f.Name())
+	assert.Nil(err)
+	if assert.Len(servs, 2) {
+		assert.Equal("http", servs[0].Type)
+		assert.Equal(200, servs[0].ExpectedStatus)
+		assert.Equal(Duration(30*time.Second), servs[0].Interval)
+		assert.Equal(Duration(30*time.Second), servs[1].Interval)
+	}
+}
+
+func TestDirectoryDiscovery(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "targets.d")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	write := func(name, content string) {
+		assert.Nil(ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+	write("api.yml", "name: API\ntemplate: https\naddress: https://api.example\n")
+	write("caches.yaml", "defaults:\n  type: redis\n  checkInterval: 1h\nservices:\n- name: Cache A\n  address: a:6379\n- name: Cache B\n  address: b:6379\n")
+	write("README.md", "not a service")
+
+	s, err := NewScout(nil, NewSlogLogger(nil),
+		WithTemplates(Templates{Templates: map[string]*Service{"https": {Type: "http", Interval: Duration(time.Hour)}}}),
+		WithDiscovery("targets.d", &DirectoryDiscovery{Dir: dir}, 10*time.Millisecond),
+	)
+	assert.Nil(err)
+	s.StartScoutingServices()
+	defer s.StopScoutingServices()
+	assert.Eventually(func() bool { return s.GetServiceByExternalID("file:caches.yaml#1") != nil }, time.Second, 5*time.Millisecond)
+	if api := s.GetServiceByExternalID("file:api.yml"); assert.NotNil(api) {
+		assert.Equal("http", api.Type)
+	}
+	assert.Equal("redis", s.GetServiceByExternalID("file:caches.yaml#0").Type)
+
+	// a file that can not be parsed keeps the services, a removed file removes its services
+	write("broken.yml", "name: [")
+	assert.Nil(os.Remove(filepath.Join(dir, "caches.yaml")))
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(s.GetServices(), 3)
+	assert.Nil(os.Remove(filepath.Join(dir, "broken.yml")))
+	assert.Eventually(func() bool { return len(s.GetServices()) == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestDuplicatePolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	newServs := func() []*Service {
+		return []*Service{
+			{ID: uuid.New(), Name: "One", Address: "scout.example", Type: "icmp"},
+			{ID: uuid.New(), Name: "Two", Address: "scout.example", Type: "icmp"},
+		}
+	}
+
+	s, err := NewScout(newServs(), NewSlogLogger(nil))
+	assert.Nil(err)
+	assert.Len(s.Services, 2)
+	assert.Len(s.Duplicates(), 1)
+
+	s, err = NewScout(newServs(), NewSlogLogger(nil), WithDuplicatePolicy(DuplicateMerge))
+	assert.Nil(err)
+	assert.Len(s.Services, 1)
+
+	servs := newServs()
+	s, err = NewScout(servs, NewSlogLogger(nil), WithDuplicatePolicy(DuplicateShare))
+	assert.Nil(err)
+	assert.Len(s.Services, 2)
+	go servs[0].Success()
+	first, second := (<-s.Responses).(ServiceSuccess), (<-s.Responses).(ServiceSuccess)
+	assert.Equal(servs[0].ID, first.Service)
+	assert.Equal(servs[1].ID, second.Service)
+	assert.True(servs[1].Online)
+
+	s.DelService(servs[0].ID)
+	assert.Nil(servs[1].primary)
+
+	// services that only differ in what they probe beyond the address are not duplicates
+	s, err = NewScout([]*Service{
+		{ID: uuid.New(), Name: "Orders", Type: "postgres", DSN: "postgres://orders.example/orders"},
+		{ID: uuid.New(), Name: "Billing", Type: "postgres", DSN: "postgres://billing.example/billing"},
+		{ID: uuid.New(), Name: "Edge A", Type: "http", Address: "https://scout.example", ResolveTo: "192.0.2.1"},
+		{ID: uuid.New(), Name: "Edge B", Type: "http", Address: "https://scout.example", ResolveTo: "192.0.2.2"},
+	}, NewSlogLogger(nil), WithDuplicatePolicy(DuplicateShare))
+	assert.Nil(err)
+	assert.Empty(s.Duplicates())
+	for _, serv := range s.Services {
+		assert.Nil(serv.primary)
+	}
+
+	// merging reports the duplicate instead of silently dropping it
+	s, err = NewScout(nil, NewSlogLogger(nil), WithDuplicatePolicy(DuplicateMerge))
+	assert.Nil(err)
+	servs = newServs()
+	servs[0].Interval, servs[1].Interval = Duration(time.Minute), Duration(time.Hour)
+	assert.Nil(s.AddService(servs[0]))
+	assert.True(errors.Is(s.AddService(servs[1]), ErrDuplicateTarget))
+	assert.Len(s.Services, 1)
+
+	// the target is released even when the config changed after adding
+	servs[0].Address = "other.example"
+	s.DelService(servs[0].ID)
+	assert.Nil(s.AddService(servs[1]))
+}
+
+func TestWatchdog(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewScout(nil, NewSlogLogger(nil), WithWatchdog(0, false))
+	assert.NotNil(err)
+
+	serv := &Service{ID: uuid.New(), Name: "Hung", Address: "scout.example", Type: "icmp", Interval: Duration(time.Second), Timeout: Duration(time.Second)}
+	s, err := NewScout([]*Service{serv}, NewSlogLogger(nil), WithWatchdog(3, false))
+	assert.Nil(err)
+	serv.Start()
+	serv.beat(time.Second)
+
+	go s.checkStalled(time.Now().Add(10 * time.Second))
+	stalled, ok := (<-s.Responses).(ServiceStalled)
+	assert.True(ok)
+	assert.Equal(serv.ID, stalled.Service)
+	assert.False(stalled.Restarted)
+
+	// a stall is only reported once until the service completes a check again
+	_, ok = serv.stalledSince(time.Now().Add(time.Second), 3)
+	assert.False(ok)
+	s.checkStalled(time.Now().Add(20 * time.Second))
+	serv.Stop()
+}
+
+func TestWatchdogRestart(t *testing.T) {
+	assert := assert.New(t)
+
+	hung := make(chan struct{})
+	checks := int32(0)
+	serv := &Service{ID: uuid.New(), Name: "Hung", Address: "scout.example", Type: "icmp", Interval: Duration(10 * time.Millisecond), Timeout: Duration(time.Hour)}
+	serv.Middleware = []Middleware{func(next CheckFunc) CheckFunc {
+		return func(s *Service) {
+			if atomic.AddInt32(&checks, 1) == 1 {
+				close(hung)
+				<-s.context().Done()
+				return
+			}
+			s.Success()
+		}
+	}}
+	s, err := NewScout([]*Service{serv}, NewSlogLogger(nil), WithWatchdog(1, true), WithResultBuffer(8))
+	assert.Nil(err)
+	go serv.Scout()
+	defer serv.Stop()
+	<-hung
+
+	// the hung check is cancelled and the loop of the service carries on checking
+	s.checkStalled(time.Now().Add(3 * time.Hour))
+	stalled, ok := (<-s.Responses).(ServiceStalled)
+	assert.True(ok)
+	assert.True(stalled.Restarted)
+	_, ok = (<-s.Responses).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal(int64(1), atomic.LoadInt64(&s.loops))
+}
+
+func TestUpdateService(t *testing.T) {
+	assert := assert.New(t)
+
+	one := &Service{ID: uuid.New(), Name: "One", Address: "one.example", Type: "icmp", Interval: Duration(time.Hour)}
+	two := &Service{ID: uuid.New(), Name: "Two", Address: "two.example", Type: "icmp", Interval: Duration(time.Hour)}
+	s, err := NewScout([]*Service{one, two}, NewSlogLogger(nil), WithDuplicatePolicy(DuplicateMerge))
+	assert.Nil(err)
+	go func() {
+		for range s.Responses {
+		}
+	}()
+	s.StartScoutingServices()
+	defer s.StopScoutingServices()
+	running := func() bool { return s.Health().ServiceLoops == 2 }
+	assert.Eventually(running, time.Second, time.Millisecond)
+
+	// a service that can not be added does not replace the running one
+	for _, update := range []*Service{
+		{ID: one.ID, Name: "One", Type: "icmp", Interval: Duration(time.Hour)},
+		{ID: one.ID, Name: "One", Address: "one.example", Type: "http", Headers: http.Header{"X-Api-Key": {"${env:SCOUT_TEST_MISSING}"}}, Interval: Duration(time.Hour)},
+		{ID: one.ID, Name: "One", Address: "two.example", Type: "icmp", Interval: Duration(time.Hour)},
+	} {
+		assert.NotNil(s.UpdateService(update))
+		assert.Equal(one, s.GetService(one.ID))
+		assert.True(running())
+	}
+	assert.True(errors.Is(s.UpdateService(&Service{ID: one.ID, Name: "One", Address: "two.example", Type: "icmp", Interval: Duration(time.Hour)}), ErrDuplicateTarget))
+
+	// a service keeps its target when it is replaced
+	update := &Service{ID: one.ID, Name: "Uno", Address: "one.example", Type: "icmp", Interval: Duration(time.Hour)}
+	assert.Nil(s.UpdateService(update))
+	assert.Equal(update, s.GetService(one.ID))
+	assert.Eventually(running, time.Second, time.Millisecond)
+	assert.True(errors.Is(s.UpdateService(&Service{ID: uuid.New(), Name: "Three"}), ErrUnknownService))
+}
+
+func TestExpireRemove(t *testing.T) {
+	assert := assert.New(t)
+
+	one := &Service{ID: uuid.New(), ExternalID: "cmdb-1", Name: "One", Address: "scout.example", Type: "icmp", Interval: Duration(time.Hour)}
+	two := &Service{ID: uuid.New(), Name: "Two", Address: "scout.example", Type: "icmp", Interval: Duration(time.Hour)}
+	s, err := NewScout([]*Service{one, two}, NewSlogLogger(nil), WithDuplicatePolicy(DuplicateShare), WithResultBuffer(8))
+	assert.Nil(err)
+	assert.Equal(one, two.primary)
+
+	// a expired service is removed like a deleted one, its follower takes over its target
+	one.ExpiresAt = time.Now()
+	one.expire()
+	assert.IsType(ServiceExpired{}, <-s.Responses)
+	assert.Nil(s.GetService(one.ID))
+	assert.Nil(s.GetServiceByExternalID("cmdb-1"))
+	assert.Nil(two.primary)
+	assert.Equal(two, s.targets[two.targetKey()])
+}
+
+func TestExternalID(t *testing.T) {
+	assert := assert.New(t)
+
+	ns := uuid.MustParse("6ba7b811-9dad-11d1-80b4-00c04fd430c8")
+	servs := []*Service{
+		{ExternalID: "cmdb-1", Name: "One", Address: "one.example", Type: "icmp"},
+		{ExternalID: "cmdb-2", Name: "Two", Address: "two.example", Type: "icmp"},
+	}
+	s, err := NewScout(servs, NewSlogLogger(nil), WithIDStrategy(ExternalIDs(ns)))
+	assert.Nil(err)
+	assert.Equal(uuid.NewSHA1(ns, []byte("cmdb-1")), servs[0].ID)
+	assert.Equal(servs[1], s.GetServiceByExternalID("cmdb-2"))
+	assert.Nil(s.GetServiceByExternalID("cmdb-3"))
+
+	err = s.AddService(&Service{ID: uuid.New(), ExternalID: "cmdb-1", Address: "three.example", Type: "icmp"})
+	assert.True(errors.Is(err, ErrDuplicateExternalID))
+
+	update := &Service{ExternalID: "cmdb-1", Name: "One", Address: "uno.example", Type: "icmp", Interval: Duration(time.Minute)}
+	assert.Nil(s.UpdateServiceByExternalID(update))
+	assert.Equal(servs[0].ID, update.ID)
+	assert.Equal(update, s.GetService(servs[0].ID))
+	assert.Len(s.Services, 2)
+
+	err = s.UpdateServiceByExternalID(&Service{ExternalID: "cmdb-3"})
+	assert.True(errors.Is(err, ErrUnknownExternalID))
+
+	// a service that can not be added does not replace the one with the external ID
+	assert.NotNil(s.UpdateServiceByExternalID(&Service{ExternalID: "cmdb-1", Name: "One", Type: "icmp"}))
+	assert.Equal(update, s.GetServiceByExternalID("cmdb-1"))
+
+	s.DelServiceByExternalID("cmdb-2")
+	assert.Nil(s.GetServiceByExternalID("cmdb-2"))
+	assert.Len(s.Services, 1)
+}
+
+func TestSummary(t *testing.T) {
+	assert := assert.New(t)
+
+	servs := []*Service{
+		{ID: uuid.New(), Name: "Up", Address: "up.example", Type: "icmp"},
+		{ID: uuid.New(), Name: "Down", Address: "down.example", Type: "icmp"},
+		{ID: uuid.New(), Name: "Flaky", Address: "flaky.example", Type: "icmp"},
+		{ID: uuid.New(), Name: "New", Address: "new.example", Type: "icmp"},
+		{ID: uuid.New(), Name: "Paused", Address: "paused.example", Type: "icmp", Paused: true},
+	}
+	s, err := NewScout(servs, NewSlogLogger(nil))
+	assert.Nil(err)
+	go func() {
+		for range s.Responses {
+		}
+	}()
+	servs[0].Success()
+	servs[2].Failure("timeout")
+	time.Sleep(time.Millisecond)
+	servs[1].Failure("connection refused")
+	servs[2].Success()
+
+	sum := s.Summary(1)
+	assert.Equal(5, sum.Total)
+	assert.Equal(2, sum.Online)
+	assert.Equal(1, sum.Offline)
+	assert.Equal(1, sum.Paused)
+	assert.Equal(1, sum.Pending)
+	assert.Equal(uint64(4), sum.Checks)
+	if assert.Len(sum.RecentFailures, 1) {
+		assert.Equal(servs[1].ID, sum.RecentFailures[0].ID)
+		assert.Equal("connection refused", sum.RecentFailures[0].Issue)
+	}
+}
+
+func TestSchedulerTick(t *testing.T) {
+	assert := assert.New(t)
+
+	w := newTimingWheel(20 * time.Millisecond)
+	first, second := make(chan time.Time, 1), make(chan time.Time, 1)
+	w.schedule(first, 5*time.Millisecond)
+	w.schedule(second, 15*time.Millisecond)
+	// both are due within the first tick so they are woken up together
+	a, b := <-first, <-second
+	assert.Equal(a, b)
+
+	// a wake up scheduled between two ticks is not woken before d has passed
+	w = newTimingWheel(50 * time.Millisecond)
+	w.schedule(make(chan time.Time, 1), time.Minute)
+	time.Sleep(30 * time.Millisecond)
+	due := make(chan time.Time, 1)
+	start := time.Now()
+	w.schedule(due, 50*time.Millisecond)
+	assert.True((<-due).Sub(start) >= 50*time.Millisecond)
+
+	// the wheel does not tick on its own within the test, it is advanced by hand
+	w = newTimingWheel(time.Hour)
+	late := make(chan time.Time, 1)
+	w.schedule(late, time.Duration(wheelSlots+1)*w.tick)
+	for i := 0; i < wheelSlots; i++ {
+		w.advance(time.Now())
+	}
+	assert.Len(late, 0)
+	w.advance(time.Now())
+	assert.Len(late, 1)
+
+	s, err := NewScout(nil, NewSlogLogger(nil), WithSchedulerTick(0))
+	assert.Nil(err)
+	assert.Equal(DefaultSchedulerTick, s.wheel.tick)
+}
+
+func TestStartJitter(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewScout(nil, NewSlogLogger(nil), WithStartJitter(1.5))
+	assert.NotNil(err)
+
+	serv := &Service{ID: uuid.New(), Name: "Staggered", Type: "heartbeat", Interval: Duration(time.Minute)}
+	s, err := NewScout([]*Service{serv}, NewSlogLogger(nil), WithStartJitter(0.5))
+	assert.Nil(err)
+	delays := map[time.Duration]bool{}
+	for i := 0; i < 20; i++ {
+		delay := serv.startDelay()
+		assert.True(delay >= 0 && delay < 30*time.Second)
+		delays[delay] = true
+	}
+	assert.True(len(delays) > 1)
+
+	// the first check waits for its delay and expiring during the wait ends the loop
+	s.startJitter = 1
+	serv.Interval = Duration(time.Hour)
+	serv.ExpiresAt = time.Now().Add(20 * time.Millisecond)
+	serv.ExpireAction = ExpirePause
+	serv.Responses = make(chan interface{}, 1)
+	checked := make(chan struct{}, 1)
+	serv.Middleware = []Middleware{func(next CheckFunc) CheckFunc {
+		return func(s *Service) { checked <- struct{}{} }
+	}}
+	serv.Scout()
+	assert.Len(checked, 0)
+	assert.IsType(ServiceExpired{}, <-serv.Responses)
+}
+
+func TestRateLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewScout(nil, NewSlogLogger(nil), WithRateLimit(0, 1))
+	assert.NotNil(err)
+	_, err = NewScout(nil, NewSlogLogger(nil), WithHostRateLimit(1, 0))
+	assert.NotNil(err)
+
+	// a burst is allowed right away, further checks wait for the refill
+	l := newRateLimiter(10, 2)
+	now := time.Now()
+	assert.Equal(time.Duration(0), l.reserve(now))
+	assert.Equal(time.Duration(0), l.reserve(now))
+	assert.Equal(100*time.Millisecond, l.reserve(now))
+	assert.Equal(200*time.Millisecond, l.reserve(now))
+	assert.Equal(100*time.Millisecond, l.reserve(now.Add(200*time.Millisecond)))
+
+	// hosts are limited on their own and all together by the global limit
+	s, err := NewScout(nil, NewSlogLogger(nil), WithHostRateLimit(1, 1), WithRateLimit(100, 3))
+	assert.Nil(err)
+	assert.Equal(time.Duration(0), s.rateLimits.reserve("api.example", now))
+	assert.Equal(time.Second, s.rateLimits.reserve("API.example", now))
+	assert.Equal(time.Duration(0), s.rateLimits.reserve("db.example", now))
+	assert.Equal(10*time.Millisecond, s.rateLimits.reserve("", now))
+
+	// checks of services sharing a host are spaced by the limit
+	s, err = NewScout(nil, NewSlogLogger(nil), WithHostRateLimit(20, 1))
+	assert.Nil(err)
+	servs := []*Service{
+		{ID: uuid.New(), Name: "One", Type: "tcp", Address: "shared.example"},
+		{ID: uuid.New(), Name: "Two", Type: "tcp", Address: "shared.example"},
+	}
+	start := time.Now()
+	for _, serv := range servs {
+		serv.scout, serv.Logger = s, s.Logger
+		assert.True(serv.throttle())
+	}
+	assert.True(time.Since(start) >= 40*time.Millisecond)
+
+	// a cancelled reservation gives its token back
+	l = newRateLimiter(10, 1)
+	assert.Equal(time.Duration(0), l.reserve(now))
+	assert.Equal(100*time.Millisecond, l.reserve(now))
+	l.cancel()
+	assert.Equal(100*time.Millisecond, l.reserve(now))
+
+	// stopping or aborting a throttled check ends the wait and gives the reservation back
+	s, err = NewScout(nil, NewSlogLogger(nil), WithHostRateLimit(1, 1))
+	assert.Nil(err)
+	waiting := &Service{ID: uuid.New(), Name: "Waiting", Type: "tcp", Address: "slow.example", scout: s, Logger: s.Logger}
+	waiting.Start()
+	assert.True(waiting.throttle())
+	for _, stop := range []func(){waiting.Stop, func() { waiting.abort() }} {
+		throttled := make(chan bool)
+		go func() { throttled <- waiting.throttle() }()
+		time.Sleep(20 * time.Millisecond)
+		start = time.Now()
+		stop()
+		assert.False(<-throttled)
+		assert.True(time.Since(start) < 500*time.Millisecond)
+		waiting.Start()
+	}
+	assert.True(s.rateLimits.reserve("slow.example", time.Now()) <= time.Second)
+
+	// the limiter of a host goes with the last service checking it
+	s, err = NewScout(nil, NewSlogLogger(nil), WithHostRateLimit(1, 1))
+	assert.Nil(err)
+	servs = []*Service{
+		{ID: uuid.New(), Name: "One", Type: "http", Address: "http://shared.example/one", Interval: Duration(time.Minute)},
+		{ID: uuid.New(), Name: "Two", Type: "http", Address: "http://shared.example/two", Interval: Duration(time.Minute)},
+	}
+	for _, serv := range servs {
+		assert.Nil(s.AddService(serv))
+		s.rateLimits.reserve(serv.parseHost(), now)
+	}
+	s.DelService(servs[0].ID)
+	assert.Contains(s.rateLimits.hosts, "shared.example")
+	s.DelService(servs[1].ID)
+	assert.NotContains(s.rateLimits.hosts, "shared.example")
+}
+
+func TestTimeline(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewScout(nil, NewSlogLogger(nil), WithTimeline(Retention{Raw: Duration(time.Hour)}))
+	assert.NotNil(err)
+
+	serv := &Service{ID: uuid.New(), Name: "Kept", Type: "heartbeat"}
+	s, err := NewScout([]*Service{serv}, NewSlogLogger(nil))
+	assert.Nil(err)
+	_, err = s.Timeline(serv.ID)
+	assert.True(errors.Is(err, ErrNoTimeline))
+
+	day := 24 * time.Hour
+	s, err = NewScout([]*Service{serv}, NewSlogLogger(nil), WithResultBuffer(4), WithTimeline(Retention{Raw: Duration(7 * day), Rollup: Duration(time.Hour), Rollups: Duration(90 * day)}))
+	assert.Nil(err)
+	serv.RequestLatency = 20
+	serv.Success()
+	serv.Failure("down")
+	tl, err := s.Timeline(serv.ID)
+	assert.Nil(err)
+	if assert.Len(tl.Points, 2) {
+		assert.True(tl.Points[0].Up)
+		assert.False(tl.Points[1].Up)
+	}
+	_, err = s.Timeline(uuid.New())
+	assert.True(errors.Is(err, ErrUnknownService))
+
+	// checks past the raw retention are downsampled into hourly rollups
+	now := time.Date(2020, 1, 10, 12, 0, 0, 0, time.UTC)
+	s.timeline.services[serv.ID].points = []TimelinePoint{
+		{Time: now.Add(-8*day + 10*time.Minute), Up: true, Latency: 10},
+		{Time: now.Add(-8*day + 20*time.Minute), Up: false, Latency: 30},
+		{Time: now.Add(-8*day + 70*time.Minute), Up: true, Latency: 5},
+		{Time: now.Add(-time.Hour), Up: true, Latency: 7},
+	}
+	s.PruneTimeline(now)
+	tl, _ = s.Timeline(serv.ID)
+	assert.Len(tl.Points, 1)
+	if assert.Len(tl.Rollups, 2) {
+		assert.Equal(TimelineRollup{Start: now.Add(-8 * day), Width: Duration(time.Hour), Checks: 2, Failures: 1, Latency: 20, MaxLatency: 30}, tl.Rollups[0])
+		assert.Equal(uint64(1), tl.Rollups[1].Checks)
+	}
+
+	// rollups past their retention are dropped
+	s.PruneTimeline(now.Add(91 * day))
+	tl, _ = s.Timeline(serv.ID)
+	assert.Empty(tl.Rollups)
+	assert.Empty(tl.Points)
+}
+
+func TestHealth(t *testing.T) {
+	assert := assert.New(t)
+
+	serv := &Service{ID: uuid.New(), Name: "Monitored", Type: "heartbeat", Interval: Duration(time.Hour), ExpireAction: ExpirePause}
+	sent := make(chan struct{}, 8)
+	s, err := NewScout([]*Service{serv}, NewSlogLogger(nil), WithResultBuffer(8),
+		WithTimeline(Retention{Raw: Duration(time.Hour), Rollup: Duration(time.Minute), Rollups: Duration(time.Hour)}),
+		WithNotifier("broken", NotifierFunc(func(n Notification) error {
+			sent <- struct{}{}
+			return errors.New("unreachable")
+		})),
+		WithRoutes(Route{Name: "all", Notifiers: []string{"broken"}}),
+	)
+	assert.Nil(err)
+
+	serv.Failure("down")
+	<-sent
+	serv.CaptureDebug(1)
+	serv.Check()
+	serv.beat(time.Minute)
+	serv.recordLag(time.Now().Add(time.Minute + time.Second))
+
+	// the loop counts while it runs and stops counting once it expired
+	serv.ExpiresAt = time.Now().Add(50 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		serv.Scout()
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	h := s.Health()
+	assert.Equal(int64(1), h.ServiceLoops)
+	<-done
+	h = s.Health()
+	assert.Equal(int64(0), h.ServiceLoops)
+	assert.True(h.NotifierFailures >= 1)
+	assert.True(h.MaxSchedulerLag >= Duration(time.Second))
+	assert.Equal(h.MaxSchedulerLag, h.MeanSchedulerLag)
+	assert.True(h.HistoryEntries >= 2)
+	assert.True(h.HistoryBytes > 0)
+
+	rec := httptest.NewRecorder()
+	s.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(rec.Body.String(), "# TYPE scout_dropped_results_total counter\nscout_dropped_results_total 0\n")
+	assert.Contains(rec.Body.String(), "scout_service_loops 0\n")
+}
+
+type pingNotifier struct{ err error }
+
+func (n *pingNotifier) Notify(Notification) error { return nil }
+func (n *pingNotifier) Ping() error               { return n.err }
+
+func TestProbes(t *testing.T) {
+	assert := assert.New(t)
+
+	sent := make(chan struct{}, 8)
+	pinger := &pingNotifier{}
+	s, err := NewScout(nil, NewSlogLogger(nil),
+		WithNotifier("pager", pinger),
+		WithNotifier("chat", NotifierFunc(func(n Notification) error {
+			defer func() { sent <- struct{}{} }()
+			if n.Severity == SeverityFailure {
+				return errors.New("unreachable")
+			}
+			return nil
+		})),
+		WithRoutes(Route{Name: "all", Notifiers: []string{"chat"}}),
+	)
+	assert.Nil(err)
+
+	probe := func(h http.Handler) (int, string) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	// not live nor ready before the scheduler runs
+	code, body := probe(s.HealthzHandler())
+	assert.Equal(http.StatusServiceUnavailable, code)
+	assert.Contains(body, "[-]scheduler failed: not running\n")
+	s.StartScoutingServices()
+	defer s.StopScoutingServices()
+	code, body = probe(s.HealthzHandler())
+	assert.Equal(http.StatusOK, code)
+	assert.Equal("[+]scheduler ok\n[+]loops ok\nok\n", body)
+	code, _ = probe(s.ReadyzHandler())
+	assert.Equal(http.StatusOK, code)
+
+	// a failing ping or a failed notification makes the scout unready until it delivers again
+	pinger.err = errors.New("no route to host")
+	code, body = probe(s.ReadyzHandler())
+	assert.Equal(http.StatusServiceUnavailable, code)
+	assert.Contains(body, "[-]notifier pager failed: no route to host\n")
+	pinger.err = nil
+
+	id := uuid.New()
+	s.notify(ServiceFailure{Service: id, Issue: "down", CreatedAt: time.Now()})
+	<-sent
+	assert.Eventually(func() bool {
+		code, body = probe(s.ReadyzHandler())
+		return code == http.StatusServiceUnavailable
+	}, time.Second, time.Millisecond)
+	assert.Contains(body, "[-]notifier chat failed: unreachable\n")
+	code, _ = probe(s.HealthzHandler())
+	assert.Equal(http.StatusOK, code)
+
+	s.notify(ServiceSuccess{Service: id, CreatedAt: time.Now()})
+	<-sent
+	assert.Eventually(func() bool {
+		code, _ = probe(s.ReadyzHandler())
+		return code == http.StatusOK
+	}, time.Second, time.Millisecond)
+}
+
+func TestDrain(t *testing.T) {
+	assert := assert.New(t)
+
+	serv := &Service{ID: uuid.New(), Name: "Slow", Type: "heartbeat", Interval: Duration(time.Hour)}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	sent := make(chan Notification, 1)
+	s, err := NewScout([]*Service{serv}, NewSlogLogger(nil), WithResultBuffer(8),
+		WithMiddleware(func(next CheckFunc) CheckFunc {
+			return func(serv *Service) {
+				close(started)
+				<-release
+				serv.Failure("down")
+			}
+		}),
+		WithNotifier("pager", NotifierFunc(func(n Notification) error {
+			time.Sleep(20 * time.Millisecond)
+			sent <- n
+			return nil
+		})),
+		WithRoutes(Route{Name: "all", Notifiers: []string{"pager"}}),
+	)
+	assert.Nil(err)
+
+	s.StartScoutingServices()
+	<-started
+
+	// a drain gives up on a check that does not finish in time
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	err = s.Drain(ctx)
+	cancel()
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+	assert.False(s.Running)
+
+	// and waits for the check in flight and the notification it queued
+	close(release)
+	assert.Nil(s.Drain(context.Background()))
+	assert.Len(sent, 1)
+}
+
+func TestPause(t *testing.T) {
+	assert := assert.New(t)
+
+	serv := &Service{ID: uuid.New(), Name: "Cron", Type: "heartbeat", Interval: Duration(time.Hour)}
+	s, err := NewScout([]*Service{serv}, NewSlogLogger(nil))
+	assert.Nil(err)
+	loops := func(n int64) func() bool {
+		return func() bool { return s.Health().ServiceLoops == n }
+	}
+	s.StartScoutingServices()
+	defer s.StopScoutingServices()
+	assert.Eventually(loops(1), time.Second, time.Millisecond)
+
+	assert.Nil(s.Pause(serv.ID))
+	assert.True(serv.Snapshot().Paused)
+	assert.Eventually(loops(0), time.Second, time.Millisecond)
+
+	assert.Nil(s.Resume(serv.ID))
+	assert.False(serv.Snapshot().Paused)
+	assert.Eventually(loops(1), time.Second, time.Millisecond)
+
+	assert.True(errors.Is(s.Pause(uuid.New()), ErrUnknownService))
+	assert.True(errors.Is(s.Resume(uuid.New()), ErrUnknownService))
+}
+
+func TestDependsOn(t *testing.T) {
+	assert := assert.New(t)
+
+	lb := &Service{ID: uuid.New(), Name: "LB", Address: "lb.example", Type: "tcp"}
+	app := &Service{ID: uuid.New(), Name: "App", Address: "app.example", Type: "tcp", DependsOn: []uuid.UUID{lb.ID}}
+	api := &Service{ID: uuid.New(), Name: "API", Address: "api.example", Type: "tcp", DependsOn: []uuid.UUID{app.ID}}
+	s, err := NewScout([]*Service{lb, app, api}, NewSlogLogger(nil))
+	assert.Nil(err)
+	for _, serv := range s.Services {
+		serv.Responses = make(chan interface{}, 1)
+	}
+	assert.Equal([]uuid.UUID{api.ID}, s.Dependents(app.ID))
+
+	// with its dependencies up a failure is reported on its own
+	api.Failure("connection refused")
+	fail := (<-api.Responses).(ServiceFailure)
+	assert.False(fail.Suppressed)
+	assert.Equal(uuid.Nil, fail.RootCause)
+
+	// the furthest upstream service that is down is the root cause
+	lb.Failure("connection refused")
+	<-lb.Responses
+	app.Failure("connection refused")
+	fail = (<-app.Responses).(ServiceFailure)
+	assert.True(fail.Suppressed)
+	assert.Equal(lb.ID, fail.RootCause)
+	api.Failure("connection refused")
+	fail = (<-api.Responses).(ServiceFailure)
+	assert.True(fail.Suppressed)
+	assert.Equal(lb.ID, fail.RootCause)
+
+	lb.Success()
+	<-lb.Responses
+	api.Failure("connection refused")
+	fail = (<-api.Responses).(ServiceFailure)
+	assert.Equal(app.ID, fail.RootCause)
+
+	// a service may not depend on itself through other services
+	cycle := &Service{ID: uuid.New(), Name: "Cycle", Address: "cycle.example", Type: "tcp"}
+	lb.DependsOn = []uuid.UUID{cycle.ID}
+	cycle.DependsOn = []uuid.UUID{api.ID}
+	assert.True(errors.Is(s.AddService(cycle), ErrDependencyCycle))
+}
+
+func TestGroups(t *testing.T) {
+	assert := assert.New(t)
+
+	api := &Service{ID: uuid.New(), Name: "API", Address: "api.example", Type: "tcp"}
+	db := &Service{ID: uuid.New(), Name: "DB", Address: "db.example", Type: "tcp"}
+	cdn := &Service{ID: uuid.New(), Name: "CDN", Address: "cdn.example", Type: "tcp"}
+	s, err := NewScout([]*Service{api, db, cdn}, NewSlogLogger(nil))
+	assert.Nil(err)
+	s.Responses = make(chan interface{}, 10)
+	for _, serv := range s.Services {
+		serv.Responses = s.Responses
+	}
+	checkout := &Group{Name: "Checkout", Members: []uuid.UUID{api.ID, db.ID, cdn.ID}, SLO: &SLO{Target: 99.9, Window: Duration(720 * time.Hour)}}
+	assert.Nil(s.AddGroup(checkout))
+	edges := &Group{Name: "Edges", Members: []uuid.UUID{api.ID, cdn.ID}, Policy: GroupAny}
+	assert.Nil(s.AddGroup(edges))
+	assert.True(errors.Is(s.AddGroup(&Group{ID: checkout.ID}), ErrDuplicateGroupID))
+	assert.True(errors.Is(s.AddGroup(&Group{Policy: GroupPercentage}), ErrInvalidGroupPolicy))
+
+	statuses := func() map[string]string {
+		byName := make(map[string]string)
+		for len(s.Responses) > 0 {
+			if st, ok := (<-s.Responses).(GroupStatus); ok {
+				byName[st.Name] = st.Status
+			}
+		}
+		return byName
+	}
+
+	api.Success()
+	db.Success()
+	assert.Equal(map[string]string{"Checkout": GroupUp, "Edges": GroupUp}, statuses())
+	cdn.Success()
+	// all members were online already, nothing changed
+	assert.Empty(statuses())
+
+	cdn.Degraded("slow")
+	assert.Equal(map[string]string{"Checkout": GroupDegraded, "Edges": GroupDegraded}, statuses())
+
+	api.Failure("connection refused")
+	assert.Equal(map[string]string{"Checkout": GroupDown}, statuses())
+	st, err := s.GroupStatus(edges.ID)
+	assert.Nil(err)
+	assert.Equal(GroupDegraded, st.Status)
+	assert.Equal(1, st.Offline)
+	assert.Equal(1, st.Degraded)
+
+	cdn.Failure("connection refused")
+	assert.Equal(map[string]string{"Edges": GroupDown}, statuses())
+
+	s.DelGroup(edges.ID)
+	assert.Nil(s.GetGroup(edges.ID))
+	_, err = s.GroupStatus(edges.ID)
+	assert.True(errors.Is(err, ErrUnknownGroup))
+	assert.Equal("Checkout", s.GetGroup(checkout.ID).Name)
+
+	// the group SLO counts a check for every member result
+	slo, err := s.SLOStatus(checkout.ID)
+	assert.Nil(err)
+	assert.Equal(uint64(4), slo.Good)
+	assert.Equal(uint64(2), slo.Bad)
+}
+
+func TestTags(t *testing.T) {
+	assert := assert.New(t)
+
+	web := &Service{ID: uuid.New(), Name: "Web", Address: "web.example", Type: "tcp", Tags: map[string]string{"team": "payments", "env": "prod"}}
+	stage := &Service{ID: uuid.New(), Name: "Stage", Address: "stage.example", Type: "tcp", Tags: map[string]string{"team": "payments", "env": "staging"}}
+	search := &Service{ID: uuid.New(), Name: "Search", Address: "search.example", Type: "tcp", Tags: map[string]string{"team": "search", "env": "prod", "region": "eu"}}
+	s, err := NewScout([]*Service{web, stage, search}, NewSlogLogger(nil))
+	assert.Nil(err)
+
+	assert.Equal([]*Service{stage, web}, s.GetServicesByTag("team", "payments"))
+	assert.Equal([]*Service{search}, s.GetServicesByTag("region", ""))
+	filter, err := ParseTagFilter("env=prod, team")
+	assert.Nil(err)
+	assert.Equal([]*Service{search, web}, s.GetServicesByTags(filter))
+	_, err = ParseTagFilter("=prod")
+	assert.NotNil(err)
+
+	// results carry the tags of their service as labels
+	web.Responses = make(chan interface{}, 1)
+	web.Failure("connection refused")
+	fail := (<-web.Responses).(ServiceFailure)
+	assert.Equal("payments", fail.Labels["team"])
+}
+
+func TestQuorum(t *testing.T) {
+	assert := assert.New(t)
+
+	id := uuid.New()
+	s, err := NewScoutWithOptions(WithResultBuffer(8), WithServices(&Service{
+		ID:       id,
+		Name:     "Edge",
+		Type:     "http",
+		Address:  "https://edge.example",
+		Interval: Duration(time.Minute),
+		Agents:   []string{"ams", "nyc", "sfo"},
+	}))
+	assert.Nil(err)
+	up := ServiceSuccess{Service: id, RequestLatency: 20}
+	down := ServiceFailure{Service: id, Issue: "timeout", Class: FailureConnectTimeout}
+
+	// a single location failing degrades the service
+	assert.Nil(s.Report("ams", up))
+	assert.Nil(s.Report("nyc", down))
+	assert.Len(s.Responses, 0)
+	assert.Nil(s.Report("sfo", ServiceSuccess{Service: id, RequestLatency: 40}))
+	r := <-s.Responses
+	if assert.IsType(ServiceSuccess{}, r) {
+		suc := r.(ServiceSuccess)
+		assert.Equal(int64(30), suc.RequestLatency)
+		assert.Equal("Down from 1 of 3 locations: nyc: timeout", suc.Degraded)
+		if assert.Len(suc.Locations, 3) {
+			assert.Equal("nyc", suc.Locations[1].Agent)
+			assert.False(suc.Locations[1].Online)
+		}
+	}
+
+	// a majority of locations failing takes it down
+	assert.Nil(s.Report("ams", down))
+	assert.Nil(s.Report("nyc", down))
+	assert.Nil(s.Report("sfo", up))
+	r = <-s.Responses
+	if assert.IsType(ServiceFailure{}, r) {
+		assert.Equal(FailureConnectTimeout, r.(ServiceFailure).Class)
+		assert.Equal("Down from 2 of 3 locations: ams: timeout; nyc: timeout", r.(ServiceFailure).Issue)
+	}
+	assert.False(s.GetService(id).Snapshot().Online)
+
+	// a location reporting again ends the round of the locations that are not reporting
+	assert.Nil(s.Report("ams", up))
+	assert.Nil(s.Report("ams", up))
+	r = <-s.Responses
+	if assert.IsType(ServiceSuccess{}, r) {
+		assert.Len(r.(ServiceSuccess).Locations, 1)
+	}
+
+	assert.True(errors.Is(s.AddService(&Service{ID: uuid.New(), Name: "Bad", Type: "http", Address: "https://edge.example", Interval: Duration(time.Minute), Agents: []string{"ams"}, Quorum: 2}), ErrInvalidQuorum))
+}
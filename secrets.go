@@ -0,0 +1,349 @@
+package scout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// redacted replaces the values of secrets in the results and logs of a service
+const redacted = "[REDACTED]"
+
+// secretRef matches the secret references of a service, ${scheme:ref}
+var secretRef = regexp.MustCompile(`\$\{([a-z][a-z0-9]*):([^}]+)\}`)
+
+// SecretProvider resolves the secret references of a scheme, e.g. the env of ${env:API_TOKEN}
+// or the vault of ${vault:secret/data/scout#token}, it is given the part after the scheme
+type SecretProvider interface {
+	Secret(ctx context.Context, ref string) (string, error)
+}
+
+// EnvSecrets resolves ${env:NAME} from the environment of the scout, it is always available
+type EnvSecrets struct{}
+
+// Secret returns the environment variable, it fails when it is not set
+func (EnvSecrets) Secret(ctx context.Context, name string) (string, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return v, nil
+}
+
+// VaultSecrets resolves ${vault:path#key} from the KV secrets engine of HashiCorp Vault, path is
+// the API path of the secret, e.g. secret/data/scout for the KV version 2 engine mounted at secret
+type VaultSecrets struct {
+	// Address is the address of Vault, http://127.0.0.1:8200 by default
+	Address string       `json:"address"`
+	Token   string       `json:"token"`
+	Client  *http.Client `json:"-"`
+}
+
+// Secret reads the secret at the path and returns its key
+func (v *VaultSecrets) Secret(ctx context.Context, ref string) (string, error) {
+	i := strings.LastIndex(ref, "#")
+	if i < 0 {
+		return "", fmt.Errorf("vault reference %s has no #key", ref)
+	}
+	path, key := strings.Trim(ref[:i], "/"), ref[i+1:]
+	address := v.Address
+	if address == "" {
+		address = "http://127.0.0.1:8200"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(address, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	if v.Token != "" {
+		req.Header.Set("X-Vault-Token", v.Token)
+	}
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault: GET %s: %s", path, resp.Status)
+	}
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", err
+	}
+	data := secret.Data
+	// the KV version 2 engine nests the secret with its metadata
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, meta := data["metadata"]; meta {
+			data = nested
+		}
+	}
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("vault: %s has no key %s", path, key)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// WithSecrets resolves the secret references with the scheme with the provider, e.g. vault with
+// a VaultSecrets. The headers, PostData, DSN, Username, Password, SNMP community and passwords
+// and SOAP envelope of a service can reference secrets as ${scheme:ref}, ${env:NAME} is
+// resolved from the environment unless another provider is set for env. The references are
+// resolved when the service is added and kept in its definition, so the exported config never
+// holds the secrets, and the resolved values are redacted from the results and logs of the
+// service
+func WithSecrets(scheme string, p SecretProvider) Option {
+	return func(s *Scout) error {
+		if scheme == "" || p == nil {
+			return fmt.Errorf("scout: secrets need a scheme and a provider")
+		}
+		if s.secrets == nil {
+			s.secrets = make(map[string]SecretProvider)
+		}
+		s.secrets[scheme] = p
+		return nil
+	}
+}
+
+// secretFields returns the fields of the service that can reference secrets
+func (s *Service) secretFields() []string {
+	fields := []string{s.PostData, s.DSN, s.Username, s.Password}
+	for _, values := range s.Headers {
+		fields = append(fields, values...)
+	}
+	if s.SNMP != nil {
+		fields = append(fields, s.SNMP.Community, s.SNMP.AuthPassword, s.SNMP.PrivPassword)
+	}
+	if s.SOAP != nil {
+		fields = append(fields, s.SOAP.Body, s.SOAP.Envelope)
+		for _, v := range s.SOAP.Variables {
+			fields = append(fields, v)
+		}
+	}
+	return fields
+}
+
+// resolveSecrets resolves the secret references of the service, it fails with ErrSecret when one
+// can not be resolved. The logger of a service with secrets is wrapped to redact them
+func (s *Scout) resolveSecrets(serv *Service) error {
+	serv.secrets = nil
+	timeout := serv.Timeout.Duration()
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for _, field := range serv.secretFields() {
+		for _, m := range secretRef.FindAllStringSubmatch(field, -1) {
+			if _, ok := serv.secrets[m[0]]; ok {
+				continue
+			}
+			p := s.secrets[m[1]]
+			if p == nil && m[1] == "env" {
+				p = EnvSecrets{}
+			}
+			if p == nil {
+				return fmt.Errorf("%w: %s of %s: no provider for %s", ErrSecret, m[0], serv.Name, m[1])
+			}
+			v, err := p.Secret(ctx, m[2])
+			if err != nil {
+				return fmt.Errorf("%w: %s of %s: %v", ErrSecret, m[0], serv.Name, err)
+			}
+			if serv.secrets == nil {
+				serv.secrets = make(map[string]string)
+			}
+			serv.secrets[m[0]] = v
+		}
+	}
+	if len(serv.secrets) > 0 && serv.Logger != nil {
+		if _, ok := serv.Logger.(redactingLogger); !ok {
+			serv.Logger = redactingLogger{Logger: serv.Logger, serv: serv}
+		}
+	}
+	return nil
+}
+
+// secret returns the field with its secret references replaced by their values
+func (s *Service) secret(field string) string {
+	if len(s.secrets) == 0 {
+		return field
+	}
+	return secretRef.ReplaceAllStringFunc(field, func(ref string) string {
+		if v, ok := s.secrets[ref]; ok {
+			return v
+		}
+		return ref
+	})
+}
+
+// secretHeaders returns the headers of the service with their secret references resolved
+func (s *Service) secretHeaders() http.Header {
+	if len(s.secrets) == 0 {
+		return s.Headers
+	}
+	h := make(http.Header, len(s.Headers))
+	for name, values := range s.Headers {
+		for _, v := range values {
+			h.Add(name, s.secret(v))
+		}
+	}
+	return h
+}
+
+// redact replaces the values of the secrets of the service in the text
+func (s *Service) redact(text string) string {
+	for _, v := range s.secrets {
+		if v != "" {
+			text = strings.ReplaceAll(text, v, redacted)
+		}
+	}
+	return text
+}
+
+// Spec returns a copy of the config of the service without its check state and with the
+// credentials that are not secret references redacted, the references are kept so a agent
+// resolves them with its own providers. It is copied under the check lock so it waits for a
+// running check
+func (s *Service) Spec() *Service {
+	c := &Service{}
+	s.checkMux.Lock()
+	src, dst := reflect.ValueOf(s).Elem(), reflect.ValueOf(c).Elem()
+	for i := 0; i < dst.NumField(); i++ {
+		f := dst.Type().Field(i)
+		if f.PkgPath != "" || f.Tag.Get("json") == "-" || stateFields[f.Name] {
+			continue
+		}
+		if sf := src.Field(i); !sf.IsZero() {
+			dst.Field(i).Set(clone(sf))
+		}
+	}
+	s.checkMux.Unlock()
+
+	c.Address = redactURL(c.Address)
+	c.DSN = redactDSN(c.DSN)
+	c.Username = redactCredential(c.Username)
+	c.Password = redactCredential(c.Password)
+	for name, values := range c.Headers {
+		if credentialHeader(name) {
+			for i, v := range values {
+				values[i] = redactCredential(v)
+			}
+		}
+	}
+	if c.SNMP != nil {
+		c.SNMP.Community = redactCredential(c.SNMP.Community)
+		c.SNMP.AuthPassword = redactCredential(c.SNMP.AuthPassword)
+		c.SNMP.PrivPassword = redactCredential(c.SNMP.PrivPassword)
+	}
+	return c
+}
+
+// redactCredential returns the credential redacted unless it only references secrets
+func redactCredential(v string) string {
+	if v == "" || secretRef.ReplaceAllString(v, "") == "" {
+		return v
+	}
+	return redacted
+}
+
+// redactURL redacts the password of a URL unless it references secrets
+func redactURL(v string) string {
+	if v == "" || secretRef.MatchString(v) {
+		return v
+	}
+	if u, err := url.Parse(v); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			return u.Redacted()
+		}
+	}
+	return v
+}
+
+// redactDSN redacts the password of a DSN, a DSN that is no URL, e.g. user:password@tcp(host)/db
+// or host=db password=secret, is redacted unless it references secrets
+func redactDSN(v string) string {
+	if v == "" || secretRef.MatchString(v) {
+		return v
+	}
+	if u, err := url.Parse(v); err == nil && u.Scheme != "" && u.Opaque == "" {
+		return redactURL(v)
+	}
+	return redacted
+}
+
+// credentialHeader reports whether the header carries credentials
+func credentialHeader(name string) bool {
+	switch http.CanonicalHeaderKey(name) {
+	case "Authorization", "Proxy-Authorization", "Cookie":
+		return true
+	}
+	name = strings.ToLower(name)
+	return strings.Contains(name, "token") || strings.Contains(name, "secret") ||
+		strings.Contains(name, "key") || strings.Contains(name, "password")
+}
+
+// redactResult redacts the secrets of the service from the response, details and cause of the
+// check before its result is sent
+func (s *Service) redactResult() {
+	if len(s.secrets) == 0 {
+		return
+	}
+	s.setResponse(s.redact(s.LastResponse))
+	for k, v := range s.Details {
+		s.Details[k] = s.redact(v)
+	}
+	if s.failureErr != nil {
+		s.failureErr = &redactedError{err: s.failureErr, msg: s.redact(s.failureErr.Error())}
+	}
+}
+
+// redactedError is the cause of a failure with the secrets of the service redacted from its
+// message, it still unwraps to the cause
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactingLogger redacts the secrets of a service from the lines it logs
+type redactingLogger struct {
+	Logger
+	serv *Service
+}
+
+func (l redactingLogger) Debugf(format string, args ...interface{}) {
+	l.Logger.Debugf("%s", l.serv.redact(fmt.Sprintf(format, args...)))
+}
+
+func (l redactingLogger) Infof(format string, args ...interface{}) {
+	l.Logger.Infof("%s", l.serv.redact(fmt.Sprintf(format, args...)))
+}
+
+func (l redactingLogger) Warnf(format string, args ...interface{}) {
+	l.Logger.Warnf("%s", l.serv.redact(fmt.Sprintf(format, args...)))
+}
+
+func (l redactingLogger) Errorf(format string, args ...interface{}) {
+	l.Logger.Errorf("%s", l.serv.redact(fmt.Sprintf(format, args...)))
+}
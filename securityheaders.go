@@ -0,0 +1,224 @@
+package scout
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the security headers audited by SecurityHeaders
+const (
+	HeaderHSTS               = "Strict-Transport-Security"
+	HeaderCSP                = "Content-Security-Policy"
+	HeaderFrameOptions       = "X-Frame-Options"
+	HeaderContentTypeOptions = "X-Content-Type-Options"
+	HeaderReferrerPolicy     = "Referrer-Policy"
+)
+
+// securityHeaders are the audited headers in the order they are reported
+var securityHeaders = []string{HeaderHSTS, HeaderCSP, HeaderFrameOptions, HeaderContentTypeOptions, HeaderReferrerPolicy}
+
+// defaultHSTSMaxAge is the minimum HSTS max-age of policies without HSTSMaxAge
+const defaultHSTSMaxAge = 180 * 24 * time.Hour
+
+// referrerPolicies are the Referrer-Policy values that do not leak the full URL to other origins
+var referrerPolicies = map[string]bool{
+	"no-referrer": true, "same-origin": true, "strict-origin": true,
+	"strict-origin-when-cross-origin": true, "origin": true, "origin-when-cross-origin": true,
+	"no-referrer-when-downgrade": true,
+}
+
+// SecurityHeadersPolicy audits the security headers of the responses of a HTTP service, a
+// missing or invalid Required header fails the check and a Recommended one degrades it. A policy
+// without either recommends all of them. The response is graded from A, all headers valid, down
+// to F and the grade kept in the details of the check
+type SecurityHeadersPolicy struct {
+	Required    []string `json:"required,omitempty"`
+	Recommended []string `json:"recommended,omitempty"`
+	// HSTSMaxAge is the minimum max-age of Strict-Transport-Security, 180 days without, and
+	// HSTSIncludeSubdomains and HSTSPreload require its directives
+	HSTSMaxAge            Duration `json:"hstsMaxAge,omitempty"`
+	HSTSIncludeSubdomains bool     `json:"hstsIncludeSubdomains,omitempty"`
+	HSTSPreload           bool     `json:"hstsPreload,omitempty"`
+	// Values are patterns the values of headers have to match instead of the built-in rules,
+	// e.g. a CSP with default-src 'self'
+	Values map[string]string `json:"values,omitempty"`
+}
+
+// validate checks that the policy only names audited headers and its patterns compile
+func (p *SecurityHeadersPolicy) validate() error {
+	for _, names := range [][]string{p.Required, p.Recommended} {
+		for _, name := range names {
+			if !isSecurityHeader(name) {
+				return fmt.Errorf("%w: %q is not a audited security header", ErrInvalidSecurityHeaders, name)
+			}
+		}
+	}
+	for name, pattern := range p.Values {
+		if !isSecurityHeader(name) {
+			return fmt.Errorf("%w: %q is not a audited security header", ErrInvalidSecurityHeaders, name)
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("%w: value of %s %q, %v", ErrInvalidSecurityHeaders, name, pattern, err)
+		}
+	}
+	if p.HSTSMaxAge < 0 {
+		return fmt.Errorf("%w: negative HSTS max-age %v", ErrInvalidSecurityHeaders, p.HSTSMaxAge.Duration())
+	}
+	return nil
+}
+
+func isSecurityHeader(name string) bool {
+	for _, h := range securityHeaders {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// audit checks the headers and returns the problems of the required headers, of the
+// recommended ones and the grade of the response
+func (p *SecurityHeadersPolicy) audit(h http.Header) (required, recommended []string, grade string) {
+	requiredSet := make(map[string]bool)
+	for _, name := range p.Required {
+		requiredSet[http.CanonicalHeaderKey(name)] = true
+	}
+	recommendedSet := make(map[string]bool)
+	for _, name := range p.Recommended {
+		recommendedSet[http.CanonicalHeaderKey(name)] = true
+	}
+	if len(p.Required) == 0 && len(p.Recommended) == 0 {
+		for _, name := range securityHeaders {
+			recommendedSet[name] = true
+		}
+	}
+	valid := 0
+	for _, name := range securityHeaders {
+		problem := p.check(h, name)
+		if problem == "" {
+			valid++
+			continue
+		}
+		switch {
+		case requiredSet[http.CanonicalHeaderKey(name)]:
+			required = append(required, problem)
+		case recommendedSet[http.CanonicalHeaderKey(name)]:
+			recommended = append(recommended, problem)
+		}
+	}
+	return required, recommended, securityGrade(valid)
+}
+
+// securityGrade grades a response by its number of valid security headers
+func securityGrade(valid int) string {
+	switch {
+	case valid >= len(securityHeaders):
+		return "A"
+	case valid == len(securityHeaders)-1:
+		return "B"
+	case valid == len(securityHeaders)-2:
+		return "C"
+	case valid == len(securityHeaders)-3:
+		return "D"
+	}
+	return "F"
+}
+
+// check returns the problem of the header, empty when it is valid
+func (p *SecurityHeadersPolicy) check(h http.Header, name string) string {
+	value := strings.TrimSpace(h.Get(name))
+	if value == "" {
+		if name == HeaderFrameOptions && strings.Contains(h.Get(HeaderCSP), "frame-ancestors") {
+			// frame-ancestors supersedes X-Frame-Options
+			return ""
+		}
+		return name + " is missing"
+	}
+	for n, pattern := range p.Values {
+		if strings.EqualFold(n, name) {
+			if ok, _ := regexp.MatchString(pattern, value); !ok {
+				return fmt.Sprintf("%s %q does not match %q", name, value, pattern)
+			}
+			return ""
+		}
+	}
+	switch name {
+	case HeaderHSTS:
+		return p.checkHSTS(value)
+	case HeaderFrameOptions:
+		if v := strings.ToUpper(value); v != "DENY" && v != "SAMEORIGIN" {
+			return fmt.Sprintf("%s %q is not DENY or SAMEORIGIN", name, value)
+		}
+	case HeaderContentTypeOptions:
+		if !strings.EqualFold(value, "nosniff") {
+			return fmt.Sprintf("%s %q is not nosniff", name, value)
+		}
+	case HeaderReferrerPolicy:
+		// the last policy the browser knows applies
+		policies := strings.Split(value, ",")
+		if policy := strings.ToLower(strings.TrimSpace(policies[len(policies)-1])); !referrerPolicies[policy] {
+			return fmt.Sprintf("%s %q leaks the URL to other origins", name, value)
+		}
+	}
+	return ""
+}
+
+// checkHSTS checks the max-age and directives of a Strict-Transport-Security header
+func (p *SecurityHeadersPolicy) checkHSTS(value string) string {
+	min := p.HSTSMaxAge.Duration()
+	if min == 0 {
+		min = defaultHSTSMaxAge
+	}
+	var maxAge time.Duration = -1
+	subdomains, preload := false, false
+	for _, directive := range strings.Split(value, ";") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case strings.HasPrefix(directive, "max-age="):
+			if secs, err := strconv.ParseInt(strings.Trim(directive[len("max-age="):], `"`), 10, 64); err == nil {
+				maxAge = time.Duration(secs) * time.Second
+			}
+		case directive == "includesubdomains":
+			subdomains = true
+		case directive == "preload":
+			preload = true
+		}
+	}
+	switch {
+	case maxAge < 0:
+		return fmt.Sprintf("%s %q has no max-age", HeaderHSTS, value)
+	case maxAge < min:
+		return fmt.Sprintf("%s max-age %v is below %v", HeaderHSTS, maxAge, min)
+	case p.HSTSIncludeSubdomains && !subdomains:
+		return fmt.Sprintf("%s %q does not include subdomains", HeaderHSTS, value)
+	case p.HSTSPreload && !preload:
+		return fmt.Sprintf("%s %q is not preloaded", HeaderHSTS, value)
+	}
+	return ""
+}
+
+// auditSecurityHeaders audits the response with the SecurityHeaders of the service and keeps its
+// grade in the details, it returns the issue of missing required headers and degrades the
+// check on missing recommended ones
+func (s *Service) auditSecurityHeaders(res *http.Response) string {
+	if s.SecurityHeaders == nil {
+		return ""
+	}
+	required, recommended, grade := s.SecurityHeaders.audit(res.Header)
+	if s.Details == nil {
+		s.Details = make(map[string]string)
+	}
+	s.Details["securityGrade"] = grade
+	if len(required) > 0 {
+		s.classify(FailureSecurityHeaders, nil)
+		return fmt.Sprintf("Security headers grade %s: %s", grade, strings.Join(append(required, recommended...), ", "))
+	}
+	if len(recommended) > 0 {
+		s.degradedIssue = fmt.Sprintf("Security headers grade %s: %s", grade, strings.Join(recommended, ", "))
+	}
+	return ""
+}
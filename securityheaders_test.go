@@ -0,0 +1,74 @@
+package scout
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	assert := assert.New(t)
+
+	headers := http.Header{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range headers {
+			w.Header()[k] = v
+		}
+	}))
+	defer ts.Close()
+
+	serv := &Service{
+		ID:              uuid.New(),
+		Name:            "Headers",
+		Address:         ts.URL,
+		Type:            "http",
+		ExpectedStatus:  http.StatusOK,
+		SkipDNSTiming:   true,
+		Interval:        Duration(time.Minute),
+		Timeout:         Duration(2 * time.Second),
+		SecurityHeaders: &SecurityHeadersPolicy{Required: []string{"strict-transport-security"}},
+		Logger:          NewSlogLogger(nil),
+	}
+	assert.Nil(serv.Validate())
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureSecurityHeaders, fail.Class)
+	assert.True(errors.Is(fail.Err, ErrUnexpectedContent))
+	assert.Equal("Security headers grade F: Strict-Transport-Security is missing", fail.Issue)
+
+	headers.Set(HeaderHSTS, "max-age=300")
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Contains(fail.Issue, "max-age 5m0s is below 4320h0m0s")
+
+	// the recommended headers only degrade the service
+	headers.Set(HeaderHSTS, "max-age=31536000; includeSubDomains")
+	headers.Set(HeaderReferrerPolicy, "unsafe-url")
+	serv.SecurityHeaders.Recommended = []string{HeaderCSP, HeaderFrameOptions, HeaderContentTypeOptions, HeaderReferrerPolicy}
+	suc, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal(`Security headers grade F: Content-Security-Policy is missing, X-Frame-Options is missing, X-Content-Type-Options is missing, Referrer-Policy "unsafe-url" leaks the URL to other origins`, suc.Degraded)
+	assert.Equal("F", suc.Details["securityGrade"])
+
+	headers.Set(HeaderCSP, "default-src 'self'; frame-ancestors 'none'")
+	headers.Set(HeaderContentTypeOptions, "nosniff")
+	headers.Set(HeaderReferrerPolicy, "no-referrer, strict-origin-when-cross-origin")
+	suc, ok = checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("", suc.Degraded)
+	assert.Equal("A", suc.Details["securityGrade"])
+
+	serv.SecurityHeaders.Values = map[string]string{HeaderCSP: `default-src 'none'`}
+	suc, ok = checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("B", suc.Details["securityGrade"])
+	assert.Contains(suc.Degraded, `does not match "default-src 'none'"`)
+
+	serv.SecurityHeaders.Required = []string{"X-Powered-By"}
+	assert.True(errors.Is(serv.Validate(), ErrInvalidSecurityHeaders))
+}
@@ -12,11 +12,12 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	traceroute "github.com/phenixrizen/go-traceroute"
-	"github.com/sirupsen/logrus"
 	fastping "github.com/tatsushid/go-fastping"
 )
 
@@ -57,42 +58,178 @@ func (d *Duration) UnmarshalJSON(b []byte) error {
 
 // Service is the main struct for Services
 type Service struct {
-	ID               uuid.UUID              `json:"id"`
-	Name             string                 `json:"name"`
-	Address          string                 `json:"address"`
-	ResolveTo        string                 `json:"resolveTo"`
-	Expected         string                 `json:"expected"`
-	ExpectedStatus   int                    `json:"expectedStatus"`
-	Interval         Duration               `json:"checkInterval"`
-	Type             string                 `json:"type"`
-	Method           string                 `json:"method"`
-	PostData         string                 `json:"postData"`
-	Port             int                    `json:"port"`
-	Timeout          Duration               `json:"timeout"`
-	VerifySSL        bool                   `json:"verifySSL"`
-	Headers          http.Header            `json:"headers"`
-	CreatedAt        time.Time              `json:"createdAt"`
-	UpdatedAt        time.Time              `json:"updatedAt"`
-	Online           bool                   `json:"online"`
-	DNSResolve       int64                  `json:"dnsResolve"`
-	RequestLatency   int64                  `json:"requestLatency"`
-	NetworkLatency   int64                  `json:"networkLatency"`
-	Trace            bool                   `json:"trace"`
-	TraceData        []traceroute.TraceData `json:"traceData,omitempty"`
-	Retry            bool                   `json:"retry"`
-	RetryMinInterval Duration               `json:"retryMinInterval"`
-	RetryMaxInterval Duration               `json:"retryMaxInterval"`
-	RetryMax         int                    `json:"retryMax"`
-	RetryAttempts    int                    `json:"-" bson:"-"`
-	Running          chan bool              `json:"-" bson:"-"`
-	Checkpoint       time.Time              `json:"-" bson:"-"`
-	SleepDuration    Duration               `json:"-" bson:"-"`
-	LastResponse     string                 `json:"lastResponse"`
-	DownText         string                 `json:"downText"`
-	LastStatusCode   int                    `json:"statusCode"`
-	LastOnline       time.Time              `json:"lastSuccess"`
-	Logger           logrus.FieldLogger     `json:"-" bson:"-"`
-	Responses        chan interface{}       `json:"-" bson:"-"`
+	ID                uuid.UUID              `json:"id"`
+	ExternalID        string                 `json:"externalId,omitempty"`
+	Namespace         string                 `json:"namespace,omitempty"`
+	Name              string                 `json:"name"`
+	Address           string                 `json:"address"`
+	ResolveTo         string                 `json:"resolveTo"`
+	HostHeader        string                 `json:"hostHeader,omitempty"`
+	SNI               string                 `json:"sni,omitempty"`
+	Expected          string                 `json:"expected"`
+	ExpectedStatus    int                    `json:"expectedStatus"`
+	Interval          Duration               `json:"checkInterval"`
+	Type              string                 `json:"type"`
+	Template          string                 `json:"template,omitempty"`
+	Method            string                 `json:"method"`
+	PostData          string                 `json:"postData"`
+	Port              int                    `json:"port"`
+	Timeout           Duration               `json:"timeout"`
+	DegradedLatency   Duration               `json:"degradedLatency"`
+	MaxLatency        Duration               `json:"maxLatency"`
+	AnomalySigma      float64                `json:"anomalySigma"`
+	SLO               *SLO                   `json:"slo,omitempty"`
+	VerifySSL         bool                   `json:"verifySSL"`
+	Headers           http.Header            `json:"headers"`
+	CreatedAt         time.Time              `json:"createdAt"`
+	UpdatedAt         time.Time              `json:"updatedAt"`
+	Online            bool                   `json:"online"`
+	DNSResolve        int64                  `json:"dnsResolve"`
+	RequestLatency    int64                  `json:"requestLatency"`
+	NetworkLatency    int64                  `json:"networkLatency"`
+	Trace             bool                   `json:"trace"`
+	TraceData         []traceroute.TraceData `json:"traceData,omitempty"`
+	TraceInterval     Duration               `json:"traceInterval"`
+	TraceBaseline     []traceroute.TraceData `json:"traceBaseline,omitempty"`
+	TraceBaselineAt   time.Time              `json:"traceBaselineAt,omitempty"`
+	Retry             bool                   `json:"retry"`
+	RetryMinInterval  Duration               `json:"retryMinInterval"`
+	RetryMaxInterval  Duration               `json:"retryMaxInterval"`
+	RetryMax          int                    `json:"retryMax"`
+	RetryStrategy     string                 `json:"retryStrategy"`
+	RetryCap          Duration               `json:"retryCap"`
+	RecoveryInterval  Duration               `json:"recoveryInterval"`
+	RetryAttempts     int                    `json:"-" bson:"-"`
+	Running           chan bool              `json:"-" bson:"-"`
+	Checkpoint        time.Time              `json:"-" bson:"-"`
+	SleepDuration     Duration               `json:"-" bson:"-"`
+	LastResponse      string                 `json:"lastResponse"`
+	DownText          string                 `json:"downText"`
+	DegradedText      string                 `json:"degradedText,omitempty"`
+	LastStatusCode    int                    `json:"statusCode"`
+	LastOnline        time.Time              `json:"lastSuccess"`
+	FailureTTL        Duration               `json:"failureTTL"`
+	DNSOverHTTPS      string                 `json:"dnsOverHTTPS"`
+	DNSOverTLS        string                 `json:"dnsOverTLS"`
+	BypassDNSCache    bool                   `json:"bypassDNSCache"`
+	ExpiresAt         time.Time              `json:"expiresAt"`
+	ExpireAction      string                 `json:"expireAction"`
+	Paused            bool                   `json:"paused"`
+	TrackRedirects    bool                   `json:"trackRedirects"`
+	MovedTo           string                 `json:"movedTo,omitempty"`
+	MovedService      uuid.UUID              `json:"movedService,omitempty"`
+	SendPayload       string                 `json:"sendPayload"`
+	ExpectedBanner    string                 `json:"expectedBanner"`
+	StartTLS          string                 `json:"startTLS"`
+	TLSHandshake      int64                  `json:"tlsHandshake"`
+	CertExpiry        time.Time              `json:"certExpiry"`
+	SampleSize        int                    `json:"sampleSize"`
+	SkipDNSTiming     bool                   `json:"skipDNSTiming"`
+	SkipPing          bool                   `json:"skipPing"`
+	ResolvedIPs       []string               `json:"resolvedIPs,omitempty"`
+	ExpectedSHA256    string                 `json:"expectedSHA256,omitempty"`
+	ContentDrift      bool                   `json:"contentDrift"`
+	ContentHash       string                 `json:"contentHash,omitempty"`
+	ReadLimit         int64                  `json:"readLimit,omitempty"`
+	MinBodyBytes      int64                  `json:"minBodyBytes,omitempty"`
+	MaxBodyBytes      int64                  `json:"maxBodyBytes,omitempty"`
+	AcceptEncoding    string                 `json:"acceptEncoding,omitempty"`
+	ExpectCompression string                 `json:"expectCompression,omitempty"`
+	ValidateCache     bool                   `json:"validateCache"`
+	HTTP2             string                 `json:"http2,omitempty"`
+	HTTP3             bool                   `json:"http3"`
+	JSONSchema        json.RawMessage        `json:"jsonSchema,omitempty"`
+	IPVersion         string                 `json:"ipVersion"`
+	CheckAllIPs       bool                   `json:"checkAllIPs"`
+	IPPolicy          string                 `json:"ipPolicy"`
+	IPQuorum          int                    `json:"ipQuorum"`
+	IPResults         []IPResult             `json:"ipResults,omitempty"`
+	Details           map[string]string      `json:"details,omitempty"`
+	DSN               string                 `json:"dsn"`
+	Driver            string                 `json:"driver"`
+	Query             string                 `json:"query"`
+	Username          string                 `json:"username"`
+	Password          string                 `json:"password"`
+	Redis             *RedisConfig           `json:"redis,omitempty"`
+	Memcached         *MemcachedConfig       `json:"memcached,omitempty"`
+	MongoDB           *MongoDBConfig         `json:"mongodb,omitempty"`
+	Kafka             *KafkaConfig           `json:"kafka,omitempty"`
+	AMQP              *AMQPConfig            `json:"amqp,omitempty"`
+	NTP               *NTPConfig             `json:"ntp,omitempty"`
+	LDAP              *LDAPConfig            `json:"ldap,omitempty"`
+	SNMP              *SNMPConfig            `json:"snmp,omitempty"`
+	Kubernetes        *KubernetesConfig      `json:"kubernetes,omitempty"`
+	GraphQL           *GraphQLConfig         `json:"graphql,omitempty"`
+	SOAP              *SOAPConfig            `json:"soap,omitempty"`
+	DockerHost        string                 `json:"dockerHost"`
+	Command           []string               `json:"command"`
+	DependsOn         []uuid.UUID            `json:"dependsOn"`
+	Tags              map[string]string      `json:"tags"`
+	SilencedUntil     time.Time              `json:"silencedUntil,omitempty"`
+	SilenceReason     string                 `json:"silenceReason,omitempty"`
+	Acknowledged      bool                   `json:"acknowledged"`
+	AckReason         string                 `json:"ackReason,omitempty"`
+	DebugChecks       int                    `json:"debugChecks"`
+	Origin            string                 `json:"origin"`
+	Agents            []string               `json:"agents,omitempty"`
+	Quorum            int                    `json:"quorum,omitempty"`
+	CompareHeaders    []string               `json:"compareHeaders"`
+	Edges             []string               `json:"edges,omitempty"`
+	EdgeResolvers     []string               `json:"edgeResolvers,omitempty"`
+	CertFingerprints  []string               `json:"certFingerprints,omitempty"`
+	SPKIPins          []string               `json:"spkiPins,omitempty"`
+	MinTLSVersion     string                 `json:"minTLSVersion"`
+	CipherSuites      []string               `json:"cipherSuites,omitempty"`
+	RefuseLegacyTLS   bool                   `json:"refuseLegacyTLS"`
+	CheckRevocation   bool                   `json:"checkRevocation"`
+	CheckChain        bool                   `json:"checkChain"`
+	DNSBLs            []string               `json:"dnsbls,omitempty"`
+	SecurityHeaders   *SecurityHeadersPolicy `json:"securityHeaders,omitempty"`
+	Logger            Logger                 `json:"-" bson:"-"`
+	Responses         chan interface{}       `json:"-" bson:"-"`
+	DNSCache          *DNSCache              `json:"-" bson:"-"`
+	Hooks             Hooks                  `json:"-" bson:"-"`
+	Middleware        []Middleware           `json:"-" bson:"-"`
+	scout             *Scout
+	primary           *Service
+	target            string
+	followers         []*Service
+	resolveDrift      bool
+	heartbeat         int64
+	heartbeatWait     int64
+	stalled           int32
+	sampler           *sampler
+	healthySince      time.Time
+	failureResponse   string
+	lastFailure       time.Time
+	debug             *DebugCapture
+	debugCaptures     []DebugCapture
+	debugMux          sync.Mutex
+	pushed            int64
+	pushWait          time.Time
+	failures          int
+	silenceMux        sync.Mutex
+	anomaly           *anomalyDetector
+	slo               *sloTracker
+	tracing           int32
+	traceMux          sync.Mutex
+	pendingTrace      []traceroute.TraceData
+	timings           *Timings
+	failureClass      FailureClass
+	failureErr        error
+	checkResult       Result
+	checkCtx          context.Context
+	checkCancel       context.CancelFunc
+	cancelMux         sync.Mutex
+	checkMux          sync.Mutex
+	revocations       revocationCache
+	degradedIssue     string
+	lag               int64
+	statusMux         sync.RWMutex
+	status            ServiceStatus
+	round             map[string]LocationResult
+	locations         []LocationResult
+	secrets           map[string]string
 }
 
 // Initialize a Service
@@ -102,11 +239,12 @@ func (s *Service) Initialize() {
 		s.UpdatedAt = time.Now().UTC()
 	}
 	if s.Logger == nil {
-		s.Logger = logrus.New()
+		s.Logger = NewSlogLogger(nil)
 	}
 	if s.Responses == nil {
 		s.Responses = make(chan interface{})
 	}
+	s.publish()
 }
 
 // Start will create a channel for use to stop the service checking go routine
@@ -134,8 +272,38 @@ func (s *Service) IsRunning() bool {
 	}
 }
 
-// Check will run checkHttp for HTTP services and checkTcp for TCP services
+// Check will run checkHttp for HTTP services and checkTcp for TCP services, wrapped in the
+// middleware and hooks of the scout and service
 func (s *Service) Check() {
+	s.checkMux.Lock()
+	defer s.checkMux.Unlock()
+	s.check()
+}
+
+// check runs a check of the service, it must be called with the check lock held
+func (s *Service) check() {
+	s.Details = nil
+	s.timings = nil
+	s.failureClass, s.failureErr = "", nil
+	s.degradedIssue = ""
+	if s.scout != nil {
+		atomic.AddInt64(&s.scout.inflight, 1)
+		defer atomic.AddInt64(&s.scout.inflight, -1)
+	}
+	if !s.throttle() {
+		return
+	}
+	if s.scout != nil && s.scout.checkSlots != nil {
+		s.scout.checkSlots <- struct{}{}
+		defer func() { <-s.scout.checkSlots }()
+	}
+	s.startDebug()
+	defer s.finishDebug()
+	s.withDeadline(s.hookedCheck)
+}
+
+// runCheck runs the check of the service type, it is the innermost CheckFunc of the middleware
+func (s *Service) runCheck() {
 	switch s.Type {
 	case "http":
 		s.CheckHTTP()
@@ -143,6 +311,42 @@ func (s *Service) Check() {
 		s.CheckNet()
 	case "icmp":
 		s.CheckICMP()
+	case "cdn":
+		s.CheckCDN()
+	case "graphql":
+		s.CheckGraphQL()
+	case "soap":
+		s.CheckSOAP()
+	case "dns":
+		s.CheckDNS()
+	case "postgres", "mysql", "sql":
+		s.CheckSQL()
+	case "redis":
+		s.CheckRedis()
+	case "memcached":
+		s.CheckMemcached()
+	case "mongodb":
+		s.CheckMongoDB()
+	case "kafka":
+		s.CheckKafka()
+	case "amqp":
+		s.CheckAMQP()
+	case "ntp":
+		s.CheckNTP()
+	case "ldap":
+		s.CheckLDAP()
+	case "snmp":
+		s.CheckSNMP()
+	case "dnsbl":
+		s.CheckDNSBL()
+	case "kubernetes":
+		s.CheckKubernetes()
+	case "docker":
+		s.CheckDocker()
+	case "exec":
+		s.CheckExec()
+	case "heartbeat":
+		s.CheckHeartbeat()
 	}
 }
 
@@ -152,17 +356,50 @@ func (s *Service) Scout() {
 		s.Timeout = Duration(1 * time.Second)
 	}
 	s.Start()
+	// a restarted service gets a new Running channel, the loop keeps the one it was started with
+	running := s.Running
+	if s.scout != nil {
+		atomic.AddInt64(&s.scout.loops, 1)
+		defer atomic.AddInt64(&s.scout.loops, -1)
+	}
+	if s.Expired() {
+		s.expire()
+		return
+	}
+	var expiry <-chan time.Time
+	if !s.ExpiresAt.IsZero() {
+		expiry = time.After(time.Until(s.ExpiresAt))
+	}
+	s.update(func() { s.Paused = false })
+	wake := make(chan time.Time, 1)
+	if delay := s.startDelay(); delay > 0 {
+		s.beat(delay)
+		select {
+		case <-running:
+			return
+		case <-expiry:
+			s.expire()
+			return
+		case <-s.after(wake, delay):
+		}
+	}
 	s.Checkpoint = time.Now().UTC()
+	s.beat(s.Interval.Duration())
 	// Go check now
 	s.Check()
 	s.SleepDuration = s.Interval
+	s.beat(s.SleepDuration.Duration())
 ScoutLoop:
 	for {
 		select {
-		case <-s.Running:
+		case <-running:
 			s.Logger.Debugf(fmt.Sprintf("Stopping service: %v", s.Name))
 			break ScoutLoop
-		case <-time.After(s.SleepDuration.Duration()):
+		case <-expiry:
+			s.expire()
+			break ScoutLoop
+		case now := <-s.after(wake, s.SleepDuration.Duration()):
+			s.recordLag(now)
 			s.Logger.Debugf("Checking: %s -> %s", s.Name, s.Type)
 			s.Check()
 			s.Checkpoint = s.Checkpoint.Add(s.Interval.Duration())
@@ -171,18 +408,22 @@ ScoutLoop:
 				s.SleepDuration = s.Interval
 			} else {
 				if s.Retry {
-					s.LinearJitterBackoff()
+					s.Backoff()
+				} else if s.RecoveryInterval > 0 {
+					s.SleepDuration = s.recoveryInterval()
+					s.Checkpoint = time.Now().UTC()
 				} else {
 					s.SleepDuration = sleep
 				}
 			}
+			s.beat(s.SleepDuration.Duration())
 		}
 		continue
 	}
 }
 
 func (s *Service) parseHost() string {
-	if s.Type == "tcp" || s.Type == "udp" || s.Type == "icmp" {
+	if s.Type == "tcp" || s.Type == "udp" || s.Type == "icmp" || s.Type == "dns" || s.Type == "postgres" || s.Type == "mysql" || s.Type == "sql" || s.Type == "redis" || s.Type == "memcached" || s.Type == "kafka" || s.Type == "ntp" || s.Type == "ldap" || s.Type == "snmp" || s.Type == "docker" || s.Type == "dnsbl" {
 		return s.Address
 	} else {
 		u, err := url.Parse(s.Address)
@@ -194,41 +435,58 @@ func (s *Service) parseHost() string {
 }
 
 func (s *Service) ips() []net.IP {
-	var addrs []string
-	var ips []net.IP
-	var err error
-	if s.Type == "tcp" {
-		addrs, err = net.LookupHost(s.parseHost())
+	ips, err := s.lookup(s.context())
+	if err != nil {
+		return nil
+	}
+	return ips
+}
+
+// lookup resolves the service host with the service resolver
+func (s *Service) lookup(ctx context.Context) ([]net.IP, error) {
+	return s.lookupHost(ctx, s.parseHost())
+}
+
+// lookupHost resolves host with the service resolver, going through the shared DNS cache
+// unless the service bypasses it
+func (s *Service) lookupHost(ctx context.Context, host string) ([]net.IP, error) {
+	if s.DNSCache != nil && !s.BypassDNSCache {
+		key := strings.Join([]string{s.DNSOverHTTPS, s.DNSOverTLS, host}, "|")
+		ips, err := s.DNSCache.lookup(ctx, key, host, s.dnsDial())
 		if err != nil {
-			return nil
+			return nil, err
 		}
-		for _, add := range addrs {
-			ip := net.ParseIP(add)
-			if ip != nil {
-				ips = append(ips, ip)
-			}
+		return s.debugIPs(host, ips)
+	}
+	addrs, err := s.resolver().LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, add := range addrs {
+		ips[i] = add.IP
+	}
+	return s.debugIPs(host, ips)
+}
 
+// debugIPs filters the answers of a lookup of host for the IPVersion and records them in the
+// debug capture of the check
+func (s *Service) debugIPs(host string, ips []net.IP) ([]net.IP, error) {
+	ips, err := s.filterIPs(host, ips)
+	if err == nil {
+		answers := make([]string, len(ips))
+		for i, ip := range ips {
+			answers[i] = ip.String()
 		}
-		return ips
-	} else {
-		ips, err = net.LookupIP(s.parseHost())
-		if err != nil {
-			return nil
-		}
-		return ips
+		s.debugLookup(host, answers)
 	}
+	return ips, err
 }
 
 // DNSCheck will check the domain name and return a int64 representing the milliseconds it took to resolve DNS
 func (s *Service) DNSCheck() (int64, error) {
-	var err error
 	t1 := time.Now()
-	host := s.parseHost()
-	if s.Type == "tcp" {
-		_, err = net.LookupHost(host)
-	} else {
-		_, err = net.LookupIP(host)
-	}
+	_, err := s.lookup(s.context())
 	if err != nil {
 		return 0, err
 	}
@@ -243,49 +501,61 @@ func isIPv6(address string) bool {
 
 // CheckICMP will send a ICMP ping packet to the service
 func (s *Service) CheckICMP() {
+	if s.timedOut() {
+		return
+	}
 	p := fastping.NewPinger()
-	p.MaxRTT = s.Timeout.Duration()
+	p.MaxRTT = s.remaining()
 	resolveIP := "ip4:icmp"
-	if isIPv6(s.Address) {
+	if s.IPVersion == IPVersion6 || (s.IPVersion != IPVersion4 && isIPv6(s.Address)) {
 		resolveIP = "ip6:icmp"
 	}
 	ra, err := net.ResolveIPAddr(resolveIP, s.Address)
 	if err != nil {
 		s.Logger.Debugf("Could not send ICMP to service %v, %v", s.Address, err)
-		s.Failure(fmt.Sprintf("Could not send ICMP to service %v, %v", s.Address, err))
+		s.fail(FailureDNS, err, fmt.Sprintf("Could not send ICMP to service %v, %v", s.Address, err))
 		return
 	}
 	p.AddIPAddr(ra)
 	sucess := false
 	p.OnRecv = func(addr *net.IPAddr, rtt time.Duration) {
-		s.NetworkLatency = rtt.Milliseconds()
+		s.setNetworkLatency(rtt.Milliseconds())
 		sucess = true
 	}
 	p.OnIdle = func() {}
 	err = p.Run()
 	if err != nil {
 		s.Logger.Debugf("Issue running ICMP to service %s, %v, %v", s.Name, s.Address, err)
-		s.Failure(fmt.Sprintf("Issue running ICMP to service %v, %v", s.Address, err))
+		s.fail(FailureConnect, err, fmt.Sprintf("Issue running ICMP to service %v, %v", s.Address, err))
 		return
 	}
 	if sucess {
 		s.Success()
 	} else {
-		s.NetworkLatency = -1
-		s.Failure("Reachmed max ICMP idle timeout")
+		s.setNetworkLatency(-1)
+		s.fail(FailureConnectTimeout, nil, "Reachmed max ICMP idle timeout")
 	}
-	s.LastResponse = ""
+	s.setResponse("")
 }
 
 // CheckNet will check a TCP/UDP service
 func (s *Service) CheckNet() {
-	dnsLookup, err := s.DNSCheck()
-	if err != nil {
-		s.Failure(fmt.Sprintf("Could not get IP address for TCP service %v, %v", s.Address, err))
+	if !s.SkipDNSTiming {
+		dnsLookup, err := s.DNSCheck()
+		if err != nil {
+			s.fail(FailureDNS, err, fmt.Sprintf("Could not get IP address for TCP service %v, %v", s.Address, err))
+			return
+		}
+		s.DNSResolve = dnsLookup
+	}
+	if s.CheckAllIPs {
+		s.checkAllIPs(s.probeNet)
 		return
 	}
-	s.DNSResolve = dnsLookup
-	s.NetworkLatency = s.ping()
+	s.setNetworkLatency(-1)
+	if !s.SkipPing {
+		s.setNetworkLatency(s.ping())
+	}
 	t1 := time.Now()
 	domain := fmt.Sprintf("%v", s.Address)
 	if s.Port != 0 {
@@ -294,111 +564,360 @@ func (s *Service) CheckNet() {
 			domain = fmt.Sprintf("[%v]:%v", s.Address, s.Port)
 		}
 	}
-	conn, err := net.DialTimeout(s.Type, domain, time.Duration(s.Timeout)*time.Second)
+	conn, err := s.dial(s.network(s.Type), domain)
 	if err != nil {
-		s.Failure(fmt.Sprintf("Dial Error %v", err))
+		s.fail(classifyError(err, false), err, fmt.Sprintf("Dial Error %v", err))
+		return
+	}
+	s.setResponse("")
+	tlsConn, err := s.startTLS(conn)
+	if err != nil {
+		conn.Close()
+		s.fail(tlsClass(err), err, fmt.Sprintf("StartTLS Error %v", err))
+		return
+	}
+	conn = tlsConn
+	if issue := s.converse(conn); issue != "" {
+		conn.Close()
+		s.Failure(issue)
 		return
 	}
 	if err := conn.Close(); err != nil {
-		s.Failure(fmt.Sprintf("%v Socket Close Error %v", strings.ToUpper(s.Type), err))
+		s.fail(FailureProtocol, err, fmt.Sprintf("%v Socket Close Error %v", strings.ToUpper(s.Type), err))
 		return
 	}
 	t2 := time.Now()
-	s.RequestLatency = t2.Sub(t1).Milliseconds()
-	s.LastResponse = ""
+	s.setRequestLatency(t2.Sub(t1).Milliseconds())
 	s.Success()
 }
 
 // CheckHTTP will check a HTTP service
 func (s *Service) CheckHTTP() {
-	dnsLookup, err := s.DNSCheck()
-	if err != nil {
-		s.Failure(fmt.Sprintf("Could not get IP address for domain %v, %v", s.Address, err))
+	if !s.SkipDNSTiming {
+		dnsLookup, err := s.DNSCheck()
+		if err != nil {
+			s.fail(FailureDNS, err, fmt.Sprintf("Could not get IP address for domain %v, %v", s.Address, err))
+			return
+		}
+		s.DNSResolve = dnsLookup
+	}
+	if s.CheckAllIPs && s.ResolveTo == "" {
+		s.checkAllIPs(s.probeHTTP)
 		return
 	}
-	s.DNSResolve = dnsLookup
-
-	timeout := time.Duration(s.Timeout) * time.Second
-	var content []byte
-	var res *http.Response
-	var metrics *HTTPRequestMetrics
-
-	if s.Method == "POST" {
-		content, res, metrics, err = HTTPRequest(context.Background(), s.Address, s.ResolveTo, s.Method, "application/json", s.Headers, bytes.NewBuffer([]byte(s.PostData)), timeout, s.VerifySSL)
-	} else {
-		content, res, metrics, err = HTTPRequest(context.Background(), s.Address, s.ResolveTo, s.Method, nil, s.Headers, nil, timeout, s.VerifySSL)
+	if s.ResolveTo != "" {
+		s.checkResolveDrift()
 	}
+
+	content, res, metrics, err := s.request(s.context(), s.ResolveTo)
+	defer metrics.release()
+	s.timings = metrics.Timings()
 	if err != nil {
-		s.Failure(fmt.Sprintf("HTTP Error %v", err))
+		s.fail(metrics.classifyError(err), err, fmt.Sprintf("HTTP Error %v", err))
 		return
 	}
 	s.Logger.Infof("Metrics: %+v", metrics)
-	s.NetworkLatency = metrics.NetworkLatency()
-	s.RequestLatency = metrics.RequestLatency()
-	s.LastResponse = string(content)
-	s.LastStatusCode = res.StatusCode
+	s.setNetworkLatency(metrics.NetworkLatency())
+	s.setRequestLatency(metrics.RequestLatency())
+	s.setResponse(metrics.response(content))
+	s.setStatusCode(res.StatusCode)
+	if s.TrackRedirects {
+		if location := permanentRedirect(res); location != "" {
+			s.moved(location)
+		}
+	}
+
+	if s.timedOut() {
+		return
+	}
+	if issue := s.verifyHTTP(content, res, metrics); issue != "" {
+		s.Failure(issue)
+		return
+	}
+	if issue := s.validateCache(res, s.ResolveTo); issue != "" {
+		s.Failure(issue)
+		return
+	}
+
+	s.Logger.Infof("Service success")
+	s.Success()
+}
 
+// verifyHTTP matches a HTTP response against Expected, ExpectedStatus, the protocol, the body size
+// and compression, the content hashes, the JSONSchema and SecurityHeaders and returns the issue
+// when it does not match
+func (s *Service) verifyHTTP(content []byte, res *http.Response, metrics *HTTPRequestMetrics) string {
+	if err := s.verifyTLS(res.TLS, s.serverName(res.Request.URL.Hostname())); err != nil {
+		s.Logger.Warnf("Service %v TLS policy failed, %v", s.Name, err)
+		s.classify(tlsClass(err), err)
+		return fmt.Sprintf("TLS Error %v", err)
+	}
+	if res.TLS != nil && s.RefuseLegacyTLS {
+		if err := s.verifyLegacyTLS(res.Request.URL); err != nil {
+			s.Logger.Warnf("Service %v TLS policy failed, %v", s.Name, err)
+			s.classify(tlsClass(err), err)
+			return fmt.Sprintf("TLS Error %v", err)
+		}
+	}
 	if s.Expected != "" {
 		match, err := regexp.MatchString(s.Expected, string(content))
 		if err != nil {
-			s.Logger.Warnln(fmt.Sprintf("Service %v expected: %v to match %v", s.Name, string(content), s.Expected))
+			s.Logger.Warnf("Service %v expected: %v to match %v", s.Name, string(content), s.Expected)
 		}
 		if !match {
-			s.Logger.Warningln(fmt.Sprintf("HTTP Response Body did not match '%v'", s.Expected))
-			s.Failure(fmt.Sprintf("HTTP Response Body did not match '%v'", s.Expected))
-			return
+			s.Logger.Warnf("HTTP Response Body did not match '%v'", s.Expected)
+			s.classify(FailureBodyMismatch, nil)
+			return fmt.Sprintf("HTTP Response Body did not match '%v'", s.Expected)
 		}
 	}
 	if s.ExpectedStatus != res.StatusCode {
-		s.Logger.Warningln(fmt.Sprintf("HTTP Status Code %v did not match %v", res.StatusCode, s.ExpectedStatus))
-		s.Failure(fmt.Sprintf("HTTP Status Code %v did not match %v", res.StatusCode, s.ExpectedStatus))
-		return
+		s.Logger.Warnf("HTTP Status Code %v did not match %v", res.StatusCode, s.ExpectedStatus)
+		s.classify(FailureStatusMismatch, nil)
+		return fmt.Sprintf("HTTP Status Code %v did not match %v", res.StatusCode, s.ExpectedStatus)
+	}
+	if s.HTTP2 == HTTP2Require && res.ProtoMajor != 2 {
+		s.classify(FailureProtocol, nil)
+		return fmt.Sprintf("HTTP Response protocol %s is not HTTP/2", res.Proto)
+	}
+	if issue := s.verifyBodySize(metrics); issue != "" {
+		return issue
+	}
+	if issue := s.verifyCompression(metrics); issue != "" {
+		return issue
 	}
+	if issue := s.verifyContentHash(content); issue != "" {
+		return issue
+	}
+	if issue := s.verifyJSONSchema(content); issue != "" {
+		return issue
+	}
+	return s.auditSecurityHeaders(res)
+}
 
-	s.Logger.Infoln("Service success")
-	s.Success()
+// request sends the configured HTTP request for the service, dialing resolveTo when it is set
+func (s *Service) request(ctx context.Context, resolveTo string) ([]byte, *http.Response, *HTTPRequestMetrics, error) {
+	return s.requestWith(ctx, resolveTo, nil)
 }
 
-// Success will create a new 'ServiceSuccess' record on the Response Channel
+// requestWith sends the configured HTTP request for the service with the extra headers, e.g.
+// the validators of a conditional request
+func (s *Service) requestWith(ctx context.Context, resolveTo string, extra http.Header) ([]byte, *http.Response, *HTTPRequestMetrics, error) {
+	cfg := &requestConfig{
+		url:            s.Address,
+		resolveTo:      resolveTo,
+		method:         s.Method,
+		headers:        s.secretHeaders(),
+		timeout:        s.Timeout.Duration(),
+		verifySSL:      s.VerifySSL,
+		resolver:       s.resolver(),
+		network:        s.network(""),
+		minTLS:         s.clientMinTLS(),
+		hostHeader:     s.HostHeader,
+		sni:            s.SNI,
+		readLimit:      s.readLimit(),
+		acceptEncoding: s.acceptEncoding(),
+		http2:          s.HTTP2 == HTTP2Allow || s.HTTP2 == HTTP2Require,
+	}
+	if s.DNSCache != nil && !s.BypassDNSCache {
+		cfg.lookup = s.lookupHost
+	}
+	if s.HTTP3 {
+		if cfg.http3 = s.http3(); cfg.http3 == nil {
+			return nil, nil, nil, fmt.Errorf("%w: http3 without a transport, see WithHTTP3", ErrInvalidCheck)
+		}
+	}
+	if len(extra) > 0 {
+		cfg.headers = cfg.headers.Clone()
+		if cfg.headers == nil {
+			cfg.headers = make(http.Header)
+		}
+		for name, values := range extra {
+			cfg.headers[name] = values
+		}
+	}
+	switch {
+	case s.Type == "graphql" && s.GraphQL != nil:
+		body, err := s.graphQLRequest()
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%w: graphql request, %v", ErrInvalidCheck, err)
+		}
+		cfg.method, cfg.contentType, cfg.body = "POST", "application/json", bytes.NewReader(body)
+		cfg.defaultHeader("Accept", "application/graphql-response+json, application/json")
+	case s.Type == "soap" && s.SOAP != nil:
+		envelope, err := s.soapEnvelope()
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%w: soap envelope, %v", ErrInvalidCheck, err)
+		}
+		cfg.method, cfg.contentType, cfg.body = "POST", s.SOAP.contentType(), bytes.NewReader(envelope)
+		if s.SOAP.version() == SOAP11 {
+			cfg.defaultHeader("SOAPAction", `"`+s.SOAP.Action+`"`)
+		}
+	case s.Method == "POST":
+		cfg.contentType = "application/json"
+		cfg.body = bytes.NewBuffer([]byte(s.secret(s.PostData)))
+	}
+	content, res, metrics, err := doHTTPRequest(ctx, cfg)
+	s.debugExchange(cfg, content, res, metrics, err)
+	return content, res, metrics, err
+}
+
+// defaultHeader sets the header of the request unless the headers of the service set it, the
+// headers of the service are not modified
+func (cfg *requestConfig) defaultHeader(name, value string) {
+	if cfg.headers.Get(name) != "" {
+		return
+	}
+	cfg.headers = cfg.headers.Clone()
+	if cfg.headers == nil {
+		cfg.headers = make(http.Header)
+	}
+	cfg.headers.Set(name, value)
+}
+
+// Success will create a new 'ServiceSuccess' record on the Response Channel, a request latency
+// above MaxLatency is a failure and above DegradedLatency or a issue found by the check, e.g. a
+// missing recommended security header, degrades the service
 func (s *Service) Success() {
-	s.LastOnline = time.Now().UTC()
+	latency := time.Duration(s.RequestLatency) * time.Millisecond
+	if s.MaxLatency > 0 && latency > s.MaxLatency.Duration() {
+		s.fail(FailureLatency, nil, fmt.Sprintf("Request latency %v exceeds the maximum of %v", latency, s.MaxLatency.Duration()))
+		return
+	}
+	if s.DegradedLatency > 0 && latency > s.DegradedLatency.Duration() {
+		s.success(fmt.Sprintf("Request latency %v exceeds %v", latency, s.DegradedLatency.Duration()))
+		return
+	}
+	s.success(s.degradedIssue)
+}
+
+// Degraded will create a new 'ServiceSuccess' record flagged with the issue on the Response
+// Channel, the service is still online but not fully healthy
+func (s *Service) Degraded(issue string) {
+	s.success(issue)
+}
+
+func (s *Service) success(degraded string) {
+	degraded = s.redact(degraded)
+	s.redactResult()
 	s.RetryAttempts = 0
+	s.update(func() {
+		s.LastOnline = time.Now().UTC()
+		if !s.Online || s.healthySince.IsZero() {
+			s.healthySince = s.LastOnline
+		}
+		s.ageFailureContext(s.LastOnline)
+		s.Online = true
+		s.failures = 0
+		s.DegradedText = degraded
+	})
+	if s.scout != nil {
+		s.scout.countCheck()
+	}
+	if degraded == "" {
+		s.recovered()
+	}
 	suc := ServiceSuccess{
 		Service:        s.ID,
 		RequestLatency: s.RequestLatency,
 		NetworkLatency: s.NetworkLatency,
+		IPResults:      s.IPResults,
+		TLSHandshake:   s.TLSHandshake,
+		CertExpiry:     s.CertExpiry,
+		Details:        copyDetails(s.Details),
+		Labels:         copyDetails(s.Tags),
+		Timings:        s.timings,
+		Degraded:       degraded,
+		Locations:      s.locations,
 		CreatedAt:      time.Now().UTC(),
 	}
-	s.Online = true
-	s.Responses <- suc
+	suc.Silenced, suc.Acknowledged = s.muted()
+	s.emit(suc)
+	s.baselineDue()
+	s.detectAnomalies(true)
+	s.trackSLO(true)
+	s.recordTimeline(true)
 }
 
 // Failure will create a new 'ServiceFailure' record on the Response Channel
 func (s *Service) Failure(issue string) {
+	issue = s.redact(issue)
+	s.redactResult()
 	exhausted := false
 	if s.RetryAttempts == s.RetryMax && s.RetryMax != 0 {
 		s.Stop()
 		exhausted = true
 	}
+	class := s.failureClass
+	if exhausted {
+		class = FailureRetriesExhausted
+	} else if class == "" {
+		class = FailureUnknown
+	}
+	cause := s.failureErr
+	s.failureClass, s.failureErr = "", nil
 	fail := ServiceFailure{
 		Service:          s.ID,
 		Issue:            issue,
+		Class:            class,
+		Err:              &CheckError{Class: class, Issue: issue, Err: cause},
 		NetworkLatency:   s.NetworkLatency,
 		RetriesExhausted: exhausted,
+		IPResults:        s.IPResults,
+		Details:          copyDetails(s.Details),
+		Labels:           copyDetails(s.Tags),
 		CreatedAt:        time.Now().UTC(),
 		ErrorCode:        s.LastStatusCode,
-	}
+		Timings:          s.timings,
+		Consecutive:      s.failures + 1,
+		RootCause:        s.rootCause(),
+		Retry:            s.retryInfo(),
+		Locations:        s.locations,
+	}
+	fail.Suppressed = fail.RootCause != uuid.Nil
+	fail.Silenced, fail.Acknowledged = s.muted()
 	if s.Trace {
-		ips := s.ips()
-		for _, ip := range ips {
-			trace := traceroute.Exec(ip, s.Timeout.Duration(), 3, 64, "icmp", 33434)
-			s.TraceData = append(s.TraceData, trace)
+		// the check already gave up, the trace gets a budget of its own past the check deadline
+		ctx, cancel := context.WithTimeout(context.Background(), traceMaxTTL*s.Timeout.Duration())
+		traces, err := s.RunTrace(ctx)
+		cancel()
+		if err != nil {
+			s.Logger.Warnf("Could not trace %s, %v", s.Name, err)
 		}
+		s.TraceData = traces
+		fail.TraceBaseline, _ = s.Baseline()
+	}
+	s.update(func() {
+		s.Online = false
+		s.failures++
+		s.DegradedText = ""
+		s.DownText = issue
+		s.healthySince = time.Time{}
+		s.failureResponse = s.LastResponse
+		s.lastFailure = fail.CreatedAt
+	})
+	if s.scout != nil {
+		s.scout.countCheck()
 	}
-	s.Online = false
-	s.DownText = issue
 	fail.TraceData = s.TraceData
-	s.Responses <- fail
+	s.emit(fail)
+	if s.Trace {
+		s.routeChanges(s.TraceData)
+	}
+	s.detectAnomalies(false)
+	s.trackSLO(false)
+	s.recordTimeline(false)
+}
+
+// copyDetails returns a copy of the check details or tags of a service for a result
+func copyDetails(details map[string]string) map[string]string {
+	if details == nil {
+		return nil
+	}
+	c := make(map[string]string, len(details))
+	for k, v := range details {
+		c[k] = v
+	}
+	return c
 }
 
 // LinearJitterBackoff will perform linear backoff based on the attempt number
@@ -429,21 +948,34 @@ func (s *Service) LinearJitterBackoff() {
 
 // ping will send a ICMP ping packet to the service and resturns response time in milliseconds
 func (s *Service) ping() int64 {
-	p := fastping.NewPinger()
-	p.MaxRTT = s.Timeout.Duration()
 	ips := s.ips()
 	if len(ips) < 1 {
 		return -1
 	}
+	pingTime, err := s.pingIP(ips[0])
+	if err != nil {
+		s.Logger.Warnf("Issue running ICMP to service %s, %v, %v", s.Name, s.Address, err)
+		s.fail(FailureConnect, err, fmt.Sprintf("Issue running ICMP to service %v, %v", s.Address, err))
+		return -1
+	}
+	return pingTime
+}
+
+// pingIP will send a ICMP ping packet to ip and returns the response time in milliseconds, or -1
+// when no reply arrived within the timeout
+func (s *Service) pingIP(ip net.IP) (int64, error) {
+	if err := s.context().Err(); err != nil {
+		return -1, err
+	}
+	p := fastping.NewPinger()
+	p.MaxRTT = s.remaining()
 	resolveIP := "ip4:icmp"
-	if isIPv6(ips[0].String()) {
+	if isIPv6(ip.String()) {
 		resolveIP = "ip6:icmp"
 	}
-	ra, err := net.ResolveIPAddr(resolveIP, ips[0].String())
+	ra, err := net.ResolveIPAddr(resolveIP, ip.String())
 	if err != nil {
-		s.Logger.Warnf("Could not send ICMP to service %v, %v", s.Address, err)
-		s.Failure(fmt.Sprintf("Could not send ICMP to service %v, %v", s.Address, err))
-		return -1
+		return -1, err
 	}
 	p.AddIPAddr(ra)
 	pingTime := int64(0)
@@ -453,14 +985,11 @@ func (s *Service) ping() int64 {
 		success = true
 	}
 	p.OnIdle = func() {}
-	err = p.Run()
-	if err != nil {
-		s.Logger.Warnf("Issue running ICMP to service %s, %v, %v", s.Name, s.Address, err)
-		s.Failure(fmt.Sprintf("Issue running ICMP to service %v, %v", s.Address, err))
-		return -1
+	if err := p.Run(); err != nil {
+		return -1, err
 	}
 	if success {
-		return pingTime
+		return pingTime, nil
 	}
-	return -1
+	return -1, nil
 }
@@ -0,0 +1,1305 @@
+package scout
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+
+	traceroute "github.com/phenixrizen/go-traceroute"
+)
+
+// checkOnce runs a single check for the service and returns the response it produced
+func checkOnce(serv *Service) interface{} {
+	serv.Responses = make(chan interface{}, 1)
+	serv.Initialize()
+	serv.Check()
+	return <-serv.Responses
+}
+
+func TestCheckCDN(t *testing.T) {
+	assert := assert.New(t)
+
+	edge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("hello"))
+	}))
+	defer edge.Close()
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v2"`)
+		w.Write([]byte("hello"))
+	}))
+	defer origin.Close()
+
+	serv := &Service{
+		ID:      uuid.New(),
+		Name:    "CDN",
+		Address: edge.URL,
+		Origin:  edge.Listener.Addr().String(),
+		Timeout: Duration(5 * time.Second),
+		Type:    "cdn",
+		Logger:  NewSlogLogger(nil),
+	}
+	_, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+
+	serv.Origin = origin.Listener.Addr().String()
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.True(strings.Contains(fail.Issue, "Etag"))
+}
+
+func TestCDNEdges(t *testing.T) {
+	assert := assert.New(t)
+
+	edge := func(etag string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", etag)
+			w.Write([]byte("hello"))
+		}))
+	}
+	a, b, stale := edge(`"v2"`), edge(`"v2"`), edge(`"v1"`)
+	defer a.Close()
+	defer b.Close()
+	defer stale.Close()
+	_, port, _ := net.SplitHostPort(a.Listener.Addr().String())
+
+	// a resolver of a POP that answers 127.0.0.1 for every name
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(err)
+	defer pc.Close()
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var q dnsmessage.Message
+			if q.Unpack(buf[:n]) != nil {
+				continue
+			}
+			resp := dnsmessage.Message{Header: dnsmessage.Header{ID: q.ID, Response: true}, Questions: q.Questions}
+			for _, qu := range q.Questions {
+				if qu.Type == dnsmessage.TypeA {
+					resp.Answers = append(resp.Answers, dnsmessage.Resource{
+						Header: dnsmessage.ResourceHeader{Name: qu.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+						Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+					})
+				}
+			}
+			b, _ := resp.Pack()
+			pc.WriteTo(b, addr)
+		}
+	}()
+
+	serv := &Service{
+		ID:            uuid.New(),
+		Name:          "Edges",
+		Address:       "http://cdn.scout.test:" + port + "/",
+		EdgeResolvers: []string{pc.LocalAddr().String()},
+		Edges:         []string{b.Listener.Addr().String()},
+		SkipDNSTiming: true,
+		Timeout:       Duration(5 * time.Second),
+		Type:          "cdn",
+		Logger:        NewSlogLogger(nil),
+	}
+	_, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Len(serv.IPResults, 2)
+	assert.Equal(a.Listener.Addr().String(), serv.IPResults[1].IP)
+
+	serv.Edges = append(serv.Edges, stale.Listener.Addr().String())
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureBodyMismatch, fail.Class)
+	assert.Equal(fmt.Sprintf(`1 of 3 CDN edges are inconsistent with the majority: %s: Etag "\"v1\"" != "\"v2\""`, stale.Listener.Addr()), fail.Issue)
+	assert.False(serv.IPResults[1].Online)
+
+	// the origin is the reference when there is one
+	serv.Origin = stale.Listener.Addr().String()
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Contains(fail.Issue, "2 of 3 CDN edges are inconsistent with origin")
+}
+
+func TestCompression(t *testing.T) {
+	assert := assert.New(t)
+
+	body := strings.Repeat("compress me ", 100)
+	compress := true
+	var accepted string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accepted = r.Header.Get("Accept-Encoding")
+		if !compress || !strings.Contains(accepted, "gzip") {
+			io.WriteString(w, body)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		io.WriteString(gz, body)
+		gz.Close()
+	}))
+	defer ts.Close()
+
+	serv := &Service{
+		ID:                uuid.New(),
+		Name:              "Compressed",
+		Address:           ts.URL,
+		Type:              "http",
+		ExpectedStatus:    http.StatusOK,
+		Expected:          "^compress me",
+		ExpectCompression: "gzip",
+		SkipDNSTiming:     true,
+		Interval:          Duration(time.Minute),
+		Timeout:           Duration(5 * time.Second),
+		Logger:            NewSlogLogger(nil),
+	}
+	assert.Nil(serv.Validate())
+	suc, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("gzip, deflate, br", accepted)
+	assert.Equal(body, serv.LastResponse)
+	assert.Equal("gzip", suc.Timings.ContentEncoding)
+	assert.Equal(int64(len(body)), suc.Timings.BodyBytes)
+	assert.True(suc.Timings.CompressedBytes > 0 && suc.Timings.CompressedBytes < suc.Timings.BodyBytes)
+
+	// the CDN stopped compressing
+	compress = false
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureCompression, fail.Class)
+	assert.Equal(`HTTP Response Body encoding "" did not match gzip`, fail.Issue)
+	serv.ExpectCompression = CompressionAny
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal("HTTP Response Body is not compressed", fail.Issue)
+
+	compress = true
+	serv.ExpectCompression = CompressionNone
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal("HTTP Response Body is compressed with gzip", fail.Issue)
+	serv.AcceptEncoding = "identity"
+	_, ok = checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("identity", accepted)
+
+	serv.ExpectCompression = "zstd"
+	assert.True(errors.Is(serv.Validate(), ErrInvalidExpected))
+}
+
+func TestCacheValidation(t *testing.T) {
+	assert := assert.New(t)
+
+	etag, cached := `"v1"`, true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		if cached && r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		io.WriteString(w, "asset")
+	}))
+	defer ts.Close()
+
+	serv := &Service{
+		ID:             uuid.New(),
+		Name:           "Asset",
+		Address:        ts.URL,
+		Type:           "http",
+		ExpectedStatus: http.StatusOK,
+		ValidateCache:  true,
+		SkipDNSTiming:  true,
+		Interval:       Duration(time.Minute),
+		Timeout:        Duration(5 * time.Second),
+		Logger:         NewSlogLogger(nil),
+	}
+	_, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("asset", serv.LastResponse)
+
+	cached = false
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureCacheValidation, fail.Class)
+	assert.True(errors.Is(fail.Err, ErrUnexpectedStatus))
+	assert.Equal(`Conditional HTTP request with If-None-Match "v1" returned 200 instead of 304`, fail.Issue)
+
+	etag = ""
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal("HTTP Response has no ETag or Last-Modified to validate the cache with", fail.Issue)
+}
+
+func TestHTTP2(t *testing.T) {
+	assert := assert.New(t)
+
+	h2 := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h2.EnableHTTP2 = true
+	h2.StartTLS()
+	defer h2.Close()
+	h1 := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer h1.Close()
+
+	serv := &Service{
+		ID:             uuid.New(),
+		Name:           "H2",
+		Address:        h2.URL,
+		Type:           "http",
+		ExpectedStatus: http.StatusOK,
+		SkipDNSTiming:  true,
+		Interval:       Duration(time.Minute),
+		Timeout:        Duration(5 * time.Second),
+		Logger:         NewSlogLogger(nil),
+	}
+	suc, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("HTTP/1.1", suc.Timings.Protocol)
+	serv.HTTP2 = HTTP2Require
+	suc, ok = checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("HTTP/2.0", suc.Timings.Protocol)
+
+	// a regression to HTTP/1.1 only fails when HTTP/2 is required
+	serv.Address = h1.URL
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureProtocol, fail.Class)
+	assert.Equal("HTTP Response protocol HTTP/1.1 is not HTTP/2", fail.Issue)
+	serv.HTTP2 = HTTP2Allow
+	_, ok = checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+
+	serv.HTTP2 = "prefer"
+	assert.True(errors.Is(serv.Validate(), ErrInvalidCheck))
+}
+
+// quicStub stands in for a QUIC round tripper, it speaks HTTP/1.1 over TLS with the TLS config of
+// the request and reports the responses as HTTP/3
+type quicStub struct {
+	*http.Transport
+	closed *int
+}
+
+func (q quicStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := q.Transport.RoundTrip(req)
+	if err == nil {
+		res.Proto, res.ProtoMajor, res.ProtoMinor = "HTTP/3.0", 3, 0
+	}
+	return res, err
+}
+
+func (q quicStub) Close() error {
+	*q.closed++
+	return nil
+}
+
+func TestHTTP3(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("quic"))
+	}))
+	defer ts.Close()
+
+	var dialed string
+	closed := 0
+	transport := func(addr string, tlsConf *tls.Config) http.RoundTripper {
+		dialed = addr
+		return quicStub{&http.Transport{
+			TLSClientConfig: tlsConf,
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		}, &closed}
+	}
+	serv := &Service{
+		ID:             uuid.New(),
+		Name:           "H3",
+		Address:        strings.Replace(ts.URL, "127.0.0.1", "localhost", 1),
+		ResolveTo:      ts.Listener.Addr().String(),
+		Type:           "http",
+		HTTP3:          true,
+		ExpectedStatus: http.StatusOK,
+		SkipDNSTiming:  true,
+		Interval:       Duration(time.Minute),
+		Timeout:        Duration(5 * time.Second),
+		Logger:         NewSlogLogger(nil),
+	}
+	assert.Nil(serv.Validate())
+
+	// without a transport the service can not be checked
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureConfig, fail.Class)
+
+	_, err := NewScout(nil, NewSlogLogger(nil), WithHTTP3(nil))
+	assert.NotNil(err)
+	serv.scout = &Scout{}
+	assert.Nil(WithHTTP3(transport)(serv.scout))
+	suc, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal(ts.Listener.Addr().String(), dialed)
+	assert.Equal(1, closed)
+	assert.Equal("HTTP/3.0", suc.Timings.Protocol)
+	assert.Equal(dialed, suc.Timings.RemoteAddr)
+	assert.NotEmpty(suc.Timings.TLSVersion)
+	assert.True(suc.Timings.TLSHandshake > 0)
+	assert.Equal(suc.Timings.TLSHandshake, suc.Timings.Connect)
+	assert.Equal("quic", serv.LastResponse)
+
+	// the handshake timing runs on top of the VerifyConnection of the TLS config
+	errPinned := errors.New("certificate is not pinned")
+	tlsConf := &tls.Config{InsecureSkipVerify: true, VerifyConnection: func(tls.ConnectionState) error { return errPinned }}
+	req, err := http.NewRequest(http.MethodGet, serv.Address, nil)
+	assert.Nil(err)
+	metrics := &HTTPRequestMetrics{}
+	_, err = roundTripHTTP3(req, &requestConfig{resolveTo: serv.ResolveTo, timeout: 5 * time.Second, http3: transport}, tlsConf, metrics)
+	assert.True(errors.Is(err, errPinned))
+	assert.NotEmpty(metrics.TLSVersion)
+
+	serv.Address = "http://localhost"
+	assert.True(errors.Is(serv.Validate(), ErrInvalidCheck))
+}
+
+func TestContentHash(t *testing.T) {
+	assert := assert.New(t)
+
+	body := "hello"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	serv := &Service{
+		ID:             uuid.New(),
+		Name:           "Static",
+		Address:        ts.URL,
+		Type:           "http",
+		ExpectedStatus: http.StatusOK,
+		ExpectedSHA256: "2CF24DBA5FB0A30E26E83B2AC5B9E29E1B161E5C1FA7425E73043362938B9824",
+		SkipDNSTiming:  true,
+		Interval:       Duration(time.Minute),
+		Timeout:        Duration(5 * time.Second),
+		Logger:         NewSlogLogger(nil),
+	}
+	s, err := NewScout([]*Service{serv}, NewSlogLogger(nil))
+	assert.Nil(err)
+	suc, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", suc.Details["sha256"])
+
+	body = "defaced"
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureBodyMismatch, fail.Class)
+	assert.Contains(fail.Issue, "did not match 2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824")
+
+	// the content keeps failing once it drifted until the change is accepted
+	serv.ExpectedSHA256, serv.ContentDrift = "", true
+	_, ok = checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	body = "defaced again"
+	for i := 0; i < 2; i++ {
+		fail, ok = checkOnce(serv).(ServiceFailure)
+		assert.True(ok)
+		assert.Equal(FailureContentDrift, fail.Class)
+		assert.True(errors.Is(fail.Err, ErrUnexpectedContent))
+		assert.Contains(fail.Issue, "HTTP Response Body changed from sha256 ")
+	}
+	assert.Nil(s.AcceptContent(serv.ID))
+	_, ok = checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	_, ok = checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.True(errors.Is(s.AcceptContent(uuid.New()), ErrUnknownService))
+
+	serv.ExpectedSHA256 = "abc"
+	assert.True(errors.Is(serv.Validate(), ErrInvalidExpected))
+}
+
+func TestHostHeaderAndSNI(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.Host, r.TLS.ServerName)
+	}))
+	defer ts.Close()
+
+	serv := &Service{
+		ID:             uuid.New(),
+		Name:           "Edge",
+		Address:        "https://www.scout.test/",
+		ResolveTo:      ts.Listener.Addr().String(),
+		HostHeader:     "origin.scout.test",
+		SNI:            "example.com",
+		ExpectedStatus: http.StatusOK,
+		SkipDNSTiming:  true,
+		CheckChain:     true,
+		Timeout:        Duration(5 * time.Second),
+		Type:           "http",
+		Logger:         NewSlogLogger(nil),
+	}
+	_, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("origin.scout.test example.com", serv.LastResponse)
+
+	// the certificate has to cover the SNI instead of the host of the url
+	serv.SNI = "edge.scout.test"
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureCertHostname, fail.Class)
+	assert.Contains(fail.Issue, "edge.scout.test")
+}
+
+func TestResolveDrift(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+
+	serv := &Service{
+		ID:             uuid.New(),
+		Name:           "Pinned",
+		Address:        "http://localhost:" + port,
+		ResolveTo:      "127.0.0.1:" + port,
+		Type:           "http",
+		ExpectedStatus: http.StatusOK,
+		SkipDNSTiming:  true,
+		Timeout:        Duration(5 * time.Second),
+		Logger:         NewSlogLogger(nil),
+		Responses:      make(chan interface{}, 2),
+	}
+	serv.Initialize()
+	serv.Check()
+	_, ok := (<-serv.Responses).(ServiceSuccess)
+	assert.True(ok)
+	st := serv.Snapshot()
+	assert.False(st.ResolveDrift)
+	assert.Contains(st.ResolvedIPs, "127.0.0.1")
+
+	// the drift is found within the check, before its result
+	serv.ResolveTo = "127.0.0.2:" + port
+	serv.Check()
+	drift, ok := (<-serv.Responses).(ServiceResolveDrift)
+	assert.True(ok)
+	assert.True(drift.Drifted)
+	<-serv.Responses
+	assert.True(serv.Snapshot().ResolveDrift)
+}
+
+func TestTrackRedirects(t *testing.T) {
+	assert := assert.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("moved"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	log := NewSlogLogger(nil)
+	serv := &Service{
+		ID:             uuid.New(),
+		Namespace:      "tenant-a",
+		Name:           "Old",
+		Address:        srv.URL + "/old",
+		Interval:       Duration(time.Minute),
+		Timeout:        Duration(5 * time.Second),
+		ExpectedStatus: 200,
+		Type:           "http",
+		TrackRedirects: true,
+	}
+	s, err := NewScout([]*Service{serv}, log)
+	assert.Nil(err)
+	go serv.Check()
+
+	moved, ok := (<-s.Responses).(ServiceMoved)
+	assert.True(ok)
+	assert.Equal(srv.URL+"/new", moved.To)
+	_, ok = (<-s.Responses).(ServiceSuccess)
+	assert.True(ok)
+
+	follow := s.GetService(moved.NewService)
+	assert.NotNil(follow)
+	assert.Equal(srv.URL+"/new", follow.Address)
+	assert.Equal(srv.URL+"/new", serv.MovedTo)
+	// the follow-up service stays in the namespace of the moved one
+	assert.Equal("tenant-a", follow.Namespace)
+	assert.True(Principal{Name: "a", Namespace: "tenant-a"}.Allowed(follow))
+	assert.False(Principal{Name: "b", Namespace: "tenant-b"}.Allowed(follow))
+
+	// a second move replaces the follow-up service instead of changing it under its check
+	assert.Equal(follow.ID, s.followMove(serv, srv.URL+"/newer"))
+	replaced := s.GetService(follow.ID)
+	assert.Equal(srv.URL+"/newer", replaced.Address)
+	assert.Equal(srv.URL+"/new", follow.Address)
+	assert.Equal(follow.CreatedAt, replaced.CreatedAt)
+}
+
+// fill sets v to a value that is not zero
+func fill(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1)
+	case reflect.Interface:
+		if v.NumMethod() == 0 {
+			v.Set(reflect.ValueOf("x"))
+		}
+	case reflect.Array:
+		fill(v.Index(0))
+	case reflect.Ptr:
+		p := reflect.New(v.Type().Elem())
+		fill(p.Elem())
+		v.Set(p)
+	case reflect.Slice:
+		e := reflect.New(v.Type().Elem()).Elem()
+		fill(e)
+		v.Set(reflect.Append(reflect.MakeSlice(v.Type(), 0, 1), e))
+	case reflect.Map:
+		k, e := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+		fill(k)
+		fill(e)
+		v.Set(reflect.MakeMap(v.Type()))
+		v.SetMapIndex(k, e)
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			v.Set(reflect.ValueOf(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				fill(v.Field(i))
+			}
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	assert := assert.New(t)
+
+	serv := &Service{}
+	src := reflect.ValueOf(serv).Elem()
+	for i := 0; i < src.NumField(); i++ {
+		if f := src.Type().Field(i); f.PkgPath == "" && f.Tag.Get("json") != "-" {
+			fill(src.Field(i))
+		}
+	}
+	c := serv.clone()
+	dst := reflect.ValueOf(c).Elem()
+	for i := 0; i < dst.NumField(); i++ {
+		f := dst.Type().Field(i)
+		if f.PkgPath != "" || f.Tag.Get("json") == "-" {
+			continue
+		}
+		switch {
+		case f.Name == "CreatedAt" || f.Name == "UpdatedAt":
+			assert.NotEqual(src.Field(i).Interface(), dst.Field(i).Interface(), f.Name)
+		case stateFields[f.Name] || cloneExempt[f.Name]:
+			assert.True(dst.Field(i).IsZero(), "%s is state and should not be copied", f.Name)
+		default:
+			assert.Equal(src.Field(i).Interface(), dst.Field(i).Interface(), "%s is config and should be copied", f.Name)
+		}
+	}
+	// the copy does not share the maps and slices of the service
+	c.Tags["x"] = "y"
+	c.Command[0] = "y"
+	assert.Equal("x", serv.Tags["x"])
+	assert.Equal("x", serv.Command[0])
+}
+
+func TestRequiredIPs(t *testing.T) {
+	assert := assert.New(t)
+
+	serv := &Service{}
+	assert.Equal(3, serv.requiredIPs(3))
+	serv.IPPolicy = IPPolicyAny
+	assert.Equal(1, serv.requiredIPs(3))
+	serv.IPPolicy = IPPolicyQuorum
+	assert.Equal(2, serv.requiredIPs(3))
+	assert.Equal(3, serv.requiredIPs(4))
+	serv.IPQuorum = 1
+	assert.Equal(1, serv.requiredIPs(4))
+}
+
+func TestSampleSize(t *testing.T) {
+	assert := assert.New(t)
+
+	serv := &Service{ID: uuid.New(), SampleSize: 3, Responses: make(chan interface{}, 3)}
+	serv.Initialize()
+	serv.RequestLatency = 10
+	serv.Success()
+	serv.RequestLatency = 30
+	serv.Success()
+	assert.Len(serv.Responses, 0)
+	serv.Failure("down")
+
+	sample, ok := (<-serv.Responses).(ServiceSample)
+	assert.True(ok)
+	assert.Equal(3, sample.Checks)
+	assert.Equal(2, sample.Successes)
+	assert.Equal(int64(10), sample.MinLatency)
+	assert.Equal(int64(30), sample.MaxLatency)
+	assert.Equal(int64(20), sample.AvgLatency)
+	assert.Equal("down", sample.LastIssue)
+	assert.False(sample.Online)
+}
+
+func TestFailureTTL(t *testing.T) {
+	assert := assert.New(t)
+
+	serv := &Service{ID: uuid.New(), Name: "Flaky", FailureTTL: Duration(time.Millisecond), Logger: NewSlogLogger(nil)}
+	serv.Responses = make(chan interface{}, 4)
+	serv.LastResponse = "502 Bad Gateway"
+	serv.Failure("HTTP Status Code 502 did not match 200")
+	serv.Success()
+	assert.Equal("HTTP Status Code 502 did not match 200", serv.DownText)
+
+	time.Sleep(2 * time.Millisecond)
+	serv.Success()
+	assert.Empty(serv.DownText)
+	assert.Empty(serv.LastResponse)
+}
+
+func TestReadAll(t *testing.T) {
+	assert := assert.New(t)
+
+	first, err := readAll(strings.NewReader("first response"))
+	assert.Nil(err)
+	assert.Equal("first response", first.String())
+	putBuffer(first)
+	// a buffer given back is emptied before it is read into again
+	second, err := readAll(strings.NewReader("second"))
+	assert.Nil(err)
+	assert.Equal("second", second.String())
+	putBuffer(second)
+
+	buf, truncated, err := readLimit(strings.NewReader("0123456789"), 4)
+	assert.Nil(err)
+	assert.True(truncated)
+	assert.Equal("0123", buf.String())
+	putBuffer(buf)
+}
+
+func TestReleaseBody(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pooled"))
+	}))
+	defer ts.Close()
+
+	// the body of a response stops reading its contents once they are released
+	contents, res, metrics, err := doHTTPRequest(context.Background(), &requestConfig{url: ts.URL, method: "GET", timeout: time.Second})
+	assert.Nil(err)
+	assert.Equal("pooled", string(contents))
+	metrics.release()
+	_, err = io.ReadAll(res.Body)
+	assert.Equal(errReleased, err)
+
+	// the contents of HTTPRequest are never released
+	_, res, _, err = HTTPRequest(context.Background(), ts.URL, "", "GET", nil, nil, nil, time.Second, false)
+	assert.Nil(err)
+	body, err := io.ReadAll(res.Body)
+	assert.Nil(err)
+	assert.Equal("pooled", string(body))
+}
+
+// BenchmarkCheckHTTP reports the allocations of a HTTP check of a 64KiB response, run with
+// -benchmem
+func BenchmarkCheckHTTP(b *testing.B) {
+	body := strings.Repeat("x", 64<<10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+	defer ts.Close()
+
+	serv := &Service{
+		ID:             uuid.New(),
+		Name:           "Bench",
+		Address:        ts.URL,
+		Type:           "http",
+		ExpectedStatus: http.StatusOK,
+		SkipDNSTiming:  true,
+		Interval:       Duration(time.Minute),
+		Timeout:        Duration(5 * time.Second),
+		Logger:         NewSlogLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		Responses:      make(chan interface{}, 1),
+	}
+	serv.Initialize()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		serv.Check()
+		<-serv.Responses
+	}
+}
+
+func TestBodySize(t *testing.T) {
+	assert := assert.New(t)
+
+	body := strings.Repeat("x", 100)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+	defer ts.Close()
+
+	serv := &Service{
+		ID:             uuid.New(),
+		Name:           "Size",
+		Address:        ts.URL,
+		Type:           "http",
+		ExpectedStatus: http.StatusOK,
+		ReadLimit:      10,
+		SkipDNSTiming:  true,
+		Interval:       Duration(time.Minute),
+		Timeout:        Duration(5 * time.Second),
+		Logger:         NewSlogLogger(nil),
+	}
+	assert.Nil(serv.Validate())
+	_, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("xxxxxxxxxx\n[truncated after 10 bytes]", serv.LastResponse)
+
+	// the limit is raised to the bounds so a truncated body is above them
+	serv.MinBodyBytes, serv.MaxBodyBytes = 50, 80
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureBodyMismatch, fail.Class)
+	assert.Equal("HTTP Response Body of more than 80 bytes exceeds the maximum of 80", fail.Issue)
+	serv.MaxBodyBytes = 100
+	_, ok = checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal(body, serv.LastResponse)
+	body = "tiny"
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal("HTTP Response Body of 4 bytes is below the minimum of 50", fail.Issue)
+
+	serv.MinBodyBytes = 200
+	assert.True(errors.Is(serv.Validate(), ErrInvalidExpected))
+
+	// HTTPRequest reads the whole body
+	body = strings.Repeat("x", DefaultReadLimit+1)
+	contents, _, metrics, err := HTTPRequest(context.Background(), serv.Address, "", "GET", nil, nil, nil, 5*time.Second, false)
+	assert.Nil(err)
+	assert.Len(contents, DefaultReadLimit+1)
+	assert.False(metrics.Truncated)
+}
+
+func TestCaptureDebug(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Served-By", "scout-test")
+		if r.URL.Path == "/large" {
+			w.Write([]byte(strings.Repeat("hunter2 ", maxDebugBody)))
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	serv := &Service{
+		ID:             uuid.New(),
+		Name:           "Debug",
+		Address:        ts.URL,
+		Type:           "http",
+		ExpectedStatus: 200,
+		SkipDNSTiming:  true,
+		Headers:        http.Header{"Authorization": {"Bearer secret"}},
+		Logger:         NewSlogLogger(nil),
+	}
+	serv.CaptureDebug(1)
+	checkOnce(serv)
+	checkOnce(serv)
+
+	captures := serv.DebugCaptures()
+	if assert.Len(captures, 1) && assert.Len(captures[0].Exchanges, 1) {
+		ex := captures[0].Exchanges[0]
+		assert.True(captures[0].Online)
+		assert.Equal(200, ex.Status)
+		assert.Equal("ok", ex.Body)
+		assert.Equal("scout-test", ex.ResponseHeaders.Get("X-Served-By"))
+		assert.Equal("REDACTED", ex.RequestHeaders.Get("Authorization"))
+		assert.Equal(ts.Listener.Addr().String(), ex.RemoteAddr)
+	}
+	assert.Empty(serv.DebugCaptures())
+
+	// the secrets are redacted from bodies too large to be kept whole
+	serv.Address = ts.URL + "/large"
+	serv.secrets = map[string]string{"env:PASSWORD": "hunter2"}
+	serv.CaptureDebug(1)
+	checkOnce(serv)
+	captures = serv.DebugCaptures()
+	if assert.Len(captures, 1) && assert.Len(captures[0].Exchanges, 1) {
+		ex := captures[0].Exchanges[0]
+		assert.True(ex.BodyTruncated)
+		assert.Len(ex.Body, maxDebugBody)
+		assert.NotContains(ex.Body, "hunter")
+	}
+}
+
+func TestLatencyThresholds(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(60 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	serv := &Service{
+		ID:              uuid.New(),
+		Name:            "Slow",
+		Address:         ts.URL,
+		Type:            "http",
+		ExpectedStatus:  200,
+		Timeout:         Duration(2 * time.Second),
+		DegradedLatency: Duration(30 * time.Millisecond),
+		Logger:          NewSlogLogger(nil),
+	}
+	suc, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Contains(suc.Degraded, "exceeds 30ms")
+
+	serv.MaxLatency = Duration(40 * time.Millisecond)
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Contains(fail.Issue, "exceeds the maximum of 40ms")
+	assert.Equal(FailureLatency, fail.Class)
+
+	serv.DegradedLatency, serv.MaxLatency = 0, Duration(time.Second)
+	suc, ok = checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Empty(suc.Degraded)
+}
+
+func TestTimings(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	serv := &Service{
+		ID:             uuid.New(),
+		Name:           "Timed",
+		Address:        ts.URL,
+		Type:           "http",
+		ExpectedStatus: 200,
+		SkipDNSTiming:  true,
+		Timeout:        Duration(2 * time.Second),
+		Logger:         NewSlogLogger(nil),
+	}
+	suc, ok := checkOnce(serv).(ServiceSuccess)
+	if assert.True(ok) && assert.NotNil(suc.Timings) {
+		assert.NotZero(suc.Timings.Connect)
+		assert.Zero(suc.Timings.TLSHandshake)
+		assert.True(suc.Timings.TTFB.Duration() >= 20*time.Millisecond)
+		assert.True(suc.Timings.Total >= suc.Timings.TTFB)
+		assert.Equal(ts.Listener.Addr().String(), suc.Timings.RemoteAddr)
+		assert.Equal("HTTP/1.1", suc.Timings.Protocol)
+	}
+
+	serv.Type = "tcp"
+	serv.Address = ts.Listener.Addr().String()
+	suc, ok = checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Nil(suc.Timings)
+}
+
+func TestFailureClass(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	serv := &Service{
+		ID:             uuid.New(),
+		Name:           "Classified",
+		Address:        ts.URL,
+		Type:           "http",
+		ExpectedStatus: 201,
+		SkipDNSTiming:  true,
+		Timeout:        Duration(2 * time.Second),
+		Logger:         NewSlogLogger(nil),
+	}
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureStatusMismatch, fail.Class)
+	assert.True(errors.Is(fail.Err, ErrUnexpectedStatus))
+	assert.Equal(fail.Issue, fail.Err.Error())
+
+	serv.ExpectedStatus, serv.Expected = 200, "^healthy$"
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureBodyMismatch, fail.Class)
+
+	// a closed listener refuses the connection
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	l.Close()
+	serv.Type, serv.Address = "tcp", l.Addr().String()
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureConnectRefused, fail.Class)
+	assert.True(errors.Is(fail.Err, ErrConnectionRefused))
+	assert.True(errors.Is(fail.Err, ErrCheckFailed))
+	assert.False(errors.Is(fail.Err, ErrTimeout))
+	var opErr *net.OpError
+	assert.True(errors.As(fail.Err, &opErr))
+	assert.Equal("dial", opErr.Op)
+
+	serv.Failure("custom")
+	fail = (<-serv.Responses).(ServiceFailure)
+	assert.Equal(FailureUnknown, fail.Class)
+	assert.True(errors.Is(fail.Err, ErrCheckFailed))
+	assert.Nil(errors.Unwrap(fail.Err))
+
+	assert.Equal(FailureDNS, classifyError(&net.DNSError{Err: "no such host", Name: "x.invalid"}, false))
+	assert.Equal(FailureReadTimeout, classifyError(fmt.Errorf("wrapped %w", os.ErrDeadlineExceeded), true))
+	assert.Equal(FailureConnectTimeout, classifyError(os.ErrDeadlineExceeded, false))
+	assert.Equal(FailureTLS, classifyError(errors.New("remote error: tls: handshake failure"), true))
+	assert.Equal(FailureProtocol, classifyError(io.EOF, true))
+}
+
+func TestCheckDeadline(t *testing.T) {
+	assert := assert.New(t)
+
+	// the banner read shares the deadline of the check with the dial
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	serv := &Service{
+		ID:             uuid.New(),
+		Name:           "Silent",
+		Address:        l.Addr().String(),
+		Type:           "tcp",
+		SendPayload:    "PING\r\n",
+		ExpectedBanner: "PONG",
+		SkipDNSTiming:  true,
+		SkipPing:       true,
+		Timeout:        Duration(100 * time.Millisecond),
+		Logger:         NewSlogLogger(nil),
+	}
+	start := time.Now()
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.True(errors.Is(fail.Err, ErrTimeout))
+	assert.True(time.Since(start) < time.Second)
+	assert.Equal(context.Background(), serv.context())
+
+	// a slow HTTP response is cut off at the deadline
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte("late"))
+	}))
+	defer ts.Close()
+	serv.Type, serv.Address, serv.ExpectedStatus = "http", ts.URL, 200
+	start = time.Now()
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.True(errors.Is(fail.Err, ErrTimeout))
+	assert.True(time.Since(start) < 250*time.Millisecond)
+}
+
+func TestBackoff(t *testing.T) {
+	assert := assert.New(t)
+
+	backoffs := func(serv *Service, n int) []time.Duration {
+		serv.RetryAttempts = 0
+		sleeps := make([]time.Duration, n)
+		for i := range sleeps {
+			serv.Backoff()
+			sleeps[i] = serv.SleepDuration.Duration()
+		}
+		return sleeps
+	}
+	serv := &Service{Retry: true, RetryMinInterval: Duration(time.Second), RetryMaxInterval: Duration(time.Second)}
+	assert.Equal([]time.Duration{time.Second, 2 * time.Second, 3 * time.Second}, backoffs(serv, 3))
+	serv.RetryStrategy = RetryFixed
+	assert.Equal([]time.Duration{time.Second, time.Second, time.Second}, backoffs(serv, 3))
+	serv.RetryStrategy = RetryFibonacci
+	assert.Equal([]time.Duration{time.Second, time.Second, 2 * time.Second, 3 * time.Second, 5 * time.Second}, backoffs(serv, 5))
+	serv.RetryStrategy = RetryExponentialJitter
+	assert.Equal([]time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}, backoffs(serv, 4))
+
+	// the cap bounds every strategy, also past the point the exponent overflows
+	serv.RetryCap = Duration(5 * time.Second)
+	sleeps := backoffs(serv, 100)
+	assert.Equal(5*time.Second, sleeps[3])
+	assert.Equal(5*time.Second, sleeps[99])
+
+	// jitter stays between the intervals
+	serv.RetryCap, serv.RetryMaxInterval = 0, Duration(2*time.Second)
+	for _, sleep := range backoffs(serv, 1) {
+		assert.True(sleep >= time.Second && sleep < 2*time.Second)
+	}
+
+	// failures carry where the service is in its backoff
+	serv.ID, serv.Responses, serv.RetryMax = uuid.New(), make(chan interface{}, 1), 5
+	serv.Initialize()
+	serv.RetryAttempts, serv.SleepDuration = 2, Duration(3*time.Second)
+	serv.Failure("down")
+	fail := (<-serv.Responses).(ServiceFailure)
+	if assert.NotNil(fail.Retry) {
+		assert.Equal(RetryInfo{Strategy: RetryExponentialJitter, Attempt: 2, Max: 5, Backoff: Duration(3 * time.Second)}, *fail.Retry)
+	}
+}
+
+func TestRecoveryInterval(t *testing.T) {
+	assert := assert.New(t)
+
+	serv := &Service{Interval: Duration(time.Minute), RecoveryInterval: Duration(10 * time.Second)}
+	var sleeps []time.Duration
+	for serv.failures = 1; serv.failures <= 4; serv.failures++ {
+		sleeps = append(sleeps, serv.recoveryInterval().Duration())
+	}
+	assert.Equal([]time.Duration{30 * time.Second, 15 * time.Second, 10 * time.Second, 10 * time.Second}, sleeps)
+
+	// a floor above the interval never checks less often than the interval
+	serv.RecoveryInterval = Duration(time.Hour)
+	assert.Equal(Duration(time.Minute), serv.recoveryInterval())
+	serv.RecoveryInterval = -1
+	assert.True(errors.Is(serv.Validate(), ErrInvalidInterval))
+}
+
+func TestSnapshot(t *testing.T) {
+	assert := assert.New(t)
+
+	serv := &Service{ID: uuid.New(), Name: "Snap", Type: "tcp", Logger: NewSlogLogger(nil)}
+	serv.Responses = make(chan interface{}, 4)
+	assert.Equal(StatePending, serv.Snapshot().State)
+	assert.Equal(serv.ID, serv.Snapshot().ID)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			serv.Snapshot()
+		}
+	}()
+	serv.RequestLatency = 12
+	serv.LastResponse = "pong"
+	serv.Success()
+	<-done
+	st := serv.Snapshot()
+	assert.Equal(StateUp, st.State)
+	assert.True(st.Online)
+	assert.Equal(int64(12), st.RequestLatency)
+	assert.Equal("pong", st.LastResponse)
+	assert.False(st.LastOnline.IsZero())
+
+	serv.Failure("connection refused")
+	serv.Failure("connection refused")
+	st = serv.Snapshot()
+	assert.Equal(StateDown, st.State)
+	assert.Equal("connection refused", st.DownText)
+	assert.Equal(2, st.Consecutive)
+	// the snapshot does not change with the service
+	serv.LastResponse = "changed"
+	assert.Equal("pong", st.LastResponse)
+
+	// nor with the slices of the service
+	serv.ResolvedIPs = []string{"10.0.0.1"}
+	serv.publish()
+	serv.ResolvedIPs[0] = "10.0.0.2"
+	assert.Equal([]string{"10.0.0.1"}, serv.Snapshot().ResolvedIPs)
+}
+
+func TestAnomalies(t *testing.T) {
+	assert := assert.New(t)
+
+	serv := &Service{ID: uuid.New(), Name: "API", AnomalySigma: 3, Logger: NewSlogLogger(nil)}
+	serv.Responses = make(chan interface{}, 4)
+	anomalies := func() []ServiceAnomaly {
+		var found []ServiceAnomaly
+		for len(serv.Responses) > 0 {
+			if a, ok := (<-serv.Responses).(ServiceAnomaly); ok {
+				found = append(found, a)
+			}
+		}
+		return found
+	}
+	for i := 0; i < 40; i++ {
+		serv.RequestLatency = 95 + int64(i%2)*10
+		serv.Success()
+		assert.Empty(anomalies())
+	}
+
+	serv.RequestLatency = 300
+	serv.Success()
+	found := anomalies()
+	if assert.Len(found, 1) {
+		assert.Equal(AnomalyLatency, found[0].Metric)
+		assert.InDelta(100, found[0].Mean, 5)
+		assert.True(found[0].ZScore > 3)
+	}
+	// a ongoing anomaly is only sent once
+	serv.Success()
+	assert.Empty(anomalies())
+
+	serv.Failure("connection refused")
+	found = anomalies()
+	if assert.Len(found, 1) {
+		assert.Equal(AnomalyAvailability, found[0].Metric)
+		assert.InDelta(0.7, found[0].Value, 0.01)
+	}
+}
+
+func TestSLO(t *testing.T) {
+	assert := assert.New(t)
+
+	serv := &Service{ID: uuid.New(), Name: "API", SLO: &SLO{Target: 99, Window: Duration(240 * time.Hour)}, Logger: NewSlogLogger(nil)}
+	serv.Responses = make(chan interface{}, 4)
+	burns := func() []SLOBurn {
+		var found []SLOBurn
+		for len(serv.Responses) > 0 {
+			if b, ok := (<-serv.Responses).(SLOBurn); ok {
+				found = append(found, b)
+			}
+		}
+		return found
+	}
+	for i := 0; i < 100; i++ {
+		serv.Success()
+		assert.Empty(burns())
+	}
+
+	// every failure burns 1% of the checks, the rules fire once as the burn rate passes them
+	var fired []SLOBurn
+	for i := 0; i < 20; i++ {
+		serv.Failure("connection refused")
+		fired = append(fired, burns()...)
+	}
+	if assert.Len(fired, 3) {
+		assert.Equal(BurnSlow, fired[0].Severity)
+		assert.Equal(BurnFast, fired[1].Severity)
+		assert.Equal(6.0, fired[1].Threshold)
+		assert.Equal(BurnFast, fired[2].Severity)
+		assert.Equal(14.4, fired[2].Threshold)
+		assert.Equal(Duration(20*time.Minute), fired[2].LongWindow)
+	}
+
+	s, err := NewScout([]*Service{serv}, NewSlogLogger(nil))
+	assert.Nil(err)
+	st, err := s.SLOStatus(serv.ID)
+	assert.Nil(err)
+	assert.Equal(uint64(100), st.Good)
+	assert.Equal(uint64(20), st.Bad)
+	assert.InDelta(83.33, st.Availability, 0.01)
+	assert.True(st.BudgetRemaining < 0)
+	_, err = s.SLOStatus(uuid.New())
+	assert.True(errors.Is(err, ErrUnknownService))
+}
+
+func TestTraceBaseline(t *testing.T) {
+	assert := assert.New(t)
+
+	traced := make(chan net.IP, 4)
+	hop := net.ParseIP("198.51.100.1")
+	defer func(trace func(context.Context, net.IP, time.Duration) (traceroute.TraceData, error)) {
+		traceIP = trace
+	}(traceIP)
+	traceIP = func(ctx context.Context, ip net.IP, timeout time.Duration) (traceroute.TraceData, error) {
+		traced <- ip
+		return traceroute.TraceData{Dest: ip, Hops: [][]traceroute.Hop{{{TTL: 1, AddrIP: hop}, {TTL: 2, AddrIP: ip}}}}, nil
+	}
+	traceDone := func(serv *Service) {
+		<-traced
+		for atomic.LoadInt32(&serv.tracing) == 1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	serv := &Service{ID: uuid.New(), Name: "Edge", Address: "192.0.2.10", Type: "tcp", TraceInterval: Duration(time.Hour), Logger: NewSlogLogger(nil)}
+	serv.Responses = make(chan interface{}, 8)
+	traces, err := serv.RunTrace(context.Background())
+	assert.Nil(err)
+	assert.Len(traces, 1)
+	<-traced
+
+	// a healthy service takes a baseline once per interval, it is kept with the next check
+	serv.Success()
+	traceDone(serv)
+	serv.Success()
+	baseline, at := serv.Baseline()
+	assert.Len(baseline, 1)
+	assert.False(at.IsZero())
+	serv.Success()
+	time.Sleep(10 * time.Millisecond)
+	assert.Len(traced, 0)
+
+	// a failure is traced, carries the baseline to compare with and reports the changed hops
+	hop = net.ParseIP("203.0.113.1")
+	serv.Trace = true
+	serv.Failure("connection refused")
+	<-traced
+	var changed []RouteChanged
+	for len(serv.Responses) > 0 {
+		switch r := (<-serv.Responses).(type) {
+		case ServiceFailure:
+			assert.Len(r.TraceData, 1)
+			assert.Len(r.TraceBaseline, 1)
+		case RouteChanged:
+			changed = append(changed, r)
+		}
+	}
+	if assert.Len(changed, 1) {
+		assert.Equal("192.0.2.10", changed[0].Dest)
+		assert.Equal([]HopChange{{TTL: 1, From: "198.51.100.1", To: "203.0.113.1"}}, changed[0].Changes)
+	}
+}
+
+func TestDiffPaths(t *testing.T) {
+	assert := assert.New(t)
+	assert.Empty(diffPaths([]string{"10.0.0.1", "*", "10.0.2.1"}, []string{"10.0.0.1", "10.0.1.1", "10.0.2.1"}))
+	assert.Equal([]HopChange{{TTL: 2, From: "10.0.1.1", To: "10.0.9.1"}, {TTL: 3, From: "10.0.2.1"}},
+		diffPaths([]string{"10.0.0.1", "10.0.1.1", "10.0.2.1"}, []string{"10.0.0.1", "10.0.9.1"}))
+}
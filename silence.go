@@ -0,0 +1,77 @@
+package scout
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Silence stops the notifications of the service with the ID for the duration while its checks
+// keep running, the recovery of a failure that was notified before is still sent
+func (s *Scout) Silence(id uuid.UUID, d time.Duration, reason string) error {
+	serv := s.GetService(id)
+	if serv == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownService, id)
+	}
+	serv.silenceMux.Lock()
+	serv.SilencedUntil = time.Now().UTC().Add(d)
+	serv.SilenceReason = reason
+	serv.silenceMux.Unlock()
+	s.Logger.Infof("Service %s silenced until %s: %s", serv.Name, serv.SilencedUntil.Format(time.RFC3339), reason)
+	return nil
+}
+
+// Unsilence ends the silence of the service with the ID
+func (s *Scout) Unsilence(id uuid.UUID) error {
+	serv := s.GetService(id)
+	if serv == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownService, id)
+	}
+	serv.silenceMux.Lock()
+	serv.SilencedUntil = time.Time{}
+	serv.SilenceReason = ""
+	serv.silenceMux.Unlock()
+	return nil
+}
+
+// Acknowledge stops the notifications of the ongoing failure of the service with the ID until
+// it recovers, it fails with ErrNoIncident when the service is not failing
+func (s *Scout) Acknowledge(id uuid.UUID, reason string) error {
+	serv := s.GetService(id)
+	if serv == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownService, id)
+	}
+	serv.silenceMux.Lock()
+	defer serv.silenceMux.Unlock()
+	if serv.Snapshot().State != StateDown {
+		return fmt.Errorf("%w: %s", ErrNoIncident, id)
+	}
+	serv.Acknowledged = true
+	serv.AckReason = reason
+	s.Logger.Infof("Service %s acknowledged: %s", serv.Name, reason)
+	return nil
+}
+
+// IsSilenced returns true if the notifications of the service are silenced or its ongoing
+// failure is acknowledged
+func (s *Service) IsSilenced() bool {
+	s.silenceMux.Lock()
+	defer s.silenceMux.Unlock()
+	return s.Acknowledged || time.Now().Before(s.SilencedUntil)
+}
+
+// muted returns whether the service is silenced and whether its failure is acknowledged
+func (s *Service) muted() (silenced, acknowledged bool) {
+	s.silenceMux.Lock()
+	defer s.silenceMux.Unlock()
+	return time.Now().Before(s.SilencedUntil), s.Acknowledged
+}
+
+// recovered clears the acknowledgment of the ongoing failure of the service
+func (s *Service) recovered() {
+	s.silenceMux.Lock()
+	s.Acknowledged = false
+	s.AckReason = ""
+	s.silenceMux.Unlock()
+}
@@ -0,0 +1,212 @@
+package scout
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// BurnFast is the severity of a burn rate that exhausts the error budget within days, it
+	// should page
+	BurnFast = "fast"
+	// BurnSlow is the severity of a burn rate that exhausts the error budget within the window,
+	// it should open a ticket
+	BurnSlow = "slow"
+
+	sloBuckets = 8640
+)
+
+// burnRules are the multiwindow burn rate alerts of the Google SRE workbook, the windows are
+// fractions of the SLO window, for a 30 day window a 14.4 burn over 1h and 5m or a 6 burn over
+// 6h and 30m is fast and a 1 burn over 3d and 6h is slow
+var burnRules = []struct {
+	severity    string
+	factor      float64
+	long, short float64
+}{
+	{BurnFast, 14.4, 1.0 / 720, 1.0 / 8640},
+	{BurnFast, 6, 1.0 / 120, 1.0 / 1440},
+	{BurnSlow, 1, 1.0 / 10, 1.0 / 120},
+}
+
+// SLO is a service level objective of a service or group, Target is the percentage of checks
+// that have to succeed within the Window, e.g. 99.9 over 30 days
+type SLO struct {
+	Target float64  `json:"target"`
+	Window Duration `json:"window"`
+}
+
+// SLOStatus is the error budget of a service or group over its SLO window
+type SLOStatus struct {
+	Target          float64  `json:"target"`
+	Window          Duration `json:"window"`
+	Good            uint64   `json:"good"`
+	Bad             uint64   `json:"bad"`
+	Availability    float64  `json:"availability"`
+	BudgetRemaining float64  `json:"budgetRemaining"`
+}
+
+// SLOBurn is sent on the Response Channel when the error budget of a service or group starts
+// burning faster than a burn rule allows over both of its windows
+type SLOBurn struct {
+	Service         uuid.UUID `json:"service"`
+	Severity        string    `json:"severity"`
+	BurnRate        float64   `json:"burnRate"`
+	Threshold       float64   `json:"threshold"`
+	LongWindow      Duration  `json:"longWindow"`
+	ShortWindow     Duration  `json:"shortWindow"`
+	BudgetRemaining float64   `json:"budgetRemaining"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// ServiceID returns the ID of the service or group burning its error budget
+func (r SLOBurn) ServiceID() uuid.UUID { return r.Service }
+
+// Time returns when the burn was detected
+func (r SLOBurn) Time() time.Time { return r.CreatedAt }
+
+// sloTracker counts the good and bad checks of a SLO window in buckets
+type sloTracker struct {
+	mux      sync.Mutex
+	slo      SLO
+	width    int64
+	epochs   []int64
+	good     []uint32
+	bad      []uint32
+	alerting []bool
+}
+
+func newSLOTracker(slo SLO) *sloTracker {
+	width := int64(slo.Window) / sloBuckets
+	if width < 1 {
+		width = 1
+	}
+	return &sloTracker{
+		slo:      slo,
+		width:    width,
+		epochs:   make([]int64, sloBuckets),
+		good:     make([]uint32, sloBuckets),
+		bad:      make([]uint32, sloBuckets),
+		alerting: make([]bool, len(burnRules)),
+	}
+}
+
+// valid reports whether the SLO can be tracked
+func (slo *SLO) valid() bool {
+	return slo != nil && slo.Target > 0 && slo.Target < 100 && slo.Window > 0
+}
+
+// add counts a check at the time and returns the burn alerts that started firing with it
+func (t *sloTracker) add(id uuid.UUID, at time.Time, ok bool) []Result {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	epoch := at.UnixNano() / t.width
+	i := epoch % sloBuckets
+	if t.epochs[i] != epoch {
+		t.epochs[i], t.good[i], t.bad[i] = epoch, 0, 0
+	}
+	if ok {
+		t.good[i]++
+	} else {
+		t.bad[i]++
+	}
+
+	var burns []Result
+	for r, rule := range burnRules {
+		long := time.Duration(float64(t.slo.Window) * rule.long)
+		short := time.Duration(float64(t.slo.Window) * rule.short)
+		burn := t.burnRate(at, long)
+		firing := burn > rule.factor && t.burnRate(at, short) > rule.factor
+		if firing && !t.alerting[r] {
+			burns = append(burns, SLOBurn{
+				Service:         id,
+				Severity:        rule.severity,
+				BurnRate:        burn,
+				Threshold:       rule.factor,
+				LongWindow:      Duration(long),
+				ShortWindow:     Duration(short),
+				BudgetRemaining: t.status(at).BudgetRemaining,
+				CreatedAt:       time.Now().UTC(),
+			})
+		}
+		t.alerting[r] = firing
+	}
+	return burns
+}
+
+// counts returns the good and bad checks of the window ending at the time
+func (t *sloTracker) counts(at time.Time, window time.Duration) (good, bad uint64) {
+	end := at.UnixNano() / t.width
+	n := int64(window) / t.width
+	if n < 1 {
+		n = 1
+	}
+	if n > sloBuckets {
+		n = sloBuckets
+	}
+	for epoch := end - n + 1; epoch <= end; epoch++ {
+		i := epoch % sloBuckets
+		if t.epochs[i] == epoch {
+			good += uint64(t.good[i])
+			bad += uint64(t.bad[i])
+		}
+	}
+	return good, bad
+}
+
+// burnRate returns how many times faster than allowed the error budget burned over the window
+func (t *sloTracker) burnRate(at time.Time, window time.Duration) float64 {
+	good, bad := t.counts(at, window)
+	if good+bad == 0 {
+		return 0
+	}
+	return float64(bad) / float64(good+bad) / (1 - t.slo.Target/100)
+}
+
+// status returns the error budget of the SLO window ending at the time
+func (t *sloTracker) status(at time.Time) SLOStatus {
+	st := SLOStatus{Target: t.slo.Target, Window: t.slo.Window, Availability: 100, BudgetRemaining: 1}
+	st.Good, st.Bad = t.counts(at, t.slo.Window.Duration())
+	if total := st.Good + st.Bad; total > 0 {
+		st.Availability = float64(st.Good) / float64(total) * 100
+		st.BudgetRemaining = 1 - float64(st.Bad)/float64(total)/(1-t.slo.Target/100)
+	}
+	return st
+}
+
+// trackSLO counts the last check of the service towards its SLO and sends the burn alerts
+func (s *Service) trackSLO(ok bool) {
+	if !s.SLO.valid() {
+		return
+	}
+	if s.slo == nil || s.slo.slo != *s.SLO {
+		s.slo = newSLOTracker(*s.SLO)
+	}
+	for _, burn := range s.slo.add(s.ID, time.Now(), ok) {
+		s.emit(burn)
+	}
+}
+
+// SLOStatus returns the error budget of the service or group with the ID
+func (s *Scout) SLOStatus(id uuid.UUID) (SLOStatus, error) {
+	s.mux.RLock()
+	var tracker *sloTracker
+	if serv, ok := s.Services[id]; ok {
+		tracker = serv.slo
+	} else if g, ok := s.groups[id]; ok {
+		tracker = g.slo
+	} else {
+		s.mux.RUnlock()
+		return SLOStatus{}, fmt.Errorf("%w: %s", ErrUnknownService, id)
+	}
+	s.mux.RUnlock()
+	if tracker == nil {
+		return SLOStatus{}, fmt.Errorf("%w: %s", ErrNoSLO, id)
+	}
+	tracker.mux.Lock()
+	defer tracker.mux.Unlock()
+	return tracker.status(time.Now()), nil
+}
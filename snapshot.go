@@ -0,0 +1,110 @@
+package scout
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ServiceStatus is a copy of the state of a service after its last check, it is safe to read
+// while the service keeps checking
+type ServiceStatus struct {
+	ID             uuid.UUID `json:"id"`
+	Name           string    `json:"name"`
+	Type           string    `json:"type"`
+	State          string    `json:"state"`
+	Online         bool      `json:"online"`
+	Paused         bool      `json:"paused"`
+	RequestLatency int64     `json:"requestLatency"`
+	NetworkLatency int64     `json:"networkLatency"`
+	LastResponse   string    `json:"lastResponse"`
+	LastStatusCode int       `json:"lastStatusCode"`
+	LastOnline     time.Time `json:"lastOnline"`
+	LastFailure    time.Time `json:"lastFailure"`
+	DownText       string    `json:"downText,omitempty"`
+	DegradedText   string    `json:"degradedText,omitempty"`
+	Consecutive    int       `json:"consecutive"`
+	// ResolveDrift is whether the host of a service pinned with ResolveTo last resolved to
+	// ResolvedIPs without the pinned address
+	ResolveDrift bool     `json:"resolveDrift,omitempty"`
+	ResolvedIPs  []string `json:"resolvedIPs,omitempty"`
+}
+
+// Snapshot returns the state of the service after its last check, unlike the fields of the
+// service it can be read from any go routine
+func (s *Service) Snapshot() ServiceStatus {
+	s.statusMux.RLock()
+	defer s.statusMux.RUnlock()
+	st := s.status
+	if st.ID == uuid.Nil {
+		st.ID, st.Name, st.Type, st.State = s.ID, s.Name, s.Type, StatePending
+	}
+	return st
+}
+
+// publish makes the current state of the service the one returned by Snapshot, it is called by
+// the check go routine whenever the state changes
+func (s *Service) publish() {
+	s.update(func() {})
+}
+
+// update changes the state of the service and publishes it under the status lock. The state is
+// only written through update and the setters below, so it is never changed while it is copied
+// for Snapshot
+func (s *Service) update(change func()) {
+	s.statusMux.Lock()
+	defer s.statusMux.Unlock()
+	change()
+	s.status = ServiceStatus{
+		ID:             s.ID,
+		Name:           s.Name,
+		Type:           s.Type,
+		State:          s.State(),
+		Online:         s.Online,
+		Paused:         s.Paused,
+		RequestLatency: s.RequestLatency,
+		NetworkLatency: s.NetworkLatency,
+		LastResponse:   s.LastResponse,
+		LastStatusCode: s.LastStatusCode,
+		LastOnline:     s.LastOnline,
+		LastFailure:    s.lastFailure,
+		DownText:       s.DownText,
+		DegradedText:   s.DegradedText,
+		Consecutive:    s.failures,
+		ResolveDrift:   s.resolveDrift,
+		// the snapshot gets its own copy, the service replaces or changes its own later
+		ResolvedIPs: append([]string(nil), s.ResolvedIPs...),
+	}
+}
+
+// setNetworkLatency records the network latency of the running check, it is published with the
+// result of the check
+func (s *Service) setNetworkLatency(ms int64) {
+	s.statusMux.Lock()
+	s.NetworkLatency = ms
+	s.statusMux.Unlock()
+}
+
+// setRequestLatency records the request latency of the running check, it is published with the
+// result of the check
+func (s *Service) setRequestLatency(ms int64) {
+	s.statusMux.Lock()
+	s.RequestLatency = ms
+	s.statusMux.Unlock()
+}
+
+// setResponse records the response of the running check, it is published with the result of the
+// check
+func (s *Service) setResponse(text string) {
+	s.statusMux.Lock()
+	s.LastResponse = text
+	s.statusMux.Unlock()
+}
+
+// setStatusCode records the status code of the running check, it is published with the result
+// of the check
+func (s *Service) setStatusCode(code int) {
+	s.statusMux.Lock()
+	s.LastStatusCode = code
+	s.statusMux.Unlock()
+}
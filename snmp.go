@@ -0,0 +1,631 @@
+package scout
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	defaultSNMPPort = 161
+
+	// SNMPv2c uses community based security, it is the default SNMP version
+	SNMPv2c = "2c"
+	// SNMPv3 uses the user based security model
+	SNMPv3 = "3"
+
+	snmpGetRequest = 0xA0
+	snmpResponse   = 0xA2
+	snmpReport     = 0xA8
+
+	snmpMaxMessage = 65507
+
+	snmpFlagAuth       = 0x01
+	snmpFlagPriv       = 0x02
+	snmpFlagReportable = 0x04
+)
+
+// usmStats are the USM report counters (RFC 3414) an agent answers failed requests with
+var usmStats = map[string]string{
+	"1.3.6.1.6.3.15.1.1.1.0": "unsupported security level",
+	"1.3.6.1.6.3.15.1.1.2.0": "not in time window",
+	"1.3.6.1.6.3.15.1.1.3.0": "unknown user name",
+	"1.3.6.1.6.3.15.1.1.4.0": "unknown engine id",
+	"1.3.6.1.6.3.15.1.1.5.0": "wrong digest",
+	"1.3.6.1.6.3.15.1.1.6.0": "decryption error",
+}
+
+// snmpAuth are the supported USM authentication protocols with the length of their digest
+var snmpAuth = map[string]struct {
+	hash   func() hash.Hash
+	digest int
+}{
+	"MD5":    {md5.New, 12},
+	"SHA":    {sha1.New, 12},
+	"SHA256": {sha256.New, 24},
+}
+
+// SNMPConfig configures the SNMP check of a service
+type SNMPConfig struct {
+	// Version is SNMPv2c (default) or SNMPv3
+	Version   string `json:"version"`
+	Community string `json:"community"`
+	// OIDs are fetched with a single GET and asserted on
+	OIDs []SNMPOID `json:"oids"`
+	// User, AuthProtocol (MD5, SHA or SHA256), AuthPassword, PrivProtocol (AES) and PrivPassword
+	// configure the SNMPv3 user, the security level follows from the protocols that are set
+	User         string `json:"user"`
+	AuthProtocol string `json:"authProtocol"`
+	AuthPassword string `json:"authPassword"`
+	PrivProtocol string `json:"privProtocol"`
+	PrivPassword string `json:"privPassword"`
+	ContextName  string `json:"contextName"`
+}
+
+// SNMPOID is a OID to fetch, its value has to match Expected and numeric values have to lie
+// within Min and Max when they are set
+type SNMPOID struct {
+	OID      string   `json:"oid"`
+	Expected string   `json:"expected"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+}
+
+// snmpValue is the value of a fetched variable binding
+type snmpValue struct {
+	value   string
+	number  float64
+	numeric bool
+	err     error
+}
+
+// CheckSNMP will GET the OIDs of the SNMP config from the agent of the service and fail when a
+// OID does not exist or its value does not match its assertions, the values are kept in Details
+// by OID and the GET round-trip as the request latency
+func (s *Service) CheckSNMP() {
+	cfg := s.SNMP
+	if cfg == nil || len(cfg.OIDs) == 0 {
+		s.fail(FailureConfig, nil, "SNMP service has no OIDs to fetch")
+		return
+	}
+	if len(s.secrets) > 0 {
+		resolved := *cfg
+		resolved.Community = s.secret(cfg.Community)
+		resolved.AuthPassword, resolved.PrivPassword = s.secret(cfg.AuthPassword), s.secret(cfg.PrivPassword)
+		cfg = &resolved
+	}
+	oids := make([][]byte, len(cfg.OIDs))
+	for i, o := range cfg.OIDs {
+		enc, err := berOID(o.OID)
+		if err != nil {
+			s.fail(FailureConfig, err, fmt.Sprintf("SNMP OID Error %v", err))
+			return
+		}
+		oids[i] = enc
+	}
+
+	conn, err := s.dial(s.network("udp"), s.netAddress(defaultSNMPPort))
+	if err != nil {
+		s.fail(classifyError(err, false), err, fmt.Sprintf("Dial Error %v", err))
+		return
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(s.deadline()); err != nil {
+		s.fail(FailureProtocol, err, fmt.Sprintf("SNMP Deadline Error %v", err))
+		return
+	}
+
+	t1 := time.Now()
+	var values map[string]snmpValue
+	switch cfg.Version {
+	case "", SNMPv2c:
+		values, err = snmpGetV2c(conn, cfg.Community, oids)
+	case SNMPv3:
+		values, err = snmpGetV3(conn, cfg, oids)
+	default:
+		err = fmt.Errorf("unsupported version %q", cfg.Version)
+	}
+	if err != nil {
+		s.fail(classifyError(err, true), err, fmt.Sprintf("SNMP Error %v", err))
+		return
+	}
+	s.setRequestLatency(time.Since(t1).Milliseconds())
+
+	s.Details = make(map[string]string, len(cfg.OIDs))
+	for _, o := range cfg.OIDs {
+		oid := strings.TrimPrefix(o.OID, ".")
+		v, ok := values[oid]
+		if !ok {
+			s.fail(FailureProtocol, nil, fmt.Sprintf("SNMP agent did not return %v", oid))
+			return
+		}
+		if v.err != nil {
+			s.fail(FailureProtocol, v.err, fmt.Sprintf("SNMP %v: %v", oid, v.err))
+			return
+		}
+		s.Details[oid] = v.value
+		if issue := o.assert(v); issue != "" {
+			s.fail(FailureUnhealthy, nil, fmt.Sprintf("SNMP %v %v", oid, issue))
+			return
+		}
+	}
+	s.Success()
+}
+
+// assert returns a issue when v does not match the assertions of the OID
+func (o SNMPOID) assert(v snmpValue) string {
+	if o.Expected != "" {
+		match, err := regexp.MatchString(o.Expected, v.value)
+		if err != nil {
+			return fmt.Sprintf("has a invalid expected value %v, %v", o.Expected, err)
+		}
+		if !match {
+			return fmt.Sprintf("value '%v' did not match '%v'", v.value, o.Expected)
+		}
+	}
+	if o.Min == nil && o.Max == nil {
+		return ""
+	}
+	if !v.numeric {
+		return fmt.Sprintf("value '%v' is not numeric", v.value)
+	}
+	if o.Min != nil && v.number < *o.Min {
+		return fmt.Sprintf("value %v is below %v", v.value, *o.Min)
+	}
+	if o.Max != nil && v.number > *o.Max {
+		return fmt.Sprintf("value %v is above %v", v.value, *o.Max)
+	}
+	return ""
+}
+
+// snmpGetPDU encodes a GetRequest-PDU for the encoded OIDs
+func snmpGetPDU(requestID int64, oids [][]byte) []byte {
+	binds := make([][]byte, len(oids))
+	for i, oid := range oids {
+		binds[i] = berSeq(0x30, oid, berTLV(0x05, nil))
+	}
+	return berSeq(snmpGetRequest,
+		berInt(0x02, requestID),
+		berInt(0x02, 0),
+		berInt(0x02, 0),
+		berSeq(0x30, binds...),
+	)
+}
+
+// snmpRequestID returns a random request or message id
+func snmpRequestID() int64 {
+	n, err := rand.Int(rand.Reader, big.NewInt(1<<31-1))
+	if err != nil {
+		return time.Now().UnixNano() & (1<<31 - 1)
+	}
+	return n.Int64()
+}
+
+// snmpExchange sends msg and returns the response
+func snmpExchange(conn net.Conn, msg []byte) ([]byte, error) {
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, snmpMaxMessage)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func snmpGetV2c(conn net.Conn, community string, oids [][]byte) (map[string]snmpValue, error) {
+	if community == "" {
+		community = "public"
+	}
+	id := snmpRequestID()
+	msg := berSeq(0x30,
+		berInt(0x02, 1),
+		berTLV(0x04, []byte(community)),
+		snmpGetPDU(id, oids),
+	)
+	resp, err := snmpExchange(conn, msg)
+	if err != nil {
+		return nil, err
+	}
+	_, body, _, err := berParse(resp)
+	if err != nil {
+		return nil, err
+	}
+	// skip the version and community
+	if _, _, body, err = berParse(body); err != nil {
+		return nil, err
+	}
+	if _, _, body, err = berParse(body); err != nil {
+		return nil, err
+	}
+	tag, pdu, _, err := berParse(body)
+	if err != nil {
+		return nil, err
+	}
+	if tag != snmpResponse {
+		return nil, fmt.Errorf("unexpected PDU 0x%x", tag)
+	}
+	return snmpParsePDU(pdu, id)
+}
+
+// snmpParsePDU returns the variable bindings of a Response-PDU for the request id
+func snmpParsePDU(pdu []byte, requestID int64) (map[string]snmpValue, error) {
+	_, id, pdu, err := berParse(pdu)
+	if err != nil {
+		return nil, err
+	}
+	if berParseInt(id) != requestID {
+		return nil, fmt.Errorf("response for request %v, expected %v", berParseInt(id), requestID)
+	}
+	_, status, pdu, err := berParse(pdu)
+	if err != nil {
+		return nil, err
+	}
+	_, index, pdu, err := berParse(pdu)
+	if err != nil {
+		return nil, err
+	}
+	if code := berParseInt(status); code != 0 {
+		return nil, fmt.Errorf("error status %v at index %v", code, berParseInt(index))
+	}
+	_, binds, _, err := berParse(pdu)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]snmpValue)
+	for len(binds) > 0 {
+		var bind []byte
+		if _, bind, binds, err = berParse(binds); err != nil {
+			return nil, err
+		}
+		_, oid, bind, err := berParse(bind)
+		if err != nil {
+			return nil, err
+		}
+		tag, value, _, err := berParse(bind)
+		if err != nil {
+			return nil, err
+		}
+		values[berParseOID(oid)] = snmpDecode(tag, value)
+	}
+	return values, nil
+}
+
+// snmpDecode decodes the value of a variable binding
+func snmpDecode(tag byte, value []byte) snmpValue {
+	switch tag {
+	case 0x02:
+		n := berParseInt(value)
+		return snmpValue{value: strconv.FormatInt(n, 10), number: float64(n), numeric: true}
+	case 0x41, 0x42, 0x43, 0x46:
+		n := berParseUint(value)
+		return snmpValue{value: strconv.FormatUint(n, 10), number: float64(n), numeric: true}
+	case 0x04:
+		if utf8.Valid(value) && strings.IndexFunc(string(value), func(r rune) bool { return !unicode.IsPrint(r) && !unicode.IsSpace(r) }) < 0 {
+			return snmpValue{value: string(value)}
+		}
+		return snmpValue{value: hex.EncodeToString(value)}
+	case 0x05:
+		return snmpValue{}
+	case 0x06:
+		return snmpValue{value: berParseOID(value)}
+	case 0x40:
+		return snmpValue{value: net.IP(value).String()}
+	case 0x80:
+		return snmpValue{err: errors.New("no such object")}
+	case 0x81:
+		return snmpValue{err: errors.New("no such instance")}
+	case 0x82:
+		return snmpValue{err: errors.New("end of mib view")}
+	}
+	return snmpValue{value: hex.EncodeToString(value)}
+}
+
+// snmpUSM is the user based security state of a SNMPv3 exchange with a agent
+type snmpUSM struct {
+	cfg      *SNMPConfig
+	engineID []byte
+	boots    int64
+	time     int64
+	authKey  []byte
+	privKey  []byte
+}
+
+func snmpGetV3(conn net.Conn, cfg *SNMPConfig, oids [][]byte) (map[string]snmpValue, error) {
+	usm := &snmpUSM{cfg: cfg}
+	if cfg.PrivProtocol != "" && cfg.AuthProtocol == "" {
+		return nil, errors.New("privacy requires a authentication protocol")
+	}
+	if cfg.PrivProtocol != "" && cfg.PrivProtocol != "AES" {
+		return nil, fmt.Errorf("unsupported privacy protocol %q", cfg.PrivProtocol)
+	}
+	if _, ok := snmpAuth[cfg.AuthProtocol]; cfg.AuthProtocol != "" && !ok {
+		return nil, fmt.Errorf("unsupported authentication protocol %q", cfg.AuthProtocol)
+	}
+
+	// discover the engine id, boots and time of the agent
+	if _, err := usm.get(conn, nil, true); err != nil {
+		return nil, fmt.Errorf("engine discovery: %v", err)
+	}
+	if auth, ok := snmpAuth[cfg.AuthProtocol]; ok {
+		usm.authKey = snmpLocalizeKey(auth.hash, cfg.AuthPassword, usm.engineID)
+		if cfg.PrivProtocol != "" {
+			usm.privKey = snmpLocalizeKey(auth.hash, cfg.PrivPassword, usm.engineID)[:16]
+		}
+	}
+	values, err := usm.get(conn, oids, false)
+	if err == errSNMPTimeWindow {
+		// the report carried the current boots and time of the agent
+		values, err = usm.get(conn, oids, false)
+	}
+	return values, err
+}
+
+var errSNMPTimeWindow = errors.New("not in time window")
+
+// flags returns the message flags of the security level of the user
+func (u *snmpUSM) flags() byte {
+	flags := byte(snmpFlagReportable)
+	if u.authKey != nil {
+		flags |= snmpFlagAuth
+	}
+	if u.privKey != nil {
+		flags |= snmpFlagPriv
+	}
+	return flags
+}
+
+// get sends a GetRequest for the OIDs, a discovery request is sent without a user and only
+// updates the engine id, boots and time from the report of the agent
+func (u *snmpUSM) get(conn net.Conn, oids [][]byte, discovery bool) (map[string]snmpValue, error) {
+	msgID, requestID := snmpRequestID(), snmpRequestID()
+	flags := byte(snmpFlagReportable)
+	user := ""
+	if !discovery {
+		flags = u.flags()
+		user = u.cfg.User
+	}
+	scoped := berSeq(0x30,
+		berTLV(0x04, u.engineID),
+		berTLV(0x04, []byte(u.cfg.ContextName)),
+		snmpGetPDU(requestID, oids),
+	)
+	var salt []byte
+	msgData := scoped
+	if flags&snmpFlagPriv != 0 {
+		salt = make([]byte, 8)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		enc, err := u.crypt(scoped, salt, u.boots, u.time, true)
+		if err != nil {
+			return nil, err
+		}
+		msgData = berTLV(0x04, enc)
+	}
+
+	var authParams []byte
+	if flags&snmpFlagAuth != 0 {
+		authParams = make([]byte, snmpAuth[u.cfg.AuthProtocol].digest)
+	}
+	build := func(authParams []byte) []byte {
+		params := berSeq(0x30,
+			berTLV(0x04, u.engineID),
+			berInt(0x02, u.boots),
+			berInt(0x02, u.time),
+			berTLV(0x04, []byte(user)),
+			berTLV(0x04, authParams),
+			berTLV(0x04, salt),
+		)
+		return berSeq(0x30,
+			berInt(0x02, 3),
+			berSeq(0x30,
+				berInt(0x02, msgID),
+				berInt(0x02, snmpMaxMessage),
+				berTLV(0x04, []byte{flags}),
+				berInt(0x02, 3),
+			),
+			berTLV(0x04, params),
+			msgData,
+		)
+	}
+	msg := build(authParams)
+	if flags&snmpFlagAuth != 0 {
+		msg = build(u.digest(msg))
+	}
+
+	resp, err := snmpExchange(conn, msg)
+	if err != nil {
+		return nil, err
+	}
+	tag, pdu, err := u.parse(resp, msgID)
+	if err != nil {
+		return nil, err
+	}
+	if tag == snmpReport {
+		values, _ := snmpParseReport(pdu)
+		for oid := range values {
+			if discovery && oid == "1.3.6.1.6.3.15.1.1.4.0" {
+				return nil, nil
+			}
+			if oid == "1.3.6.1.6.3.15.1.1.2.0" {
+				return nil, errSNMPTimeWindow
+			}
+			if reason, ok := usmStats[oid]; ok {
+				return nil, errors.New(reason)
+			}
+		}
+		if discovery {
+			return nil, nil
+		}
+		return nil, errors.New("agent sent a report")
+	}
+	if tag != snmpResponse {
+		return nil, fmt.Errorf("unexpected PDU 0x%x", tag)
+	}
+	return snmpParsePDU(pdu, requestID)
+}
+
+// snmpParseReport returns the variable bindings of a Report-PDU, its request id is not checked
+// as agents may not know it when they fail to decode the request
+func snmpParseReport(pdu []byte) (map[string]snmpValue, error) {
+	_, id, _, err := berParse(pdu)
+	if err != nil {
+		return nil, err
+	}
+	return snmpParsePDU(pdu, berParseInt(id))
+}
+
+// parse verifies and decrypts a SNMPv3 response, keeping the engine id, boots and time of the
+// agent, and returns its PDU
+func (u *snmpUSM) parse(resp []byte, msgID int64) (byte, []byte, error) {
+	_, body, _, err := berParse(resp)
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, _, body, err = berParse(body); err != nil {
+		return 0, nil, err
+	}
+	_, global, body, err := berParse(body)
+	if err != nil {
+		return 0, nil, err
+	}
+	_, id, global, err := berParse(global)
+	if err != nil {
+		return 0, nil, err
+	}
+	if berParseInt(id) != msgID {
+		return 0, nil, fmt.Errorf("response for message %v, expected %v", berParseInt(id), msgID)
+	}
+	if _, _, global, err = berParse(global); err != nil {
+		return 0, nil, err
+	}
+	_, flags, _, err := berParse(global)
+	if err != nil || len(flags) != 1 {
+		return 0, nil, errors.New("invalid message flags")
+	}
+	_, params, msgData, err := berParse(body)
+	if err != nil {
+		return 0, nil, err
+	}
+	_, params, _, err = berParse(params)
+	if err != nil {
+		return 0, nil, err
+	}
+	fields := make([][]byte, 6)
+	for i := range fields {
+		if _, fields[i], params, err = berParse(params); err != nil {
+			return 0, nil, err
+		}
+	}
+	u.engineID = append([]byte(nil), fields[0]...)
+	u.boots, u.time = berParseInt(fields[1]), berParseInt(fields[2])
+
+	if flags[0]&snmpFlagAuth != 0 {
+		if u.authKey == nil {
+			return 0, nil, errors.New("authenticated response to a unauthenticated request")
+		}
+		authParams := fields[4]
+		received := append([]byte(nil), authParams...)
+		// authParams is a slice of resp, blank it to compute the digest of the response
+		offset := cap(resp) - cap(authParams)
+		check := append([]byte(nil), resp...)
+		for i := range received {
+			check[offset+i] = 0
+		}
+		if !hmac.Equal(received, u.digest(check)) {
+			return 0, nil, errors.New("response has a wrong digest")
+		}
+	}
+	if flags[0]&snmpFlagPriv != 0 {
+		_, enc, _, err := berParse(msgData)
+		if err != nil {
+			return 0, nil, err
+		}
+		if msgData, err = u.crypt(enc, fields[5], u.boots, u.time, false); err != nil {
+			return 0, nil, err
+		}
+	}
+	_, scoped, _, err := berParse(msgData)
+	if err != nil {
+		return 0, nil, err
+	}
+	// skip the context engine id and name
+	if _, _, scoped, err = berParse(scoped); err != nil {
+		return 0, nil, err
+	}
+	if _, _, scoped, err = berParse(scoped); err != nil {
+		return 0, nil, err
+	}
+	tag, pdu, _, err := berParse(scoped)
+	return tag, pdu, err
+}
+
+// digest returns the truncated HMAC of msg with the localized authentication key
+func (u *snmpUSM) digest(msg []byte) []byte {
+	auth := snmpAuth[u.cfg.AuthProtocol]
+	mac := hmac.New(auth.hash, u.authKey)
+	mac.Write(msg)
+	return mac.Sum(nil)[:auth.digest]
+}
+
+// crypt encrypts or decrypts data with AES-128 in CFB mode (RFC 3826)
+func (u *snmpUSM) crypt(data, salt []byte, boots, engineTime int64, encrypt bool) ([]byte, error) {
+	if len(salt) != 8 {
+		return nil, errors.New("invalid privacy parameters")
+	}
+	block, err := aes.NewCipher(u.privKey)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, 16)
+	binary.BigEndian.PutUint32(iv, uint32(boots))
+	binary.BigEndian.PutUint32(iv[4:], uint32(engineTime))
+	copy(iv[8:], salt)
+	out := make([]byte, len(data))
+	if encrypt {
+		cipher.NewCFBEncrypter(block, iv).XORKeyStream(out, data)
+	} else {
+		cipher.NewCFBDecrypter(block, iv).XORKeyStream(out, data)
+	}
+	return out, nil
+}
+
+// snmpLocalizeKey derives the key of a password localized to the engine id (RFC 3414 A.2)
+func snmpLocalizeKey(h func() hash.Hash, password string, engineID []byte) []byte {
+	if password == "" {
+		password = "\x00"
+	}
+	d := h()
+	buf := make([]byte, 64)
+	for i := 0; i < 1048576; i += 64 {
+		for j := range buf {
+			buf[j] = password[(i+j)%len(password)]
+		}
+		d.Write(buf)
+	}
+	ku := d.Sum(nil)
+	d = h()
+	d.Write(ku)
+	d.Write(engineID)
+	d.Write(ku)
+	return d.Sum(nil)
+}
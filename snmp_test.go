@@ -0,0 +1,112 @@
+package scout
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckSNMP(t *testing.T) {
+	assert := assert.New(t)
+
+	// the agent answers ifOperStatus.1 and sysName.0, sysUpTime.0 does not exist
+	values := map[string][]byte{
+		"1.3.6.1.2.1.2.2.1.8.1": berInt(0x02, 1),
+		"1.3.6.1.2.1.1.5.0":     berTLV(0x04, []byte("core-sw1")),
+		"1.3.6.1.2.1.1.3.0":     berTLV(0x80, nil),
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go func() {
+		buf := make([]byte, snmpMaxMessage)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, body, _, _ := berParse(buf[:n])
+			_, _, body, _ = berParse(body)
+			_, community, body, _ := berParse(body)
+			if string(community) != "private" {
+				continue
+			}
+			_, pdu, _, _ := berParse(body)
+			_, id, pdu, _ := berParse(pdu)
+			_, _, pdu, _ = berParse(pdu)
+			_, _, pdu, _ = berParse(pdu)
+			_, binds, _, _ := berParse(pdu)
+			var out [][]byte
+			for len(binds) > 0 {
+				var bind, oid []byte
+				_, bind, binds, _ = berParse(binds)
+				_, oid, _, _ = berParse(bind)
+				out = append(out, berSeq(0x30, berTLV(0x06, oid), values[berParseOID(oid)]))
+			}
+			res := berSeq(0x30,
+				berInt(0x02, 1),
+				berTLV(0x04, community),
+				berSeq(snmpResponse, berTLV(0x02, id), berInt(0x02, 0), berInt(0x02, 0), berSeq(0x30, out...)),
+			)
+			pc.WriteTo(res, addr)
+		}
+	}()
+
+	one := 1.0
+	addr := pc.LocalAddr().(*net.UDPAddr)
+	serv := &Service{
+		ID:      uuid.New(),
+		Name:    "SNMP",
+		Type:    "snmp",
+		Address: addr.IP.String(),
+		Port:    addr.Port,
+		SNMP: &SNMPConfig{
+			Community: "private",
+			OIDs: []SNMPOID{
+				{OID: ".1.3.6.1.2.1.2.2.1.8.1", Min: &one, Max: &one},
+				{OID: "1.3.6.1.2.1.1.5.0", Expected: "^core-"},
+			},
+		},
+		Timeout: Duration(2 * time.Second),
+		Logger:  NewSlogLogger(nil),
+	}
+	suc, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("1", suc.Details["1.3.6.1.2.1.2.2.1.8.1"])
+	assert.Equal("core-sw1", suc.Details["1.3.6.1.2.1.1.5.0"])
+
+	serv.SNMP.OIDs[1].Expected = "^edge-"
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Contains(fail.Issue, "did not match")
+
+	serv.SNMP.OIDs = []SNMPOID{{OID: "1.3.6.1.2.1.1.3.0"}}
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Contains(fail.Issue, "no such object")
+}
+
+func TestSNMPOIDAssert(t *testing.T) {
+	assert := assert.New(t)
+	min, max := 10.0, 20.0
+	o := SNMPOID{Min: &min, Max: &max}
+	assert.Equal("", o.assert(snmpValue{value: "15", number: 15, numeric: true}))
+	assert.Contains(o.assert(snmpValue{value: "5", number: 5, numeric: true}), "below")
+	assert.Contains(o.assert(snmpValue{value: "25", number: 25, numeric: true}), "above")
+	assert.Contains(o.assert(snmpValue{value: "up"}), "not numeric")
+}
+
+func TestSNMPLocalizeKey(t *testing.T) {
+	// RFC 3414 A.3.1 and A.3.2
+	engineID, _ := hex.DecodeString("000000000000000000000002")
+	assert.Equal(t, "526f5eed9fcce26f8964c2930787d82b", hex.EncodeToString(snmpLocalizeKey(md5.New, "maplesyrup", engineID)))
+	assert.Equal(t, "6695febc9288e36282235fc7151f128497b38f3f", hex.EncodeToString(snmpLocalizeKey(sha1.New, "maplesyrup", engineID)))
+}
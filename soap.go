@@ -0,0 +1,242 @@
+package scout
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const (
+	// SOAP11 posts SOAP 1.1 envelopes with a SOAPAction header, it is the default SOAP version
+	SOAP11 = "1.1"
+	// SOAP12 posts SOAP 1.2 envelopes with the action in the Content-Type
+	SOAP12 = "1.2"
+)
+
+// soapNamespaces are the envelope namespaces of the SOAP versions
+var soapNamespaces = map[string]string{
+	SOAP11: "http://schemas.xmlsoap.org/soap/envelope/",
+	SOAP12: "http://www.w3.org/2003/05/soap-envelope",
+}
+
+// SOAPConfig configures the SOAP check of a service, the envelope is posted to the address of the
+// service with the Action of the operation
+type SOAPConfig struct {
+	// Version is SOAP11 (default) or SOAP12
+	Version string `json:"version,omitempty"`
+	Action  string `json:"action,omitempty"`
+	// Body is a text/template of the content of the soap:Body, or Envelope of the whole envelope,
+	// e.g. to add a WS-Security header. They are executed with the Variables, XML escaped
+	Body      string            `json:"body,omitempty"`
+	Envelope  string            `json:"envelope,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
+	// Assertions are matched against the response envelope
+	Assertions []XPathAssertion `json:"assertions,omitempty"`
+}
+
+// XPathAssertion asserts on the values of the nodes the XPath Path selects, e.g.
+// //GetQuoteResponse/Price or count(//Order[@status='open']), each value has to match Expected
+// and numeric values have to lie within Min and Max when they are set. A path that selects
+// nothing fails the assertion
+type XPathAssertion struct {
+	Path     string   `json:"path"`
+	Expected string   `json:"expected,omitempty"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+}
+
+// CheckSOAP will post the envelope of the SOAP config of the service and fail when the response
+// is a SOAP fault, matches none of the HTTP assertions of the service, is not a SOAP envelope or
+// does not match the assertions of the config. The asserted values are kept in Details by path
+func (s *Service) CheckSOAP() {
+	if s.SOAP == nil || (strings.TrimSpace(s.SOAP.Body) == "" && strings.TrimSpace(s.SOAP.Envelope) == "") {
+		s.fail(FailureConfig, nil, "SOAP service has no envelope")
+		return
+	}
+	content, res, metrics, err := s.request(s.context(), s.ResolveTo)
+	defer metrics.release()
+	s.timings = metrics.Timings()
+	if err != nil {
+		s.fail(metrics.classifyError(err), err, fmt.Sprintf("SOAP Error %v", err))
+		return
+	}
+	s.setNetworkLatency(metrics.NetworkLatency())
+	s.setRequestLatency(metrics.RequestLatency())
+	s.setResponse(metrics.response(content))
+	s.setStatusCode(res.StatusCode)
+	if s.timedOut() {
+		return
+	}
+	// faults are answered with a 500, the fault says more than the status
+	doc, parseErr := parseXML(content)
+	if parseErr == nil {
+		if fault := soapFault(doc); fault != "" {
+			s.fail(FailureUnhealthy, nil, "SOAP Fault "+fault)
+			return
+		}
+	}
+	if issue := s.verifyHTTP(content, res, metrics); issue != "" {
+		s.Failure(issue)
+		return
+	}
+	if parseErr != nil {
+		s.fail(FailureProtocol, parseErr, fmt.Sprintf("SOAP Response Error %v", parseErr))
+		return
+	}
+	if len(mustXPath("/Envelope/Body").eval(doc)) == 0 {
+		s.fail(FailureProtocol, nil, "SOAP Response is not a envelope with a body")
+		return
+	}
+	s.Details = make(map[string]string, len(s.SOAP.Assertions))
+	for _, a := range s.SOAP.Assertions {
+		x, err := parseXPath(a.Path)
+		if err != nil {
+			s.fail(FailureConfig, err, fmt.Sprintf("SOAP path %v: %v", a.Path, err))
+			return
+		}
+		values := x.eval(doc)
+		if len(values) == 0 {
+			s.fail(FailureBodyMismatch, nil, fmt.Sprintf("SOAP Response has nothing at %v", a.Path))
+			return
+		}
+		s.Details[a.Path] = strings.Join(values, ", ")
+		for _, v := range values {
+			if issue := a.assert(v); issue != "" {
+				s.fail(FailureBodyMismatch, nil, fmt.Sprintf("SOAP Response at %v %v", a.Path, issue))
+				return
+			}
+		}
+	}
+	s.Success()
+}
+
+// assert returns a issue when the value does not match the assertion
+func (a XPathAssertion) assert(value string) string {
+	if a.Expected != "" {
+		if match, _ := regexp.MatchString(a.Expected, value); !match {
+			return fmt.Sprintf("value '%v' did not match '%v'", value, a.Expected)
+		}
+	}
+	if a.Min == nil && a.Max == nil {
+		return ""
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Sprintf("value '%v' is not numeric", value)
+	}
+	if a.Min != nil && number < *a.Min {
+		return fmt.Sprintf("value %v is below %v", value, *a.Min)
+	}
+	if a.Max != nil && number > *a.Max {
+		return fmt.Sprintf("value %v is above %v", value, *a.Max)
+	}
+	return ""
+}
+
+// soapFault returns the code and reason of the fault of a SOAP 1.1 or 1.2 response, empty when
+// it is not a fault
+func soapFault(doc *xmlNode) string {
+	if len(mustXPath("/Envelope/Body/Fault").eval(doc)) == 0 {
+		return ""
+	}
+	var parts []string
+	for _, paths := range [][]string{
+		{"/Envelope/Body/Fault/faultcode", "/Envelope/Body/Fault/Code/Value"},
+		{"/Envelope/Body/Fault/faultstring", "/Envelope/Body/Fault/Reason/Text"},
+	} {
+		for _, path := range paths {
+			if values := mustXPath(path).eval(doc); len(values) > 0 && values[0] != "" {
+				parts = append(parts, values[0])
+				break
+			}
+		}
+	}
+	if len(parts) == 0 {
+		return "without a reason"
+	}
+	return strings.Join(parts, ": ")
+}
+
+// mustXPath parses a XPath that is known to be valid
+func mustXPath(expr string) *xpath {
+	x, err := parseXPath(expr)
+	if err != nil {
+		panic(err)
+	}
+	return x
+}
+
+// soapEnvelope returns the envelope of the service, the Envelope or the Body wrapped in one,
+// executed with the XML escaped Variables
+func (s *Service) soapEnvelope() ([]byte, error) {
+	cfg := s.SOAP
+	text := cfg.Envelope
+	if strings.TrimSpace(text) == "" {
+		text = `<?xml version="1.0" encoding="utf-8"?>` +
+			`<soap:Envelope xmlns:soap="` + soapNamespaces[cfg.version()] + `"><soap:Body>` + cfg.Body + `</soap:Body></soap:Envelope>`
+	}
+	tmpl, err := template.New(s.Name).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[string]string, len(cfg.Variables))
+	for k, v := range cfg.Variables {
+		var b bytes.Buffer
+		xml.EscapeText(&b, []byte(v))
+		vars[k] = b.String()
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, vars); err != nil {
+		return nil, err
+	}
+	return []byte(s.secret(b.String())), nil
+}
+
+// version returns the SOAP version of the config
+func (c *SOAPConfig) version() string {
+	if c.Version == "" {
+		return SOAP11
+	}
+	return c.Version
+}
+
+// contentType returns the Content-Type of the requests of the config, the action of SOAP 1.2 is
+// a parameter of it
+func (c *SOAPConfig) contentType() string {
+	if c.version() == SOAP12 {
+		ct := "application/soap+xml; charset=utf-8"
+		if c.Action != "" {
+			ct += `; action="` + c.Action + `"`
+		}
+		return ct
+	}
+	return "text/xml; charset=utf-8"
+}
+
+// validate checks the version, templates and assertions of the config
+func (c *SOAPConfig) validate() error {
+	if _, ok := soapNamespaces[c.version()]; !ok {
+		return fmt.Errorf("%w: unknown soap version %q", ErrInvalidCheck, c.Version)
+	}
+	if strings.TrimSpace(c.Body) == "" && strings.TrimSpace(c.Envelope) == "" {
+		return fmt.Errorf("%w: soap without a body or envelope", ErrInvalidCheck)
+	}
+	for _, text := range []string{c.Body, c.Envelope} {
+		if _, err := template.New("soap").Parse(text); err != nil {
+			return fmt.Errorf("%w: soap template, %v", ErrInvalidCheck, err)
+		}
+	}
+	for _, a := range c.Assertions {
+		if _, err := parseXPath(a.Path); err != nil {
+			return fmt.Errorf("%w: soap path %v", ErrInvalidExpected, err)
+		}
+		if _, err := regexp.Compile(a.Expected); err != nil {
+			return fmt.Errorf("%w: soap expected %q, %v", ErrInvalidExpected, a.Expected, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package scout
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXPath(t *testing.T) {
+	assert := assert.New(t)
+
+	doc, err := parseXML([]byte(`<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" xmlns:m="urn:orders">
+  <s:Body>
+    <m:Orders>
+      <m:Order id="1" status="open"><m:Total>9.50</m:Total><m:Item>a</m:Item><m:Item>b</m:Item></m:Order>
+      <m:Order id="2" status="closed"><m:Total>20</m:Total><m:Item>c</m:Item></m:Order>
+      <m:Note>mixed <b>content</b></m:Note>
+    </m:Orders>
+  </s:Body>
+</s:Envelope>`))
+	assert.Nil(err)
+	for expr, expected := range map[string][]string{
+		"/Envelope/Body/Orders/Order/Total":   {"9.50", "20"},
+		"//m:Order[@status='closed']/Total":   {"20"},
+		"//Order[2]/@id":                      {"2"},
+		"//Order[last()]/@status":             {"closed"},
+		"//Item[1]":                           {"a", "c"},
+		"//Order[Total='20']/Item":            {"c"},
+		"//Order[@id]/Item[text()='b']":       {"b"},
+		"count(//Item)":                       {"3"},
+		"count(//Order[@status='open'])":      {"1"},
+		"//Note":                              {"mixed content"},
+		"//Note/text()":                       {"mixed"},
+		"/Envelope/*/Orders/Order[1]/@*":      {"1", "open"},
+		"//Order[@status=\"open\"][1]/Total":  {"9.50"},
+		"//Missing":                           {},
+		"Envelope/Body/Orders/Order/Item[.]":  {"a", "b", "c"},
+		"//Order[@status='a]b']/Total":        {},
+		"//Orders/Order[Item='c'][@id='2']/.": {"20c"},
+	} {
+		x, err := parseXPath(expr)
+		if !assert.Nil(err, expr) {
+			continue
+		}
+		assert.Equal(expected, x.eval(doc), expr)
+	}
+	for _, expr := range []string{"", "//", "/a[", "/a[0]", "/a[@b=c]", "/a/../b", "count()"} {
+		_, err := parseXPath(expr)
+		assert.NotNil(err, expr)
+	}
+	_, err = parseXML([]byte("not xml"))
+	assert.NotNil(err)
+}
+
+func TestCheckSOAP(t *testing.T) {
+	assert := assert.New(t)
+
+	var action, contentType, envelope string
+	fault := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		action, contentType, envelope = r.Header.Get("SOAPAction"), r.Header.Get("Content-Type"), string(b)
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		if fault {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>` +
+				`<faultcode>soap:Server</faultcode><faultstring>Quote service unavailable</faultstring></soap:Fault></soap:Body></soap:Envelope>`))
+			return
+		}
+		w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+			`<m:GetQuoteResponse xmlns:m="urn:quotes"><m:Symbol>ACME</m:Symbol><m:Price>41.5</m:Price></m:GetQuoteResponse></soap:Body></soap:Envelope>`))
+	}))
+	defer ts.Close()
+
+	min := 40.0
+	serv := &Service{
+		ID:             uuid.New(),
+		Name:           "Quotes",
+		Address:        ts.URL,
+		Type:           "soap",
+		ExpectedStatus: http.StatusOK,
+		SkipDNSTiming:  true,
+		Interval:       Duration(time.Minute),
+		Timeout:        Duration(5 * time.Second),
+		Logger:         NewSlogLogger(nil),
+		SOAP: &SOAPConfig{
+			Action:    "urn:quotes#GetQuote",
+			Body:      `<m:GetQuote xmlns:m="urn:quotes"><m:Symbol>{{.symbol}}</m:Symbol></m:GetQuote>`,
+			Variables: map[string]string{"symbol": "ACME & Co"},
+			Assertions: []XPathAssertion{
+				{Path: "//GetQuoteResponse/Symbol", Expected: "^ACME$"},
+				{Path: "//GetQuoteResponse/Price", Min: &min},
+			},
+		},
+	}
+	assert.Nil(serv.Validate())
+	suc, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal(`"urn:quotes#GetQuote"`, action)
+	assert.Equal("text/xml; charset=utf-8", contentType)
+	assert.True(strings.Contains(envelope, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`))
+	assert.True(strings.Contains(envelope, "<m:Symbol>ACME &amp; Co</m:Symbol>"))
+	assert.Equal("41.5", suc.Details["//GetQuoteResponse/Price"])
+
+	min = 50
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureBodyMismatch, fail.Class)
+	assert.Equal("SOAP Response at //GetQuoteResponse/Price value 41.5 is below 50", fail.Issue)
+
+	// the fault is reported instead of the 500 it is answered with
+	fault = true
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureUnhealthy, fail.Class)
+	assert.Equal("SOAP Fault soap:Server: Quote service unavailable", fail.Issue)
+
+	fault = false
+	serv.SOAP.Version = SOAP12
+	serv.SOAP.Assertions = nil
+	_, ok = checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("", action)
+	assert.Equal(`application/soap+xml; charset=utf-8; action="urn:quotes#GetQuote"`, contentType)
+	assert.True(strings.Contains(envelope, "http://www.w3.org/2003/05/soap-envelope"))
+
+	serv.SOAP.Assertions = []XPathAssertion{{Path: "//Price[x"}}
+	assert.True(errors.Is(serv.Validate(), ErrInvalidExpected))
+	serv.SOAP.Version = "1.3"
+	assert.True(errors.Is(serv.Validate(), ErrInvalidCheck))
+}
@@ -0,0 +1,104 @@
+package scout
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// defaultProbeQuery is run by database checks that do not specify a Query
+const defaultProbeQuery = "SELECT 1"
+
+// CheckSQL will connect to a database with database/sql, run the probe query and match the
+// first column of the first row against Expected. The database driver (e.g. github.com/lib/pq
+// or github.com/go-sql-driver/mysql) has to be imported by the application, Driver defaults to
+// the service Type ("postgres", "mysql")
+func (s *Service) CheckSQL() {
+	driver := s.Driver
+	if driver == "" {
+		driver = s.Type
+	}
+	dsn := s.secret(s.DSN)
+	if dsn == "" {
+		dsn = s.Address
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		s.fail(FailureConfig, err, fmt.Sprintf("Database Open Error %v", err))
+		return
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithTimeout(s.context(), s.Timeout.Duration())
+	defer cancel()
+
+	t1 := time.Now()
+	if err := db.PingContext(ctx); err != nil {
+		s.fail(classifyError(err, false), err, fmt.Sprintf("Database Connect Error %v", err))
+		return
+	}
+	t2 := time.Now()
+	s.setNetworkLatency(t2.Sub(t1).Milliseconds())
+
+	query := s.Query
+	if query == "" {
+		query = defaultProbeQuery
+	}
+	result, err := queryFirstRow(ctx, db, query)
+	if err != nil {
+		s.fail(classifyError(err, true), err, fmt.Sprintf("Database Query Error %v", err))
+		return
+	}
+	s.setRequestLatency(time.Since(t2).Milliseconds())
+	s.setResponse(strings.Join(result, ","))
+
+	if len(result) == 0 {
+		s.fail(FailureBodyMismatch, nil, fmt.Sprintf("Database query '%v' returned no rows", query))
+		return
+	}
+	if s.Expected != "" {
+		match, err := regexp.MatchString(s.Expected, result[0])
+		if err != nil {
+			s.Logger.Warnf("Service %v expected: %v to match %v", s.Name, result[0], s.Expected)
+		}
+		if !match {
+			s.fail(FailureBodyMismatch, nil, fmt.Sprintf("Database query result '%v' did not match '%v'", result[0], s.Expected))
+			return
+		}
+	}
+	s.Success()
+}
+
+// queryFirstRow runs query and returns the columns of the first row as strings, nil when the
+// query returned no rows
+func queryFirstRow(ctx context.Context, db *sql.DB, query string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	values := make([]sql.NullString, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+	result := make([]string, len(values))
+	for i, v := range values {
+		result[i] = v.String
+	}
+	return result, nil
+}
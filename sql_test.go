@@ -0,0 +1,93 @@
+package scout
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDriver answers every query with a single row holding the DSN, the DSN "down" fails to connect
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	if dsn == "down" {
+		return nil, errors.New("connection refused")
+	}
+	return fakeConn(dsn), nil
+}
+
+type fakeConn string
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt(c), nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+type fakeStmt string
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &fakeRows{value: string(s)}, nil
+}
+
+type fakeRows struct {
+	value string
+	done  bool
+}
+
+func (r *fakeRows) Columns() []string { return []string{"value"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	dest[0] = []byte(r.value)
+	r.done = true
+	return nil
+}
+
+func init() {
+	sql.Register("fake", fakeDriver{})
+}
+
+func TestCheckSQL(t *testing.T) {
+	assert := assert.New(t)
+
+	serv := &Service{
+		ID:       uuid.New(),
+		Name:     "Database",
+		Type:     "sql",
+		Driver:   "fake",
+		DSN:      "1",
+		Expected: "^1$",
+		Timeout:  Duration(2 * time.Second),
+		Logger:   NewSlogLogger(nil),
+	}
+	_, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("1", serv.LastResponse)
+
+	serv.Expected = "^2$"
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Contains(fail.Issue, "did not match")
+
+	serv.DSN = "down"
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Contains(fail.Issue, "Database Connect Error")
+
+	serv.Driver = "unregistered"
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Contains(fail.Issue, "Database Open Error")
+}
@@ -0,0 +1,66 @@
+package scout
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// SRVDiscovery is a Discoverer with a service for every target of DNS SRV records, e.g.
+// _api._tcp.example.com, so backends registered in DNS are checked as they come and go. The
+// services check the target and port with a tcp check, or with a http check of
+// Scheme://target:port/Path when Type is http, the other fields come from the Template and the
+// defaults of the scout
+type SRVDiscovery struct {
+	Records      []string          `json:"records"`
+	Type         string            `json:"type"`
+	Scheme       string            `json:"scheme"`
+	Path         string            `json:"path"`
+	Template     string            `json:"template"`
+	Interval     Duration          `json:"checkInterval"`
+	Tags         map[string]string `json:"tags"`
+	DNSOverHTTPS string            `json:"dnsOverHTTPS"`
+	DNSOverTLS   string            `json:"dnsOverTLS"`
+}
+
+// Discover resolves the SRV records, it fails when one of them can not be resolved so the
+// services of a record are not removed because of a DNS outage
+func (d *SRVDiscovery) Discover(ctx context.Context) ([]*Service, error) {
+	resolver := (&Service{DNSOverHTTPS: d.DNSOverHTTPS, DNSOverTLS: d.DNSOverTLS}).resolver()
+	var servs []*Service
+	for _, record := range d.Records {
+		_, srvs, err := resolver.LookupSRV(ctx, "", "", record)
+		if err != nil {
+			return nil, fmt.Errorf("srv %s: %w", record, err)
+		}
+		for _, srv := range srvs {
+			host := strings.TrimSuffix(srv.Target, ".")
+			target := net.JoinHostPort(host, strconv.Itoa(int(srv.Port)))
+			serv := &Service{
+				ExternalID: "srv:" + record + "/" + target,
+				Name:       record + " " + target,
+				Type:       "tcp",
+				Address:    host,
+				Port:       int(srv.Port),
+				Template:   d.Template,
+				Interval:   d.Interval,
+				Tags:       map[string]string{"srv": record},
+			}
+			for k, v := range d.Tags {
+				serv.Tags[k] = v
+			}
+			if d.Type == "http" {
+				scheme := d.Scheme
+				if scheme == "" {
+					scheme = "http"
+				}
+				serv.Type, serv.Port = "http", 0
+				serv.Address = scheme + "://" + target + "/" + strings.TrimPrefix(d.Path, "/")
+			}
+			servs = append(servs, serv)
+		}
+	}
+	return servs, nil
+}
@@ -0,0 +1,192 @@
+package scout
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// StartTLSSMTP upgrades a SMTP session with EHLO and STARTTLS
+	StartTLSSMTP = "smtp"
+	// StartTLSIMAP upgrades a IMAP session with STARTTLS
+	StartTLSIMAP = "imap"
+	// StartTLSPOP3 upgrades a POP3 session with STLS
+	StartTLSPOP3 = "pop3"
+	// StartTLSLDAP upgrades a LDAP session with the StartTLS extended operation
+	StartTLSLDAP = "ldap"
+)
+
+// ldapStartTLSOID is the LDAP StartTLS extended operation (RFC 4511)
+const ldapStartTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// startTLS negotiates StartTLS on conn for the service protocol and returns the TLS conn, the
+// handshake latency and certificate expiry are kept on the service and the connection has to
+// meet its TLS policy
+func (s *Service) startTLS(conn net.Conn) (net.Conn, error) {
+	if s.StartTLS == "" {
+		return conn, nil
+	}
+	if err := conn.SetDeadline(s.deadline()); err != nil {
+		return nil, err
+	}
+	var err error
+	switch s.StartTLS {
+	case StartTLSSMTP:
+		err = startTLSSMTP(conn)
+	case StartTLSIMAP:
+		err = startTLSText(conn, "* OK", "a001 STARTTLS\r\n", "a001 OK")
+	case StartTLSPOP3:
+		err = startTLSText(conn, "+OK", "STLS\r\n", "+OK")
+	case StartTLSLDAP:
+		err = startTLSLDAP(conn)
+	default:
+		err = fmt.Errorf("unsupported StartTLS protocol %q", s.StartTLS)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	host := s.Address
+	if h, _, err := net.SplitHostPort(s.Address); err == nil {
+		host = h
+	}
+	t1 := time.Now()
+	host = s.serverName(host)
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: !s.VerifySSL,
+		MinVersion:         s.clientMinTLS(),
+	})
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, fmt.Errorf("TLS handshake error %v", err)
+	}
+	s.TLSHandshake = time.Since(t1).Milliseconds()
+	state := tlsConn.ConnectionState()
+	if len(state.PeerCertificates) > 0 {
+		s.CertExpiry = state.PeerCertificates[0].NotAfter
+	}
+	if err := s.verifyTLS(&state, host); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// startTLSSMTP reads the greeting, introduces itself with EHLO and issues STARTTLS
+func startTLSSMTP(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	if err := smtpReply(r, "220"); err != nil {
+		return err
+	}
+	if _, err := conn.Write([]byte("EHLO phenixrizen-scout\r\n")); err != nil {
+		return err
+	}
+	if err := smtpReply(r, "250"); err != nil {
+		return err
+	}
+	if _, err := conn.Write([]byte("STARTTLS\r\n")); err != nil {
+		return err
+	}
+	return smtpReply(r, "220")
+}
+
+// smtpReply reads a possibly multi-line SMTP reply and checks its code
+func smtpReply(r *bufio.Reader, code string) error {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("SMTP read error %v", err)
+		}
+		if !strings.HasPrefix(line, code) {
+			return fmt.Errorf("SMTP reply %q, expected %s", strings.TrimSpace(line), code)
+		}
+		if len(line) < 4 || line[3] != '-' {
+			return nil
+		}
+	}
+}
+
+// startTLSText handles the single command line protocols (IMAP, POP3)
+func startTLSText(conn net.Conn, greeting, command, ok string) error {
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("read greeting error %v", err)
+	}
+	if !strings.HasPrefix(line, greeting) {
+		return fmt.Errorf("greeting %q, expected %s", strings.TrimSpace(line), greeting)
+	}
+	if _, err := conn.Write([]byte(command)); err != nil {
+		return err
+	}
+	for {
+		line, err = r.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("read StartTLS reply error %v", err)
+		}
+		// IMAP servers may send untagged responses before the tagged reply
+		if strings.HasPrefix(line, "* ") && greeting == "* OK" {
+			continue
+		}
+		if !strings.HasPrefix(line, ok) {
+			return fmt.Errorf("StartTLS reply %q, expected %s", strings.TrimSpace(line), ok)
+		}
+		return nil
+	}
+}
+
+// startTLSLDAP sends the StartTLS extended request and checks the result code of the response
+func startTLSLDAP(conn net.Conn) error {
+	req := berSeq(0x30,
+		berInt(0x02, 1),
+		berSeq(0x77, berTLV(0x80, []byte(ldapStartTLSOID))),
+	)
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	resp, err := berRead(conn)
+	if err != nil {
+		return fmt.Errorf("LDAP read error %v", err)
+	}
+	code, diag, err := ldapResult(resp, 0x78)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("LDAP StartTLS result code %d %s", code, diag)
+	}
+	return nil
+}
+
+// ldapResult returns the result code and diagnostic message of a LDAPMessage whose protocol
+// op has tag op
+func ldapResult(msg []byte, op byte) (int64, string, error) {
+	_, body, _, err := berParse(msg)
+	if err != nil {
+		return 0, "", err
+	}
+	// skip the message id
+	if _, _, body, err = berParse(body); err != nil {
+		return 0, "", err
+	}
+	tag, result, _, err := berParse(body)
+	if err != nil {
+		return 0, "", err
+	}
+	if tag != op {
+		return 0, "", fmt.Errorf("LDAP unexpected response tag 0x%x", tag)
+	}
+	_, code, result, err := berParse(result)
+	if err != nil {
+		return 0, "", err
+	}
+	// skip the matched DN
+	if _, _, result, err = berParse(result); err != nil {
+		return berParseInt(code), "", nil
+	}
+	_, diag, _, _ := berParse(result)
+	return berParseInt(code), string(diag), nil
+}
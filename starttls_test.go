@@ -0,0 +1,62 @@
+package scout
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartTLSSMTP(t *testing.T) {
+	assert := assert.New(t)
+
+	// borrow the self signed certificate of a httptest TLS server
+	ts := httptest.NewTLSServer(nil)
+	defer ts.Close()
+	cert := ts.TLS.Certificates
+
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		r := bufio.NewReader(server)
+		server.Write([]byte("220 mail.example ESMTP\r\n"))
+		r.ReadString('\n')
+		server.Write([]byte("250-mail.example\r\n250 STARTTLS\r\n"))
+		r.ReadString('\n')
+		server.Write([]byte("220 Ready to start TLS\r\n"))
+		tlsServer := tls.Server(server, &tls.Config{Certificates: cert})
+		tlsServer.Handshake()
+		tlsServer.Close()
+	}()
+
+	serv := &Service{
+		Address:  "example.com",
+		Type:     "tcp",
+		StartTLS: StartTLSSMTP,
+		Timeout:  Duration(5 * time.Second),
+	}
+	conn, err := serv.startTLS(client)
+	assert.Nil(err)
+	assert.NotNil(conn)
+	assert.True(serv.CertExpiry.After(time.Now()))
+
+	// with certificate verification the self signed certificate is rejected
+	client, server = net.Pipe()
+	go func() {
+		defer server.Close()
+		r := bufio.NewReader(server)
+		server.Write([]byte("220 mail.example ESMTP\r\n"))
+		r.ReadString('\n')
+		server.Write([]byte("250 mail.example\r\n"))
+		r.ReadString('\n')
+		server.Write([]byte("220 Ready to start TLS\r\n"))
+		tls.Server(server, &tls.Config{Certificates: cert}).Handshake()
+	}()
+	serv.VerifySSL = true
+	_, err = serv.startTLS(client)
+	assert.NotNil(err)
+}
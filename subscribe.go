@@ -0,0 +1,114 @@
+package scout
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// CheckResult is a result delivered to a subscriber, Status is the state of the service after the
+// check and nil for results about groups
+type CheckResult struct {
+	Result
+	Status *ServiceStatus `json:"status,omitempty"`
+}
+
+// subscription is a named consumer of the results of the scout
+type subscription struct {
+	ch   chan CheckResult
+	done chan struct{}
+	mux  sync.RWMutex
+}
+
+// Subscribe returns a channel receiving every result of the scout, each subscriber gets its own
+// copy of the stream so consumers do not take results from one another. A full subscriber
+// channel is handled by the overflow policy of the scout, subscribing again with the same name
+// closes the previous channel. While the scout has subscribers the Response Channel is only fed
+// once it is read through GetResponseChannel or HandleResponses
+func (s *Scout) Subscribe(name string, buffer int) <-chan CheckResult {
+	if buffer < 0 {
+		buffer = 0
+	}
+	sub := &subscription{ch: make(chan CheckResult, buffer), done: make(chan struct{})}
+	s.mux.Lock()
+	if s.subscribers == nil {
+		s.subscribers = make(map[string]*subscription)
+	}
+	old := s.subscribers[name]
+	s.subscribers[name] = sub
+	s.mux.Unlock()
+	if old != nil {
+		old.close()
+	}
+	return sub.ch
+}
+
+// Unsubscribe stops sending results to the subscriber and closes its channel
+func (s *Scout) Unsubscribe(name string) {
+	s.mux.Lock()
+	sub := s.subscribers[name]
+	delete(s.subscribers, name)
+	s.mux.Unlock()
+	if sub != nil {
+		sub.close()
+	}
+}
+
+// close closes the channel of the subscription once no result is being sent on it
+func (sub *subscription) close() {
+	close(sub.done)
+	sub.mux.Lock()
+	close(sub.ch)
+	sub.mux.Unlock()
+}
+
+// subscriptions appends the current subscribers of the scout to subs
+func (s *Scout) subscriptions(subs []*subscription) []*subscription {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	for _, sub := range s.subscribers {
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// send sends r to the subscriber following the overflow policy, it gives up once the subscriber
+// unsubscribed
+func (s *Scout) send(sub *subscription, r CheckResult) {
+	sub.mux.RLock()
+	defer sub.mux.RUnlock()
+	select {
+	case <-sub.done:
+		return
+	default:
+	}
+	policy := s.overflowPolicy
+	if policy == OverflowDropOldest && cap(sub.ch) == 0 {
+		policy = OverflowDropNewest
+	}
+	switch policy {
+	case OverflowDropNewest:
+		select {
+		case sub.ch <- r:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case sub.ch <- r:
+				return
+			default:
+			}
+			select {
+			case <-sub.ch:
+				atomic.AddUint64(&s.dropped, 1)
+			default:
+			}
+		}
+	default:
+		select {
+		case sub.ch <- r:
+		case <-sub.done:
+		}
+	}
+}
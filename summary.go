@@ -0,0 +1,90 @@
+package scout
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Summary is the status of all services of a scout at one point in time
+type Summary struct {
+	Total           int             `json:"total"`
+	Online          int             `json:"online"`
+	Degraded        int             `json:"degraded"`
+	Offline         int             `json:"offline"`
+	Paused          int             `json:"paused"`
+	Pending         int             `json:"pending"`
+	Checks          uint64          `json:"checks"`
+	ChecksPerSecond float64         `json:"checksPerSecond"`
+	RecentFailures  []FailedService `json:"recentFailures"`
+	CreatedAt       time.Time       `json:"createdAt"`
+}
+
+// FailedService is a service with its last failure
+type FailedService struct {
+	ID       uuid.UUID `json:"id"`
+	Name     string    `json:"name"`
+	Issue    string    `json:"issue"`
+	Online   bool      `json:"online"`
+	FailedAt time.Time `json:"failedAt"`
+}
+
+// Summary returns the number of services by status (paused, pending a first check, online, of
+// which degraded, or offline), the checks run since the scout started and their rate, and the
+// last failures of the n services that failed most recently
+func (s *Scout) Summary(n int) Summary {
+	now := time.Now().UTC()
+	sum := Summary{
+		Checks:    atomic.LoadUint64(&s.checks),
+		CreatedAt: now,
+	}
+	var failed []FailedService
+	s.mux.RLock()
+	sum.Total = len(s.Services)
+	for _, serv := range s.Services {
+		st := serv.Snapshot()
+		switch {
+		case st.Paused:
+			sum.Paused++
+		case st.LastOnline.IsZero() && st.LastFailure.IsZero():
+			sum.Pending++
+		case st.Online:
+			sum.Online++
+			if st.DegradedText != "" {
+				sum.Degraded++
+			}
+		default:
+			sum.Offline++
+		}
+		if !st.LastFailure.IsZero() {
+			failed = append(failed, FailedService{
+				ID:       st.ID,
+				Name:     st.Name,
+				Issue:    st.DownText,
+				Online:   st.Online,
+				FailedAt: st.LastFailure,
+			})
+		}
+	}
+	started := s.started
+	s.mux.RUnlock()
+
+	if !started.IsZero() {
+		if elapsed := now.Sub(started).Seconds(); elapsed > 0 {
+			sum.ChecksPerSecond = float64(sum.Checks) / elapsed
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool { return failed[i].FailedAt.After(failed[j].FailedAt) })
+	if len(failed) > n {
+		failed = failed[:n]
+	}
+	sum.RecentFailures = failed
+	return sum
+}
+
+// countCheck counts a completed check of a service of the scout
+func (s *Scout) countCheck() {
+	atomic.AddUint64(&s.checks, 1)
+}
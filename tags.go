@@ -0,0 +1,63 @@
+package scout
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// hasTags reports whether the service has all the tags, a empty value matches any value of the
+// tag
+func (s *Service) hasTags(tags map[string]string) bool {
+	for k, v := range tags {
+		tag, ok := s.Tags[k]
+		if !ok || (v != "" && tag != v) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetServicesByTag returns the services with the tag set to value, or set to any value when
+// value is empty
+func (s *Scout) GetServicesByTag(key, value string) []*Service {
+	return s.GetServicesByTags(map[string]string{key: value})
+}
+
+// GetServicesByTags returns the services that have all the tags, sorted by name, a empty value
+// matches any value of the tag
+func (s *Scout) GetServicesByTags(tags map[string]string) []*Service {
+	s.mux.RLock()
+	var servs []*Service
+	for _, serv := range s.Services {
+		if serv.hasTags(tags) {
+			servs = append(servs, serv)
+		}
+	}
+	s.mux.RUnlock()
+	sort.Slice(servs, func(i, j int) bool { return servs[i].Name < servs[j].Name })
+	return servs
+}
+
+// ParseTagFilter parses a comma separated list of tag filters like "team=payments,env=prod" or
+// "region" for any value of the tag
+func ParseTagFilter(filter string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, f := range strings.Split(filter, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		kv := strings.SplitN(f, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if key == "" {
+			return nil, fmt.Errorf("scout: tag filter %q has no key", f)
+		}
+		if len(kv) == 2 {
+			tags[key] = strings.TrimSpace(kv[1])
+		} else {
+			tags[key] = ""
+		}
+	}
+	return tags, nil
+}
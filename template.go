@@ -0,0 +1,124 @@
+package scout
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Templates are the defaults of every service and named service definitions, e.g. a
+// "https-prod" template with the timeout, headers, expected status and retry policy shared by
+// many checks. A service referencing a template by its Template takes the fields it leaves
+// unset from the template, then from the templates it extends, then from the defaults. Tags
+// and headers are merged with the ones of the service winning, a bool that is true in a
+// template can not be turned off by the service.
+type Templates struct {
+	Defaults  *Service            `json:"defaults,omitempty"`
+	Templates map[string]*Service `json:"templates,omitempty"`
+}
+
+// templateExempt are the fields identifying a service, they are never inherited
+var templateExempt = map[string]bool{"ID": true, "ExternalID": true, "Name": true, "Template": true}
+
+// WithTemplates sets the defaults and templates the services added to the scout inherit from
+func WithTemplates(t Templates) Option {
+	return func(s *Scout) error {
+		for name, tmpl := range t.Templates {
+			if _, err := t.chain(tmpl); err != nil {
+				return fmt.Errorf("template %s: %w", name, err)
+			}
+		}
+		s.templates = &t
+		return nil
+	}
+}
+
+// Apply fills the fields serv leaves unset from its template and the defaults, it fails with
+// ErrUnknownTemplate when the template does not exist and ErrTemplateCycle when templates
+// extend one another in a loop
+func (t *Templates) Apply(serv *Service) error {
+	if t == nil || serv == nil {
+		return nil
+	}
+	chain, err := t.chain(serv)
+	if err != nil {
+		return fmt.Errorf("service %s: %w", serv.Name, err)
+	}
+	for _, tmpl := range chain {
+		inherit(serv, tmpl)
+	}
+	if t.Defaults != nil {
+		inherit(serv, t.Defaults)
+	}
+	return nil
+}
+
+// chain returns the templates serv extends, the closest first
+func (t *Templates) chain(serv *Service) ([]*Service, error) {
+	var chain []*Service
+	seen := make(map[string]bool)
+	for name := serv.Template; name != ""; {
+		if seen[name] {
+			return nil, fmt.Errorf("%w: %s", ErrTemplateCycle, name)
+		}
+		seen[name] = true
+		tmpl, ok := t.Templates[name]
+		if !ok || tmpl == nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+		}
+		chain = append(chain, tmpl)
+		name = tmpl.Template
+	}
+	return chain, nil
+}
+
+// inherit sets the exported fields of dst that are zero to a copy of the field of src, maps are
+// merged with the entries of dst winning
+func inherit(dst, src *Service) {
+	d, s := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem()
+	for i := 0; i < d.NumField(); i++ {
+		f := d.Type().Field(i)
+		if f.PkgPath != "" || templateExempt[f.Name] || f.Tag.Get("json") == "-" {
+			continue
+		}
+		df, sf := d.Field(i), s.Field(i)
+		if sf.IsZero() {
+			continue
+		}
+		switch {
+		case df.Kind() == reflect.Map && !df.IsZero():
+			merged := reflect.MakeMapWithSize(df.Type(), df.Len()+sf.Len())
+			for _, m := range []reflect.Value{sf, df} {
+				iter := m.MapRange()
+				for iter.Next() {
+					merged.SetMapIndex(iter.Key(), iter.Value())
+				}
+			}
+			df.Set(merged)
+		case !df.IsZero():
+		default:
+			df.Set(clone(sf))
+		}
+	}
+}
+
+// clone returns a copy of v that does not share its maps, slices or pointed to struct
+func clone(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Map:
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), clone(iter.Value()))
+		}
+		return c
+	case reflect.Slice:
+		return reflect.AppendSlice(reflect.MakeSlice(v.Type(), 0, v.Len()), v)
+	case reflect.Ptr:
+		if v.Elem().Kind() == reflect.Struct {
+			c := reflect.New(v.Elem().Type())
+			c.Elem().Set(v.Elem())
+			return c
+		}
+	}
+	return v
+}
@@ -0,0 +1,172 @@
+package scout
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Retention is how long the check timeline of the services is kept, checks are kept as is for
+// Raw, then downsampled into rollups of Rollup width that are kept for Rollups, e.g. raw
+// checks for 7 days and hourly rollups for 90 days
+type Retention struct {
+	Raw     Duration `json:"raw"`
+	Rollup  Duration `json:"rollup"`
+	Rollups Duration `json:"rollups"`
+}
+
+// TimelinePoint is a single check of a service
+type TimelinePoint struct {
+	Time    time.Time `json:"time"`
+	Up      bool      `json:"up"`
+	Latency int64     `json:"latency"`
+}
+
+// TimelineRollup is the checks of a service within Width from Start downsampled into counts
+// and latencies
+type TimelineRollup struct {
+	Start      time.Time `json:"start"`
+	Width      Duration  `json:"width"`
+	Checks     uint64    `json:"checks"`
+	Failures   uint64    `json:"failures"`
+	Latency    int64     `json:"latency"`
+	MaxLatency int64     `json:"maxLatency"`
+}
+
+// Timeline is the check history of a service, the rollups of the older checks followed by the
+// recent checks, both oldest first
+type Timeline struct {
+	Service uuid.UUID        `json:"service"`
+	Rollups []TimelineRollup `json:"rollups"`
+	Points  []TimelinePoint  `json:"points"`
+}
+
+// WithTimeline keeps the check timeline of every service following the retention, a pruning
+// job downsamples and drops the expired checks while the services are scouted
+func WithTimeline(retention Retention) Option {
+	return func(s *Scout) error {
+		if retention.Raw <= 0 || retention.Rollup <= 0 || retention.Rollups < retention.Raw {
+			return fmt.Errorf("scout: invalid timeline retention raw %v, rollup %v, rollups %v", retention.Raw.Duration(), retention.Rollup.Duration(), retention.Rollups.Duration())
+		}
+		s.timeline = &timeline{retention: retention, services: make(map[uuid.UUID]*serviceTimeline)}
+		return nil
+	}
+}
+
+// Timeline returns the check timeline of the service with the ID
+func (s *Scout) Timeline(id uuid.UUID) (Timeline, error) {
+	if s.timeline == nil {
+		return Timeline{}, ErrNoTimeline
+	}
+	if s.GetService(id) == nil {
+		return Timeline{}, fmt.Errorf("%w: %s", ErrUnknownService, id)
+	}
+	return s.timeline.get(id), nil
+}
+
+// PruneTimeline downsamples the checks older than the raw retention into rollups and drops the
+// rollups older than the rollup retention, it runs on its own while the services are scouted
+func (s *Scout) PruneTimeline(now time.Time) {
+	if s.timeline != nil {
+		s.timeline.prune(now)
+	}
+}
+
+// pruneTimeline prunes the timeline every rollup width until stop is closed
+func (s *Scout) pruneTimeline(stop chan struct{}) {
+	ticker := time.NewTicker(s.timeline.retention.Rollup.Duration())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			s.PruneTimeline(now)
+		}
+	}
+}
+
+// recordTimeline adds the last check of the service to the timeline of its scout
+func (s *Service) recordTimeline(up bool) {
+	if s.scout == nil || s.scout.timeline == nil {
+		return
+	}
+	s.scout.timeline.add(s.ID, TimelinePoint{Time: time.Now().UTC(), Up: up, Latency: s.RequestLatency})
+}
+
+type timeline struct {
+	mux       sync.Mutex
+	retention Retention
+	services  map[uuid.UUID]*serviceTimeline
+}
+
+type serviceTimeline struct {
+	rollups []TimelineRollup
+	points  []TimelinePoint
+}
+
+func (t *timeline) add(id uuid.UUID, p TimelinePoint) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	st, ok := t.services[id]
+	if !ok {
+		st = &serviceTimeline{}
+		t.services[id] = st
+	}
+	st.points = append(st.points, p)
+}
+
+func (t *timeline) get(id uuid.UUID) Timeline {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	tl := Timeline{Service: id}
+	if st, ok := t.services[id]; ok {
+		tl.Rollups = append([]TimelineRollup(nil), st.rollups...)
+		tl.Points = append([]TimelinePoint(nil), st.points...)
+	}
+	return tl
+}
+
+func (t *timeline) prune(now time.Time) {
+	rawCutoff := now.Add(-t.retention.Raw.Duration())
+	rollupCutoff := now.Add(-t.retention.Rollups.Duration())
+	width := t.retention.Rollup.Duration()
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	for id, st := range t.services {
+		n := 0
+		for n < len(st.points) && st.points[n].Time.Before(rawCutoff) {
+			st.rollup(st.points[n], width)
+			n++
+		}
+		st.points = append(st.points[:0], st.points[n:]...)
+		n = 0
+		for n < len(st.rollups) && !st.rollups[n].Start.Add(width).After(rollupCutoff) {
+			n++
+		}
+		st.rollups = append(st.rollups[:0], st.rollups[n:]...)
+		if len(st.points) == 0 && len(st.rollups) == 0 {
+			delete(t.services, id)
+		}
+	}
+}
+
+// rollup downsamples p into the rollup of its time, points arrive oldest first
+func (st *serviceTimeline) rollup(p TimelinePoint, width time.Duration) {
+	start := p.Time.Truncate(width)
+	if len(st.rollups) == 0 || !st.rollups[len(st.rollups)-1].Start.Equal(start) {
+		st.rollups = append(st.rollups, TimelineRollup{Start: start, Width: Duration(width)})
+	}
+	r := &st.rollups[len(st.rollups)-1]
+	// Latency is the mean latency of the checks of the rollup
+	r.Latency = (r.Latency*int64(r.Checks) + p.Latency) / int64(r.Checks+1)
+	r.Checks++
+	if !p.Up {
+		r.Failures++
+	}
+	if p.Latency > r.MaxLatency {
+		r.MaxLatency = p.Latency
+	}
+}
@@ -0,0 +1,54 @@
+package scout
+
+import "time"
+
+// Timings is the breakdown of a HTTP request, phases that did not happen (no DNS lookup for a
+// ip address, no TLS handshake for plain HTTP, ...) are zero
+type Timings struct {
+	DNS          Duration `json:"dns,omitempty"`
+	Connect      Duration `json:"connect,omitempty"`
+	TLSHandshake Duration `json:"tlsHandshake,omitempty"`
+	TTFB         Duration `json:"ttfb,omitempty"`
+	BodyRead     Duration `json:"bodyRead,omitempty"`
+	Total        Duration `json:"total,omitempty"`
+	RemoteAddr   string   `json:"remoteAddr,omitempty"`
+	Protocol     string   `json:"protocol,omitempty"`
+	TLSVersion   string   `json:"tlsVersion,omitempty"`
+	CipherSuite  string   `json:"cipherSuite,omitempty"`
+	// ContentEncoding is the compression of the body, CompressedBytes its size as sent and
+	// BodyBytes its size decompressed
+	ContentEncoding string `json:"contentEncoding,omitempty"`
+	CompressedBytes int64  `json:"compressedBytes,omitempty"`
+	BodyBytes       int64  `json:"bodyBytes,omitempty"`
+}
+
+// Timings returns the breakdown of the request, TTFB runs from the request being written to the
+// first response byte and Total from getting a connection to the end of the body
+func (m *HTTPRequestMetrics) Timings() *Timings {
+	if m == nil {
+		return nil
+	}
+	return &Timings{
+		DNS:             span(m.DNSStart, m.DNSDone),
+		Connect:         span(m.ConnectStart, m.ConnectDone),
+		TLSHandshake:    span(m.TLSHandshakeStart, m.TLSHandshakeDone),
+		TTFB:            span(m.WroteRequest, m.GotFirstResponseByte),
+		BodyRead:        span(m.GotResponse, m.BodyDone),
+		Total:           span(m.GetConn, m.BodyDone),
+		RemoteAddr:      m.RemoteAddr,
+		Protocol:        m.Protocol,
+		TLSVersion:      m.TLSVersion,
+		CipherSuite:     m.CipherSuite,
+		ContentEncoding: m.ContentEncoding,
+		CompressedBytes: m.CompressedBytes,
+		BodyBytes:       m.BodyBytes,
+	}
+}
+
+// span returns the duration between two unix nano timestamps, zero when either was not recorded
+func span(start, end int64) Duration {
+	if start == 0 || end == 0 || end < start {
+		return 0
+	}
+	return Duration(time.Duration(end - start))
+}
@@ -0,0 +1,265 @@
+package scout
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// tlsVersions are the TLS versions of MinTLSVersion, it also takes the names of tlsVersionName
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSVersion returns the TLS version of a name like 1.2 or TLS 1.2
+func parseTLSVersion(name string) (uint16, bool) {
+	v, ok := tlsVersions[strings.TrimSpace(strings.TrimPrefix(strings.ToUpper(name), "TLS"))]
+	return v, ok
+}
+
+// knownCipherSuite reports whether Go knows the cipher suite with the name, e.g.
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+func knownCipherSuite(name string) bool {
+	for _, suites := range [][]*tls.CipherSuite{tls.CipherSuites(), tls.InsecureCipherSuites()} {
+		for _, cs := range suites {
+			if cs.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tlsPolicyError is a TLS connection that was established but breaks the TLS policy of the
+// service, e.g. with a certificate that is not pinned
+type tlsPolicyError struct {
+	class FailureClass
+	msg   string
+}
+
+func (e *tlsPolicyError) Error() string {
+	return e.msg
+}
+
+// tlsClass returns the failure class of a TLS error, FailureTLS unless it breaks the TLS policy
+// of the service
+func tlsClass(err error) FailureClass {
+	var policy *tlsPolicyError
+	if errors.As(err, &policy) {
+		return policy.class
+	}
+	return FailureTLS
+}
+
+// verifyTLS checks the connection state of a HTTPS or StartTLS check of the host against the TLS
+// policy of the service, its pins, minimum version, allowed cipher suites, the chain and the
+// revocation of its certificate, a nil state is a connection without TLS
+func (s *Service) verifyTLS(state *tls.ConnectionState, host string) error {
+	pinned := len(s.CertFingerprints) > 0 || len(s.SPKIPins) > 0
+	if state == nil || len(state.PeerCertificates) == 0 {
+		if pinned {
+			return &tlsPolicyError{class: FailureCertMismatch, msg: "no certificate to match the pins"}
+		}
+		return nil
+	}
+	if pinned {
+		if err := s.verifyPins(state); err != nil {
+			return err
+		}
+	}
+	if min, ok := parseTLSVersion(s.MinTLSVersion); ok && state.Version < min {
+		return &tlsPolicyError{
+			class: FailureTLSPolicy,
+			msg:   fmt.Sprintf("negotiated %s is below the minimum %s", tlsVersionName(state.Version), tlsVersionName(min)),
+		}
+	}
+	if len(s.CipherSuites) > 0 && !containsString(s.CipherSuites, tls.CipherSuiteName(state.CipherSuite)) {
+		return &tlsPolicyError{
+			class: FailureTLSPolicy,
+			msg:   fmt.Sprintf("negotiated cipher suite %s is not allowed", tls.CipherSuiteName(state.CipherSuite)),
+		}
+	}
+	if s.CheckChain {
+		if err := verifyChain(state.PeerCertificates, host); err != nil {
+			return err
+		}
+	}
+	if s.CheckRevocation {
+		return s.verifyRevocation(state)
+	}
+	return nil
+}
+
+// verifyChain checks that the leaf certificate covers the host and that the chain sent by the
+// server is in order, each certificate issued by the next, and complete up to a trusted root or
+// a self-signed certificate. Go fetches no intermediates either, but clients that do not cache
+// them break on a chain that only verifies where the missing intermediate is known
+func verifyChain(certs []*x509.Certificate, host string) error {
+	leaf := certs[0]
+	if host != "" {
+		if err := leaf.VerifyHostname(host); err != nil {
+			return &tlsPolicyError{class: FailureCertHostname, msg: err.Error()}
+		}
+	}
+	for i, cert := range certs[:len(certs)-1] {
+		if bytes.Equal(cert.RawIssuer, certs[i+1].RawSubject) && cert.CheckSignatureFrom(certs[i+1]) == nil {
+			continue
+		}
+		for _, issuer := range certs {
+			if bytes.Equal(cert.RawIssuer, issuer.RawSubject) && cert.CheckSignatureFrom(issuer) == nil {
+				return &tlsPolicyError{
+					class: FailureCertChain,
+					msg:   fmt.Sprintf("certificate chain is out of order, %q is followed by %q instead of its issuer %q", cert.Subject.CommonName, certs[i+1].Subject.CommonName, issuer.Subject.CommonName),
+				}
+			}
+		}
+		return &tlsPolicyError{
+			class: FailureCertChain,
+			msg:   fmt.Sprintf("certificate chain is missing the intermediate %q that issued %q", cert.Issuer.CommonName, cert.Subject.CommonName),
+		}
+	}
+	last := certs[len(certs)-1]
+	if bytes.Equal(last.RawIssuer, last.RawSubject) && last.CheckSignatureFrom(last) == nil {
+		return nil
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{Intermediates: intermediates, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+	var unknown x509.UnknownAuthorityError
+	if errors.As(err, &unknown) {
+		return &tlsPolicyError{
+			class: FailureCertChain,
+			msg:   fmt.Sprintf("certificate chain is incomplete, the issuer %q of %q was not sent and is not a trusted root", last.Issuer.CommonName, last.Subject.CommonName),
+		}
+	}
+	return nil
+}
+
+// serverName returns the TLS server name of a handshake with the host, the SNI of the service
+// when it overrides it
+func (s *Service) serverName(host string) string {
+	if s.SNI != "" {
+		return s.SNI
+	}
+	return host
+}
+
+// clientMinTLS returns the minimum TLS version of the handshakes of the service, TLS 1.0 with a
+// MinTLSVersion so the older versions fail its TLS policy instead of the handshake, the default of
+// Go without
+func (s *Service) clientMinTLS() uint16 {
+	if s.MinTLSVersion != "" {
+		return tls.VersionTLS10
+	}
+	return 0
+}
+
+// verifyLegacyTLS fails when the server of the URL still accepts a handshake with the TLS
+// versions below the MinTLSVersion of the service, TLS 1.2 without one
+func (s *Service) verifyLegacyTLS(u *url.URL) error {
+	min, ok := parseTLSVersion(s.MinTLSVersion)
+	if !ok {
+		min = tls.VersionTLS12
+	}
+	if min <= tls.VersionTLS10 {
+		return nil
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+	if s.ResolveTo != "" {
+		addr = s.ResolveTo
+	}
+	// a probe that can not connect after the check did tells nothing about the old versions
+	conn, err := s.dial(s.network("tcp"), addr)
+	if err != nil {
+		s.Logger.Warnf("Service %v could not probe legacy TLS versions, %v", s.Name, err)
+		return nil
+	}
+	defer conn.Close()
+	conn.SetDeadline(s.deadline())
+	// the certificate was verified by the check, the probe only tells whether the old versions
+	// are still accepted
+	legacy := tls.Client(conn, &tls.Config{
+		ServerName:         s.serverName(u.Hostname()),
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS10,
+		MaxVersion:         min - 1,
+	})
+	if legacy.Handshake() != nil {
+		return nil
+	}
+	return &tlsPolicyError{
+		class: FailureTLSPolicy,
+		msg:   fmt.Sprintf("server still accepts %s below the minimum %s", tlsVersionName(legacy.ConnectionState().Version), tlsVersionName(min)),
+	}
+}
+
+// verifyPins checks that the leaf certificate has one of the pinned fingerprints or its public
+// key one of the pinned SPKI hashes
+func (s *Service) verifyPins(state *tls.ConnectionState) error {
+	leaf := state.PeerCertificates[0]
+	sum := sha256.Sum256(leaf.Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+	for _, fp := range s.CertFingerprints {
+		if normalizeFingerprint(fp) == fingerprint {
+			return nil
+		}
+	}
+	sum = sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(sum[:])
+	for _, p := range s.SPKIPins {
+		if strings.TrimPrefix(p, "sha256/") == pin {
+			return nil
+		}
+	}
+	return &tlsPolicyError{
+		class: FailureCertMismatch,
+		msg:   fmt.Sprintf("certificate %q with SHA-256 fingerprint %s and SPKI pin sha256/%s is not pinned", leaf.Subject.CommonName, fingerprint, pin),
+	}
+}
+
+// normalizeFingerprint returns the fingerprint in lower case hex without separators, e.g. for
+// AB:CD:... as printed by openssl
+func normalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.NewReplacer(":", "", " ", "").Replace(fp))
+}
+
+// validateTLSPolicy checks that the pins of the service are SHA-256 hashes and that Go knows its
+// TLS version and cipher suites
+func (s *Service) validateTLSPolicy() error {
+	if _, ok := parseTLSVersion(s.MinTLSVersion); s.MinTLSVersion != "" && !ok {
+		return fmt.Errorf("%w: unknown TLS version %q", ErrInvalidTLSPolicy, s.MinTLSVersion)
+	}
+	for _, cs := range s.CipherSuites {
+		if !knownCipherSuite(cs) {
+			return fmt.Errorf("%w: unknown cipher suite %q", ErrInvalidTLSPolicy, cs)
+		}
+	}
+	for _, fp := range s.CertFingerprints {
+		if b, err := hex.DecodeString(normalizeFingerprint(fp)); err != nil || len(b) != sha256.Size {
+			return fmt.Errorf("%w: certificate fingerprint %q is not a SHA-256 hash", ErrInvalidTLSPolicy, fp)
+		}
+	}
+	for _, p := range s.SPKIPins {
+		if b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(p, "sha256/")); err != nil || len(b) != sha256.Size {
+			return fmt.Errorf("%w: SPKI pin %q is not a base64 SHA-256 hash", ErrInvalidTLSPolicy, p)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,371 @@
+package scout
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCertPinning(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	cert := ts.Certificate()
+	sum := sha256.Sum256(cert.Raw)
+	// the fingerprint as printed by openssl x509 -fingerprint -sha256
+	var hexes []string
+	for _, b := range sum {
+		hexes = append(hexes, fmt.Sprintf("%02X", b))
+	}
+	fingerprint := strings.Join(hexes, ":")
+	sum = sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	pin := "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+
+	serv := &Service{
+		ID:               uuid.New(),
+		Name:             "Pinned",
+		Address:          ts.URL,
+		Type:             "http",
+		ExpectedStatus:   http.StatusOK,
+		SkipDNSTiming:    true,
+		Interval:         Duration(time.Minute),
+		Timeout:          Duration(2 * time.Second),
+		CertFingerprints: []string{fingerprint},
+		Logger:           NewSlogLogger(nil),
+	}
+	assert.Nil(serv.Validate())
+	_, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	serv.CertFingerprints, serv.SPKIPins = nil, []string{pin}
+	_, ok = checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+
+	// a swapped certificate fails
+	serv.CertFingerprints, serv.SPKIPins = []string{strings.Repeat("ab", sha256.Size)}, nil
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureCertMismatch, fail.Class)
+	assert.True(errors.Is(fail.Err, ErrTLSVerification))
+	assert.Contains(fail.Issue, "is not pinned")
+	assert.Contains(fail.Issue, pin)
+
+	// pins on a connection without TLS fail too
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+	serv.Address = plain.URL
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureCertMismatch, fail.Class)
+
+	serv.CertFingerprints, serv.SPKIPins = []string{"abcd"}, []string{"sha256/nope"}
+	assert.True(errors.Is(serv.Validate(), ErrInvalidTLSPolicy))
+}
+
+func TestTLSPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	// a server that still accepts TLS 1.1
+	legacy := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	legacy.TLS = &tls.Config{MinVersion: tls.VersionTLS11, MaxVersion: tls.VersionTLS11}
+	legacy.StartTLS()
+	defer legacy.Close()
+	modern := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	modern.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	modern.StartTLS()
+	defer modern.Close()
+
+	serv := &Service{
+		ID:             uuid.New(),
+		Name:           "Policy",
+		Address:        modern.URL,
+		Type:           "http",
+		ExpectedStatus: http.StatusOK,
+		SkipDNSTiming:  true,
+		Interval:       Duration(time.Minute),
+		Timeout:        Duration(2 * time.Second),
+		MinTLSVersion:  "TLS 1.2",
+		Logger:         NewSlogLogger(nil),
+	}
+	suc, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	assert.Equal("TLS 1.3", suc.Timings.TLSVersion)
+	assert.Equal("TLS_AES_128_GCM_SHA256", suc.Timings.CipherSuite)
+	serv.RefuseLegacyTLS = true
+	_, ok = checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+
+	serv.MinTLSVersion, serv.CipherSuites = "1.3", []string{"TLS_CHACHA20_POLY1305_SHA256"}
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureTLSPolicy, fail.Class)
+	assert.Contains(fail.Issue, "cipher suite TLS_AES_128_GCM_SHA256 is not allowed")
+
+	// the negotiated version is below the policy and the old versions are still accepted
+	serv.Address, serv.MinTLSVersion, serv.CipherSuites, serv.RefuseLegacyTLS = legacy.URL, "1.2", nil, false
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureTLSPolicy, fail.Class)
+	assert.Contains(fail.Issue, "negotiated TLS 1.1 is below the minimum TLS 1.2")
+	assert.True(errors.Is(fail.Err, ErrTLSVerification))
+	serv.MinTLSVersion, serv.RefuseLegacyTLS = "1.1", true
+	_, ok = checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	serv.MinTLSVersion = ""
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureTLS, fail.Class)
+	u, _ := url.Parse(legacy.URL)
+	err := serv.verifyLegacyTLS(u)
+	assert.Equal(FailureTLSPolicy, tlsClass(err))
+	assert.Contains(err.Error(), "server still accepts TLS 1.1 below the minimum TLS 1.2")
+
+	serv.MinTLSVersion, serv.CipherSuites = "1.4", nil
+	assert.True(errors.Is(serv.Validate(), ErrInvalidTLSPolicy))
+	serv.MinTLSVersion, serv.CipherSuites = "", []string{"TLS_RSA_WITH_NULL"}
+	assert.True(errors.Is(serv.Validate(), ErrInvalidTLSPolicy))
+}
+
+func TestRevocation(t *testing.T) {
+	assert := assert.New(t)
+
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Scout Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, _ := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	ca, _ := x509.ParseCertificate(caDER)
+
+	// the OCSP responder and CRL answer with the status of revoked, or fail without status
+	var status string
+	now := time.Now().UTC().Truncate(time.Second)
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ocspRequest
+		body, _ := ioutil.ReadAll(r.Body)
+		if _, err := asn1.Unmarshal(body, &req); err != nil || status == "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(testOCSPResponse(t, req.TBSRequest.RequestList[0].Cert, status, now, caKey))
+	}))
+	defer responder.Close()
+	crl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		list := &x509.RevocationList{Number: big.NewInt(1), ThisUpdate: now, NextUpdate: now.Add(time.Hour)}
+		if status == "revoked" {
+			list.RevokedCertificateEntries = []x509.RevocationListEntry{{SerialNumber: big.NewInt(2), RevocationTime: now}}
+		}
+		der, _ := x509.CreateRevocationList(rand.Reader, list, ca, caKey)
+		w.Write(der)
+	}))
+	defer crl.Close()
+
+	leafKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leafTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "revoked.example.com"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		OCSPServer:            []string{responder.URL},
+		CRLDistributionPoints: []string{crl.URL},
+	}
+	leafDER, _ := x509.CreateCertificate(rand.Reader, leafTmpl, ca, &leafKey.PublicKey, caKey)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leafDER, caDER}, PrivateKey: leafKey}}}
+	ts.StartTLS()
+	defer ts.Close()
+
+	serv := &Service{
+		ID:              uuid.New(),
+		Name:            "Revocation",
+		Address:         ts.URL,
+		Type:            "http",
+		ExpectedStatus:  http.StatusOK,
+		SkipDNSTiming:   true,
+		Interval:        Duration(time.Minute),
+		Timeout:         Duration(2 * time.Second),
+		CheckRevocation: true,
+		Logger:          NewSlogLogger(nil),
+	}
+	status = "good"
+	_, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+
+	// the good status is cached until the next update of the response
+	status = "revoked"
+	_, ok = checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+	serv.revocations.statuses = nil
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureCertRevoked, fail.Class)
+	assert.True(errors.Is(fail.Err, ErrTLSVerification))
+	assert.Contains(fail.Issue, `certificate "revoked.example.com" was revoked`)
+
+	// the CRL is read when the responder is unreachable
+	leafTmpl.OCSPServer = []string{"http://127.0.0.1:1"}
+	leafDER, _ = x509.CreateCertificate(rand.Reader, leafTmpl, ca, &leafKey.PublicKey, caKey)
+	ts.TLS.Certificates[0].Certificate[0] = leafDER
+	serv.revocations.statuses = nil
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureCertRevoked, fail.Class)
+
+	// neither answers
+	status = ""
+	serv.revocations.statuses = nil
+	fail, ok = checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureRevocationUnknown, fail.Class)
+	assert.Contains(fail.Issue, "revocation status unknown")
+	assert.Contains(fail.Issue, "OCSP http://127.0.0.1:1")
+	assert.Contains(fail.Issue, "CRL "+crl.URL)
+}
+
+// testOCSPResponse returns a OCSP response for the certificate with the status signed by the
+// key of its issuer
+func testOCSPResponse(t *testing.T, id ocspCertID, status string, now time.Time, key *ecdsa.PrivateKey) []byte {
+	cert := asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0}
+	if status == "revoked" {
+		at, _ := asn1.MarshalWithParams(now, "generalized")
+		cert = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: at}
+	}
+	keyHash, _ := asn1.Marshal(id.IssuerKeyHash)
+	tbs, err := asn1.Marshal(struct {
+		ResponderID asn1.RawValue
+		ProducedAt  time.Time `asn1:"generalized"`
+		Responses   []struct {
+			CertID     ocspCertID
+			Status     asn1.RawValue
+			ThisUpdate time.Time `asn1:"generalized"`
+			NextUpdate time.Time `asn1:"generalized,explicit,tag:0"`
+		}
+	}{
+		ResponderID: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, IsCompound: true, Bytes: keyHash},
+		ProducedAt:  now,
+		Responses: []struct {
+			CertID     ocspCertID
+			Status     asn1.RawValue
+			ThisUpdate time.Time `asn1:"generalized"`
+			NextUpdate time.Time `asn1:"generalized,explicit,tag:0"`
+		}{{id, cert, now, now.Add(time.Hour)}},
+	})
+	assert.Nil(t, err)
+	sum := sha256.Sum256(tbs)
+	sig, _ := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	basic, err := asn1.Marshal(struct {
+		TBSResponseData    asn1.RawValue
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Signature          asn1.BitString
+	}{
+		asn1.RawValue{FullBytes: tbs},
+		pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+		asn1.BitString{Bytes: sig, BitLength: len(sig) * 8},
+	})
+	assert.Nil(t, err)
+	var resp ocspResponse
+	resp.Response.ResponseType, resp.Response.Response = oidOCSPBasicResponse, basic
+	der, err := asn1.Marshal(resp)
+	assert.Nil(t, err)
+	return der
+}
+
+func TestCertChain(t *testing.T) {
+	assert := assert.New(t)
+
+	root, rootKey := testIssue(&x509.Certificate{Subject: pkix.Name{CommonName: "Scout Test Root"}, IsCA: true}, nil, nil)
+	inter, interKey := testIssue(&x509.Certificate{Subject: pkix.Name{CommonName: "Scout Test Intermediate"}, IsCA: true}, root, rootKey)
+	leaf, leafKey := testIssue(&x509.Certificate{Subject: pkix.Name{CommonName: "scout.test"}, IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)}}, inter, interKey)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Raw, inter.Raw, root.Raw}, PrivateKey: leafKey}}}
+	ts.StartTLS()
+	defer ts.Close()
+	// the chain sent by the server
+	chain := &ts.TLS.Certificates[0].Certificate
+
+	serv := &Service{
+		ID:             uuid.New(),
+		Name:           "Chain",
+		Address:        ts.URL,
+		Type:           "http",
+		ExpectedStatus: http.StatusOK,
+		SkipDNSTiming:  true,
+		Interval:       Duration(time.Minute),
+		Timeout:        Duration(2 * time.Second),
+		CheckChain:     true,
+		Logger:         NewSlogLogger(nil),
+	}
+	_, ok := checkOnce(serv).(ServiceSuccess)
+	assert.True(ok)
+
+	for _, c := range []struct {
+		chain [][]byte
+		issue string
+	}{
+		{[][]byte{leaf.Raw, inter.Raw}, `the issuer "Scout Test Root" of "Scout Test Intermediate" was not sent`},
+		{[][]byte{leaf.Raw, root.Raw}, `missing the intermediate "Scout Test Intermediate" that issued "scout.test"`},
+		{[][]byte{leaf.Raw, root.Raw, inter.Raw}, `"scout.test" is followed by "Scout Test Root" instead of its issuer "Scout Test Intermediate"`},
+	} {
+		*chain = c.chain
+		fail, ok := checkOnce(serv).(ServiceFailure)
+		assert.True(ok)
+		assert.Equal(FailureCertChain, fail.Class)
+		assert.True(errors.Is(fail.Err, ErrTLSVerification))
+		assert.Contains(fail.Issue, c.issue)
+	}
+
+	// the certificate does not cover the name of the check
+	*chain = [][]byte{leaf.Raw, inter.Raw, root.Raw}
+	serv.Address = strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)
+	fail, ok := checkOnce(serv).(ServiceFailure)
+	assert.True(ok)
+	assert.Equal(FailureCertHostname, fail.Class)
+	assert.Contains(fail.Issue, "localhost")
+}
+
+// testIssue returns a certificate of the template signed by the parent, self-signed without
+func testIssue(tmpl, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl.SerialNumber = serial
+	tmpl.NotBefore, tmpl.NotAfter = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	if tmpl.IsCA {
+		tmpl.BasicConstraintsValid, tmpl.KeyUsage = true, x509.KeyUsageCertSign
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
@@ -0,0 +1,196 @@
+package scout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	traceroute "github.com/phenixrizen/go-traceroute"
+)
+
+const (
+	traceTries  = 3
+	traceMaxTTL = 64
+)
+
+// traceIP traces the path to ip with ICMP echos hop by hop until it is reached, the context is
+// checked between hops
+var traceIP = func(ctx context.Context, ip net.IP, timeout time.Duration) (traceroute.TraceData, error) {
+	data := traceroute.Exec(ip, timeout, traceTries, traceMaxTTL, "icmp", 0)
+	for {
+		if err := ctx.Err(); err != nil {
+			return data, err
+		}
+		if err := data.Next(); err != nil {
+			if len(data.Hops[0]) == traceMaxTTL {
+				return data, nil
+			}
+			return data, err
+		}
+		hops := data.Hops[0]
+		if last := hops[len(hops)-1]; last.Err == nil && data.Dest.Equal(last.AddrIP) {
+			return data, nil
+		}
+	}
+}
+
+// RunTrace traces the path to every resolved IP of the service, it returns the traces completed
+// before the context ended with its error
+func (s *Service) RunTrace(ctx context.Context) ([]traceroute.TraceData, error) {
+	ips, err := s.lookup(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, errors.New("no IPs to trace")
+	}
+	traces := make([]traceroute.TraceData, 0, len(ips))
+	for _, ip := range ips {
+		trace, err := traceIP(ctx, ip, s.Timeout.Duration())
+		if err != nil {
+			return traces, err
+		}
+		traces = append(traces, trace)
+	}
+	return traces, nil
+}
+
+// RunTrace traces the path to the service with the ID
+func (s *Scout) RunTrace(ctx context.Context, id uuid.UUID) ([]traceroute.TraceData, error) {
+	serv := s.GetService(id)
+	if serv == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownService, id)
+	}
+	return serv.RunTrace(ctx)
+}
+
+// Baseline returns the last known-good trace of the service and when it was taken
+func (s *Service) Baseline() ([]traceroute.TraceData, time.Time) {
+	s.traceMux.Lock()
+	defer s.traceMux.Unlock()
+	return s.TraceBaseline, s.TraceBaselineAt
+}
+
+// RouteChanged is sent on the Response Channel when the path of a new trace to a IP of the
+// service differs from its baseline trace, unresponsive hops are not compared
+type RouteChanged struct {
+	Service    uuid.UUID   `json:"service"`
+	Dest       string      `json:"dest"`
+	Changes    []HopChange `json:"changes"`
+	BaselineAt time.Time   `json:"baselineAt"`
+	CreatedAt  time.Time   `json:"createdAt"`
+}
+
+// HopChange is a hop of a trace that differs from the baseline, a missing hop is empty
+type HopChange struct {
+	TTL  int    `json:"ttl"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ServiceID returns the ID of the service whose route changed
+func (r RouteChanged) ServiceID() uuid.UUID { return r.Service }
+
+// Time returns when the route change was detected
+func (r RouteChanged) Time() time.Time { return r.CreatedAt }
+
+// tracePath returns the address answering each TTL of the trace, "*" when no try got a answer
+func tracePath(trace traceroute.TraceData) []string {
+	var path []string
+	for _, hops := range trace.Hops {
+		for i, hop := range hops {
+			if i == len(path) {
+				path = append(path, "*")
+			}
+			if path[i] == "*" && hop.Err == nil && hop.AddrIP != nil {
+				path[i] = hop.AddrIP.String()
+			}
+		}
+	}
+	return path
+}
+
+// diffPaths returns the hops of path that differ from the baseline
+func diffPaths(baseline, path []string) []HopChange {
+	var changes []HopChange
+	for i := 0; i < len(baseline) || i < len(path); i++ {
+		from, to := "", ""
+		if i < len(baseline) {
+			from = baseline[i]
+		}
+		if i < len(path) {
+			to = path[i]
+		}
+		if from == to || from == "*" || to == "*" {
+			continue
+		}
+		changes = append(changes, HopChange{TTL: i + 1, From: from, To: to})
+	}
+	return changes
+}
+
+// routeChanges compares the traces with the baseline of the service and sends a RouteChanged
+// for every destination whose path changed
+func (s *Service) routeChanges(traces []traceroute.TraceData) {
+	baseline, at := s.Baseline()
+	for _, trace := range traces {
+		for _, base := range baseline {
+			if !base.Dest.Equal(trace.Dest) {
+				continue
+			}
+			if changes := diffPaths(tracePath(base), tracePath(trace)); len(changes) > 0 {
+				s.emit(RouteChanged{
+					Service:    s.ID,
+					Dest:       trace.Dest.String(),
+					Changes:    changes,
+					BaselineAt: at,
+					CreatedAt:  time.Now().UTC(),
+				})
+			}
+		}
+	}
+}
+
+// baselineDue starts a baseline trace of a healthy service when its TraceInterval passed since
+// the last one, only one baseline trace runs at a time and it replaces the baseline with the
+// next check, after sending the route changes against the previous baseline
+func (s *Service) baselineDue() {
+	if s.TraceInterval <= 0 {
+		return
+	}
+	s.traceMux.Lock()
+	pending := s.pendingTrace
+	s.pendingTrace = nil
+	s.traceMux.Unlock()
+	if pending != nil {
+		s.routeChanges(pending)
+		s.traceMux.Lock()
+		s.TraceBaseline = pending
+		s.TraceBaselineAt = time.Now().UTC()
+		s.traceMux.Unlock()
+	}
+	s.traceMux.Lock()
+	due := time.Since(s.TraceBaselineAt) >= s.TraceInterval.Duration() && s.pendingTrace == nil
+	s.traceMux.Unlock()
+	if !due || !atomic.CompareAndSwapInt32(&s.tracing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&s.tracing, 0)
+		ctx, cancel := context.WithTimeout(context.Background(), s.TraceInterval.Duration())
+		defer cancel()
+		traces, err := s.RunTrace(ctx)
+		if err != nil {
+			s.Logger.Warnf("Could not trace the baseline of %s, %v", s.Name, err)
+			return
+		}
+		s.traceMux.Lock()
+		s.pendingTrace = traces
+		s.traceMux.Unlock()
+	}()
+}
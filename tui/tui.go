@@ -0,0 +1,192 @@
+// Package tui renders a live dashboard of the services of a scout in a terminal
+package tui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/phenixrizen/scout"
+)
+
+const (
+	// subscriber is the name the dashboard subscribes to the results of the scout with
+	subscriber = "tui"
+	clear      = "\x1b[H\x1b[2J"
+	reset      = "\x1b[0m"
+)
+
+var (
+	sparks = []rune("▁▂▃▄▅▆▇█")
+	colors = map[string]string{
+		scout.StateUp:       "\x1b[32m",
+		scout.StateDegraded: "\x1b[33m",
+		scout.StateDown:     "\x1b[31m",
+	}
+)
+
+// Dashboard keeps the results of the services of a scout and renders them as a table with their
+// status, a sparkline of their recent latencies, their uptime and last error
+type Dashboard struct {
+	// Refresh is how often Run redraws the dashboard
+	Refresh time.Duration
+	// Samples is the number of latencies shown in the sparkline
+	Samples int
+
+	scout *scout.Scout
+	out   io.Writer
+	rows  map[uuid.UUID]*row
+	mux   sync.Mutex
+}
+
+// row is what the dashboard has seen of a service
+type row struct {
+	latencies []int64
+	checks    uint64
+	ups       uint64
+	lastError string
+}
+
+// New returns a dashboard of the services of the scout drawn to out
+func New(s *scout.Scout, out io.Writer) *Dashboard {
+	return &Dashboard{Refresh: time.Second, Samples: 20, scout: s, out: out, rows: make(map[uuid.UUID]*row)}
+}
+
+// Run subscribes to the results of the scout and redraws the dashboard every Refresh until ctx
+// is done
+func (d *Dashboard) Run(ctx context.Context) error {
+	results := d.scout.Subscribe(subscriber, 64)
+	defer d.scout.Unsubscribe(subscriber)
+	ticker := time.NewTicker(d.Refresh)
+	defer ticker.Stop()
+	d.draw()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case r, ok := <-results:
+			if !ok {
+				return nil
+			}
+			d.Update(r)
+		case <-ticker.C:
+			d.draw()
+		}
+	}
+}
+
+// Update adds the result of a check to the dashboard
+func (d *Dashboard) Update(r scout.CheckResult) {
+	var up bool
+	var latency int64
+	var issue string
+	switch res := r.Result.(type) {
+	case scout.ServiceSuccess:
+		up, latency = true, res.RequestLatency
+	case scout.ServiceFailure:
+		issue = res.Issue
+	default:
+		return
+	}
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	rw, ok := d.rows[r.ServiceID()]
+	if !ok {
+		rw = &row{}
+		d.rows[r.ServiceID()] = rw
+	}
+	rw.checks++
+	if up {
+		rw.ups++
+		rw.latencies = append(rw.latencies, latency)
+		if len(rw.latencies) > d.Samples {
+			rw.latencies = rw.latencies[len(rw.latencies)-d.Samples:]
+		}
+	} else {
+		rw.lastError = issue
+	}
+}
+
+// Render writes the dashboard once to w, services are sorted by name
+func (d *Dashboard) Render(w io.Writer) {
+	servs := d.scout.GetServices()
+	sts := make([]scout.ServiceStatus, 0, len(servs))
+	for _, serv := range servs {
+		sts = append(sts, serv.Snapshot())
+	}
+	sort.Slice(sts, func(i, j int) bool { return sts[i].Name < sts[j].Name })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "scout  %d services  %s\n\n", len(sts), time.Now().Format(time.RFC1123))
+	fmt.Fprintf(&b, "%-24s %-10s %-9s %8s  %-*s %7s  %s\n", "SERVICE", "TYPE", "STATUS", "LATENCY", d.Samples, "HISTORY", "UPTIME", "LAST ERROR")
+	d.mux.Lock()
+	for _, st := range sts {
+		rw := d.rows[st.ID]
+		if rw == nil {
+			rw = &row{}
+		}
+		state := st.State
+		if st.Paused {
+			state = "paused"
+		}
+		status := fmt.Sprintf("%-9s", state)
+		if color, ok := colors[state]; ok {
+			status = color + status + reset
+		}
+		uptime := "-"
+		if rw.checks > 0 {
+			uptime = fmt.Sprintf("%.1f%%", float64(rw.ups)/float64(rw.checks)*100)
+		}
+		fmt.Fprintf(&b, "%-24s %-10s %s %6dms  %s %7s  %s\n", truncate(st.Name, 24), truncate(st.Type, 10), status, st.RequestLatency, sparkline(rw.latencies, d.Samples), uptime, rw.lastError)
+	}
+	d.mux.Unlock()
+	io.WriteString(w, b.String())
+}
+
+// draw clears the terminal and renders the dashboard to its output
+func (d *Dashboard) draw() {
+	io.WriteString(d.out, clear)
+	d.Render(d.out)
+}
+
+// sparkline returns the latencies scaled between the lowest and highest, padded to width
+func sparkline(latencies []int64, width int) string {
+	if len(latencies) > width {
+		latencies = latencies[len(latencies)-width:]
+	}
+	if len(latencies) == 0 {
+		return strings.Repeat(" ", width)
+	}
+	min, max := latencies[0], latencies[0]
+	for _, l := range latencies {
+		if l < min {
+			min = l
+		}
+		if l > max {
+			max = l
+		}
+	}
+	line := make([]rune, 0, width)
+	for _, l := range latencies {
+		i := 0
+		if max > min {
+			i = int((l - min) * int64(len(sparks)-1) / (max - min))
+		}
+		line = append(line, sparks[i])
+	}
+	return string(line) + strings.Repeat(" ", width-len(line))
+}
+
+// truncate shortens s to n runes
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,41 @@
+package tui
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/phenixrizen/scout"
+)
+
+func TestDashboard(t *testing.T) {
+	assert := assert.New(t)
+
+	api := &scout.Service{ID: uuid.New(), Name: "API", Type: "http", Address: "https://api.example"}
+	db := &scout.Service{ID: uuid.New(), Name: "DB", Type: "tcp", Address: "db.example:5432"}
+	s, err := scout.NewScoutWithOptions(scout.WithServices(api, db))
+	assert.Nil(err)
+
+	d := New(s, nil)
+	d.Samples = 4
+	for _, l := range []int64{10, 20, 30, 40, 50} {
+		d.Update(scout.CheckResult{Result: scout.ServiceSuccess{Service: api.ID, RequestLatency: l, CreatedAt: time.Now()}})
+	}
+	d.Update(scout.CheckResult{Result: scout.ServiceFailure{Service: api.ID, Issue: "connection refused", CreatedAt: time.Now()}})
+
+	var b bytes.Buffer
+	d.Render(&b)
+	out := b.String()
+	assert.Contains(out, "2 services")
+	// only the last Samples latencies are drawn, scaled between the lowest and highest
+	assert.Contains(out, "▁▃▅█")
+	assert.Contains(out, "83.3%  connection refused")
+	assert.Contains(out, "DB                       tcp        pending")
+	assert.Less(bytes.Index(b.Bytes(), []byte("API")), bytes.Index(b.Bytes(), []byte("DB ")))
+
+	assert.Equal("▁█  ", sparkline([]int64{1, 2}, 4))
+	assert.Equal("Long…", truncate("Longer", 5))
+}
@@ -5,7 +5,6 @@ import (
 	"context"
 	"crypto/tls"
 	"io"
-	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptrace"
@@ -27,8 +26,37 @@ type HTTPRequestMetrics struct {
 	WroteHeaders         int64
 	WroteRequest         int64
 	GotResponse          int64
+	BodyDone             int64
+	RemoteAddr           string
+	Protocol             string
+	TLSVersion           string
+	CipherSuite          string
+	// BodyBytes is how much of the body was read, Truncated whether the body was longer than the
+	// read limit of the request
+	BodyBytes int64
+	Truncated bool
+	// ContentEncoding is the encoding the body was sent with and CompressedBytes its size as
+	// sent, unknown when the transport decompressed it transparently
+	ContentEncoding string
+	CompressedBytes int64
+	// body is the pooled buffer holding the contents returned with the metrics, the checks give it
+	// back with release once they are done with the contents
+	body *bytes.Buffer
 }
 
+const (
+	// HTTP2Off speaks HTTP/1.1 with the target, it is the default HTTP2 mode
+	HTTP2Off = "off"
+	// HTTP2Allow negotiates HTTP/2 with ALPN and falls back to HTTP/1.1
+	HTTP2Allow = "allow"
+	// HTTP2Require negotiates HTTP/2 and fails the check when the target does not speak it
+	HTTP2Require = "require"
+)
+
+// DefaultReadLimit is the most of a response body read into memory by the requests of services
+// without ReadLimit, HTTPRequest reads the whole body
+const DefaultReadLimit = 4 << 20
+
 // HTTPRequest is a global function to send a HTTP request
 //  ctx - Context to be used in request
 //  url - The URL for HTTP request
@@ -41,19 +69,66 @@ type HTTPRequestMetrics struct {
 //  verifySSL - verify the SSL certificate
 //  You can use a HTTP Proxy if you HTTP_PROXY environment variable
 func HTTPRequest(ctx context.Context, url, resolveTo, method string, contentType interface{}, headers http.Header, body io.Reader, timeout time.Duration, verifySSL bool) ([]byte, *http.Response, *HTTPRequestMetrics, error) {
+	return doHTTPRequest(ctx, &requestConfig{
+		url:         url,
+		resolveTo:   resolveTo,
+		method:      method,
+		contentType: contentType,
+		headers:     headers,
+		body:        body,
+		timeout:     timeout,
+		verifySSL:   verifySSL,
+		readLimit:   -1,
+	})
+}
+
+// requestConfig holds the settings for a single HTTP request, HTTPRequest covers the common ones
+// while services use it directly for the settings that are not part of the HTTPRequest signature
+type requestConfig struct {
+	url         string
+	resolveTo   string
+	method      string
+	contentType interface{}
+	headers     http.Header
+	body        io.Reader
+	timeout     time.Duration
+	verifySSL   bool
+	resolver    *net.Resolver
+	lookup      func(ctx context.Context, host string) ([]net.IP, error)
+	network     string
+	minTLS      uint16
+	// hostHeader and sni replace the host of the url in the Host header and the TLS server name
+	hostHeader string
+	sni        string
+	// readLimit is the most of the body read, DefaultReadLimit when zero and the whole body when
+	// negative
+	readLimit int64
+	// http2 lets the transport negotiate HTTP/2 with ALPN, it speaks HTTP/1.1 otherwise
+	http2 bool
+	// http3 sends the request over HTTP/3 with its round tripper instead of the transport
+	http3 HTTP3Transport
+	// acceptEncoding is sent as Accept-Encoding and the body decompressed by the request instead
+	// of the transport, so its encoding and compressed size are known
+	acceptEncoding string
+}
+
+func doHTTPRequest(ctx context.Context, cfg *requestConfig) ([]byte, *http.Response, *HTTPRequestMetrics, error) {
 	var err error
 	var req *http.Request
 	metrics := &HTTPRequestMetrics{}
 
-	if req, err = http.NewRequestWithContext(ctx, method, url, body); err != nil {
+	if req, err = http.NewRequestWithContext(ctx, cfg.method, cfg.url, cfg.body); err != nil {
 		return nil, nil, nil, err
 	}
 	trace := &httptrace.ClientTrace{
 		GetConn: func(hostPort string) {
 			metrics.GetConn = time.Now().UnixNano()
 		},
-		GotConn: func(httptrace.GotConnInfo) {
+		GotConn: func(info httptrace.GotConnInfo) {
 			metrics.GotConn = time.Now().UnixNano()
+			if info.Conn != nil {
+				metrics.RemoteAddr = info.Conn.RemoteAddr().String()
+			}
 		},
 		GotFirstResponseByte: func() {
 			metrics.GotFirstResponseByte = time.Now().UnixNano()
@@ -73,8 +148,12 @@ func HTTPRequest(ctx context.Context, url, resolveTo, method string, contentType
 		TLSHandshakeStart: func() {
 			metrics.TLSHandshakeStart = time.Now().UnixNano()
 		},
-		TLSHandshakeDone: func(tls.ConnectionState, error) {
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
 			metrics.TLSHandshakeDone = time.Now().UnixNano()
+			if err == nil {
+				metrics.TLSVersion = tlsVersionName(state.Version)
+				metrics.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+			}
 		},
 		WroteHeaderField: func(key string, value []string) {
 			metrics.WroteHeaderField = time.Now().UnixNano()
@@ -86,63 +165,152 @@ func HTTPRequest(ctx context.Context, url, resolveTo, method string, contentType
 			metrics.WroteRequest = time.Now().UnixNano()
 		},
 	}
-	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	if cfg.http3 == nil {
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	}
 
-	if headers != nil {
-		if headers.Get("User-Agent") == "" {
-			headers.Set("User-Agent", "phenixrizen-scout")
+	if cfg.headers == nil && cfg.contentType != nil {
+		cfg.headers = make(http.Header)
+	}
+	if cfg.headers != nil {
+		if cfg.headers.Get("User-Agent") == "" {
+			cfg.headers.Set("User-Agent", "phenixrizen-scout")
 		}
-		if contentType != nil {
-			ct, ok := contentType.(string)
+		if cfg.contentType != nil {
+			ct, ok := cfg.contentType.(string)
 			if ok {
-				headers.Set("Content-Type", ct)
+				cfg.headers.Set("Content-Type", ct)
 			}
 		}
 	}
 
-	req.Header = headers
+	req.Header = cfg.headers
+	if cfg.hostHeader != "" {
+		req.Host = cfg.hostHeader
+	}
+	if cfg.acceptEncoding != "" {
+		header := req.Header.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+		header.Set("Accept-Encoding", cfg.acceptEncoding)
+		req.Header = header
+	}
+	serverName := req.URL.Hostname()
+	if cfg.sni != "" {
+		serverName = cfg.sni
+	}
 
 	var resp *http.Response
 
 	dialer := &net.Dialer{
-		Timeout:   timeout,
-		KeepAlive: timeout,
+		Timeout:   cfg.timeout,
+		KeepAlive: cfg.timeout,
+		Resolver:  cfg.resolver,
 	}
 
+	tlsConf := &tls.Config{
+		InsecureSkipVerify: !cfg.verifySSL,
+		ServerName:         serverName,
+		MinVersion:         cfg.minTLS,
+	}
 	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: !verifySSL,
-			ServerName:         req.URL.Hostname(),
-		},
+		TLSClientConfig:       tlsConf,
 		DisableKeepAlives:     true,
-		ResponseHeaderTimeout: timeout,
-		TLSHandshakeTimeout:   timeout,
+		ForceAttemptHTTP2:     cfg.http2,
+		ResponseHeaderTimeout: cfg.timeout,
+		TLSHandshakeTimeout:   cfg.timeout,
 		Proxy:                 http.ProxyFromEnvironment,
 		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			if resolveTo != "" {
-				addr = resolveTo
+			if cfg.network != "" {
+				network = cfg.network
+			}
+			if cfg.resolveTo != "" {
+				addr = cfg.resolveTo
 			} else {
 				// redirect all connections to host specified in url
-				addr = strings.Split(req.URL.Host, ":")[0] + addr[strings.LastIndex(addr, ":"):]
+				addr = net.JoinHostPort(req.URL.Hostname(), addr[strings.LastIndex(addr, ":")+1:])
+				if cfg.lookup != nil {
+					return dialLookup(ctx, dialer, cfg.lookup, network, addr)
+				}
 			}
 			return dialer.DialContext(ctx, network, addr)
 		},
 	}
 	client := &http.Client{
 		Transport: transport,
-		Timeout:   timeout,
+		Timeout:   cfg.timeout,
 	}
 
-	if resp, err = client.Do(req); err != nil {
+	if cfg.http3 != nil {
+		resp, err = roundTripHTTP3(req, cfg, tlsConf, metrics)
+	} else {
+		resp, err = client.Do(req)
+	}
+	if err != nil {
 		return nil, resp, metrics, err
 	}
 	metrics.GotResponse = time.Now().UnixNano()
+	metrics.Protocol = resp.Proto
 	defer resp.Body.Close()
-	contents, err := ioutil.ReadAll(resp.Body)
-	resp.Body = ioutil.NopCloser(bytes.NewBuffer(contents))
+	limit := cfg.readLimit
+	if limit == 0 {
+		limit = DefaultReadLimit
+	}
+	buf, truncated, err := readLimit(resp.Body, limit)
+	if resp.Uncompressed {
+		metrics.ContentEncoding = "gzip"
+	}
+	if encoding := resp.Header.Get("Content-Encoding"); err == nil && cfg.acceptEncoding != "" && encoding != "" && !strings.EqualFold(encoding, "identity") {
+		metrics.ContentEncoding, metrics.CompressedBytes = encoding, int64(buf.Len())
+		compressed := buf
+		if buf, truncated, err = decompress(encoding, compressed, truncated, limit); buf != compressed {
+			putBuffer(compressed)
+		}
+	}
+	metrics.body = buf
+	contents := buf.Bytes()
+	metrics.BodyDone = time.Now().UnixNano()
+	metrics.BodyBytes, metrics.Truncated = int64(len(contents)), truncated
+	// the body reads the pooled contents, it stops reading them once they are released
+	resp.Body = &pooledBody{contents: bytes.NewReader(contents), metrics: metrics}
 	return contents, resp, metrics, err
 }
 
+// dialLookup resolves the host of addr with lookup and dials the resolved addresses in order
+func dialLookup(ctx context.Context, dialer *net.Dialer, lookup func(ctx context.Context, host string) ([]net.IP, error), network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	var conn net.Conn
+	for _, ip := range ips {
+		conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// release gives the buffer of the contents returned with the metrics back to the pool, the
+// contents must not be used after and the body of the response fails to read. The contents
+// returned by HTTPRequest are never released
+func (m *HTTPRequestMetrics) release() {
+	if m == nil {
+		return
+	}
+	putBuffer(m.body)
+	m.body = nil
+}
+
 // NetworkLatency returns the network connection latency in ms
 func (m *HTTPRequestMetrics) NetworkLatency() int64 {
 	return time.Unix(0, m.ConnectDone).Sub(time.Unix(0, m.GetConn)).Milliseconds()
@@ -0,0 +1,249 @@
+package scout
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+)
+
+// minTimeout is the shortest Timeout a service can have, a Duration counts nanoseconds so
+// Timeout: 10 is 10ns and not 10s
+const minTimeout = time.Millisecond
+
+// checkTypes are the service types Check can run
+var checkTypes = map[string]bool{
+	"http": true, "graphql": true, "soap": true, "tcp": true, "udp": true, "icmp": true, "cdn": true, "dns": true,
+	"postgres": true, "mysql": true, "sql": true, "redis": true, "memcached": true,
+	"mongodb": true, "kafka": true, "amqp": true, "ntp": true, "ldap": true, "snmp": true,
+	"dnsbl": true, "kubernetes": true, "docker": true, "exec": true, "heartbeat": true,
+}
+
+// ValidationError lists the problems of a invalid service, it matches ErrInvalidService and the
+// errors of each of its problems with errors.Is
+type ValidationError struct {
+	Service  string
+	Problems []error
+}
+
+// Error returns the problems of the service
+func (e *ValidationError) Error() string {
+	problems := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		problems[i] = p.Error()
+	}
+	return fmt.Sprintf("scout: invalid service %s: %s", e.Service, strings.Join(problems, "; "))
+}
+
+// Is reports whether target is ErrInvalidService or matches one of the problems
+func (e *ValidationError) Is(target error) bool {
+	if target == ErrInvalidService {
+		return true
+	}
+	for _, p := range e.Problems {
+		if errors.Is(p, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the configuration of the service and returns a ValidationError with all its
+// problems, nil when the service can be checked
+func (s *Service) Validate() error {
+	var problems []error
+	if !checkTypes[s.Type] {
+		problems = append(problems, fmt.Errorf("%w %q", ErrUnsupportedType, s.Type))
+	}
+	if s.Interval <= 0 {
+		problems = append(problems, fmt.Errorf("%w %v", ErrInvalidInterval, s.Interval.Duration()))
+	}
+	if s.Timeout > 0 && s.Timeout.Duration() < minTimeout {
+		problems = append(problems, fmt.Errorf("%w %v, a Duration counts nanoseconds, e.g. Duration(10 * time.Second)", ErrInvalidTimeout, s.Timeout.Duration()))
+	}
+	if err := s.validateAddress(); err != nil {
+		problems = append(problems, err)
+	}
+	if _, err := regexp.Compile(s.Expected); err != nil {
+		problems = append(problems, fmt.Errorf("%w: expected %q, %v", ErrInvalidExpected, s.Expected, err))
+	}
+	if _, err := regexp.Compile(s.ExpectedBanner); err != nil {
+		problems = append(problems, fmt.Errorf("%w: expected banner %q, %v", ErrInvalidExpected, s.ExpectedBanner, err))
+	}
+	if s.Retry && (s.RetryMinInterval <= 0 || s.RetryMaxInterval < s.RetryMinInterval) {
+		problems = append(problems, fmt.Errorf("%w: min %v, max %v", ErrInvalidRetry, s.RetryMinInterval.Duration(), s.RetryMaxInterval.Duration()))
+	}
+	if s.RecoveryInterval < 0 {
+		problems = append(problems, fmt.Errorf("%w: recovery interval %v", ErrInvalidInterval, s.RecoveryInterval.Duration()))
+	}
+	if !validRetryStrategy(s.RetryStrategy) || s.RetryCap < 0 {
+		problems = append(problems, fmt.Errorf("%w: strategy %q, cap %v", ErrInvalidRetry, s.RetryStrategy, s.RetryCap.Duration()))
+	}
+	if s.SecurityHeaders != nil {
+		if err := s.SecurityHeaders.validate(); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if s.ReadLimit < 0 || s.MinBodyBytes < 0 || s.MaxBodyBytes < 0 || (s.MaxBodyBytes > 0 && s.MaxBodyBytes < s.MinBodyBytes) {
+		problems = append(problems, fmt.Errorf("%w: read limit %d, body bytes min %d, max %d", ErrInvalidExpected, s.ReadLimit, s.MinBodyBytes, s.MaxBodyBytes))
+	}
+	switch s.HTTP2 {
+	case "", HTTP2Off, HTTP2Allow, HTTP2Require:
+	default:
+		problems = append(problems, fmt.Errorf("%w: unknown http2 mode %q", ErrInvalidCheck, s.HTTP2))
+	}
+	if s.HTTP3 && !strings.HasPrefix(s.Address, "https://") {
+		problems = append(problems, fmt.Errorf("%w: http3 needs a https address", ErrInvalidCheck))
+	}
+	if len(s.JSONSchema) > 0 {
+		if _, err := parseJSONSchema(s.JSONSchema); err != nil {
+			problems = append(problems, fmt.Errorf("%w: json schema, %v", ErrInvalidExpected, err))
+		}
+	}
+	if s.GraphQL != nil {
+		if err := s.GraphQL.validate(); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if s.SOAP != nil {
+		if err := s.SOAP.validate(); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if s.ExpectCompression != "" && !compressions[s.ExpectCompression] {
+		problems = append(problems, fmt.Errorf("%w: unknown compression %q", ErrInvalidExpected, s.ExpectCompression))
+	}
+	if err := s.validateContentHash(); err != nil {
+		problems = append(problems, err)
+	}
+	if err := s.validateTLSPolicy(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.Quorum < 0 || s.Quorum > len(s.Agents) {
+		problems = append(problems, fmt.Errorf("%w: %d of %d agents", ErrInvalidQuorum, s.Quorum, len(s.Agents)))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	name := s.Name
+	if name == "" {
+		name = s.ID.String()
+	}
+	return &ValidationError{Service: name, Problems: problems}
+}
+
+// validateAddress checks that the address of the service fits its type
+func (s *Service) validateAddress() error {
+	switch s.Type {
+	case "heartbeat", "exec", "kubernetes":
+		return nil
+	case "postgres", "mysql", "sql":
+		if s.DSN != "" {
+			return nil
+		}
+	}
+	if s.Address == "" {
+		return fmt.Errorf("%w: no address", ErrInvalidAddress)
+	}
+	switch s.Type {
+	case "http", "graphql", "soap", "cdn":
+		u, err := url.Parse(s.Address)
+		if err != nil {
+			return fmt.Errorf("%w %q, %v", ErrInvalidAddress, s.Address, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w %q, expected a http or https url", ErrInvalidAddress, s.Address)
+		}
+	case "tcp", "udp":
+		if s.Port != 0 {
+			return nil
+		}
+		if _, _, err := net.SplitHostPort(s.Address); err != nil {
+			return fmt.Errorf("%w %q, expected host:port or a port", ErrInvalidAddress, s.Address)
+		}
+	}
+	return nil
+}
+
+// ConfigError lists the invalid services of a configuration file, it matches the errors of its
+// services with errors.Is
+type ConfigError struct {
+	Path     string
+	Services []error
+}
+
+// Error returns the errors of the invalid services
+func (e *ConfigError) Error() string {
+	errs := make([]string, len(e.Services))
+	for i, err := range e.Services {
+		errs[i] = err.Error()
+	}
+	return fmt.Sprintf("scout: invalid config %s: %s", e.Path, strings.Join(errs, ", "))
+}
+
+// Is reports whether target matches the error of one of the services
+func (e *ConfigError) Is(target error) bool {
+	for _, err := range e.Services {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Config is a configuration file with the defaults and templates its services inherit from
+type Config struct {
+	Templates
+	Services []*Service `json:"services"`
+}
+
+// LoadConfig reads the services from a YAML or JSON file and validates them, the ConfigError
+// returned lists every invalid service. The file is either a list of services or a Config with
+// defaults and templates that are applied to its services
+func LoadConfig(path string) ([]*Service, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := parseConfig(b)
+	if err != nil {
+		return nil, err
+	}
+	var invalid []error
+	for _, serv := range cfg.Services {
+		if err := cfg.Apply(serv); err != nil {
+			invalid = append(invalid, err)
+			continue
+		}
+		if err := serv.Validate(); err != nil {
+			invalid = append(invalid, err)
+		}
+	}
+	if len(invalid) > 0 {
+		return nil, &ConfigError{Path: path, Services: invalid}
+	}
+	return cfg.Services, nil
+}
+
+// parseConfig parses a YAML or JSON list of services or Config
+func parseConfig(b []byte) (*Config, error) {
+	j, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if trimmed := bytes.TrimSpace(j); len(trimmed) > 0 && trimmed[0] == '{' {
+		err = json.Unmarshal(j, cfg)
+	} else {
+		err = json.Unmarshal(j, &cfg.Services)
+	}
+	return cfg, err
+}
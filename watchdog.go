@@ -0,0 +1,104 @@
+package scout
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// watchdogTick is how often the watchdog looks for stalled services
+var watchdogTick = time.Second
+
+// ServiceStalled is sent on the Response Channel when a service has not completed a check
+// within the watchdog factor times its interval, e.g. because a check hung. Restarted is true
+// when the hung check was cancelled for the service loop to carry on
+type ServiceStalled struct {
+	Service   uuid.UUID `json:"service"`
+	LastCheck time.Time `json:"lastCheck"`
+	Stalled   Duration  `json:"stalled"`
+	Restarted bool      `json:"restarted"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ServiceID returns the ID of the stalled service
+func (r ServiceStalled) ServiceID() uuid.UUID { return r.Service }
+
+// Time returns when the stall was detected
+func (r ServiceStalled) Time() time.Time { return r.CreatedAt }
+
+// WithWatchdog watches the running services of the scout and sends a ServiceStalled when a
+// service has not completed a check within factor times its interval (plus its timeout),
+// with restart the context of the hung check is cancelled so the service loop carries on
+func WithWatchdog(factor int, restart bool) Option {
+	return func(s *Scout) error {
+		if factor < 1 {
+			return fmt.Errorf("scout: watchdog factor must be at least 1, got %d", factor)
+		}
+		s.stallFactor = factor
+		s.stallRestart = restart
+		return nil
+	}
+}
+
+// beat records that the service loop is alive and will check again within wait
+func (s *Service) beat(wait time.Duration) {
+	atomic.StoreInt64(&s.heartbeat, time.Now().UnixNano())
+	atomic.StoreInt64(&s.heartbeatWait, int64(wait))
+	atomic.StoreInt32(&s.stalled, 0)
+}
+
+// stalledSince returns the time of the last heartbeat of the service loop and true when it is
+// older than factor times the wait that was expected after it
+func (s *Service) stalledSince(now time.Time, factor int) (time.Time, bool) {
+	hb := atomic.LoadInt64(&s.heartbeat)
+	if hb == 0 {
+		return time.Time{}, false
+	}
+	last := time.Unix(0, hb)
+	wait := time.Duration(atomic.LoadInt64(&s.heartbeatWait))
+	if wait < s.Interval.Duration() {
+		wait = s.Interval.Duration()
+	}
+	return last, now.Sub(last) > time.Duration(factor)*wait+s.Timeout.Duration()
+}
+
+// watch runs the watchdog until stop is closed
+func (s *Scout) watch(stop chan struct{}) {
+	ticker := time.NewTicker(watchdogTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			s.checkStalled(now)
+		}
+	}
+}
+
+// checkStalled sends a ServiceStalled for every running service that stalled since its last
+// heartbeat, cancelling its running check when the watchdog was configured to restart. The
+// service keeps its one loop, a second loop would race the first on the state of the service
+// and wait behind the hung check for the check lock
+func (s *Scout) checkStalled(now time.Time) {
+	for _, serv := range s.GetServices() {
+		if serv.primary != nil || serv.Snapshot().Paused || !serv.IsRunning() {
+			continue
+		}
+		last, stalled := serv.stalledSince(now, s.stallFactor)
+		if !stalled || !atomic.CompareAndSwapInt32(&serv.stalled, 0, 1) {
+			continue
+		}
+		s.Logger.Warnf("Service %s (%s) has not completed a check since %s", serv.Name, serv.ID, last)
+		restarted := s.stallRestart && serv.abort()
+		serv.emit(ServiceStalled{
+			Service:   serv.ID,
+			LastCheck: last.UTC(),
+			Stalled:   Duration(now.Sub(last)),
+			Restarted: restarted,
+			CreatedAt: now.UTC(),
+		})
+	}
+}
@@ -0,0 +1,351 @@
+package scout
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// xmlNode is a element, text or attribute of a parsed XML document
+type xmlNode struct {
+	name     string
+	text     string
+	attr     bool
+	attrs    []xml.Attr
+	children []*xmlNode
+}
+
+// isText reports whether the node is character data
+func (n *xmlNode) isText() bool {
+	return n.name == "" && !n.attr
+}
+
+// value returns the string value of the node, the text of a element is the text of all of its
+// descendants
+func (n *xmlNode) value() string {
+	if n.attr || n.isText() {
+		return n.text
+	}
+	var b strings.Builder
+	for _, c := range n.children {
+		b.WriteString(c.value())
+	}
+	return b.String()
+}
+
+// parseXML parses a XML document into the document node, whose only element is the root
+func parseXML(content []byte) (*xmlNode, error) {
+	doc := &xmlNode{name: "/"}
+	stack := []*xmlNode{doc}
+	dec := xml.NewDecoder(bytes.NewReader(content))
+	dec.Strict = false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		parent := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: t.Name.Local, attrs: t.Attr}
+			parent.children = append(parent.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			if len(stack) > 1 {
+				parent.children = append(parent.children, &xmlNode{text: string(t)})
+			}
+		}
+	}
+	if len(doc.children) == 0 {
+		return nil, fmt.Errorf("no root element")
+	}
+	return doc, nil
+}
+
+// xpathStep is a step of a XPath, the nodes matching the test among the children, or all the
+// descendants, of the context nodes that pass the predicates
+type xpathStep struct {
+	descendant bool
+	test       string
+	predicates []xpathPredicate
+}
+
+// xpathPredicate filters the nodes of a step by position, e.g. [2] or [last()], or by the
+// value of a attribute, child element, their text or themselves, e.g. [@id='1'] or [status]
+type xpathPredicate struct {
+	position int
+	last     bool
+	operand  string
+	value    string
+	compare  bool
+}
+
+// xpath is a parsed XPath expression, a location path or count() of one
+type xpath struct {
+	steps []xpathStep
+	count bool
+}
+
+// parseXPath parses the subset of XPath assertions use: absolute and relative location paths of
+// element names, *, @attribute, text() and . steps with // descendants, position and
+// equality predicates, and count() of a path. Namespace prefixes are ignored, elements match by
+// local name, e.g. //soap:Body/m:Price matches the Price in the body of any envelope
+func parseXPath(expr string) (*xpath, error) {
+	expr = strings.TrimSpace(expr)
+	x := &xpath{}
+	if strings.HasPrefix(expr, "count(") && strings.HasSuffix(expr, ")") {
+		x.count = true
+		expr = strings.TrimSpace(expr[len("count(") : len(expr)-1])
+	}
+	if expr == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+	rest := expr
+	first := true
+	for rest != "" {
+		step := xpathStep{}
+		switch {
+		case strings.HasPrefix(rest, "//"):
+			step.descendant = true
+			rest = rest[2:]
+		case strings.HasPrefix(rest, "/"):
+			rest = rest[1:]
+		case !first:
+			return nil, fmt.Errorf("unexpected %q in %q", rest, expr)
+		}
+		first = false
+		end := 0
+		depth := 0
+		var quote byte
+		for ; end < len(rest); end++ {
+			c := rest[end]
+			if quote != 0 {
+				if c == quote {
+					quote = 0
+				}
+				continue
+			}
+			if c == '\'' || c == '"' {
+				quote = c
+			} else if c == '[' {
+				depth++
+			} else if c == ']' {
+				depth--
+			} else if c == '/' && depth == 0 {
+				break
+			}
+		}
+		if quote != 0 || depth != 0 {
+			return nil, fmt.Errorf("unbalanced predicate in %q", expr)
+		}
+		token := rest[:end]
+		rest = rest[end:]
+		if i := strings.IndexByte(token, '['); i >= 0 {
+			preds, err := parseXPathPredicates(token[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%v in %q", err, expr)
+			}
+			step.predicates = preds
+			token = token[:i]
+		}
+		if token == "" || token == ".." {
+			return nil, fmt.Errorf("unsupported step %q in %q", token, expr)
+		}
+		step.test = localName(token)
+		if strings.HasPrefix(token, "@") {
+			step.test = "@" + localName(token[1:])
+		}
+		x.steps = append(x.steps, step)
+	}
+	return x, nil
+}
+
+// parseXPathPredicates parses the [predicates] of a step
+func parseXPathPredicates(s string) ([]xpathPredicate, error) {
+	var preds []xpathPredicate
+	for s != "" {
+		if s[0] != '[' {
+			return nil, fmt.Errorf("unexpected %q", s)
+		}
+		// a ] inside a quoted value does not close the predicate
+		end := -1
+		var quote byte
+		for i := 1; i < len(s) && end < 0; i++ {
+			switch {
+			case quote != 0:
+				if s[i] == quote {
+					quote = 0
+				}
+			case s[i] == '\'' || s[i] == '"':
+				quote = s[i]
+			case s[i] == ']':
+				end = i
+			}
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed predicate")
+		}
+		body := strings.TrimSpace(s[1:end])
+		s = s[end+1:]
+		pred := xpathPredicate{}
+		if n, err := strconv.Atoi(body); err == nil {
+			if n < 1 {
+				return nil, fmt.Errorf("position %d", n)
+			}
+			pred.position = n
+		} else if body == "last()" {
+			pred.last = true
+		} else {
+			operand := body
+			if i := strings.IndexByte(body, '='); i >= 0 {
+				operand = strings.TrimSpace(body[:i])
+				value := strings.TrimSpace(body[i+1:])
+				if len(value) < 2 || (value[0] != '\'' && value[0] != '"') || value[len(value)-1] != value[0] {
+					return nil, fmt.Errorf("predicate value %s is not quoted", value)
+				}
+				pred.value, pred.compare = value[1:len(value)-1], true
+			}
+			if operand == "" || operand == ".." {
+				return nil, fmt.Errorf("invalid predicate %q", body)
+			}
+			pred.operand = localName(operand)
+			if strings.HasPrefix(operand, "@") {
+				pred.operand = "@" + localName(operand[1:])
+			}
+		}
+		preds = append(preds, pred)
+	}
+	return preds, nil
+}
+
+// localName strips the namespace prefix of a name
+func localName(name string) string {
+	if i := strings.LastIndexByte(name, ':'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// eval returns the string values of the nodes the path selects in the document, or their
+// number for count()
+func (x *xpath) eval(doc *xmlNode) []string {
+	nodes := []*xmlNode{doc}
+	for _, step := range x.steps {
+		var next []*xmlNode
+		seen := make(map[*xmlNode]bool)
+		for _, ctx := range nodes {
+			for _, n := range step.apply(ctx) {
+				if !seen[n] {
+					seen[n] = true
+					next = append(next, n)
+				}
+			}
+		}
+		nodes = next
+	}
+	if x.count {
+		return []string{strconv.Itoa(len(nodes))}
+	}
+	values := make([]string, len(nodes))
+	for i, n := range nodes {
+		values[i] = strings.TrimSpace(n.value())
+	}
+	return values
+}
+
+// apply returns the nodes the step selects from the context node
+func (step xpathStep) apply(ctx *xmlNode) []*xmlNode {
+	candidates := []*xmlNode{ctx}
+	if step.descendant {
+		candidates = descendants(ctx, candidates)
+	}
+	// positions count among the nodes selected from the same parent, //item[1] is every item
+	// that is the first of its parent
+	var matched []*xmlNode
+	for _, c := range candidates {
+		selected := selectNodes(c, step.test)
+		for _, pred := range step.predicates {
+			selected = pred.filter(selected)
+		}
+		matched = append(matched, selected...)
+	}
+	return matched
+}
+
+// descendants appends the element descendants of the node to nodes
+func descendants(n *xmlNode, nodes []*xmlNode) []*xmlNode {
+	for _, c := range n.children {
+		if !c.isText() {
+			nodes = append(nodes, c)
+			nodes = descendants(c, nodes)
+		}
+	}
+	return nodes
+}
+
+// selectNodes returns the nodes the test selects relative to n
+func selectNodes(n *xmlNode, test string) []*xmlNode {
+	switch {
+	case test == ".":
+		return []*xmlNode{n}
+	case test == "text()":
+		var texts []*xmlNode
+		for _, c := range n.children {
+			if c.isText() {
+				texts = append(texts, c)
+			}
+		}
+		return texts
+	case strings.HasPrefix(test, "@"):
+		var attrs []*xmlNode
+		for _, a := range n.attrs {
+			if test == "@*" || a.Name.Local == test[1:] {
+				attrs = append(attrs, &xmlNode{name: a.Name.Local, text: a.Value, attr: true})
+			}
+		}
+		return attrs
+	}
+	var elems []*xmlNode
+	for _, c := range n.children {
+		if !c.isText() && (test == "*" || c.name == test) {
+			elems = append(elems, c)
+		}
+	}
+	return elems
+}
+
+// filter returns the nodes that pass the predicate
+func (p xpathPredicate) filter(nodes []*xmlNode) []*xmlNode {
+	switch {
+	case p.position > 0:
+		if p.position > len(nodes) {
+			return nil
+		}
+		return nodes[p.position-1 : p.position]
+	case p.last:
+		if len(nodes) == 0 {
+			return nil
+		}
+		return nodes[len(nodes)-1:]
+	}
+	var passed []*xmlNode
+	for _, n := range nodes {
+		for _, operand := range selectNodes(n, p.operand) {
+			if !p.compare || strings.TrimSpace(operand.value()) == p.value {
+				passed = append(passed, n)
+				break
+			}
+		}
+	}
+	return passed
+}
@@ -0,0 +1,13 @@
+// Package zapadapter adapts zap loggers to scout.Logger
+package zapadapter
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/phenixrizen/scout"
+)
+
+// New returns a scout.Logger writing to the zap logger through its sugared logger
+func New(log *zap.Logger) scout.Logger {
+	return log.Sugar()
+}